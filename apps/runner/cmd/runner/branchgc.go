@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/repobox/runner/internal/branchgc"
+	"github.com/repobox/runner/internal/cacerts"
+	"github.com/repobox/runner/internal/config"
+	"github.com/repobox/runner/internal/mergerequest"
+	"github.com/repobox/runner/internal/redis"
+)
+
+// branchGCCommand runs the stale branch cleanup once and prints a summary.
+// Returns the process exit code: 0 on success, 1 on failure, 2 on usage errors.
+func branchGCCommand(args []string, configPath string) int {
+	if len(args) > 0 {
+		fmt.Fprintf(os.Stderr, "runner branch-gc: unexpected arguments: %s\n", strings.Join(args, " "))
+		return 2
+	}
+
+	cfg, err := config.LoadFile(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "runner branch-gc: failed to load config: %v\n", err)
+		return 1
+	}
+	mergerequest.SetHTTPTimeout(cfg.MRHTTPTimeout)
+	if err := cacerts.Configure(cfg.ExtraCACerts, cfg.TempDir); err != nil {
+		fmt.Fprintf(os.Stderr, "runner branch-gc: failed to load EXTRA_CA_CERTS: %v\n", err)
+		return 1
+	}
+	if !cfg.BranchGCEnabled {
+		fmt.Fprintln(os.Stderr, "runner branch-gc: branch cleanup is disabled, set BRANCH_GC_ENABLED=true")
+		return 1
+	}
+
+	// Logs go to stderr so stdout carries only the summary
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: config.ParseLogLevel(cfg.LogLevel)}))
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	redisClient, err := redis.NewClient(ctx, cfg.RedisURL, redisOptions(cfg))
+	if err != nil {
+		logger.Error("Failed to connect to Redis", "error", err)
+		return 1
+	}
+	defer redisClient.Close()
+
+	gc, err := branchgc.New(redisClient.Redis(), cfg, logger)
+	if err != nil {
+		logger.Error("Failed to create branch cleaner", "error", err)
+		return 1
+	}
+
+	report, err := gc.Run(ctx)
+	if err != nil {
+		logger.Error("Branch cleanup failed", "error", err)
+		return 1
+	}
+
+	deleted := "deleted"
+	if cfg.BranchGCDryRun {
+		deleted = "would delete (dry run)"
+	}
+	fmt.Printf("repositories: %d, branches: %d, %s: %d, kept: %d, errors: %d\n",
+		report.Repos, report.Branches, deleted, report.Deleted, report.Kept, report.Errors)
+	return 0
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/repobox/runner/internal/config"
+	"github.com/repobox/runner/internal/redis"
+)
+
+// cancelJobsCommand flags every running job of a user for cancellation and
+// prints how many were signaled. The runners holding the jobs stop them.
+// Returns the process exit code: 0 on success, 1 on failure, 2 on usage errors.
+func cancelJobsCommand(args []string, configPath string) int {
+	if len(args) != 1 || args[0] == "" {
+		fmt.Fprintln(os.Stderr, "usage: runner cancel-jobs <user-id>")
+		return 2
+	}
+	userID := args[0]
+
+	cfg, err := config.LoadFile(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "runner cancel-jobs: failed to load config: %v\n", err)
+		return 1
+	}
+
+	// Logs go to stderr so stdout carries only the count
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: config.ParseLogLevel(cfg.LogLevel)}))
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	redisClient, err := redis.NewClient(ctx, cfg.RedisURL, redisOptions(cfg))
+	if err != nil {
+		logger.Error("Failed to connect to Redis", "error", err)
+		return 1
+	}
+	defer redisClient.Close()
+
+	n, err := redis.CancelUserJobs(ctx, redisClient.Redis(), userID)
+	if err != nil {
+		logger.Error("Cancelling jobs failed", "user_id", userID, "signaled", n, "error", err)
+		return 1
+	}
+
+	fmt.Printf("signaled: %d\n", n)
+	return 0
+}
@@ -2,35 +2,120 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
+	"os/exec"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/repobox/runner/internal/agent"
+	"github.com/repobox/runner/internal/branchgc"
+	"github.com/repobox/runner/internal/cacerts"
 	"github.com/repobox/runner/internal/cleanup"
 	"github.com/repobox/runner/internal/config"
 	"github.com/repobox/runner/internal/consumer"
 	"github.com/repobox/runner/internal/executor"
+	"github.com/repobox/runner/internal/mergerequest"
 	"github.com/repobox/runner/internal/redis"
 	"github.com/repobox/runner/internal/session"
+	"github.com/repobox/runner/internal/telemetry"
+	"github.com/repobox/runner/internal/version"
 	"github.com/repobox/runner/internal/worker"
 )
 
+// splitConfigFlag removes --config <path> (or --config=<path>) from args and
+// returns the remaining args and the config file path, REPOBOX_CONFIG when
+// the flag is absent
+func splitConfigFlag(args []string) ([]string, string, error) {
+	path := os.Getenv("REPOBOX_CONFIG")
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--config" || arg == "-config":
+			if i+1 >= len(args) || args[i+1] == "" {
+				return nil, "", fmt.Errorf("%s requires a path", arg)
+			}
+			path = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--config=") || strings.HasPrefix(arg, "-config="):
+			_, path, _ = strings.Cut(arg, "=")
+			if path == "" {
+				return nil, "", fmt.Errorf("--config requires a path")
+			}
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, path, nil
+}
+
 func main() {
+	// The agent CLI runs behind this bridge inside its network namespace; its
+	// arguments are the CLI's, so they aren't parsed as runner flags
+	if len(os.Args) > 1 && os.Args[1] == agent.NetnsBridgeCommand {
+		os.Exit(agent.RunNetnsBridge(os.Args[2:]))
+	}
+
+	args, configPath, err := splitConfigFlag(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "runner: %v\n", err)
+		os.Exit(2)
+	}
+
+	if len(args) > 0 && (args[0] == "--version" || args[0] == "-version") {
+		fmt.Println(version.Get())
+		return
+	}
+
+	// "runner run" processes a single job locally for debugging
+	if len(args) > 0 && args[0] == "run" {
+		os.Exit(runCommand(args[1:], configPath))
+	}
+
+	// "runner branch-gc" deletes stale remote branches once
+	if len(args) > 0 && args[0] == "branch-gc" {
+		os.Exit(branchGCCommand(args[1:], configPath))
+	}
+
+	// "runner cancel-jobs <user-id>" cancels all running jobs of a user
+	if len(args) > 0 && args[0] == "cancel-jobs" {
+		os.Exit(cancelJobsCommand(args[1:], configPath))
+	}
+
 	// Load config first to get log settings
-	cfg, err := config.Load()
+	cfg, err := config.LoadFile(configPath)
 	if err != nil {
 		// Fallback logger for config errors
 		slog.Error("Failed to load config", "error", err)
 		os.Exit(1)
 	}
+	if err := cfg.PrepareDirs(); err != nil {
+		slog.Error("Failed to prepare directories", "error", err)
+		os.Exit(1)
+	}
+
+	mergerequest.SetHTTPTimeout(cfg.MRHTTPTimeout)
+	if err := cacerts.Configure(cfg.ExtraCACerts, cfg.TempDir); err != nil {
+		slog.Error("Failed to load EXTRA_CA_CERTS", "error", err)
+		os.Exit(1)
+	}
 
 	// Setup structured logging from config
 	logger := cfg.NewLogger()
 	slog.SetDefault(logger)
 
+	build := version.Get()
 	logger.Info("Starting Repobox Runner...",
+		"version", build.Version,
+		"commit", build.Commit,
+		"build_date", build.BuildDate,
+		"go_version", build.GoVersion,
 		"log_level", cfg.LogLevel,
 		"log_format", cfg.LogFormat,
 	)
@@ -38,8 +123,30 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Fail fast instead of mid-job when git or the agent CLI is missing
+	binaries := requiredBinaries(cfg)
+	paths, err := checkBinaries(binaries, exec.LookPath)
+	if err != nil {
+		logger.Error("Preflight failed", "error", err)
+		os.Exit(1)
+	}
+	for _, bin := range binaries {
+		logger.Info("Found binary", "name", bin.Name, "path", paths[bin.Name], "version", binaryVersion(ctx, paths[bin.Name]))
+	}
+	if err := checkAgentNetwork(ctx, cfg); err != nil {
+		logger.Error("Preflight failed", "error", err)
+		os.Exit(1)
+	}
+
+	// Tracing is a no-op unless OTEL_EXPORTER_OTLP_ENDPOINT is set
+	shutdownTracing, err := telemetry.Setup(ctx, cfg.OTelEndpoint, cfg.RunnerID)
+	if err != nil {
+		logger.Error("Failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+
 	// Connect to Redis first (needed for cleanup)
-	redisClient, err := redis.NewClient(ctx, cfg.RedisURL)
+	redisClient, err := redis.NewClient(ctx, cfg.RedisURL, redisOptions(cfg))
 	if err != nil {
 		logger.Error("Failed to connect to Redis", "error", err)
 		os.Exit(1)
@@ -60,6 +167,7 @@ func main() {
 		MaxAge:        cfg.CleanupMaxAge,
 		MaxDiskMB:     cfg.CleanupMaxDiskMB,
 		SessionMaxAge: 24 * time.Hour, // Sessions timeout after 24h
+		OutputLogDir:  cfg.OutputLogDir,
 	}, redisClient.Redis(), logger)
 
 	// Run startup cleanup
@@ -70,6 +178,16 @@ func main() {
 	// Start periodic cleanup
 	cleaner.Start(ctx)
 
+	// Delete remote branches of merged or closed MRs, only when enabled
+	if cfg.BranchGCEnabled {
+		gc, err := branchgc.New(redisClient.Redis(), cfg, logger)
+		if err != nil {
+			logger.Error("Failed to create branch cleaner", "error", err)
+			os.Exit(1)
+		}
+		gc.Start(ctx)
+	}
+
 	// Create executor
 	exec, err := executor.NewExecutor(redisClient.Redis(), cfg, logger)
 	if err != nil {
@@ -80,8 +198,7 @@ func main() {
 	// Create consumer (needed for ACK)
 	cons := consumer.NewConsumer(
 		redisClient.Redis(),
-		cfg.RunnerID,
-		cfg.MaxJobsPerUser,
+		cfg,
 		nil, // Will set pool after creation
 		logger,
 	)
@@ -89,6 +206,12 @@ func main() {
 	// Job handler wraps executor + ACK
 	jobHandler := func(ctx context.Context, msg *worker.JobMessage) error {
 		err := exec.Execute(ctx, msg)
+		if errors.Is(err, executor.ErrJobRunning) {
+			// A redelivery of a job still running elsewhere - its worker ACKs the message
+			logger.Info("job already running, skipping redelivered message", "job_id", msg.Job.ID, "stream_id", msg.StreamID)
+			cons.ReleaseJob(ctx, msg)
+			return nil
+		}
 		// Always ACK and decrement counter, regardless of success/failure
 		cons.AckJob(ctx, msg)
 		return err
@@ -100,8 +223,7 @@ func main() {
 	// Update consumer with pool
 	cons = consumer.NewConsumer(
 		redisClient.Redis(),
-		cfg.RunnerID,
-		cfg.MaxJobsPerUser,
+		cfg,
 		pool,
 		logger,
 	)
@@ -129,6 +251,22 @@ func main() {
 		}
 	}()
 
+	// Serve build info and in-flight work when HTTP_ADDR is set
+	var httpServer *http.Server
+	if cfg.HTTPAddr != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/version", version.Handler)
+		mux.Handle("/jobs", pool.Activity())
+		mux.Handle("/sessions", sessionConsumer.Activity())
+		httpServer = &http.Server{Addr: cfg.HTTPAddr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+		go func() {
+			if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("HTTP server error", "error", err)
+			}
+		}()
+		logger.Info("HTTP server listening", "addr", cfg.HTTPAddr)
+	}
+
 	logger.Info("Runner started and waiting for jobs")
 
 	// Wait for shutdown signal
@@ -141,8 +279,35 @@ func main() {
 	// Cancel context to stop consumer
 	cancel()
 
+	if httpServer != nil {
+		httpCtx, httpCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		httpServer.Shutdown(httpCtx)
+		httpCancel()
+	}
+
 	// Stop worker pool (waits for in-flight jobs)
 	pool.Stop()
 
+	// Flush buffered spans
+	flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer flushCancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		logger.Warn("Failed to flush traces", "error", err)
+	}
+
 	logger.Info("Runner shutdown complete")
 }
+
+// redisOptions maps the Redis connection settings from config
+func redisOptions(cfg *config.Config) redis.Options {
+	return redis.Options{
+		Mode:           cfg.RedisMode,
+		SentinelMaster: cfg.RedisSentinelMaster,
+		Addrs:          cfg.RedisAddrs,
+		PoolSize:       cfg.RedisPoolSize,
+		DialTimeout:    cfg.RedisDialTimeout,
+		TLSCAFile:      cfg.RedisTLSCAFile,
+		TLSSkipVerify:  cfg.RedisTLSSkipVerify,
+		KeyPrefix:      cfg.RedisKeyPrefix,
+	}
+}
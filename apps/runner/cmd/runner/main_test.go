@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitConfigFlag(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		env      string
+		wantArgs []string
+		wantPath string
+		wantErr  string
+	}{
+		{name: "no flag", args: []string{"run", "--job-id", "j1"}, wantArgs: []string{"run", "--job-id", "j1"}},
+		{name: "env fallback", args: nil, env: "/etc/repobox.yaml", wantArgs: []string{}, wantPath: "/etc/repobox.yaml"},
+		{name: "separate value", args: []string{"--config", "runner.yml"}, wantArgs: []string{}, wantPath: "runner.yml"},
+		{name: "equals form", args: []string{"--config=runner.yaml", "--version"}, wantArgs: []string{"--version"}, wantPath: "runner.yaml"},
+		{name: "flag overrides env", args: []string{"run", "-config", "a.yaml", "--job-id", "j1"}, env: "b.yaml", wantArgs: []string{"run", "--job-id", "j1"}, wantPath: "a.yaml"},
+		{name: "missing value", args: []string{"--config"}, wantErr: "requires a path"},
+		{name: "empty equals", args: []string{"--config="}, wantErr: "requires a path"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("REPOBOX_CONFIG", tt.env)
+
+			args, path, err := splitConfigFlag(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("splitConfigFlag() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("splitConfigFlag() error = %v", err)
+			}
+			if strings.Join(args, " ") != strings.Join(tt.wantArgs, " ") {
+				t.Errorf("args = %q, want %q", args, tt.wantArgs)
+			}
+			if path != tt.wantPath {
+				t.Errorf("path = %q, want %q", path, tt.wantPath)
+			}
+		})
+	}
+}
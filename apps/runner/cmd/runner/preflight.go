@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/repobox/runner/internal/agent"
+	"github.com/repobox/runner/internal/config"
+)
+
+// requiredBinary is an external program the runner shells out to
+type requiredBinary struct {
+	Name string // Command or path as configured, e.g. "git" or AI_CLI_PATH
+	Hint string // How to fix a missing binary
+}
+
+// requiredBinaries lists the programs jobs need: git always, the agent CLI
+// unless the runner is in mock mode
+func requiredBinaries(cfg *config.Config) []requiredBinary {
+	bins := []requiredBinary{{Name: "git", Hint: "install git in the runner image"}}
+	if cfg.AIEnabled {
+		cli := cfg.AICLIPath
+		if cli == "" {
+			cli = "claude"
+		}
+		bins = append(bins, requiredBinary{
+			Name: cli,
+			Hint: "install it (npm install -g @anthropic-ai/claude-code), set AI_CLI_PATH, or set AI_ENABLED=false for mock mode",
+		})
+	}
+	return bins
+}
+
+// checkBinaries resolves each binary with lookPath and returns their paths by
+// name, or an error naming every missing one
+func checkBinaries(bins []requiredBinary, lookPath func(string) (string, error)) (map[string]string, error) {
+	paths := make(map[string]string, len(bins))
+	var missing []string
+	for _, bin := range bins {
+		path, err := lookPath(bin.Name)
+		if err != nil {
+			missing = append(missing, fmt.Sprintf("%s not found on PATH: %s", bin.Name, bin.Hint))
+			continue
+		}
+		paths[bin.Name] = path
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("required binaries missing: %s", strings.Join(missing, "; "))
+	}
+	return paths, nil
+}
+
+// checkAgentNetwork makes sure the agent can be isolated when AGENT_NETWORK
+// restricts it, so a host without user namespaces fails at startup
+func checkAgentNetwork(ctx context.Context, cfg *config.Config) error {
+	if cfg.AgentNetwork == "" || cfg.AgentNetwork == agent.NetworkOpen {
+		return nil
+	}
+	if err := agent.CheckNetworkIsolation(ctx); err != nil {
+		return fmt.Errorf("AGENT_NETWORK=%s needs a network namespace for the agent (allow unprivileged user namespaces, e.g. kernel.unprivileged_userns_clone=1 or a seccomp profile permitting them): %w", cfg.AgentNetwork, err)
+	}
+	return nil
+}
+
+// binaryVersion returns the first line of "<path> --version", or "unknown"
+func binaryVersion(ctx context.Context, path string) string {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, path, "--version").Output()
+	if err != nil {
+		return "unknown"
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	return line
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/repobox/runner/internal/config"
+)
+
+func TestRequiredBinaries(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+		want []string
+	}{
+		{"mock mode skips the CLI", config.Config{AIEnabled: false, AICLIPath: "claude"}, []string{"git"}},
+		{"agent CLI", config.Config{AIEnabled: true, AICLIPath: "/opt/bin/claude"}, []string{"git", "/opt/bin/claude"}},
+		{"default CLI name", config.Config{AIEnabled: true}, []string{"git", "claude"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, bin := range requiredBinaries(&tt.cfg) {
+				got = append(got, bin.Name)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("requiredBinaries() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckBinaries(t *testing.T) {
+	bins := requiredBinaries(&config.Config{AIEnabled: true, AICLIPath: "claude"})
+
+	tests := []struct {
+		name      string
+		installed map[string]string
+		wantErr   []string
+	}{
+		{"all found", map[string]string{"git": "/usr/bin/git", "claude": "/usr/local/bin/claude"}, nil},
+		{"cli missing", map[string]string{"git": "/usr/bin/git"}, []string{"claude not found on PATH", "AI_CLI_PATH"}},
+		{"both missing", map[string]string{}, []string{"git not found on PATH", "claude not found on PATH"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookPath := func(name string) (string, error) {
+				if path, ok := tt.installed[name]; ok {
+					return path, nil
+				}
+				return "", errors.New("executable file not found in $PATH")
+			}
+
+			paths, err := checkBinaries(bins, lookPath)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("checkBinaries() error = %v", err)
+				}
+				for name, want := range tt.installed {
+					if paths[name] != want {
+						t.Errorf("path of %s = %q, want %q", name, paths[name], want)
+					}
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("checkBinaries() error = nil, want missing binaries")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("checkBinaries() error = %q, want it to mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckAgentNetwork_Open(t *testing.T) {
+	for _, mode := range []string{"", "open"} {
+		if err := checkAgentNetwork(context.Background(), &config.Config{AgentNetwork: mode}); err != nil {
+			t.Errorf("checkAgentNetwork(%q) error = %v, want nil", mode, err)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/cacerts"
+	"github.com/repobox/runner/internal/config"
+	"github.com/repobox/runner/internal/consumer"
+	"github.com/repobox/runner/internal/executor"
+	"github.com/repobox/runner/internal/git"
+	"github.com/repobox/runner/internal/job"
+	"github.com/repobox/runner/internal/mergerequest"
+	"github.com/repobox/runner/internal/redis"
+	"github.com/repobox/runner/internal/worker"
+)
+
+// runOptions holds the flags of the "run" subcommand
+type runOptions struct {
+	JobID       string
+	RepoURL     string
+	Prompt      string
+	ProviderID  string
+	UserID      string
+	Environment string
+}
+
+// parseRunArgs parses "run" flags. Either --job-id (an existing job in Redis)
+// or --repo-url with --prompt, --provider-id and --user-id is required.
+func parseRunArgs(args []string, stderr io.Writer) (*runOptions, error) {
+	opts := &runOptions{}
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&opts.JobID, "job-id", "", "run an existing job from Redis")
+	fs.StringVar(&opts.RepoURL, "repo-url", "", "repository to clone for a synthetic job")
+	fs.StringVar(&opts.Prompt, "prompt", "", "prompt for a synthetic job")
+	fs.StringVar(&opts.ProviderID, "provider-id", "", "git provider whose token is used (defaults to the job's provider)")
+	fs.StringVar(&opts.UserID, "user-id", "", "owner of the provider (required for a synthetic job)")
+	fs.StringVar(&opts.Environment, "environment", "", "runtime environment for a synthetic job")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	if opts.JobID != "" {
+		if opts.RepoURL != "" || opts.Prompt != "" {
+			return nil, errors.New("--job-id cannot be combined with --repo-url or --prompt")
+		}
+		return opts, nil
+	}
+
+	var missing []string
+	for _, f := range []struct{ name, value string }{
+		{"--repo-url", opts.RepoURL},
+		{"--prompt", opts.Prompt},
+		{"--provider-id", opts.ProviderID},
+		{"--user-id", opts.UserID},
+	} {
+		if f.value == "" {
+			missing = append(missing, f.name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("either --job-id or all of --repo-url, --prompt, --provider-id and --user-id are required (missing %s)", strings.Join(missing, ", "))
+	}
+	return opts, nil
+}
+
+// buildRunMessage creates the job message for a "run" invocation: the stored
+// job when --job-id is given (jobData is its Redis hash), otherwise a synthetic job
+func buildRunMessage(opts *runOptions, jobData map[string]string, now time.Time) (*worker.JobMessage, error) {
+	if opts.JobID != "" {
+		if len(jobData) == 0 {
+			return nil, fmt.Errorf("job not found: %s", opts.JobID)
+		}
+		j, err := consumer.ParseJobFromHash(jobData)
+		if err != nil {
+			return nil, err
+		}
+		providerID := opts.ProviderID
+		if providerID == "" {
+			providerID = j.ProviderID
+		}
+		return &worker.JobMessage{Job: j, ProviderID: providerID}, nil
+	}
+
+	j := &job.Job{
+		ID:          fmt.Sprintf("local-%d", now.UnixMilli()),
+		UserID:      opts.UserID,
+		ProviderID:  opts.ProviderID,
+		RepoURL:     opts.RepoURL,
+		RepoName:    git.RepoDisplayName(opts.RepoURL, false),
+		Prompt:      opts.Prompt,
+		Environment: opts.Environment,
+		Status:      job.StatusPending,
+		CreatedAt:   now,
+	}
+	return &worker.JobMessage{Job: j, ProviderID: opts.ProviderID}, nil
+}
+
+// runCommand executes a single job without the stream consumers and prints
+// its output. Returns the process exit code: 0 on success, 1 on failure, 2 on usage errors.
+func runCommand(args []string, configPath string) int {
+	opts, err := parseRunArgs(args, os.Stderr)
+	if err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "runner run: %v\n", err)
+		}
+		return 2
+	}
+
+	cfg, err := config.LoadFile(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "runner run: failed to load config: %v\n", err)
+		return 1
+	}
+	if err := cfg.PrepareDirs(); err != nil {
+		fmt.Fprintf(os.Stderr, "runner run: %v\n", err)
+		return 1
+	}
+	mergerequest.SetHTTPTimeout(cfg.MRHTTPTimeout)
+	if err := cacerts.Configure(cfg.ExtraCACerts, cfg.TempDir); err != nil {
+		fmt.Fprintf(os.Stderr, "runner run: failed to load EXTRA_CA_CERTS: %v\n", err)
+		return 1
+	}
+
+	// Logs go to stderr so stdout carries only the job output
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: config.ParseLogLevel(cfg.LogLevel)}))
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if _, err := checkBinaries(requiredBinaries(cfg), exec.LookPath); err != nil {
+		logger.Error("Preflight failed", "error", err)
+		return 1
+	}
+	if err := checkAgentNetwork(ctx, cfg); err != nil {
+		logger.Error("Preflight failed", "error", err)
+		return 1
+	}
+
+	redisClient, err := redis.NewClient(ctx, cfg.RedisURL, redisOptions(cfg))
+	if err != nil {
+		logger.Error("Failed to connect to Redis", "error", err)
+		return 1
+	}
+	defer redisClient.Close()
+	rdb := redisClient.Redis()
+
+	var jobData map[string]string
+	if opts.JobID != "" {
+		if jobData, err = rdb.HGetAll(ctx, redis.JobKey(opts.JobID)).Result(); err != nil {
+			logger.Error("Failed to load job", "job_id", opts.JobID, "error", err)
+			return 1
+		}
+	}
+
+	msg, err := buildRunMessage(opts, jobData, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "runner run: %v\n", err)
+		return 1
+	}
+
+	exec, err := executor.NewExecutor(rdb, cfg, logger)
+	if err != nil {
+		logger.Error("Failed to create executor", "error", err)
+		return 1
+	}
+
+	// Print the job output while it runs
+	printer := &outputPrinter{rdb: rdb, key: redis.JobOutputKey(msg.Job.ID), w: os.Stdout}
+	printCtx, stopPrinting := context.WithCancel(context.Background())
+	printed := make(chan struct{})
+	go func() {
+		defer close(printed)
+		printer.follow(printCtx, 200*time.Millisecond)
+	}()
+
+	logger.Info("Running job", "job_id", msg.Job.ID, "repo", msg.Job.RepoURL)
+	execErr := exec.Execute(ctx, msg)
+
+	stopPrinting()
+	<-printed
+
+	if execErr != nil {
+		logger.Error("Job failed", "job_id", msg.Job.ID, "error", execErr)
+		return 1
+	}
+	logger.Info("Job succeeded", "job_id", msg.Job.ID)
+	return 0
+}
+
+// outputPrinter prints new entries of a job output list
+type outputPrinter struct {
+	rdb  goredis.UniversalClient
+	key  string
+	w    io.Writer
+	next int64
+}
+
+// follow prints new entries every interval until ctx is done, then prints the rest
+func (p *outputPrinter) follow(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			p.print(context.Background())
+			return
+		case <-ticker.C:
+			p.print(ctx)
+		}
+	}
+}
+
+// print writes entries added since the last call
+func (p *outputPrinter) print(ctx context.Context) {
+	entries, err := p.rdb.LRange(ctx, p.key, p.next, -1).Result()
+	if err != nil {
+		return
+	}
+	p.next += int64(len(entries))
+
+	for _, raw := range entries {
+		var entry struct {
+			Line   string `json:"line"`
+			Stream string `json:"stream"`
+		}
+		if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+			continue
+		}
+		if entry.Stream == "stderr" {
+			fmt.Fprintf(p.w, "[stderr] %s\n", entry.Line)
+		} else {
+			fmt.Fprintln(p.w, entry.Line)
+		}
+	}
+}
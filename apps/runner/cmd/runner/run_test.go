@@ -0,0 +1,140 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/repobox/runner/internal/job"
+)
+
+func TestParseRunArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    runOptions
+		wantErr string
+	}{
+		{
+			name: "existing job",
+			args: []string{"--job-id", "job-123"},
+			want: runOptions{JobID: "job-123"},
+		},
+		{
+			name: "synthetic job",
+			args: []string{"--repo-url", "https://github.com/owner/repo.git", "--prompt", "Fix the tests",
+				"--provider-id", "prov-1", "--user-id", "user-1", "--environment", "python"},
+			want: runOptions{RepoURL: "https://github.com/owner/repo.git", Prompt: "Fix the tests",
+				ProviderID: "prov-1", UserID: "user-1", Environment: "python"},
+		},
+		{
+			name:    "nothing given",
+			args:    nil,
+			wantErr: "missing --repo-url, --prompt, --provider-id, --user-id",
+		},
+		{
+			name:    "synthetic job without provider",
+			args:    []string{"--repo-url", "https://github.com/owner/repo.git", "--prompt", "Fix", "--user-id", "user-1"},
+			wantErr: "missing --provider-id",
+		},
+		{
+			name:    "job id with prompt",
+			args:    []string{"--job-id", "job-123", "--prompt", "Fix"},
+			wantErr: "cannot be combined",
+		},
+		{
+			name:    "positional arguments",
+			args:    []string{"--job-id", "job-123", "extra"},
+			wantErr: "unexpected arguments: extra",
+		},
+		{
+			name:    "unknown flag",
+			args:    []string{"--bogus"},
+			wantErr: "flag provided but not defined",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRunArgs(tt.args, io.Discard)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseRunArgs() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRunArgs() error = %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("parseRunArgs() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildRunMessage(t *testing.T) {
+	now := time.UnixMilli(1700000000000)
+
+	t.Run("synthetic job", func(t *testing.T) {
+		msg, err := buildRunMessage(&runOptions{
+			RepoURL:     "https://gitlab.com/group/app.git",
+			Prompt:      "Add a README",
+			ProviderID:  "prov-1",
+			UserID:      "user-1",
+			Environment: "php",
+		}, nil, now)
+		if err != nil {
+			t.Fatalf("buildRunMessage() error = %v", err)
+		}
+
+		j := msg.Job
+		if j.ID != "local-1700000000000" {
+			t.Errorf("ID = %q, want local-1700000000000", j.ID)
+		}
+		if j.RepoName != "app" || j.Prompt != "Add a README" || j.Environment != "php" || j.UserID != "user-1" {
+			t.Errorf("job = %+v", j)
+		}
+		if j.Status != job.StatusPending || !j.CreatedAt.Equal(now) {
+			t.Errorf("status = %q, created = %v", j.Status, j.CreatedAt)
+		}
+		if msg.ProviderID != "prov-1" || msg.Action != "" {
+			t.Errorf("ProviderID = %q, Action = %q", msg.ProviderID, msg.Action)
+		}
+	})
+
+	t.Run("existing job", func(t *testing.T) {
+		data := map[string]string{
+			"id":          "job-123",
+			"user_id":     "user-1",
+			"provider_id": "prov-1",
+			"repo_url":    "https://github.com/owner/repo.git",
+			"prompt":      "Fix the tests",
+			"status":      "failed",
+		}
+
+		msg, err := buildRunMessage(&runOptions{JobID: "job-123"}, data, now)
+		if err != nil {
+			t.Fatalf("buildRunMessage() error = %v", err)
+		}
+		if msg.Job.ID != "job-123" || msg.Job.Prompt != "Fix the tests" {
+			t.Errorf("job = %+v", msg.Job)
+		}
+		if msg.ProviderID != "prov-1" {
+			t.Errorf("ProviderID = %q, want the job's provider", msg.ProviderID)
+		}
+
+		// An explicit provider overrides the job's
+		msg, _ = buildRunMessage(&runOptions{JobID: "job-123", ProviderID: "prov-2"}, data, now)
+		if msg.ProviderID != "prov-2" {
+			t.Errorf("ProviderID = %q, want prov-2", msg.ProviderID)
+		}
+	})
+
+	t.Run("missing job", func(t *testing.T) {
+		if _, err := buildRunMessage(&runOptions{JobID: "job-404"}, map[string]string{}, now); err == nil {
+			t.Error("buildRunMessage() error = nil, want job not found")
+		}
+	})
+}
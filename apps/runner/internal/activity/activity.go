@@ -0,0 +1,123 @@
+// Package activity keeps a registry of the jobs and session tasks a runner is
+// working on, served read-only on the HTTP server for operators
+package activity
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Phases an executor reports while it works
+const (
+	PhaseStarting     = "starting"
+	PhaseClone        = "clone"
+	PhaseAgent        = "agent"
+	PhaseValidate     = "validate"
+	PhaseCommit       = "commit"
+	PhasePush         = "push"
+	PhaseMergeRequest = "merge_request"
+)
+
+// Entry describes one piece of in-flight work
+type Entry struct {
+	ID        string    `json:"id"`               // Job ID, or session ID for session tasks
+	Kind      string    `json:"kind"`             // run or retry_push for jobs; init, prompt or push for sessions
+	JobID     string    `json:"job_id,omitempty"` // Session prompt's job ID
+	UserID    string    `json:"user_id"`
+	Phase     string    `json:"phase"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// Registry tracks in-flight work. A nil *Registry tracks nothing.
+type Registry struct {
+	mu      sync.Mutex
+	next    uint64
+	entries map[uint64]*Entry
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{entries: make(map[uint64]*Entry)}
+}
+
+type contextKey struct{}
+
+// tracked points at a registered entry, so executors can update its phase
+// through the context
+type tracked struct {
+	r  *Registry
+	id uint64
+}
+
+// Start registers e in the starting phase and returns a context carrying it
+// for SetPhase, and a func that removes it once the work is done
+func (r *Registry) Start(ctx context.Context, e Entry) (context.Context, func()) {
+	if r == nil {
+		return ctx, func() {}
+	}
+	e.Phase = PhaseStarting
+	e.StartedAt = time.Now()
+
+	r.mu.Lock()
+	r.next++
+	id := r.next
+	r.entries[id] = &e
+	r.mu.Unlock()
+
+	done := func() {
+		r.mu.Lock()
+		delete(r.entries, id)
+		r.mu.Unlock()
+	}
+	return context.WithValue(ctx, contextKey{}, tracked{r: r, id: id}), done
+}
+
+// SetPhase updates the phase of the work registered in ctx. It does nothing
+// when ctx carries none, e.g. in tests or "runner run".
+func SetPhase(ctx context.Context, phase string) {
+	t, ok := ctx.Value(contextKey{}).(tracked)
+	if !ok {
+		return
+	}
+	t.r.mu.Lock()
+	defer t.r.mu.Unlock()
+	if e, ok := t.r.entries[t.id]; ok {
+		e.Phase = phase
+	}
+}
+
+// List returns a copy of the registered entries, oldest first
+func (r *Registry) List() []Entry {
+	list := []Entry{}
+	if r == nil {
+		return list
+	}
+	r.mu.Lock()
+	for _, e := range r.entries {
+		list = append(list, *e)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].StartedAt.Equal(list[j].StartedAt) {
+			return list[i].StartedAt.Before(list[j].StartedAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// ServeHTTP serves the entries as a JSON array
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(r.List())
+}
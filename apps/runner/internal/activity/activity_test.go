@@ -0,0 +1,104 @@
+package activity
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+
+	ctx1, done1 := r.Start(context.Background(), Entry{ID: "job-1", Kind: "run", UserID: "user-1"})
+	_, done2 := r.Start(context.Background(), Entry{ID: "job-2", Kind: "retry_push", UserID: "user-2"})
+
+	list := r.List()
+	if len(list) != 2 {
+		t.Fatalf("List() returned %d entries, want 2", len(list))
+	}
+	if list[0].ID != "job-1" || list[1].ID != "job-2" {
+		t.Errorf("List() order = %s, %s, want job-1, job-2", list[0].ID, list[1].ID)
+	}
+	if list[0].Phase != PhaseStarting || list[0].StartedAt.IsZero() {
+		t.Errorf("new entry = %+v, want starting phase and a start time", list[0])
+	}
+
+	SetPhase(ctx1, PhaseAgent)
+	if got := r.List()[0].Phase; got != PhaseAgent {
+		t.Errorf("phase after SetPhase = %q, want %q", got, PhaseAgent)
+	}
+
+	done1()
+	list = r.List()
+	if len(list) != 1 || list[0].ID != "job-2" {
+		t.Errorf("List() after done = %+v, want only job-2", list)
+	}
+
+	// A finished entry's context no longer changes anything
+	SetPhase(ctx1, PhasePush)
+	done2()
+	if list := r.List(); len(list) != 0 {
+		t.Errorf("List() after all done = %+v, want empty", list)
+	}
+}
+
+func TestRegistry_Nil(t *testing.T) {
+	var r *Registry
+	ctx, done := r.Start(context.Background(), Entry{ID: "job-1"})
+	SetPhase(ctx, PhaseClone)
+	done()
+	if list := r.List(); list == nil || len(list) != 0 {
+		t.Errorf("List() on nil registry = %#v, want empty slice", list)
+	}
+
+	// Without a registered entry SetPhase is a no-op
+	SetPhase(context.Background(), PhaseClone)
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := NewRegistry()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs", nil))
+	if body := rec.Body.String(); body != "[]\n" {
+		t.Errorf("empty registry body = %q, want []", body)
+	}
+
+	ctx, done := r.Start(context.Background(), Entry{ID: "s1", Kind: "prompt", JobID: "job-1", UserID: "user-1"})
+	defer done()
+	SetPhase(ctx, PhaseCommit)
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sessions", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+
+	var got []map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %d entries, want 1", len(got))
+	}
+	want := map[string]string{"id": "s1", "kind": "prompt", "job_id": "job-1", "user_id": "user-1", "phase": "commit"}
+	for key, value := range want {
+		if got[0][key] != value {
+			t.Errorf("%s = %v, want %q", key, got[0][key], value)
+		}
+	}
+	if _, ok := got[0]["started_at"].(string); !ok {
+		t.Errorf("started_at = %v, want a timestamp", got[0]["started_at"])
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/jobs", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
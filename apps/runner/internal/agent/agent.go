@@ -2,6 +2,18 @@ package agent
 
 import (
 	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrTimeout is returned when the agent run exceeds its deadline
+	ErrTimeout = errors.New("agent execution timed out")
+	// ErrCancelled is returned when the agent run is cancelled
+	ErrCancelled = errors.New("agent execution cancelled")
+	// ErrStalled is returned when the CLI produced no output for the idle timeout
+	ErrStalled = errors.New("agent stalled")
 )
 
 // OutputSource identifies the origin of output lines
@@ -12,8 +24,25 @@ const (
 	SourceRunner OutputSource = "runner"
 	// SourceClaude indicates output from Claude Code CLI
 	SourceClaude OutputSource = "claude"
+	// SourcePrompt indicates the user's prompt recorded for audit
+	SourcePrompt OutputSource = "prompt"
+	// SourceHeartbeat indicates a keepalive line written while the agent is quiet
+	SourceHeartbeat OutputSource = "heartbeat"
+	// SourceThinking indicates the agent's reasoning, kept apart from its answers
+	SourceThinking OutputSource = "thinking"
+	// SourceValidate indicates output from the repository's validation command
+	SourceValidate OutputSource = "validate"
 )
 
+// Valid reports whether s is one of the sources above
+func (s OutputSource) Valid() bool {
+	switch s {
+	case SourceRunner, SourceClaude, SourcePrompt, SourceHeartbeat, SourceThinking, SourceValidate:
+		return true
+	}
+	return false
+}
+
 // OutputWriter is a callback for streaming agent output
 type OutputWriter func(stream string, source OutputSource, line string)
 
@@ -22,7 +51,9 @@ type Agent interface {
 	// Execute runs the agent with the given prompt in the working directory.
 	// Output is streamed via the OutputWriter callback.
 	// Returns error if execution fails, times out, or exits with non-zero code.
-	Execute(ctx context.Context, opts ExecuteOptions) error
+	// The Result is never nil, also on error: it holds what the run reported
+	// before it ended.
+	Execute(ctx context.Context, opts ExecuteOptions) (*Result, error)
 }
 
 // ExecuteOptions contains all options for agent execution
@@ -33,23 +64,78 @@ type ExecuteOptions struct {
 	// Prompt is the user's instruction for the AI agent
 	Prompt string
 
+	// SystemPrompt is operator guidance appended to the agent's system prompt (optional)
+	SystemPrompt string
+
+	// ExtraArgs are operator CLI arguments (e.g. --model) added to the base arguments (optional)
+	ExtraArgs []string
+
+	// Env are NAME=value entries added to the CLI's environment, e.g. user secrets (optional)
+	Env []string
+
 	// Environment is the runtime environment (e.g., "default", "php", "python")
 	Environment string
 
 	// JobID is used for logging and identification
 	JobID string
 
+	// SessionID, RunnerID and TraceID correlate the run with the runner's
+	// logs and output; passed to the CLI as REPOBOX_* env vars (optional)
+	SessionID string
+	RunnerID  string
+	TraceID   string
+
 	// Output is the callback for streaming stdout/stderr lines
 	Output OutputWriter
+
+	// ResumeSessionID continues an earlier CLI conversation (--resume), so
+	// the agent keeps its context across a work session's prompts (optional)
+	ResumeSessionID string
+
+	// OnSession is called with the CLI's session ID once the run starts (optional)
+	OnSession func(id string)
+
+	// OnToolResult, when set, receives each tool result with its tool_use ID,
+	// its output line summary and its full content, and writes the summary
+	// line instead of Output, so the full result can be stored next to it (optional)
+	OnToolResult func(stream, toolUseID, summary, content string)
+
+	// Redact masks secrets in the lines kept in Config.OutputLogDir; without
+	// it no output log is written
+	Redact func(line string) string
 }
 
 // Result contains the outcome of agent execution
 type Result struct {
-	// ExitCode is the process exit code (0 = success)
+	// ExitCode is the process exit code (0 = success, -1 when the process
+	// never started or was killed)
 	ExitCode int
 
 	// Error contains any error message if execution failed
 	Error string
+
+	// Summary is the agent's final summary text, if one was reported
+	Summary string
+
+	// Usage reported by the CLI at the end of the run (zero when it reported none)
+	NumTurns     int
+	InputTokens  int
+	OutputTokens int
+	CostUSD      float64
+}
+
+// StatusFields returns the usage as job hash fields, or nil when the run
+// reported none
+func (r *Result) StatusFields() map[string]interface{} {
+	if r == nil || (r.NumTurns == 0 && r.InputTokens == 0 && r.OutputTokens == 0 && r.CostUSD == 0) {
+		return nil
+	}
+	return map[string]interface{}{
+		"agent_turns":         r.NumTurns,
+		"agent_input_tokens":  r.InputTokens,
+		"agent_output_tokens": r.OutputTokens,
+		"agent_cost_usd":      strconv.FormatFloat(r.CostUSD, 'f', -1, 64),
+	}
 }
 
 // Config holds agent-specific configuration
@@ -69,6 +155,32 @@ type Config struct {
 	// Timeout is the maximum execution time for the agent
 	Timeout int
 
+	// IdleTimeout kills the CLI when neither output stream produces data
+	// for this long (0 = off)
+	IdleTimeout time.Duration
+
 	// MaxOutputLines limits output to prevent memory issues
 	MaxOutputLines int
+
+	// OutputLogDir keeps every CLI output line, redacted with
+	// ExecuteOptions.Redact, in <dir>/<job_id>.log, including lines dropped
+	// by MaxOutputLines (empty = off)
+	OutputLogDir string
+
+	// OutputLogMaxBytes rotates a job's log file at this size (0 = no cap)
+	OutputLogMaxBytes int64
+
+	// BinaryOutputMode controls handling of binary data on the CLI output
+	// streams: "abort" (default), "skip" or "allow"
+	BinaryOutputMode string
+
+	// BashPolicy checks the agent's Bash tool commands (nil = no policy)
+	BashPolicy *BashPolicy
+
+	// Egress limits the hosts the CLI's network traffic may reach (nil = open)
+	Egress *EgressPolicy
+
+	// IncludeThinking streams thinking blocks as SourceThinking lines;
+	// when false they are dropped
+	IncludeThinking bool
 }
@@ -0,0 +1,61 @@
+package agent
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// Every output callback in the runner must satisfy OutputWriter
+var _ OutputWriter = func(stream string, source OutputSource, line string) {}
+
+func TestOutputSource_Valid(t *testing.T) {
+	tests := []struct {
+		source OutputSource
+		want   bool
+	}{
+		{SourceRunner, true},
+		{SourceClaude, true},
+		{SourcePrompt, true},
+		{SourceHeartbeat, true},
+		{SourceThinking, true},
+		{SourceValidate, true},
+		{"", false},
+		{"Runner", false},
+		{"stdout", false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.source.Valid(); got != tt.want {
+			t.Errorf("OutputSource(%q).Valid() = %v, want %v", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestOutputSource_RoundTrip(t *testing.T) {
+	sources := []OutputSource{SourceRunner, SourceClaude, SourcePrompt, SourceHeartbeat, SourceThinking, SourceValidate}
+
+	for _, source := range sources {
+		var got []string
+		var w OutputWriter = func(stream string, s OutputSource, line string) {
+			data, err := json.Marshal(map[string]interface{}{"stream": stream, "source": s, "line": line})
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			var entry struct {
+				Source OutputSource `json:"source"`
+			}
+			if err := json.Unmarshal(data, &entry); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			got = append(got, string(entry.Source))
+			if !entry.Source.Valid() {
+				t.Errorf("decoded source %q is not valid", entry.Source)
+			}
+		}
+		w("stdout", source, "line")
+
+		if len(got) != 1 || got[0] != string(source) {
+			t.Errorf("source %q round-tripped as %q", source, got)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// reservedArgs are CLI flags the runner sets itself; overriding them would
+// break prompt passing or stream-json parsing
+var reservedArgs = map[string]string{
+	"-p":                     "the prompt is passed by the runner",
+	"--print":                "the runner always runs the CLI non-interactively",
+	"--output-format":        "the runner parses stream-json output",
+	"--input-format":         "the prompt is passed as text",
+	"--append-system-prompt": "use AI_INSTRUCTIONS for system instructions",
+}
+
+// CLIArgs holds the extra CLI arguments added to every agent run, globally and
+// per environment. The zero value adds nothing.
+type CLIArgs struct {
+	global []string
+	env    map[string][]string
+}
+
+// LoadCLIArgs parses the global arguments (whitespace-separated) and the
+// environment -> arguments JSON object. Reserved flags return an error so the
+// runner fails at startup.
+func LoadCLIArgs(global, perEnv string) (CLIArgs, error) {
+	args := CLIArgs{global: strings.Fields(global)}
+	if err := checkReservedArgs(args.global); err != nil {
+		return CLIArgs{}, fmt.Errorf("invalid AI_EXTRA_ARGS: %w", err)
+	}
+
+	if strings.TrimSpace(perEnv) != "" {
+		var env map[string][]string
+		if err := json.Unmarshal([]byte(perEnv), &env); err != nil {
+			return CLIArgs{}, fmt.Errorf("invalid AI_ENV_ARGS: %w", err)
+		}
+		args.env = make(map[string][]string, len(env))
+		for name, list := range env {
+			if err := checkReservedArgs(list); err != nil {
+				return CLIArgs{}, fmt.Errorf("invalid AI_ENV_ARGS for %s: %w", name, err)
+			}
+			args.env[strings.ToLower(strings.TrimSpace(name))] = list
+		}
+	}
+	return args, nil
+}
+
+// For returns the global arguments followed by those of env, falling back to
+// the default entry. Later flags win in the CLI, so environments can override
+// global settings such as --model.
+func (c CLIArgs) For(env string) []string {
+	list, ok := c.env[strings.ToLower(env)]
+	if !ok {
+		list = c.env[DefaultInstructionsKey]
+	}
+	if len(c.global) == 0 && len(list) == 0 {
+		return nil
+	}
+	return append(append([]string{}, c.global...), list...)
+}
+
+// checkReservedArgs rejects flags the runner manages, in "--flag" and "--flag=value" form
+func checkReservedArgs(args []string) error {
+	for _, arg := range args {
+		name, _, _ := strings.Cut(arg, "=")
+		if reason, ok := reservedArgs[name]; ok {
+			return fmt.Errorf("%s is reserved: %s", name, reason)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadCLIArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		global  string
+		perEnv  string
+		wantErr string
+	}{
+		{"empty", "", "", ""},
+		{"global and env", "--model sonnet", `{"php": ["--permission-mode", "acceptEdits"]}`, ""},
+		{"invalid JSON", "", `{"php": "--model"}`, "invalid AI_ENV_ARGS"},
+		{"reserved global", "--output-format text", "", "--output-format is reserved"},
+		{"reserved with value", "--output-format=json", "", "--output-format is reserved"},
+		{"reserved prompt flag", "", `{"default": ["-p", "hi"]}`, "invalid AI_ENV_ARGS for default: -p is reserved"},
+		{"reserved system prompt", "", `{"php": ["--append-system-prompt", "x"]}`, "AI_INSTRUCTIONS"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadCLIArgs(tt.global, tt.perEnv)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("LoadCLIArgs() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadCLIArgs() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuildArgs_PerEnvironment(t *testing.T) {
+	cliArgs, err := LoadCLIArgs("--model claude-sonnet-4-5", `{
+		"default": ["--permission-mode", "acceptEdits"],
+		"PHP": ["--model", "claude-opus-4-1", "--allowedTools", "Bash(composer:*) Edit"]
+	}`)
+	if err != nil {
+		t.Fatalf("LoadCLIArgs() error = %v", err)
+	}
+	base := []string{"--print", "--output-format", "stream-json", "--verbose"}
+
+	tests := []struct {
+		name        string
+		environment string
+		stdin       bool
+		want        []string
+	}{
+		{
+			name:        "environment entry after global args",
+			environment: "php",
+			want: append(append([]string{}, base...),
+				"--model", "claude-sonnet-4-5", "--model", "claude-opus-4-1", "--allowedTools", "Bash(composer:*) Edit",
+				"-p", "Fix it", "--append-system-prompt", "Be careful"),
+		},
+		{
+			name:        "default entry for other environments",
+			environment: "python",
+			want: append(append([]string{}, base...),
+				"--model", "claude-sonnet-4-5", "--permission-mode", "acceptEdits",
+				"-p", "Fix it", "--append-system-prompt", "Be careful"),
+		},
+		{
+			name:        "prompt on stdin",
+			environment: "python",
+			stdin:       true,
+			want: append(append([]string{}, base...),
+				"--model", "claude-sonnet-4-5", "--permission-mode", "acceptEdits",
+				"--append-system-prompt", "Be careful"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := ExecuteOptions{
+				Prompt:       "Fix it",
+				SystemPrompt: "Be careful",
+				ExtraArgs:    cliArgs.For(tt.environment),
+			}
+			if got := buildArgs(opts, tt.stdin); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// The zero value adds nothing
+	var none CLIArgs
+	if got := none.For("php"); got != nil {
+		t.Errorf("zero CLIArgs.For() = %q, want nil", got)
+	}
+}
@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// Bash command policy modes
+const (
+	BashPolicyOff   = "off"
+	BashPolicyWarn  = "warn"
+	BashPolicyBlock = "block"
+)
+
+// DestructivePatterns match commands that destroy data beyond the work
+// branch, denied with BASH_COMMAND_DENY_DEFAULTS
+var DestructivePatterns = []string{
+	`\brm\s+(?:-\w+\s+)*-[a-zA-Z]*(?:[rR][a-zA-Z]*f|f[a-zA-Z]*[rR])`,                   // rm -rf, rm -fr, rm -Rf
+	`\bgit\s+push\b[^;&|]*\s(?:--force(?:-with-lease)?\b|-[a-zA-Z]*f[a-zA-Z]*\b|\+\S)`, // force push
+	`\bgit\s+push\b[^;&|]*\s(?:--delete\b|-d\b|:\S)`,                                   // remote branch deletion
+	`\bmkfs(?:\.\w+)?\b`,
+	`\bdd\b[^;&|]*\bof=/dev/`,
+}
+
+// ErrCommandDenied is returned when the agent runs a Bash command denied by the policy in block mode
+var ErrCommandDenied = errors.New("agent ran a denied command")
+
+// BashPolicy checks the commands of the agent's Bash tool calls against deny
+// patterns. The CLI runs the commands itself, so the policy can only react to
+// a tool call it sees on the output stream: warn records the violation, block
+// also aborts the run. A command may already have started by then.
+type BashPolicy struct {
+	deny []*regexp.Regexp
+	mode string
+}
+
+// NewBashPolicy compiles the deny patterns, with DestructivePatterns first
+// when withDefaults is set. Returns nil when there are no patterns or the mode
+// is off, which disables the policy.
+func NewBashPolicy(patterns []string, withDefaults bool, mode string) (*BashPolicy, error) {
+	switch mode {
+	case "":
+		mode = BashPolicyWarn
+	case BashPolicyOff, BashPolicyWarn, BashPolicyBlock:
+	default:
+		return nil, fmt.Errorf("invalid bash policy mode %q (want %s, %s or %s)", mode, BashPolicyOff, BashPolicyWarn, BashPolicyBlock)
+	}
+
+	if withDefaults {
+		patterns = append(append([]string{}, DestructivePatterns...), patterns...)
+	}
+	if len(patterns) == 0 || mode == BashPolicyOff {
+		return nil, nil
+	}
+
+	p := &BashPolicy{mode: mode}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bash deny pattern %q: %w", pattern, err)
+		}
+		p.deny = append(p.deny, re)
+	}
+	return p, nil
+}
+
+// Check returns the first deny pattern the command matches. Patterns match
+// anywhere in the command, so compound commands (a && b, pipes) are covered.
+func (p *BashPolicy) Check(command string) (pattern string, denied bool) {
+	if p == nil {
+		return "", false
+	}
+	for _, re := range p.deny {
+		if re.MatchString(command) {
+			return re.String(), true
+		}
+	}
+	return "", false
+}
+
+// Blocks reports whether a violation aborts the run
+func (p *BashPolicy) Blocks() bool {
+	return p != nil && p.mode == BashPolicyBlock
+}
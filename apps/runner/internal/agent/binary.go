@@ -0,0 +1,44 @@
+package agent
+
+import (
+	"errors"
+	"unicode/utf8"
+)
+
+// Binary output handling modes
+const (
+	BinaryOutputAbort = "abort"
+	BinaryOutputSkip  = "skip"
+	BinaryOutputAllow = "allow"
+)
+
+// ErrBinaryOutput is returned when the agent writes binary data instead of text
+var ErrBinaryOutput = errors.New("agent produced binary output")
+
+// binaryRatioThreshold is the share of non-printable bytes above which a line is treated as binary
+const binaryRatioThreshold = 0.3
+
+// isBinaryLine reports whether a line looks like binary data rather than text.
+// NUL bytes are a strong signal; otherwise count control characters and
+// invalid UTF-8 sequences relative to the line length.
+func isBinaryLine(line string) bool {
+	if line == "" {
+		return false
+	}
+
+	nonPrintable := 0
+	for i := 0; i < len(line); {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		switch {
+		case r == 0:
+			return true
+		case r == utf8.RuneError && size == 1:
+			nonPrintable++
+		case r < 0x20 && r != '\t' && r != '\r' && r != 0x1b: // allow tabs and ANSI escapes
+			nonPrintable++
+		}
+		i += size
+	}
+
+	return float64(nonPrintable)/float64(len(line)) > binaryRatioThreshold
+}
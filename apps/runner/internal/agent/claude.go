@@ -3,13 +3,17 @@ package agent
 import (
 	"bufio"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // StreamMessage represents a message from Claude CLI stream-json output
@@ -19,6 +23,19 @@ type StreamMessage struct {
 	Message  *MessageContent `json:"message"`
 	Result   string          `json:"result"`
 	SessionID string         `json:"session_id"`
+
+	// Reported by the final "result" message
+	NumTurns     int          `json:"num_turns"`
+	TotalCostUSD float64      `json:"total_cost_usd"`
+	Usage        *StreamUsage `json:"usage"`
+}
+
+// StreamUsage is the token usage of a whole run
+type StreamUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
 }
 
 // MessageContent represents the content of an assistant/user message
@@ -29,8 +46,9 @@ type MessageContent struct {
 
 // ContentBlock represents a single block in a message
 type ContentBlock struct {
-	Type      string      `json:"type"`        // "text", "tool_use", "tool_result"
+	Type      string      `json:"type"`        // "text", "thinking", "tool_use", "tool_result"
 	Text      string      `json:"text"`        // for text blocks
+	Thinking  string      `json:"thinking"`    // for thinking blocks
 	ID        string      `json:"id"`          // for tool_use
 	Name      string      `json:"name"`        // for tool_use (Read, Edit, Bash, etc.)
 	Input     interface{} `json:"input"`       // for tool_use
@@ -53,12 +71,54 @@ func NewClaudeAgent(cfg *Config, logger *slog.Logger) *ClaudeAgent {
 }
 
 // Execute runs Claude Code CLI with the given prompt
-func (a *ClaudeAgent) Execute(ctx context.Context, opts ExecuteOptions) error {
+func (a *ClaudeAgent) Execute(ctx context.Context, opts ExecuteOptions) (*Result, error) {
+	res := &Result{ExitCode: -1}
+	err := a.execute(ctx, opts, res)
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res, err
+}
+
+// execute runs the CLI, or the mock when the agent is disabled, filling res
+func (a *ClaudeAgent) execute(ctx context.Context, opts ExecuteOptions, res *Result) error {
 	if !a.cfg.Enabled {
-		return a.executeMock(ctx, opts)
+		return a.executeMock(ctx, opts, res)
+	}
+	if opts.ResumeSessionID == "" {
+		return a.run(ctx, opts, res)
 	}
 
-	logger := a.logger.With("job_id", opts.JobID, "work_dir", opts.WorkDir)
+	// A resumed run that exits before the CLI reports its session couldn't
+	// load the conversation (expired, or stored on another machine), so
+	// nothing has happened yet and the prompt is run in a new conversation
+	var started atomic.Bool
+	onSession := opts.OnSession
+	resumeOpts := opts
+	resumeOpts.OnSession = func(id string) {
+		started.Store(true)
+		if onSession != nil {
+			onSession(id)
+		}
+	}
+
+	err := a.run(ctx, resumeOpts, res)
+	var exitErr *ExitError
+	if started.Load() || !errors.As(err, &exitErr) {
+		return err
+	}
+
+	a.logger.Warn("failed to resume claude session, starting a new one",
+		"job_id", opts.JobID, "resume_session_id", opts.ResumeSessionID, "exit_code", exitErr.Code)
+	opts.Output("stderr", SourceRunner, fmt.Sprintf("Could not resume Claude session %s, starting a new one", opts.ResumeSessionID))
+	opts.ResumeSessionID = ""
+	*res = Result{ExitCode: -1}
+	return a.run(ctx, opts, res)
+}
+
+// run executes the CLI once, recording its exit code and final report in res
+func (a *ClaudeAgent) run(ctx context.Context, opts ExecuteOptions, res *Result) error {
+	logger := a.logger.With("job_id", opts.JobID, "work_dir", opts.WorkDir, "trace_id", opts.TraceID)
 	logger.Info("executing claude agent")
 
 	// Build command
@@ -67,25 +127,56 @@ func (a *ClaudeAgent) Execute(ctx context.Context, opts ExecuteOptions) error {
 		cliPath = "claude" // Default to PATH lookup
 	}
 
-	// Claude Code CLI arguments:
-	// --print: Output to stdout instead of interactive mode
-	// --output-format stream-json: Streaming JSON output with tool calls
-	// --verbose: Required for stream-json with --print
-	// -p: Provide the prompt
-	args := []string{
-		"--print",
-		"--output-format", "stream-json",
-		"--verbose",
-		"-p", opts.Prompt,
-	}
+	stdinPrompt := promptViaStdin(opts.Prompt)
+	args := buildArgs(opts, stdinPrompt)
+
+	// runCtx lets stream readers kill the CLI (e.g. on binary output)
+	runCtx, cancelRun := context.WithCancel(ctx)
+	defer cancelRun()
 
-	cmd := exec.CommandContext(ctx, cliPath, args...)
+	cmd := exec.CommandContext(runCtx, cliPath, args...)
 	cmd.Dir = opts.WorkDir
+	if stdinPrompt {
+		cmd.Stdin = strings.NewReader(opts.Prompt)
+	}
+
+	// Serialize the two stream readers (and the egress proxy) so lines are written in emission order,
+	// keeping the end of stderr for the exit error
+	var outputMu sync.Mutex
+	var tail stderrTail
+	output := func(stream string, source OutputSource, line string) {
+		outputMu.Lock()
+		defer outputMu.Unlock()
+		if stream == "stderr" {
+			tail.add(line)
+		}
+		opts.Output(stream, source, line)
+	}
 
 	// Set up environment
 	cmd.Env = append(cmd.Environ(),
 		fmt.Sprintf("ANTHROPIC_API_KEY=%s", a.cfg.APIKey),
 	)
+	cmd.Env = append(cmd.Env, correlationEnv(opts)...)
+	cmd.Env = append(cmd.Env, opts.Env...)
+
+	// Run the CLI in its own network namespace with the egress filter as its
+	// only way out; the proxy variables are added last, so no secret can
+	// override them
+	if a.cfg.Egress != nil {
+		proxy, err := startEgressProxy(a.cfg.Egress, func(host string) {
+			logger.Warn("blocked agent network access", "host", host)
+			output("stderr", SourceRunner, fmt.Sprintf("Network access to %s blocked (AGENT_NETWORK=%s)", host, a.cfg.Egress.Mode()))
+		})
+		if err != nil {
+			return fmt.Errorf("failed to start egress proxy: %w", err)
+		}
+		defer proxy.Close()
+		cmd.Env = append(cmd.Env, proxy.env()...)
+		if err := isolateNetwork(cmd, proxy.socket); err != nil {
+			return fmt.Errorf("failed to isolate the agent network: %w", err)
+		}
+	}
 
 	// Get stdout and stderr pipes
 	stdout, err := cmd.StdoutPipe()
@@ -98,6 +189,20 @@ func (a *ClaudeAgent) Execute(ctx context.Context, opts ExecuteOptions) error {
 		return fmt.Errorf("failed to create stderr pipe: %w", err)
 	}
 
+	// The raw output log is best effort: without it the job still runs
+	var rawLog *outputLog
+	if a.cfg.OutputLogDir != "" {
+		rawLog, err = openOutputLog(a.cfg.OutputLogDir, opts.JobID, a.cfg.OutputLogMaxBytes, opts.Redact, logger)
+		if err != nil {
+			logger.Warn("output log unavailable", "error", err)
+		}
+		defer func() {
+			if err := rawLog.Close(); err != nil {
+				logger.Warn("failed to close output log", "error", err)
+			}
+		}()
+	}
+
 	// Start the command
 	logger.Info("starting claude CLI", "cli_path", cliPath, "args", args)
 	opts.Output("stdout", SourceRunner, fmt.Sprintf("Starting AI agent (claude %s)...", strings.Join(args[:3], " ")))
@@ -106,6 +211,31 @@ func (a *ClaudeAgent) Execute(ctx context.Context, opts ExecuteOptions) error {
 		return fmt.Errorf("failed to start claude CLI: %w", err)
 	}
 
+	// The idle watchdog kills a CLI that hangs without output; any data on
+	// either stream resets it
+	var stalled atomic.Bool
+	touch := func() {}
+	if a.cfg.IdleTimeout > 0 {
+		idle := time.AfterFunc(a.cfg.IdleTimeout, func() {
+			stalled.Store(true)
+			cancelRun()
+		})
+		defer idle.Stop()
+		touch = func() { idle.Reset(a.cfg.IdleTimeout) }
+	}
+
+	// Both stream readers may see the final report
+	var resultMu sync.Mutex
+	hooks := &streamHooks{
+		onResult: func(msg *StreamMessage) {
+			resultMu.Lock()
+			defer resultMu.Unlock()
+			recordResult(res, msg)
+		},
+		onSession:    opts.OnSession,
+		onToolResult: opts.OnToolResult,
+	}
+
 	// Stream output concurrently
 	var wg sync.WaitGroup
 	var streamErr error
@@ -115,12 +245,15 @@ func (a *ClaudeAgent) Execute(ctx context.Context, opts ExecuteOptions) error {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := a.streamOutput(ctx, stdout, "stdout", opts.Output); err != nil {
+		if err := a.streamOutput(ctx, activityReader{stdout, touch}, "stdout", output, rawLog, hooks); err != nil {
 			streamErrMu.Lock()
 			if streamErr == nil {
 				streamErr = fmt.Errorf("stdout stream error: %w", err)
 			}
 			streamErrMu.Unlock()
+			if errors.Is(err, ErrBinaryOutput) || errors.Is(err, ErrCommandDenied) {
+				cancelRun()
+			}
 		}
 	}()
 
@@ -128,12 +261,15 @@ func (a *ClaudeAgent) Execute(ctx context.Context, opts ExecuteOptions) error {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := a.streamOutput(ctx, stderr, "stderr", opts.Output); err != nil {
+		if err := a.streamOutput(ctx, activityReader{stderr, touch}, "stderr", output, rawLog, hooks); err != nil {
 			streamErrMu.Lock()
 			if streamErr == nil {
 				streamErr = fmt.Errorf("stderr stream error: %w", err)
 			}
 			streamErrMu.Unlock()
+			if errors.Is(err, ErrBinaryOutput) || errors.Is(err, ErrCommandDenied) {
+				cancelRun()
+			}
 		}
 	}()
 
@@ -142,16 +278,40 @@ func (a *ClaudeAgent) Execute(ctx context.Context, opts ExecuteOptions) error {
 
 	// Wait for command to finish
 	waitErr := cmd.Wait()
+	if cmd.ProcessState != nil {
+		res.ExitCode = cmd.ProcessState.ExitCode()
+	}
+
+	// Binary output aborts the run before it floods the job output
+	if errors.Is(streamErr, ErrBinaryOutput) {
+		logger.Error("agent produced binary output, aborted", "error", streamErr)
+		opts.Output("stderr", SourceRunner, "Agent produced binary output on its output stream - aborted (check AI_CLI_PATH)")
+		return fmt.Errorf("agent execution aborted: %w", streamErr)
+	}
+
+	// A denied command in block mode aborts the run
+	if errors.Is(streamErr, ErrCommandDenied) {
+		logger.Error("agent ran a denied command, aborted", "error", streamErr)
+		opts.Output("stderr", SourceRunner, "Agent aborted by the Bash command policy")
+		return fmt.Errorf("agent execution aborted: %w", streamErr)
+	}
+
+	// The watchdog killed a silent CLI
+	if stalled.Load() && ctx.Err() == nil {
+		logger.Error("agent stalled, killed", "idle_timeout", a.cfg.IdleTimeout)
+		opts.Output("stderr", SourceRunner, fmt.Sprintf("Agent stalled (no output for %s)", a.cfg.IdleTimeout))
+		return fmt.Errorf("%w: no output for %s", ErrStalled, a.cfg.IdleTimeout)
+	}
 
 	// Check context for timeout/cancellation
 	if ctx.Err() != nil {
 		if ctx.Err() == context.DeadlineExceeded {
 			opts.Output("stderr", SourceRunner, "Agent execution timed out")
-			return fmt.Errorf("agent execution timed out")
+			return ErrTimeout
 		}
 		if ctx.Err() == context.Canceled {
 			opts.Output("stderr", SourceRunner, "Agent execution cancelled")
-			return fmt.Errorf("agent execution cancelled")
+			return ErrCancelled
 		}
 		return ctx.Err()
 	}
@@ -167,7 +327,7 @@ func (a *ClaudeAgent) Execute(ctx context.Context, opts ExecuteOptions) error {
 			exitCode := exitErr.ExitCode()
 			logger.Error("claude CLI exited with error", "exit_code", exitCode)
 			opts.Output("stderr", SourceRunner, fmt.Sprintf("Agent exited with code %d", exitCode))
-			return fmt.Errorf("agent exited with code %d: %w", exitCode, waitErr)
+			return &ExitError{Code: exitCode, Stderr: tail.lines, Err: waitErr}
 		}
 		return fmt.Errorf("agent execution failed: %w", waitErr)
 	}
@@ -177,9 +337,44 @@ func (a *ClaudeAgent) Execute(ctx context.Context, opts ExecuteOptions) error {
 	return nil
 }
 
+// activityReader calls touch whenever data is read, feeding the idle watchdog
+type activityReader struct {
+	r     io.Reader
+	touch func()
+}
+
+func (a activityReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	if n > 0 {
+		a.touch()
+	}
+	return n, err
+}
+
+// correlationEnv returns REPOBOX_* variables so the agent's own logs can be
+// matched with the runner's logs and output entries. Empty values are left out.
+func correlationEnv(opts ExecuteOptions) []string {
+	vars := []struct{ name, value string }{
+		{"REPOBOX_JOB_ID", opts.JobID},
+		{"REPOBOX_SESSION_ID", opts.SessionID},
+		{"REPOBOX_RUNNER_ID", opts.RunnerID},
+		{"REPOBOX_TRACE_ID", opts.TraceID},
+	}
+
+	var env []string
+	for _, v := range vars {
+		if v.value != "" {
+			env = append(env, v.name+"="+v.value)
+		}
+	}
+	return env
+}
+
 // streamOutput reads from reader line by line and calls output callback
-// For stream-json format, it parses JSON and extracts human-readable output
-func (a *ClaudeAgent) streamOutput(ctx context.Context, reader interface{ Read([]byte) (int, error) }, stream string, output OutputWriter) error {
+// For stream-json format, it parses JSON (one object per line, or values
+// spread over several lines, see jsonAssembler) and extracts human-readable output.
+// Every line is also written to rawLog (may be nil), before truncation.
+func (a *ClaudeAgent) streamOutput(ctx context.Context, reader interface{ Read([]byte) (int, error) }, stream string, output OutputWriter, rawLog *outputLog, hooks *streamHooks) error {
 	// Use larger buffer for potentially long lines (JSON can be large)
 	scanner := bufio.NewScanner(reader)
 	buf := make([]byte, 0, 64*1024)
@@ -190,6 +385,8 @@ func (a *ClaudeAgent) streamOutput(ctx context.Context, reader interface{ Read([
 	if maxLines == 0 {
 		maxLines = 10000 // Default limit
 	}
+	binarySkipped := 0
+	var assembler jsonAssembler
 
 	for scanner.Scan() {
 		select {
@@ -199,6 +396,19 @@ func (a *ClaudeAgent) streamOutput(ctx context.Context, reader interface{ Read([
 		}
 
 		line := scanner.Text()
+
+		if a.cfg.BinaryOutputMode != BinaryOutputAllow && isBinaryLine(line) {
+			if a.cfg.BinaryOutputMode == BinaryOutputSkip {
+				if binarySkipped == 0 {
+					output(stream, SourceRunner, "... binary output suppressed")
+				}
+				binarySkipped++
+				continue
+			}
+			return fmt.Errorf("%w (%d bytes on %s)", ErrBinaryOutput, len(line), stream)
+		}
+
+		rawLog.write(stream, line)
 		lineCount++
 
 		if lineCount > maxLines {
@@ -208,33 +418,92 @@ func (a *ClaudeAgent) streamOutput(ctx context.Context, reader interface{ Read([
 			continue
 		}
 
-		// Try to parse as JSON (stream-json format)
-		var msg StreamMessage
-		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+		// Parse as JSON (stream-json format), which may span lines
+		msgs, raw := assembler.feed(line)
+		for _, rawLine := range raw {
 			// Not valid JSON, output as raw line (fallback)
-			output(stream, SourceClaude, line)
-			continue
+			output(stream, SourceClaude, rawLine)
 		}
 
 		// Process based on message type
-		a.processStreamMessage(&msg, stream, output)
+		for i := range msgs {
+			if err := a.processStreamMessage(&msgs[i], stream, output, hooks); err != nil {
+				return err
+			}
+		}
 	}
 
+	// An unfinished JSON value at the end of the output is plain text
+	for _, rawLine := range assembler.flush() {
+		output(stream, SourceClaude, rawLine)
+	}
 	return scanner.Err()
 }
 
-// processStreamMessage extracts and outputs human-readable content from stream-json messages
-func (a *ClaudeAgent) processStreamMessage(msg *StreamMessage, stream string, output OutputWriter) {
+// buildArgs returns the Claude Code CLI arguments:
+// --print: Output to stdout instead of interactive mode
+// --output-format stream-json: Streaming JSON output with tool calls
+// --verbose: Required for stream-json with --print
+// extra args: Operator flags for the environment (AI_EXTRA_ARGS, AI_ENV_ARGS)
+// -p: Provide the prompt (large prompts are written to stdin instead)
+// --append-system-prompt: Operator instructions, kept apart from the user's prompt
+// --resume: Continue the work session's earlier conversation
+func buildArgs(opts ExecuteOptions, stdinPrompt bool) []string {
+	args := []string{
+		"--print",
+		"--output-format", "stream-json",
+		"--verbose",
+	}
+	args = append(args, opts.ExtraArgs...)
+	if !stdinPrompt {
+		args = append(args, "-p", opts.Prompt)
+	}
+	if opts.SystemPrompt != "" {
+		args = append(args, "--append-system-prompt", opts.SystemPrompt)
+	}
+	if opts.ResumeSessionID != "" {
+		args = append(args, "--resume", opts.ResumeSessionID)
+	}
+	return args
+}
+
+// streamHooks receive values the CLI reports on its output stream. A nil
+// *streamHooks or nil field ignores them.
+type streamHooks struct {
+	onResult     func(msg *StreamMessage)
+	onSession    func(id string)
+	onToolResult func(stream, toolUseID, summary, content string)
+}
+
+// recordResult copies the summary and usage of the CLI's final result message into res
+func recordResult(res *Result, msg *StreamMessage) {
+	if msg.Subtype == "success" && msg.Result != "" {
+		res.Summary = msg.Result
+	}
+	res.NumTurns = msg.NumTurns
+	res.CostUSD = msg.TotalCostUSD
+	if u := msg.Usage; u != nil {
+		res.InputTokens = u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+		res.OutputTokens = u.OutputTokens
+	}
+}
+
+// processStreamMessage extracts and outputs human-readable content from stream-json messages.
+// Returns ErrCommandDenied when a Bash tool call violates a blocking command policy.
+func (a *ClaudeAgent) processStreamMessage(msg *StreamMessage, stream string, output OutputWriter, hooks *streamHooks) error {
 	switch msg.Type {
 	case "system":
 		// System messages (init, etc.) - skip or log minimally
 		if msg.Subtype == "init" && msg.SessionID != "" {
 			output(stream, SourceRunner, fmt.Sprintf("Claude session: %s", msg.SessionID))
+			if hooks != nil && hooks.onSession != nil {
+				hooks.onSession(msg.SessionID)
+			}
 		}
 
 	case "assistant":
 		if msg.Message == nil || len(msg.Message.Content) == 0 {
-			return
+			return nil
 		}
 
 		for _, block := range msg.Message.Content {
@@ -245,11 +514,23 @@ func (a *ClaudeAgent) processStreamMessage(msg *StreamMessage, stream string, ou
 					output(stream, SourceClaude, block.Text)
 				}
 
+			case "thinking":
+				// Reasoning before the answer, optional in the output
+				if a.cfg.IncludeThinking && block.Thinking != "" {
+					output(stream, SourceThinking, block.Thinking)
+				}
+
 			case "tool_use":
 				// Tool call - format as readable line
 				target := a.getToolTarget(block.Name, block.Input)
 				output(stream, SourceClaude, fmt.Sprintf("%s %s", block.Name, target))
 
+				if block.Name == "Bash" {
+					if err := a.checkBashCommand(block.Input, output); err != nil {
+						return err
+					}
+				}
+
 				// Pro Edit tool přidat old/new string pro zobrazení diffu
 				if block.Name == "Edit" {
 					if inputMap, ok := block.Input.(map[string]interface{}); ok {
@@ -269,18 +550,23 @@ func (a *ClaudeAgent) processStreamMessage(msg *StreamMessage, stream string, ou
 				}
 
 			case "tool_result":
-				// Tool results - summarize if too long
-				content := a.formatToolResult(block.Content)
-				if content != "" {
-					// Only output short summaries, full results can be very long
-					if len(content) > 200 {
-						content = content[:200] + "..."
-					}
-					output(stream, SourceClaude, fmt.Sprintf("└─ %s", content))
-				}
+				a.outputToolResult(block, stream, output, hooks)
 			}
 		}
 
+	case "user":
+		// Tool results are reported back to Claude as user messages
+		if msg.Message == nil {
+			return nil
+		}
+
+		for _, block := range msg.Message.Content {
+			if block.Type != "tool_result" {
+				continue
+			}
+			a.outputToolResult(block, stream, output, hooks)
+		}
+
 	case "result":
 		// Final result - include stats if available
 		if msg.Subtype == "success" {
@@ -288,7 +574,34 @@ func (a *ClaudeAgent) processStreamMessage(msg *StreamMessage, stream string, ou
 		} else if msg.Subtype == "error" {
 			output(stream, SourceRunner, fmt.Sprintf("Claude error: %s", msg.Result))
 		}
+		if hooks != nil && hooks.onResult != nil {
+			hooks.onResult(msg)
+		}
 	}
+	return nil
+}
+
+// checkBashCommand records a Bash tool call that matches a deny pattern.
+// Returns ErrCommandDenied when the policy blocks.
+func (a *ClaudeAgent) checkBashCommand(input interface{}, output OutputWriter) error {
+	inputMap, ok := input.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	command, _ := inputMap["command"].(string)
+
+	pattern, denied := a.cfg.BashPolicy.Check(command)
+	if !denied {
+		return nil
+	}
+
+	a.logger.Warn("agent ran a denied command", "pattern", pattern, "command", truncateString(command, 200), "blocked", a.cfg.BashPolicy.Blocks())
+	if a.cfg.BashPolicy.Blocks() {
+		output("stderr", SourceRunner, fmt.Sprintf("Bash command policy violation (pattern %q), stopping the agent: %s", pattern, truncateString(command, 200)))
+		return fmt.Errorf("%w: %s", ErrCommandDenied, truncateString(command, 80))
+	}
+	output("stderr", SourceRunner, fmt.Sprintf("Bash command policy violation (pattern %q): %s", pattern, truncateString(command, 200)))
+	return nil
 }
 
 // getToolTarget extracts the main target/argument from tool input
@@ -338,6 +651,33 @@ func (a *ClaudeAgent) getToolTarget(toolName string, input interface{}) string {
 	return ""
 }
 
+// outputToolResult writes the summary line of a tool result, through the
+// onToolResult hook together with the full content when there is one
+func (a *ClaudeAgent) outputToolResult(block ContentBlock, stream string, output OutputWriter, hooks *streamHooks) {
+	summary := a.summarizeToolResult(block.Content)
+	if summary == "" {
+		return
+	}
+	if hooks != nil && hooks.onToolResult != nil && block.ToolUseID != "" {
+		hooks.onToolResult(stream, block.ToolUseID, summary, a.formatToolResult(block.Content))
+		return
+	}
+	output(stream, SourceClaude, summary)
+}
+
+// summarizeToolResult formats a tool result as an output line. Only a short
+// summary is kept, full results can be very long.
+func (a *ClaudeAgent) summarizeToolResult(content interface{}) string {
+	summary := a.formatToolResult(content)
+	if summary == "" {
+		return ""
+	}
+	if len(summary) > 200 {
+		summary = summary[:200] + "..."
+	}
+	return fmt.Sprintf("└─ %s", summary)
+}
+
 // formatToolResult converts tool result content to string
 func (a *ClaudeAgent) formatToolResult(content interface{}) string {
 	if content == nil {
@@ -363,8 +703,11 @@ func (a *ClaudeAgent) formatToolResult(content interface{}) string {
 	}
 }
 
+// MockAgentFile is the file the mock agent writes into its working directory
+const MockAgentFile = ".repobox-mock.md"
+
 // executeMock runs a mock agent for testing when AI is disabled
-func (a *ClaudeAgent) executeMock(ctx context.Context, opts ExecuteOptions) error {
+func (a *ClaudeAgent) executeMock(ctx context.Context, opts ExecuteOptions, res *Result) error {
 	logger := a.logger.With("job_id", opts.JobID)
 	logger.Info("executing mock agent (AI disabled)")
 
@@ -372,9 +715,13 @@ func (a *ClaudeAgent) executeMock(ctx context.Context, opts ExecuteOptions) erro
 	opts.Output("stdout", SourceRunner, fmt.Sprintf("Would execute prompt: %s", truncateString(opts.Prompt, 100)))
 	opts.Output("stdout", SourceRunner, fmt.Sprintf("Working directory: %s", opts.WorkDir))
 	opts.Output("stdout", SourceRunner, fmt.Sprintf("Environment: %s", opts.Environment))
+	if opts.SystemPrompt != "" {
+		opts.Output("stdout", SourceRunner, fmt.Sprintf("System instructions: %s", truncateString(opts.SystemPrompt, 100)))
+	}
 
 	// Create a mock file to verify the flow works
-	// This is useful for testing the full pipeline without AI
+	// This is useful for testing the full pipeline without AI; the runner
+	// excludes it from commits (git.RunnerArtifacts)
 	mockContent := fmt.Sprintf(`# Repobox Mock Execution
 
 This file was created by Repobox in mock mode (AI agent disabled).
@@ -391,13 +738,14 @@ This file was created by Repobox in mock mode (AI agent disabled).
 `, opts.JobID, opts.Environment, opts.Prompt)
 
 	// Write mock file
-	mockFile := opts.WorkDir + "/.repobox-mock.md"
+	mockFile := filepath.Join(opts.WorkDir, MockAgentFile)
 	if err := writeFile(mockFile, mockContent); err != nil {
 		opts.Output("stderr", SourceRunner, fmt.Sprintf("Failed to create mock file: %s", err))
 		return fmt.Errorf("mock agent failed: %w", err)
 	}
 
-	opts.Output("stdout", SourceRunner, "Mock agent completed - created .repobox-mock.md")
+	opts.Output("stdout", SourceRunner, fmt.Sprintf("Mock agent completed - created %s (never committed)", MockAgentFile))
+	res.ExitCode = 0
 	return nil
 }
 
@@ -2,12 +2,19 @@ package agent
 
 import (
 	"context"
+	"errors"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/repobox/runner/internal/git"
 )
 
 func TestClaudeAgent_ExecuteMock(t *testing.T) {
@@ -41,7 +48,7 @@ func TestClaudeAgent_ExecuteMock(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	err = agent.Execute(ctx, opts)
+	_, err = agent.Execute(ctx, opts)
 	if err != nil {
 		t.Fatalf("mock execution failed: %v", err)
 	}
@@ -71,10 +78,15 @@ func TestClaudeAgent_ExecuteMock(t *testing.T) {
 	}
 
 	// Verify mock file created
-	mockFile := filepath.Join(tempDir, ".repobox-mock.md")
+	mockFile := filepath.Join(tempDir, MockAgentFile)
 	if _, err := os.Stat(mockFile); os.IsNotExist(err) {
 		t.Error("mock file was not created")
 	}
+
+	// The runner keeps the mock file out of commits
+	if !slices.Contains(git.RunnerArtifacts, MockAgentFile) {
+		t.Errorf("git.RunnerArtifacts = %q, want it to include %s", git.RunnerArtifacts, MockAgentFile)
+	}
 }
 
 func TestClaudeAgent_ContextCancellation(t *testing.T) {
@@ -109,7 +121,7 @@ func TestClaudeAgent_ContextCancellation(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
 	defer cancel()
 
-	err = agent.Execute(ctx, opts)
+	_, err = agent.Execute(ctx, opts)
 
 	// Should fail with context deadline exceeded or cancelled
 	if err == nil {
@@ -177,3 +189,578 @@ func TestWriteFile(t *testing.T) {
 		t.Errorf("content mismatch: got %q, want %q", string(content), testContent)
 	}
 }
+
+func TestIsBinaryLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want bool
+	}{
+		{"plain text", "Editing src/main.go", false},
+		{"json", `{"type":"assistant","message":{"content":[]}}`, false},
+		{"utf8 text", "Přidat podporu pro diff ✓", false},
+		{"ansi colors", "\x1b[32mPASS\x1b[0m ok", false},
+		{"empty", "", false},
+		{"nul byte", "ELF\x00\x01\x02", true},
+		{"control chars", "\x01\x02\x03\x04\x05abc", true},
+		{"invalid utf8", "\xff\xfe\xfd\xfc\xfb\xfa", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isBinaryLine(tt.line); got != tt.want {
+				t.Errorf("isBinaryLine(%q) = %v, want %v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamOutput_BinaryOutput(t *testing.T) {
+	input := "starting\n\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\nmore\n"
+
+	tests := []struct {
+		name      string
+		mode      string
+		wantErr   bool
+		wantLines int
+	}{
+		{"abort by default", "", true, 1},
+		{"abort", BinaryOutputAbort, true, 1},
+		{"skip", BinaryOutputSkip, false, 3},
+		{"allow", BinaryOutputAllow, false, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			a := NewClaudeAgent(&Config{MaxOutputLines: 100, BinaryOutputMode: tt.mode}, logger)
+
+			var lines []string
+			output := func(stream string, source OutputSource, line string) {
+				lines = append(lines, line)
+			}
+
+			err := a.streamOutput(context.Background(), strings.NewReader(input), "stdout", output, nil, nil)
+			if tt.wantErr {
+				if !errors.Is(err, ErrBinaryOutput) {
+					t.Fatalf("streamOutput() error = %v, want ErrBinaryOutput", err)
+				}
+			} else if err != nil {
+				t.Fatalf("streamOutput() error = %v", err)
+			}
+			if len(lines) != tt.wantLines {
+				t.Errorf("got %d output lines %q, want %d", len(lines), lines, tt.wantLines)
+			}
+		})
+	}
+}
+
+func TestStreamOutput_Thinking(t *testing.T) {
+	input := `{"type":"assistant","message":{"role":"assistant","content":[` +
+		`{"type":"thinking","thinking":"The test fails because the fixture is stale.","signature":"sig"},` +
+		`{"type":"text","text":"Updating the fixture."}]}}` + "\n"
+
+	tests := []struct {
+		name    string
+		include bool
+		want    []string
+	}{
+		{"included", true, []string{"thinking: The test fails because the fixture is stale.", "claude: Updating the fixture."}},
+		{"suppressed", false, []string{"claude: Updating the fixture."}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			a := NewClaudeAgent(&Config{MaxOutputLines: 100, IncludeThinking: tt.include}, logger)
+
+			var lines []string
+			output := func(stream string, source OutputSource, line string) {
+				lines = append(lines, string(source)+": "+line)
+			}
+
+			if err := a.streamOutput(context.Background(), strings.NewReader(input), "stdout", output, nil, nil); err != nil {
+				t.Fatalf("streamOutput() error = %v", err)
+			}
+			if strings.Join(lines, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("output = %q, want %q", lines, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamOutput_UserToolResult(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "string content",
+			input: `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"ok  \tpkg/config\t0.01s"}]}}`,
+			want:  []string{"└─ ok  \tpkg/config\t0.01s"},
+		},
+		{
+			name:  "block content",
+			input: `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":[{"type":"text","text":"line one"},{"type":"text","text":"line two"}]}]}}`,
+			want:  []string{"└─ line one line two"},
+		},
+		{
+			name:  "long result truncated",
+			input: `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"` + long + `"}]}}`,
+			want:  []string{"└─ " + long[:200] + "..."},
+		},
+		{
+			name:  "text blocks skipped",
+			input: `{"type":"user","message":{"role":"user","content":[{"type":"text","text":"Fix the tests"}]}}`,
+			want:  nil,
+		},
+		{
+			name:  "no message",
+			input: `{"type":"user"}`,
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			a := NewClaudeAgent(&Config{MaxOutputLines: 100}, logger)
+
+			var lines []string
+			output := func(stream string, source OutputSource, line string) {
+				if source != SourceClaude {
+					t.Errorf("source = %q, want %q", source, SourceClaude)
+				}
+				lines = append(lines, line)
+			}
+
+			if err := a.streamOutput(context.Background(), strings.NewReader(tt.input+"\n"), "stdout", output, nil, nil); err != nil {
+				t.Fatalf("streamOutput() error = %v", err)
+			}
+			if strings.Join(lines, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("output = %q, want %q", lines, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamOutput_ToolResultHook(t *testing.T) {
+	long := strings.Repeat("x", 300)
+	input := `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"` + long + `"}]}}` + "\n" +
+		`{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_result","tool_use_id":"t2","content":[{"type":"text","text":"PASS"}]}]}}` + "\n" +
+		`{"type":"user","message":{"role":"user","content":[{"type":"tool_result","content":"no id"}]}}` + "\n"
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	a := NewClaudeAgent(&Config{MaxOutputLines: 100}, logger)
+
+	var lines []string
+	output := func(stream string, source OutputSource, line string) {
+		lines = append(lines, line)
+	}
+	type toolResult struct{ stream, id, summary, content string }
+	var results []toolResult
+	hooks := &streamHooks{onToolResult: func(stream, toolUseID, summary, content string) {
+		results = append(results, toolResult{stream, toolUseID, summary, content})
+	}}
+
+	if err := a.streamOutput(context.Background(), strings.NewReader(input), "stdout", output, nil, hooks); err != nil {
+		t.Fatalf("streamOutput() error = %v", err)
+	}
+
+	// The hook gets the truncated summary with the full content
+	want := []toolResult{
+		{"stdout", "t1", "└─ " + long[:200] + "...", long},
+		{"stdout", "t2", "└─ PASS", "PASS"},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("tool results = %q, want %q", results, want)
+	}
+	// A result without an ID has nothing to be stored under
+	if want := []string{"└─ no id"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("output = %q, want %q", lines, want)
+	}
+}
+
+func TestClaudeAgent_AbortsOnBinaryOutput(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Fake CLI that dumps binary data and would otherwise keep running
+	script := filepath.Join(tempDir, "fake-cli.sh")
+	content := "#!/bin/sh\nprintf 'ok\\n\\000\\001\\002\\003binary\\n'\nexec sleep 10\n"
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	a := NewClaudeAgent(&Config{Enabled: true, CLIPath: script, MaxOutputLines: 100}, logger)
+
+	start := time.Now()
+	_, err := a.Execute(context.Background(), ExecuteOptions{
+		WorkDir: tempDir,
+		Prompt:  "test",
+		JobID:   "test-binary",
+		Output:  func(stream string, source OutputSource, line string) {},
+	})
+
+	if !errors.Is(err, ErrBinaryOutput) {
+		t.Fatalf("Execute() error = %v, want ErrBinaryOutput", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("agent was not killed after binary output was detected")
+	}
+}
+
+func TestClaudeAgent_IdleTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		script      string
+		wantStalled bool
+	}{
+		{"silent agent is killed", "#!/bin/sh\necho started\nexec sleep 10\n", true},
+		{"steady output keeps it alive", "#!/bin/sh\nfor i in 1 2 3 4 5 6; do echo tick; sleep 0.1; done\n", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			script := filepath.Join(tempDir, "fake-cli.sh")
+			if err := os.WriteFile(script, []byte(tt.script), 0755); err != nil {
+				t.Fatalf("failed to write script: %v", err)
+			}
+
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			a := NewClaudeAgent(&Config{Enabled: true, CLIPath: script, MaxOutputLines: 100, IdleTimeout: 300 * time.Millisecond}, logger)
+
+			var mu sync.Mutex
+			var lines []string
+			start := time.Now()
+			_, err := a.Execute(context.Background(), ExecuteOptions{
+				WorkDir: tempDir,
+				Prompt:  "test",
+				JobID:   "test-idle",
+				Output: func(stream string, source OutputSource, line string) {
+					mu.Lock()
+					defer mu.Unlock()
+					lines = append(lines, line)
+				},
+			})
+
+			if !tt.wantStalled {
+				if err != nil {
+					t.Fatalf("Execute() error = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrStalled) {
+				t.Fatalf("Execute() error = %v, want ErrStalled", err)
+			}
+			if time.Since(start) > 5*time.Second {
+				t.Error("stalled agent was not killed")
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if last := lines[len(lines)-1]; !strings.Contains(last, "Agent stalled (no output for 300ms)") {
+				t.Errorf("last output = %q, want stall notice", last)
+			}
+		})
+	}
+}
+
+func TestClaudeAgent_SystemPrompt(t *testing.T) {
+	tests := []struct {
+		name         string
+		systemPrompt string
+		want         string
+	}{
+		{"with instructions", "Follow PSR-12.", "--print\n--output-format\nstream-json\n--verbose\n-p\nAdd a README\n--append-system-prompt\nFollow PSR-12.\n"},
+		{"without instructions", "", "--print\n--output-format\nstream-json\n--verbose\n-p\nAdd a README\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			argsFile := filepath.Join(tempDir, "args.txt")
+
+			// Fake CLI that records its arguments, one per line
+			script := filepath.Join(tempDir, "fake-cli.sh")
+			content := "#!/bin/sh\nprintf '%s\\n' \"$@\" > " + argsFile + "\n"
+			if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+				t.Fatalf("failed to write script: %v", err)
+			}
+
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			a := NewClaudeAgent(&Config{Enabled: true, CLIPath: script, MaxOutputLines: 100}, logger)
+
+			_, err := a.Execute(context.Background(), ExecuteOptions{
+				WorkDir:      tempDir,
+				Prompt:       "Add a README",
+				SystemPrompt: tt.systemPrompt,
+				JobID:        "test-system-prompt",
+				Output:       func(stream string, source OutputSource, line string) {},
+			})
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+
+			got, err := os.ReadFile(argsFile)
+			if err != nil {
+				t.Fatalf("failed to read args: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("CLI args = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaudeAgent_CorrelationEnv(t *testing.T) {
+	tempDir := t.TempDir()
+	envFile := filepath.Join(tempDir, "env.txt")
+
+	// Fake CLI that records its REPOBOX_* environment
+	script := filepath.Join(tempDir, "fake-cli.sh")
+	content := "#!/bin/sh\nenv | grep '^REPOBOX_' | sort > " + envFile + "\n"
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	a := NewClaudeAgent(&Config{Enabled: true, CLIPath: script, MaxOutputLines: 100}, logger)
+
+	_, err := a.Execute(context.Background(), ExecuteOptions{
+		WorkDir:   tempDir,
+		Prompt:    "Add a README",
+		JobID:     "job-1",
+		SessionID: "session-1",
+		RunnerID:  "runner-1",
+		TraceID:   "trace-1",
+		Output:    func(stream string, source OutputSource, line string) {},
+	})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	got, err := os.ReadFile(envFile)
+	if err != nil {
+		t.Fatalf("failed to read env: %v", err)
+	}
+	want := "REPOBOX_JOB_ID=job-1\nREPOBOX_RUNNER_ID=runner-1\nREPOBOX_SESSION_ID=session-1\nREPOBOX_TRACE_ID=trace-1\n"
+	if string(got) != want {
+		t.Errorf("CLI env = %q, want %q", got, want)
+	}
+}
+
+func TestClaudeAgent_EgressProxyEnv(t *testing.T) {
+	if err := CheckNetworkIsolation(context.Background()); err != nil {
+		t.Skipf("network namespaces unavailable: %v", err)
+	}
+	tempDir := t.TempDir()
+	envFile := filepath.Join(tempDir, "env.txt")
+
+	// Fake CLI that records its proxy environment
+	script := filepath.Join(tempDir, "fake-cli.sh")
+	content := "#!/bin/sh\nprintf '%s\\n%s\\n' \"$HTTPS_PROXY\" \"$NO_PROXY\" > " + envFile + "\n"
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+
+	egress, err := NewEgressPolicy(NetworkNone, DefaultAPIHosts, nil)
+	if err != nil {
+		t.Fatalf("NewEgressPolicy() error = %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	a := NewClaudeAgent(&Config{Enabled: true, CLIPath: script, MaxOutputLines: 100, Egress: egress}, logger)
+
+	_, err = a.Execute(context.Background(), ExecuteOptions{
+		WorkDir: tempDir,
+		Prompt:  "Add a README",
+		JobID:   "job-1",
+		// A secret can't route around the proxy
+		Env:    []string{"HTTPS_PROXY=http://elsewhere:3128", "NO_PROXY=*"},
+		Output: func(stream string, source OutputSource, line string) {},
+	})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	got, err := os.ReadFile(envFile)
+	if err != nil {
+		t.Fatalf("failed to read env: %v", err)
+	}
+	lines := strings.Split(string(got), "\n")
+	if lines[0] != "http://"+netnsProxyAddr || lines[1] != "" {
+		t.Errorf("CLI proxy env = %q, want the bridged proxy and no bypass", got)
+	}
+}
+
+func TestCorrelationEnv_SkipsEmpty(t *testing.T) {
+	got := correlationEnv(ExecuteOptions{JobID: "job-1", TraceID: "trace-1"})
+	want := []string{"REPOBOX_JOB_ID=job-1", "REPOBOX_TRACE_ID=trace-1"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("correlationEnv() = %v, want %v", got, want)
+	}
+}
+
+func TestClaudeAgent_ResumeSession(t *testing.T) {
+	tests := []struct {
+		name        string
+		resume      string
+		wantCalls   []string // CLI arguments after the prompt, one entry per run
+		wantSession []string
+		wantErr     bool
+	}{
+		{"new conversation", "", []string{"-p Next"}, []string{"new-session"}, false},
+		{"resumed conversation", "abc", []string{"-p Next --resume abc"}, []string{"new-session"}, false},
+		{
+			"expired session starts fresh",
+			"expired",
+			[]string{"-p Next --resume expired", "-p Next"},
+			[]string{"new-session"},
+			false,
+		},
+		{"failure after the session started is not repeated", "broken", []string{"-p Next --resume broken"}, []string{"broken"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			callsFile := filepath.Join(tempDir, "calls.txt")
+
+			// Fake CLI that records each run's arguments and fails to resume
+			// "expired" before reporting a session
+			script := filepath.Join(tempDir, "fake-cli.sh")
+			content := "#!/bin/sh\n" +
+				"shift 4\necho \"$*\" >> " + callsFile + "\n" +
+				"case \"$*\" in\n" +
+				"  *'--resume expired'*) echo 'No conversation found with session ID: expired' >&2; exit 1 ;;\n" +
+				"  *'--resume broken'*) echo '{\"type\":\"system\",\"subtype\":\"init\",\"session_id\":\"broken\"}'; exit 2 ;;\n" +
+				"esac\n" +
+				"echo '{\"type\":\"system\",\"subtype\":\"init\",\"session_id\":\"new-session\"}'\n"
+			if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+				t.Fatalf("failed to write script: %v", err)
+			}
+
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			a := NewClaudeAgent(&Config{Enabled: true, CLIPath: script, MaxOutputLines: 100}, logger)
+
+			var sessions []string
+			_, err := a.Execute(context.Background(), ExecuteOptions{
+				WorkDir:         tempDir,
+				Prompt:          "Next",
+				JobID:           "test-resume",
+				ResumeSessionID: tt.resume,
+				Output:          func(stream string, source OutputSource, line string) {},
+				OnSession:       func(id string) { sessions = append(sessions, id) },
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Execute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			data, err := os.ReadFile(callsFile)
+			if err != nil {
+				t.Fatalf("failed to read calls: %v", err)
+			}
+			calls := strings.Split(strings.TrimSpace(string(data)), "\n")
+			if !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("CLI runs = %q, want %q", calls, tt.wantCalls)
+			}
+			if !reflect.DeepEqual(sessions, tt.wantSession) {
+				t.Errorf("reported sessions = %q, want %q", sessions, tt.wantSession)
+			}
+		})
+	}
+}
+
+func TestClaudeAgent_Result(t *testing.T) {
+	const success = `{"type":"result","subtype":"success","result":"Fixed the bug","num_turns":4,"total_cost_usd":0.0125,` +
+		`"usage":{"input_tokens":100,"cache_creation_input_tokens":20,"cache_read_input_tokens":30,"output_tokens":40}}`
+	const failure = `{"type":"result","subtype":"error_max_turns","num_turns":10,"total_cost_usd":0.5,"usage":{"input_tokens":900,"output_tokens":80}}`
+
+	tests := []struct {
+		name    string
+		enabled bool
+		script  string
+		wantErr bool
+		want    Result
+	}{
+		{
+			name:    "success",
+			enabled: true,
+			script:  "#!/bin/sh\necho '" + success + "'\n",
+			want:    Result{ExitCode: 0, Summary: "Fixed the bug", NumTurns: 4, InputTokens: 150, OutputTokens: 40, CostUSD: 0.0125},
+		},
+		{
+			name:    "failure keeps the reported usage",
+			enabled: true,
+			script:  "#!/bin/sh\necho '" + failure + "'\nexit 3\n",
+			wantErr: true,
+			want:    Result{ExitCode: 3, NumTurns: 10, InputTokens: 900, OutputTokens: 80, CostUSD: 0.5},
+		},
+		{
+			name:    "no report",
+			enabled: true,
+			script:  "#!/bin/sh\necho plain text\n",
+			want:    Result{ExitCode: 0},
+		},
+		{
+			name: "mock",
+			want: Result{ExitCode: 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			script := filepath.Join(tempDir, "fake-cli.sh")
+			if err := os.WriteFile(script, []byte(tt.script), 0755); err != nil {
+				t.Fatalf("failed to write script: %v", err)
+			}
+
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			a := NewClaudeAgent(&Config{Enabled: tt.enabled, CLIPath: script, MaxOutputLines: 100}, logger)
+
+			res, err := a.Execute(context.Background(), ExecuteOptions{
+				WorkDir: tempDir,
+				Prompt:  "test",
+				JobID:   "test-result",
+				Output:  func(stream string, source OutputSource, line string) {},
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Execute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if res == nil {
+				t.Fatal("Execute() returned a nil Result")
+			}
+
+			want := tt.want
+			if err != nil {
+				want.Error = err.Error()
+			}
+			if *res != want {
+				t.Errorf("Result = %+v, want %+v", *res, want)
+			}
+		})
+	}
+}
+
+func TestResult_StatusFields(t *testing.T) {
+	if fields := (&Result{ExitCode: 0, Summary: "done"}).StatusFields(); fields != nil {
+		t.Errorf("StatusFields() without usage = %v, want nil", fields)
+	}
+	if fields := (*Result)(nil).StatusFields(); fields != nil {
+		t.Errorf("StatusFields() of nil Result = %v, want nil", fields)
+	}
+
+	res := &Result{NumTurns: 4, InputTokens: 150, OutputTokens: 40, CostUSD: 0.0125}
+	want := map[string]interface{}{
+		"agent_turns":         4,
+		"agent_input_tokens":  150,
+		"agent_output_tokens": 40,
+		"agent_cost_usd":      "0.0125",
+	}
+	if got := res.StatusFields(); !reflect.DeepEqual(got, want) {
+		t.Errorf("StatusFields() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Agent network modes. With none and restricted the CLI runs in its own
+// network namespace, so the egress proxy is its only way out.
+const (
+	NetworkOpen       = "open"
+	NetworkNone       = "none"
+	NetworkRestricted = "restricted"
+)
+
+// DefaultAPIHosts are the AI API hosts the agent reaches in every mode
+var DefaultAPIHosts = []string{"api.anthropic.com"}
+
+// EgressPolicy decides which hosts the agent's network traffic may reach:
+// with none only the AI API, with restricted also the allowlist. The CLI runs
+// in a network namespace with only a loopback interface, where the filtering
+// proxy is reachable (see isolateNetwork), so a process opening sockets
+// directly reaches nothing.
+type EgressPolicy struct {
+	mode  string
+	hosts []hostRule
+}
+
+// hostRule is one allowed host, "*.example.com" for its subdomains, with an
+// optional port ("" = any)
+type hostRule struct {
+	host     string
+	wildcard bool
+	port     string
+}
+
+// NewEgressPolicy parses the API hosts and, in restricted mode, the allowlist.
+// Entries are host names or IPs, "*.example.com" for every subdomain, each
+// with an optional ":port". Returns nil in open mode, which disables the policy.
+func NewEgressPolicy(mode string, apiHosts, allow []string) (*EgressPolicy, error) {
+	switch mode {
+	case "", NetworkOpen:
+		return nil, nil
+	case NetworkNone:
+		allow = nil
+	case NetworkRestricted:
+	default:
+		return nil, fmt.Errorf("invalid agent network mode %q (want %s, %s or %s)", mode, NetworkOpen, NetworkNone, NetworkRestricted)
+	}
+
+	p := &EgressPolicy{mode: mode}
+	for _, entry := range append(append([]string{}, apiHosts...), allow...) {
+		rule, err := parseHostRule(entry)
+		if err != nil {
+			return nil, err
+		}
+		p.hosts = append(p.hosts, rule)
+	}
+	return p, nil
+}
+
+// parseHostRule parses one allowlist entry
+func parseHostRule(entry string) (hostRule, error) {
+	e := strings.ToLower(strings.TrimSpace(entry))
+	if e == "" || strings.ContainsAny(e, "/@ ") {
+		return hostRule{}, fmt.Errorf("invalid network allowlist entry %q (want a host like api.example.com or *.example.com:443)", entry)
+	}
+
+	var rule hostRule
+	if host, port, err := net.SplitHostPort(e); err == nil {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return hostRule{}, fmt.Errorf("invalid port in network allowlist entry %q", entry)
+		}
+		e, rule.port = host, port
+	}
+	e = strings.TrimSuffix(e, ".")
+	if rest, ok := strings.CutPrefix(e, "*."); ok {
+		e, rule.wildcard = rest, true
+	}
+	if e == "" || strings.Contains(e, "*") {
+		return hostRule{}, fmt.Errorf("invalid network allowlist entry %q (want a host like api.example.com or *.example.com:443)", entry)
+	}
+	rule.host = e
+	return rule, nil
+}
+
+// Allows reports whether the agent may connect to host on port
+func (p *EgressPolicy) Allows(host, port string) bool {
+	if p == nil {
+		return true
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, rule := range p.hosts {
+		if rule.port != "" && rule.port != port {
+			continue
+		}
+		if rule.wildcard && strings.HasSuffix(host, "."+rule.host) || !rule.wildcard && host == rule.host {
+			return true
+		}
+	}
+	return false
+}
+
+// Mode returns the network mode the policy enforces
+func (p *EgressPolicy) Mode() string {
+	if p == nil {
+		return NetworkOpen
+	}
+	return p.mode
+}
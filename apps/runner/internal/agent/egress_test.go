@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewEgressPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		allow    []string
+		wantNil  bool
+		wantErr  string
+		wantMode string
+	}{
+		{"default is open", "", nil, true, "", NetworkOpen},
+		{"open", NetworkOpen, []string{"example.com"}, true, "", NetworkOpen},
+		{"none", NetworkNone, nil, false, "", NetworkNone},
+		{"none ignores the allowlist", NetworkNone, []string{"bad/entry"}, false, "", NetworkNone},
+		{"restricted", NetworkRestricted, []string{"registry.npmjs.org", "*.github.com:443", "10.0.0.5", "[::1]:8080"}, false, "", NetworkRestricted},
+		{"unknown mode", "offline", nil, false, "invalid agent network mode", ""},
+		{"URL instead of host", NetworkRestricted, []string{"https://registry.npmjs.org"}, false, "invalid network allowlist entry", ""},
+		{"bad port", NetworkRestricted, []string{"example.com:http"}, false, "invalid port", ""},
+		{"port out of range", NetworkRestricted, []string{"example.com:70000"}, false, "invalid port", ""},
+		{"inner wildcard", NetworkRestricted, []string{"api.*.example.com"}, false, "invalid network allowlist entry", ""},
+		{"bare wildcard", NetworkRestricted, []string{"*"}, false, "invalid network allowlist entry", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewEgressPolicy(tt.mode, DefaultAPIHosts, tt.allow)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NewEgressPolicy() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewEgressPolicy() error = %v", err)
+			}
+			if (p == nil) != tt.wantNil {
+				t.Errorf("NewEgressPolicy() = %+v, want nil %v", p, tt.wantNil)
+			}
+			if got := p.Mode(); got != tt.wantMode {
+				t.Errorf("Mode() = %q, want %q", got, tt.wantMode)
+			}
+		})
+	}
+
+	if _, err := NewEgressPolicy(NetworkNone, []string{"api.example.com/v1"}, nil); err == nil {
+		t.Error("NewEgressPolicy() with an invalid API host: error = nil")
+	}
+}
+
+func TestEgressPolicy_Allows(t *testing.T) {
+	restricted, err := NewEgressPolicy(NetworkRestricted, DefaultAPIHosts, []string{"Registry.NPMjs.org", "*.github.com:443", "10.0.0.5"})
+	if err != nil {
+		t.Fatalf("NewEgressPolicy() error = %v", err)
+	}
+	none, err := NewEgressPolicy(NetworkNone, DefaultAPIHosts, nil)
+	if err != nil {
+		t.Fatalf("NewEgressPolicy() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		policy *EgressPolicy
+		host   string
+		port   string
+		want   bool
+	}{
+		{"open allows all", nil, "evil.example.com", "443", true},
+		{"API host", none, "api.anthropic.com", "443", true},
+		{"API host, trailing dot", none, "API.anthropic.com.", "443", true},
+		{"none blocks the rest", none, "registry.npmjs.org", "443", false},
+		{"API host in restricted", restricted, "api.anthropic.com", "443", true},
+		{"exact host, any port", restricted, "registry.npmjs.org", "80", true},
+		{"exact host is not a suffix", restricted, "evil-registry.npmjs.org", "443", false},
+		{"wildcard subdomain", restricted, "api.github.com", "443", true},
+		{"wildcard nested subdomain", restricted, "codeload.eu.github.com", "443", true},
+		{"wildcard excludes the apex", restricted, "github.com", "443", false},
+		{"wildcard port", restricted, "api.github.com", "22", false},
+		{"lookalike domain", restricted, "api.github.com.evil.io", "443", false},
+		{"IP", restricted, "10.0.0.5", "5432", true},
+		{"other IP", restricted, "10.0.0.6", "5432", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Allows(tt.host, tt.port); got != tt.want {
+				t.Errorf("Allows(%q, %q) = %v, want %v", tt.host, tt.port, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// egressDialTimeout bounds the proxy's connection to an allowed host
+const egressDialTimeout = 30 * time.Second
+
+// NetnsBridgeCommand is the hidden runner subcommand that runs the CLI inside
+// its network namespace (see RunNetnsBridge)
+const NetnsBridgeCommand = "agent-netns-bridge"
+
+// netnsProxyAddr is where the bridge serves the proxy inside the namespace.
+// The namespace belongs to one run, so a fixed port can't collide.
+const netnsProxyAddr = "127.0.0.1:3128"
+
+// egressProxy is a local HTTP proxy that forwards the agent's requests and
+// CONNECT tunnels to hosts its policy allows and refuses the rest. It listens
+// on a Unix socket, which the bridge in the CLI's network namespace reaches.
+type egressProxy struct {
+	policy    *EgressPolicy
+	onBlock   func(host string)
+	dir       string // Holds the socket
+	socket    string
+	listener  net.Listener
+	server    *http.Server
+	transport *http.Transport
+
+	mu      sync.Mutex
+	blocked map[string]bool // Hosts already reported to onBlock
+	tunnels map[net.Conn]struct{}
+}
+
+// startEgressProxy listens on a socket in a new temporary directory for one
+// agent run. onBlock is called once per refused host.
+func startEgressProxy(policy *EgressPolicy, onBlock func(host string)) (*egressProxy, error) {
+	dir, err := os.MkdirTemp("", "repobox-egress-")
+	if err != nil {
+		return nil, err
+	}
+	socket := filepath.Join(dir, "proxy.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	p := &egressProxy{
+		policy:    policy,
+		onBlock:   onBlock,
+		dir:       dir,
+		socket:    socket,
+		listener:  listener,
+		transport: &http.Transport{Proxy: nil, DialContext: (&net.Dialer{Timeout: egressDialTimeout}).DialContext},
+		blocked:   make(map[string]bool),
+		tunnels:   make(map[net.Conn]struct{}),
+	}
+	p.server = &http.Server{Handler: p, ReadHeaderTimeout: egressDialTimeout}
+	go p.server.Serve(listener)
+	return p, nil
+}
+
+// env returns the proxy variables that route the CLI and its tools through
+// the bridge to the proxy
+func (p *egressProxy) env() []string {
+	proxyURL := "http://" + netnsProxyAddr
+	var env []string
+	for _, name := range []string{"HTTPS_PROXY", "HTTP_PROXY", "ALL_PROXY"} {
+		env = append(env, name+"="+proxyURL, strings.ToLower(name)+"="+proxyURL)
+	}
+	// Nothing bypasses the proxy
+	return append(env, "NO_PROXY=", "no_proxy=")
+}
+
+// Close stops the proxy and its open tunnels and removes the socket
+func (p *egressProxy) Close() error {
+	err := p.server.Close()
+	p.mu.Lock()
+	for conn := range p.tunnels {
+		conn.Close()
+	}
+	p.mu.Unlock()
+	p.transport.CloseIdleConnections()
+	os.RemoveAll(p.dir)
+	return err
+}
+
+func (p *egressProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target, defaultPort := r.Host, "443"
+	if r.Method != http.MethodConnect {
+		target, defaultPort = r.URL.Host, "80"
+		if r.URL.Scheme == "https" {
+			defaultPort = "443"
+		}
+	}
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		host, port = target, defaultPort
+	}
+
+	if !p.policy.Allows(host, port) {
+		p.block(net.JoinHostPort(host, port))
+		http.Error(w, "blocked by the runner's agent network policy", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r, net.JoinHostPort(host, port))
+		return
+	}
+	p.forward(w, r)
+}
+
+// block reports a refused host the first time it is seen
+func (p *egressProxy) block(target string) {
+	p.mu.Lock()
+	seen := p.blocked[target]
+	p.blocked[target] = true
+	p.mu.Unlock()
+	if !seen && p.onBlock != nil {
+		p.onBlock(target)
+	}
+}
+
+// tunnel connects the client to target and copies bytes both ways
+func (p *egressProxy) tunnel(w http.ResponseWriter, r *http.Request, target string) {
+	ctx, cancel := context.WithTimeout(r.Context(), egressDialTimeout)
+	defer cancel()
+	upstream, err := (&net.Dialer{}).DialContext(ctx, "tcp", target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "tunneling not supported", http.StatusInternalServerError)
+		return
+	}
+	client, _, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	if _, err := io.WriteString(client, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		client.Close()
+		upstream.Close()
+		return
+	}
+
+	p.mu.Lock()
+	p.tunnels[client] = struct{}{}
+	p.tunnels[upstream] = struct{}{}
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.tunnels, client)
+		delete(p.tunnels, upstream)
+		p.mu.Unlock()
+	}()
+
+	done := make(chan struct{}, 2)
+	pipe := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		// Unblock the other direction
+		dst.Close()
+		src.Close()
+		done <- struct{}{}
+	}
+	go pipe(upstream, client)
+	go pipe(client, upstream)
+	<-done
+	<-done
+}
+
+// forward sends a plain HTTP proxy request on and copies the response back
+func (p *egressProxy) forward(w http.ResponseWriter, r *http.Request) {
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.Header.Del("Proxy-Connection")
+	out.Header.Del("Proxy-Authorization")
+
+	resp, err := p.transport.RoundTrip(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	for name, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
@@ -0,0 +1,148 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEgressProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello from upstream")
+	}))
+	defer upstream.Close()
+	_, upstreamPort, _ := net.SplitHostPort(strings.TrimPrefix(upstream.URL, "http://"))
+
+	// Only the loopback IP is allowed, so "localhost" is a blocked host on the same server
+	policy, err := NewEgressPolicy(NetworkRestricted, nil, []string{"127.0.0.1"})
+	if err != nil {
+		t.Fatalf("NewEgressPolicy() error = %v", err)
+	}
+	var mu sync.Mutex
+	var blocked []string
+	proxy, err := startEgressProxy(policy, func(host string) {
+		mu.Lock()
+		defer mu.Unlock()
+		blocked = append(blocked, host)
+	})
+	if err != nil {
+		t.Fatalf("startEgressProxy() error = %v", err)
+	}
+	defer proxy.Close()
+
+	// Reach the proxy on its socket, as the bridge does
+	dialProxy := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", proxy.socket)
+	}
+	proxyURL, _ := url.Parse("http://" + netnsProxyAddr)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL), DialContext: dialProxy}}
+
+	t.Run("plain request allowed", func(t *testing.T) {
+		resp, err := client.Get(upstream.URL)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK || string(body) != "hello from upstream" {
+			t.Errorf("response = %d %q, want the upstream's", resp.StatusCode, body)
+		}
+	})
+
+	t.Run("plain request blocked", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			resp, err := client.Get("http://localhost:" + upstreamPort)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusForbidden {
+				t.Errorf("status = %d, want 403", resp.StatusCode)
+			}
+		}
+	})
+
+	connect := func(t *testing.T, target string) (*http.Response, net.Conn, *bufio.Reader) {
+		t.Helper()
+		conn, err := net.Dial("unix", proxy.socket)
+		if err != nil {
+			t.Fatalf("Dial() error = %v", err)
+		}
+		fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target)
+		reader := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			conn.Close()
+			t.Fatalf("ReadResponse() error = %v", err)
+		}
+		return resp, conn, reader
+	}
+
+	t.Run("tunnel allowed", func(t *testing.T) {
+		resp, conn, reader := connect(t, "127.0.0.1:"+upstreamPort)
+		defer conn.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("CONNECT status = %d, want 200", resp.StatusCode)
+		}
+		// Speak HTTP through the tunnel
+		fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: 127.0.0.1\r\nConnection: close\r\n\r\n")
+		tunneled, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatalf("ReadResponse() through the tunnel error = %v", err)
+		}
+		body, _ := io.ReadAll(tunneled.Body)
+		if string(body) != "hello from upstream" {
+			t.Errorf("tunneled body = %q", body)
+		}
+	})
+
+	t.Run("tunnel blocked", func(t *testing.T) {
+		resp, conn, _ := connect(t, "example.com:443")
+		defer conn.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("CONNECT status = %d, want 403", resp.StatusCode)
+		}
+	})
+
+	// Each blocked host is reported once
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"localhost:" + upstreamPort, "example.com:443"}
+	if strings.Join(blocked, ",") != strings.Join(want, ",") {
+		t.Errorf("blocked = %q, want %q", blocked, want)
+	}
+}
+
+func TestEgressProxy_Env(t *testing.T) {
+	proxy, err := startEgressProxy(&EgressPolicy{mode: NetworkNone}, nil)
+	if err != nil {
+		t.Fatalf("startEgressProxy() error = %v", err)
+	}
+	defer proxy.Close()
+
+	env := strings.Join(proxy.env(), "\n")
+	want := "http://" + netnsProxyAddr
+	for _, name := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy", "ALL_PROXY", "all_proxy"} {
+		if !strings.Contains(env, name+"="+want+"\n") {
+			t.Errorf("env missing %s=%s:\n%s", name, want, env)
+		}
+	}
+	if !strings.Contains(env, "NO_PROXY=\n") {
+		t.Errorf("env does not clear NO_PROXY:\n%s", env)
+	}
+
+	// Closing the proxy removes its socket
+	proxy.Close()
+	if _, err := os.Stat(proxy.dir); !os.IsNotExist(err) {
+		t.Errorf("socket directory still exists after Close(): %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ExecuteWithHeartbeat runs the agent and writes a heartbeat line through
+// opts.Output whenever the agent has produced no output for interval, so the
+// UI can tell a quiet run from a stalled one. A zero interval disables heartbeats.
+func ExecuteWithHeartbeat(ctx context.Context, a Agent, opts ExecuteOptions, interval time.Duration) (*Result, error) {
+	if interval <= 0 || opts.Output == nil {
+		return a.Execute(ctx, opts)
+	}
+
+	var mu sync.Mutex
+	start := time.Now()
+	lastOutput := start
+
+	output := opts.Output
+	opts.Output = func(stream string, source OutputSource, line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		lastOutput = time.Now()
+		output(stream, source, line)
+	}
+	// Tool results are written beside Output, so they count as output too
+	if onToolResult := opts.OnToolResult; onToolResult != nil {
+		opts.OnToolResult = func(stream, toolUseID, summary, content string) {
+			mu.Lock()
+			defer mu.Unlock()
+			lastOutput = time.Now()
+			onToolResult(stream, toolUseID, summary, content)
+		}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+
+			mu.Lock()
+			quiet := time.Since(lastOutput)
+			if quiet >= interval {
+				elapsed := time.Since(start).Round(time.Second)
+				output("stdout", SourceHeartbeat, fmt.Sprintf("Agent still running (%s elapsed)", elapsed))
+				lastOutput = time.Now()
+				quiet = 0
+			}
+			mu.Unlock()
+
+			timer.Reset(interval - quiet)
+		}
+	}()
+
+	res, err := a.Execute(ctx, opts)
+
+	// Wait for the heartbeat goroutine so no line is written after we return
+	close(done)
+	<-stopped
+	return res, err
+}
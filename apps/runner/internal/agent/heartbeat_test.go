@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// agentFunc adapts a function to the Agent interface
+type agentFunc func(ctx context.Context, opts ExecuteOptions) error
+
+func (f agentFunc) Execute(ctx context.Context, opts ExecuteOptions) (*Result, error) {
+	return &Result{}, f(ctx, opts)
+}
+
+// recorder collects output lines by source
+type recorder struct {
+	mu     sync.Mutex
+	counts map[OutputSource]int
+}
+
+func (r *recorder) write(stream string, source OutputSource, line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.counts == nil {
+		r.counts = make(map[OutputSource]int)
+	}
+	r.counts[source]++
+}
+
+func (r *recorder) count(source OutputSource) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.counts[source]
+}
+
+func TestExecuteWithHeartbeat_QuietRun(t *testing.T) {
+	rec := &recorder{}
+	quiet := agentFunc(func(ctx context.Context, opts ExecuteOptions) error {
+		time.Sleep(120 * time.Millisecond)
+		return nil
+	})
+
+	_, err := ExecuteWithHeartbeat(context.Background(), quiet, ExecuteOptions{Output: rec.write}, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("ExecuteWithHeartbeat() error = %v", err)
+	}
+
+	got := rec.count(SourceHeartbeat)
+	if got < 2 {
+		t.Errorf("heartbeats during quiet run = %d, want at least 2", got)
+	}
+
+	// Heartbeats must stop once the agent has returned
+	time.Sleep(60 * time.Millisecond)
+	if after := rec.count(SourceHeartbeat); after != got {
+		t.Errorf("heartbeats after run = %d, want %d", after, got)
+	}
+}
+
+func TestExecuteWithHeartbeat_BusyRun(t *testing.T) {
+	rec := &recorder{}
+	busy := agentFunc(func(ctx context.Context, opts ExecuteOptions) error {
+		for i := 0; i < 20; i++ {
+			opts.Output("stdout", SourceClaude, "working")
+			time.Sleep(5 * time.Millisecond)
+		}
+		return nil
+	})
+
+	if _, err := ExecuteWithHeartbeat(context.Background(), busy, ExecuteOptions{Output: rec.write}, 50*time.Millisecond); err != nil {
+		t.Fatalf("ExecuteWithHeartbeat() error = %v", err)
+	}
+
+	if got := rec.count(SourceHeartbeat); got != 0 {
+		t.Errorf("heartbeats during busy run = %d, want 0", got)
+	}
+	if got := rec.count(SourceClaude); got != 20 {
+		t.Errorf("agent lines = %d, want 20", got)
+	}
+}
+
+func TestExecuteWithHeartbeat_ToolResults(t *testing.T) {
+	rec := &recorder{}
+	var results int
+	busy := agentFunc(func(ctx context.Context, opts ExecuteOptions) error {
+		for i := 0; i < 20; i++ {
+			opts.OnToolResult("stdout", "toolu_1", "└─ ok", "ok")
+			time.Sleep(5 * time.Millisecond)
+		}
+		return nil
+	})
+
+	opts := ExecuteOptions{
+		Output:       rec.write,
+		OnToolResult: func(stream, toolUseID, summary, content string) { results++ },
+	}
+	if _, err := ExecuteWithHeartbeat(context.Background(), busy, opts, 50*time.Millisecond); err != nil {
+		t.Fatalf("ExecuteWithHeartbeat() error = %v", err)
+	}
+
+	if got := rec.count(SourceHeartbeat); got != 0 {
+		t.Errorf("heartbeats during tool results = %d, want 0", got)
+	}
+	if results != 20 {
+		t.Errorf("tool results = %d, want 20", results)
+	}
+}
+
+func TestExecuteWithHeartbeat_Disabled(t *testing.T) {
+	rec := &recorder{}
+	quiet := agentFunc(func(ctx context.Context, opts ExecuteOptions) error {
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+
+	if _, err := ExecuteWithHeartbeat(context.Background(), quiet, ExecuteOptions{Output: rec.write}, 0); err != nil {
+		t.Fatalf("ExecuteWithHeartbeat() error = %v", err)
+	}
+
+	if got := rec.count(SourceHeartbeat); got != 0 {
+		t.Errorf("heartbeats with interval 0 = %d, want 0", got)
+	}
+}
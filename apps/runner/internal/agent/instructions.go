@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultInstructionsKey holds the instructions used when an environment has no entry of its own
+const DefaultInstructionsKey = "default"
+
+// Instructions maps an environment to the system instructions added to every agent run in it
+type Instructions map[string]string
+
+// LoadInstructions reads the environment -> instructions JSON object from the
+// file at path and/or the inline JSON. Inline entries override file entries.
+// Invalid JSON returns an error so the runner fails at startup.
+func LoadInstructions(path, inline string) (Instructions, error) {
+	instructions := Instructions{}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read agent instructions: %w", err)
+		}
+		if err := json.Unmarshal(data, &instructions); err != nil {
+			return nil, fmt.Errorf("invalid agent instructions %s: %w", path, err)
+		}
+		instructions = instructions.normalized()
+	}
+
+	if strings.TrimSpace(inline) != "" {
+		var overrides Instructions
+		if err := json.Unmarshal([]byte(inline), &overrides); err != nil {
+			return nil, fmt.Errorf("invalid inline agent instructions: %w", err)
+		}
+		// Normalized first, so an override replaces a file entry spelled differently
+		for env, text := range overrides.normalized() {
+			instructions[env] = text
+		}
+	}
+
+	return instructions.normalized(), nil
+}
+
+// normalized returns the instructions with lowercased, trimmed environments and trimmed text
+func (i Instructions) normalized() Instructions {
+	normalized := make(Instructions, len(i))
+	for env, text := range i {
+		normalized[strings.ToLower(strings.TrimSpace(env))] = strings.TrimSpace(text)
+	}
+	return normalized
+}
+
+// For returns the instructions for env, falling back to the default entry
+func (i Instructions) For(env string) string {
+	if text, ok := i[strings.ToLower(env)]; ok {
+		return text
+	}
+	return i[DefaultInstructionsKey]
+}
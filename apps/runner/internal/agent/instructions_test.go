@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadInstructions(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "instructions.json")
+	if err := os.WriteFile(file, []byte(`{"default": "Keep changes small.", "PHP": " Follow PSR-12. "}`), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	broken := filepath.Join(dir, "broken.json")
+	if err := os.WriteFile(broken, []byte(`{"php":`), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		inline  string
+		want    Instructions
+		wantErr bool
+	}{
+		{"none", "", "", Instructions{}, false},
+		{"file", file, "", Instructions{"default": "Keep changes small.", "php": "Follow PSR-12."}, false},
+		{"inline overrides file", file, `{"php": "Use Laravel conventions."}`, Instructions{"default": "Keep changes small.", "php": "Use Laravel conventions."}, false},
+		{"missing file", filepath.Join(dir, "missing.json"), "", nil, true},
+		{"invalid file", broken, "", nil, true},
+		{"invalid inline", "", "php=PSR-12", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadInstructions(tt.path, tt.inline)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadInstructions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("LoadInstructions() = %v, want %v", got, tt.want)
+			}
+			for env, text := range tt.want {
+				if got[env] != text {
+					t.Errorf("instructions[%q] = %q, want %q", env, got[env], text)
+				}
+			}
+		})
+	}
+}
+
+func TestInstructions_For(t *testing.T) {
+	withDefault := Instructions{"default": "Keep changes small.", "php": "Follow PSR-12."}
+	withoutDefault := Instructions{"php": "Follow PSR-12."}
+
+	tests := []struct {
+		name         string
+		instructions Instructions
+		env          string
+		want         string
+	}{
+		{"exact match", withDefault, "php", "Follow PSR-12."},
+		{"case insensitive", withDefault, "PHP", "Follow PSR-12."},
+		{"fallback to default", withDefault, "python", "Keep changes small."},
+		{"default environment", withDefault, "default", "Keep changes small."},
+		{"no default", withoutDefault, "python", ""},
+		{"empty registry", nil, "php", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.instructions.For(tt.env); got != tt.want {
+				t.Errorf("For(%q) = %q, want %q", tt.env, got, tt.want)
+			}
+		})
+	}
+}
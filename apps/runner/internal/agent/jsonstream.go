@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+)
+
+// maxPendingJSON caps how much of an unfinished multi-line JSON value is
+// buffered, the same as the longest line the scanner accepts
+const maxPendingJSON = 2 * 1024 * 1024
+
+// jsonAssembler turns output lines into stream messages. The CLI normally
+// writes one JSON object per line, but a value may also be pretty-printed
+// over several lines, several objects may share a line, or the messages may
+// come as one JSON array. Lines that don't form JSON come back as raw text.
+type jsonAssembler struct {
+	pending      bytes.Buffer
+	pendingLines []string
+}
+
+// feed adds a line and returns the messages it completes, or the lines to
+// output as raw text (in order) when they turned out not to be JSON
+func (j *jsonAssembler) feed(line string) ([]StreamMessage, []string) {
+	if j.pending.Len() == 0 {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+			return nil, []string{line}
+		}
+	}
+
+	j.pending.WriteString(line)
+	j.pending.WriteByte('\n')
+	j.pendingLines = append(j.pendingLines, line)
+
+	// Only a closing line can complete a value; skip decoding the lines inside
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasSuffix(trimmed, "}") && !strings.HasSuffix(trimmed, "]") {
+		if j.pending.Len() > maxPendingJSON {
+			return nil, j.flush()
+		}
+		return nil, nil
+	}
+
+	msgs, complete, err := decodeStreamMessages(j.pending.Bytes())
+	switch {
+	case err != nil:
+		return nil, j.flush()
+	case complete && len(msgs) == 0:
+		// e.g. "[]" or "[ ]" in plain text output
+		return nil, j.flush()
+	case complete:
+		j.reset()
+		return msgs, nil
+	case j.pending.Len() > maxPendingJSON:
+		return nil, j.flush()
+	default:
+		return nil, nil
+	}
+}
+
+// flush returns the buffered lines as raw text, e.g. at the end of the output
+func (j *jsonAssembler) flush() []string {
+	lines := j.pendingLines
+	j.reset()
+	return lines
+}
+
+func (j *jsonAssembler) reset() {
+	j.pending.Reset()
+	j.pendingLines = nil
+}
+
+// decodeStreamMessages decodes the JSON objects in data, which may be
+// concatenated and may be wrapped in arrays. complete is false when data ends
+// inside a value; err is set when data isn't a sequence of JSON objects.
+func decodeStreamMessages(data []byte) (msgs []StreamMessage, complete bool, err error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		rest := bytes.TrimLeft(data[dec.InputOffset():], " \t\r\n")
+		if len(rest) == 0 {
+			return msgs, true, nil
+		}
+
+		if rest[0] != '[' {
+			var msg StreamMessage
+			if err := dec.Decode(&msg); err != nil {
+				return nil, false, incompleteOr(err, len(data))
+			}
+			msgs = append(msgs, msg)
+			continue
+		}
+
+		if _, err := dec.Token(); err != nil {
+			return nil, false, incompleteOr(err, len(data))
+		}
+		for dec.More() {
+			var msg StreamMessage
+			if err := dec.Decode(&msg); err != nil {
+				return nil, false, incompleteOr(err, len(data))
+			}
+			msgs = append(msgs, msg)
+		}
+		// The closing bracket, or EOF when the array isn't finished yet
+		if _, err := dec.Token(); err != nil {
+			return nil, false, incompleteOr(err, len(data))
+		}
+	}
+}
+
+// incompleteOr returns nil for the errors of input that ends inside a value,
+// so the caller waits for more lines, and err otherwise
+func incompleteOr(err error, size int) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil
+	}
+	// Inside an array the decoder reports the end as a syntax error
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) && syntaxErr.Offset >= int64(size) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStreamOutput_JSONFraming(t *testing.T) {
+	const textMsg = `{"type":"assistant","message":{"content":[{"type":"text","text":"%s"}]}}`
+	text := func(s string) string { return strings.Replace(textMsg, "%s", s, 1) }
+
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "ndjson",
+			input: text("one") + "\n" + text("two") + "\n",
+			want:  []string{"one", "two"},
+		},
+		{
+			name: "pretty-printed object",
+			input: `{
+  "type": "assistant",
+  "message": {
+    "content": [
+      {"type": "text", "text": "pretty"}
+    ]
+  }
+}
+` + text("after") + "\n",
+			want: []string{"pretty", "after"},
+		},
+		{
+			name:  "concatenated objects on one line",
+			input: text("one") + text("two") + "\n",
+			want:  []string{"one", "two"},
+		},
+		{
+			name:  "array on one line",
+			input: "[" + text("one") + "," + text("two") + "]\n",
+			want:  []string{"one", "two"},
+		},
+		{
+			name:  "array over several lines",
+			input: "[\n  " + text("one") + ",\n  " + text("two") + "\n]\n",
+			want:  []string{"one", "two"},
+		},
+		{
+			name:  "plain text in brackets",
+			input: "[INFO] starting\n{not json}\n[]\n",
+			want:  []string{"[INFO] starting", "{not json}", "[]"},
+		},
+		{
+			name:  "unfinished JSON followed by text",
+			input: "{\n  \"type\": \"assistant\",\nplain text }\n" + text("next") + "\n",
+			want:  []string{"{", "  \"type\": \"assistant\",", "plain text }", "next"},
+		},
+		{
+			name:  "unfinished JSON at the end",
+			input: text("one") + "\n{\n  \"type\": \"assistant\",\n",
+			want:  []string{"one", "{", "  \"type\": \"assistant\","},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+			a := NewClaudeAgent(&Config{MaxOutputLines: 100}, logger)
+
+			var lines []string
+			output := func(stream string, source OutputSource, line string) {
+				lines = append(lines, line)
+			}
+
+			if err := a.streamOutput(context.Background(), strings.NewReader(tt.input), "stdout", output, nil, nil); err != nil {
+				t.Fatalf("streamOutput() error = %v", err)
+			}
+			if !reflect.DeepEqual(lines, tt.want) {
+				t.Errorf("output = %q, want %q", lines, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamOutput_PrettyPrintedResult(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	a := NewClaudeAgent(&Config{MaxOutputLines: 100}, logger)
+
+	input := "{\n  \"type\": \"result\",\n  \"subtype\": \"success\",\n  \"result\": \"Fixed the bug\"\n}\n"
+	var summary string
+	hooks := &streamHooks{onResult: func(msg *StreamMessage) { summary = msg.Result }}
+	output := func(stream string, source OutputSource, line string) {}
+
+	if err := a.streamOutput(context.Background(), strings.NewReader(input), "stdout", output, nil, hooks); err != nil {
+		t.Fatalf("streamOutput() error = %v", err)
+	}
+	if summary != "Fixed the bug" {
+		t.Errorf("result summary = %q, want %q", summary, "Fixed the bug")
+	}
+}
+
+func TestJSONAssembler_PendingCap(t *testing.T) {
+	var j jsonAssembler
+	if msgs, raw := j.feed("{"); msgs != nil || raw != nil {
+		t.Fatalf("feed(\"{\") = %v, %q, want it buffered", msgs, raw)
+	}
+
+	line := `  "padding": "` + strings.Repeat("x", maxPendingJSON) + `",`
+	msgs, raw := j.feed(line)
+	if msgs != nil || len(raw) != 2 || raw[0] != "{" || raw[1] != line {
+		t.Errorf("feed() past the cap returned %d messages and %d raw lines, want the 2 buffered lines", len(msgs), len(raw))
+	}
+	if j.pending.Len() != 0 {
+		t.Errorf("pending = %d bytes after the cap, want 0", j.pending.Len())
+	}
+}
@@ -0,0 +1,192 @@
+package agent
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// Capability and prctl constants the syscall package doesn't define
+const (
+	capNetAdmin          = 12
+	prCapAmbient         = 47
+	prCapAmbientClearAll = 4
+)
+
+// netnsAttr starts a process in a new user and network namespace. The user
+// keeps its IDs, and CAP_NET_ADMIN in the new namespace lets the bridge bring
+// the loopback interface up; Pdeathsig takes it down with the runner.
+func netnsAttr() *syscall.SysProcAttr {
+	uid, gid := os.Getuid(), os.Getgid()
+	return &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}},
+		AmbientCaps: []uintptr{capNetAdmin},
+		Pdeathsig:   syscall.SIGKILL,
+	}
+}
+
+// isolateNetwork rewrites cmd to run in a network namespace of its own, which
+// has nothing but a loopback interface. The runner binary starts there as the
+// bridge (RunNetnsBridge): it forwards netnsProxyAddr to the egress proxy's
+// socket and runs the original command.
+func isolateNetwork(cmd *exec.Cmd, socket string) error {
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the runner binary: %w", err)
+	}
+	cmd.Args = append([]string{self, NetnsBridgeCommand, socket, "--", cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = self
+	cmd.SysProcAttr = netnsAttr()
+	return nil
+}
+
+// CheckNetworkIsolation starts the bridge in a new network namespace once, so
+// a host that doesn't allow unprivileged user namespaces fails at startup
+// instead of on every agent run
+func CheckNetworkIsolation(ctx context.Context) error {
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find the runner binary: %w", err)
+	}
+	cmd := exec.CommandContext(ctx, self, NetnsBridgeCommand, "", "--")
+	cmd.SysProcAttr = netnsAttr()
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// RunNetnsBridge is the NetnsBridgeCommand, started by isolateNetwork with
+// the arguments <socket> -- <command> [args...]. It brings the namespace's
+// loopback interface up, forwards connections to netnsProxyAddr to the
+// socket, runs the command and returns its exit code. Without a command it
+// only checks the namespace works.
+func RunNetnsBridge(args []string) int {
+	if len(args) < 2 || args[1] != "--" {
+		fmt.Fprintf(os.Stderr, "usage: runner %s <socket> -- <command> [args...]\n", NetnsBridgeCommand)
+		return 2
+	}
+	socket, command := args[0], args[2:]
+
+	if err := loopbackUp(); err != nil {
+		fmt.Fprintf(os.Stderr, "agent network: failed to bring up loopback: %v\n", err)
+		return 1
+	}
+	if len(command) == 0 {
+		return 0
+	}
+
+	listener, err := net.Listen("tcp", netnsProxyAddr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "agent network: failed to listen on %s: %v\n", netnsProxyAddr, err)
+		return 1
+	}
+	go forwardToSocket(listener, socket)
+
+	// Ambient capabilities and Pdeathsig are per thread, keep the command's
+	// parent thread fixed and don't pass CAP_NET_ADMIN on
+	runtime.LockOSThread()
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prCapAmbient, prCapAmbientClearAll, 0); errno != 0 {
+		fmt.Fprintf(os.Stderr, "agent network: failed to drop capabilities: %v\n", errno)
+		return 1
+	}
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL}
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "agent network: %v\n", err)
+		return 127
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		for sig := range signals {
+			cmd.Process.Signal(sig)
+		}
+	}()
+
+	err = cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "agent network: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// loopbackUp sets the lo interface up (SIOCSIFFLAGS), a new network
+// namespace starts with it down
+func loopbackUp() error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	// struct ifreq: the interface name, then the flags
+	var req [40]byte
+	copy(req[:syscall.IFNAMSIZ-1], "lo")
+	binary.NativeEndian.PutUint16(req[syscall.IFNAMSIZ:], syscall.IFF_UP|syscall.IFF_LOOPBACK|syscall.IFF_RUNNING)
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCSIFFLAGS, uintptr(unsafe.Pointer(&req[0]))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// forwardToSocket copies each connection accepted on listener to a new
+// connection to the socket and back
+func forwardToSocket(listener net.Listener, socket string) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			upstream, err := net.Dial("unix", socket)
+			if err != nil {
+				return
+			}
+			defer upstream.Close()
+
+			done := make(chan struct{}, 2)
+			pipe := func(dst, src net.Conn) {
+				io.Copy(dst, src)
+				// Unblock the other direction
+				dst.Close()
+				src.Close()
+				done <- struct{}{}
+			}
+			go pipe(upstream, conn)
+			go pipe(conn, upstream)
+			<-done
+			<-done
+		}()
+	}
+}
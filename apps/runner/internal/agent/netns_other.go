@@ -0,0 +1,30 @@
+//go:build !linux
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// errNoNetns is returned where network namespaces don't exist
+var errNoNetns = errors.New("AGENT_NETWORK none and restricted need Linux network namespaces")
+
+// isolateNetwork can't isolate the agent outside Linux
+func isolateNetwork(cmd *exec.Cmd, socket string) error {
+	return errNoNetns
+}
+
+// CheckNetworkIsolation reports that the agent can't be isolated outside Linux
+func CheckNetworkIsolation(ctx context.Context) error {
+	return errNoNetns
+}
+
+// RunNetnsBridge is the NetnsBridgeCommand, which only exists on Linux
+func RunNetnsBridge(args []string) int {
+	fmt.Fprintln(os.Stderr, errNoNetns)
+	return 1
+}
@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// probeEnv makes the test binary, started as the agent CLI, probe its network
+// and write the results to the file the variable names
+const probeEnv = "AGENT_TEST_NETWORK_PROBE"
+
+func TestMain(m *testing.M) {
+	// Isolated runs start the test binary as the bridge, as they would the runner
+	if len(os.Args) > 1 && os.Args[1] == NetnsBridgeCommand {
+		os.Exit(RunNetnsBridge(os.Args[2:]))
+	}
+	if out := os.Getenv(probeEnv); out != "" {
+		os.Exit(probeNetwork(out, os.Getenv(probeEnv+"_HOST")))
+	}
+	os.Exit(m.Run())
+}
+
+// probeNetwork dials host directly and tunnels to it through the proxy the
+// CLI is given, writing one line per attempt to out
+func probeNetwork(out, host string) int {
+	var results []string
+	if conn, err := net.Dial("tcp", host); err != nil {
+		results = append(results, "direct: failed")
+	} else {
+		conn.Close()
+		results = append(results, "direct: connected")
+	}
+
+	proxyAddr := strings.TrimPrefix(os.Getenv("HTTPS_PROXY"), "http://")
+	for _, target := range []string{host, "example.com:443"} {
+		conn, err := net.Dial("tcp", proxyAddr)
+		if err != nil {
+			results = append(results, "proxy: failed")
+			continue
+		}
+		fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target)
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		conn.Close()
+		if err != nil {
+			results = append(results, "proxy: failed")
+			continue
+		}
+		results = append(results, fmt.Sprintf("proxy %s: %d", target, resp.StatusCode))
+	}
+
+	if err := os.WriteFile(out, []byte(strings.Join(results, "\n")), 0644); err != nil {
+		return 1
+	}
+	return 0
+}
+
+func TestClaudeAgent_NetworkIsolation(t *testing.T) {
+	if err := CheckNetworkIsolation(context.Background()); err != nil {
+		t.Skipf("network namespaces unavailable: %v", err)
+	}
+
+	// Listens on the runner's loopback, which the namespace doesn't share
+	host := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer host.Close()
+	hostAddr := strings.TrimPrefix(host.URL, "http://")
+
+	egress, err := NewEgressPolicy(NetworkRestricted, DefaultAPIHosts, []string{hostAddr})
+	if err != nil {
+		t.Fatalf("NewEgressPolicy() error = %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	a := NewClaudeAgent(&Config{Enabled: true, CLIPath: os.Args[0], MaxOutputLines: 100, Egress: egress}, logger)
+
+	out := filepath.Join(t.TempDir(), "probe.txt")
+	var blocked []string
+	_, err = a.Execute(context.Background(), ExecuteOptions{
+		WorkDir: t.TempDir(),
+		Prompt:  "Add a README",
+		JobID:   "job-1",
+		Env:     []string{probeEnv + "=" + out, probeEnv + "_HOST=" + hostAddr},
+		Output: func(stream string, source OutputSource, line string) {
+			if source == SourceRunner && strings.HasPrefix(line, "Network access") {
+				blocked = append(blocked, line)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("failed to read probe results: %v", err)
+	}
+	want := "direct: failed\nproxy " + hostAddr + ": 200\nproxy example.com:443: 403"
+	if string(got) != want {
+		t.Errorf("probe = %q, want %q", got, want)
+	}
+	if len(blocked) != 1 || !strings.Contains(blocked[0], "example.com:443") {
+		t.Errorf("blocked lines = %q, want one for example.com:443", blocked)
+	}
+}
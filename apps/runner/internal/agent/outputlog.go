@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// outputLog appends the CLI's output lines to <dir>/<job_id>.log, masked by
+// the job's redactor but before MaxOutputLines truncation. When the file reaches
+// maxBytes it is rotated to <job_id>.log.1, so a job keeps at most twice
+// maxBytes on disk. A nil *outputLog discards lines.
+type outputLog struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64 // 0 = no cap
+	redact   func(line string) string
+	file     *os.File
+	w        *bufio.Writer
+	size     int64
+	failed   bool
+	logger   *slog.Logger
+}
+
+// openOutputLog creates the job's log file in dir, or appends to it when the
+// job's agent runs again (retries, a failed resume). Without redact the log
+// is refused, so secrets never reach the disk unmasked.
+func openOutputLog(dir, jobID string, maxBytes int64, redact func(string) string, logger *slog.Logger) (*outputLog, error) {
+	if jobID == "" || jobID == "." || jobID == ".." || filepath.Base(jobID) != jobID {
+		return nil, fmt.Errorf("invalid job ID %q for output log", jobID)
+	}
+	if redact == nil {
+		return nil, fmt.Errorf("no redactor for output log")
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create output log dir: %w", err)
+	}
+
+	l := &outputLog{
+		path:     filepath.Join(dir, jobID+".log"),
+		maxBytes: maxBytes,
+		redact:   redact,
+		logger:   logger,
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *outputLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open output log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat output log: %w", err)
+	}
+	l.file = f
+	l.w = bufio.NewWriter(f)
+	l.size = info.Size()
+	return nil
+}
+
+// write appends "<stream>\t<redacted line>". The first write error is
+// logged and disables the log; the job itself carries on.
+func (l *outputLog) write(stream, line string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.failed {
+		return
+	}
+
+	entry := stream + "\t" + l.redact(line) + "\n"
+	if l.maxBytes > 0 && l.size > 0 && l.size+int64(len(entry)) > l.maxBytes {
+		if err := l.rotate(); err != nil {
+			l.fail(err)
+			return
+		}
+	}
+
+	n, err := l.w.WriteString(entry)
+	l.size += int64(n)
+	if err != nil {
+		l.fail(err)
+	}
+}
+
+// rotate moves the current file to <path>.1 and starts an empty one
+func (l *outputLog) rotate() error {
+	err := l.closeFile()
+	l.file = nil
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate output log: %w", err)
+	}
+	return l.open()
+}
+
+func (l *outputLog) fail(err error) {
+	l.failed = true
+	l.logger.Warn("output log disabled after write error", "path", l.path, "error", err)
+}
+
+func (l *outputLog) closeFile() error {
+	flushErr := l.w.Flush()
+	closeErr := l.file.Close()
+	if flushErr != nil {
+		return fmt.Errorf("failed to flush output log: %w", flushErr)
+	}
+	return closeErr
+}
+
+// Close flushes and closes the file
+func (l *outputLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.closeFile()
+	l.file = nil
+	return err
+}
@@ -0,0 +1,128 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// keepLine is a redactor that masks nothing
+func keepLine(line string) string { return line }
+
+func TestOpenOutputLog_InvalidJobID(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for _, id := range []string{"", ".", "..", "../escape", "a/b"} {
+		if _, err := openOutputLog(t.TempDir(), id, 0, keepLine, logger); err == nil {
+			t.Errorf("openOutputLog(%q) succeeded, want error", id)
+		}
+	}
+}
+
+func TestOpenOutputLog_NoRedactor(t *testing.T) {
+	dir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if _, err := openOutputLog(dir, "job-1", 0, nil, logger); err == nil {
+		t.Error("openOutputLog() without a redactor succeeded, want error")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "job-1.log")); !os.IsNotExist(err) {
+		t.Errorf("log file created without a redactor: %v", err)
+	}
+}
+
+func TestOutputLog_Rotate(t *testing.T) {
+	dir := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// Each entry is "stdout\tline-N\n" = 14 bytes, so 3 fit in 50
+	l, err := openOutputLog(dir, "job-1", 50, keepLine, logger)
+	if err != nil {
+		t.Fatalf("openOutputLog() error = %v", err)
+	}
+	for i := 1; i <= 5; i++ {
+		l.write("stdout", fmt.Sprintf("line-%d", i))
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	rotated, err := os.ReadFile(filepath.Join(dir, "job-1.log.1"))
+	if err != nil {
+		t.Fatalf("failed to read rotated log: %v", err)
+	}
+	current, err := os.ReadFile(filepath.Join(dir, "job-1.log"))
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+
+	if want := "stdout\tline-1\nstdout\tline-2\nstdout\tline-3\n"; string(rotated) != want {
+		t.Errorf("rotated log = %q, want %q", rotated, want)
+	}
+	if want := "stdout\tline-4\nstdout\tline-5\n"; string(current) != want {
+		t.Errorf("log = %q, want %q", current, want)
+	}
+}
+
+func TestOutputLog_NilDiscards(t *testing.T) {
+	var l *outputLog
+	l.write("stdout", "line")
+	if err := l.Close(); err != nil {
+		t.Errorf("Close() on nil log error = %v", err)
+	}
+}
+
+func TestClaudeAgent_OutputLogKeepsTruncatedLines(t *testing.T) {
+	tempDir := t.TempDir()
+	logDir := filepath.Join(tempDir, "logs")
+
+	// Fake CLI printing more lines than the output cap
+	script := filepath.Join(tempDir, "fake-cli.sh")
+	content := "#!/bin/sh\nfor i in 1 2 3 4 5 6 7 8 9 10; do echo \"raw $i\"; done\necho 'to stderr s3cretvalue' >&2\n"
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	a := NewClaudeAgent(&Config{Enabled: true, CLIPath: script, MaxOutputLines: 3, OutputLogDir: logDir}, logger)
+
+	var stored []string
+	_, err := a.Execute(context.Background(), ExecuteOptions{
+		WorkDir: tempDir,
+		Prompt:  "test",
+		JobID:   "job-42",
+		Redact:  func(line string) string { return strings.ReplaceAll(line, "s3cretvalue", "[REDACTED]") },
+		Output: func(stream string, source OutputSource, line string) {
+			if source == SourceClaude {
+				stored = append(stored, line)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	if len(stored) != 4 {
+		t.Errorf("stored %d agent lines, want 4 (3 stdout + 1 stderr): %v", len(stored), stored)
+	}
+
+	data, err := os.ReadFile(filepath.Join(logDir, "job-42.log"))
+	if err != nil {
+		t.Fatalf("failed to read output log: %v", err)
+	}
+	log := string(data)
+	for i := 1; i <= 10; i++ {
+		if want := fmt.Sprintf("stdout\traw %d\n", i); !strings.Contains(log, want) {
+			t.Errorf("output log missing %q", want)
+		}
+	}
+	if !strings.Contains(log, "stderr\tto stderr [REDACTED]\n") {
+		t.Error("output log missing the redacted stderr line")
+	}
+	if strings.Contains(log, "s3cretvalue") {
+		t.Error("output log contains the secret")
+	}
+}
@@ -0,0 +1,50 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrPromptTooLong is returned when a prompt exceeds the configured maximum length
+var ErrPromptTooLong = errors.New("prompt too long")
+
+// promptArgLimit is the largest prompt passed as a CLI argument. Linux caps a
+// single argument at 128 KiB (MAX_ARG_STRLEN); larger prompts go via stdin.
+const promptArgLimit = 64 * 1024
+
+// SanitizePrompt removes control characters that would corrupt the output
+// (ANSI escapes, NULs, carriage returns). Newlines and tabs are kept and
+// invalid UTF-8 is dropped.
+func SanitizePrompt(prompt string) string {
+	prompt = strings.ToValidUTF8(prompt, "")
+	prompt = strings.ReplaceAll(prompt, "\r\n", "\n")
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return r
+		}
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, prompt)
+}
+
+// CheckPromptLength fails when the prompt has more than maxLen characters.
+// A maxLen of 0 disables the check.
+func CheckPromptLength(prompt string, maxLen int) error {
+	if maxLen <= 0 {
+		return nil
+	}
+	if n := utf8.RuneCountInString(prompt); n > maxLen {
+		return fmt.Errorf("%w: %d characters, the limit is %d", ErrPromptTooLong, n, maxLen)
+	}
+	return nil
+}
+
+// promptViaStdin reports whether the prompt is too large to pass as an argument
+func promptViaStdin(prompt string) bool {
+	return len(prompt) > promptArgLimit
+}
@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSanitizePrompt(t *testing.T) {
+	tests := []struct {
+		name   string
+		prompt string
+		want   string
+	}{
+		{"plain", "Add a README", "Add a README"},
+		{"newlines and tabs kept", "line one\n\tline two", "line one\n\tline two"},
+		{"CRLF normalized", "one\r\ntwo\r", "one\ntwo"},
+		{"ANSI escape dropped", "\x1b[31mred\x1b[0m", "[31mred[0m"},
+		{"NUL and bell dropped", "a\x00b\x07c", "abc"},
+		{"C1 control dropped", "a\u0085b", "ab"},
+		{"invalid UTF-8 dropped", "ok\xffok", "okok"},
+		{"unicode kept", "Přidej README 📄", "Přidej README 📄"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizePrompt(tt.prompt); got != tt.want {
+				t.Errorf("SanitizePrompt(%q) = %q, want %q", tt.prompt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckPromptLength(t *testing.T) {
+	tests := []struct {
+		name    string
+		prompt  string
+		maxLen  int
+		wantErr bool
+	}{
+		{"under limit", "hello", 10, false},
+		{"at limit", "hello", 5, false},
+		{"over limit", "hello!", 5, true},
+		{"counts characters not bytes", "žluťoučký", 9, false},
+		{"unlimited", strings.Repeat("x", 1_000_000), 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckPromptLength(tt.prompt, tt.maxLen)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckPromptLength() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrPromptTooLong) {
+				t.Errorf("CheckPromptLength() error = %v, want ErrPromptTooLong", err)
+			}
+		})
+	}
+}
+
+func TestPromptViaStdin(t *testing.T) {
+	if promptViaStdin(strings.Repeat("x", promptArgLimit)) {
+		t.Error("promptViaStdin() = true at the limit, want argument")
+	}
+	if !promptViaStdin(strings.Repeat("x", promptArgLimit+1)) {
+		t.Error("promptViaStdin() = false over the limit, want stdin")
+	}
+}
+
+func TestClaudeAgent_LargePromptViaStdin(t *testing.T) {
+	tempDir := t.TempDir()
+	argsFile := filepath.Join(tempDir, "args.txt")
+	stdinFile := filepath.Join(tempDir, "stdin.txt")
+
+	// Fake CLI that records its arguments and stdin
+	script := filepath.Join(tempDir, "fake-cli.sh")
+	content := "#!/bin/sh\necho \"$#\" > " + argsFile + "\ncat > " + stdinFile + "\n"
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatalf("failed to write script: %v", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	a := NewClaudeAgent(&Config{Enabled: true, CLIPath: script, MaxOutputLines: 100}, logger)
+
+	tests := []struct {
+		name      string
+		prompt    string
+		wantArgs  string
+		wantStdin string
+	}{
+		{"small prompt as argument", "Add a README", "6", ""},
+		{"large prompt via stdin", strings.Repeat("x", promptArgLimit+1), "4", strings.Repeat("x", promptArgLimit+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := a.Execute(context.Background(), ExecuteOptions{
+				WorkDir: tempDir,
+				Prompt:  tt.prompt,
+				Output:  func(stream string, source OutputSource, line string) {},
+			})
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+
+			args, _ := os.ReadFile(argsFile)
+			if got := strings.TrimSpace(string(args)); got != tt.wantArgs {
+				t.Errorf("argument count = %s, want %s", got, tt.wantArgs)
+			}
+			stdin, _ := os.ReadFile(stdinFile)
+			if string(stdin) != tt.wantStdin {
+				t.Errorf("stdin = %d bytes, want %d", len(stdin), len(tt.wantStdin))
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// stderrTailLines is how many trailing stderr lines an ExitError keeps
+const stderrTailLines = 50
+
+// ExitError is returned when the agent CLI exits with a non-zero code.
+// It keeps the end of the CLI's stderr so callers can tell transient failures from real ones.
+type ExitError struct {
+	Code   int
+	Stderr []string
+	Err    error
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("agent exited with code %d: %v", e.Code, e.Err)
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// transientSignatures are stderr fragments that indicate a network or API
+// hiccup rather than a real failure. Matched case-insensitively.
+var transientSignatures = []string{
+	"econnreset",
+	"econnrefused",
+	"etimedout",
+	"eai_again",
+	"enotfound",
+	"socket hang up",
+	"network error",
+	"connection error",
+	"fetch failed",
+	"overloaded_error",
+	"internal server error",
+	"502 bad gateway",
+	"503 service unavailable",
+	"504 gateway timeout",
+}
+
+// RetryPolicy decides whether a failed agent run is worth repeating
+type RetryPolicy struct {
+	// ExitCodes are CLI exit codes that are always retried
+	ExitCodes map[int]bool
+}
+
+// IsRetryable reports whether err is a CLI exit caused by a transient problem:
+// an exit code in the policy's set, or a known network/API error in stderr.
+// Timeouts, cancellations and aborted runs are never retried.
+func (p RetryPolicy) IsRetryable(err error) bool {
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	if p.ExitCodes[exitErr.Code] {
+		return true
+	}
+
+	for _, line := range exitErr.Stderr {
+		lower := strings.ToLower(line)
+		for _, sig := range transientSignatures {
+			if strings.Contains(lower, sig) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stderrTail collects the last stderrTailLines lines written to stderr
+type stderrTail struct {
+	lines []string
+}
+
+func (t *stderrTail) add(line string) {
+	t.lines = append(t.lines, line)
+	if len(t.lines) > stderrTailLines {
+		t.lines = t.lines[len(t.lines)-stderrTailLines:]
+	}
+}
@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRetryPolicy_IsRetryable(t *testing.T) {
+	policy := RetryPolicy{ExitCodes: map[int]bool{75: true}}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"connection reset", &ExitError{Code: 1, Stderr: []string{"Error: read ECONNRESET"}}, true},
+		{"socket hang up", &ExitError{Code: 1, Stderr: []string{"starting", "FetchError: socket hang up"}}, true},
+		{"api overloaded", &ExitError{Code: 1, Stderr: []string{`{"type":"error","error":{"type":"overloaded_error"}}`}}, true},
+		{"bad gateway", &ExitError{Code: 1, Stderr: []string{"API Error: 502 Bad Gateway"}}, true},
+		{"retriable exit code", &ExitError{Code: 75}, true},
+		{"wrapped exit error", fmt.Errorf("agent execution failed: %w", &ExitError{Code: 1, Stderr: []string{"ETIMEDOUT"}}), true},
+		{"real failure", &ExitError{Code: 1, Stderr: []string{"Error: Invalid API key"}}, false},
+		{"no stderr", &ExitError{Code: 1}, false},
+		{"timeout", ErrTimeout, false},
+		{"cancelled", ErrCancelled, false},
+		{"binary output", fmt.Errorf("agent execution aborted: %w", ErrBinaryOutput), false},
+		{"other error", errors.New("failed to start claude CLI: network error"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStderrTail(t *testing.T) {
+	var tail stderrTail
+	for i := 0; i < stderrTailLines+10; i++ {
+		tail.add(fmt.Sprintf("line %d", i))
+	}
+
+	if len(tail.lines) != stderrTailLines {
+		t.Fatalf("len = %d, want %d", len(tail.lines), stderrTailLines)
+	}
+	if tail.lines[0] != "line 10" {
+		t.Errorf("first kept line = %q, want %q", tail.lines[0], "line 10")
+	}
+}
@@ -0,0 +1,362 @@
+// Package branchgc deletes stale repobox branches from remotes once their
+// merge requests are merged or closed
+package branchgc
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/config"
+	"github.com/repobox/runner/internal/crypto"
+	"github.com/repobox/runner/internal/git"
+	"github.com/repobox/runner/internal/mergerequest"
+	rediskeys "github.com/repobox/runner/internal/redis"
+	"github.com/repobox/runner/internal/tokensource"
+)
+
+// BranchPrefix is the prefix of the branches jobs and sessions push
+const BranchPrefix = "repobox/"
+
+// scanCount is the SCAN batch size when collecting repositories
+const scanCount = 500
+
+// activeSessionStatuses are session states whose work branch may still be pushed
+var activeSessionStatuses = map[string]bool{
+	"initializing":      true,
+	"ready":             true,
+	"running":           true,
+	"awaiting_approval": true,
+}
+
+// Report summarizes one cleanup run
+type Report struct {
+	Repos    int // Repositories checked
+	Branches int // Branches with the prefix found
+	Deleted  int // Branches deleted, or that would be in a dry run
+	Kept     int // Branches kept
+	Errors   int // Repositories or branches that couldn't be checked
+}
+
+// provider is a repository host with a token that can reach the repository
+type provider struct {
+	Token   string
+	Type    mergerequest.ProviderType
+	BaseURL string
+}
+
+// repoTarget is a repository seen in a job or session, with the owners whose
+// providers may be used to reach it
+type repoTarget struct {
+	RepoURL string
+	Owners  []owner
+}
+
+// owner is a user's git provider
+type owner struct {
+	UserID     string
+	ProviderID string
+}
+
+// Cleaner finds and deletes stale remote branches
+type Cleaner struct {
+	rdb       redis.UniversalClient
+	decryptor *crypto.Decryptor
+	tokens    tokensource.Source
+	dryRun    bool
+	interval  time.Duration
+	logger    *slog.Logger
+
+	// Swappable for tests
+	listBranches func(ctx context.Context, repoURL, token string, source git.TokenSource) ([]string, error)
+	cleanerFor   func(mergerequest.ProviderType) mergerequest.BranchCleaner
+}
+
+// New creates a Cleaner from the BRANCH_GC_* settings
+func New(rdb redis.UniversalClient, cfg *config.Config, logger *slog.Logger) (*Cleaner, error) {
+	decryptor, err := crypto.NewDecryptor(cfg.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create decryptor: %w", err)
+	}
+	tokens, err := tokensource.New(rdb, cfg, decryptor)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cleaner{
+		rdb:       rdb,
+		decryptor: decryptor,
+		tokens:    tokens,
+		dryRun:    cfg.BranchGCDryRun,
+		interval:  cfg.BranchGCInterval,
+		logger:    logger.With("component", "branch-gc"),
+		listBranches: func(ctx context.Context, repoURL, token string, source git.TokenSource) ([]string, error) {
+			return git.NewWithOptions(git.Options{Token: token, TokenSource: source}).ListRemoteBranches(ctx, repoURL, BranchPrefix)
+		},
+		cleanerFor: mergerequest.GetBranchCleaner,
+	}, nil
+}
+
+// Start runs the cleanup every interval in a goroutine
+func (c *Cleaner) Start(ctx context.Context) {
+	if c.interval <= 0 {
+		c.logger.Debug("periodic branch cleanup disabled")
+		return
+	}
+
+	c.logger.Info("starting periodic branch cleanup", "interval", c.interval, "dry_run", c.dryRun)
+	go func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := c.Run(ctx); err != nil {
+					c.logger.Warn("branch cleanup failed", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// Run checks every repository seen in a job or session once. A branch is
+// deleted when all of its merge requests are merged or closed (see decide),
+// unless an active session still works on it. In a dry run nothing is deleted.
+func (c *Cleaner) Run(ctx context.Context) (Report, error) {
+	var report Report
+
+	targets, active, err := c.collect(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	for _, target := range targets {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		report.Repos++
+		c.cleanRepo(ctx, target, active, &report)
+	}
+
+	c.logger.Info("branch cleanup finished",
+		"dry_run", c.dryRun,
+		"repos", report.Repos,
+		"branches", report.Branches,
+		"deleted", report.Deleted,
+		"kept", report.Kept,
+		"errors", report.Errors,
+	)
+	return report, nil
+}
+
+// cleanRepo checks the prefixed branches of one repository
+func (c *Cleaner) cleanRepo(ctx context.Context, target repoTarget, active map[string]bool, report *Report) {
+	logger := c.logger.With("repo", target.RepoURL)
+
+	prov, source, err := c.resolveProvider(ctx, target.Owners)
+	if err != nil {
+		logger.Warn("no usable provider for repository", "error", err)
+		report.Errors++
+		return
+	}
+	cleaner := c.cleanerFor(prov.Type)
+	if cleaner == nil {
+		logger.Debug("branch cleanup not supported for provider", "type", prov.Type)
+		return
+	}
+	projectID, err := mergerequest.ExtractProjectID(target.RepoURL)
+	if err != nil {
+		logger.Warn("failed to extract project ID", "error", err)
+		report.Errors++
+		return
+	}
+
+	branches, err := c.listBranches(ctx, target.RepoURL, prov.Token, source)
+	if err != nil {
+		logger.Warn("failed to list remote branches", "error", err)
+		report.Errors++
+		return
+	}
+
+	for _, branch := range branches {
+		report.Branches++
+		params := mergerequest.BranchParams{Token: prov.Token, BaseURL: prov.BaseURL, ProjectID: projectID, Branch: branch}
+
+		if active[activeKey(target.RepoURL, branch)] {
+			logger.Debug("keeping branch", "branch", branch, "reason", "active session")
+			report.Kept++
+			continue
+		}
+
+		states, err := cleaner.BranchMergeRequests(ctx, params)
+		if err != nil {
+			logger.Warn("failed to look up merge requests", "branch", branch, "error", err)
+			report.Errors++
+			continue
+		}
+
+		remove, reason := decide(states)
+		if !remove {
+			logger.Debug("keeping branch", "branch", branch, "reason", reason)
+			report.Kept++
+			continue
+		}
+
+		if c.dryRun {
+			logger.Info("would delete branch (dry run)", "branch", branch, "reason", reason)
+			report.Deleted++
+			continue
+		}
+		if err := cleaner.DeleteBranch(ctx, params); err != nil {
+			logger.Warn("failed to delete branch", "branch", branch, "error", err)
+			report.Errors++
+			continue
+		}
+		logger.Info("deleted branch", "branch", branch, "reason", reason)
+		report.Deleted++
+	}
+}
+
+// decide reports whether a branch with merge requests in the given states can
+// be deleted, and why. Branches without any merge request are kept: job
+// branches are pushed for the user to open one.
+func decide(states []mergerequest.MRState) (bool, string) {
+	if len(states) == 0 {
+		return false, "no merge request"
+	}
+
+	merged := false
+	for _, s := range states {
+		switch s {
+		case mergerequest.MRStateMerged:
+			merged = true
+		case mergerequest.MRStateClosed:
+		default:
+			return false, "merge request open"
+		}
+	}
+	if merged {
+		return true, "merge request merged"
+	}
+	return true, "merge request closed"
+}
+
+// collect scans job and session hashes for the repositories to check, sorted
+// by URL, and the work branches of active sessions, keyed by activeKey
+func (c *Cleaner) collect(ctx context.Context) ([]repoTarget, map[string]bool, error) {
+	byRepo := make(map[string]*repoTarget)
+	active := make(map[string]bool)
+
+	for _, pattern := range []string{rediskeys.JobKey("*"), rediskeys.WorkSessionKey("*")} {
+		iter := c.rdb.Scan(ctx, 0, pattern, scanCount).Iterator()
+		for iter.Next(ctx) {
+			key := iter.Val()
+			// Skip sub-keys such as job:{id}:output
+			if strings.Count(strings.TrimPrefix(key, rediskeys.KeyPrefix()), ":") != 1 {
+				continue
+			}
+
+			vals, err := c.rdb.HMGet(ctx, key, "repo_url", "user_id", "provider_id", "status", "work_branch").Result()
+			if err != nil {
+				c.logger.Debug("failed to read hash", "key", key, "error", err)
+				continue
+			}
+			field := func(i int) string {
+				s, _ := vals[i].(string)
+				return s
+			}
+			repoURL, userID, providerID := field(0), field(1), field(2)
+			if repoURL == "" || userID == "" || providerID == "" {
+				continue
+			}
+
+			if strings.HasPrefix(key, rediskeys.WorkSessionKey("")) && activeSessionStatuses[field(3)] && field(4) != "" {
+				active[activeKey(repoURL, field(4))] = true
+			}
+
+			id := git.NormalizeRepoURL(repoURL)
+			t, ok := byRepo[id]
+			if !ok {
+				t = &repoTarget{RepoURL: repoURL}
+				byRepo[id] = t
+			}
+			o := owner{UserID: userID, ProviderID: providerID}
+			if !containsOwner(t.Owners, o) {
+				t.Owners = append(t.Owners, o)
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan %s: %w", pattern, err)
+		}
+	}
+
+	targets := make([]repoTarget, 0, len(byRepo))
+	for _, t := range byRepo {
+		targets = append(targets, *t)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return git.NormalizeRepoURL(targets[i].RepoURL) < git.NormalizeRepoURL(targets[j].RepoURL)
+	})
+	return targets, active, nil
+}
+
+// activeKey identifies a branch of a repository
+func activeKey(repoURL, branch string) string {
+	return git.NormalizeRepoURL(repoURL) + "|" + branch
+}
+
+func containsOwner(owners []owner, o owner) bool {
+	for _, existing := range owners {
+		if existing == o {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveProvider returns the first owner's provider that still exists and
+// decrypts, with its token source for GitHub App providers
+func (c *Cleaner) resolveProvider(ctx context.Context, owners []owner) (*provider, git.TokenSource, error) {
+	var lastErr error
+	for _, o := range owners {
+		data, err := c.rdb.HGetAll(ctx, rediskeys.GitProviderKey(o.UserID, o.ProviderID)).Result()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(data) == 0 {
+			lastErr = fmt.Errorf("provider not found: %s", o.ProviderID)
+			continue
+		}
+		prov := &provider{Type: mergerequest.ProviderType(data["type"]), BaseURL: data["url"]}
+
+		if data["auth_type"] == mergerequest.AuthTypeGitHubApp {
+			source, err := mergerequest.GitHubAppFromProvider(data, c.decryptor.Decrypt)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if prov.Token, err = source.Token(ctx); err != nil {
+				lastErr = err
+				continue
+			}
+			return prov, source, nil
+		}
+
+		if prov.Token, err = c.tokens.Get(ctx, o.UserID, o.ProviderID); err != nil {
+			lastErr = err
+			continue
+		}
+		return prov, nil, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no provider")
+	}
+	return nil, nil, lastErr
+}
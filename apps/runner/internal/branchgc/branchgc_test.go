@@ -0,0 +1,181 @@
+package branchgc
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/config"
+	"github.com/repobox/runner/internal/git"
+	"github.com/repobox/runner/internal/mergerequest"
+	rediskeys "github.com/repobox/runner/internal/redis"
+)
+
+const testKeyHex = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+// encryptToken encrypts a token the way the web app stores it (iv:authTag:ciphertext)
+func encryptToken(t *testing.T, plaintext string) string {
+	t.Helper()
+	key, _ := hex.DecodeString(testKeyHex)
+
+	iv := make([]byte, 12)
+	if _, err := rand.Read(iv); err != nil {
+		t.Fatalf("rand.Read() error = %v", err)
+	}
+	block, _ := aes.NewCipher(key)
+	gcm, _ := cipher.NewGCMWithNonceSize(block, len(iv))
+	sealed := gcm.Seal(nil, iv, []byte(plaintext), nil)
+	tag, ciphertext := sealed[len(sealed)-16:], sealed[:len(sealed)-16]
+
+	return base64.StdEncoding.EncodeToString(iv) + ":" +
+		base64.StdEncoding.EncodeToString(tag) + ":" +
+		base64.StdEncoding.EncodeToString(ciphertext)
+}
+
+func TestDecide(t *testing.T) {
+	const (
+		open   = mergerequest.MRStateOpen
+		merged = mergerequest.MRStateMerged
+		closed = mergerequest.MRStateClosed
+	)
+	tests := []struct {
+		name       string
+		states     []mergerequest.MRState
+		wantDelete bool
+		wantReason string
+	}{
+		{"no merge request", nil, false, "no merge request"},
+		{"open", []mergerequest.MRState{open}, false, "merge request open"},
+		{"merged", []mergerequest.MRState{merged}, true, "merge request merged"},
+		{"closed", []mergerequest.MRState{closed}, true, "merge request closed"},
+		{"closed then merged", []mergerequest.MRState{closed, merged}, true, "merge request merged"},
+		{"closed then reopened as new", []mergerequest.MRState{closed, open}, false, "merge request open"},
+		{"merged and open", []mergerequest.MRState{merged, open}, false, "merge request open"},
+		{"unknown state", []mergerequest.MRState{"draft"}, false, "merge request open"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotDelete, gotReason := decide(tt.states)
+			if gotDelete != tt.wantDelete || gotReason != tt.wantReason {
+				t.Errorf("decide(%v) = %v, %q, want %v, %q", tt.states, gotDelete, gotReason, tt.wantDelete, tt.wantReason)
+			}
+		})
+	}
+}
+
+// fakeBranchCleaner answers with fixed MR states per branch and records deletions
+type fakeBranchCleaner struct {
+	states  map[string][]mergerequest.MRState
+	deleted []string
+}
+
+func (f *fakeBranchCleaner) BranchMergeRequests(ctx context.Context, params mergerequest.BranchParams) ([]mergerequest.MRState, error) {
+	return f.states[params.Branch], nil
+}
+
+func (f *fakeBranchCleaner) DeleteBranch(ctx context.Context, params mergerequest.BranchParams) error {
+	f.deleted = append(f.deleted, params.ProjectID+":"+params.Branch)
+	return nil
+}
+
+func newTestCleaner(t *testing.T, dryRun bool) (*Cleaner, *redis.Client, *fakeBranchCleaner) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	cfg := &config.Config{EncryptionKey: testKeyHex, BranchGCDryRun: dryRun}
+	c, err := New(rdb, cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	fake := &fakeBranchCleaner{states: map[string][]mergerequest.MRState{
+		"repobox/merged":  {mergerequest.MRStateMerged},
+		"repobox/closed":  {mergerequest.MRStateClosed},
+		"repobox/open":    {mergerequest.MRStateOpen},
+		"repobox/session": {mergerequest.MRStateClosed},
+	}}
+	c.cleanerFor = func(mergerequest.ProviderType) mergerequest.BranchCleaner { return fake }
+	c.listBranches = func(ctx context.Context, repoURL, token string, source git.TokenSource) ([]string, error) {
+		if token != "ghp_secret" {
+			t.Errorf("listBranches() token = %q, want the decrypted provider token", token)
+		}
+		return []string{"repobox/closed", "repobox/merged", "repobox/nomr", "repobox/open", "repobox/session"}, nil
+	}
+
+	ctx := context.Background()
+	rdb.HSet(ctx, rediskeys.GitProviderKey("user-1", "prov-1"), map[string]interface{}{
+		"type":  "github",
+		"url":   "https://github.com",
+		"token": encryptToken(t, "ghp_secret"),
+	})
+	rdb.HSet(ctx, rediskeys.JobKey("job-1"), map[string]interface{}{
+		"repo_url": "https://github.com/acme/app.git", "user_id": "user-1", "provider_id": "prov-1",
+	})
+	// Output lists share the prefix and must be skipped
+	rdb.RPush(ctx, rediskeys.JobOutputKey("job-1"), "line")
+	// An active session still works on its branch, even though its MR was closed
+	rdb.HSet(ctx, rediskeys.WorkSessionKey("sess-1"), map[string]interface{}{
+		"repo_url": "https://github.com/acme/app", "user_id": "user-1", "provider_id": "prov-1",
+		"status": "ready", "work_branch": "repobox/session",
+	})
+	return c, rdb, fake
+}
+
+func TestRun(t *testing.T) {
+	c, _, fake := newTestCleaner(t, false)
+
+	report, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	sort.Strings(fake.deleted)
+	if want := []string{"acme/app:repobox/closed", "acme/app:repobox/merged"}; !reflect.DeepEqual(fake.deleted, want) {
+		t.Errorf("deleted = %v, want %v", fake.deleted, want)
+	}
+	want := Report{Repos: 1, Branches: 5, Deleted: 2, Kept: 3}
+	if report != want {
+		t.Errorf("Run() report = %+v, want %+v", report, want)
+	}
+}
+
+func TestRun_DryRun(t *testing.T) {
+	c, _, fake := newTestCleaner(t, true)
+
+	report, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(fake.deleted) != 0 {
+		t.Errorf("deleted = %v in a dry run, want none", fake.deleted)
+	}
+	if report.Deleted != 2 {
+		t.Errorf("report.Deleted = %d, want 2 branches reported as deletable", report.Deleted)
+	}
+}
+
+func TestRun_ProviderMissing(t *testing.T) {
+	c, rdb, fake := newTestCleaner(t, false)
+	rdb.Del(context.Background(), rediskeys.GitProviderKey("user-1", "prov-1"))
+
+	report, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if report.Errors != 1 || len(fake.deleted) != 0 {
+		t.Errorf("Run() report = %+v, deleted %v, want one error and nothing deleted", report, fake.deleted)
+	}
+}
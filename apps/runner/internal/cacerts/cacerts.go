@@ -0,0 +1,101 @@
+// Package cacerts trusts operator CA certificates (EXTRA_CA_CERTS) next to the
+// system roots, in the runner's HTTPS clients and in git, for self-hosted
+// providers behind an internal CA.
+package cacerts
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// BundleFileName is the bundle of system roots and extra certificates Configure writes for git
+const BundleFileName = "ca-bundle.pem"
+
+// GitEnv is the variable git reads http.sslCAInfo from. A CA file replaces
+// git's default bundle, so it gets the system roots too.
+const GitEnv = "GIT_SSL_CAINFO"
+
+// systemBundles are the usual system CA bundle locations, in the order Go searches them on Linux
+var systemBundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",
+	"/etc/pki/tls/certs/ca-bundle.crt",
+	"/etc/ssl/ca-bundle.pem",
+	"/etc/pki/tls/cacert.pem",
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem",
+	"/etc/ssl/cert.pem",
+}
+
+// tlsConfig is what TLSConfig hands out, nil for the system defaults
+var tlsConfig atomic.Pointer[tls.Config]
+
+// Configure trusts the PEM certificates in path in addition to the system
+// roots: in the TLS config TLSConfig returns and, through GIT_SSL_CAINFO, in
+// git subprocesses, pointed at a combined bundle written to dir. An empty path
+// restores the defaults for HTTPS clients. Call it once at startup, before any
+// client is created.
+func Configure(path, dir string) error {
+	if path == "" {
+		tlsConfig.Store(nil)
+		return nil
+	}
+
+	extra, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read CA certificates: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(extra) {
+		return fmt.Errorf("no PEM certificates found in %s", path)
+	}
+
+	bundle := systemBundle()
+	if len(bundle) > 0 && bundle[len(bundle)-1] != '\n' {
+		bundle = append(bundle, '\n')
+	}
+	bundle = append(bundle, extra...)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create CA bundle dir: %w", err)
+	}
+	bundlePath := filepath.Join(dir, BundleFileName)
+	if err := os.WriteFile(bundlePath, bundle, 0644); err != nil {
+		return fmt.Errorf("failed to write CA bundle: %w", err)
+	}
+	if err := os.Setenv(GitEnv, bundlePath); err != nil {
+		return err
+	}
+
+	tlsConfig.Store(&tls.Config{RootCAs: pool})
+	return nil
+}
+
+// TLSConfig returns the TLS client config for HTTPS transports, nil (the
+// system defaults) unless Configure was given certificates
+func TLSConfig() *tls.Config {
+	cfg := tlsConfig.Load()
+	if cfg == nil {
+		return nil
+	}
+	return cfg.Clone()
+}
+
+// systemBundle reads the system CA bundle, honoring SSL_CERT_FILE like Go
+// does. Returns nil when there is none.
+func systemBundle() []byte {
+	paths := systemBundles
+	if file := os.Getenv("SSL_CERT_FILE"); file != "" {
+		paths = []string{file}
+	}
+	for _, path := range paths {
+		if data, err := os.ReadFile(path); err == nil {
+			return data
+		}
+	}
+	return nil
+}
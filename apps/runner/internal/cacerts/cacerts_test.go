@@ -0,0 +1,128 @@
+package cacerts
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes the server's certificate as a PEM file
+func writeCert(t *testing.T, srv *httptest.Server, path string) []byte {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+	return data
+}
+
+// newCA returns a self-signed CA certificate as PEM
+func newCA(t *testing.T) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "System Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestConfigure(t *testing.T) {
+	internal := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer internal.Close()
+
+	dir := t.TempDir()
+	// An unrelated CA stands in for the system bundle, without a trailing newline
+	system := newCA(t)
+	system = system[:len(system)-1]
+	if err := os.WriteFile(filepath.Join(dir, "system.pem"), system, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SSL_CERT_FILE", filepath.Join(dir, "system.pem"))
+	t.Setenv(GitEnv, "")
+	extra := writeCert(t, internal, filepath.Join(dir, "internal-ca.pem"))
+	t.Cleanup(func() { Configure("", "") })
+
+	get := func() error {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: TLSConfig()}}
+		resp, err := client.Get(internal.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	if err := get(); err == nil {
+		t.Fatal("request before Configure: error = nil, want an unknown authority")
+	}
+
+	bundleDir := filepath.Join(dir, "tmp")
+	if err := Configure(filepath.Join(dir, "internal-ca.pem"), bundleDir); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+	if err := get(); err != nil {
+		t.Errorf("request after Configure: error = %v", err)
+	}
+
+	// git gets the system roots and the extra certificates
+	bundlePath := filepath.Join(bundleDir, BundleFileName)
+	if got := os.Getenv(GitEnv); got != bundlePath {
+		t.Errorf("%s = %q, want %q", GitEnv, got, bundlePath)
+	}
+	bundle, err := os.ReadFile(bundlePath)
+	if err != nil {
+		t.Fatalf("failed to read bundle: %v", err)
+	}
+	if want := string(system) + "\n" + string(extra); string(bundle) != want {
+		t.Errorf("bundle = %q, want %q", bundle, want)
+	}
+
+	// An empty path restores the defaults
+	if err := Configure("", ""); err != nil {
+		t.Fatalf("Configure(\"\") error = %v", err)
+	}
+	if cfg := TLSConfig(); cfg != nil {
+		t.Errorf("TLSConfig() after reset = %+v, want nil", cfg)
+	}
+}
+
+func TestConfigure_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(GitEnv, "")
+	t.Cleanup(func() { Configure("", "") })
+
+	garbage := filepath.Join(dir, "garbage.pem")
+	if err := os.WriteFile(garbage, []byte("not a certificate\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{garbage, filepath.Join(dir, "missing.pem")} {
+		if err := Configure(path, dir); err == nil {
+			t.Errorf("Configure(%q) error = nil", path)
+		}
+	}
+	if TLSConfig() != nil || os.Getenv(GitEnv) != "" {
+		t.Error("a failed Configure changed the defaults")
+	}
+}
@@ -20,17 +20,18 @@ type Config struct {
 	MaxAge         time.Duration // Max age of directories before cleanup
 	MaxDiskMB      int           // Max disk usage in MB (0 = unlimited)
 	SessionMaxAge  time.Duration // Max age for sessions (24h default)
+	OutputLogDir   string        // Agent output logs, removed after MaxAge like the work directories (empty = none)
 }
 
 // Cleaner handles temp directory cleanup
 type Cleaner struct {
 	cfg    Config
-	rdb    *redis.Client
+	rdb    redis.UniversalClient
 	logger *slog.Logger
 }
 
 // New creates a new Cleaner
-func New(cfg Config, rdb *redis.Client, logger *slog.Logger) *Cleaner {
+func New(cfg Config, rdb redis.UniversalClient, logger *slog.Logger) *Cleaner {
 	// Default session max age to 24 hours if not set
 	if cfg.SessionMaxAge == 0 {
 		cfg.SessionMaxAge = 24 * time.Hour
@@ -85,6 +86,9 @@ func (c *Cleaner) runPeriodic(ctx context.Context) {
 			if err := c.cleanOld(); err != nil {
 				c.logger.Warn("periodic cleanup failed", "error", err)
 			}
+			if err := c.cleanOldLogs(); err != nil {
+				c.logger.Warn("output log cleanup failed", "error", err)
+			}
 			// Clean old sessions
 			if err := c.cleanOldSessions(ctx); err != nil {
 				c.logger.Warn("session cleanup failed", "error", err)
@@ -165,6 +169,49 @@ func (c *Cleaner) cleanOld() error {
 	return nil
 }
 
+// cleanOldLogs removes agent output logs not written to for MaxAge, so they
+// don't outlive the work directories they were produced in
+func (c *Cleaner) cleanOldLogs() error {
+	if c.cfg.OutputLogDir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(c.cfg.OutputLogDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	cutoff := time.Now().Add(-c.cfg.MaxAge)
+	var removed int
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		if info.ModTime().Before(cutoff) {
+			path := filepath.Join(c.cfg.OutputLogDir, entry.Name())
+			if err := os.Remove(path); err != nil {
+				c.logger.Warn("failed to remove old output log", "path", path, "error", err)
+			} else {
+				removed++
+			}
+		}
+	}
+
+	if removed > 0 {
+		c.logger.Info("cleaned old output logs", "removed", removed)
+	}
+	return nil
+}
+
 // enforceMaxDisk removes oldest directories until disk usage is under limit
 func (c *Cleaner) enforceMaxDisk() error {
 	usage, err := c.getDiskUsageMB()
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -13,19 +14,57 @@ type Config struct {
 	RunnerID          string
 	RedisURL          string
 	TempDir           string
+	CloneCacheDir     string // Bare mirrors for faster clones, empty disables
+	CloneSubmodules   bool   // Check out submodules recursively on clone
 	CleanupAfterJob   bool
 	JobTimeout        time.Duration
+	JobMaxWorkdirMB   int               // Cancel a job whose workdir grows beyond this, 0 = unlimited
 	EncryptionKey     string
+
+	// Provider token source
+	TokenSource     string // redis (default) or vault
+	VaultAddr       string // Vault address for TOKEN_SOURCE=vault
+	VaultToken      string // Vault token with read access to the token paths
+	VaultNamespace  string // Optional Vault Enterprise namespace
+	VaultTokenPath  string // Secret path template with {user_id} and {provider_id}
+	VaultTokenField string // Secret field holding the token
+
 	MaxConcurrentJobs int
 	MaxJobsPerUser    int
+	MaxJobsPerRepo    int               // 0 = unlimited
+	ClaimMinIdle      time.Duration     // Idle time before a pending stream message is reclaimed
+	PriorityWeight    int               // High-priority reads per normal read, 0 = strict priority
+	StreamReadCount   int               // Messages fetched per stream read
+	RunnerLabels      map[string]string // Routing labels, e.g. gpu=false,region=eu
+	TopicEnvironments map[string]string // Repository topic -> environment, e.g. python=python,laravel=php
+	RepoNameFullPath  bool              // Derived repo names keep the owner/groups: group/sub/project instead of project
+
+	// Redis connection tuning, zero values keep the go-redis defaults
+	RedisMode           string        // standalone, sentinel or cluster
+	RedisSentinelMaster string        // Sentinel master name
+	RedisAddrs          []string      // Sentinel or cluster node addresses
+	RedisPoolSize       int           // Max connections in the pool
+	RedisDialTimeout    time.Duration // Timeout for establishing new connections
+	RedisTLSCAFile      string        // PEM CA bundle for rediss:// connections
+	RedisTLSSkipVerify  bool          // Skip server certificate verification
+	RedisKeyPrefix      string        // Namespace of every key, must match the web app's REDIS_KEY_PREFIX
 
 	// Logging
 	LogLevel  string // debug, info, warn, error
 	LogFormat string // json, text
 
 	// Git commit identity
-	GitAuthorName  string
-	GitAuthorEmail string
+	GitAuthorName        string
+	GitAuthorEmail       string
+	GitEmailFromProvider []string          // Provider types ("github", "gitlab") whose account email is used as author email
+	ForbidDefaultBranch  bool              // Reject jobs/sessions that would push to the repo's default branch
+	ProtectedBranches    []string          // Branch names/globs never pushed to directly, empty with AllowProtectedPush
+	AllowProtectedPush   bool              // Override: push to branches matching ProtectedBranches
+	BranchCollision      string            // When a job's branch already exists: "suffix", "reuse" or "force"
+
+	// Commit filter: files the agent added or changed that are left out of commits
+	CommitMaxFileMB    int      // Skip files larger than this, 0 = no limit
+	CommitDenyPatterns []string // Globs of skipped files, e.g. "*.exe", "dist/*"
 
 	// Cleanup configuration
 	CleanupOnStartup   bool          // Clean temp dir on startup
@@ -33,6 +72,11 @@ type Config struct {
 	CleanupMaxAge      time.Duration // Max age of temp files before cleanup
 	CleanupMaxDiskMB   int           // Max disk usage in MB (0 = unlimited)
 
+	// Stale remote branch cleanup
+	BranchGCEnabled  bool          // Delete remote repobox/* branches whose MRs are merged or closed
+	BranchGCDryRun   bool          // Only log what would be deleted
+	BranchGCInterval time.Duration // Periodic run interval (0 = only via "runner branch-gc")
+
 	// AI Agent configuration
 	AIEnabled        bool
 	AIProvider       string
@@ -40,44 +84,249 @@ type Config struct {
 	AIAPIKey         string
 	AITimeout        time.Duration
 	AIMaxOutputLines int
+	AIMaxLineLength  int           // Longer output lines keep their start and end around a marker, 0 = no limit
+	AIBinaryOutput   string        // abort, skip, allow
+	AIThinking       bool          // Stream the agent's thinking blocks (source "thinking")
+	AIToolResults    bool          // Store full tool_result payloads next to their summary lines
+	AIToolResultMax  int           // Longest stored tool_result in characters, 0 = no limit
+	AIHeartbeat      time.Duration // Heartbeat interval while the agent is quiet, 0 disables
+	AIIdleTimeout    time.Duration // Kill the agent after this long without output, 0 disables
+	AIResumeSession  bool          // Continue a work session's agent conversation on its next prompt (--resume)
+	AIMaxRetries     int           // Re-runs of a job's agent after a transient CLI failure
+	AIRetryExitCodes map[int]bool  // CLI exit codes that are always treated as transient
+	MaxPromptLength  int           // Longest accepted prompt in characters, 0 = unlimited
+	SessionMaxJobs   int           // Successful prompts a work session accepts before it must be pushed, 0 = unlimited
+
+	// Per-environment system instructions, JSON object of environment -> text
+	AIInstructionsFile string // File with the instructions object
+	AIInstructions     string // Inline instructions object, overrides file entries
+
+	// Extra agent CLI arguments
+	AIExtraArgs string // Whitespace-separated, added to every run
+	AIEnvArgs   string // JSON object of environment -> argument list
+
+	// Agent Bash tool command policy
+	BashCommandDeny  []string // Regexes of denied commands
+	BashDenyDefaults bool     // Also deny built-in destructive commands (rm -rf, force push, ...)
+	BashPolicyMode   string   // off, warn, block
+
+	// Agent network egress
+	AgentNetwork      string   // open, none (AI API only), restricted (AI API and AgentNetworkAllow); enforced with a network namespace
+	AgentNetworkAllow []string // Hosts reachable with restricted, e.g. "registry.npmjs.org", "*.github.com:443"
+	AgentAPIHosts     []string // AI API hosts reachable in every mode
+
+	// Tracing, disabled when the OTLP endpoint is empty
+	OTelEndpoint string
+
+	// HTTP listener for /version, disabled when empty
+	HTTPAddr string
+
+	// Output configuration
+	OutputIncludePrompt  bool     // Store the prompt as the first output entry for audit
+	OutputRedactPatterns []string // Extra regexes whose matches are masked in stored output
+	OutputRedactDefaults bool     // Mask built-in secret patterns (AWS keys, GitHub/GitLab tokens, JWTs)
+
+	OutputBatchSize     int           // Output lines written per Redis round-trip, 1 = unbatched
+	OutputBatchInterval time.Duration // Longest a line waits for its batch
+
+	OutputLogDir   string // Keep each job's raw agent output in <dir>/<job_id>.log, empty = off
+	OutputLogMaxMB int    // Rotate a job's output log at this size, 0 = no cap
+
+	// PEM file of CA certificates git and the provider API clients trust next to the system roots
+	ExtraCACerts string
+
+	// Merge request configuration
+	MRTemplatePath  string        // Optional text/template file for MR/PR descriptions
+	MRCreateTimeout time.Duration // Deadline for the MR/PR create API call
+	MRHTTPTimeout   time.Duration // Overall timeout of each provider API request, 0 = context only
+	MRAutoMerge     bool          // Enable auto-merge on created MRs/PRs once pipelines pass
+	MRReopenClosed  bool          // Reopen the branch's closed MR/PR on re-push instead of creating another
+	PushLockTTL     time.Duration // Max time a session push holds its lock
+	SquashOnPush    bool          // Squash a session's commits into one before pushing
+
+	// Session commit granularity: prompt commits after each successful prompt,
+	// push leaves changes uncommitted until the session is pushed
+	SessionCommitMode string
+
+	// Session stream workers: how many init, prompt and push messages of
+	// different sessions this runner handles at once
+	SessionInitWorkers int
+	SessionJobWorkers  int
+	SessionPushWorkers int
+
+	// SessionMaxDeliveries bounds how often a session message that failed
+	// transiently (clone, push, merge request, Redis trouble) is delivered
+	// before the failure is recorded
+	SessionMaxDeliveries int
+
+	// Push approval
+	ApprovalRequired bool          // Hold committed session pushes until approved
+	ApprovalTimeout  time.Duration // Cancel a push not approved within this time
 }
 
+// Load reads the configuration from the environment and, when REPOBOX_CONFIG
+// names one, a config file
 func Load() (*Config, error) {
+	return LoadFile(os.Getenv("REPOBOX_CONFIG"))
+}
+
+// LoadFile reads the configuration from the environment and the config file
+// at path, with environment variables taking precedence. An empty path reads
+// the environment only.
+func LoadFile(path string) (*Config, error) {
+	src := &source{read: make(map[string]bool)}
+	if path != "" {
+		file, err := readConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		src.file = file
+	}
+
 	cfg := &Config{
-		RunnerID:          getEnv("RUNNER_ID", "runner-1"),
-		RedisURL:          getEnv("REDIS_URL", "redis://localhost:6379"),
-		TempDir:           getEnv("TEMP_DIR", "/tmp/repobox"),
-		CleanupAfterJob:   getEnvBool("CLEANUP_AFTER_JOB", true),
-		JobTimeout:        time.Duration(getEnvInt("JOB_TIMEOUT", 3600)) * time.Second,
-		EncryptionKey:     getEnv("ENCRYPTION_KEY", ""),
-		MaxConcurrentJobs: getEnvInt("MAX_CONCURRENT_JOBS", 10),
-		MaxJobsPerUser:    getEnvInt("MAX_JOBS_PER_USER", 3),
+		RunnerID:          src.getEnv("RUNNER_ID", "runner-1"),
+		RedisURL:          src.getEnv("REDIS_URL", "redis://localhost:6379"),
+		TempDir:           src.getEnv("TEMP_DIR", "/tmp/repobox"),
+		CloneCacheDir:     src.getEnv("CLONE_CACHE_DIR", ""),
+		CloneSubmodules:   src.getEnvBool("CLONE_SUBMODULES", false),
+		CleanupAfterJob:   src.getEnvBool("CLEANUP_AFTER_JOB", true),
+		JobTimeout:        time.Duration(src.getEnvInt("JOB_TIMEOUT", 3600)) * time.Second,
+		JobMaxWorkdirMB:   src.getEnvInt("JOB_MAX_WORKDIR_MB", 0),
+		EncryptionKey:     src.getEnv("ENCRYPTION_KEY", ""),
+
+		// Provider token source
+		TokenSource:     strings.ToLower(src.getEnv("TOKEN_SOURCE", "redis")),
+		VaultAddr:       src.getEnv("VAULT_ADDR", ""),
+		VaultToken:      src.getEnv("VAULT_TOKEN", ""),
+		VaultNamespace:  src.getEnv("VAULT_NAMESPACE", ""),
+		VaultTokenPath:  src.getEnv("VAULT_TOKEN_PATH", "secret/data/repobox/{user_id}/{provider_id}"),
+		VaultTokenField: src.getEnv("VAULT_TOKEN_FIELD", "token"),
+
+		MaxConcurrentJobs: src.getEnvInt("MAX_CONCURRENT_JOBS", 10),
+		MaxJobsPerUser:    src.getEnvInt("MAX_JOBS_PER_USER", 3),
+		MaxJobsPerRepo:    src.getEnvInt("MAX_JOBS_PER_REPO", 0),
+		ClaimMinIdle:      time.Duration(src.getEnvInt("CLAIM_MIN_IDLE_SECONDS", 300)) * time.Second,
+		PriorityWeight:    src.getEnvInt("JOBS_HIGH_PRIORITY_WEIGHT", 3),
+		StreamReadCount:   src.getEnvInt("STREAM_READ_COUNT", 1),
+		RunnerLabels:      ParseLabels(src.getEnv("RUNNER_LABELS", "")),
+		TopicEnvironments: ParseLabels(strings.ToLower(src.getEnv("TOPIC_ENVIRONMENTS", ""))),
+		RepoNameFullPath:  src.getEnvBool("REPO_NAME_FULL_PATH", false),
+
+		// Redis connection tuning
+		RedisMode:           strings.ToLower(src.getEnv("REDIS_MODE", "standalone")),
+		RedisSentinelMaster: src.getEnv("REDIS_SENTINEL_MASTER", ""),
+		RedisAddrs:          ParseList(src.getEnv("REDIS_ADDRS", "")),
+		RedisPoolSize:       src.getEnvInt("REDIS_POOL_SIZE", 0),
+		RedisDialTimeout:    time.Duration(src.getEnvInt("REDIS_DIAL_TIMEOUT_SECONDS", 0)) * time.Second,
+		RedisTLSCAFile:      src.getEnv("REDIS_TLS_CA_FILE", ""),
+		RedisTLSSkipVerify:  src.getEnvBool("REDIS_TLS_SKIP_VERIFY", false),
+		RedisKeyPrefix:      src.getEnv("REDIS_KEY_PREFIX", ""),
 
 		// Logging
-		LogLevel:  getEnv("LOG_LEVEL", "info"),
-		LogFormat: getEnv("LOG_FORMAT", "json"),
+		LogLevel:  src.getEnv("LOG_LEVEL", "info"),
+		LogFormat: src.getEnv("LOG_FORMAT", "json"),
 
 		// Git commit identity
-		GitAuthorName:  getEnv("GIT_AUTHOR_NAME", "Repobox Bot"),
-		GitAuthorEmail: getEnv("GIT_AUTHOR_EMAIL", "bot@repobox.cloud"),
+		GitAuthorName:        src.getEnv("GIT_AUTHOR_NAME", "Repobox Bot"),
+		GitAuthorEmail:       src.getEnv("GIT_AUTHOR_EMAIL", "bot@repobox.cloud"),
+		GitEmailFromProvider: ParseList(strings.ToLower(src.getEnv("GIT_AUTHOR_EMAIL_FROM_PROVIDER", ""))),
+		ForbidDefaultBranch:  src.getEnvBool("FORBID_DEFAULT_BRANCH", false),
+		ProtectedBranches:    ParseList(src.getEnv("PROTECTED_BRANCHES", "main,master")),
+		AllowProtectedPush:   src.getEnvBool("ALLOW_PROTECTED_PUSH", false),
+		BranchCollision:      src.getEnv("BRANCH_COLLISION", "suffix"),
+
+		// Commit filter
+		CommitMaxFileMB:    src.getEnvInt("COMMIT_MAX_FILE_MB", 0),
+		CommitDenyPatterns: ParseList(src.getEnv("COMMIT_DENY_PATTERNS", "")),
 
 		// Cleanup configuration
-		CleanupOnStartup:   getEnvBool("CLEANUP_ON_STARTUP", true),
-		CleanupInterval:    time.Duration(getEnvInt("CLEANUP_INTERVAL_MINUTES", 30)) * time.Minute,
-		CleanupMaxAge:      time.Duration(getEnvInt("CLEANUP_MAX_AGE_MINUTES", 120)) * time.Minute,
-		CleanupMaxDiskMB:   getEnvInt("CLEANUP_MAX_DISK_MB", 0), // 0 = unlimited
+		CleanupOnStartup:   src.getEnvBool("CLEANUP_ON_STARTUP", true),
+		CleanupInterval:    time.Duration(src.getEnvInt("CLEANUP_INTERVAL_MINUTES", 30)) * time.Minute,
+		CleanupMaxAge:      time.Duration(src.getEnvInt("CLEANUP_MAX_AGE_MINUTES", 120)) * time.Minute,
+		CleanupMaxDiskMB:   src.getEnvInt("CLEANUP_MAX_DISK_MB", 0), // 0 = unlimited
+
+		// Stale remote branch cleanup
+		BranchGCEnabled:  src.getEnvBool("BRANCH_GC_ENABLED", false),
+		BranchGCDryRun:   src.getEnvBool("BRANCH_GC_DRY_RUN", true),
+		BranchGCInterval: time.Duration(src.getEnvInt("BRANCH_GC_INTERVAL_HOURS", 24)) * time.Hour,
 
 		// AI Agent configuration
-		AIEnabled:        getEnvBool("AI_ENABLED", true),
-		AIProvider:       getEnv("AI_PROVIDER", "claude"),
-		AICLIPath:        getEnv("AI_CLI_PATH", "claude"),
-		AIAPIKey:         getEnv("ANTHROPIC_API_KEY", ""),
-		AITimeout:        time.Duration(getEnvInt("AI_TIMEOUT", 1800)) * time.Second,
-		AIMaxOutputLines: getEnvInt("AI_MAX_OUTPUT_LINES", 10000),
+		AIEnabled:        src.getEnvBool("AI_ENABLED", true),
+		AIProvider:       src.getEnv("AI_PROVIDER", "claude"),
+		AICLIPath:        src.getEnv("AI_CLI_PATH", "claude"),
+		AIAPIKey:         src.getEnv("ANTHROPIC_API_KEY", ""),
+		AITimeout:        time.Duration(src.getEnvInt("AI_TIMEOUT", 1800)) * time.Second,
+		AIMaxOutputLines: src.getEnvInt("AI_MAX_OUTPUT_LINES", 10000),
+		AIMaxLineLength:  src.getEnvInt("AI_MAX_LINE_LENGTH", 10000),
+		AIBinaryOutput:   src.getEnv("AI_BINARY_OUTPUT", "abort"),
+		AIThinking:       src.getEnvBool("AI_THINKING_OUTPUT", true),
+		AIToolResults:    src.getEnvBool("AI_TOOL_RESULTS_FULL", false),
+		AIToolResultMax:  src.getEnvInt("AI_TOOL_RESULT_MAX_LENGTH", 100000),
+		AIHeartbeat:      time.Duration(src.getEnvInt("AI_HEARTBEAT_SECONDS", 30)) * time.Second,
+		AIIdleTimeout:    time.Duration(src.getEnvInt("AGENT_IDLE_TIMEOUT_SECONDS", 0)) * time.Second,
+		AIResumeSession:  src.getEnvBool("AI_RESUME_SESSION", true),
+		AIMaxRetries:     src.getEnvInt("AGENT_MAX_RETRIES", 0),
+		AIRetryExitCodes: ParseIntSet(src.getEnv("AGENT_RETRY_EXIT_CODES", "")),
+		MaxPromptLength:  src.getEnvInt("MAX_PROMPT_LENGTH", 100000),
+		SessionMaxJobs:   src.getEnvInt("SESSION_MAX_JOBS", 0),
+
+		AIInstructionsFile: src.getEnv("AI_INSTRUCTIONS_FILE", ""),
+		AIInstructions:     src.getEnv("AI_INSTRUCTIONS", ""),
+
+		AIExtraArgs: src.getEnv("AI_EXTRA_ARGS", ""),
+		AIEnvArgs:   src.getEnv("AI_ENV_ARGS", ""),
+
+		BashCommandDeny:  ParsePatterns(src.getEnv("BASH_COMMAND_DENY", "")),
+		BashDenyDefaults: src.getEnvBool("BASH_COMMAND_DENY_DEFAULTS", false),
+		BashPolicyMode:   strings.ToLower(src.getEnv("BASH_POLICY_MODE", "warn")),
+
+		// Agent network egress
+		AgentNetwork:      strings.ToLower(src.getEnv("AGENT_NETWORK", "open")),
+		AgentNetworkAllow: ParseList(src.getEnv("AGENT_NETWORK_ALLOW", "")),
+		AgentAPIHosts:     ParseList(src.getEnv("AGENT_API_HOSTS", "api.anthropic.com")),
+
+		OTelEndpoint: src.getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+
+		HTTPAddr: src.getEnv("HTTP_ADDR", ""),
+
+		// Output configuration
+		OutputIncludePrompt:  src.getEnvBool("OUTPUT_INCLUDE_PROMPT", false),
+		OutputRedactPatterns: ParsePatterns(src.getEnv("OUTPUT_REDACT_PATTERNS", "")),
+		OutputRedactDefaults: src.getEnvBool("OUTPUT_REDACT_DEFAULTS", true),
+
+		OutputBatchSize:     src.getEnvInt("OUTPUT_BATCH_SIZE", 50),
+		OutputBatchInterval: time.Duration(src.getEnvInt("OUTPUT_BATCH_INTERVAL_MS", 100)) * time.Millisecond,
+
+		OutputLogDir:   src.getEnv("OUTPUT_LOG_DIR", ""),
+		OutputLogMaxMB: src.getEnvInt("OUTPUT_LOG_MAX_MB", 100),
+
+		ExtraCACerts: src.getEnv("EXTRA_CA_CERTS", ""),
+
+		// Merge request configuration
+		MRTemplatePath:  src.getEnv("MR_TEMPLATE_PATH", ""),
+		MRCreateTimeout: time.Duration(src.getEnvInt("MR_CREATE_TIMEOUT_SECONDS", 20)) * time.Second,
+		MRHTTPTimeout:   time.Duration(src.getEnvInt("MR_HTTP_TIMEOUT_SECONDS", 30)) * time.Second,
+		MRAutoMerge:     src.getEnvBool("MR_AUTO_MERGE", false),
+		MRReopenClosed:  src.getEnvBool("MR_REOPEN_CLOSED", true),
+		PushLockTTL:     time.Duration(src.getEnvInt("PUSH_LOCK_TTL_SECONDS", 600)) * time.Second,
+		SquashOnPush:    src.getEnvBool("SESSION_SQUASH_ON_PUSH", false),
+
+		SessionCommitMode: src.getEnv("SESSION_COMMIT_MODE", "prompt"),
+
+		SessionInitWorkers: src.getEnvInt("SESSION_INIT_WORKERS", 1),
+		SessionJobWorkers:  src.getEnvInt("SESSION_JOB_WORKERS", 1),
+		SessionPushWorkers: src.getEnvInt("SESSION_PUSH_WORKERS", 1),
+
+		SessionMaxDeliveries: src.getEnvInt("SESSION_MAX_DELIVERIES", 3),
+
+		// Push approval
+		ApprovalRequired: src.getEnvBool("APPROVAL_REQUIRED", false),
+		ApprovalTimeout:  time.Duration(src.getEnvInt("APPROVAL_TIMEOUT", 86400)) * time.Second,
 	}
 
-	if cfg.EncryptionKey == "" {
-		return nil, fmt.Errorf("ENCRYPTION_KEY is required")
+	// A file key no setting reads is most likely a typo
+	if unknown := src.unknownKeys(); len(unknown) > 0 {
+		return nil, fmt.Errorf("config file %s: unknown keys: %s", path, strings.Join(unknown, ", "))
 	}
 
 	// AI API key is optional - mock mode will be used if not provided
@@ -85,18 +334,53 @@ func Load() (*Config, error) {
 		cfg.AIEnabled = false
 	}
 
+	// The override lifts the protected set for the pre-checks and Push alike
+	if cfg.AllowProtectedPush {
+		cfg.ProtectedBranches = nil
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
 	return cfg, nil
 }
 
-func getEnv(key, defaultValue string) string {
+// source resolves settings from the environment, falling back to the config file
+type source struct {
+	file map[string]string // Config file values by environment variable name
+	read map[string]bool   // Variables looked up, to spot unknown file keys
+}
+
+func (s *source) lookup(key string) string {
+	s.read[key] = true
 	if value := os.Getenv(key); value != "" {
 		return value
 	}
+	return s.file[key]
+}
+
+// unknownKeys returns the sorted file keys no setting looked up
+func (s *source) unknownKeys() []string {
+	var unknown []string
+	for key := range s.file {
+		if !s.read[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+func (s *source) getEnv(key, defaultValue string) string {
+	if value := s.lookup(key); value != "" {
+		return value
+	}
 	return defaultValue
 }
 
-func getEnvBool(key string, defaultValue bool) bool {
-	if value := os.Getenv(key); value != "" {
+func (s *source) getEnvBool(key string, defaultValue bool) bool {
+	if value := s.lookup(key); value != "" {
 		b, err := strconv.ParseBool(value)
 		if err != nil {
 			return defaultValue
@@ -106,8 +390,8 @@ func getEnvBool(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
-func getEnvInt(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
+func (s *source) getEnvInt(key string, defaultValue int) int {
+	if value := s.lookup(key); value != "" {
 		i, err := strconv.Atoi(value)
 		if err != nil {
 			return defaultValue
@@ -117,6 +401,74 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// ParseLabels parses "key=value,key2=value2" into a map.
+// A bare "key" is stored with an empty value and matches any value.
+func ParseLabels(s string) map[string]string {
+	labels := make(map[string]string)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(part, "=")
+		labels[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return labels
+}
+
+// ParseList parses "a,b,c" into a slice, ignoring empty entries
+func ParseList(s string) []string {
+	var items []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			items = append(items, part)
+		}
+	}
+	return items
+}
+
+// ParseIntSet parses "1,75,143" into a set, ignoring entries that are not integers
+func ParseIntSet(s string) map[int]bool {
+	set := make(map[int]bool)
+	for _, part := range strings.Split(s, ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+			set[n] = true
+		}
+	}
+	return set
+}
+
+// ParsePatterns splits a semicolon-separated list of regexes, ignoring empty entries.
+// Semicolons are used because commas commonly appear in regex quantifiers.
+func ParsePatterns(s string) []string {
+	var patterns []string
+	for _, p := range strings.Split(s, ";") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// FormatLabels converts labels back to the "key=value,..." form, sorted by key
+func FormatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if labels[k] == "" {
+			parts = append(parts, k)
+		} else {
+			parts = append(parts, k+"="+labels[k])
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
 // ParseLogLevel converts string log level to slog.Level
 func ParseLogLevel(level string) slog.Level {
 	switch strings.ToLower(level) {
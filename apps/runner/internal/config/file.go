@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/repobox/runner/internal/yamlsubset"
+)
+
+// readConfigFile parses a YAML config file (.yaml, .yml) of flat settings named
+// like the environment variables, case-insensitive: "MAX_CONCURRENT_JOBS: 5".
+// Values may be quoted; nested values and lists are not supported.
+func readConfigFile(path string) (map[string]string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported format, use .yaml or .yml", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	values, err := parseConfigFile(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// parseConfigFile parses "key: value" settings into values keyed by the
+// upper-cased key
+func parseConfigFile(s string) (map[string]string, error) {
+	parsed, err := yamlsubset.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(parsed))
+	for key, v := range parsed {
+		// "KEY:" without list items is an empty value
+		if v.IsList && len(v.List) == 0 {
+			v = yamlsubset.Value{}
+		}
+		value, err := v.String(key)
+		if err != nil {
+			return nil, fmt.Errorf("%w, lists are comma-separated strings", err)
+		}
+		upper := strings.ToUpper(key)
+		if _, dup := values[upper]; dup {
+			return nil, fmt.Errorf("duplicate key %s", upper)
+		}
+		values[upper] = value
+	}
+	return values, nil
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConfigFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			"flat settings",
+			"# runner settings\n---\nmax_concurrent_jobs: 5\nREDIS_URL: redis://cache:6379 # shared\nLOG_FORMAT: \"text\"\nbash_command_deny: 'rm -rf /;curl .*\\| sh'\n",
+			map[string]string{"MAX_CONCURRENT_JOBS": "5", "REDIS_URL": "redis://cache:6379", "LOG_FORMAT": "text", "BASH_COMMAND_DENY": `rm -rf /;curl .*\| sh`},
+			"",
+		},
+		{"empty value", "CLONE_CACHE_DIR:\n", map[string]string{"CLONE_CACHE_DIR": ""}, ""},
+		{"nested", "redis:\n  url: redis://x\n", nil, "line 2"},
+		{"block list", "PROTECTED_BRANCHES:\n- main\n", nil, "comma-separated"},
+		{"inline list", "PROTECTED_BRANCHES: [main, master]\n", nil, "comma-separated"},
+		{"missing separator", "MAX_CONCURRENT_JOBS 5\n", nil, "expected \"key: value\""},
+		{"duplicate", "LOG_LEVEL: info\nLOG_LEVEL: debug\n", nil, "duplicate key"},
+		{"duplicate in another case", "LOG_LEVEL: info\nlog_level: debug\n", nil, "duplicate key LOG_LEVEL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseConfigFile(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseConfigFile() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseConfigFile() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseConfigFile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// writeConfig writes a config file named name into a temp dir and returns its path
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadFile_Precedence(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	t.Setenv("ENCRYPTION_KEY", "")
+	t.Setenv("MAX_CONCURRENT_JOBS", "7")
+	t.Setenv("LOG_LEVEL", "")
+
+	for _, tt := range []struct{ name, content string }{
+		{"config.yaml", "ENCRYPTION_KEY: from-file\nmax_concurrent_jobs: 2\nlog_level: debug\njob_timeout: 120\nai_timeout: 60\ntemp_dir: " + tempDir + "\n"},
+		{"config.yml", "encryption_key: \"from-file\"\nMAX_CONCURRENT_JOBS: 2\nLOG_LEVEL: 'debug'\nJOB_TIMEOUT: 120\nAI_TIMEOUT: 60\nTEMP_DIR: \"" + tempDir + "\"\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadFile(writeConfig(t, tt.name, tt.content))
+			if err != nil {
+				t.Fatalf("LoadFile() error = %v", err)
+			}
+			if cfg.EncryptionKey != "from-file" {
+				t.Errorf("EncryptionKey = %q, want the file value", cfg.EncryptionKey)
+			}
+			if cfg.MaxConcurrentJobs != 7 {
+				t.Errorf("MaxConcurrentJobs = %d, want 7 from the environment", cfg.MaxConcurrentJobs)
+			}
+			if cfg.LogLevel != "debug" {
+				t.Errorf("LogLevel = %q, want debug from the file", cfg.LogLevel)
+			}
+			if cfg.JobTimeout != 2*time.Minute {
+				t.Errorf("JobTimeout = %s, want 2m from the file", cfg.JobTimeout)
+			}
+			if cfg.MaxJobsPerUser != 3 {
+				t.Errorf("MaxJobsPerUser = %d, want the default 3", cfg.MaxJobsPerUser)
+			}
+		})
+	}
+}
+
+func TestLoadFile_EnvOnly(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	t.Setenv("ENCRYPTION_KEY", "from-env")
+	t.Setenv("TEMP_DIR", t.TempDir())
+
+	cfg, err := LoadFile("")
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if cfg.EncryptionKey != "from-env" {
+		t.Errorf("EncryptionKey = %q, want from-env", cfg.EncryptionKey)
+	}
+}
+
+func TestLoadFile_Errors(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	t.Setenv("ENCRYPTION_KEY", "from-env")
+	t.Setenv("TEMP_DIR", t.TempDir())
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{"unknown keys", "config.yaml", "MAX_CONCURENT_JOBS: 5\nLOG_LEVEL: info\nredis_ulr: redis://x\n", "unknown keys: MAX_CONCURENT_JOBS, REDIS_ULR"},
+		{"unsupported format", "config.toml", "max_concurrent_jobs = 5\n", "unsupported format"},
+		{"parse error", "config.yaml", "runner:\n  max_concurrent_jobs: 5\n", "line 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadFile(writeConfig(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("LoadFile() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := LoadFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("LoadFile() of a missing file succeeded")
+	}
+}
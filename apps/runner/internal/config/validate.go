@@ -0,0 +1,220 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks the configuration as a whole and reports every problem at
+// once, so a misconfigured deployment can be fixed in one pass. Returns nil or
+// a *ValidationError.
+func (c *Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.EncryptionKey == "" {
+		add("ENCRYPTION_KEY is required")
+	}
+
+	switch c.TokenSource {
+	case "", "redis":
+	case "vault":
+		if c.VaultAddr == "" || c.VaultToken == "" {
+			add("TOKEN_SOURCE=vault requires VAULT_ADDR and VAULT_TOKEN")
+		}
+	default:
+		add("TOKEN_SOURCE must be redis or vault, got %q", c.TokenSource)
+	}
+
+	switch c.SessionCommitMode {
+	case "", "prompt", "push":
+	default:
+		add("SESSION_COMMIT_MODE must be prompt or push, got %q", c.SessionCommitMode)
+	}
+
+	switch c.BranchCollision {
+	case "", "suffix", "reuse", "force":
+	default:
+		add("BRANCH_COLLISION must be suffix, reuse or force, got %q", c.BranchCollision)
+	}
+
+	switch c.AgentNetwork {
+	case "", "open", "none", "restricted":
+	default:
+		add("AGENT_NETWORK must be open, none or restricted, got %q", c.AgentNetwork)
+	}
+	if c.AgentNetwork == "restricted" && len(c.AgentNetworkAllow) == 0 {
+		add("AGENT_NETWORK_ALLOW must not be empty with AGENT_NETWORK=restricted, use none to allow only the AI API")
+	}
+	if (c.AgentNetwork == "none" || c.AgentNetwork == "restricted") && len(c.AgentAPIHosts) == 0 {
+		add("AGENT_API_HOSTS must not be empty with AGENT_NETWORK=%s, the agent could not reach the AI API", c.AgentNetwork)
+	}
+
+	switch c.BashPolicyMode {
+	case "", "off", "warn", "block":
+	default:
+		add("BASH_POLICY_MODE must be off, warn or block, got %q", c.BashPolicyMode)
+	}
+
+	if c.MaxConcurrentJobs <= 0 {
+		add("MAX_CONCURRENT_JOBS must be greater than 0, got %d", c.MaxConcurrentJobs)
+	}
+	if c.MaxJobsPerUser <= 0 {
+		add("MAX_JOBS_PER_USER must be greater than 0, got %d", c.MaxJobsPerUser)
+	}
+	if c.MaxJobsPerRepo < 0 {
+		add("MAX_JOBS_PER_REPO must not be negative, got %d", c.MaxJobsPerRepo)
+	}
+	for _, w := range []struct {
+		name  string
+		value int
+	}{
+		{"SESSION_INIT_WORKERS", c.SessionInitWorkers},
+		{"SESSION_JOB_WORKERS", c.SessionJobWorkers},
+		{"SESSION_PUSH_WORKERS", c.SessionPushWorkers},
+		{"SESSION_MAX_DELIVERIES", c.SessionMaxDeliveries},
+	} {
+		if w.value <= 0 {
+			add("%s must be greater than 0, got %d", w.name, w.value)
+		}
+	}
+	if c.SessionMaxJobs < 0 {
+		add("SESSION_MAX_JOBS must not be negative, got %d", c.SessionMaxJobs)
+	}
+	if c.JobMaxWorkdirMB < 0 {
+		add("JOB_MAX_WORKDIR_MB must not be negative, got %d", c.JobMaxWorkdirMB)
+	}
+	if c.StreamReadCount <= 0 {
+		add("STREAM_READ_COUNT must be greater than 0, got %d", c.StreamReadCount)
+	}
+	if c.OutputBatchSize <= 0 {
+		add("OUTPUT_BATCH_SIZE must be greater than 0, got %d", c.OutputBatchSize)
+	}
+	if c.AIMaxLineLength < 0 {
+		add("AI_MAX_LINE_LENGTH must not be negative, got %d", c.AIMaxLineLength)
+	}
+	if c.AIToolResultMax < 0 {
+		add("AI_TOOL_RESULT_MAX_LENGTH must not be negative, got %d", c.AIToolResultMax)
+	}
+	if c.OutputLogMaxMB < 0 {
+		add("OUTPUT_LOG_MAX_MB must not be negative, got %d", c.OutputLogMaxMB)
+	}
+	if c.CommitMaxFileMB < 0 {
+		add("COMMIT_MAX_FILE_MB must not be negative, got %d", c.CommitMaxFileMB)
+	}
+	for _, pattern := range c.CommitDenyPatterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			add("COMMIT_DENY_PATTERNS has an invalid glob %q", pattern)
+		}
+	}
+
+	switch strings.ToLower(c.LogLevel) {
+	case "debug", "info", "warn", "warning", "error":
+	default:
+		add("LOG_LEVEL must be one of debug, info, warn, error, got %q", c.LogLevel)
+	}
+	switch c.LogFormat {
+	case "json", "text":
+	default:
+		add("LOG_FORMAT must be json or text, got %q", c.LogFormat)
+	}
+
+	// Timeouts that must be set
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"JOB_TIMEOUT", c.JobTimeout},
+		{"AI_TIMEOUT", c.AITimeout},
+		{"MR_CREATE_TIMEOUT_SECONDS", c.MRCreateTimeout},
+		{"PUSH_LOCK_TTL_SECONDS", c.PushLockTTL},
+	} {
+		if d.value <= 0 {
+			add("%s must be greater than 0, got %s", d.name, d.value)
+		}
+	}
+	// Timeouts where 0 disables
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"CLAIM_MIN_IDLE_SECONDS", c.ClaimMinIdle},
+		{"CLEANUP_INTERVAL_MINUTES", c.CleanupInterval},
+		{"AI_HEARTBEAT_SECONDS", c.AIHeartbeat},
+		{"AGENT_IDLE_TIMEOUT_SECONDS", c.AIIdleTimeout},
+		{"REDIS_DIAL_TIMEOUT_SECONDS", c.RedisDialTimeout},
+		{"BRANCH_GC_INTERVAL_HOURS", c.BranchGCInterval},
+		{"MR_HTTP_TIMEOUT_SECONDS", c.MRHTTPTimeout},
+	} {
+		if d.value < 0 {
+			add("%s must not be negative, got %s", d.name, d.value)
+		}
+	}
+	if c.JobTimeout > 0 && c.AITimeout > c.JobTimeout {
+		add("AI_TIMEOUT (%s) must not exceed JOB_TIMEOUT (%s)", c.AITimeout, c.JobTimeout)
+	}
+	if c.AIIdleTimeout > 0 && c.AITimeout > 0 && c.AIIdleTimeout >= c.AITimeout {
+		add("AGENT_IDLE_TIMEOUT_SECONDS (%s) must be shorter than AI_TIMEOUT (%s)", c.AIIdleTimeout, c.AITimeout)
+	}
+	if c.ApprovalRequired && c.ApprovalTimeout <= 0 {
+		add("APPROVAL_TIMEOUT must be greater than 0 when APPROVAL_REQUIRED is set, got %s", c.ApprovalTimeout)
+	}
+
+	if c.TempDir == "" {
+		add("TEMP_DIR is required")
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// PrepareDirs creates the directories the runner writes to and checks they
+// are writable. Load doesn't call it, so one-off commands such as branch-gc
+// work from any host; the runner calls it before taking work. Returns nil or
+// a *ValidationError.
+func (c *Config) PrepareDirs() error {
+	var problems []string
+	if err := checkWritableDir(c.TempDir); err != nil {
+		problems = append(problems, fmt.Sprintf("TEMP_DIR %q is not writable: %v", c.TempDir, err))
+	}
+	if c.OutputLogDir != "" {
+		if err := checkWritableDir(c.OutputLogDir); err != nil {
+			problems = append(problems, fmt.Sprintf("OUTPUT_LOG_DIR %q is not writable: %v", c.OutputLogDir, err))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// checkWritableDir creates dir if needed and writes a probe file into it
+func checkWritableDir(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".write-check-")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
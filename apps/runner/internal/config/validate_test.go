@@ -0,0 +1,223 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validConfig returns a configuration that passes Validate
+func validConfig(t *testing.T) *Config {
+	t.Helper()
+	return &Config{
+		TempDir:              t.TempDir(),
+		EncryptionKey:        "key",
+		MaxConcurrentJobs:    10,
+		MaxJobsPerUser:       3,
+		JobTimeout:           time.Hour,
+		ClaimMinIdle:         5 * time.Minute,
+		LogLevel:             "info",
+		LogFormat:            "json",
+		AITimeout:            30 * time.Minute,
+		OutputBatchSize:      50,
+		StreamReadCount:      1,
+		SessionInitWorkers:   1,
+		SessionJobWorkers:    1,
+		SessionPushWorkers:   1,
+		SessionMaxDeliveries: 3,
+		MRCreateTimeout:      20 * time.Second,
+		PushLockTTL:          10 * time.Minute,
+		AgentAPIHosts:        []string{"api.anthropic.com"},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	// A regular file where a directory is expected can't be written into
+	blocker := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   []string // Variables named in the reported problems, in order
+	}{
+		{"valid", func(c *Config) {}, nil},
+		{"valid with warning level and text logs", func(c *Config) { c.LogLevel = "WARNING"; c.LogFormat = "text" }, nil},
+		{"missing encryption key", func(c *Config) { c.EncryptionKey = "" }, []string{"ENCRYPTION_KEY"}},
+		{"unknown token source", func(c *Config) { c.TokenSource = "aws" }, []string{"TOKEN_SOURCE"}},
+		{"unknown session commit mode", func(c *Config) { c.SessionCommitMode = "never" }, []string{"SESSION_COMMIT_MODE"}},
+		{"unknown branch collision mode", func(c *Config) { c.BranchCollision = "rename" }, []string{"BRANCH_COLLISION"}},
+		{"no session push workers", func(c *Config) { c.SessionPushWorkers = 0 }, []string{"SESSION_PUSH_WORKERS"}},
+		{"no session deliveries", func(c *Config) { c.SessionMaxDeliveries = 0 }, []string{"SESSION_MAX_DELIVERIES"}},
+		{"negative line length", func(c *Config) { c.AIMaxLineLength = -1 }, []string{"AI_MAX_LINE_LENGTH"}},
+		{"negative tool result length", func(c *Config) { c.AIToolResultMax = -1 }, []string{"AI_TOOL_RESULT_MAX_LENGTH"}},
+		{"negative commit file limit", func(c *Config) { c.CommitMaxFileMB = -1 }, []string{"COMMIT_MAX_FILE_MB"}},
+		{"invalid commit deny glob", func(c *Config) { c.CommitDenyPatterns = []string{"*.exe", "dist/["} }, []string{`COMMIT_DENY_PATTERNS has an invalid glob "dist/["`}},
+		{"unknown bash policy mode", func(c *Config) { c.BashPolicyMode = "deny" }, []string{"BASH_POLICY_MODE"}},
+		{"bash policy off", func(c *Config) { c.BashPolicyMode = "off" }, nil},
+		{"unknown agent network mode", func(c *Config) { c.AgentNetwork = "offline" }, []string{"AGENT_NETWORK must be"}},
+		{"restricted network without allowlist", func(c *Config) { c.AgentNetwork = "restricted" }, []string{"AGENT_NETWORK_ALLOW"}},
+		{"restricted network", func(c *Config) {
+			c.AgentNetwork = "restricted"
+			c.AgentNetworkAllow = []string{"registry.npmjs.org"}
+		}, nil},
+		{"no network without API hosts", func(c *Config) {
+			c.AgentNetwork = "none"
+			c.AgentAPIHosts = nil
+		}, []string{"AGENT_API_HOSTS"}},
+		{"vault without address", func(c *Config) { c.TokenSource = "vault"; c.VaultToken = "s.token" }, []string{"TOKEN_SOURCE=vault requires VAULT_ADDR"}},
+		{
+			"vault configured",
+			func(c *Config) { c.TokenSource = "vault"; c.VaultAddr = "https://vault:8200"; c.VaultToken = "s.token" },
+			nil,
+		},
+		{
+			"limits",
+			func(c *Config) {
+				c.MaxConcurrentJobs = 0
+				c.MaxJobsPerUser = -1
+				c.MaxJobsPerRepo = -1
+				c.SessionMaxJobs = -1
+			},
+			[]string{"MAX_CONCURRENT_JOBS", "MAX_JOBS_PER_USER", "MAX_JOBS_PER_REPO", "SESSION_MAX_JOBS"},
+		},
+		{
+			"logging",
+			func(c *Config) { c.LogLevel = "verbose"; c.LogFormat = "xml" },
+			[]string{"LOG_LEVEL", "LOG_FORMAT"},
+		},
+		{
+			"timeouts",
+			func(c *Config) { c.JobTimeout = 0; c.AITimeout = 0; c.AIHeartbeat = -time.Second },
+			[]string{"JOB_TIMEOUT", "AI_TIMEOUT", "AI_HEARTBEAT_SECONDS"},
+		},
+		{
+			"agent timeout beyond job timeout",
+			func(c *Config) { c.AITimeout = 2 * time.Hour },
+			[]string{"AI_TIMEOUT (2h0m0s) must not exceed JOB_TIMEOUT"},
+		},
+		{
+			"idle timeout beyond agent timeout",
+			func(c *Config) { c.AIIdleTimeout = time.Hour },
+			[]string{"AGENT_IDLE_TIMEOUT_SECONDS"},
+		},
+		{
+			"approval without timeout",
+			func(c *Config) { c.ApprovalRequired = true },
+			[]string{"APPROVAL_TIMEOUT"},
+		},
+		{"temp dir unset", func(c *Config) { c.TempDir = "" }, []string{"TEMP_DIR"}},
+		{"temp dir not checked", func(c *Config) { c.TempDir = filepath.Join(blocker, "sub") }, nil},
+		{"negative output log size", func(c *Config) { c.OutputLogMaxMB = -1 }, []string{"OUTPUT_LOG_MAX_MB"}},
+		{"CA certificates not read", func(c *Config) { c.ExtraCACerts = filepath.Join(blocker, "ca.pem") }, nil},
+		{"agent CLI not resolved", func(c *Config) { c.AIEnabled = true; c.AICLIPath = "repobox-no-such-cli" }, nil},
+		{
+			"everything at once",
+			func(c *Config) {
+				c.EncryptionKey = ""
+				c.MaxConcurrentJobs = 0
+				c.LogFormat = "yaml"
+				c.JobTimeout = 0
+				c.TempDir = ""
+			},
+			[]string{"ENCRYPTION_KEY", "MAX_CONCURRENT_JOBS", "LOG_FORMAT", "JOB_TIMEOUT", "TEMP_DIR"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig(t)
+			tt.modify(cfg)
+
+			err := cfg.Validate()
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Validate() error = %v, want *ValidationError", err)
+			}
+			if len(verr.Problems) != len(tt.want) {
+				t.Fatalf("Validate() problems = %q, want %d matching %q", verr.Problems, len(tt.want), tt.want)
+			}
+			for i, want := range tt.want {
+				if !strings.HasPrefix(verr.Problems[i], want) {
+					t.Errorf("problem %d = %q, want prefix %q", i, verr.Problems[i], want)
+				}
+				if !strings.Contains(err.Error(), verr.Problems[i]) {
+					t.Errorf("Error() = %q, missing problem %q", err.Error(), verr.Problems[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPrepareDirs(t *testing.T) {
+	// A regular file where a directory is expected can't be written into
+	blocker := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   []string
+	}{
+		{"writable", func(c *Config) {}, nil},
+		{"created", func(c *Config) {
+			c.TempDir = filepath.Join(c.TempDir, "a", "b")
+			c.OutputLogDir = filepath.Join(c.TempDir, "logs")
+		}, nil},
+		{"temp dir not writable", func(c *Config) { c.TempDir = filepath.Join(blocker, "sub") }, []string{"TEMP_DIR"}},
+		{"output log dir not writable", func(c *Config) { c.OutputLogDir = filepath.Join(blocker, "logs") }, []string{"OUTPUT_LOG_DIR"}},
+		{
+			"both",
+			func(c *Config) {
+				c.TempDir = filepath.Join(blocker, "sub")
+				c.OutputLogDir = filepath.Join(blocker, "logs")
+			},
+			[]string{"TEMP_DIR", "OUTPUT_LOG_DIR"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig(t)
+			tt.modify(cfg)
+
+			err := cfg.PrepareDirs()
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("PrepareDirs() error = %v, want nil", err)
+				}
+				if _, err := os.Stat(cfg.TempDir); err != nil {
+					t.Errorf("TEMP_DIR not created: %v", err)
+				}
+				return
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("PrepareDirs() error = %v, want *ValidationError", err)
+			}
+			if len(verr.Problems) != len(tt.want) {
+				t.Fatalf("PrepareDirs() problems = %q, want %d matching %q", verr.Problems, len(tt.want), tt.want)
+			}
+			for i, want := range tt.want {
+				if !strings.HasPrefix(verr.Problems[i], want) {
+					t.Errorf("problem %d = %q, want prefix %q", i, verr.Problems[i], want)
+				}
+			}
+		})
+	}
+}
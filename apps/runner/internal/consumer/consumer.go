@@ -4,36 +4,64 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/config"
+	"github.com/repobox/runner/internal/git"
 	"github.com/repobox/runner/internal/job"
 	rediskeys "github.com/repobox/runner/internal/redis"
 	"github.com/repobox/runner/internal/worker"
 )
 
+// poolFullBackoff is how long the read loop pauses when the worker pool has no room
+const poolFullBackoff = 500 * time.Millisecond
+
 // Consumer reads jobs from Redis stream
 type Consumer struct {
-	rdb            *redis.Client
+	rdb            redis.UniversalClient
+	cfg            *config.Config
 	runnerID       string
 	maxJobsPerUser int
+	maxJobsPerRepo int           // 0 = unlimited
+	claimMinIdle   time.Duration // How long a message must be pending before it may be reclaimed
+	lanes          *lanePolicy   // Order in which the priority lanes are read
+	readCount      int64         // Messages fetched per stream read
+	labels         map[string]string
 	pool           *worker.Pool
 	logger         *slog.Logger
 }
 
 // NewConsumer creates a new stream consumer
-func NewConsumer(rdb *redis.Client, runnerID string, maxJobsPerUser int, pool *worker.Pool, logger *slog.Logger) *Consumer {
+func NewConsumer(rdb redis.UniversalClient, cfg *config.Config, pool *worker.Pool, logger *slog.Logger) *Consumer {
+	claimMinIdle := cfg.ClaimMinIdle
+	if claimMinIdle <= 0 {
+		claimMinIdle = 5 * time.Minute
+	}
+	readCount := int64(cfg.StreamReadCount)
+	if readCount <= 0 {
+		readCount = 1
+	}
+
 	return &Consumer{
 		rdb:            rdb,
-		runnerID:       runnerID,
-		maxJobsPerUser: maxJobsPerUser,
+		cfg:            cfg,
+		runnerID:       cfg.RunnerID,
+		maxJobsPerUser: cfg.MaxJobsPerUser,
+		maxJobsPerRepo: cfg.MaxJobsPerRepo,
+		claimMinIdle:   claimMinIdle,
+		lanes:          &lanePolicy{weight: cfg.PriorityWeight},
+		readCount:      readCount,
+		labels:         cfg.RunnerLabels,
 		pool:           pool,
 		logger:         logger,
 	}
 }
 
-// Start begins consuming jobs from the stream
+// Start begins consuming jobs from the high and normal priority streams
 func (c *Consumer) Start(ctx context.Context) error {
 	// Ensure consumer group exists
 	if err := c.ensureConsumerGroup(ctx); err != nil {
@@ -42,18 +70,28 @@ func (c *Consumer) Start(ctx context.Context) error {
 
 	c.logger.Info("consumer started",
 		"runner_id", c.runnerID,
-		"stream", rediskeys.JobsStream,
+		"streams", jobStreams(),
 		"group", rediskeys.JobsConsumerGroup,
+		"priority_weight", c.lanes.weight,
+		"labels", config.FormatLabels(c.labels),
 	)
 
+	// Advertise labels and limits so the web app can route jobs
+	if err := c.advertiseCapabilities(ctx); err != nil {
+		c.logger.Warn("failed to advertise runner capabilities", "error", err)
+	}
+
 	// First, claim any pending messages from crashed consumers
 	if err := c.claimPendingMessages(ctx); err != nil {
 		c.logger.Warn("failed to claim pending messages", "error", err)
 	}
 
-	// Start periodic claim goroutine to recover messages from user-limit-skipped jobs
+	// Start periodic claim goroutine to recover messages left pending, e.g. by a crashed runner
 	go c.periodicClaim(ctx)
 
+	// Re-queue delayed jobs once their user and repository have capacity and this runner fits them
+	go c.promoteDelayedLoop(ctx)
+
 	// Main consumer loop
 	for {
 		select {
@@ -63,14 +101,8 @@ func (c *Consumer) Start(ctx context.Context) error {
 		default:
 		}
 
-		// Read from stream with timeout
-		streams, err := c.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
-			Group:    rediskeys.JobsConsumerGroup,
-			Consumer: c.runnerID,
-			Streams:  []string{rediskeys.JobsStream, ">"},
-			Count:    1,
-			Block:    5 * time.Second,
-		}).Result()
+		// Read the next batch of jobs, high priority lane weighted first
+		streams, err := c.readNext(ctx, 5*time.Second)
 
 		if err != nil {
 			if errors.Is(err, redis.Nil) {
@@ -85,9 +117,11 @@ func (c *Consumer) Start(ctx context.Context) error {
 			continue
 		}
 
+		// Messages are handled in stream order, each checked against the
+		// user and repository limits on its own
 		for _, stream := range streams {
 			for _, msg := range stream.Messages {
-				if err := c.processMessage(ctx, msg); err != nil {
+				if err := c.processMessage(ctx, stream.Stream, msg); err != nil {
 					c.logger.Error("failed to process message",
 						"stream_id", msg.ID,
 						"error", err,
@@ -98,73 +132,106 @@ func (c *Consumer) Start(ctx context.Context) error {
 	}
 }
 
-// ensureConsumerGroup creates the consumer group if it doesn't exist
+// ensureConsumerGroup creates the consumer group on each stream if it doesn't exist
 func (c *Consumer) ensureConsumerGroup(ctx context.Context) error {
-	err := c.rdb.XGroupCreateMkStream(ctx, rediskeys.JobsStream, rediskeys.JobsConsumerGroup, "0").Err()
-	if err != nil {
-		// BUSYGROUP means group already exists - that's fine
-		if err.Error() != "BUSYGROUP Consumer Group name already exists" {
-			return err
+	for _, stream := range jobStreams() {
+		err := c.rdb.XGroupCreateMkStream(ctx, stream, rediskeys.JobsConsumerGroup, "0").Err()
+		if err != nil {
+			// BUSYGROUP means group already exists - that's fine
+			if err.Error() != "BUSYGROUP Consumer Group name already exists" {
+				return err
+			}
 		}
 	}
 	return nil
 }
 
-// claimPendingMessages claims old pending messages from dead consumers
+// claimPendingMessages claims old pending messages from dead consumers and
+// processes them, high priority lane first
 func (c *Consumer) claimPendingMessages(ctx context.Context) error {
-	// Get pending messages older than 5 minutes
-	pending, err := c.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
-		Stream: rediskeys.JobsStream,
-		Group:  rediskeys.JobsConsumerGroup,
-		Start:  "-",
-		End:    "+",
-		Count:  100,
-	}).Result()
-
-	if err != nil {
-		return err
+	var errs []error
+	for _, stream := range jobStreams() {
+		claimed, err := c.claimIdleMessages(ctx, stream)
+		for _, msg := range claimed {
+			c.logger.Info("claimed pending message", "id", msg.ID, "stream", stream)
+			if err := c.processMessage(ctx, stream, msg); err != nil {
+				c.logger.Error("failed to process claimed message", "id", msg.ID, "error", err)
+			}
+		}
+		errs = append(errs, err)
 	}
+	return errors.Join(errs...)
+}
 
-	minIdleTime := 5 * time.Minute
-	for _, p := range pending {
-		if p.Idle < minIdleTime {
-			continue
-		}
+// claimIdleMessages atomically transfers pending messages idle for at least
+// claimMinIdle to this consumer. XAUTOCLAIM is cursor based, so we iterate
+// until the cursor wraps back to "0-0".
+func (c *Consumer) claimIdleMessages(ctx context.Context, stream string) ([]redis.XMessage, error) {
+	var claimed []redis.XMessage
+	start := "0-0"
 
-		// Claim the message
-		claimed, err := c.rdb.XClaim(ctx, &redis.XClaimArgs{
-			Stream:   rediskeys.JobsStream,
+	for {
+		msgs, next, err := c.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   stream,
 			Group:    rediskeys.JobsConsumerGroup,
 			Consumer: c.runnerID,
-			MinIdle:  minIdleTime,
-			Messages: []string{p.ID},
+			MinIdle:  c.claimMinIdle,
+			Start:    start,
+			Count:    100,
 		}).Result()
-
 		if err != nil {
-			c.logger.Warn("failed to claim message", "id", p.ID, "error", err)
-			continue
+			if strings.Contains(err.Error(), "unknown command") {
+				err = fmt.Errorf("XAUTOCLAIM not supported by Redis server (requires Redis >= 6.2): %w", err)
+			}
+			// Return what was claimed so far - those messages are now ours
+			return claimed, err
 		}
 
-		for _, msg := range claimed {
-			c.logger.Info("claimed pending message", "id", msg.ID)
-			if err := c.processMessage(ctx, msg); err != nil {
-				c.logger.Error("failed to process claimed message", "id", msg.ID, "error", err)
-			}
+		claimed = append(claimed, msgs...)
+
+		if next == "0-0" || next == "" || next == start {
+			return claimed, nil
 		}
+		start = next
 	}
-
-	return nil
 }
 
-// processMessage handles a single stream message
-func (c *Consumer) processMessage(ctx context.Context, msg redis.XMessage) error {
+// processMessage handles a single message read from stream
+func (c *Consumer) processMessage(ctx context.Context, stream string, msg redis.XMessage) error {
 	// Parse job from message
 	jobMsg, err := c.parseMessage(msg)
 	if err != nil {
 		// Invalid message - ACK it to remove from stream
-		c.rdb.XAck(ctx, rediskeys.JobsStream, rediskeys.JobsConsumerGroup, msg.ID)
+		c.rdb.XAck(ctx, stream, rediskeys.JobsConsumerGroup, msg.ID)
 		return err
 	}
+	jobMsg.Stream = stream
+
+	// Check runner labels - park the job until a matching runner re-queues it
+	if !labelsMatch(c.labels, jobMsg.RequiredLabels) {
+		c.logger.Debug("job requires labels this runner lacks, delaying",
+			"job_id", jobMsg.Job.ID,
+			"required", config.FormatLabels(jobMsg.RequiredLabels),
+			"labels", config.FormatLabels(c.labels),
+		)
+		return c.delayJob(ctx, stream, msg, delayedJob{
+			UserID: jobMsg.Job.UserID,
+			Labels: config.FormatLabels(jobMsg.RequiredLabels),
+		}, 0)
+	}
+
+	// A push retry needs the work dir kept on the runner that ran the job
+	if jobMsg.Action == worker.ActionRetryPush && jobMsg.WorkdirRunner != "" && jobMsg.WorkdirRunner != c.runnerID {
+		c.logger.Debug("push retry belongs to another runner, delaying",
+			"job_id", jobMsg.Job.ID,
+			"workdir_runner", jobMsg.WorkdirRunner,
+		)
+		// Park it until the owning runner re-queues it
+		return c.delayJob(ctx, stream, msg, delayedJob{
+			UserID: jobMsg.Job.UserID,
+			Runner: jobMsg.WorkdirRunner,
+		}, 0)
+	}
 
 	// Check user limit
 	userKey := rediskeys.UserRunningJobsKey(jobMsg.Job.UserID)
@@ -174,32 +241,67 @@ func (c *Consumer) processMessage(ctx context.Context, msg redis.XMessage) error
 	}
 
 	if running >= c.maxJobsPerUser {
-		c.logger.Debug("user at job limit, skipping",
+		c.logger.Debug("user at job limit, delaying",
 			"user_id", jobMsg.Job.UserID,
 			"running", running,
 			"limit", c.maxJobsPerUser,
 		)
-		// Don't ACK - let it be reprocessed later
-		// Sleep briefly to avoid tight loop
-		time.Sleep(100 * time.Millisecond)
-		return nil
+		c.updateQueuePosition(ctx, stream, msg.ID, jobMsg.Job.ID, running)
+		// Park it until the user has capacity - on failure it stays pending
+		return c.delayJob(ctx, stream, msg, delayedJob{UserID: jobMsg.Job.UserID}, limitDelay)
+	}
+
+	// Check repository limit - jobs on one repo race on branch creation and push
+	acquired, err := c.acquireRepoSlot(ctx, jobMsg.Job.RepoURL)
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		repo := git.NormalizeRepoURL(jobMsg.Job.RepoURL)
+		c.logger.Debug("repository at job limit, delaying",
+			"job_id", jobMsg.Job.ID,
+			"repo", repo,
+			"limit", c.maxJobsPerRepo,
+		)
+		// Park it until the repository has capacity - on failure it stays pending
+		return c.delayJob(ctx, stream, msg, delayedJob{UserID: jobMsg.Job.UserID, Repo: repo}, limitDelay)
 	}
 
 	// Increment user's running count with TTL for crash recovery
 	if err := c.rdb.Incr(ctx, userKey).Err(); err != nil {
 		c.logger.Error("failed to increment user counter", "user_id", jobMsg.Job.UserID, "error", err)
+		c.releaseRepoSlot(ctx, jobMsg.Job.RepoURL)
 		return err
 	}
 	// Set TTL to ensure counter expires if runner crashes (24h is enough for any job)
 	c.rdb.Expire(ctx, userKey, 24*time.Hour)
-
-	// Submit to worker pool
-	if err := c.pool.Submit(jobMsg); err != nil {
-		// Pool is stopped, decrement counter and return error
+	// The job IDs behind the counter, for cancelling a user's jobs
+	jobsKey := rediskeys.UserRunningJobIDsKey(jobMsg.Job.UserID)
+	c.rdb.SAdd(ctx, jobsKey, jobMsg.Job.ID)
+	c.rdb.Expire(ctx, jobsKey, 24*time.Hour)
+
+	// Submit to worker pool without blocking the read loop
+	if err := c.pool.TrySubmit(jobMsg); err != nil {
+		// Not handed to a worker, decrement counters
 		c.rdb.Decr(ctx, userKey)
+		c.rdb.SRem(ctx, jobsKey, jobMsg.Job.ID)
+		c.releaseRepoSlot(ctx, jobMsg.Job.RepoURL)
+		if errors.Is(err, worker.ErrPoolFull) {
+			c.logger.Debug("worker pool full, leaving job pending",
+				"job_id", jobMsg.Job.ID,
+				"queued", c.pool.QueueSize(),
+			)
+			// Don't ACK - let it be reprocessed later
+			// Back off so the workers can catch up
+			time.Sleep(poolFullBackoff)
+			return nil
+		}
 		return err
 	}
 
+	// The job has a worker now, it is no longer waiting in line
+	c.rdb.HDel(ctx, rediskeys.JobKey(jobMsg.Job.ID), "queue_position")
+
 	return nil
 }
 
@@ -239,7 +341,7 @@ func (c *Consumer) parseMessage(msg redis.XMessage) (*worker.JobMessage, error)
 	)
 
 	// Parse job
-	j, err := parseJobFromHash(jobData)
+	j, err := ParseJobFromHash(jobData)
 	if err != nil {
 		return nil, err
 	}
@@ -251,19 +353,40 @@ func (c *Consumer) parseMessage(msg redis.XMessage) (*worker.JobMessage, error)
 		"repo_url", j.RepoURL,
 	)
 
-	// Get provider ID from message
+	// Get provider ID, routing labels and action from message
 	providerID, _ := values["provider_id"].(string)
+	requiredLabels, _ := values["required_labels"].(string)
+	action, _ := values["action"].(string)
+	ref, _ := values["ref"].(string)
+	userName, _ := values["user_name"].(string)
+	userEmail, _ := values["user_email"].(string)
+	secretNames, _ := values["secrets"].(string)
+	workSubdir, _ := values["work_subdir"].(string)
+	if ref == "" {
+		ref = jobData["ref"]
+	}
+	if workSubdir == "" {
+		workSubdir = jobData["work_subdir"]
+	}
 
 	return &worker.JobMessage{
-		StreamID:   msg.ID,
-		Job:        j,
-		ProviderID: providerID,
+		StreamID:       msg.ID,
+		Job:            j,
+		ProviderID:     providerID,
+		RequiredLabels: config.ParseLabels(requiredLabels),
+		Action:         action,
+		WorkdirRunner:  jobData["workdir_runner"],
+		Ref:            ref,
+		WorkSubdir:     workSubdir,
+		UserName:       userName,
+		UserEmail:      userEmail,
+		Secrets:        config.ParseList(secretNames),
 	}, nil
 }
 
-// parseJobFromHash converts Redis hash to Job struct
+// ParseJobFromHash converts a job:{id} Redis hash to a Job struct
 // Note: Web app stores keys in snake_case (user_id, provider_id, etc.)
-func parseJobFromHash(data map[string]string) (*job.Job, error) {
+func ParseJobFromHash(data map[string]string) (*job.Job, error) {
 	j := &job.Job{
 		ID:          data["id"],
 		UserID:      data["user_id"],
@@ -286,7 +409,7 @@ func parseJobFromHash(data map[string]string) (*job.Job, error) {
 	return j, nil
 }
 
-// periodicClaim periodically claims pending messages that were skipped due to user limits
+// periodicClaim periodically claims pending messages, e.g. ones a crashed runner left
 func (c *Consumer) periodicClaim(ctx context.Context) {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
@@ -299,12 +422,31 @@ func (c *Consumer) periodicClaim(ctx context.Context) {
 			if err := c.claimPendingMessages(ctx); err != nil {
 				c.logger.Debug("periodic claim failed", "error", err)
 			}
+			if err := c.advertiseCapabilities(ctx); err != nil {
+				c.logger.Debug("failed to refresh runner capabilities", "error", err)
+			}
 		}
 	}
 }
 
-// AckJob acknowledges a job message and decrements user counter
+// AckJob acknowledges a job message and decrements the user and repository counters
 func (c *Consumer) AckJob(ctx context.Context, msg *worker.JobMessage) error {
+	c.ReleaseJob(ctx, msg)
+	c.rdb.SRem(ctx, rediskeys.UserRunningJobIDsKey(msg.Job.UserID), msg.Job.ID)
+
+	// ACK the stream message
+	stream := msg.Stream
+	if stream == "" {
+		stream = rediskeys.JobsStream()
+	}
+	return c.rdb.XAck(ctx, stream, rediskeys.JobsConsumerGroup, msg.StreamID).Err()
+}
+
+// ReleaseJob gives back the user and repository slots taken for a message
+// without acknowledging it. Used for a redelivered message whose job another
+// worker is still running; that worker ACKs it and owns the job's entry in
+// the user's running jobs.
+func (c *Consumer) ReleaseJob(ctx context.Context, msg *worker.JobMessage) {
 	// Decrement user's running count and clamp to 0
 	userKey := rediskeys.UserRunningJobsKey(msg.Job.UserID)
 	val, err := c.rdb.Decr(ctx, userKey).Result()
@@ -314,7 +456,5 @@ func (c *Consumer) AckJob(ctx context.Context, msg *worker.JobMessage) error {
 		// Clamp to 0 to prevent negative values from counter desync
 		c.rdb.Set(ctx, userKey, 0, 24*time.Hour)
 	}
-
-	// ACK the stream message
-	return c.rdb.XAck(ctx, rediskeys.JobsStream, rediskeys.JobsConsumerGroup, msg.StreamID).Err()
+	c.releaseRepoSlot(ctx, msg.Job.RepoURL)
 }
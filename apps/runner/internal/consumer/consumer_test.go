@@ -0,0 +1,395 @@
+package consumer
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/config"
+	"github.com/repobox/runner/internal/job"
+	rediskeys "github.com/repobox/runner/internal/redis"
+	"github.com/repobox/runner/internal/worker"
+)
+
+func testConfig() *config.Config {
+	return &config.Config{
+		RunnerID:          "runner-new",
+		MaxConcurrentJobs: 1,
+		MaxJobsPerUser:    3,
+		ClaimMinIdle:      5 * time.Minute,
+	}
+}
+
+func newTestConsumer(t *testing.T, cfg *config.Config) (*Consumer, *miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	// Pool is never started, submitted jobs stay queued for inspection
+	pool := worker.NewPool(1, func(ctx context.Context, msg *worker.JobMessage) error { return nil }, logger)
+	c := NewConsumer(rdb, cfg, pool, logger)
+	if err := c.ensureConsumerGroup(context.Background()); err != nil {
+		t.Fatalf("ensureConsumerGroup() error = %v", err)
+	}
+	return c, mr, rdb
+}
+
+// deliverTo adds a message to the jobs stream and reads it as the given consumer,
+// leaving it pending in that consumer's PEL
+func deliverTo(t *testing.T, rdb *redis.Client, consumer, jobID string) string {
+	t.Helper()
+	ctx := context.Background()
+	id, err := rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: rediskeys.JobsStream(),
+		Values: map[string]interface{}{"job_id": jobID},
+	}).Result()
+	if err != nil {
+		t.Fatalf("XAdd() error = %v", err)
+	}
+	if err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    rediskeys.JobsConsumerGroup,
+		Consumer: consumer,
+		Streams:  []string{rediskeys.JobsStream(), ">"},
+		Count:    1,
+	}).Err(); err != nil {
+		t.Fatalf("XReadGroup() error = %v", err)
+	}
+	return id
+}
+
+func TestClaimIdleMessages(t *testing.T) {
+	c, mr, rdb := newTestConsumer(t, testConfig())
+	ctx := context.Background()
+
+	now := time.Now()
+	mr.SetTime(now)
+	idleID := deliverTo(t, rdb, "runner-dead", "job-idle")
+
+	mr.SetTime(now.Add(4 * time.Minute))
+	deliverTo(t, rdb, "runner-busy", "job-fresh")
+
+	// idle message is now 6m old, fresh one only 2m
+	mr.SetTime(now.Add(6 * time.Minute))
+
+	claimed, err := c.claimIdleMessages(ctx, rediskeys.JobsStream())
+	if err != nil {
+		t.Fatalf("claimIdleMessages() error = %v", err)
+	}
+
+	if len(claimed) != 1 {
+		t.Fatalf("claimed %d messages, want 1", len(claimed))
+	}
+	if claimed[0].ID != idleID {
+		t.Errorf("claimed %s, want %s", claimed[0].ID, idleID)
+	}
+	if claimed[0].Values["job_id"] != "job-idle" {
+		t.Errorf("claimed job_id = %v, want job-idle", claimed[0].Values["job_id"])
+	}
+
+	pending, err := rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream:   rediskeys.JobsStream(),
+		Group:    rediskeys.JobsConsumerGroup,
+		Start:    "-",
+		End:      "+",
+		Count:    10,
+		Consumer: "runner-new",
+	}).Result()
+	if err != nil {
+		t.Fatalf("XPendingExt() error = %v", err)
+	}
+	if len(pending) != 1 || pending[0].ID != idleID {
+		t.Errorf("pending for runner-new = %v, want only %s", pending, idleID)
+	}
+}
+
+func TestClaimIdleMessages_NothingIdle(t *testing.T) {
+	c, mr, rdb := newTestConsumer(t, testConfig())
+
+	mr.SetTime(time.Now())
+	deliverTo(t, rdb, "runner-busy", "job-1")
+	deliverTo(t, rdb, "runner-busy", "job-2")
+
+	claimed, err := c.claimIdleMessages(context.Background(), rediskeys.JobsStream())
+	if err != nil {
+		t.Fatalf("claimIdleMessages() error = %v", err)
+	}
+	if len(claimed) != 0 {
+		t.Errorf("claimed %d messages, want 0", len(claimed))
+	}
+}
+
+func TestLabelsMatch(t *testing.T) {
+	runner := config.ParseLabels("gpu=false,region=eu,arch")
+
+	tests := []struct {
+		name     string
+		required string
+		want     bool
+	}{
+		{"no requirements", "", true},
+		{"matching value", "region=eu", true},
+		{"multiple matching", "gpu=false,region=eu", true},
+		{"key only", "arch", true},
+		{"key only against valued label", "region", true},
+		{"wrong value", "region=us", false},
+		{"missing label", "gpu=false,zone=a", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := labelsMatch(runner, config.ParseLabels(tt.required)); got != tt.want {
+				t.Errorf("labelsMatch(%q) = %v, want %v", tt.required, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessMessage_RequiredLabels(t *testing.T) {
+	tests := []struct {
+		name        string
+		required    string
+		wantQueued  int
+		wantPending int64
+		wantDelayed int64
+	}{
+		{"matching labels", "region=eu", 1, 1, 0},
+		{"non-matching labels", "gpu=true", 0, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.RunnerLabels = config.ParseLabels("gpu=false,region=eu")
+			c, _, rdb := newTestConsumer(t, cfg)
+			ctx := context.Background()
+
+			rdb.HSet(ctx, rediskeys.JobKey("job-1"), map[string]interface{}{
+				"id":      "job-1",
+				"user_id": "user-1",
+			})
+			id := deliverTo(t, rdb, "runner-new", "job-1")
+
+			msg := redis.XMessage{ID: id, Values: map[string]interface{}{
+				"job_id":          "job-1",
+				"required_labels": tt.required,
+			}}
+			if err := c.processMessage(ctx, rediskeys.JobsStream(), msg); err != nil {
+				t.Fatalf("processMessage() error = %v", err)
+			}
+
+			if got := c.pool.QueueSize(); got != tt.wantQueued {
+				t.Errorf("queued jobs = %d, want %d", got, tt.wantQueued)
+			}
+
+			// A job for other runners leaves the stream's pending list for the delayed set
+			pending, _ := rdb.XPending(ctx, rediskeys.JobsStream(), rediskeys.JobsConsumerGroup).Result()
+			if pending.Count != tt.wantPending {
+				t.Errorf("pending count = %d, want %d", pending.Count, tt.wantPending)
+			}
+			if delayed, _ := rdb.ZCard(ctx, rediskeys.JobsDelayedKey()).Result(); delayed != tt.wantDelayed {
+				t.Errorf("delayed jobs = %d, want %d", delayed, tt.wantDelayed)
+			}
+		})
+	}
+}
+
+func TestAdvertiseCapabilities(t *testing.T) {
+	cfg := testConfig()
+	cfg.RunnerLabels = config.ParseLabels("region=eu,gpu=false")
+	c, _, rdb := newTestConsumer(t, cfg)
+
+	if err := c.advertiseCapabilities(context.Background()); err != nil {
+		t.Fatalf("advertiseCapabilities() error = %v", err)
+	}
+
+	data, err := rdb.HGetAll(context.Background(), rediskeys.RunnerCapabilitiesKey("runner-new")).Result()
+	if err != nil {
+		t.Fatalf("HGetAll() error = %v", err)
+	}
+	if data["labels"] != "gpu=false,region=eu" {
+		t.Errorf("labels = %q, want %q", data["labels"], "gpu=false,region=eu")
+	}
+	if data["max_jobs_per_user"] != "3" {
+		t.Errorf("max_jobs_per_user = %q, want 3", data["max_jobs_per_user"])
+	}
+}
+
+func TestProcessMessage_PoolFull(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxJobsPerRepo = 1
+	c, _, rdb := newTestConsumer(t, cfg)
+	ctx := context.Background()
+
+	// Fill the pool's queue (size 1, buffer 2)
+	for i := 0; i < 2; i++ {
+		if err := c.pool.TrySubmit(&worker.JobMessage{Job: &job.Job{ID: "queued"}}); err != nil {
+			t.Fatalf("TrySubmit() error = %v", err)
+		}
+	}
+
+	rdb.HSet(ctx, rediskeys.JobKey("job-1"), map[string]interface{}{
+		"id":       "job-1",
+		"user_id":  "user-1",
+		"repo_url": "https://github.com/acme/app.git",
+	})
+	id := deliverTo(t, rdb, "runner-new", "job-1")
+
+	msg := redis.XMessage{ID: id, Values: map[string]interface{}{"job_id": "job-1"}}
+	if err := c.processMessage(ctx, rediskeys.JobsStream(), msg); err != nil {
+		t.Fatalf("processMessage() error = %v", err)
+	}
+
+	if got := c.pool.QueueSize(); got != 2 {
+		t.Errorf("queued jobs = %d, want 2", got)
+	}
+
+	// The message stays pending for a later claim
+	pending, _ := rdb.XPending(ctx, rediskeys.JobsStream(), rediskeys.JobsConsumerGroup).Result()
+	if pending.Count != 1 {
+		t.Errorf("pending count = %d, want 1", pending.Count)
+	}
+
+	// The slots taken for the job are given back
+	if running, _ := rdb.Get(ctx, rediskeys.UserRunningJobsKey("user-1")).Int(); running != 0 {
+		t.Errorf("user running count = %d, want 0", running)
+	}
+	if ids, _ := rediskeys.UserRunningJobs(ctx, rdb, "user-1"); len(ids) != 0 {
+		t.Errorf("user running jobs = %v, want none", ids)
+	}
+	acquired, err := c.acquireRepoSlot(ctx, "https://github.com/acme/app.git")
+	if err != nil || !acquired {
+		t.Errorf("acquireRepoSlot() = %v, %v, want the slot released", acquired, err)
+	}
+}
+
+func TestAckJob_UserRunningJobs(t *testing.T) {
+	c, _, rdb := newTestConsumer(t, testConfig())
+	ctx := context.Background()
+
+	rdb.Set(ctx, rediskeys.UserRunningJobsKey("user-1"), 2, 0)
+	rdb.SAdd(ctx, rediskeys.UserRunningJobIDsKey("user-1"), "job-1", "job-2")
+
+	msg := &worker.JobMessage{StreamID: "0-1", Job: &job.Job{ID: "job-1", UserID: "user-1"}}
+	if err := c.AckJob(ctx, msg); err != nil {
+		t.Fatalf("AckJob() error = %v", err)
+	}
+
+	if running, _ := rdb.Get(ctx, rediskeys.UserRunningJobsKey("user-1")).Int(); running != 1 {
+		t.Errorf("user running count = %d, want 1", running)
+	}
+	if ids, _ := rediskeys.UserRunningJobs(ctx, rdb, "user-1"); len(ids) != 1 || ids[0] != "job-2" {
+		t.Errorf("user running jobs = %v, want [job-2]", ids)
+	}
+}
+
+func TestReleaseJob(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxJobsPerRepo = 1
+	c, _, rdb := newTestConsumer(t, cfg)
+	ctx := context.Background()
+
+	// The original delivery is running, the redelivery took slots of its own
+	rdb.Set(ctx, rediskeys.UserRunningJobsKey("user-1"), 2, 0)
+	rdb.SAdd(ctx, rediskeys.UserRunningJobIDsKey("user-1"), "job-1")
+	rdb.HSet(ctx, rediskeys.JobKey("job-1"), map[string]interface{}{"id": "job-1", "user_id": "user-1"})
+	id := deliverTo(t, rdb, "runner-new", "job-1")
+	if acquired, err := c.acquireRepoSlot(ctx, "https://github.com/acme/app.git"); err != nil || !acquired {
+		t.Fatalf("acquireRepoSlot() = %v, %v", acquired, err)
+	}
+
+	msg := &worker.JobMessage{StreamID: id, Job: &job.Job{ID: "job-1", UserID: "user-1", RepoURL: "https://github.com/acme/app.git"}}
+	c.ReleaseJob(ctx, msg)
+
+	if running, _ := rdb.Get(ctx, rediskeys.UserRunningJobsKey("user-1")).Int(); running != 1 {
+		t.Errorf("user running count = %d, want 1", running)
+	}
+	acquired, err := c.acquireRepoSlot(ctx, "https://github.com/acme/app.git")
+	if err != nil || !acquired {
+		t.Errorf("acquireRepoSlot() = %v, %v, want the slot released", acquired, err)
+	}
+	// The original run still owns the message and the job's entry
+	if ids, _ := rediskeys.UserRunningJobs(ctx, rdb, "user-1"); len(ids) != 1 {
+		t.Errorf("user running jobs = %v, want [job-1]", ids)
+	}
+	pending, _ := rdb.XPending(ctx, rediskeys.JobsStream(), rediskeys.JobsConsumerGroup).Result()
+	if pending.Count != 1 {
+		t.Errorf("pending count = %d, want 1", pending.Count)
+	}
+}
+
+func TestReadNext_Batch(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxJobsPerUser = 1
+	cfg.StreamReadCount = 10
+	cfg.PriorityWeight = 0
+	c, _, rdb := newTestConsumer(t, cfg)
+	c.pool = worker.NewPool(4, func(ctx context.Context, msg *worker.JobMessage) error { return nil }, c.logger)
+	ctx := context.Background()
+
+	jobs := []struct{ id, user string }{
+		{"job-a1", "user-a"},
+		{"job-b1", "user-b"},
+		{"job-a2", "user-a"},
+		{"job-c1", "user-c"},
+	}
+	var ids []string
+	for _, j := range jobs {
+		rdb.HSet(ctx, rediskeys.JobKey(j.id), map[string]interface{}{"id": j.id, "user_id": j.user})
+		id, err := rdb.XAdd(ctx, &redis.XAddArgs{
+			Stream: rediskeys.JobsStream(),
+			Values: map[string]interface{}{"job_id": j.id},
+		}).Result()
+		if err != nil {
+			t.Fatalf("XAdd() error = %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	streams, err := c.readNext(ctx, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("readNext() error = %v", err)
+	}
+	if len(streams) != 1 || len(streams[0].Messages) != len(jobs) {
+		t.Fatalf("readNext() = %v, want all %d jobs in one batch", streams, len(jobs))
+	}
+	for i, msg := range streams[0].Messages {
+		if msg.ID != ids[i] {
+			t.Errorf("message %d = %s, want %s in stream order", i, msg.ID, ids[i])
+		}
+		if err := c.processMessage(ctx, streams[0].Stream, msg); err != nil {
+			t.Fatalf("processMessage(%s) error = %v", msg.ID, err)
+		}
+	}
+
+	// user-a's second job is over the per-user limit, the others go to workers
+	if got := c.pool.QueueSize(); got != 3 {
+		t.Errorf("queued jobs = %d, want 3", got)
+	}
+	for user, want := range map[string]int{"user-a": 1, "user-b": 1, "user-c": 1} {
+		if running, _ := rdb.Get(ctx, rediskeys.UserRunningJobsKey(user)).Int(); running != want {
+			t.Errorf("%s running count = %d, want %d", user, running, want)
+		}
+	}
+	if ids, _ := rediskeys.UserRunningJobs(ctx, rdb, "user-a"); len(ids) != 1 || ids[0] != "job-a1" {
+		t.Errorf("user-a running jobs = %v, want [job-a1]", ids)
+	}
+	if pos, _ := rdb.HGet(ctx, rediskeys.JobKey("job-a2"), "queue_position").Result(); pos == "" {
+		t.Error("job-a2 has no queue position, want it waiting")
+	}
+
+	// Submitted jobs stay pending until their worker ACKs them, job-a2 is
+	// parked in the delayed set
+	pending, _ := rdb.XPending(ctx, rediskeys.JobsStream(), rediskeys.JobsConsumerGroup).Result()
+	if pending.Count != 3 {
+		t.Errorf("pending count = %d, want 3", pending.Count)
+	}
+	if delayed, _ := rdb.ZCard(ctx, rediskeys.JobsDelayedKey()).Result(); delayed != 1 {
+		t.Errorf("delayed jobs = %d, want 1", delayed)
+	}
+}
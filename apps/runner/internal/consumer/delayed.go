@@ -0,0 +1,187 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/config"
+	rediskeys "github.com/repobox/runner/internal/redis"
+)
+
+// limitDelay is how long a job deferred by the per-user or per-repository
+// limit waits before the capacity is checked again
+const limitDelay = 5 * time.Second
+
+// routeDelay is how long a job waits for a runner with its required labels, or
+// a push retry for the runner holding its work dir, before it is looked at again
+const routeDelay = time.Second
+
+// delayedPollInterval is how often the delayed set is checked for due jobs
+const delayedPollInterval = time.Second
+
+// maxPromoteBatch caps how many due jobs one promotion pass looks at
+const maxPromoteBatch = 100
+
+// delayedJob is a stream message parked in the delayed set, stored as JSON
+type delayedJob struct {
+	Stream string            `json:"stream"`
+	UserID string            `json:"user_id"`
+	Repo   string            `json:"repo,omitempty"`   // Normalized repo URL, set when deferred by MAX_JOBS_PER_REPO
+	Labels string            `json:"labels,omitempty"` // Required runner labels, only a matching runner re-queues the job
+	Runner string            `json:"runner,omitempty"` // Only this runner re-queues the job (push retries)
+	Values map[string]string `json:"values"`
+}
+
+// promoteDelayedScript removes a delayed job and adds it back to its stream in
+// one step, so only one runner re-queues it. Returns the new stream ID or nil
+// if another runner got there first. The keys share the {queue} hash tag, so
+// they are in one slot in cluster mode.
+var promoteDelayedScript = redis.NewScript(`
+if redis.call("ZREM", KEYS[1], ARGV[1]) == 1 then
+	return redis.call("XADD", KEYS[2], "*", unpack(ARGV, 2))
+end
+return false
+`)
+
+// delayJob moves a message this runner can't take now out of the stream into
+// the delayed set as dj, due after delay. The message is ACKed in the same
+// transaction, so it is either parked or still pending, never lost.
+func (c *Consumer) delayJob(ctx context.Context, stream string, msg redis.XMessage, dj delayedJob, delay time.Duration) error {
+	dj.Stream = stream
+	dj.Values = make(map[string]string, len(msg.Values))
+	for k, v := range msg.Values {
+		if s, ok := v.(string); ok {
+			dj.Values[k] = s
+		}
+	}
+	member, err := json.Marshal(dj)
+	if err != nil {
+		return fmt.Errorf("failed to encode delayed job: %w", err)
+	}
+
+	readyAt := time.Now().Add(delay).UnixMilli()
+	_, err = c.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, rediskeys.JobsDelayedKey(), redis.Z{Score: float64(readyAt), Member: string(member)})
+		pipe.XAck(ctx, stream, rediskeys.JobsConsumerGroup, msg.ID)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delay job: %w", err)
+	}
+	return nil
+}
+
+// promoteDelayed adds due delayed jobs back to their stream once their user
+// is under MAX_JOBS_PER_USER and, for jobs deferred by it, their repository
+// under MAX_JOBS_PER_REPO. Jobs still at a limit are pushed back by another
+// limitDelay; jobs requiring labels this runner lacks, or routed to another
+// runner, are left to that runner and pushed back by routeDelay. Returns the number of
+// jobs re-queued.
+func (c *Consumer) promoteDelayed(ctx context.Context) (int, error) {
+	now := time.Now()
+	members, err := c.rdb.ZRangeByScore(ctx, rediskeys.JobsDelayedKey(), &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: maxPromoteBatch,
+	}).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	promoted := 0
+	// Jobs promoted per user and repository in this pass, their counters
+	// aren't incremented yet
+	queued, queuedRepo := make(map[string]int), make(map[string]int)
+	running, runningRepo := make(map[string]int), make(map[string]int)
+	for _, member := range members {
+		var dj delayedJob
+		if err := json.Unmarshal([]byte(member), &dj); err != nil || dj.Stream == "" {
+			c.logger.Error("dropping invalid delayed job", "member", member, "error", err)
+			c.rdb.ZRem(ctx, rediskeys.JobsDelayedKey(), member)
+			continue
+		}
+
+		if (dj.Labels != "" && !labelsMatch(c.labels, config.ParseLabels(dj.Labels))) ||
+			(dj.Runner != "" && dj.Runner != c.runnerID) {
+			c.postpone(ctx, member, now.Add(routeDelay))
+			continue
+		}
+
+		if _, ok := running[dj.UserID]; !ok {
+			n, err := c.rdb.Get(ctx, rediskeys.UserRunningJobsKey(dj.UserID)).Int()
+			if err != nil && !errors.Is(err, redis.Nil) {
+				return promoted, err
+			}
+			running[dj.UserID] = n
+		}
+		if running[dj.UserID]+queued[dj.UserID] >= c.maxJobsPerUser {
+			// Still at the limit, check again later
+			c.postpone(ctx, member, now.Add(limitDelay))
+			continue
+		}
+
+		if dj.Repo != "" && c.maxJobsPerRepo > 0 {
+			if _, ok := runningRepo[dj.Repo]; !ok {
+				n, err := c.rdb.Get(ctx, rediskeys.RepoRunningJobsKey(dj.Repo)).Int()
+				if err != nil && !errors.Is(err, redis.Nil) {
+					return promoted, err
+				}
+				runningRepo[dj.Repo] = n
+			}
+			if runningRepo[dj.Repo]+queuedRepo[dj.Repo] >= c.maxJobsPerRepo {
+				c.postpone(ctx, member, now.Add(limitDelay))
+				continue
+			}
+		}
+
+		args := []interface{}{member}
+		for k, v := range dj.Values {
+			args = append(args, k, v)
+		}
+		err := promoteDelayedScript.Run(ctx, c.rdb, []string{rediskeys.JobsDelayedKey(), dj.Stream}, args...).Err()
+		if errors.Is(err, redis.Nil) {
+			continue // Promoted by another runner
+		}
+		if err != nil {
+			return promoted, err
+		}
+		queued[dj.UserID]++
+		if dj.Repo != "" {
+			queuedRepo[dj.Repo]++
+		}
+		promoted++
+		c.logger.Debug("re-queued delayed job", "job_id", dj.Values["job_id"], "stream", dj.Stream)
+	}
+	return promoted, nil
+}
+
+// postpone moves a delayed job's ready-at time to at, unless another runner
+// promoted it meanwhile
+func (c *Consumer) postpone(ctx context.Context, member string, at time.Time) {
+	c.rdb.ZAddXX(ctx, rediskeys.JobsDelayedKey(), redis.Z{
+		Score:  float64(at.UnixMilli()),
+		Member: member,
+	})
+}
+
+// promoteDelayedLoop periodically re-queues due delayed jobs
+func (c *Consumer) promoteDelayedLoop(ctx context.Context) {
+	ticker := time.NewTicker(delayedPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := c.promoteDelayed(ctx); err != nil {
+				c.logger.Debug("failed to promote delayed jobs", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/config"
+	rediskeys "github.com/repobox/runner/internal/redis"
+	"github.com/repobox/runner/internal/worker"
+)
+
+func TestProcessMessage_UserLimitDelays(t *testing.T) {
+	c, _, rdb := newTestConsumer(t, testConfig())
+	ctx := context.Background()
+
+	rdb.HSet(ctx, rediskeys.JobKey("job-1"), map[string]interface{}{"id": "job-1", "user_id": "user-1"})
+	rdb.Set(ctx, rediskeys.UserRunningJobsKey("user-1"), 3, 0)
+	id := deliverTo(t, rdb, "runner-new", "job-1")
+
+	msg := redis.XMessage{ID: id, Values: map[string]interface{}{"job_id": "job-1", "ref": "v1.2.0"}}
+	before := time.Now()
+	if err := c.processMessage(ctx, rediskeys.JobsStream(), msg); err != nil {
+		t.Fatalf("processMessage() error = %v", err)
+	}
+
+	if c.pool.QueueSize() != 0 {
+		t.Errorf("queued jobs = %d, want 0", c.pool.QueueSize())
+	}
+
+	// The message leaves the stream's pending list for the delayed set
+	pending, _ := rdb.XPending(ctx, rediskeys.JobsStream(), rediskeys.JobsConsumerGroup).Result()
+	if pending.Count != 0 {
+		t.Errorf("pending count = %d, want 0", pending.Count)
+	}
+	delayed, err := rdb.ZRangeWithScores(ctx, rediskeys.JobsDelayedKey(), 0, -1).Result()
+	if err != nil || len(delayed) != 1 {
+		t.Fatalf("delayed set = %v, %v, want one job", delayed, err)
+	}
+	var dj delayedJob
+	if err := json.Unmarshal([]byte(delayed[0].Member.(string)), &dj); err != nil {
+		t.Fatalf("failed to decode delayed job: %v", err)
+	}
+	if dj.Stream != rediskeys.JobsStream() || dj.UserID != "user-1" || dj.Values["job_id"] != "job-1" || dj.Values["ref"] != "v1.2.0" {
+		t.Errorf("delayed job = %+v, want job-1 of user-1 on %s", dj, rediskeys.JobsStream())
+	}
+	if readyAt := int64(delayed[0].Score); readyAt < before.Add(limitDelay).UnixMilli() {
+		t.Errorf("ready at %d, want at least %s from now", readyAt, limitDelay)
+	}
+}
+
+// addDelayed parks a job in the delayed set with the given ready-at time
+func addDelayed(t *testing.T, rdb *redis.Client, stream, userID, jobID string, readyAt time.Time) string {
+	t.Helper()
+	member, _ := json.Marshal(delayedJob{Stream: stream, UserID: userID, Values: map[string]string{"job_id": jobID}})
+	if err := rdb.ZAdd(context.Background(), rediskeys.JobsDelayedKey(), redis.Z{Score: float64(readyAt.UnixMilli()), Member: string(member)}).Err(); err != nil {
+		t.Fatalf("ZAdd() error = %v", err)
+	}
+	return string(member)
+}
+
+// streamJobIDs returns the job IDs on a stream in order
+func streamJobIDs(t *testing.T, rdb *redis.Client, stream string) []string {
+	t.Helper()
+	msgs, err := rdb.XRange(context.Background(), stream, "-", "+").Result()
+	if err != nil {
+		t.Fatalf("XRange() error = %v", err)
+	}
+	var ids []string
+	for _, m := range msgs {
+		ids = append(ids, m.Values["job_id"].(string))
+	}
+	return ids
+}
+
+func TestPromoteDelayed(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxJobsPerUser = 1
+	c, _, rdb := newTestConsumer(t, cfg)
+	ctx := context.Background()
+	past := time.Now().Add(-time.Second)
+
+	rdb.Set(ctx, rediskeys.UserRunningJobsKey("user-busy"), 1, 0)
+	addDelayed(t, rdb, rediskeys.JobsHighStream(), "user-free", "job-free", past)
+	free2 := addDelayed(t, rdb, rediskeys.JobsStream(), "user-free", "job-free-2", past.Add(time.Millisecond))
+	busy := addDelayed(t, rdb, rediskeys.JobsStream(), "user-busy", "job-busy", past)
+	addDelayed(t, rdb, rediskeys.JobsStream(), "user-later", "job-later", time.Now().Add(time.Hour))
+
+	promoted, err := c.promoteDelayed(ctx)
+	if err != nil {
+		t.Fatalf("promoteDelayed() error = %v", err)
+	}
+	if promoted != 1 {
+		t.Errorf("promoteDelayed() = %d, want 1", promoted)
+	}
+
+	// Only one job of user-free fits under the limit, on its own lane
+	if got := streamJobIDs(t, rdb, rediskeys.JobsHighStream()); len(got) != 1 || got[0] != "job-free" {
+		t.Errorf("high stream jobs = %v, want [job-free]", got)
+	}
+	if got := streamJobIDs(t, rdb, rediskeys.JobsStream()); len(got) != 0 {
+		t.Errorf("normal stream jobs = %v, want none", got)
+	}
+	if n, _ := rdb.ZCard(ctx, rediskeys.JobsDelayedKey()).Result(); n != 3 {
+		t.Errorf("delayed jobs = %d, want 3", n)
+	}
+
+	// A user still at the limit is checked again later
+	score, _ := rdb.ZScore(ctx, rediskeys.JobsDelayedKey(), busy).Result()
+	if int64(score) <= time.Now().UnixMilli() {
+		t.Errorf("job-busy ready at %d, want pushed into the future", int64(score))
+	}
+
+	// Capacity frees up - the jobs are re-queued once due
+	rdb.Set(ctx, rediskeys.UserRunningJobsKey("user-busy"), 0, 0)
+	rdb.ZAdd(ctx, rediskeys.JobsDelayedKey(), redis.Z{Score: float64(past.UnixMilli()), Member: free2})
+	rdb.ZAdd(ctx, rediskeys.JobsDelayedKey(), redis.Z{Score: float64(past.Add(time.Millisecond).UnixMilli()), Member: busy})
+	if _, err := c.promoteDelayed(ctx); err != nil {
+		t.Fatalf("promoteDelayed() error = %v", err)
+	}
+	if got := streamJobIDs(t, rdb, rediskeys.JobsStream()); len(got) != 2 || got[0] != "job-free-2" || got[1] != "job-busy" {
+		t.Errorf("normal stream jobs = %v, want [job-free-2 job-busy]", got)
+	}
+	if n, _ := rdb.ZCard(ctx, rediskeys.JobsDelayedKey()).Result(); n != 1 {
+		t.Errorf("delayed jobs = %d, want only job-later", n)
+	}
+}
+
+func TestPromoteDelayed_InvalidMember(t *testing.T) {
+	c, _, rdb := newTestConsumer(t, testConfig())
+	ctx := context.Background()
+
+	rdb.ZAdd(ctx, rediskeys.JobsDelayedKey(), redis.Z{Score: 0, Member: "not json"})
+	if _, err := c.promoteDelayed(ctx); err != nil {
+		t.Fatalf("promoteDelayed() error = %v", err)
+	}
+	if n, _ := rdb.ZCard(ctx, rediskeys.JobsDelayedKey()).Result(); n != 0 {
+		t.Errorf("delayed jobs = %d, want the invalid entry dropped", n)
+	}
+}
+
+func TestPromoteDelayed_RequiredLabels(t *testing.T) {
+	cfg := testConfig()
+	cfg.RunnerLabels = config.ParseLabels("region=us")
+	c, _, rdb := newTestConsumer(t, cfg)
+	ctx := context.Background()
+
+	member, _ := json.Marshal(delayedJob{Stream: rediskeys.JobsStream(), UserID: "user-1", Labels: "region=eu", Values: map[string]string{"job_id": "job-1"}})
+	rdb.ZAdd(ctx, rediskeys.JobsDelayedKey(), redis.Z{Score: float64(time.Now().Add(-time.Second).UnixMilli()), Member: string(member)})
+
+	// A runner without the labels leaves the job to a matching one
+	if promoted, err := c.promoteDelayed(ctx); err != nil || promoted != 0 {
+		t.Fatalf("promoteDelayed() = %d, %v, want 0", promoted, err)
+	}
+	score, _ := rdb.ZScore(ctx, rediskeys.JobsDelayedKey(), string(member)).Result()
+	if int64(score) <= time.Now().UnixMilli() {
+		t.Errorf("job-1 ready at %d, want pushed into the future", int64(score))
+	}
+
+	// A matching runner re-queues it once due
+	rdb.ZAdd(ctx, rediskeys.JobsDelayedKey(), redis.Z{Score: 0, Member: string(member)})
+	c.labels = config.ParseLabels("region=eu,gpu=false")
+	if promoted, err := c.promoteDelayed(ctx); err != nil || promoted != 1 {
+		t.Fatalf("promoteDelayed() = %d, %v, want 1", promoted, err)
+	}
+	if got := streamJobIDs(t, rdb, rediskeys.JobsStream()); len(got) != 1 || got[0] != "job-1" {
+		t.Errorf("stream jobs = %v, want [job-1]", got)
+	}
+}
+
+func TestProcessMessage_RetryPushRoutedToOwner(t *testing.T) {
+	c, _, rdb := newTestConsumer(t, testConfig())
+	ctx := context.Background()
+
+	rdb.HSet(ctx, rediskeys.JobKey("job-1"), map[string]interface{}{
+		"id":             "job-1",
+		"user_id":        "user-1",
+		"workdir_runner": "runner-old",
+	})
+	id := deliverTo(t, rdb, "runner-new", "job-1")
+	msg := redis.XMessage{ID: id, Values: map[string]interface{}{"job_id": "job-1", "action": worker.ActionRetryPush}}
+	if err := c.processMessage(ctx, rediskeys.JobsStream(), msg); err != nil {
+		t.Fatalf("processMessage() error = %v", err)
+	}
+
+	// Another runner's push retry is parked for its owner, not run or left pending
+	if got := c.pool.QueueSize(); got != 0 {
+		t.Errorf("queued jobs = %d, want 0", got)
+	}
+	if pending, _ := rdb.XPending(ctx, rediskeys.JobsStream(), rediskeys.JobsConsumerGroup).Result(); pending.Count != 0 {
+		t.Errorf("pending count = %d, want 0", pending.Count)
+	}
+	delayed, _ := rdb.ZRange(ctx, rediskeys.JobsDelayedKey(), 0, -1).Result()
+	if len(delayed) != 1 {
+		t.Fatalf("delayed jobs = %d, want 1", len(delayed))
+	}
+
+	// Only the owning runner re-queues it
+	if promoted, err := c.promoteDelayed(ctx); err != nil || promoted != 0 {
+		t.Fatalf("promoteDelayed() = %d, %v, want 0", promoted, err)
+	}
+	rdb.ZAdd(ctx, rediskeys.JobsDelayedKey(), redis.Z{Score: 0, Member: delayed[0]})
+	c.runnerID = "runner-old"
+	if promoted, err := c.promoteDelayed(ctx); err != nil || promoted != 1 {
+		t.Fatalf("promoteDelayed() = %d, %v, want 1", promoted, err)
+	}
+	msgs, _ := rdb.XRange(ctx, rediskeys.JobsStream(), "-", "+").Result()
+	if last := msgs[len(msgs)-1]; last.Values["job_id"] != "job-1" || last.Values["action"] != worker.ActionRetryPush {
+		t.Errorf("re-queued message = %v, want the job-1 push retry", last.Values)
+	}
+}
@@ -0,0 +1,42 @@
+package consumer
+
+import (
+	"context"
+	"time"
+
+	"github.com/repobox/runner/internal/config"
+	rediskeys "github.com/repobox/runner/internal/redis"
+)
+
+// capabilitiesTTL keeps the capabilities hash alive while the runner refreshes it
+const capabilitiesTTL = 2 * time.Minute
+
+// labelsMatch reports whether the runner labels satisfy every required label.
+// A required label with an empty value only requires the key to be present.
+func labelsMatch(runner, required map[string]string) bool {
+	for key, want := range required {
+		got, ok := runner[key]
+		if !ok {
+			return false
+		}
+		if want != "" && got != want {
+			return false
+		}
+	}
+	return true
+}
+
+// advertiseCapabilities writes the runner's labels and limits to Redis
+func (c *Consumer) advertiseCapabilities(ctx context.Context) error {
+	key := rediskeys.RunnerCapabilitiesKey(c.runnerID)
+	if err := c.rdb.HSet(ctx, key, map[string]interface{}{
+		"runner_id":           c.runnerID,
+		"labels":              config.FormatLabels(c.labels),
+		"max_concurrent_jobs": c.cfg.MaxConcurrentJobs,
+		"max_jobs_per_user":   c.maxJobsPerUser,
+		"updated_at":          time.Now().UnixMilli(),
+	}).Err(); err != nil {
+		return err
+	}
+	return c.rdb.Expire(ctx, key, capabilitiesTTL).Err()
+}
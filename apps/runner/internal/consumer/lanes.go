@@ -0,0 +1,74 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	rediskeys "github.com/repobox/runner/internal/redis"
+)
+
+// jobStreams returns the priority lanes, high priority first. Built on each
+// call, as the keys carry the prefix set at startup.
+func jobStreams() []string {
+	return []string{rediskeys.JobsHighStream(), rediskeys.JobsStream()}
+}
+
+// lanePolicy decides which lane a read tries first. Out of every weight+1
+// reads, weight prefer the high lane and one the normal lane, so a steady
+// flow of high-priority jobs can't starve normal ones. A weight of 0 or less
+// always prefers the high lane.
+type lanePolicy struct {
+	weight int
+	reads  int
+}
+
+// order returns the lanes in the order the next read should try them
+func (p *lanePolicy) order() []string {
+	p.reads++
+	if p.weight > 0 && p.reads%(p.weight+1) == 0 {
+		return []string{rediskeys.JobsStream(), rediskeys.JobsHighStream()}
+	}
+	return jobStreams()
+}
+
+// readNext reads up to readCount new messages from one lane, trying the lanes
+// in policy order. When both are empty it blocks on both until either gets a
+// message. Both lanes carry the {queue} hash tag, so reading them in one call
+// stays within a slot in Redis Cluster.
+func (c *Consumer) readNext(ctx context.Context, block time.Duration) ([]redis.XStream, error) {
+	for _, stream := range c.lanes.order() {
+		streams, err := c.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    rediskeys.JobsConsumerGroup,
+			Consumer: c.runnerID,
+			Streams:  []string{stream, ">"},
+			Count:    c.readCount,
+			Block:    -1, // Don't wait, the other lane may have work
+		}).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+		if hasMessages(streams) {
+			return streams, nil
+		}
+	}
+
+	return c.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    rediskeys.JobsConsumerGroup,
+		Consumer: c.runnerID,
+		Streams:  append(jobStreams(), ">", ">"),
+		Count:    c.readCount,
+		Block:    block,
+	}).Result()
+}
+
+// hasMessages reports whether a read returned any message
+func hasMessages(streams []redis.XStream) bool {
+	for _, s := range streams {
+		if len(s.Messages) > 0 {
+			return true
+		}
+	}
+	return false
+}
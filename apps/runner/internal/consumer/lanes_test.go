@@ -0,0 +1,146 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	rediskeys "github.com/repobox/runner/internal/redis"
+)
+
+func TestLanePolicy_Order(t *testing.T) {
+	tests := []struct {
+		name   string
+		weight int
+		want   string // First lane of each read: h(igh) or n(ormal)
+	}{
+		{"strict priority", 0, "hhhhhh"},
+		{"negative is strict", -1, "hhhh"},
+		{"weight 1 alternates", 1, "hnhnhn"},
+		{"weight 3", 3, "hhhnhhhn"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &lanePolicy{weight: tt.weight}
+			var got strings.Builder
+			for range len(tt.want) {
+				order := p.order()
+				if len(order) != 2 {
+					t.Fatalf("order() = %v, want both lanes", order)
+				}
+				if order[0] == rediskeys.JobsHighStream() {
+					got.WriteString("h")
+				} else {
+					got.WriteString("n")
+				}
+			}
+			if got.String() != tt.want {
+				t.Errorf("order() sequence = %q, want %q", got.String(), tt.want)
+			}
+		})
+	}
+}
+
+// enqueue adds count jobs to stream, with IDs prefixed by prefix
+func enqueue(t *testing.T, rdb *redis.Client, stream, prefix string, count int) {
+	t.Helper()
+	for i := range count {
+		if err := rdb.XAdd(context.Background(), &redis.XAddArgs{
+			Stream: stream,
+			Values: map[string]interface{}{"job_id": fmt.Sprintf("%s-%d", prefix, i)},
+		}).Err(); err != nil {
+			t.Fatalf("XAdd() error = %v", err)
+		}
+	}
+}
+
+// readLanes reads n messages and returns the lane of each as h or n
+func readLanes(t *testing.T, c *Consumer, n int) string {
+	t.Helper()
+	var got strings.Builder
+	for range n {
+		streams, err := c.readNext(context.Background(), 10*time.Millisecond)
+		if err != nil {
+			t.Fatalf("readNext() error = %v", err)
+		}
+		if !hasMessages(streams) {
+			t.Fatalf("readNext() returned no message")
+		}
+		if streams[0].Stream == rediskeys.JobsHighStream() {
+			got.WriteString("h")
+		} else {
+			got.WriteString("n")
+		}
+	}
+	return got.String()
+}
+
+func TestReadNext_MixedLoad(t *testing.T) {
+	tests := []struct {
+		name         string
+		weight       int
+		high, normal int
+		want         string
+	}{
+		{"weighted", 2, 4, 3, "hhnhhnn"},
+		{"strict priority drains high first", 0, 3, 2, "hhhnn"},
+		{"only normal", 3, 0, 3, "nnn"},
+		{"only high", 3, 3, 0, "hhh"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.PriorityWeight = tt.weight
+			c, _, rdb := newTestConsumer(t, cfg)
+			enqueue(t, rdb, rediskeys.JobsHighStream(), "high", tt.high)
+			enqueue(t, rdb, rediskeys.JobsStream(), "normal", tt.normal)
+
+			if got := readLanes(t, c, len(tt.want)); got != tt.want {
+				t.Errorf("lanes read = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadNext_Empty(t *testing.T) {
+	c, _, _ := newTestConsumer(t, testConfig())
+
+	streams, err := c.readNext(context.Background(), 10*time.Millisecond)
+	if err != nil && err != redis.Nil {
+		t.Fatalf("readNext() error = %v", err)
+	}
+	if hasMessages(streams) {
+		t.Errorf("readNext() = %v, want no messages", streams)
+	}
+}
+
+func TestReadNext_KeyPrefix(t *testing.T) {
+	// The prefix is set after package init, as the runner does at startup
+	rediskeys.SetKeyPrefix("staging:")
+	t.Cleanup(func() { rediskeys.SetKeyPrefix("") })
+
+	c, _, rdb := newTestConsumer(t, testConfig())
+	enqueue(t, rdb, "staging:jobs:{queue}:stream:high", "high", 1)
+	enqueue(t, rdb, "staging:jobs:{queue}:stream", "normal", 1)
+
+	if got := readLanes(t, c, 2); got != "hn" {
+		t.Errorf("lanes read = %q, want %q", got, "hn")
+	}
+}
+
+func TestJobStreams_SameSlot(t *testing.T) {
+	// One XREADGROUP may block on both lanes in cluster mode
+	rediskeys.SetKeyPrefix("repobox:")
+	t.Cleanup(func() { rediskeys.SetKeyPrefix("") })
+
+	for _, stream := range jobStreams() {
+		if tag := rediskeys.HashTag(stream); tag != "queue" {
+			t.Errorf("HashTag(%q) = %q, want both lanes in the {queue} slot", stream, tag)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package consumer
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+	rediskeys "github.com/repobox/runner/internal/redis"
+)
+
+// maxQueueScan caps how many older pending messages are counted for a queue position
+const maxQueueScan = 1000
+
+// estimateQueuePosition returns an approximate 1-based place in line for a job
+// deferred by the per-user limit. olderPending counts messages delivered before
+// it that are not yet acknowledged - running or waiting jobs of any user, so the
+// estimate errs on the high side. A job also can't start before enough of the
+// user's own running jobs finish to get under the limit.
+func estimateQueuePosition(olderPending, userRunning, userLimit int) int {
+	ownBlocking := 0
+	if userRunning >= userLimit {
+		ownBlocking = userRunning - userLimit + 1
+	}
+	return max(olderPending, ownBlocking) + 1
+}
+
+// updateQueuePosition writes the estimated queue_position to the job hash,
+// counting the older pending messages of the job's own priority lane.
+// Best effort: failures are only logged.
+func (c *Consumer) updateQueuePosition(ctx context.Context, stream, streamID, jobID string, userRunning int) {
+	pending, err := c.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: stream,
+		Group:  rediskeys.JobsConsumerGroup,
+		Start:  "-",
+		End:    streamID,
+		Count:  maxQueueScan,
+	}).Result()
+	if err != nil {
+		c.logger.Debug("failed to read pending messages for queue position", "job_id", jobID, "error", err)
+		return
+	}
+
+	older := 0
+	for _, p := range pending {
+		if p.ID != streamID {
+			older++
+		}
+	}
+
+	position := estimateQueuePosition(older, userRunning, c.maxJobsPerUser)
+	if err := c.rdb.HSet(ctx, rediskeys.JobKey(jobID), "queue_position", position).Err(); err != nil {
+		c.logger.Debug("failed to write queue position", "job_id", jobID, "error", err)
+	}
+}
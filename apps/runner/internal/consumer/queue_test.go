@@ -0,0 +1,67 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	rediskeys "github.com/repobox/runner/internal/redis"
+)
+
+func TestEstimateQueuePosition(t *testing.T) {
+	tests := []struct {
+		name         string
+		olderPending int
+		userRunning  int
+		userLimit    int
+		want         int
+	}{
+		{"front of the line", 0, 0, 3, 1},
+		{"older jobs pending", 4, 3, 3, 5},
+		{"user at limit, nothing else pending", 0, 3, 3, 2},
+		{"user over limit", 1, 5, 3, 4},
+		{"under limit", 2, 1, 3, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := estimateQueuePosition(tt.olderPending, tt.userRunning, tt.userLimit); got != tt.want {
+				t.Errorf("estimateQueuePosition(%d, %d, %d) = %d, want %d", tt.olderPending, tt.userRunning, tt.userLimit, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessMessage_QueuePosition(t *testing.T) {
+	c, _, rdb := newTestConsumer(t, testConfig())
+	ctx := context.Background()
+
+	// Two older jobs of other users are still pending
+	deliverTo(t, rdb, "runner-other", "job-a")
+	deliverTo(t, rdb, "runner-other", "job-b")
+
+	rdb.HSet(ctx, rediskeys.JobKey("job-1"), map[string]interface{}{"id": "job-1", "user_id": "user-1"})
+	id := deliverTo(t, rdb, "runner-new", "job-1")
+	msg := redis.XMessage{ID: id, Values: map[string]interface{}{"job_id": "job-1"}}
+
+	// User at the limit - job is deferred with a position
+	rdb.Set(ctx, rediskeys.UserRunningJobsKey("user-1"), 3, 0)
+	if err := c.processMessage(ctx, rediskeys.JobsStream(), msg); err != nil {
+		t.Fatalf("processMessage() error = %v", err)
+	}
+	if got, _ := rdb.HGet(ctx, rediskeys.JobKey("job-1"), "queue_position").Int(); got != 3 {
+		t.Errorf("queue_position = %d, want 3", got)
+	}
+
+	// A slot frees up - job is submitted and the position cleared
+	rdb.Set(ctx, rediskeys.UserRunningJobsKey("user-1"), 2, 0)
+	if err := c.processMessage(ctx, rediskeys.JobsStream(), msg); err != nil {
+		t.Fatalf("processMessage() error = %v", err)
+	}
+	if c.pool.QueueSize() != 1 {
+		t.Fatalf("queued jobs = %d, want 1", c.pool.QueueSize())
+	}
+	if exists, _ := rdb.HExists(ctx, rediskeys.JobKey("job-1"), "queue_position").Result(); exists {
+		t.Error("queue_position still set after the job was submitted")
+	}
+}
@@ -0,0 +1,48 @@
+package consumer
+
+import (
+	"context"
+	"time"
+
+	"github.com/repobox/runner/internal/git"
+	rediskeys "github.com/repobox/runner/internal/redis"
+)
+
+// acquireRepoSlot takes one of the repository's MAX_JOBS_PER_REPO slots.
+// INCR first and give the slot back when over the limit, so two runners can't
+// both pass a check-then-increment race. Always succeeds when unlimited.
+func (c *Consumer) acquireRepoSlot(ctx context.Context, repoURL string) (bool, error) {
+	if c.maxJobsPerRepo <= 0 {
+		return true, nil
+	}
+
+	key := rediskeys.RepoRunningJobsKey(git.NormalizeRepoURL(repoURL))
+	running, err := c.rdb.Incr(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+	// TTL so the counter expires if a runner crashes (24h is enough for any job)
+	c.rdb.Expire(ctx, key, 24*time.Hour)
+
+	if running > int64(c.maxJobsPerRepo) {
+		c.rdb.Decr(ctx, key)
+		return false, nil
+	}
+	return true, nil
+}
+
+// releaseRepoSlot gives back a slot taken by acquireRepoSlot
+func (c *Consumer) releaseRepoSlot(ctx context.Context, repoURL string) {
+	if c.maxJobsPerRepo <= 0 {
+		return
+	}
+
+	key := rediskeys.RepoRunningJobsKey(git.NormalizeRepoURL(repoURL))
+	val, err := c.rdb.Decr(ctx, key).Result()
+	if err != nil {
+		c.logger.Warn("failed to decrement repository counter", "repo_url", repoURL, "error", err)
+	} else if val < 0 {
+		// Clamp to 0 to prevent negative values from counter desync
+		c.rdb.Set(ctx, key, 0, 24*time.Hour)
+	}
+}
@@ -0,0 +1,102 @@
+package consumer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	rediskeys "github.com/repobox/runner/internal/redis"
+)
+
+func TestProcessMessage_RepoLimit(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxJobsPerRepo = 1
+	c, _, rdb := newTestConsumer(t, cfg)
+	ctx := context.Background()
+	repoKey := rediskeys.RepoRunningJobsKey("github.com/owner/repo")
+
+	// Two users, same repo spelled differently
+	rdb.HSet(ctx, rediskeys.JobKey("job-1"), map[string]interface{}{
+		"id":       "job-1",
+		"user_id":  "user-1",
+		"repo_url": "https://github.com/owner/repo.git",
+	})
+	rdb.HSet(ctx, rediskeys.JobKey("job-2"), map[string]interface{}{
+		"id":       "job-2",
+		"user_id":  "user-2",
+		"repo_url": "https://GitHub.com/owner/repo",
+	})
+	id1 := deliverTo(t, rdb, "runner-new", "job-1")
+	id2 := deliverTo(t, rdb, "runner-new", "job-2")
+	msg1 := redis.XMessage{ID: id1, Values: map[string]interface{}{"job_id": "job-1"}}
+	msg2 := redis.XMessage{ID: id2, Values: map[string]interface{}{"job_id": "job-2"}}
+
+	if err := c.processMessage(ctx, rediskeys.JobsStream(), msg1); err != nil {
+		t.Fatalf("processMessage(job-1) error = %v", err)
+	}
+	if err := c.processMessage(ctx, rediskeys.JobsStream(), msg2); err != nil {
+		t.Fatalf("processMessage(job-2) error = %v", err)
+	}
+
+	// Second job is parked without taking a user or repo slot
+	if got := c.pool.QueueSize(); got != 1 {
+		t.Fatalf("queued jobs = %d, want 1", got)
+	}
+	if got, _ := rdb.Get(ctx, repoKey).Int(); got != 1 {
+		t.Errorf("repo running = %d, want 1", got)
+	}
+	if n, _ := rdb.Exists(ctx, rediskeys.UserRunningJobsKey("user-2")).Result(); n != 0 {
+		t.Error("deferred job took a user slot")
+	}
+	pending, _ := rdb.XPending(ctx, rediskeys.JobsStream(), rediskeys.JobsConsumerGroup).Result()
+	if pending.Count != 1 {
+		t.Errorf("pending count = %d, want 1", pending.Count)
+	}
+	delayed, _ := rdb.ZRange(ctx, rediskeys.JobsDelayedKey(), 0, -1).Result()
+	if len(delayed) != 1 {
+		t.Fatalf("delayed jobs = %d, want 1", len(delayed))
+	}
+
+	// Not re-queued while the repository is at the limit
+	rdb.ZAdd(ctx, rediskeys.JobsDelayedKey(), redis.Z{Score: 0, Member: delayed[0]})
+	if promoted, err := c.promoteDelayed(ctx); err != nil || promoted != 0 {
+		t.Fatalf("promoteDelayed() = %d, %v, want 0", promoted, err)
+	}
+
+	// First job finishes - the slot is released and the second one is re-queued
+	job1, err := c.parseMessage(msg1)
+	if err != nil {
+		t.Fatalf("parseMessage() error = %v", err)
+	}
+	if err := c.AckJob(ctx, job1); err != nil {
+		t.Fatalf("AckJob() error = %v", err)
+	}
+	if got, _ := rdb.Get(ctx, repoKey).Int(); got != 0 {
+		t.Errorf("repo running after ack = %d, want 0", got)
+	}
+	rdb.ZAdd(ctx, rediskeys.JobsDelayedKey(), redis.Z{Score: 0, Member: delayed[0]})
+	if promoted, err := c.promoteDelayed(ctx); err != nil || promoted != 1 {
+		t.Fatalf("promoteDelayed() = %d, %v, want 1", promoted, err)
+	}
+	if got := streamJobIDs(t, rdb, rediskeys.JobsStream()); got[len(got)-1] != "job-2" {
+		t.Errorf("stream jobs = %v, want job-2 re-added last", got)
+	}
+}
+
+func TestAcquireRepoSlot_Unlimited(t *testing.T) {
+	c, _, rdb := newTestConsumer(t, testConfig())
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		ok, err := c.acquireRepoSlot(ctx, "https://github.com/owner/repo.git")
+		if err != nil || !ok {
+			t.Fatalf("acquireRepoSlot() = %v, %v, want true", ok, err)
+		}
+	}
+	c.releaseRepoSlot(ctx, "https://github.com/owner/repo.git")
+
+	// No counter is kept when the limit is off
+	if n, _ := rdb.Exists(ctx, rediskeys.RepoRunningJobsKey("github.com/owner/repo")).Result(); n != 0 {
+		t.Error("repo counter written with MAX_JOBS_PER_REPO unset")
+	}
+}
@@ -0,0 +1,97 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/repobox/runner/internal/agent"
+	"github.com/repobox/runner/internal/config"
+	"github.com/repobox/runner/internal/git"
+)
+
+// flakyAgent leaves partial changes and fails with the given errors before succeeding
+type flakyAgent struct {
+	failures []error
+	attempts int
+}
+
+func (a *flakyAgent) Execute(ctx context.Context, opts agent.ExecuteOptions) (*agent.Result, error) {
+	a.attempts++
+	if a.attempts <= len(a.failures) {
+		os.WriteFile(filepath.Join(opts.WorkDir, "README.md"), []byte("half-edited\n"), 0644)
+		os.MkdirAll(filepath.Join(opts.WorkDir, "partial"), 0755)
+		os.WriteFile(filepath.Join(opts.WorkDir, "partial", "file.go"), []byte("package partial\n"), 0644)
+		return &agent.Result{ExitCode: 1}, a.failures[a.attempts-1]
+	}
+	return &agent.Result{}, os.WriteFile(filepath.Join(opts.WorkDir, "DONE.md"), []byte("done\n"), 0644)
+}
+
+func TestExecuteAgent_Retry(t *testing.T) {
+	transient := &agent.ExitError{Code: 1, Stderr: []string{"Error: read ECONNRESET"}}
+	permanent := &agent.ExitError{Code: 1, Stderr: []string{"Error: Invalid API key"}}
+
+	tests := []struct {
+		name         string
+		maxRetries   int
+		failures     []error
+		wantErr      bool
+		wantAttempts int
+	}{
+		{"transient failure retried", 2, []error{transient}, false, 2},
+		{"retries disabled", 0, []error{transient}, true, 1},
+		{"permanent failure not retried", 2, []error{permanent}, true, 1},
+		{"retries exhausted", 1, []error{transient, transient}, true, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := filepath.Join(t.TempDir(), "repo")
+			runGit(t, "init", repo)
+			if err := os.WriteFile(filepath.Join(repo, "README.md"), []byte("hello\n"), 0644); err != nil {
+				t.Fatalf("failed to write README: %v", err)
+			}
+			runGit(t, "-C", repo, "add", "-A")
+			runGit(t, "-C", repo, "commit", "-m", "initial")
+
+			e, _ := newTestExecutor(t, &config.Config{AIMaxRetries: tt.maxRetries})
+			fake := &flakyAgent{failures: tt.failures}
+			e.agent = fake
+
+			res, err := e.executeAgent(context.Background(), git.New(), "job-1", repo, agent.ExecuteOptions{
+				WorkDir: repo,
+				Output:  func(string, agent.OutputSource, string) {},
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("executeAgent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if fake.attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", fake.attempts, tt.wantAttempts)
+			}
+			// The result is the last attempt's
+			wantExit := 0
+			if tt.wantErr {
+				wantExit = 1
+			}
+			if res == nil || res.ExitCode != wantExit {
+				t.Errorf("result = %+v, want exit code %d", res, wantExit)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			// The successful attempt starts from a clean checkout
+			readme, _ := os.ReadFile(filepath.Join(repo, "README.md"))
+			if string(readme) != "hello\n" {
+				t.Errorf("README.md = %q, want partial change reset", readme)
+			}
+			if _, err := os.Stat(filepath.Join(repo, "partial")); !os.IsNotExist(err) {
+				t.Errorf("partial dir still exists after retry: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(repo, "DONE.md")); err != nil {
+				t.Errorf("DONE.md missing: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	rediskeys "github.com/repobox/runner/internal/redis"
+)
+
+// ErrJobCancelled is the cancellation cause of a job an operator cancelled
+var ErrJobCancelled = errors.New("job cancelled by an operator")
+
+// cancelPollInterval is how often a running job's cancel flag is checked
+const cancelPollInterval = 2 * time.Second
+
+// watchCancel polls the job's cancel flag every interval and cancels the job
+// through cancel, with an ErrJobCancelled cause, once it is set. Redis errors
+// are retried on the next tick. The returned stop ends the watcher and waits
+// for it to exit.
+func watchCancel(ctx context.Context, cancel context.CancelCauseFunc, rdb redis.UniversalClient, jobID string, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if requested, err := rediskeys.CancelRequested(ctx, rdb, jobID); err == nil && requested {
+				cancel(ErrJobCancelled)
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
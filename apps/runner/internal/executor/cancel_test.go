@@ -0,0 +1,60 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/repobox/runner/internal/config"
+	"github.com/repobox/runner/internal/job"
+	rediskeys "github.com/repobox/runner/internal/redis"
+)
+
+func TestWatchCancel(t *testing.T) {
+	_, rdb := newTestExecutor(t, &config.Config{})
+	rdb.HSet(context.Background(), rediskeys.JobKey("job-1"), "id", "job-1", "status", "running")
+	rdb.SAdd(context.Background(), rediskeys.UserRunningJobIDsKey("user-1"), "job-1")
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	stop := watchCancel(ctx, cancel, rdb, "job-1", 10*time.Millisecond)
+	defer stop()
+
+	// Without the flag the job keeps running
+	time.Sleep(50 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Fatalf("job cancelled without a request: %v", context.Cause(ctx))
+	}
+
+	if n, err := rediskeys.CancelUserJobs(context.Background(), rdb, "user-1"); err != nil || n != 1 {
+		t.Fatalf("CancelUserJobs() = %d, %v, want 1", n, err)
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("job not cancelled after the cancel flag was set")
+	}
+	if cause := context.Cause(ctx); !errors.Is(cause, ErrJobCancelled) {
+		t.Errorf("cancel cause = %v, want ErrJobCancelled", cause)
+	}
+}
+
+func TestFailJob_Cancelled(t *testing.T) {
+	e, rdb := newTestExecutor(t, &config.Config{})
+	rdb.HSet(context.Background(), rediskeys.JobKey("job-1"), "id", "job-1", "status", "running")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(ErrJobCancelled)
+
+	// The step that noticed the cancellation reports its own error
+	err := e.failJob(ctx, "job-1", job.Wrap(job.ErrCodeAgent, errors.New("agent execution failed: signal: killed")))
+	if got := job.CodeOf(err); got != job.ErrCodeCancelled {
+		t.Errorf("failJob() code = %q, want %q", got, job.ErrCodeCancelled)
+	}
+
+	data, _ := rdb.HGetAll(context.Background(), rediskeys.JobKey("job-1")).Result()
+	if data["status"] != string(job.StatusCancelled) || data["error_code"] != string(job.ErrCodeCancelled) {
+		t.Errorf("job hash = %v, want the job cancelled", data)
+	}
+}
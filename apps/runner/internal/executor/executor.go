@@ -2,7 +2,7 @@ package executor
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -11,77 +11,186 @@ import (
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/activity"
 	"github.com/repobox/runner/internal/agent"
 	"github.com/repobox/runner/internal/config"
 	"github.com/repobox/runner/internal/crypto"
 	"github.com/repobox/runner/internal/git"
+	"github.com/repobox/runner/internal/identity"
 	"github.com/repobox/runner/internal/job"
+	"github.com/repobox/runner/internal/joboutput"
+	"github.com/repobox/runner/internal/mergerequest"
+	"github.com/repobox/runner/internal/redact"
 	rediskeys "github.com/repobox/runner/internal/redis"
+	"github.com/repobox/runner/internal/repoconfig"
+	"github.com/repobox/runner/internal/secrets"
+	"github.com/repobox/runner/internal/telemetry"
+	"github.com/repobox/runner/internal/tokensource"
+	"github.com/repobox/runner/internal/topics"
+	"github.com/repobox/runner/internal/trace"
 	"github.com/repobox/runner/internal/util"
 	"github.com/repobox/runner/internal/worker"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Executor handles job execution
 type Executor struct {
-	rdb       *redis.Client
-	cfg       *config.Config
-	decryptor *crypto.Decryptor
-	agent     agent.Agent
-	logger    *slog.Logger
+	rdb          redis.UniversalClient
+	cfg          *config.Config
+	decryptor    *crypto.Decryptor
+	tokens       tokensource.Source
+	agent        agent.Agent
+	seq          *rediskeys.OutputSequencer
+	redactor     *redact.Redactor
+	topics       *topics.Client
+	identity     *identity.Client
+	logger       *slog.Logger
+	instructions agent.Instructions
+	cliArgs      agent.CLIArgs
 }
 
 // NewExecutor creates a new job executor
-func NewExecutor(rdb *redis.Client, cfg *config.Config, logger *slog.Logger) (*Executor, error) {
+func NewExecutor(rdb redis.UniversalClient, cfg *config.Config, logger *slog.Logger) (*Executor, error) {
 	decryptor, err := crypto.NewDecryptor(cfg.EncryptionKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create decryptor: %w", err)
 	}
 
+	tokens, err := tokensource.New(rdb, cfg, decryptor)
+	if err != nil {
+		return nil, err
+	}
+
+	redactor, err := redact.New(cfg.OutputRedactPatterns, cfg.OutputRedactDefaults)
+	if err != nil {
+		return nil, err
+	}
+
+	instructions, err := agent.LoadInstructions(cfg.AIInstructionsFile, cfg.AIInstructions)
+	if err != nil {
+		return nil, err
+	}
+
+	cliArgs, err := agent.LoadCLIArgs(cfg.AIExtraArgs, cfg.AIEnvArgs)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create AI agent
+	bashPolicy, err := agent.NewBashPolicy(cfg.BashCommandDeny, cfg.BashDenyDefaults, cfg.BashPolicyMode)
+	if err != nil {
+		return nil, err
+	}
+	egress, err := agent.NewEgressPolicy(cfg.AgentNetwork, cfg.AgentAPIHosts, cfg.AgentNetworkAllow)
+	if err != nil {
+		return nil, err
+	}
+
 	agentCfg := &agent.Config{
-		Enabled:        cfg.AIEnabled,
-		Provider:       cfg.AIProvider,
-		CLIPath:        cfg.AICLIPath,
-		APIKey:         cfg.AIAPIKey,
-		Timeout:        int(cfg.AITimeout.Seconds()),
-		MaxOutputLines: cfg.AIMaxOutputLines,
+		Enabled:           cfg.AIEnabled,
+		Provider:          cfg.AIProvider,
+		CLIPath:           cfg.AICLIPath,
+		APIKey:            cfg.AIAPIKey,
+		Timeout:           int(cfg.AITimeout.Seconds()),
+		IdleTimeout:       cfg.AIIdleTimeout,
+		MaxOutputLines:    cfg.AIMaxOutputLines,
+		OutputLogDir:      cfg.OutputLogDir,
+		OutputLogMaxBytes: int64(cfg.OutputLogMaxMB) << 20,
+		BinaryOutputMode:  cfg.AIBinaryOutput,
+		IncludeThinking:   cfg.AIThinking,
+		BashPolicy:        bashPolicy,
+		Egress:            egress,
 	}
 	aiAgent := agent.NewClaudeAgent(agentCfg, logger.With("component", "agent"))
 
 	return &Executor{
-		rdb:       rdb,
-		cfg:       cfg,
-		decryptor: decryptor,
-		agent:     aiAgent,
-		logger:    logger,
+		rdb:          rdb,
+		cfg:          cfg,
+		decryptor:    decryptor,
+		tokens:       tokens,
+		agent:        aiAgent,
+		seq:          rediskeys.NewBatchedOutputSequencer(rdb, cfg.OutputBatchSize, cfg.OutputBatchInterval),
+		redactor:     redactor,
+		topics:       topics.NewClient(),
+		identity:     identity.NewClient(),
+		logger:       logger,
+		instructions: instructions,
+		cliArgs:      cliArgs,
 	}, nil
 }
 
-// Execute runs a job
-func (e *Executor) Execute(ctx context.Context, msg *worker.JobMessage) error {
+// Execute runs a job. Returns ErrJobRunning without touching the job when
+// another worker is already executing it.
+func (e *Executor) Execute(ctx context.Context, msg *worker.JobMessage) (retErr error) {
+	release, err := e.acquireJobLock(ctx, msg.Job.ID, jobLockTTL, jobLockHeartbeat)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if msg.Action == worker.ActionRetryPush {
+		return e.RetryPush(ctx, msg)
+	}
+
 	j := msg.Job
-	logger := e.logger.With("job_id", j.ID, "user_id", j.UserID, "repo", j.RepoName)
+	// The enqueuer may have left out the display name
+	derivedName := j.RepoName == ""
+	if derivedName {
+		j.RepoName = git.RepoDisplayName(j.RepoURL, e.cfg.RepoNameFullPath)
+	}
 
-	// Create timeout context
+	traceID := trace.NewID()
+	ctx = trace.WithID(ctx, traceID)
+	ctx, span := telemetry.Start(ctx, "job", attribute.String("job.id", j.ID), attribute.String("repo", j.RepoName))
+	defer func() { telemetry.End(span, retErr) }()
+	logger := e.logger.With("job_id", j.ID, "user_id", j.UserID, "repo", j.RepoName, "trace_id", traceID)
+	defer e.seq.Forget(rediskeys.JobOutputKey(j.ID))
+
+	// Create timeout context, also cancelled when the workdir outgrows its quota
+	// or an operator cancels the job
 	jobCtx, cancel := context.WithTimeout(ctx, e.cfg.JobTimeout)
 	defer cancel()
+	jobCtx, cancelJob := context.WithCancelCause(jobCtx)
+	defer cancelJob(nil)
 
 	// Update job status to running
-	if err := e.updateJobStatus(jobCtx, j.ID, job.StatusRunning, map[string]interface{}{
+	running := map[string]interface{}{
 		"startedAt": time.Now().UnixMilli(),
-	}); err != nil {
+	}
+	if derivedName && j.RepoName != "" {
+		running["repo_name"] = j.RepoName
+	}
+	if err := e.updateJobStatus(jobCtx, j.ID, job.StatusRunning, running); err != nil {
 		return fmt.Errorf("failed to update status to running: %w", err)
 	}
+	stopCancelWatch := watchCancel(jobCtx, cancelJob, e.rdb, j.ID, cancelPollInterval)
+	defer stopCancelWatch()
+
+	// Reject an oversized prompt before cloning; control characters would corrupt the output
+	j.Prompt = agent.SanitizePrompt(j.Prompt)
+	if err := agent.CheckPromptLength(j.Prompt, e.cfg.MaxPromptLength); err != nil {
+		return e.failJob(jobCtx, j.ID, job.Wrap(job.ErrCodePromptTooLong, err))
+	}
 
 	// Create temp directory for this job
 	workDir := filepath.Join(e.cfg.TempDir, j.ID)
 	if err := os.MkdirAll(workDir, 0755); err != nil {
-		return e.failJob(jobCtx, j.ID, fmt.Errorf("failed to create work dir: %w", err))
+		return e.failJob(jobCtx, j.ID, job.Wrap(job.ErrCodeWorkdir, fmt.Errorf("failed to create work dir: %w", err)))
 	}
 
-	// Cleanup temp dir when done
+	if e.cfg.JobMaxWorkdirMB > 0 {
+		stop := watchWorkdirSize(jobCtx, cancelJob, workDir, int64(e.cfg.JobMaxWorkdirMB)<<20, workdirSampleInterval)
+		defer stop()
+	}
+
+	// Cleanup temp dir when done, unless a failed push left committed work to retry
+	keepWorkDir := false
 	if e.cfg.CleanupAfterJob {
 		defer func() {
+			if keepWorkDir {
+				logger.Info("keeping work dir for push retry", "path", workDir)
+				return
+			}
 			if err := os.RemoveAll(workDir); err != nil {
 				logger.Warn("failed to cleanup work dir", "error", err)
 			}
@@ -91,86 +200,236 @@ func (e *Executor) Execute(ctx context.Context, msg *worker.JobMessage) error {
 	// Get provider info
 	provider, err := e.getProviderInfo(jobCtx, j.UserID, msg.ProviderID)
 	if err != nil {
-		return e.failJob(jobCtx, j.ID, fmt.Errorf("failed to get provider: %w", err))
+		return e.failJob(jobCtx, j.ID, job.Wrap(job.ErrCodeProvider, fmt.Errorf("failed to get provider: %w", err)))
+	}
+
+	// Secrets the job exposes to the agent's commands, loaded before any work starts
+	secretValues, err := secrets.Load(jobCtx, e.rdb, e.decryptor, j.UserID, msg.Secrets)
+	if err != nil {
+		return e.failJob(jobCtx, j.ID, job.Wrap(job.ErrCodeSecret, err))
 	}
 
 	logger.Info("starting job execution")
-	e.appendOutput(jobCtx, j.ID, "stdout", "runner", "Starting job execution...")
+	e.appendPrompt(jobCtx, j.ID, j.Prompt)
+	e.appendOutput(jobCtx, j.ID, "stdout", agent.SourceRunner, "Starting job execution...")
+
+	// Fail fast when the repository is missing or the token can't reach it
+	if err := mergerequest.CheckRepo(jobCtx, mergerequest.ProviderType(provider.Type), provider.URL, provider.Token, j.RepoURL); err != nil {
+		if code, ok := job.PreflightErrorCode(err); ok {
+			return e.failJob(jobCtx, j.ID, job.Wrap(code, fmt.Errorf("repository check failed: %w", err)))
+		}
+		logger.Warn("repository preflight check failed, cloning anyway", "error", err)
+	}
 
 	// Clone repository
 	logger.Info("cloning repository")
-	e.appendOutput(jobCtx, j.ID, "stdout", "runner", fmt.Sprintf("Cloning %s...", j.RepoURL))
+	e.appendOutput(jobCtx, j.ID, "stdout", agent.SourceRunner, fmt.Sprintf("Cloning %s...", j.RepoURL))
 
 	g := git.NewWithOptions(git.Options{
 		Token:       provider.Token,
+		TokenSource: provider.TokenSource,
 		AuthorName:  e.cfg.GitAuthorName,
-		AuthorEmail: e.cfg.GitAuthorEmail,
+		AuthorEmail: e.authorEmail(jobCtx, j.ID, provider),
+		CacheDir:    e.cfg.CloneCacheDir,
+		Author:      identity.CommitAuthor(jobCtx, e.rdb, logger, msg.Job.UserID, msg.UserName, msg.UserEmail),
+		Submodules:  e.cfg.CloneSubmodules,
+		Protected:   e.cfg.ProtectedBranches,
+		Filter:      e.commitFilter(jobCtx, j.ID),
 	})
 	repoPath := filepath.Join(workDir, "repo")
-	if err := g.Clone(jobCtx, j.RepoURL, repoPath); err != nil {
-		return e.failJob(jobCtx, j.ID, fmt.Errorf("clone failed: %w", err))
+	activity.SetPhase(jobCtx, activity.PhaseClone)
+	cloneCtx, cloneSpan := telemetry.Start(jobCtx, "git.clone")
+	err = g.Clone(cloneCtx, j.RepoURL, repoPath)
+	telemetry.End(cloneSpan, err)
+	if err != nil {
+		return e.failJob(jobCtx, j.ID, job.Wrap(job.GitErrorCode(job.ErrCodeClone, err), fmt.Errorf("clone failed: %w", err)))
 	}
 
-	e.appendOutput(jobCtx, j.ID, "stdout", "runner", "Clone completed.")
+	e.appendOutput(jobCtx, j.ID, "stdout", agent.SourceRunner, "Clone completed.")
+
+	// Work from a pinned commit, tag or branch when the job asks for one
+	var pinnedCommit string
+	if msg.Ref != "" {
+		e.appendOutput(jobCtx, j.ID, "stdout", agent.SourceRunner, fmt.Sprintf("Checking out %s...", msg.Ref))
+		pinnedCommit, err = g.CheckoutRef(jobCtx, repoPath, msg.Ref)
+		if err != nil {
+			return e.failJob(jobCtx, j.ID, job.Wrap(job.ErrCodeBranch, fmt.Errorf("checkout ref failed: %w", err)))
+		}
+		e.appendOutput(jobCtx, j.ID, "stdout", agent.SourceRunner, fmt.Sprintf("Pinned to commit %s", util.SafePrefix(pinnedCommit, 12)))
+	}
+
+	// Load the repository's own settings, if it has any
+	repoCfg, err := repoconfig.Load(repoPath)
+	if err != nil {
+		return e.failJob(jobCtx, j.ID, job.Wrap(job.ErrCodeRepoConfig, err))
+	}
 
 	// Detect default branch
-	defaultBranch, err := g.GetDefaultBranch(jobCtx, repoPath)
+	defaultBranch, err := job.DefaultBranch(jobCtx, g, repoPath, provider.Type, provider.URL, provider.Token, j.RepoURL)
 	if err != nil {
-		defaultBranch = "main" // Fallback
+		logger.Warn("default branch unknown", "error", err)
 	}
 
-	// Create working branch
+	// Refuse to work on a branch the policy forbids before the agent runs;
+	// an unknown default branch fails closed
 	branchName := fmt.Sprintf("repobox/%s", util.SafePrefix(j.ID, 8))
+	policy := git.BranchPolicy{ForbidDefault: e.cfg.ForbidDefaultBranch, Protected: e.cfg.ProtectedBranches}
+	if err := policy.Check(branchName, defaultBranch); err != nil {
+		return e.failJob(jobCtx, j.ID, job.Wrap(job.ErrCodeBranchPolicy, err))
+	}
+	if defaultBranch == "" {
+		defaultBranch = "main"
+	}
+
+	if repoCfg.BaseBranch != "" && repoCfg.BaseBranch != defaultBranch && pinnedCommit == "" {
+		e.appendOutput(jobCtx, j.ID, "stdout", agent.SourceRunner, fmt.Sprintf("Using base branch %s from %s", repoCfg.BaseBranch, repoconfig.FileName))
+		if err := g.Checkout(jobCtx, repoPath, repoCfg.BaseBranch); err != nil {
+			return e.failJob(jobCtx, j.ID, job.Wrap(job.ErrCodeBranch, fmt.Errorf("checkout base branch failed: %w", err)))
+		}
+		defaultBranch = repoCfg.BaseBranch
+	}
+
+	// Scope the agent to a subdirectory; git still works from the repository root
+	agentDir, err := git.ResolveSubdir(repoPath, msg.WorkSubdir)
+	if err != nil {
+		return e.failJob(jobCtx, j.ID, job.Wrap(job.ErrCodeWorkSubdir, err))
+	}
+	if agentDir != repoPath {
+		e.appendOutput(jobCtx, j.ID, "stdout", agent.SourceRunner, fmt.Sprintf("Running agent in %s", msg.WorkSubdir))
+	}
+
+	// Create working branch
 	logger.Info("creating branch", "branch", branchName)
-	e.appendOutput(jobCtx, j.ID, "stdout", "runner", fmt.Sprintf("Creating branch %s...", branchName))
+	e.appendOutput(jobCtx, j.ID, "stdout", agent.SourceRunner, fmt.Sprintf("Creating branch %s...", branchName))
 
-	if err := g.CreateBranch(jobCtx, repoPath, branchName); err != nil {
-		return e.failJob(jobCtx, j.ID, fmt.Errorf("create branch failed: %w", err))
+	workBranch, err := g.CreateWorkBranch(jobCtx, repoPath, branchName, e.cfg.BranchCollision)
+	if err != nil {
+		return e.failJob(jobCtx, j.ID, job.Wrap(job.ErrCodeBranch, fmt.Errorf("create branch failed: %w", err)))
 	}
+	switch {
+	case workBranch.Reused:
+		e.appendOutput(jobCtx, j.ID, "stdout", agent.SourceRunner, fmt.Sprintf("Branch %s already exists, continuing on it", branchName))
+	case workBranch.Lease != "":
+		e.appendOutput(jobCtx, j.ID, "stdout", agent.SourceRunner, fmt.Sprintf("Branch %s already exists on the remote and will be replaced", branchName))
+	case workBranch.Name != branchName:
+		e.appendOutput(jobCtx, j.ID, "stdout", agent.SourceRunner, fmt.Sprintf("Branch %s already exists, using %s", branchName, workBranch.Name))
+		// The suffixed name gets the same policy check
+		if err := policy.Check(workBranch.Name, defaultBranch); err != nil {
+			return e.failJob(jobCtx, j.ID, job.Wrap(job.ErrCodeBranchPolicy, err))
+		}
+	}
+	branchName = workBranch.Name
 
 	// Execute AI agent
-	logger.Info("executing AI agent", "environment", j.Environment)
-	e.appendOutput(jobCtx, j.ID, "stdout", "runner", "Executing AI agent...")
-
-	// Create output callback that streams to Redis
+	environment := e.selectEnvironment(jobCtx, j, provider)
+	logger.Info("executing AI agent", "environment", environment)
+	e.appendOutput(jobCtx, j.ID, "stdout", agent.SourceRunner, "Executing AI agent...")
+
+	// Create output callback that streams to Redis, masking the provider token
+	// and secret values in addition to the patterns appendOutput always redacts.
+	// Long lines are shortened after redaction so no secret is cut in half.
+	tokenRedactor := e.redactor.WithValues(append([]string{provider.Token}, secrets.Values(secretValues)...)...)
 	outputCallback := func(stream string, source agent.OutputSource, line string) {
-		e.appendOutput(jobCtx, j.ID, stream, string(source), line)
+		e.appendOutput(jobCtx, j.ID, stream, source, util.TruncateMiddle(tokenRedactor.Redact(line), e.cfg.AIMaxLineLength))
 	}
 
 	agentOpts := agent.ExecuteOptions{
-		WorkDir:     repoPath,
-		Prompt:      j.Prompt,
-		Environment: j.Environment,
-		JobID:       j.ID,
-		Output:      outputCallback,
+		WorkDir:      agentDir,
+		Prompt:       j.Prompt,
+		SystemPrompt: e.instructions.For(environment),
+		ExtraArgs:    e.cliArgs.For(environment),
+		Env:          secrets.Env(secretValues),
+		Environment:  environment,
+		JobID:        j.ID,
+		RunnerID:     e.cfg.RunnerID,
+		TraceID:      traceID,
+		Output:       outputCallback,
+		Redact:       tokenRedactor.Redact,
+	}
+	if e.cfg.AIToolResults {
+		agentOpts.OnToolResult = func(stream, toolUseID, summary, content string) {
+			e.appendToolResult(jobCtx, j.ID, stream, toolUseID, tokenRedactor.Redact(summary), tokenRedactor.Redact(content))
+		}
+	}
+	if agentOpts.SystemPrompt != "" {
+		e.appendOutput(jobCtx, j.ID, "stdout", agent.SourceRunner, fmt.Sprintf("Adding system instructions for environment %s", environment))
+	}
+	if len(msg.Secrets) > 0 {
+		e.appendOutput(jobCtx, j.ID, "stdout", agent.SourceRunner, fmt.Sprintf("Injecting secrets: %s", strings.Join(msg.Secrets, ", ")))
 	}
 
-	if err := e.agent.Execute(jobCtx, agentOpts); err != nil {
-		return e.failJob(jobCtx, j.ID, fmt.Errorf("agent execution failed: %w", err))
+	// The commit the agent starts on, so its own commits are checked too
+	startCommit, err := g.HeadCommit(jobCtx, repoPath)
+	if err != nil {
+		logger.Warn("failed to record start commit", "error", err)
+	}
+
+	activity.SetPhase(jobCtx, activity.PhaseAgent)
+	agentCtx, agentSpan := telemetry.Start(jobCtx, "agent.run", attribute.String("environment", environment))
+	agentResult, err := e.executeAgent(agentCtx, g, j.ID, repoPath, agentOpts)
+	telemetry.End(agentSpan, err)
+	e.recordAgentUsage(jobCtx, j.ID, agentResult)
+	if err != nil {
+		return e.failJob(jobCtx, j.ID, job.Wrap(job.AgentErrorCode(err), fmt.Errorf("agent execution failed: %w", err)))
+	}
+
+	if err := e.checkProtectedPaths(jobCtx, g, repoPath, startCommit, repoCfg); err != nil {
+		return e.failJob(jobCtx, j.ID, err)
+	}
+
+	if repoCfg.ValidationCommand != "" {
+		logger.Info("running validation command")
+		activity.SetPhase(jobCtx, activity.PhaseValidate)
+		e.appendOutput(jobCtx, j.ID, "stdout", agent.SourceRunner, fmt.Sprintf("Running validation: %s", repoCfg.ValidationCommand))
+		if err := e.runValidation(jobCtx, j.ID, repoPath, repoCfg.ValidationCommand, tokenRedactor); err != nil {
+			return e.failJob(jobCtx, j.ID, job.Wrap(job.ErrCodeValidation, err))
+		}
 	}
 
 	// Commit changes
 	logger.Info("committing changes")
-	e.appendOutput(jobCtx, j.ID, "stdout", "runner", "Committing changes...")
-
-	commitMsg := fmt.Sprintf("repobox: %s", truncateString(j.Prompt, 50))
-	if err := g.Commit(jobCtx, repoPath, commitMsg); err != nil {
-		return e.failJob(jobCtx, j.ID, fmt.Errorf("commit failed: %w", err))
+	e.appendOutput(jobCtx, j.ID, "stdout", agent.SourceRunner, "Committing changes...")
+
+	// The agent's final summary is the fallback commit message
+	commitMsg := e.commitMessage(jobCtx, j.ID, agentDir, j.Prompt, agentResult.Summary)
+	activity.SetPhase(jobCtx, activity.PhaseCommit)
+	commitCtx, commitSpan := telemetry.Start(jobCtx, "git.commit")
+	err = e.commitChanges(commitCtx, g, j.ID, repoPath, commitMsg)
+	telemetry.End(commitSpan, err)
+	if err != nil {
+		return e.failJob(jobCtx, j.ID, job.Wrap(job.ErrCodeCommit, fmt.Errorf("commit failed: %w", err)))
 	}
 
-	// Get diff stats
-	linesAdded, linesRemoved, _ := g.GetDiffStats(jobCtx, repoPath, defaultBranch)
+	// Get diff stats, against the pinned commit so only the agent's changes count
+	diffBase := defaultBranch
+	if pinnedCommit != "" {
+		diffBase = pinnedCommit
+	}
+	diff, err := g.GetDiffSummary(jobCtx, repoPath, diffBase)
+	if err != nil {
+		// Stats are informational - report zero rather than failing the job
+		logger.Warn("failed to get diff summary", "error", err)
+		e.appendOutput(jobCtx, j.ID, "stderr", agent.SourceRunner, fmt.Sprintf("Could not compute diff stats, reporting 0 changed lines: %s", err))
+	}
+	linesAdded, linesRemoved := diff.LinesAdded, diff.LinesRemoved
 
 	// Push branch
 	logger.Info("pushing branch")
-	e.appendOutput(jobCtx, j.ID, "stdout", "runner", "Pushing to remote...")
+	e.appendOutput(jobCtx, j.ID, "stdout", agent.SourceRunner, "Pushing to remote...")
 
-	if err := g.Push(jobCtx, repoPath, branchName); err != nil {
-		return e.failJob(jobCtx, j.ID, fmt.Errorf("push failed: %w", err))
+	activity.SetPhase(jobCtx, activity.PhasePush)
+	pushCtx, pushSpan := telemetry.Start(jobCtx, "git.push")
+	err = g.PushWithLease(pushCtx, repoPath, branchName, workBranch.Lease)
+	telemetry.End(pushSpan, err)
+	if err != nil {
+		// The agent's work is committed locally - keep it so the push can be retried
+		keepWorkDir = true
+		e.markPushRetryable(jobCtx, j.ID, branchName, workBranch.Lease, linesAdded, linesRemoved)
+		return e.failJob(jobCtx, j.ID, job.Wrap(job.GitErrorCode(job.ErrCodePush, err), fmt.Errorf("push failed: %w", err)))
 	}
 
-	e.appendOutput(jobCtx, j.ID, "stdout", "runner", "Push completed successfully!")
-	e.appendOutput(jobCtx, j.ID, "stdout", "runner", fmt.Sprintf("Branch '%s' is ready. Create a pull request when you're satisfied with the changes.", branchName))
+	e.appendOutput(jobCtx, j.ID, "stdout", agent.SourceRunner, "Push completed successfully!")
+	e.appendOutput(jobCtx, j.ID, "stdout", agent.SourceRunner, fmt.Sprintf("Branch '%s' is ready. Create a pull request when you're satisfied with the changes.", branchName))
 
 	// Update job to success
 	updateFields := map[string]interface{}{
@@ -178,9 +437,23 @@ func (e *Executor) Execute(ctx context.Context, msg *worker.JobMessage) error {
 		"branch":       branchName,
 		"linesAdded":   linesAdded,
 		"linesRemoved": linesRemoved,
+
+		"files_changed": diff.FilesChanged,
+		"files_added":   diff.FilesAdded,
+		"files_deleted": diff.FilesDeleted,
+		"files_renamed": diff.FilesRenamed,
+	}
+	conflictFields, err := job.CheckMergeConflicts(jobCtx, g, repoPath, defaultBranch, func(line string) {
+		e.appendOutput(jobCtx, j.ID, "stderr", agent.SourceRunner, line)
+	})
+	if err != nil {
+		logger.Warn("merge conflict check failed", "error", err)
+	}
+	for k, v := range conflictFields {
+		updateFields[k] = v
 	}
 
-	if err := e.updateJobStatus(jobCtx, j.ID, job.StatusSuccess, updateFields); err != nil {
+	if err := e.updateJobStatus(jobCtx, j.ID, job.StatusSuccess, updateFields); err != nil && !errors.Is(err, job.ErrInvalidTransition) {
 		logger.Error("failed to update status to success", "error", err)
 	}
 
@@ -193,11 +466,265 @@ func (e *Executor) Execute(ctx context.Context, msg *worker.JobMessage) error {
 	return nil
 }
 
+// RetryPush pushes the branch kept from a job whose push failed, without re-running the agent
+func (e *Executor) RetryPush(ctx context.Context, msg *worker.JobMessage) (retErr error) {
+	j := msg.Job
+	if j.RepoName == "" {
+		j.RepoName = git.RepoDisplayName(j.RepoURL, e.cfg.RepoNameFullPath)
+	}
+	traceID := trace.NewID()
+	ctx = trace.WithID(ctx, traceID)
+	ctx, span := telemetry.Start(ctx, "job.retry_push", attribute.String("job.id", j.ID), attribute.String("repo", j.RepoName))
+	defer func() { telemetry.End(span, retErr) }()
+	logger := e.logger.With("job_id", j.ID, "user_id", j.UserID, "repo", j.RepoName, "trace_id", traceID)
+	defer e.seq.Forget(rediskeys.JobOutputKey(j.ID))
+
+	jobCtx, cancel := context.WithTimeout(ctx, e.cfg.JobTimeout)
+	defer cancel()
+
+	data, err := e.rdb.HGetAll(jobCtx, rediskeys.JobKey(j.ID)).Result()
+	if err != nil {
+		return fmt.Errorf("failed to load job: %w", err)
+	}
+	if data["push_retryable"] != "true" {
+		// Nothing to retry - leave the job as it is
+		return fmt.Errorf("job %s has no failed push to retry", j.ID)
+	}
+	branchName := data["branch"]
+
+	workDir := filepath.Join(e.cfg.TempDir, j.ID)
+	repoPath := filepath.Join(workDir, "repo")
+	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
+		e.rdb.HDel(jobCtx, rediskeys.JobKey(j.ID), "push_retryable")
+		return e.failJob(jobCtx, j.ID, job.Wrap(job.ErrCodeWorkdir, fmt.Errorf("work dir no longer available, re-run the job")))
+	}
+
+	if err := e.updateJobStatus(jobCtx, j.ID, job.StatusRunning, nil); err != nil {
+		return fmt.Errorf("failed to update status to running: %w", err)
+	}
+
+	provider, err := e.getProviderInfo(jobCtx, j.UserID, msg.ProviderID)
+	if err != nil {
+		return e.failJob(jobCtx, j.ID, job.Wrap(job.ErrCodeProvider, fmt.Errorf("failed to get provider: %w", err)))
+	}
+
+	logger.Info("retrying push", "branch", branchName)
+	e.appendOutput(jobCtx, j.ID, "stdout", agent.SourceRunner, fmt.Sprintf("Retrying push of %s...", branchName))
+
+	g := git.NewWithOptions(git.Options{
+		Token:       provider.Token,
+		TokenSource: provider.TokenSource,
+		AuthorName:  e.cfg.GitAuthorName,
+		AuthorEmail: e.cfg.GitAuthorEmail,
+		Protected:   e.cfg.ProtectedBranches,
+	})
+	activity.SetPhase(jobCtx, activity.PhasePush)
+	pushCtx, pushSpan := telemetry.Start(jobCtx, "git.push")
+	err = g.PushWithLease(pushCtx, repoPath, branchName, data["push_lease"])
+	telemetry.End(pushSpan, err)
+	if err != nil {
+		// Work dir and retry flag stay in place for another attempt
+		return e.failJob(jobCtx, j.ID, job.Wrap(job.GitErrorCode(job.ErrCodePush, err), fmt.Errorf("push failed: %w", err)))
+	}
+
+	e.appendOutput(jobCtx, j.ID, "stdout", agent.SourceRunner, "Push completed successfully!")
+
+	if err := e.updateJobStatus(jobCtx, j.ID, job.StatusSuccess, map[string]interface{}{
+		"finishedAt":    time.Now().UnixMilli(),
+		"errorMessage":  "",
+		"errorCode":     "",
+		"pushRetryable": "",
+	}); err != nil && !errors.Is(err, job.ErrInvalidTransition) {
+		logger.Error("failed to update status to success", "error", err)
+	}
+
+	if e.cfg.CleanupAfterJob {
+		if err := os.RemoveAll(workDir); err != nil {
+			logger.Warn("failed to cleanup work dir", "error", err)
+		}
+	}
+
+	logger.Info("push retry succeeded", "branch", branchName)
+	return nil
+}
+
+// selectEnvironment picks the environment from repository topics when the job left
+// the choice to the runner and a topic mapping is configured
+func (e *Executor) selectEnvironment(ctx context.Context, j *job.Job, provider *providerInfo) string {
+	if len(e.cfg.TopicEnvironments) == 0 || !topics.IsAutoEnvironment(j.Environment) {
+		return j.Environment
+	}
+
+	projectID, err := mergerequest.ExtractProjectID(j.RepoURL)
+	if err != nil {
+		e.logger.Warn("failed to extract project ID for topics", "job_id", j.ID, "error", err)
+		return j.Environment
+	}
+
+	repoTopics, err := e.topics.Fetch(ctx, provider.Type, provider.URL, provider.Token, projectID)
+	if err != nil {
+		e.logger.Warn("failed to fetch repository topics", "job_id", j.ID, "error", err)
+		return j.Environment
+	}
+
+	env := topics.SelectEnvironment(repoTopics, e.cfg.TopicEnvironments)
+	if env == "" {
+		return j.Environment
+	}
+	e.appendOutput(ctx, j.ID, "stdout", agent.SourceRunner, fmt.Sprintf("Selected environment %s from repository topics", env))
+	return env
+}
+
+// authorEmail returns the commit email for the job: the provider account's
+// verified email when enabled for the provider type, otherwise the configured bot email
+func (e *Executor) authorEmail(ctx context.Context, jobID string, provider *providerInfo) string {
+	email, err := e.identity.AuthorEmail(ctx, e.cfg.GitEmailFromProvider, e.cfg.GitAuthorEmail, provider.Type, provider.URL, provider.Token)
+	if err != nil {
+		e.logger.Warn("failed to look up provider account email", "job_id", jobID, "error", err)
+		e.appendOutput(ctx, jobID, "stderr", agent.SourceRunner, fmt.Sprintf("Could not look up provider account email, committing as %s", email))
+	}
+	return email
+}
+
+// commitChanges commits the agent's work, split into several commits when the
+// agent left a commit manifest. Falls back to a single commit otherwise.
+func (e *Executor) commitChanges(ctx context.Context, g *git.Git, jobID, repoPath, message string) error {
+	groups, err := git.ReadCommitManifest(repoPath)
+	if err != nil {
+		e.appendOutput(ctx, jobID, "stderr", agent.SourceRunner, fmt.Sprintf("Ignoring commit manifest: %s", err))
+	}
+	if len(groups) == 0 {
+		return g.Commit(ctx, repoPath, message)
+	}
+
+	e.appendOutput(ctx, jobID, "stdout", agent.SourceRunner, fmt.Sprintf("Splitting changes into %d commits from %s...", len(groups), git.CommitManifestFile))
+	if err := g.CommitGroups(ctx, repoPath, groups, message); err != nil {
+		e.appendOutput(ctx, jobID, "stderr", agent.SourceRunner, fmt.Sprintf("Commit manifest failed, committing remaining changes together: %s", err))
+		return g.Commit(ctx, repoPath, message)
+	}
+	return nil
+}
+
+// commitMessage reads the commit message the agent proposed in
+// git.CommitMessageFile in agentDir and picks the job's message with selectCommitMessage
+func (e *Executor) commitMessage(ctx context.Context, jobID, agentDir, prompt, summary string) string {
+	fileMsg, err := git.ReadCommitMessage(agentDir)
+	if err != nil {
+		e.appendOutput(ctx, jobID, "stderr", agent.SourceRunner, fmt.Sprintf("Ignoring commit message file: %s", err))
+	}
+	if fileMsg != "" {
+		e.appendOutput(ctx, jobID, "stdout", agent.SourceRunner, fmt.Sprintf("Using commit message from %s", git.CommitMessageFile))
+	}
+	return selectCommitMessage(fileMsg, summary, prompt)
+}
+
+// selectCommitMessage returns the agent's proposed message if it wrote one,
+// else the first line of its result summary, else the prompt-based default
+func selectCommitMessage(fileMsg, summary, prompt string) string {
+	if fileMsg != "" {
+		return fileMsg
+	}
+	if subject, _, _ := strings.Cut(git.SanitizeCommitMessage(summary), "\n"); subject != "" {
+		return subject
+	}
+	return fmt.Sprintf("repobox: %s", truncateString(prompt, 50))
+}
+
+// executeAgent runs the agent, re-running it from a clean checkout of the work
+// branch when the CLI fails with a transient error, up to AIMaxRetries times.
+// The result is the last attempt's.
+func (e *Executor) executeAgent(ctx context.Context, g *git.Git, jobID, repoPath string, opts agent.ExecuteOptions) (*agent.Result, error) {
+	var startCommit string
+	if e.cfg.AIMaxRetries > 0 {
+		var err error
+		if startCommit, err = g.HeadCommit(ctx, repoPath); err != nil {
+			e.logger.Warn("failed to record start commit, agent retries disabled", "job_id", jobID, "error", err)
+		}
+	}
+
+	policy := agent.RetryPolicy{ExitCodes: e.cfg.AIRetryExitCodes}
+	for attempt := 1; ; attempt++ {
+		res, err := agent.ExecuteWithHeartbeat(ctx, e.agent, opts, e.cfg.AIHeartbeat)
+		if err == nil || startCommit == "" || attempt > e.cfg.AIMaxRetries || !policy.IsRetryable(err) {
+			return res, err
+		}
+
+		e.logger.Warn("agent failed with a transient error, retrying", "job_id", jobID, "attempt", attempt, "error", err)
+		e.appendOutput(ctx, jobID, "stderr", agent.SourceRunner, fmt.Sprintf("Agent failed with a transient error, retrying (%d/%d)...", attempt, e.cfg.AIMaxRetries))
+
+		// Start the next attempt from the work branch as it was before the agent ran
+		if resetErr := g.ResetHard(ctx, repoPath, startCommit); resetErr != nil {
+			return res, fmt.Errorf("%w (reset before retry failed: %v)", err, resetErr)
+		}
+	}
+}
+
+// commitFilter leaves the files COMMIT_MAX_FILE_MB and COMMIT_DENY_PATTERNS
+// exclude out of the job's commits, reporting each one in the output
+func (e *Executor) commitFilter(ctx context.Context, jobID string) *git.CommitFilter {
+	return git.NewCommitFilter(e.cfg.CommitMaxFileMB, e.cfg.CommitDenyPatterns, func(path, reason string) {
+		e.logger.Warn("file left out of commit", "job_id", jobID, "path", path, "reason", reason)
+		e.appendOutput(ctx, jobID, "stderr", agent.SourceRunner, fmt.Sprintf("Not committing %s (%s)", path, reason))
+	})
+}
+
+// recordAgentUsage stores the agent's reported usage on the job, also when it failed
+func (e *Executor) recordAgentUsage(ctx context.Context, jobID string, res *agent.Result) {
+	fields := res.StatusFields()
+	if fields == nil {
+		return
+	}
+	if err := e.rdb.HSet(ctx, rediskeys.JobKey(jobID), fields).Err(); err != nil {
+		e.logger.Warn("failed to record agent usage", "job_id", jobID, "error", err)
+	}
+}
+
+// runValidation runs the repository's validation command, streaming its
+// output as SourceValidate lines so the UI can tell them from the agent's
+func (e *Executor) runValidation(ctx context.Context, jobID, repoPath, command string, redactor *redact.Redactor) error {
+	return repoconfig.RunValidation(ctx, repoPath, command, func(line string) {
+		e.appendOutput(ctx, jobID, "stdout", agent.SourceValidate, util.TruncateMiddle(redactor.Redact(line), e.cfg.AIMaxLineLength))
+	})
+}
+
+// checkProtectedPaths fails when the agent changed a path the repository
+// protects since startCommit, in its own commits or uncommitted
+func (e *Executor) checkProtectedPaths(ctx context.Context, g *git.Git, repoPath, startCommit string, repoCfg *repoconfig.Config) error {
+	if len(repoCfg.ProtectedPaths) == 0 {
+		return nil
+	}
+
+	changed, err := g.ChangedFilesSince(ctx, repoPath, startCommit)
+	if err != nil {
+		return job.Wrap(job.ErrCodeProtected, fmt.Errorf("failed to check protected paths: %w", err))
+	}
+	if violations := repoCfg.ProtectedViolations(changed); len(violations) > 0 {
+		return job.Wrap(job.ErrCodeProtected, fmt.Errorf("agent modified protected paths: %s", strings.Join(violations, ", ")))
+	}
+	return nil
+}
+
+// markPushRetryable records what a push retry needs once the agent's work is committed but not pushed
+func (e *Executor) markPushRetryable(ctx context.Context, jobID, branchName, lease string, linesAdded, linesRemoved int) {
+	err := e.rdb.HSet(ctx, rediskeys.JobKey(jobID), map[string]interface{}{
+		"push_retryable": "true",
+		"branch":         branchName,
+		"push_lease":     lease,
+		"lines_added":    linesAdded,
+		"lines_removed":  linesRemoved,
+		"workdir_runner": e.cfg.RunnerID,
+	}).Err()
+	if err != nil {
+		e.logger.Error("failed to mark push as retryable", "job_id", jobID, "error", err)
+	}
+}
+
 // providerInfo holds provider data needed for job execution
 type providerInfo struct {
-	Token string // Decrypted token
-	Type  string // "gitlab" or "github"
-	URL   string // Base URL (e.g., https://gitlab.com)
+	Token       string          // Decrypted token
+	TokenSource git.TokenSource // Mints fresh tokens for GitHub App providers, nil otherwise
+	Type        string          // "gitlab" or "github"
+	URL         string          // Base URL (e.g., https://gitlab.com)
 }
 
 // getProviderInfo fetches provider details including decrypted token
@@ -229,17 +756,30 @@ func (e *Executor) getProviderInfo(ctx context.Context, userID, providerID strin
 		"type", data["type"],
 		"url", data["url"],
 		"has_token", data["token"] != "",
+		"auth_type", data["auth_type"],
 	)
 
-	encryptedToken, ok := data["token"]
-	if !ok {
-		return nil, fmt.Errorf("token not found for provider: %s", providerID)
+	if data["auth_type"] == mergerequest.AuthTypeGitHubApp {
+		source, err := mergerequest.GitHubAppFromProvider(data, e.decryptor.Decrypt)
+		if err != nil {
+			return nil, err
+		}
+		token, err := source.Token(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get GitHub App installation token: %w", err)
+		}
+		return &providerInfo{
+			Token:       token,
+			TokenSource: source,
+			Type:        data["type"],
+			URL:         data["url"],
+		}, nil
 	}
 
-	token, err := e.decryptor.Decrypt(encryptedToken)
+	token, err := e.tokens.Get(ctx, userID, providerID)
 	if err != nil {
-		e.logger.Debug("failed to decrypt token", "error", err)
-		return nil, fmt.Errorf("failed to decrypt token: %w", err)
+		e.logger.Debug("failed to get provider token", "error", err)
+		return nil, err
 	}
 
 	e.logger.Debug("provider info loaded successfully",
@@ -255,14 +795,10 @@ func (e *Executor) getProviderInfo(ctx context.Context, userID, providerID strin
 }
 
 
-// updateJobStatus updates job status in Redis
+// updateJobStatus updates job status in Redis. A change the job's current
+// status doesn't allow is refused with job.ErrInvalidTransition.
 func (e *Executor) updateJobStatus(ctx context.Context, jobID string, status job.Status, fields map[string]interface{}) error {
-	key := rediskeys.JobKey(jobID)
-
-	updates := map[string]interface{}{
-		"status": string(status),
-	}
-
+	updates := make(map[string]interface{}, len(fields))
 	for k, v := range fields {
 		// Convert field names to snake_case for Redis
 		redisKey := toSnakeCase(k)
@@ -278,36 +814,73 @@ func (e *Executor) updateJobStatus(ctx context.Context, jobID string, status job
 		}
 	}
 
-	return e.rdb.HSet(ctx, key, updates).Err()
+	policy := rediskeys.StatusRetry
+	if status.IsTerminal() {
+		policy = rediskeys.TerminalRetry
+	}
+	err := rediskeys.Retry(ctx, policy, func(ctx context.Context) error {
+		// Batched output lines land before the status the UI reacts to; lines
+		// that fail stay buffered for the next try
+		_ = e.seq.Flush(ctx, rediskeys.JobOutputKey(jobID))
+		return rediskeys.SetJobStatus(ctx, e.rdb, jobID, status, updates)
+	})
+	if errors.Is(err, job.ErrInvalidTransition) {
+		e.logger.Warn("refused job status change", "job_id", jobID, "error", err)
+	}
+	return err
 }
 
-// failJob marks a job as failed and logs the error
+// failJob marks a job as failed, or cancelled when an operator cancelled it,
+// and logs the error
 func (e *Executor) failJob(ctx context.Context, jobID string, err error) error {
-	e.appendOutput(ctx, jobID, "stderr", "runner", fmt.Sprintf("Error: %s", err.Error()))
+	// Whatever step noticed the cancellation, the quota or the operator is what
+	// stopped the job
+	status := job.StatusFailed
+	switch cause := context.Cause(ctx); {
+	case errors.Is(cause, ErrWorkdirLimit):
+		err = job.Wrap(job.ErrCodeWorkdir, cause)
+	case errors.Is(cause, ErrJobCancelled):
+		err = job.Wrap(job.ErrCodeCancelled, cause)
+		status = job.StatusCancelled
+	}
+
+	e.appendOutput(ctx, jobID, "stderr", agent.SourceRunner, fmt.Sprintf("Error: %s", err.Error()))
 
-	updateErr := e.updateJobStatus(ctx, jobID, job.StatusFailed, map[string]interface{}{
+	updateErr := e.updateJobStatus(ctx, jobID, status, map[string]interface{}{
 		"finishedAt":   time.Now().UnixMilli(),
 		"errorMessage": err.Error(),
+		"errorCode":    string(job.CodeOf(err)),
 	})
-	if updateErr != nil {
-		e.logger.Error("failed to update job status to failed", "job_id", jobID, "error", updateErr)
+	if updateErr != nil && !errors.Is(updateErr, job.ErrInvalidTransition) {
+		e.logger.Error("failed to update job status", "job_id", jobID, "status", status, "error", updateErr)
 	}
 
 	return err
 }
 
 // appendOutput adds output line to job output list
-func (e *Executor) appendOutput(ctx context.Context, jobID, stream, source, line string) {
-	key := rediskeys.JobOutputKey(jobID)
-	output := map[string]interface{}{
-		"timestamp": time.Now().UnixMilli(),
-		"line":      line,
-		"stream":    stream,
-		"source":    source,
-	}
-	data, _ := json.Marshal(output)
-	e.rdb.RPush(ctx, key, string(data))
-	e.rdb.Expire(ctx, key, 24*time.Hour)
+func (e *Executor) appendOutput(ctx context.Context, jobID, stream string, source agent.OutputSource, line string) {
+	joboutput.NewWriter(e.rdb, e.seq, e.redactor, 24*time.Hour).Append(ctx, rediskeys.JobOutputKey(jobID), stream, source, line, nil)
+}
+
+// appendToolResult stores the full content of a tool result, capped at
+// AI_TOOL_RESULT_MAX_LENGTH, and adds its summary line, capped at
+// AI_MAX_LINE_LENGTH, linked to it
+func (e *Executor) appendToolResult(ctx context.Context, jobID, stream, toolUseID, summary, content string) {
+	w := joboutput.NewWriter(e.rdb, e.seq, e.redactor, 24*time.Hour)
+	err := w.AppendToolResult(ctx, rediskeys.JobOutputKey(jobID), rediskeys.JobToolResultsKey(jobID), stream, toolUseID, util.TruncateMiddle(summary, e.cfg.AIMaxLineLength), content, e.cfg.AIToolResultMax)
+	if err != nil {
+		e.logger.Warn("failed to store tool result", "job_id", jobID, "tool_use_id", toolUseID, "error", err)
+	}
+}
+
+// appendPrompt records the prompt in the job output when enabled, so the
+// transcript is self-contained for audit
+func (e *Executor) appendPrompt(ctx context.Context, jobID, prompt string) {
+	if !e.cfg.OutputIncludePrompt {
+		return
+	}
+	e.appendOutput(ctx, jobID, "stdout", agent.SourcePrompt, prompt)
 }
 
 // toSnakeCase converts camelCase to snake_case
@@ -0,0 +1,413 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/agent"
+	"github.com/repobox/runner/internal/config"
+	"github.com/repobox/runner/internal/git"
+	"github.com/repobox/runner/internal/identity"
+	"github.com/repobox/runner/internal/job"
+	"github.com/repobox/runner/internal/redact"
+	rediskeys "github.com/repobox/runner/internal/redis"
+	"github.com/repobox/runner/internal/worker"
+)
+
+func newTestExecutor(t *testing.T, cfg *config.Config) (*Executor, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	redactor, err := redact.New(nil, true)
+	if err != nil {
+		t.Fatalf("redact.New() error = %v", err)
+	}
+
+	return &Executor{
+		rdb:      rdb,
+		cfg:      cfg,
+		seq:      rediskeys.NewOutputSequencer(rdb),
+		redactor: redactor,
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}, rdb
+}
+
+func readOutput(t *testing.T, rdb *redis.Client, jobID string) []map[string]interface{} {
+	t.Helper()
+	raw, err := rdb.LRange(context.Background(), rediskeys.JobOutputKey(jobID), 0, -1).Result()
+	if err != nil {
+		t.Fatalf("LRange() error = %v", err)
+	}
+
+	entries := make([]map[string]interface{}, 0, len(raw))
+	for _, r := range raw {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(r), &entry); err != nil {
+			t.Fatalf("invalid output entry %q: %v", r, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestAppendPrompt(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		want    int
+	}{
+		{"enabled", true, 2},
+		{"disabled", false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, rdb := newTestExecutor(t, &config.Config{OutputIncludePrompt: tt.enabled})
+			ctx := context.Background()
+
+			e.appendPrompt(ctx, "job-1", "Add a README")
+			e.appendOutput(ctx, "job-1", "stdout", "runner", "Starting job execution...")
+
+			entries := readOutput(t, rdb, "job-1")
+			if len(entries) != tt.want {
+				t.Fatalf("got %d entries, want %d", len(entries), tt.want)
+			}
+
+			first := entries[0]
+			if tt.enabled {
+				if first["source"] != "prompt" || first["line"] != "Add a README" {
+					t.Errorf("first entry = %v, want prompt entry", first)
+				}
+			} else if first["source"] == "prompt" {
+				t.Errorf("prompt entry present while disabled: %v", first)
+			}
+		})
+	}
+}
+
+func TestExecute_ErrorCode(t *testing.T) {
+	// A regular file where the work dir root should be makes MkdirAll fail
+	blocked := filepath.Join(t.TempDir(), "blocked")
+	if err := os.WriteFile(blocked, nil, 0644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		tempDir string
+		want    job.ErrorCode
+	}{
+		{"work dir not creatable", blocked, job.ErrCodeWorkdir},
+		{"provider missing", t.TempDir(), job.ErrCodeProvider},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, rdb := newTestExecutor(t, &config.Config{TempDir: tt.tempDir, JobTimeout: time.Minute})
+			ctx := context.Background()
+
+			err := e.Execute(ctx, &worker.JobMessage{
+				Job:        &job.Job{ID: "job-1", UserID: "user-1"},
+				ProviderID: "missing",
+			})
+			if err == nil {
+				t.Fatal("Execute() expected error")
+			}
+
+			data, _ := rdb.HGetAll(ctx, rediskeys.JobKey("job-1")).Result()
+			if data["status"] != string(job.StatusFailed) {
+				t.Errorf("status = %q, want failed", data["status"])
+			}
+			if data["error_code"] != string(tt.want) {
+				t.Errorf("error_code = %q, want %q", data["error_code"], tt.want)
+			}
+			if data["error_message"] != err.Error() {
+				t.Errorf("error_message = %q, want %q", data["error_message"], err.Error())
+			}
+		})
+	}
+}
+
+func TestAppendOutput_Sequence(t *testing.T) {
+	e, rdb := newTestExecutor(t, &config.Config{})
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		stream := "stdout"
+		if i%2 == 1 {
+			stream = "stderr"
+		}
+		e.appendOutput(ctx, "job-1", stream, "claude", fmt.Sprintf("line %d", i))
+	}
+
+	var last float64
+	for i, entry := range readOutput(t, rdb, "job-1") {
+		seq, ok := entry["seq"].(float64)
+		if !ok {
+			t.Fatalf("entry %d has no seq: %v", i, entry)
+		}
+		if seq <= last {
+			t.Errorf("entry %d seq = %v, want > %v", i, seq, last)
+		}
+		last = seq
+	}
+}
+
+func TestAppendOutput_RedactsSecrets(t *testing.T) {
+	e, rdb := newTestExecutor(t, &config.Config{})
+	ctx := context.Background()
+
+	secret := "ghp_" + strings.Repeat("a", 36)
+	e.appendOutput(ctx, "job-1", "stdout", "claude", "export GITHUB_TOKEN="+secret)
+
+	entries := readOutput(t, rdb, "job-1")
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	line, _ := entries[0]["line"].(string)
+	if strings.Contains(line, secret) {
+		t.Errorf("stored line %q contains the secret", line)
+	}
+	if !strings.HasPrefix(line, "export GITHUB_TOKEN=ghp_") {
+		t.Errorf("stored line = %q, want masked token after the variable name", line)
+	}
+}
+
+func TestRunValidation_OutputSource(t *testing.T) {
+	e, rdb := newTestExecutor(t, &config.Config{})
+	ctx := context.Background()
+
+	redactor := e.redactor.WithValues("s3cretvalue")
+	err := e.runValidation(ctx, "job-1", t.TempDir(), "echo tests passed; echo token s3cretvalue >&2", redactor)
+	if err != nil {
+		t.Fatalf("runValidation() error = %v", err)
+	}
+
+	entries := readOutput(t, rdb, "job-1")
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	for _, entry := range entries {
+		if entry["source"] != string(agent.SourceValidate) {
+			t.Errorf("entry %v source = %v, want %q", entry["line"], entry["source"], agent.SourceValidate)
+		}
+		if line, _ := entry["line"].(string); strings.Contains(line, "s3cretvalue") {
+			t.Errorf("stored line %q contains the secret", line)
+		}
+	}
+}
+
+func TestSelectCommitMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		fileMsg string
+		summary string
+		want    string
+	}{
+		{"file wins", "Add retry to uploader\n\nDetails.", "I added a retry.", "Add retry to uploader\n\nDetails."},
+		{"summary first line", "", "\n  Added a retry to the uploader.  \n\nIt now retries three times.", "Added a retry to the uploader."},
+		{"default", "", "", "repobox: Fix the flaky upload"},
+		{"blank summary", "", " \n\t", "repobox: Fix the flaky upload"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selectCommitMessage(tt.fileMsg, tt.summary, "Fix the flaky upload"); got != tt.want {
+				t.Errorf("selectCommitMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommitMessage_File(t *testing.T) {
+	e, rdb := newTestExecutor(t, &config.Config{})
+	ctx := context.Background()
+	repo := t.TempDir()
+	path := filepath.Join(repo, git.CommitMessageFile)
+	if err := os.WriteFile(path, []byte("Add retry to uploader   \n"), 0644); err != nil {
+		t.Fatalf("failed to write commit message file: %v", err)
+	}
+
+	if got := e.commitMessage(ctx, "job-1", repo, "Fix the flaky upload", "Summary"); got != "Add retry to uploader" {
+		t.Errorf("commitMessage() = %q, want the file's message", got)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("commit message file was not removed")
+	}
+	if entries := readOutput(t, rdb, "job-1"); len(entries) != 1 || !strings.Contains(entries[0]["line"].(string), git.CommitMessageFile) {
+		t.Errorf("output = %v, want a line naming the commit message file", entries)
+	}
+
+	// Without the file the summary is used
+	if got := e.commitMessage(ctx, "job-1", repo, "Fix the flaky upload", "Summary"); got != "Summary" {
+		t.Errorf("commitMessage() = %q, want the summary", got)
+	}
+}
+
+// flakyRedis fails the next n commands and pipelines like a dropped connection
+type flakyRedis struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (f *flakyRedis) fail() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.n > 0 {
+		f.n--
+		return io.EOF
+	}
+	return nil
+}
+
+func (f *flakyRedis) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (f *flakyRedis) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := f.fail(); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (f *flakyRedis) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if err := f.fail(); err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		return next(ctx, cmds)
+	}
+}
+
+func TestFailJob_TransientRedisErrors(t *testing.T) {
+	e, rdb := newTestExecutor(t, &config.Config{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // a cancelled job still reports its final status
+
+	// The error line and the first status write hit the outage: sequence
+	// lookup, output write, then flush and status script of the first try
+	rdb.AddHook(&flakyRedis{n: 4})
+	e.failJob(ctx, "job-1", job.Wrap(job.ErrCodeAgent, fmt.Errorf("agent exited with code 1")))
+
+	status, err := rdb.HGet(context.Background(), rediskeys.JobKey("job-1"), "status").Result()
+	if err != nil {
+		t.Fatalf("HGet() error = %v", err)
+	}
+	if status != string(job.StatusFailed) {
+		t.Errorf("status = %q, want %q", status, job.StatusFailed)
+	}
+
+	entries := readOutput(t, rdb, "job-1")
+	if len(entries) != 1 || !strings.HasPrefix(entries[0]["line"].(string), "Error: ") {
+		t.Errorf("output = %v, want the buffered error line", entries)
+	}
+}
+
+func TestFailJob_AfterSuccess(t *testing.T) {
+	e, rdb := newTestExecutor(t, &config.Config{})
+	ctx := context.Background()
+	rdb.HSet(ctx, rediskeys.JobKey("job-1"), "status", string(job.StatusSuccess))
+
+	// A late error must not clobber the finished job
+	e.failJob(ctx, "job-1", job.Wrap(job.ErrCodeInternal, fmt.Errorf("late cleanup error")))
+
+	data, _ := rdb.HGetAll(ctx, rediskeys.JobKey("job-1")).Result()
+	if data["status"] != string(job.StatusSuccess) || data["error_message"] != "" {
+		t.Errorf("job hash = %v, want success left untouched", data)
+	}
+}
+
+// fakeTokenSource serves tokens from a map keyed by provider ID
+type fakeTokenSource map[string]string
+
+func (f fakeTokenSource) Get(ctx context.Context, userID, providerID string) (string, error) {
+	token, ok := f[providerID]
+	if !ok {
+		return "", fmt.Errorf("no token for %s", providerID)
+	}
+	return token, nil
+}
+
+func TestGetProviderInfo_TokenSource(t *testing.T) {
+	e, rdb := newTestExecutor(t, &config.Config{})
+	e.tokens = fakeTokenSource{"prov-1": "from-vault"}
+	ctx := context.Background()
+
+	// The hash keeps type and URL, the token lives in the external source
+	rdb.HSet(ctx, rediskeys.GitProviderKey("user-1", "prov-1"), "type", "gitlab", "url", "https://gitlab.example.com")
+	rdb.HSet(ctx, rediskeys.GitProviderKey("user-1", "prov-2"), "type", "gitlab")
+
+	info, err := e.getProviderInfo(ctx, "user-1", "prov-1")
+	if err != nil {
+		t.Fatalf("getProviderInfo() error = %v", err)
+	}
+	if info.Token != "from-vault" || info.Type != "gitlab" || info.URL != "https://gitlab.example.com" {
+		t.Errorf("getProviderInfo() = %+v, want the source's token with the hash's type and URL", info)
+	}
+
+	if _, err := e.getProviderInfo(ctx, "user-1", "prov-2"); err == nil {
+		t.Error("getProviderInfo() error = nil, want the source's error")
+	}
+}
+
+func TestAuthorEmail(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v4/user" || r.Header.Get("PRIVATE-TOKEN") != "gl-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"id": 1, "email": "dev@example.com", "commit_email": "dev@example.com"}`))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		enabled    []string
+		token      string
+		want       string
+		wantOutput int
+	}{
+		{"disabled", nil, "gl-token", "bot@repobox.cloud", 0},
+		{"other provider enabled", []string{"github"}, "gl-token", "bot@repobox.cloud", 0},
+		{"enabled", []string{"gitlab"}, "gl-token", "dev@example.com", 0},
+		{"lookup fails", []string{"gitlab"}, "bad-token", "bot@repobox.cloud", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, rdb := newTestExecutor(t, &config.Config{
+				GitAuthorEmail:       "bot@repobox.cloud",
+				GitEmailFromProvider: tt.enabled,
+			})
+			e.identity = identity.NewClient()
+
+			provider := &providerInfo{Token: tt.token, Type: "gitlab", URL: srv.URL}
+			if got := e.authorEmail(context.Background(), "job-1", provider); got != tt.want {
+				t.Errorf("authorEmail() = %q, want %q", got, tt.want)
+			}
+			if got := len(readOutput(t, rdb, "job-1")); got != tt.wantOutput {
+				t.Errorf("output entries = %d, want %d", got, tt.wantOutput)
+			}
+		})
+	}
+}
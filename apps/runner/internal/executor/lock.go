@@ -0,0 +1,89 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	rediskeys "github.com/repobox/runner/internal/redis"
+)
+
+// ErrJobRunning is returned by Execute when another worker holds the job's
+// execution lock, e.g. for a message reclaimed while the original run is
+// still going. The message must be left pending for that worker to ACK.
+var ErrJobRunning = errors.New("job is already running")
+
+// Job execution lock timing: the TTL frees the lock of a runner that died,
+// the heartbeat keeps it held while the job runs
+const (
+	jobLockTTL       = 60 * time.Second
+	jobLockHeartbeat = 20 * time.Second
+)
+
+// refreshJobLockScript extends the lock only if it is still held by the caller's token
+var refreshJobLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseJobLockScript deletes the lock only if it is still held by the caller's token
+var releaseJobLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// acquireJobLock takes the job's execution lock and keeps refreshing it every
+// heartbeat until the returned release is called. Returns ErrJobRunning when
+// the lock is held elsewhere.
+func (e *Executor) acquireJobLock(ctx context.Context, jobID string, ttl, heartbeat time.Duration) (release func(), err error) {
+	key := rediskeys.JobLockKey(jobID)
+	token := fmt.Sprintf("%s:%d", e.cfg.RunnerID, time.Now().UnixNano())
+	acquired, err := e.rdb.SetNX(ctx, key, token, ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire job lock: %w", err)
+	}
+	if !acquired {
+		return nil, ErrJobRunning
+	}
+
+	// Kept refreshed while the job winds down after a shutdown
+	lockCtx := context.WithoutCancel(ctx)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			held, err := refreshJobLockScript.Run(lockCtx, e.rdb, []string{key}, token, ttl.Milliseconds()).Int()
+			if err != nil {
+				// Retried on the next tick, before the TTL runs out
+				e.logger.Warn("failed to refresh job lock", "job_id", jobID, "error", err)
+			} else if held == 0 {
+				e.logger.Warn("job lock lost, a redelivered message may run the job again", "job_id", jobID)
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+		if err := releaseJobLockScript.Run(lockCtx, e.rdb, []string{key}, token).Err(); err != nil {
+			e.logger.Warn("failed to release job lock", "job_id", jobID, "error", err)
+		}
+	}, nil
+}
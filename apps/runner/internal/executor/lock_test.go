@@ -0,0 +1,109 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/config"
+	"github.com/repobox/runner/internal/job"
+	rediskeys "github.com/repobox/runner/internal/redis"
+	"github.com/repobox/runner/internal/worker"
+)
+
+func TestAcquireJobLock(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	first := &Executor{rdb: rdb, cfg: &config.Config{RunnerID: "runner-1"}, logger: logger}
+	second := &Executor{rdb: rdb, cfg: &config.Config{RunnerID: "runner-2"}, logger: logger}
+	ctx := context.Background()
+	key := rediskeys.JobLockKey("job-1")
+
+	release, err := first.acquireJobLock(ctx, "job-1", time.Second, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("acquireJobLock() error = %v", err)
+	}
+
+	// A redelivery on this or another runner finds the job running
+	for _, e := range []*Executor{first, second} {
+		if _, err := e.acquireJobLock(ctx, "job-1", time.Second, 10*time.Millisecond); !errors.Is(err, ErrJobRunning) {
+			t.Errorf("acquireJobLock() of a held lock error = %v, want ErrJobRunning", err)
+		}
+	}
+
+	// The heartbeat keeps the lock alive past its TTL
+	mr.FastForward(800 * time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	mr.FastForward(800 * time.Millisecond)
+	if !mr.Exists(key) {
+		t.Fatal("job lock expired while the job was running")
+	}
+
+	release()
+	if mr.Exists(key) {
+		t.Error("job lock still held after release")
+	}
+	release2, err := second.acquireJobLock(ctx, "job-1", time.Second, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("acquireJobLock() after release error = %v", err)
+	}
+	defer release2()
+}
+
+func TestAcquireJobLock_ReleaseAfterExpiry(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	e := &Executor{rdb: rdb, cfg: &config.Config{RunnerID: "runner-1"}, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	ctx := context.Background()
+
+	release, err := e.acquireJobLock(ctx, "job-1", time.Second, time.Hour)
+	if err != nil {
+		t.Fatalf("acquireJobLock() error = %v", err)
+	}
+
+	// The runner stalled, the lock expired and a redelivery took it over
+	mr.FastForward(2 * time.Second)
+	if err := rdb.Set(ctx, rediskeys.JobLockKey("job-1"), "runner-2:1", time.Minute).Err(); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	// The late release leaves the new holder's lock alone
+	release()
+	if got, _ := mr.Get(rediskeys.JobLockKey("job-1")); got != "runner-2:1" {
+		t.Errorf("job lock = %q after a late release, want the new holder's", got)
+	}
+}
+
+func TestExecute_AlreadyRunning(t *testing.T) {
+	e, rdb := newTestExecutor(t, &config.Config{RunnerID: "runner-2", JobTimeout: time.Minute})
+	ctx := context.Background()
+	rdb.HSet(ctx, rediskeys.JobKey("job-1"), "id", "job-1", "status", "running")
+	rdb.Set(ctx, rediskeys.JobLockKey("job-1"), "runner-1:1", time.Minute)
+
+	for _, action := range []string{"", worker.ActionRetryPush} {
+		msg := &worker.JobMessage{Job: &job.Job{ID: "job-1", UserID: "user-1"}, Action: action}
+		if err := e.Execute(ctx, msg); !errors.Is(err, ErrJobRunning) {
+			t.Errorf("Execute(action %q) error = %v, want ErrJobRunning", action, err)
+		}
+	}
+
+	// The running job is left as it is
+	data, _ := rdb.HGetAll(ctx, rediskeys.JobKey("job-1")).Result()
+	if data["status"] != "running" || data["error_code"] != "" {
+		t.Errorf("job hash = %v, want it untouched", data)
+	}
+	if n, _ := rdb.LLen(ctx, rediskeys.JobOutputKey("job-1")).Result(); n != 0 {
+		t.Errorf("job output has %d lines, want none", n)
+	}
+	if got, _ := rdb.Get(ctx, rediskeys.JobLockKey("job-1")).Result(); got != "runner-1:1" {
+		t.Errorf("job lock = %q, want it still held by runner-1", got)
+	}
+}
@@ -0,0 +1,73 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+// ErrWorkdirLimit is the cancellation cause of a job whose workdir outgrew JOB_MAX_WORKDIR_MB
+var ErrWorkdirLimit = errors.New("workdir size limit exceeded")
+
+// workdirSampleInterval is how often a job's workdir size is sampled
+const workdirSampleInterval = 5 * time.Second
+
+// errSizeOverLimit stops a size walk once the limit is passed
+var errSizeOverLimit = errors.New("size over limit")
+
+// watchWorkdirSize samples the size of dir every interval and cancels the job
+// through cancel, with an ErrWorkdirLimit cause, once it exceeds limit bytes.
+// The returned stop ends the monitor and waits for it to exit.
+func watchWorkdirSize(ctx context.Context, cancel context.CancelCauseFunc, dir string, limit int64, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if dirSizeOver(dir, limit) {
+				cancel(fmt.Errorf("%w (over %d MB)", ErrWorkdirLimit, limit>>20))
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// dirSizeOver reports whether the regular files under dir add up to more than
+// limit bytes, stopping the walk once they do. Files that vanish mid-walk are skipped.
+func dirSizeOver(dir string, limit int64) bool {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		size += info.Size()
+		if size > limit {
+			return errSizeOverLimit
+		}
+		return nil
+	})
+	return errors.Is(err, errSizeOverLimit)
+}
@@ -0,0 +1,118 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/repobox/runner/internal/config"
+	"github.com/repobox/runner/internal/job"
+	rediskeys "github.com/repobox/runner/internal/redis"
+)
+
+func TestWatchWorkdirSize(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "small"), make([]byte, 512), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	stop := watchWorkdirSize(ctx, cancel, dir, 4096, 10*time.Millisecond)
+	defer stop()
+
+	// Under the limit the job keeps running
+	time.Sleep(50 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Fatalf("job cancelled under the limit: %v", context.Cause(ctx))
+	}
+
+	// The agent writes past the limit in a nested directory
+	if err := os.MkdirAll(filepath.Join(dir, "build", "out"), 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "build", "out", "blob"), make([]byte, 8192), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("job not cancelled after the workdir grew past the limit")
+	}
+	if cause := context.Cause(ctx); !errors.Is(cause, ErrWorkdirLimit) {
+		t.Errorf("cancel cause = %v, want ErrWorkdirLimit", cause)
+	}
+}
+
+func TestWatchWorkdirSize_Stop(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	stop := watchWorkdirSize(ctx, cancel, dir, 1024, 10*time.Millisecond)
+	stop()
+
+	// Growth after stop no longer cancels the job
+	if err := os.WriteFile(filepath.Join(dir, "blob"), make([]byte, 4096), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Errorf("job cancelled after the monitor stopped: %v", context.Cause(ctx))
+	}
+}
+
+func TestDirSizeOver(t *testing.T) {
+	dir := t.TempDir()
+	writeSized := func(name string, size int) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+	writeSized("a", 600)
+	writeSized("sub/b", 600)
+
+	tests := []struct {
+		limit int64
+		want  bool
+	}{
+		{1000, true},
+		{1200, false},
+		{5000, false},
+	}
+	for _, tt := range tests {
+		if got := dirSizeOver(dir, tt.limit); got != tt.want {
+			t.Errorf("dirSizeOver(limit %d) = %v, want %v", tt.limit, got, tt.want)
+		}
+	}
+	if dirSizeOver(filepath.Join(dir, "missing"), 0) {
+		t.Error("dirSizeOver() of a missing dir = true, want false")
+	}
+}
+
+func TestFailJob_WorkdirLimit(t *testing.T) {
+	e, rdb := newTestExecutor(t, &config.Config{})
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(ErrWorkdirLimit)
+
+	// The step that noticed the cancellation reports its own error
+	err := e.failJob(ctx, "job-1", job.Wrap(job.ErrCodeAgent, errors.New("agent execution failed: signal: killed")))
+	if got := job.CodeOf(err); got != job.ErrCodeWorkdir {
+		t.Errorf("failJob() code = %q, want %q", got, job.ErrCodeWorkdir)
+	}
+
+	data, _ := rdb.HGetAll(context.Background(), rediskeys.JobKey("job-1")).Result()
+	if data["error_code"] != string(job.ErrCodeWorkdir) || !strings.Contains(data["error_message"], "workdir size limit exceeded") {
+		t.Errorf("job hash = %v, want the workdir limit error", data)
+	}
+}
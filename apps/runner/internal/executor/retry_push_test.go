@@ -0,0 +1,175 @@
+package executor
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/repobox/runner/internal/agent"
+	"github.com/repobox/runner/internal/config"
+	"github.com/repobox/runner/internal/crypto"
+	"github.com/repobox/runner/internal/job"
+	rediskeys "github.com/repobox/runner/internal/redis"
+	"github.com/repobox/runner/internal/tokensource"
+	"github.com/repobox/runner/internal/worker"
+)
+
+const testKeyHex = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+// encryptToken encrypts a token the way the web app stores it (iv:authTag:ciphertext)
+func encryptToken(t *testing.T, plaintext string) string {
+	t.Helper()
+	key, _ := hex.DecodeString(testKeyHex)
+
+	iv := make([]byte, 12)
+	if _, err := rand.Read(iv); err != nil {
+		t.Fatalf("rand.Read() error = %v", err)
+	}
+	block, _ := aes.NewCipher(key)
+	gcm, _ := cipher.NewGCMWithNonceSize(block, len(iv))
+	sealed := gcm.Seal(nil, iv, []byte(plaintext), nil)
+	tag, ciphertext := sealed[len(sealed)-16:], sealed[:len(sealed)-16]
+
+	return base64.StdEncoding.EncodeToString(iv) + ":" +
+		base64.StdEncoding.EncodeToString(tag) + ":" +
+		base64.StdEncoding.EncodeToString(ciphertext)
+}
+
+func runGit(t *testing.T, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %s: %v", args, output, err)
+	}
+}
+
+// initRemote creates a bare repository with one commit on main
+func initRemote(t *testing.T, path string) {
+	t.Helper()
+	runGit(t, "init", "--bare", path)
+	runGit(t, "--git-dir", path, "symbolic-ref", "HEAD", "refs/heads/main")
+
+	seed := filepath.Join(t.TempDir(), "seed")
+	runGit(t, "clone", path, seed)
+	if err := os.WriteFile(filepath.Join(seed, "README.md"), []byte("hello\n"), 0644); err != nil {
+		t.Fatalf("failed to write README: %v", err)
+	}
+	runGit(t, "-C", seed, "add", "-A")
+	runGit(t, "-C", seed, "commit", "-m", "initial")
+	runGit(t, "-C", seed, "push", "origin", "HEAD:main")
+}
+
+// editingAgent changes a file and then runs an optional hook (used to break the remote)
+type editingAgent struct {
+	after func()
+}
+
+func (a *editingAgent) Execute(ctx context.Context, opts agent.ExecuteOptions) (*agent.Result, error) {
+	if err := os.WriteFile(filepath.Join(opts.WorkDir, "CHANGE.md"), []byte("change\n"), 0644); err != nil {
+		return &agent.Result{ExitCode: 1}, err
+	}
+	if a.after != nil {
+		a.after()
+	}
+	return &agent.Result{}, nil
+}
+
+func TestExecute_PushFailureKeepsWorkDir(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	initRemote(t, remote)
+
+	cfg := &config.Config{
+		RunnerID:        "runner-1",
+		TempDir:         t.TempDir(),
+		CleanupAfterJob: true,
+		JobTimeout:      time.Minute,
+		GitAuthorName:   "Repobox Bot",
+		GitAuthorEmail:  "bot@repobox.cloud",
+	}
+	e, rdb := newTestExecutor(t, cfg)
+	decryptor, err := crypto.NewDecryptor(testKeyHex)
+	if err != nil {
+		t.Fatalf("NewDecryptor() error = %v", err)
+	}
+	e.decryptor = decryptor
+	e.tokens = tokensource.NewRedis(rdb, decryptor)
+	// Remote disappears after the agent runs, so the push fails
+	e.agent = &editingAgent{after: func() { os.RemoveAll(remote) }}
+
+	ctx := context.Background()
+	rdb.HSet(ctx, rediskeys.GitProviderKey("user-1", "provider-1"), map[string]interface{}{
+		"type":  "github",
+		"token": encryptToken(t, ""),
+	})
+
+	msg := &worker.JobMessage{
+		Job:        &job.Job{ID: "job-1", UserID: "user-1", RepoURL: remote, Prompt: "add a change"},
+		ProviderID: "provider-1",
+	}
+
+	if err := e.Execute(ctx, msg); err == nil {
+		t.Fatal("Execute() expected push error")
+	}
+
+	repoPath := filepath.Join(cfg.TempDir, "job-1", "repo")
+	if _, err := os.Stat(repoPath); err != nil {
+		t.Fatalf("work dir should be kept after push failure: %v", err)
+	}
+
+	data, _ := rdb.HGetAll(ctx, rediskeys.JobKey("job-1")).Result()
+	if data["status"] != string(job.StatusFailed) || data["push_retryable"] != "true" {
+		t.Errorf("status = %q, push_retryable = %q, want failed/true", data["status"], data["push_retryable"])
+	}
+	if data["error_code"] != string(job.ErrCodePush) {
+		t.Errorf("error_code = %q, want %q", data["error_code"], job.ErrCodePush)
+	}
+	if data["branch"] != "repobox/job-1" || data["workdir_runner"] != "runner-1" {
+		t.Errorf("branch = %q, workdir_runner = %q", data["branch"], data["workdir_runner"])
+	}
+
+	// Remote is back - retry pushes the kept branch without running the agent again
+	runGit(t, "init", "--bare", remote)
+	e.agent = &editingAgent{after: func() { t.Error("agent must not run on push retry") }}
+
+	msg.Action = worker.ActionRetryPush
+	if err := e.Execute(ctx, msg); err != nil {
+		t.Fatalf("RetryPush() error = %v", err)
+	}
+
+	data, _ = rdb.HGetAll(ctx, rediskeys.JobKey("job-1")).Result()
+	if data["status"] != string(job.StatusSuccess) || data["push_retryable"] == "true" {
+		t.Errorf("status = %q, push_retryable = %q, want success/cleared", data["status"], data["push_retryable"])
+	}
+	if _, err := os.Stat(filepath.Join(cfg.TempDir, "job-1")); !os.IsNotExist(err) {
+		t.Errorf("work dir should be removed after successful retry, stat error = %v", err)
+	}
+	runGit(t, "--git-dir", remote, "rev-parse", "--verify", "repobox/job-1")
+}
+
+func TestRetryPush_NothingToRetry(t *testing.T) {
+	e, rdb := newTestExecutor(t, &config.Config{TempDir: t.TempDir(), JobTimeout: time.Minute})
+	ctx := context.Background()
+	rdb.HSet(ctx, rediskeys.JobKey("job-1"), "status", string(job.StatusSuccess))
+
+	err := e.RetryPush(ctx, &worker.JobMessage{Job: &job.Job{ID: "job-1"}})
+	if err == nil {
+		t.Fatal("RetryPush() expected error for job without failed push")
+	}
+
+	status, _ := rdb.HGet(ctx, rediskeys.JobKey("job-1"), "status").Result()
+	if status != string(job.StatusSuccess) {
+		t.Errorf("status = %q, should be left untouched", status)
+	}
+}
@@ -0,0 +1,67 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// mockAgentFile is the file the mock agent (AI disabled) writes, agent.MockAgentFile
+const mockAgentFile = ".repobox-mock.md"
+
+// RunnerArtifacts are files the runner and its mock agent may leave in the
+// agent's working directory. ExcludeArtifacts keeps them out of every commit.
+var RunnerArtifacts = []string{mockAgentFile, CommitMessageFile, CommitManifestFile}
+
+// ExcludeArtifacts adds RunnerArtifacts to the repository's .git/info/exclude,
+// so "git add -A" and "git status" skip them at any depth, including in a
+// work subdirectory. Files the repository tracks are not affected. Entries
+// already present are not added again.
+func (g *Git) ExcludeArtifacts(ctx context.Context, repoPath string) error {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "rev-parse", "--git-path", "info/exclude")
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to locate info/exclude: %w", err)
+	}
+	path := strings.TrimSpace(string(output))
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(repoPath, path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read info/exclude: %w", err)
+	}
+	existing := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		existing[strings.TrimSpace(line)] = true
+	}
+
+	var missing []string
+	for _, name := range RunnerArtifacts {
+		// Unanchored, as the agent may run in a work subdirectory
+		if !existing[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	content := string(data)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	content += "# repobox runner files\n" + strings.Join(missing, "\n") + "\n"
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create info directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write info/exclude: %w", err)
+	}
+	return nil
+}
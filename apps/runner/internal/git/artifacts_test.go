@@ -0,0 +1,121 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// headFiles returns the files changed by the repository's HEAD commit
+func headFiles(t *testing.T, repo string) []string {
+	t.Helper()
+	output, err := exec.Command("git", "-C", repo, "show", "--name-only", "--format=", "HEAD").Output()
+	if err != nil {
+		t.Fatalf("git show failed: %v", err)
+	}
+	return strings.Fields(string(output))
+}
+
+func TestCommit_ExcludesArtifacts(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	ctx := context.Background()
+	repo := t.TempDir()
+	g := NewWithOptions(Options{AuthorName: "Repobox Bot", AuthorEmail: "bot@repobox.cloud"})
+
+	if output, err := exec.Command("git", "init", repo).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %s", output)
+	}
+	writeFile(t, filepath.Join(repo, "README.md"), "hello\n")
+	if err := g.Commit(ctx, repo, "initial"); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	// A tracked file of the same name belongs to the repository
+	writeFile(t, filepath.Join(repo, "docs", CommitManifestFile), "[]\n")
+	if err := exec.Command("git", "-C", repo, "add", "-f", "docs").Run(); err != nil {
+		t.Fatalf("git add failed: %v", err)
+	}
+	if err := g.Commit(ctx, repo, "docs"); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	// The runner's files next to the agent's real changes, in the repo root
+	// and in a work subdirectory
+	for _, name := range RunnerArtifacts {
+		writeFile(t, filepath.Join(repo, name), "runner\n")
+		writeFile(t, filepath.Join(repo, "services", "api", name), "runner\n")
+	}
+	writeFile(t, filepath.Join(repo, "README.md"), "changed\n")
+	writeFile(t, filepath.Join(repo, "docs", CommitManifestFile), "[{}]\n")
+
+	changed, err := g.ChangedFiles(ctx, repo)
+	if err != nil {
+		t.Fatalf("ChangedFiles() error = %v", err)
+	}
+	want := []string{"README.md", "docs/" + CommitManifestFile}
+	if !reflect.DeepEqual(changed, want) {
+		t.Errorf("ChangedFiles() = %q, want %q", changed, want)
+	}
+
+	if err := g.Commit(ctx, repo, "agent changes"); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if got := headFiles(t, repo); !reflect.DeepEqual(got, want) {
+		t.Errorf("committed files = %q, want %q", got, want)
+	}
+
+	// Amending stages the same way
+	writeFile(t, filepath.Join(repo, "b.txt"), "b\n")
+	writeFile(t, filepath.Join(repo, mockAgentFile), "runner again\n")
+	writeFile(t, filepath.Join(repo, "services", "api", mockAgentFile), "runner again\n")
+	if amended, err := g.Amend(ctx, repo); err != nil || !amended {
+		t.Fatalf("Amend() = %v, %v, want true", amended, err)
+	}
+	want = []string{"README.md", "b.txt", "docs/" + CommitManifestFile}
+	if got := headFiles(t, repo); !reflect.DeepEqual(got, want) {
+		t.Errorf("amended files = %q, want %q", got, want)
+	}
+}
+
+func TestExcludeArtifacts(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	ctx := context.Background()
+	repo := t.TempDir()
+	g := New()
+
+	if output, err := exec.Command("git", "init", repo).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %s", output)
+	}
+	excludePath := filepath.Join(repo, ".git", "info", "exclude")
+	if err := os.MkdirAll(filepath.Dir(excludePath), 0755); err != nil {
+		t.Fatalf("failed to create info dir: %v", err)
+	}
+	// An existing entry without a trailing newline
+	if err := os.WriteFile(excludePath, []byte("*.local\n"+CommitMessageFile), 0644); err != nil {
+		t.Fatalf("failed to write exclude: %v", err)
+	}
+
+	// Repeated calls add each entry once
+	for i := 0; i < 2; i++ {
+		if err := g.ExcludeArtifacts(ctx, repo); err != nil {
+			t.Fatalf("ExcludeArtifacts() error = %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(excludePath)
+	if err != nil {
+		t.Fatalf("failed to read exclude: %v", err)
+	}
+	want := "*.local\n" + CommitMessageFile + "\n# repobox runner files\n" + mockAgentFile + "\n" + CommitManifestFile + "\n"
+	if string(data) != want {
+		t.Errorf("info/exclude = %q, want %q", data, want)
+	}
+}
@@ -0,0 +1,43 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"path"
+)
+
+// ErrProtectedBranch is returned when a job or session would change a branch the policy forbids
+var ErrProtectedBranch = errors.New("direct changes to this branch are not allowed")
+
+// BranchPolicy decides which branches the runner may push to directly
+type BranchPolicy struct {
+	// ForbidDefault rejects the repository's default branch
+	ForbidDefault bool
+	// Protected are branch names or path.Match globs (e.g. "release/*") that are always rejected
+	Protected []string
+}
+
+// Check returns an error wrapping ErrProtectedBranch if branch may not be pushed to directly.
+// An empty defaultBranch means it couldn't be detected, which ForbidDefault rejects.
+func (p BranchPolicy) Check(branch, defaultBranch string) error {
+	if p.ForbidDefault && defaultBranch == "" {
+		return fmt.Errorf("%w: default branch unknown, can't tell whether %s is it", ErrProtectedBranch, branch)
+	}
+	if p.ForbidDefault && branch == defaultBranch {
+		return fmt.Errorf("%w: %s is the default branch, work must go through a feature branch and merge request", ErrProtectedBranch, branch)
+	}
+	if pattern, ok := matchProtected(p.Protected, branch); ok {
+		return fmt.Errorf("%w: %s is protected (%s)", ErrProtectedBranch, branch, pattern)
+	}
+	return nil
+}
+
+// matchProtected returns the first of patterns (names or path.Match globs) that branch matches
+func matchProtected(patterns []string, branch string) (string, bool) {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, branch); ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,59 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBranchPolicy_Check(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        BranchPolicy
+		branch        string
+		defaultBranch string
+		wantErr       bool
+	}{
+		{"no policy allows default", BranchPolicy{}, "main", "main", false},
+		{"feature branch allowed", BranchPolicy{ForbidDefault: true}, "repobox/abc12345", "main", false},
+		{"default forbidden", BranchPolicy{ForbidDefault: true}, "main", "main", true},
+		{"unknown default fails closed", BranchPolicy{ForbidDefault: true}, "repobox/abc12345", "", true},
+		{"unknown default without policy", BranchPolicy{}, "repobox/abc12345", "", false},
+		{"protected name", BranchPolicy{Protected: []string{"production"}}, "production", "main", true},
+		{"protected glob", BranchPolicy{Protected: []string{"release/*"}}, "release/1.2", "main", true},
+		{"glob stays in segment", BranchPolicy{Protected: []string{"release/*"}}, "release/1.2/hotfix", "main", false},
+		{"unprotected branch", BranchPolicy{ForbidDefault: true, Protected: []string{"release/*"}}, "develop", "main", false},
+		{"default set", BranchPolicy{Protected: []string{"main", "master"}}, "master", "main", true},
+		{"name is not a prefix", BranchPolicy{Protected: []string{"main"}}, "main-fix", "main", false},
+		{"glob needs a segment", BranchPolicy{Protected: []string{"release/*"}}, "release", "main", false},
+		{"wildcard prefix glob", BranchPolicy{Protected: []string{"hotfix-*"}}, "hotfix-42", "main", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(tt.branch, tt.defaultBranch)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrProtectedBranch) {
+				t.Errorf("Check() error = %v, want ErrProtectedBranch", err)
+			}
+		})
+	}
+}
+
+func TestPush_Protected(t *testing.T) {
+	g := NewWithOptions(Options{Protected: []string{"main", "release/*"}})
+
+	// Refused before git runs, so the repository doesn't need to exist
+	for _, branch := range []string{"main", "release/2.0"} {
+		err := g.Push(context.Background(), t.TempDir(), branch)
+		if !errors.Is(err, ErrProtectedBranch) {
+			t.Errorf("Push(%q) error = %v, want ErrProtectedBranch", branch, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), "refusing to push to protected branch "+branch) {
+			t.Errorf("Push(%q) error = %q, want a refusal naming the branch", branch, err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package git
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// cacheState is the condition of a repository's mirror in the clone cache
+type cacheState int
+
+const (
+	cacheMiss    cacheState = iota // No mirror yet
+	cacheHit                       // Usable bare mirror
+	cacheCorrupt                   // Directory exists but isn't a bare repository
+)
+
+// mirrorLocks serializes access to each mirror within the runner process
+var mirrorLocks sync.Map // mirror path -> *sync.Mutex
+
+func lockMirror(path string) func() {
+	mu, _ := mirrorLocks.LoadOrStore(path, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+// mirrorPath returns the cache directory of a repository. Spellings of the
+// same repository URL share one mirror.
+func mirrorPath(cacheDir, repoURL string) string {
+	normalized := NormalizeRepoURL(repoURL)
+	sum := sha256.Sum256([]byte(normalized))
+	name := filepath.Base(normalized)
+	return filepath.Join(cacheDir, fmt.Sprintf("%s-%s.git", name, hex.EncodeToString(sum[:8])))
+}
+
+// mirrorState reports whether path holds a usable bare mirror
+func (g *Git) mirrorState(ctx context.Context, path string) cacheState {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return cacheMiss
+	}
+	out, err := exec.CommandContext(ctx, "git", "-C", path, "rev-parse", "--is-bare-repository").Output()
+	if err != nil || strings.TrimSpace(string(out)) != "true" {
+		return cacheCorrupt
+	}
+	return cacheHit
+}
+
+// cloneFromCache updates (or creates) the repository's mirror in the cache
+// and clones destPath from it, pointing origin back at cloneURL
+func (g *Git) cloneFromCache(ctx context.Context, repoURL, cloneURL, destPath string) error {
+	if err := os.MkdirAll(g.cacheDir, 0755); err != nil {
+		return fmt.Errorf("failed to create clone cache dir: %w", err)
+	}
+
+	mirror := mirrorPath(g.cacheDir, repoURL)
+	unlock := lockMirror(mirror)
+	defer unlock()
+
+	switch g.mirrorState(ctx, mirror) {
+	case cacheCorrupt:
+		if err := os.RemoveAll(mirror); err != nil {
+			return fmt.Errorf("failed to remove corrupt mirror: %w", err)
+		}
+		if err := g.createMirror(ctx, cloneURL, mirror); err != nil {
+			return err
+		}
+	case cacheMiss:
+		if err := g.createMirror(ctx, cloneURL, mirror); err != nil {
+			return err
+		}
+	case cacheHit:
+		// The token is passed on each fetch rather than stored in the mirror
+		cmd := exec.CommandContext(ctx, "git", "-C", mirror, "fetch", "--prune", cloneURL,
+			"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("git fetch into mirror failed: %s: %w", maskTokenInString(string(output), g.token), err)
+		}
+	}
+
+	// A local clone hardlinks the mirror's objects, so the work tree stays
+	// valid when the mirror is later pruned or replaced
+	cmd := exec.CommandContext(ctx, "git", "clone", mirror, destPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git clone from mirror failed: %s: %w", output, err)
+	}
+	cmd = exec.CommandContext(ctx, "git", "-C", destPath, "remote", "set-url", "origin", cloneURL)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git remote set-url failed: %s: %w", maskTokenInString(string(output), g.token), err)
+	}
+	return nil
+}
+
+// createMirror clones the bare mirror and drops the credentials from its
+// remote. A bare clone (branches and tags) is used rather than --mirror, which
+// would also copy every pull/merge request ref.
+func (g *Git) createMirror(ctx context.Context, cloneURL, mirror string) error {
+	cmd := exec.CommandContext(ctx, "git", "clone", "--bare", cloneURL, mirror)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.RemoveAll(mirror)
+		return fmt.Errorf("git clone --bare failed: %s: %w", maskTokenInString(string(output), g.token), err)
+	}
+	cmd = exec.CommandContext(ctx, "git", "-C", mirror, "remote", "remove", "origin")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.RemoveAll(mirror)
+		return fmt.Errorf("git remote remove failed: %s: %w", output, err)
+	}
+	return nil
+}
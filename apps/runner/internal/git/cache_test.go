@@ -0,0 +1,136 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMirrorPath(t *testing.T) {
+	dir := "/cache"
+	a := mirrorPath(dir, "https://github.com/user/repo.git")
+	b := mirrorPath(dir, "https://token@GitHub.com/user/repo/")
+	c := mirrorPath(dir, "https://github.com/other/repo")
+
+	if a != b {
+		t.Errorf("mirrorPath() = %q and %q, want one mirror for both spellings", a, b)
+	}
+	if a == c {
+		t.Errorf("mirrorPath() = %q for different repositories", a)
+	}
+	if !strings.HasPrefix(filepath.Base(a), "repo-") || filepath.Dir(a) != dir {
+		t.Errorf("mirrorPath() = %q, want %s/repo-<hash>.git", a, dir)
+	}
+}
+
+func TestClone_Cache(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	ctx := context.Background()
+	g := NewWithOptions(Options{AuthorName: "Repobox Bot", AuthorEmail: "bot@repobox.cloud", CacheDir: t.TempDir()})
+	git := func(dir string, args ...string) string {
+		t.Helper()
+		output, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %s", args, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+	commit := func(dir, file, content string) string {
+		t.Helper()
+		writeFile(t, filepath.Join(dir, file), content)
+		if err := g.Commit(ctx, dir, "update "+file); err != nil {
+			t.Fatalf("Commit() error = %v", err)
+		}
+		return git(dir, "rev-parse", "HEAD")
+	}
+
+	originDir := t.TempDir()
+	originURL := "file://" + originDir
+	git(originDir, "init", "-b", "main")
+	commit(originDir, "a.txt", "one\n")
+
+	clone := func() string {
+		t.Helper()
+		dest := filepath.Join(t.TempDir(), "repo")
+		if err := g.Clone(ctx, originURL, dest); err != nil {
+			t.Fatalf("Clone() error = %v", err)
+		}
+		return dest
+	}
+
+	mirror := mirrorPath(g.cacheDir, originURL)
+	if state := g.mirrorState(ctx, mirror); state != cacheMiss {
+		t.Fatalf("mirrorState() before first clone = %v, want miss", state)
+	}
+
+	// Miss: the mirror is created and the clone tracks the real remote
+	repo := clone()
+	if state := g.mirrorState(ctx, mirror); state != cacheHit {
+		t.Fatalf("mirrorState() after first clone = %v, want hit", state)
+	}
+	if got := git(repo, "remote", "get-url", "origin"); got != originURL {
+		t.Errorf("origin = %q, want the repository URL", got)
+	}
+	if branch, err := g.DetectDefaultBranch(ctx, repo); err != nil || branch != "main" {
+		t.Errorf("DetectDefaultBranch() = %q, %v, want main", branch, err)
+	}
+
+	// Hit: the mirror is fetched, so new commits show up
+	head := commit(originDir, "b.txt", "two\n")
+	repo = clone()
+	if got := git(repo, "rev-parse", "HEAD"); got != head {
+		t.Errorf("HEAD after cached clone = %s, want %s", got, head)
+	}
+
+	// Corrupt: the mirror is rebuilt
+	if err := os.RemoveAll(filepath.Join(mirror, "objects")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(mirror, "HEAD")); err != nil {
+		t.Fatal(err)
+	}
+	if state := g.mirrorState(ctx, mirror); state != cacheCorrupt {
+		t.Fatalf("mirrorState() of broken mirror = %v, want corrupt", state)
+	}
+	repo = clone()
+	if got := git(repo, "rev-parse", "HEAD"); got != head {
+		t.Errorf("HEAD after rebuilt mirror = %s, want %s", got, head)
+	}
+	if state := g.mirrorState(ctx, mirror); state != cacheHit {
+		t.Errorf("mirrorState() after rebuild = %v, want hit", state)
+	}
+}
+
+func TestClone_CacheFallback(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	ctx := context.Background()
+
+	// An unusable cache dir (a file) falls back to a direct clone
+	cacheFile := filepath.Join(t.TempDir(), "cache")
+	writeFile(t, cacheFile, "not a directory")
+	g := NewWithOptions(Options{AuthorName: "Repobox Bot", AuthorEmail: "bot@repobox.cloud", CacheDir: cacheFile})
+
+	origin := t.TempDir()
+	if output, err := exec.Command("git", "-C", origin, "init", "-b", "main").CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %s", output)
+	}
+	writeFile(t, filepath.Join(origin, "a.txt"), "one\n")
+	if err := g.Commit(ctx, origin, "init"); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "repo")
+	if err := g.Clone(ctx, "file://"+origin, dest); err != nil {
+		t.Fatalf("Clone() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "a.txt")); err != nil {
+		t.Errorf("cloned file missing: %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// CommitMessageFile is the file the agent may write in its working directory to
+// propose the commit message
+const CommitMessageFile = ".repobox-commit-msg.txt"
+
+// maxCommitMessageFileSize caps CommitMessageFile; anything larger isn't a commit message
+const maxCommitMessageFileSize = 16 * 1024
+
+// MaxCommitSubjectLength caps the first line of agent-proposed commit messages
+const MaxCommitSubjectLength = 72
+
+// ReadCommitMessage loads the agent's proposed commit message from workDir, the
+// directory the agent ran in, sanitized with SanitizeCommitMessage. The file is
+// removed so it never ends up in a commit. Returns an empty message and no
+// error if there is no file.
+func ReadCommitMessage(workDir string) (string, error) {
+	path := filepath.Join(workDir, CommitMessageFile)
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read commit message file: %w", err)
+	}
+	defer os.Remove(path)
+
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("commit message file is not a regular file")
+	}
+	if info.Size() > maxCommitMessageFileSize {
+		return "", fmt.Errorf("commit message file is %d bytes, the limit is %d", info.Size(), maxCommitMessageFileSize)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read commit message file: %w", err)
+	}
+	return SanitizeCommitMessage(string(data)), nil
+}
+
+// SanitizeCommitMessage drops control characters and trailing whitespace,
+// removes leading and trailing blank lines, unindents the subject line and
+// caps it at MaxCommitSubjectLength characters. Returns "" if nothing is left.
+func SanitizeCommitMessage(msg string) string {
+	msg = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' || !unicode.IsControl(r) {
+			return r
+		}
+		return -1
+	}, msg)
+
+	lines := strings.Split(msg, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRightFunc(line, unicode.IsSpace)
+	}
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+
+	lines[0] = strings.TrimLeftFunc(lines[0], unicode.IsSpace)
+	if subject := []rune(lines[0]); len(subject) > MaxCommitSubjectLength {
+		lines[0] = strings.TrimRightFunc(string(subject[:MaxCommitSubjectLength-3]), unicode.IsSpace) + "..."
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,71 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeCommitMessage(t *testing.T) {
+	long := strings.Repeat("word ", 20)
+	tests := []struct {
+		name string
+		msg  string
+		want string
+	}{
+		{"plain", "Fix login redirect", "Fix login redirect"},
+		{"trailing whitespace", "Fix login redirect  \t\n\nExplain why.   \n\n\n", "Fix login redirect\n\nExplain why."},
+		{"leading blank lines", "\n\n  \n  Fix it", "Fix it"},
+		{"control characters", "Fix \x1b[31mlogin\x00\r\n\n\tindented body", "Fix [31mlogin\n\n\tindented body"},
+		{"long subject", long + "\n\nbody", strings.TrimSpace(long[:69]) + "...\n\nbody"},
+		{"long body kept", "Subject\n\n" + long, "Subject\n\n" + strings.TrimSpace(long)},
+		{"multibyte subject", strings.Repeat("é", 80), strings.Repeat("é", 69) + "..."},
+		{"only whitespace", " \n\t\n", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeCommitMessage(tt.msg); got != tt.want {
+				t.Errorf("SanitizeCommitMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadCommitMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		content *string
+		want    string
+		wantErr bool
+	}{
+		{"no file", nil, "", false},
+		{"message", ptr("Add retry to uploader\n\nUploads failed on flaky networks.  \n"), "Add retry to uploader\n\nUploads failed on flaky networks.", false},
+		{"empty file", ptr("\n  \n"), "", false},
+		{"too large", ptr(strings.Repeat("x", maxCommitMessageFileSize+1)), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := t.TempDir()
+			path := filepath.Join(repo, CommitMessageFile)
+			if tt.content != nil {
+				writeFile(t, path, *tt.content)
+			}
+
+			got, err := ReadCommitMessage(repo)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadCommitMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ReadCommitMessage() = %q, want %q", got, tt.want)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("commit message file still exists after reading")
+			}
+		})
+	}
+}
+
+func ptr(s string) *string { return &s }
@@ -0,0 +1,118 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// CommitFilter leaves files the agent added or changed out of commits: files
+// larger than MaxFileBytes and files matching a Deny glob. Skipped files stay
+// in the work tree. Deletions are always committed.
+type CommitFilter struct {
+	// MaxFileBytes is the largest file committed (0 = no limit)
+	MaxFileBytes int64
+
+	// Deny are path.Match globs. A glob without "/" matches any path
+	// segment ("*.exe", "node_modules"), one with "/" the path from the repo
+	// root or any of its leading directories ("build/out", "dist/*").
+	Deny []string
+
+	// OnSkip is called with each file left out of a commit and why (optional)
+	OnSkip func(path, reason string)
+}
+
+// NewCommitFilter returns a filter for the given limits, or nil when there is
+// nothing to filter
+func NewCommitFilter(maxFileMB int, deny []string, onSkip func(path, reason string)) *CommitFilter {
+	if maxFileMB <= 0 && len(deny) == 0 {
+		return nil
+	}
+	return &CommitFilter{
+		MaxFileBytes: int64(maxFileMB) * 1024 * 1024,
+		Deny:         deny,
+		OnSkip:       onSkip,
+	}
+}
+
+// reason returns why the repo-relative file is left out, or "" to commit it
+func (f *CommitFilter) reason(repoPath, file string) string {
+	if pattern := f.denied(file); pattern != "" {
+		return fmt.Sprintf("matches %q", pattern)
+	}
+	if f.MaxFileBytes > 0 {
+		info, err := os.Lstat(filepath.Join(repoPath, filepath.FromSlash(file)))
+		if err == nil && info.Mode().IsRegular() && info.Size() > f.MaxFileBytes {
+			return fmt.Sprintf("%d bytes, the limit is %d", info.Size(), f.MaxFileBytes)
+		}
+	}
+	return ""
+}
+
+// denied returns the first Deny glob matching file, or ""
+func (f *CommitFilter) denied(file string) string {
+	segments := strings.Split(file, "/")
+	for _, pattern := range f.Deny {
+		pattern = strings.Trim(pattern, "/")
+		if !strings.Contains(pattern, "/") {
+			for _, segment := range segments {
+				if ok, _ := path.Match(pattern, segment); ok {
+					return pattern
+				}
+			}
+			continue
+		}
+		for i := len(segments); i > 0; i-- {
+			if ok, _ := path.Match(pattern, strings.Join(segments[:i], "/")); ok {
+				return pattern
+			}
+		}
+	}
+	return ""
+}
+
+// unstageFiltered removes the staged additions and changes the commit filter
+// rejects from the index
+func (g *Git) unstageFiltered(ctx context.Context, repoPath string) error {
+	if g.filter == nil {
+		return nil
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "diff", "--cached", "--name-only", "-z", "--diff-filter=ACMRT")
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to list staged files: %w", err)
+	}
+
+	var skipped []string
+	for _, file := range strings.Split(string(bytes.TrimRight(output, "\x00")), "\x00") {
+		if file == "" {
+			continue
+		}
+		if reason := g.filter.reason(repoPath, file); reason != "" {
+			skipped = append(skipped, file)
+			if g.filter.OnSkip != nil {
+				g.filter.OnSkip(file, reason)
+			}
+		}
+	}
+	if len(skipped) == 0 {
+		return nil
+	}
+
+	// A new repository has no HEAD to reset the index to
+	args := []string{"-C", repoPath, "--literal-pathspecs", "reset", "-q", "--"}
+	if _, ok := g.revParseCommit(ctx, repoPath, "HEAD"); !ok {
+		args = []string{"-C", repoPath, "--literal-pathspecs", "rm", "--cached", "-q", "--"}
+	}
+	unstage := exec.CommandContext(ctx, "git", append(args, skipped...)...)
+	if output, err := unstage.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to unstage filtered files: %s: %w", output, err)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCommitFilter_Denied(t *testing.T) {
+	f := &CommitFilter{Deny: []string{"*.exe", "node_modules", "dist/*", "/build/out/"}}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"app.exe", "*.exe"},
+		{"bin/tool.exe", "*.exe"},
+		{"web/node_modules/left-pad/index.js", "node_modules"},
+		{"dist/bundle.js", "dist/*"},
+		{"dist/maps/bundle.js.map", "dist/*"},
+		{"build/out/app", "build/out"},
+		{"src/dist/bundle.js", ""},
+		{"main.go", ""},
+		{"exe.txt", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := f.denied(tt.path); got != tt.want {
+				t.Errorf("denied(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCommitFilter(t *testing.T) {
+	if f := NewCommitFilter(0, nil, nil); f != nil {
+		t.Errorf("NewCommitFilter() without limits = %+v, want nil", f)
+	}
+	if f := NewCommitFilter(2, nil, nil); f == nil || f.MaxFileBytes != 2*1024*1024 {
+		t.Errorf("NewCommitFilter(2) = %+v, want a 2MB limit", f)
+	}
+}
+
+func TestCommit_Filter(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	tests := []struct {
+		name    string
+		initial bool // Whether the repository has a commit before the filtered one
+	}{
+		{"existing repository", true},
+		{"first commit", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := t.TempDir()
+			if output, err := exec.Command("git", "init", repo).CombinedOutput(); err != nil {
+				t.Fatalf("git init failed: %s", output)
+			}
+			if tt.initial {
+				writeFile(t, filepath.Join(repo, "data.csv"), "a,b\n")
+				if err := NewWithOptions(Options{AuthorName: "Repobox Bot", AuthorEmail: "bot@repobox.cloud"}).Commit(ctx, repo, "initial"); err != nil {
+					t.Fatalf("Commit() error = %v", err)
+				}
+				// A tracked file grown past the limit
+				writeFile(t, filepath.Join(repo, "data.csv"), strings.Repeat("a,b\n", 10))
+			}
+
+			skipped := make(map[string]string)
+			g := NewWithOptions(Options{
+				AuthorName:  "Repobox Bot",
+				AuthorEmail: "bot@repobox.cloud",
+				Filter: &CommitFilter{
+					MaxFileBytes: 16,
+					Deny:         []string{"*.exe"},
+					OnSkip:       func(path, reason string) { skipped[path] = reason },
+				},
+			})
+
+			writeFile(t, filepath.Join(repo, "main.go"), "package main\n")
+			writeFile(t, filepath.Join(repo, "bin", "tool.exe"), "MZ\n")
+			writeFile(t, filepath.Join(repo, "big.bin"), strings.Repeat("x", 17))
+			if err := g.Commit(ctx, repo, "agent changes"); err != nil {
+				t.Fatalf("Commit() error = %v", err)
+			}
+
+			if got := headFiles(t, repo); !reflect.DeepEqual(got, []string{"main.go"}) {
+				t.Errorf("committed files = %q, want only main.go", got)
+			}
+
+			var gotSkipped []string
+			for path := range skipped {
+				gotSkipped = append(gotSkipped, path)
+			}
+			sort.Strings(gotSkipped)
+			wantSkipped := []string{"big.bin", "bin/tool.exe"}
+			if tt.initial {
+				wantSkipped = []string{"big.bin", "bin/tool.exe", "data.csv"}
+			}
+			if !reflect.DeepEqual(gotSkipped, wantSkipped) {
+				t.Errorf("skipped = %q, want %q", gotSkipped, wantSkipped)
+			}
+			if reason := skipped["bin/tool.exe"]; reason != `matches "*.exe"` {
+				t.Errorf("tool.exe skip reason = %q", reason)
+			}
+			if reason := skipped["big.bin"]; reason != "17 bytes, the limit is 16" {
+				t.Errorf("big.bin skip reason = %q", reason)
+			}
+
+			// Skipped files stay in the work tree, unstaged
+			if _, err := os.Stat(filepath.Join(repo, "big.bin")); err != nil {
+				t.Errorf("big.bin removed from the work tree: %v", err)
+			}
+			output, err := exec.Command("git", "-C", repo, "diff", "--cached", "--name-only").Output()
+			if err != nil {
+				t.Fatalf("git diff failed: %v", err)
+			}
+			if staged := strings.TrimSpace(string(output)); staged != "" {
+				t.Errorf("files left staged: %q", staged)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package git
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CommitManifestFile is the file the agent may write to split its changes into several commits
+const CommitManifestFile = ".repobox-commits.json"
+
+// CommitGroup is a set of files committed together with one message
+type CommitGroup struct {
+	Message string   `json:"message"`
+	Files   []string `json:"files"`
+}
+
+// commitManifest is the JSON layout of CommitManifestFile
+type commitManifest struct {
+	Commits []CommitGroup `json:"commits"`
+}
+
+// ReadCommitManifest loads and validates the agent's commit manifest from the repo root.
+// The manifest file is removed so it never ends up in a commit.
+// Returns nil groups and no error if there is no manifest.
+func ReadCommitManifest(repoPath string) ([]CommitGroup, error) {
+	path := filepath.Join(repoPath, CommitManifestFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commit manifest: %w", err)
+	}
+	os.Remove(path)
+
+	var manifest commitManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid commit manifest: %w", err)
+	}
+
+	for i, group := range manifest.Commits {
+		if strings.TrimSpace(group.Message) == "" {
+			return nil, fmt.Errorf("invalid commit manifest: commit %d has no message", i+1)
+		}
+		if len(group.Files) == 0 {
+			return nil, fmt.Errorf("invalid commit manifest: commit %d has no files", i+1)
+		}
+		for j, file := range group.Files {
+			clean, err := manifestPath(file)
+			if err != nil {
+				return nil, fmt.Errorf("invalid commit manifest: commit %d: %w", i+1, err)
+			}
+			manifest.Commits[i].Files[j] = clean
+		}
+	}
+
+	return manifest.Commits, nil
+}
+
+// manifestPath validates that a manifest path stays within the repository
+// and returns it in a form safe to pass to git as a literal pathspec
+func manifestPath(file string) (string, error) {
+	if file == "" || filepath.IsAbs(file) {
+		return "", fmt.Errorf("path %q must be relative to the repository root", file)
+	}
+
+	clean := filepath.Clean(file)
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("path %q escapes the repository", file)
+	}
+	if clean == ".git" || strings.HasPrefix(clean, ".git/") {
+		return "", fmt.Errorf("path %q points into .git", file)
+	}
+
+	// Disable pathspec magic so names like ":(glob)*" can't widen the match
+	return ":(literal)" + clean, nil
+}
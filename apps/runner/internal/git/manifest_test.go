@@ -0,0 +1,133 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func TestReadCommitManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     []CommitGroup
+		wantErr  string
+	}{
+		{
+			name:     "valid",
+			manifest: `{"commits": [{"message": "Add parser", "files": ["pkg/parser.go", "./pkg/parser_test.go"]}, {"message": "Update docs", "files": ["README.md"]}]}`,
+			want: []CommitGroup{
+				{Message: "Add parser", Files: []string{":(literal)pkg/parser.go", ":(literal)pkg/parser_test.go"}},
+				{Message: "Update docs", Files: []string{":(literal)README.md"}},
+			},
+		},
+		{name: "not json", manifest: `commit everything`, wantErr: "invalid commit manifest"},
+		{name: "missing message", manifest: `{"commits": [{"files": ["a.go"]}]}`, wantErr: "has no message"},
+		{name: "missing files", manifest: `{"commits": [{"message": "x"}]}`, wantErr: "has no files"},
+		{name: "parent escape", manifest: `{"commits": [{"message": "x", "files": ["pkg/../../etc/passwd"]}]}`, wantErr: "escapes the repository"},
+		{name: "absolute path", manifest: `{"commits": [{"message": "x", "files": ["/etc/passwd"]}]}`, wantErr: "must be relative"},
+		{name: "git dir", manifest: `{"commits": [{"message": "x", "files": [".git/config"]}]}`, wantErr: "points into .git"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := t.TempDir()
+			writeFile(t, filepath.Join(repo, CommitManifestFile), tt.manifest)
+
+			got, err := ReadCommitManifest(repo)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ReadCommitManifest() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("ReadCommitManifest() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadCommitManifest() = %+v, want %+v", got, tt.want)
+			}
+
+			if _, err := os.Stat(filepath.Join(repo, CommitManifestFile)); !os.IsNotExist(err) {
+				t.Error("manifest file should be removed after reading")
+			}
+		})
+	}
+}
+
+func TestReadCommitManifest_Absent(t *testing.T) {
+	got, err := ReadCommitManifest(t.TempDir())
+	if err != nil || got != nil {
+		t.Errorf("ReadCommitManifest() = %v, %v, want nil, nil", got, err)
+	}
+}
+
+func TestCommitGroups(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	ctx := context.Background()
+	repo := t.TempDir()
+	g := NewWithOptions(Options{AuthorName: "Repobox Bot", AuthorEmail: "bot@repobox.cloud"})
+
+	if output, err := exec.Command("git", "init", repo).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %s", output)
+	}
+	writeFile(t, filepath.Join(repo, "README.md"), "hello\n")
+	writeFile(t, filepath.Join(repo, "old.go"), "package old\n")
+	if err := g.Commit(ctx, repo, "initial"); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	// Agent changes: new parser, deleted file, docs update, and one unlisted file
+	writeFile(t, filepath.Join(repo, "pkg", "parser.go"), "package pkg\n")
+	os.Remove(filepath.Join(repo, "old.go"))
+	writeFile(t, filepath.Join(repo, "README.md"), "hello world\n")
+	writeFile(t, filepath.Join(repo, "notes.txt"), "unlisted\n")
+	writeFile(t, filepath.Join(repo, CommitManifestFile), `{"commits": [
+		{"message": "Add parser and drop old package", "files": ["pkg/parser.go", "old.go"]},
+		{"message": "Already committed", "files": ["pkg/parser.go"]},
+		{"message": "Update README", "files": ["README.md"]}
+	]}`)
+
+	groups, err := ReadCommitManifest(repo)
+	if err != nil {
+		t.Fatalf("ReadCommitManifest() error = %v", err)
+	}
+	if err := g.CommitGroups(ctx, repo, groups, "repobox: remaining changes"); err != nil {
+		t.Fatalf("CommitGroups() error = %v", err)
+	}
+
+	out, err := exec.Command("git", "-C", repo, "log", "--format=%s", "--name-status").CombinedOutput()
+	if err != nil {
+		t.Fatalf("git log failed: %s", out)
+	}
+
+	want := []string{
+		"repobox: remaining changes", "A\tnotes.txt",
+		"Update README", "M\tREADME.md",
+		"Add parser and drop old package", "D\told.go", "A\tpkg/parser.go",
+		"initial", "A\tREADME.md", "A\told.go",
+	}
+	var got []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line != "" {
+			got = append(got, line)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("commit log =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
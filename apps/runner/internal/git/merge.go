@@ -0,0 +1,75 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// WouldMergeCleanly test-merges origin/<base> into HEAD and returns the files
+// that would conflict. The merge runs in a throwaway worktree next to the
+// repository, so the checkout and index stay untouched. Only committed
+// changes take part.
+func (g *Git) WouldMergeCleanly(ctx context.Context, repoPath, base string) (bool, []string, error) {
+	target := base
+	if !strings.HasPrefix(target, "origin/") {
+		target = "origin/" + base
+	}
+
+	// A shallow clone may lack the common history the merge needs
+	if _, err := g.mergeBase(ctx, repoPath, target); err != nil {
+		return false, nil, err
+	}
+
+	worktree, err := os.MkdirTemp(filepath.Dir(repoPath), ".merge-check-")
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to create merge check dir: %w", err)
+	}
+	defer func() {
+		_ = exec.CommandContext(context.Background(), "git", "-C", repoPath, "worktree", "remove", "--force", worktree).Run()
+		_ = os.RemoveAll(worktree)
+		_ = exec.CommandContext(context.Background(), "git", "-C", repoPath, "worktree", "prune").Run()
+	}()
+
+	addCmd := exec.CommandContext(ctx, "git", "-C", repoPath, "worktree", "add", "--detach", worktree, "HEAD")
+	if output, err := addCmd.CombinedOutput(); err != nil {
+		return false, nil, fmt.Errorf("git worktree add failed: %s: %w", output, err)
+	}
+
+	// The repository may have no identity configured; merge refuses to start without one
+	mergeCmd := exec.CommandContext(ctx, "git", "-C", worktree,
+		"-c", "user.name=repobox", "-c", "user.email=merge-check@repobox.invalid",
+		"merge", "--no-commit", "--no-ff", target)
+	output, mergeErr := mergeCmd.CombinedOutput()
+	if mergeErr == nil {
+		return true, nil, nil
+	}
+
+	conflicts, err := unmergedFiles(ctx, worktree)
+	if err != nil {
+		return false, nil, err
+	}
+	if len(conflicts) == 0 {
+		return false, nil, fmt.Errorf("git merge failed: %s: %w", strings.TrimSpace(string(output)), mergeErr)
+	}
+	return false, conflicts, nil
+}
+
+// unmergedFiles lists the paths a stopped merge left with conflicts
+func unmergedFiles(ctx context.Context, repoPath string) ([]string, error) {
+	output, err := exec.CommandContext(ctx, "git", "-C", repoPath, "diff", "--name-only", "--diff-filter=U", "-z").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff failed: %w", err)
+	}
+
+	var files []string
+	for _, name := range strings.Split(string(output), "\x00") {
+		if name != "" {
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
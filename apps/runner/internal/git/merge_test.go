@@ -0,0 +1,95 @@
+package git
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWouldMergeCleanly(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	ctx := context.Background()
+	g := NewWithOptions(Options{AuthorName: "Repobox Bot", AuthorEmail: "bot@repobox.cloud"})
+
+	git := func(dir string, args ...string) {
+		t.Helper()
+		if output, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %s", args, output)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		baseChange    string // app.txt on main after the clone
+		branchChange  string // app.txt on the work branch
+		wantClean     bool
+		wantConflicts []string
+	}{
+		{"base unchanged", "", "line 1 changed\nline 2\nline 3\n", true, nil},
+		{"different lines", "line 1\nline 2\nline 3 on main\n", "line 1 changed\nline 2\nline 3\n", true, nil},
+		{"same line", "line 1 on main\nline 2\nline 3\n", "line 1 changed\nline 2\nline 3\n", false, []string{"app.txt"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origin := t.TempDir()
+			git(origin, "init", "-b", "main")
+			writeFile(t, filepath.Join(origin, "app.txt"), "line 1\nline 2\nline 3\n")
+			if err := g.Commit(ctx, origin, "initial"); err != nil {
+				t.Fatalf("Commit() error = %v", err)
+			}
+
+			repo := filepath.Join(t.TempDir(), "repo")
+			if output, err := exec.Command("git", "clone", "--quiet", "file://"+origin, repo).CombinedOutput(); err != nil {
+				t.Fatalf("git clone failed: %s", output)
+			}
+			git(repo, "checkout", "-b", "repobox/work")
+			writeFile(t, filepath.Join(repo, "app.txt"), tt.branchChange)
+			if err := g.Commit(ctx, repo, "work"); err != nil {
+				t.Fatalf("Commit() error = %v", err)
+			}
+
+			if tt.baseChange != "" {
+				writeFile(t, filepath.Join(origin, "app.txt"), tt.baseChange)
+				if err := g.Commit(ctx, origin, "base moved on"); err != nil {
+					t.Fatalf("Commit() error = %v", err)
+				}
+				git(repo, "fetch", "--quiet", "origin")
+			}
+
+			clean, conflicts, err := g.WouldMergeCleanly(ctx, repo, "main")
+			if err != nil {
+				t.Fatalf("WouldMergeCleanly() error = %v", err)
+			}
+			if clean != tt.wantClean {
+				t.Errorf("clean = %v, want %v", clean, tt.wantClean)
+			}
+			if !reflect.DeepEqual(conflicts, tt.wantConflicts) {
+				t.Errorf("conflicts = %v, want %v", conflicts, tt.wantConflicts)
+			}
+
+			// The checkout is untouched and no worktree is left behind
+			content, err := os.ReadFile(filepath.Join(repo, "app.txt"))
+			if err != nil {
+				t.Fatalf("ReadFile() error = %v", err)
+			}
+			if string(content) != tt.branchChange {
+				t.Errorf("app.txt = %q after the check, want the branch content", content)
+			}
+			output, _ := exec.Command("git", "-C", repo, "worktree", "list").Output()
+			if n := len(strings.Split(strings.TrimSpace(string(output)), "\n")); n != 1 {
+				t.Errorf("worktree list has %d entries, want 1:\n%s", n, output)
+			}
+			entries, _ := os.ReadDir(filepath.Dir(repo))
+			if len(entries) != 1 {
+				t.Errorf("workdir has %d entries after the check, want only the repo", len(entries))
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// CommitInfo describes a commit in a range
+type CommitInfo struct {
+	Author  string // "Name <email>"
+	Subject string
+}
+
+// CommitsSince lists the commits HEAD has on top of its merge base with base, oldest first
+func (g *Git) CommitsSince(ctx context.Context, repoPath, base string) ([]CommitInfo, error) {
+	from, err := g.mergeBase(ctx, repoPath, base)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "log", "--reverse", "--format=%an <%ae>%x00%s%x00", from+"..HEAD")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git log failed: %w", err)
+	}
+	return parseCommitLog(string(output)), nil
+}
+
+// parseCommitLog parses NUL-separated author/subject pairs from git log
+func parseCommitLog(output string) []CommitInfo {
+	fields := strings.Split(output, "\x00")
+	var commits []CommitInfo
+	for i := 0; i+1 < len(fields); i += 2 {
+		commits = append(commits, CommitInfo{
+			Author:  strings.TrimSpace(fields[i]),
+			Subject: fields[i+1],
+		})
+	}
+	return commits
+}
+
+// RefExists reports whether rev resolves to a commit, e.g. "origin/<branch>"
+// for a branch pushed before
+func (g *Git) RefExists(ctx context.Context, repoPath, rev string) bool {
+	_, ok := g.revParseCommit(ctx, repoPath, rev)
+	return ok
+}
+
+// Squash folds the commits HEAD has on top of its merge base with base into
+// one commit with message. The merge base is used rather than base itself so
+// changes base gained meanwhile aren't reverted. The commit is authored like
+// Commit's; without a configured author a sole author of the squashed commits
+// is kept. Other authors are credited with Co-authored-by trailers. Returns the
+// number of commits squashed; with fewer than two history is left alone.
+func (g *Git) Squash(ctx context.Context, repoPath, base, message string) (int, error) {
+	commits, err := g.CommitsSince(ctx, repoPath, base)
+	if err != nil {
+		return 0, err
+	}
+	if len(commits) < 2 {
+		return len(commits), nil
+	}
+
+	from, err := g.mergeBase(ctx, repoPath, base)
+	if err != nil {
+		return 0, err
+	}
+	if err := g.configureAuthor(ctx, repoPath); err != nil {
+		return 0, err
+	}
+
+	author := g.author
+	authors := distinctAuthors(commits)
+	if author == "" && len(authors) == 1 {
+		author = authors[0]
+	}
+	message += coAuthorTrailers(authors, author, g.botIdentity())
+
+	resetCmd := exec.CommandContext(ctx, "git", "-C", repoPath, "reset", "--soft", from)
+	if output, err := resetCmd.CombinedOutput(); err != nil {
+		return 0, fmt.Errorf("git reset --soft failed: %s: %w", output, err)
+	}
+
+	args := []string{"-C", repoPath, "commit", "--allow-empty", "-m", message}
+	if author != "" {
+		args = append(args, "--author", author)
+	}
+	if output, err := exec.CommandContext(ctx, "git", args...).CombinedOutput(); err != nil {
+		return 0, fmt.Errorf("git commit failed: %s: %w", output, err)
+	}
+	return len(commits), nil
+}
+
+// botIdentity returns the configured committer as "Name <email>", empty if unset
+func (g *Git) botIdentity() string {
+	if g.authorName == "" || g.authorEmail == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s <%s>", g.authorName, g.authorEmail)
+}
+
+// distinctAuthors returns the commit authors in order of first appearance
+func distinctAuthors(commits []CommitInfo) []string {
+	seen := make(map[string]bool)
+	var authors []string
+	for _, c := range commits {
+		if c.Author != "" && !seen[c.Author] {
+			seen[c.Author] = true
+			authors = append(authors, c.Author)
+		}
+	}
+	return authors
+}
+
+// coAuthorTrailers credits authors other than the commit's own author and
+// the bot, as a trailer block to append to a commit message
+func coAuthorTrailers(authors []string, author, bot string) string {
+	var b strings.Builder
+	for _, a := range authors {
+		if a == author || a == bot {
+			continue
+		}
+		if b.Len() == 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("\nCo-authored-by: " + a)
+	}
+	return b.String()
+}
@@ -0,0 +1,108 @@
+package git
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSquash(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	ctx := context.Background()
+	bot := NewWithOptions(Options{AuthorName: "Repobox Bot", AuthorEmail: "bot@repobox.cloud"})
+
+	git := func(dir string, args ...string) string {
+		t.Helper()
+		output, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %s", args, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+
+	tests := []struct {
+		name        string
+		author      string   // Options.Author of the squashing helper
+		commits     []string // Authors of the work branch commits, empty for the bot
+		wantN       int
+		wantAuthor  string
+		wantCoAuths []string
+	}{
+		{"no commits", "", nil, 0, "", nil},
+		{"single commit is left alone", "", []string{""}, 1, "Repobox Bot <bot@repobox.cloud>", nil},
+		{"bot commits", "", []string{"", ""}, 2, "Repobox Bot <bot@repobox.cloud>", nil},
+		{"sole author kept", "", []string{"Jana <jana@example.com>", "Jana <jana@example.com>"}, 2, "Jana <jana@example.com>", nil},
+		{"requesting user authors, others credited", "Jana <jana@example.com>", []string{"Petr <petr@example.com>", "", "Jana <jana@example.com>"}, 3, "Jana <jana@example.com>", []string{"Petr <petr@example.com>"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origin := t.TempDir()
+			git(origin, "init", "-b", "main")
+			writeFile(t, filepath.Join(origin, "base.txt"), "v1\n")
+			if err := bot.Commit(ctx, origin, "initial"); err != nil {
+				t.Fatalf("Commit() error = %v", err)
+			}
+
+			repo := filepath.Join(t.TempDir(), "repo")
+			if output, err := exec.Command("git", "clone", "--quiet", "file://"+origin, repo).CombinedOutput(); err != nil {
+				t.Fatalf("git clone failed: %s", output)
+			}
+			git(repo, "checkout", "-b", "repobox/work")
+			for i, author := range tt.commits {
+				writeFile(t, filepath.Join(repo, "work.txt"), strings.Repeat("x", i+1)+"\n")
+				g := NewWithOptions(Options{AuthorName: "Repobox Bot", AuthorEmail: "bot@repobox.cloud", Author: author})
+				if err := g.Commit(ctx, repo, "change "+string(rune('a'+i))); err != nil {
+					t.Fatalf("Commit() error = %v", err)
+				}
+			}
+			before := git(repo, "rev-parse", "HEAD")
+
+			// Base moves on after the clone; the squash must not revert it
+			writeFile(t, filepath.Join(origin, "base.txt"), "v2\n")
+			if err := bot.Commit(ctx, origin, "base moved on"); err != nil {
+				t.Fatalf("Commit() error = %v", err)
+			}
+			git(repo, "fetch", "--quiet", "origin")
+
+			g := NewWithOptions(Options{AuthorName: "Repobox Bot", AuthorEmail: "bot@repobox.cloud", Author: tt.author})
+			n, err := g.Squash(ctx, repo, "origin/main", "repobox: Work session")
+			if err != nil {
+				t.Fatalf("Squash() error = %v", err)
+			}
+			if n != tt.wantN {
+				t.Errorf("squashed %d commits, want %d", n, tt.wantN)
+			}
+			if n < 2 {
+				if after := git(repo, "rev-parse", "HEAD"); after != before {
+					t.Errorf("HEAD moved from %s to %s without squashing", before, after)
+				}
+				return
+			}
+
+			commits, err := g.CommitsSince(ctx, repo, "origin/main")
+			if err != nil {
+				t.Fatalf("CommitsSince() error = %v", err)
+			}
+			if len(commits) != 1 {
+				t.Fatalf("%d commits after squash, want 1", len(commits))
+			}
+			if commits[0].Author != tt.wantAuthor {
+				t.Errorf("author = %q, want %q", commits[0].Author, tt.wantAuthor)
+			}
+			if got := git(repo, "show", "-s", "--format=%(trailers:key=Co-authored-by,valueonly)", "HEAD"); got != strings.Join(tt.wantCoAuths, "\n") {
+				t.Errorf("co-authors = %q, want %q", got, tt.wantCoAuths)
+			}
+			if got := git(repo, "show", "HEAD:work.txt"); got != strings.Repeat("x", len(tt.commits)) {
+				t.Errorf("work.txt = %q, want the last change", got)
+			}
+			if got := git(repo, "diff", "--name-only", "HEAD~1", "HEAD"); got != "work.txt" {
+				t.Errorf("squashed commit changes %q, want only work.txt", got)
+			}
+		})
+	}
+}
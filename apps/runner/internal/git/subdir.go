@@ -0,0 +1,64 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ResolveSubdir returns the path of subdir inside the repository at repoPath,
+// for scoping the agent to part of a monorepo. subdir must be relative, stay
+// inside the repository (symlinks included) and name an existing directory
+// outside .git. An empty subdir resolves to repoPath.
+func ResolveSubdir(repoPath, subdir string) (string, error) {
+	if subdir == "" {
+		return repoPath, nil
+	}
+	if filepath.IsAbs(subdir) || strings.HasPrefix(subdir, "/") {
+		return "", fmt.Errorf("work subdir %q must be relative to the repository root", subdir)
+	}
+
+	clean := filepath.Clean(subdir)
+	if clean == "." {
+		return repoPath, nil
+	}
+	if escapes(clean) {
+		return "", fmt.Errorf("work subdir %q is outside the repository", subdir)
+	}
+	if first, _, _ := strings.Cut(filepath.ToSlash(clean), "/"); first == ".git" {
+		return "", fmt.Errorf("work subdir %q is inside .git", subdir)
+	}
+
+	root, err := filepath.EvalSymlinks(repoPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve repository path: %w", err)
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(root, clean))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("work subdir %q does not exist", subdir)
+		}
+		return "", fmt.Errorf("failed to resolve work subdir %q: %w", subdir, err)
+	}
+
+	// A symlink inside the repository may still point out of it
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || escapes(rel) {
+		return "", fmt.Errorf("work subdir %q is outside the repository", subdir)
+	}
+
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat work subdir %q: %w", subdir, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("work subdir %q is not a directory", subdir)
+	}
+	return filepath.Join(repoPath, clean), nil
+}
+
+// escapes reports whether a cleaned relative path leaves its base directory
+func escapes(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,55 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveSubdir(t *testing.T) {
+	base := t.TempDir()
+	repo := filepath.Join(base, "repo")
+	writeFile(t, filepath.Join(repo, "services", "api", "main.go"), "package main\n")
+	writeFile(t, filepath.Join(repo, "README.md"), "readme\n")
+	writeFile(t, filepath.Join(repo, ".git", "HEAD"), "ref: refs/heads/main\n")
+	writeFile(t, filepath.Join(base, "outside", "secret.txt"), "secret\n")
+	if err := os.Symlink(filepath.Join(base, "outside"), filepath.Join(repo, "escape")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	if err := os.Symlink("services", filepath.Join(repo, "svc")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		subdir  string
+		want    string
+		wantErr bool
+	}{
+		{"empty is repo root", "", repo, false},
+		{"dot is repo root", ".", repo, false},
+		{"nested dir", "services/api", filepath.Join(repo, "services", "api"), false},
+		{"trailing slash", "services/api/", filepath.Join(repo, "services", "api"), false},
+		{"dotdot staying inside", "services/../services", filepath.Join(repo, "services"), false},
+		{"symlink inside repo", "svc/api", filepath.Join(repo, "svc", "api"), false},
+		{"absolute", "/etc", "", true},
+		{"parent", "..", "", true},
+		{"traversal", "services/../../outside", "", true},
+		{"symlink out of repo", "escape", "", true},
+		{"missing", "services/web", "", true},
+		{"file", "README.md", "", true},
+		{"git dir", ".git", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveSubdir(repo, tt.subdir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveSubdir(%q) error = %v, wantErr %v", tt.subdir, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveSubdir(%q) = %q, want %q", tt.subdir, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// cloneArgs returns the arguments of a direct clone
+func (g *Git) cloneArgs(repoURL, cloneURL, destPath string) []string {
+	args := g.submoduleAuthArgs(repoURL)
+	args = append(args, "clone")
+	if g.submodules {
+		args = append(args, "--recurse-submodules")
+	}
+	return append(args, cloneURL, destPath)
+}
+
+// submoduleUpdateArgs returns the arguments that check out the submodules of
+// repoPath. Clone runs them after a cached clone, which can't recurse, and as
+// a fallback for submodules a recursive clone left empty.
+func (g *Git) submoduleUpdateArgs(repoURL, repoPath string) []string {
+	args := g.submoduleAuthArgs(repoURL)
+	return append(args, "-C", repoPath, "submodule", "update", "--init", "--recursive")
+}
+
+// submoduleAuthArgs rewrites URLs on the repository's host to carry the token,
+// so absolute submodule URLs on the same host authenticate like the clone. The
+// setting is passed per command and not stored in the repository.
+func (g *Git) submoduleAuthArgs(repoURL string) []string {
+	if !g.submodules || g.token == "" {
+		return nil
+	}
+	u, err := url.Parse(repoURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil
+	}
+	base := "https://" + u.Host + "/"
+	authBase, err := embedToken(base, g.token)
+	if err != nil {
+		return nil
+	}
+	return []string{"-c", fmt.Sprintf("url.%s.insteadOf=%s", authBase, base)}
+}
+
+// updateSubmodules checks out the submodules of a fresh clone
+func (g *Git) updateSubmodules(ctx context.Context, repoURL, repoPath string) error {
+	if _, err := os.Stat(filepath.Join(repoPath, ".gitmodules")); err != nil {
+		return nil
+	}
+	cmd := exec.CommandContext(ctx, "git", g.submoduleUpdateArgs(repoURL, repoPath)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git submodule update failed: %s: %w", maskTokenInString(string(output), g.token), err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// How CreateWorkBranch handles a branch name that already exists locally or on origin
+const (
+	BranchSuffix = "suffix" // Use the first free "<name>-2", "<name>-3", ...
+	BranchReuse  = "reuse"  // Check out the existing branch and continue on it
+	BranchForce  = "force"  // Start the branch over from HEAD and overwrite origin with a lease
+)
+
+// maxBranchSuffix is the highest suffix BranchSuffix tries
+const maxBranchSuffix = 100
+
+// WorkBranch is the branch CreateWorkBranch checked out
+type WorkBranch struct {
+	Name   string // Requested name, or the suffixed one
+	Reused bool   // An existing branch was checked out
+	Lease  string // Commit origin had for Name when overwriting it (BranchForce), "" for a normal push
+}
+
+// CreateWorkBranch creates and checks out branch name from HEAD. When the name
+// is taken locally (a kept work dir) or on origin (an earlier run), mode
+// decides between a suffixed name, reusing the branch, or starting it over.
+func (g *Git) CreateWorkBranch(ctx context.Context, repoPath, name, mode string) (WorkBranch, error) {
+	remote, err := g.remoteHeads(ctx, repoPath, name)
+	if err != nil {
+		return WorkBranch{}, err
+	}
+	taken := func(branch string) bool {
+		_, onRemote := remote[branch]
+		return onRemote || g.BranchExists(ctx, repoPath, branch)
+	}
+	if !taken(name) {
+		return WorkBranch{Name: name}, g.CreateBranch(ctx, repoPath, name)
+	}
+
+	switch mode {
+	case BranchReuse:
+		if _, onRemote := remote[name]; onRemote && !g.BranchExists(ctx, repoPath, name) {
+			// The branch may be newer than the clone
+			fetch := exec.CommandContext(ctx, "git", "-C", repoPath, "fetch", "--quiet", "origin",
+				fmt.Sprintf("refs/heads/%s:refs/remotes/origin/%s", name, name))
+			if output, err := fetch.CombinedOutput(); err != nil {
+				return WorkBranch{}, fmt.Errorf("git fetch failed: %s: %w", maskTokenInString(string(output), g.token), err)
+			}
+		}
+		return WorkBranch{Name: name, Reused: true}, g.Checkout(ctx, repoPath, name)
+	case BranchForce:
+		cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "checkout", "-B", name)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return WorkBranch{}, fmt.Errorf("git checkout -B failed: %s: %w", output, err)
+		}
+		return WorkBranch{Name: name, Lease: remote[name]}, nil
+	default:
+		for n := 2; n <= maxBranchSuffix; n++ {
+			candidate := fmt.Sprintf("%s-%d", name, n)
+			if !taken(candidate) {
+				return WorkBranch{Name: candidate}, g.CreateBranch(ctx, repoPath, candidate)
+			}
+		}
+		return WorkBranch{}, fmt.Errorf("branch %s and its suffixed names up to -%d already exist", name, maxBranchSuffix)
+	}
+}
+
+// remoteHeads returns origin's branches starting with prefix, mapped to their commits
+func (g *Git) remoteHeads(ctx context.Context, repoPath, prefix string) (map[string]string, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "ls-remote", "--heads", "origin", "refs/heads/"+prefix+"*")
+	output, err := cmd.Output()
+	if err != nil {
+		var stderr string
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			stderr = string(exitErr.Stderr)
+		}
+		return nil, fmt.Errorf("git ls-remote failed: %s: %w", maskTokenInString(strings.TrimSpace(stderr), g.token), err)
+	}
+
+	heads := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		sha, ref, ok := strings.Cut(strings.TrimSpace(line), "\t")
+		if name, found := strings.CutPrefix(ref, "refs/heads/"); ok && found && strings.HasPrefix(name, prefix) {
+			heads[name] = sha
+		}
+	}
+	return heads, nil
+}
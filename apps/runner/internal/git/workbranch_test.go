@@ -0,0 +1,156 @@
+package git
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateWorkBranch(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	tests := []struct {
+		name       string
+		local      bool // The branch exists in the clone (a kept work dir)
+		remote     bool // The branch exists on origin (an earlier run pushed it)
+		mode       string
+		wantName   string
+		wantReused bool
+		wantLease  bool
+		wantFile   bool // The checked out branch has the earlier run's commit
+	}{
+		{"free name", false, false, BranchSuffix, "repobox/abc12345", false, false, false},
+		{"local exists, suffix", true, false, BranchSuffix, "repobox/abc12345-2", false, false, false},
+		{"remote exists, suffix", false, true, BranchSuffix, "repobox/abc12345-3", false, false, false},
+		{"local exists, reuse", true, false, BranchReuse, "repobox/abc12345", true, false, true},
+		{"remote exists, reuse", false, true, BranchReuse, "repobox/abc12345", true, false, true},
+		{"local exists, force", true, false, BranchForce, "repobox/abc12345", false, false, false},
+		{"remote exists, force", false, true, BranchForce, "repobox/abc12345", false, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			g := NewWithOptions(Options{AuthorName: "Repobox Bot", AuthorEmail: "bot@repobox.cloud"})
+			git := func(dir string, args ...string) string {
+				t.Helper()
+				output, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+				if err != nil {
+					t.Fatalf("git %v failed: %s", args, output)
+				}
+				return strings.TrimSpace(string(output))
+			}
+
+			origin := t.TempDir()
+			git(origin, "init", "-b", "main")
+			writeFile(t, filepath.Join(origin, "README.md"), "hello\n")
+			if err := g.Commit(ctx, origin, "initial"); err != nil {
+				t.Fatalf("Commit() error = %v", err)
+			}
+			repo := filepath.Join(t.TempDir(), "repo")
+			if output, err := exec.Command("git", "clone", "--quiet", "file://"+origin, repo).CombinedOutput(); err != nil {
+				t.Fatalf("git clone failed: %s", output)
+			}
+
+			// An earlier run's branch with one commit on it; on origin it is
+			// newer than the clone
+			if tt.local || tt.remote {
+				earlier := origin
+				if tt.local {
+					earlier = repo
+				}
+				git(earlier, "checkout", "-q", "-b", "repobox/abc12345")
+				writeFile(t, filepath.Join(earlier, "earlier.txt"), "earlier\n")
+				if err := g.Commit(ctx, earlier, "earlier run"); err != nil {
+					t.Fatalf("Commit() error = %v", err)
+				}
+				git(earlier, "checkout", "-q", "main")
+			}
+			if tt.remote {
+				// Only on origin, and taking the first suffix as well
+				git(origin, "branch", "repobox/abc12345-2")
+			}
+
+			wb, err := g.CreateWorkBranch(ctx, repo, "repobox/abc12345", tt.mode)
+			if err != nil {
+				t.Fatalf("CreateWorkBranch() error = %v", err)
+			}
+			if wb.Name != tt.wantName || wb.Reused != tt.wantReused || (wb.Lease != "") != tt.wantLease {
+				t.Errorf("CreateWorkBranch() = %+v, want name %s, reused %v, lease %v", wb, tt.wantName, tt.wantReused, tt.wantLease)
+			}
+			if tt.wantLease {
+				if want := git(origin, "rev-parse", "repobox/abc12345"); wb.Lease != want {
+					t.Errorf("Lease = %s, want origin's commit %s", wb.Lease, want)
+				}
+			}
+			if head := git(repo, "branch", "--show-current"); head != tt.wantName {
+				t.Errorf("checked out %s, want %s", head, tt.wantName)
+			}
+			hasFile := git(repo, "ls-files", "earlier.txt") != ""
+			if hasFile != tt.wantFile {
+				t.Errorf("earlier run's commit checked out = %v, want %v", hasFile, tt.wantFile)
+			}
+		})
+	}
+}
+
+func TestPushWithLease(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	ctx := context.Background()
+	g := NewWithOptions(Options{AuthorName: "Repobox Bot", AuthorEmail: "bot@repobox.cloud"})
+	git := func(dir string, args ...string) string {
+		t.Helper()
+		output, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %s", args, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+
+	origin := t.TempDir()
+	git(origin, "init", "-b", "main")
+	writeFile(t, filepath.Join(origin, "README.md"), "hello\n")
+	if err := g.Commit(ctx, origin, "initial"); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	git(origin, "branch", "repobox/abc12345")
+	repo := filepath.Join(t.TempDir(), "repo")
+	if output, err := exec.Command("git", "clone", "--quiet", "file://"+origin, repo).CombinedOutput(); err != nil {
+		t.Fatalf("git clone failed: %s", output)
+	}
+
+	wb, err := g.CreateWorkBranch(ctx, repo, "repobox/abc12345", BranchForce)
+	if err != nil {
+		t.Fatalf("CreateWorkBranch() error = %v", err)
+	}
+	writeFile(t, filepath.Join(repo, "a.txt"), "a\n")
+	if err := g.Commit(ctx, repo, "rerun"); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+
+	// Someone else moved the branch since: the lease refuses to overwrite it
+	git(origin, "checkout", "-q", "repobox/abc12345")
+	writeFile(t, filepath.Join(origin, "b.txt"), "b\n")
+	if err := g.Commit(ctx, origin, "meanwhile"); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	moved := git(origin, "rev-parse", "HEAD")
+	git(origin, "checkout", "-q", "main")
+	if err := g.PushWithLease(ctx, repo, wb.Name, wb.Lease); err == nil {
+		t.Fatal("PushWithLease() over a moved branch: error = nil")
+	}
+
+	// With the current commit as the lease the push goes through
+	if err := g.PushWithLease(ctx, repo, wb.Name, moved); err != nil {
+		t.Fatalf("PushWithLease() error = %v", err)
+	}
+	if got, want := git(origin, "rev-parse", "repobox/abc12345"), git(repo, "rev-parse", "HEAD"); got != want {
+		t.Errorf("origin branch at %s, want %s", got, want)
+	}
+}
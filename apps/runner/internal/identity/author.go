@@ -0,0 +1,84 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	rediskeys "github.com/repobox/runner/internal/redis"
+)
+
+// Author is the person a commit is attributed to. The runner's bot identity
+// stays the committer.
+type Author struct {
+	Name  string
+	Email string
+}
+
+// String formats the author for git commit --author
+func (a Author) String() string {
+	return fmt.Sprintf("%s <%s>", a.Name, a.Email)
+}
+
+// normalize validates the email and fills a missing name from its local part.
+// Returns false when the author can't be used.
+func (a Author) normalize() (Author, bool) {
+	a.Name = strings.TrimSpace(a.Name)
+	a.Email = strings.TrimSpace(a.Email)
+	if a.Email == "" {
+		return Author{}, false
+	}
+	addr, err := mail.ParseAddress(a.Email)
+	if err != nil || addr.Address != a.Email {
+		return Author{}, false
+	}
+	if strings.ContainsAny(a.Name, "<>\n\r") {
+		return Author{}, false
+	}
+	if a.Name == "" {
+		a.Name = a.Email[:strings.LastIndex(a.Email, "@")]
+	}
+	return a, true
+}
+
+// SelectAuthor returns the first candidate with a valid email, in order of
+// precedence. Returns false when none is usable and the bot identity should
+// author the commit.
+func SelectAuthor(candidates ...Author) (Author, bool) {
+	for _, c := range candidates {
+		if a, ok := c.normalize(); ok {
+			return a, true
+		}
+	}
+	return Author{}, false
+}
+
+// CommitAuthor credits the requesting user as commit author: the name and
+// email on the stream message, then the user's profile. Empty when neither
+// has a valid email, leaving the bot as author.
+func CommitAuthor(ctx context.Context, rdb redis.Cmdable, logger *slog.Logger, userID, name, email string) string {
+	user, err := rdb.HMGet(ctx, rediskeys.UserKey(userID), "name", "email").Result()
+	if err != nil {
+		logger.Warn("failed to load user profile", "error", err)
+	}
+	author, ok := SelectAuthor(
+		Author{Name: name, Email: email},
+		Author{Name: hashString(user, 0), Email: hashString(user, 1)},
+	)
+	if !ok {
+		return ""
+	}
+	return author.String()
+}
+
+// hashString returns field i of an HMGET reply, empty when missing
+func hashString(values []interface{}, i int) string {
+	if i >= len(values) {
+		return ""
+	}
+	s, _ := values[i].(string)
+	return s
+}
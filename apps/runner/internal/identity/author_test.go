@@ -0,0 +1,79 @@
+package identity
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	rediskeys "github.com/repobox/runner/internal/redis"
+)
+
+func TestSelectAuthor(t *testing.T) {
+	message := Author{Name: "Jan Novak", Email: "jan@example.com"}
+	user := Author{Name: "Jan N.", Email: "jan.user@example.com"}
+
+	tests := []struct {
+		name       string
+		candidates []Author
+		want       Author
+		wantOK     bool
+	}{
+		{"message wins", []Author{message, user}, message, true},
+		{"user hash when message empty", []Author{{}, user}, user, true},
+		{"invalid message email skipped", []Author{{Name: "Jan", Email: "not-an-email"}, user}, user, true},
+		{"display form rejected", []Author{{Name: "Jan", Email: "Jan <jan@example.com>"}}, Author{}, false},
+		{"name with brackets rejected", []Author{{Name: "Jan <x>", Email: "jan@example.com"}}, Author{}, false},
+		{"missing name from email", []Author{{Email: " jan@example.com "}}, Author{Name: "jan", Email: "jan@example.com"}, true},
+		{"none usable", []Author{{}, {Name: "Jan"}}, Author{}, false},
+		{"no candidates", nil, Author{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := SelectAuthor(tt.candidates...)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("SelectAuthor() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestAuthorString(t *testing.T) {
+	if got := (Author{Name: "Jan Novak", Email: "jan@example.com"}).String(); got != "Jan Novak <jan@example.com>" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestCommitAuthor(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	rdb.HSet(ctx, rediskeys.UserKey("user-1"), "name", "Jan Novak", "email", "jan@example.com")
+	rdb.HSet(ctx, rediskeys.UserKey("user-2"), "name", "No Email")
+
+	tests := []struct {
+		name   string
+		userID string
+		author Author // On the stream message
+		want   string
+	}{
+		{"message author", "user-1", Author{Name: "Jana", Email: "jana@example.com"}, "Jana <jana@example.com>"},
+		{"user hash", "user-1", Author{}, "Jan Novak <jan@example.com>"},
+		{"invalid message email falls back to hash", "user-1", Author{Name: "Jana", Email: "jana"}, "Jan Novak <jan@example.com>"},
+		{"no email anywhere", "user-2", Author{}, ""},
+		{"unknown user", "user-3", Author{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CommitAuthor(ctx, rdb, logger, tt.userID, tt.author.Name, tt.author.Email); got != tt.want {
+				t.Errorf("CommitAuthor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/repobox/runner/internal/providerapi"
+)
+
+// ErrNoVerifiedEmail is returned when the account has no usable verified email
+var ErrNoVerifiedEmail = errors.New("no verified email for provider account")
+
+// Client looks up the commit email of the provider account that owns a token
+type Client struct {
+	api *providerapi.Client
+}
+
+// NewClient creates a new identity client
+func NewClient() *Client {
+	return &Client{api: providerapi.NewClient()}
+}
+
+// AuthorEmail returns the commit email for a provider account: its verified
+// email when providerType is one of enabled, otherwise fallback. A failed
+// lookup returns fallback with the error.
+func (c *Client) AuthorEmail(ctx context.Context, enabled []string, fallback, providerType, baseURL, token string) (string, error) {
+	if !slices.Contains(enabled, providerType) {
+		return fallback, nil
+	}
+	email, err := c.Email(ctx, providerType, baseURL, token)
+	if err != nil {
+		return fallback, err
+	}
+	return email, nil
+}
+
+// Email returns the verified email of the token's account, suitable as commit author email
+// providerType is "github" or "gitlab"
+func (c *Client) Email(ctx context.Context, providerType, baseURL, token string) (string, error) {
+	switch providerType {
+	case "github":
+		return c.githubEmail(ctx, baseURL, token)
+	case "gitlab":
+		return c.gitlabEmail(ctx, baseURL, token)
+	default:
+		return "", fmt.Errorf("unknown provider type: %s", providerType)
+	}
+}
+
+// githubEmail returns the primary verified email (requires the user:email scope)
+func (c *Client) githubEmail(ctx context.Context, baseURL, token string) (string, error) {
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	apiURL := providerapi.GitHubURL(baseURL, "/user/emails")
+	if err := c.api.GetJSON(ctx, apiURL, providerapi.GitHubHeaders(token), &emails); err != nil {
+		return "", fmt.Errorf("GitHub emails: %w", err)
+	}
+
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			return e.Email, nil
+		}
+	}
+	return "", ErrNoVerifiedEmail
+}
+
+// gitlabEmail returns the account's commit email, falling back to its primary email.
+// GitLab only allows confirmed addresses for both.
+func (c *Client) gitlabEmail(ctx context.Context, baseURL, token string) (string, error) {
+	var user struct {
+		Email       string `json:"email"`
+		CommitEmail string `json:"commit_email"`
+	}
+	apiURL := providerapi.GitLabURL(baseURL, "/user")
+	if err := c.api.GetJSON(ctx, apiURL, providerapi.GitLabHeaders(token), &user); err != nil {
+		return "", fmt.Errorf("GitLab user: %w", err)
+	}
+
+	if user.CommitEmail != "" {
+		return user.CommitEmail, nil
+	}
+	if user.Email != "" {
+		return user.Email, nil
+	}
+	return "", ErrNoVerifiedEmail
+}
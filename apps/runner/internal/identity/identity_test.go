@@ -0,0 +1,72 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEmail(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/user/emails":
+			switch r.Header.Get("Authorization") {
+			case "Bearer gh-token":
+				w.Write([]byte(`[
+					{"email": "old@example.com", "primary": false, "verified": true},
+					{"email": "dev@example.com", "primary": true, "verified": true}
+				]`))
+			case "Bearer gh-unverified":
+				w.Write([]byte(`[{"email": "new@example.com", "primary": true, "verified": false}]`))
+			default:
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		case "/api/v4/user":
+			switch r.Header.Get("PRIVATE-TOKEN") {
+			case "gl-token":
+				w.Write([]byte(`{"id": 1, "email": "dev@example.com", "commit_email": "commits@example.com"}`))
+			case "gl-no-commit-email":
+				w.Write([]byte(`{"id": 2, "email": "dev@example.com"}`))
+			default:
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		provider string
+		token    string
+		want     string
+		wantErr  error
+	}{
+		{"github primary verified", "github", "gh-token", "dev@example.com", nil},
+		{"github unverified", "github", "gh-unverified", "", ErrNoVerifiedEmail},
+		{"gitlab commit email", "gitlab", "gl-token", "commits@example.com", nil},
+		{"gitlab primary email", "gitlab", "gl-no-commit-email", "dev@example.com", nil},
+	}
+
+	c := NewClient()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Email(context.Background(), tt.provider, srv.URL, tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Email() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Email() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	for _, provider := range []string{"github", "gitlab", "bitbucket"} {
+		if _, err := c.Email(context.Background(), provider, srv.URL, "bad-token"); err == nil {
+			t.Errorf("Email(%s, bad token) error = nil, want error", provider)
+		}
+	}
+}
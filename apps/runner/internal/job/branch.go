@@ -0,0 +1,23 @@
+package job
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/repobox/runner/internal/git"
+	"github.com/repobox/runner/internal/mergerequest"
+)
+
+// DefaultBranch detects the repository's default branch from the clone at
+// repoPath, else asks the provider's API for repoURL's. Returns an error when
+// neither can tell.
+func DefaultBranch(ctx context.Context, g *git.Git, repoPath, providerType, baseURL, token, repoURL string) (string, error) {
+	if branch, err := g.DetectDefaultBranch(ctx, repoPath); err == nil {
+		return branch, nil
+	}
+	branch, err := mergerequest.DefaultBranch(ctx, mergerequest.ProviderType(providerType), baseURL, token, repoURL)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", git.ErrDefaultBranchUnknown, err)
+	}
+	return branch, nil
+}
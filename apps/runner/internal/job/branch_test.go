@@ -0,0 +1,51 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+
+	"github.com/repobox/runner/internal/git"
+)
+
+func TestDefaultBranch_APIFallback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v4/projects/group/project" || r.Header.Get("PRIVATE-TOKEN") != "gl-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"id": 1, "default_branch": "develop"}`))
+	}))
+	defer srv.Close()
+
+	// A repository without an origin: the clone can't tell its default branch
+	repo := t.TempDir()
+	if output, err := exec.Command("git", "init", repo).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %s", output)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		want    string
+		wantErr bool
+	}{
+		{"from the API", "gl-token", "develop", false},
+		{"lookup fails", "bad-token", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DefaultBranch(context.Background(), git.New(), repo, "gitlab", srv.URL, tt.token, "https://gitlab.example.com/group/project.git")
+			if got != tt.want {
+				t.Errorf("DefaultBranch() = %q, want %q", got, tt.want)
+			}
+			if tt.wantErr != errors.Is(err, git.ErrDefaultBranchUnknown) {
+				t.Errorf("DefaultBranch() error = %v, want ErrDefaultBranchUnknown: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package job
+
+import (
+	"errors"
+
+	"github.com/repobox/runner/internal/agent"
+	"github.com/repobox/runner/internal/git"
+	"github.com/repobox/runner/internal/mergerequest"
+)
+
+// AgentErrorCode classifies an agent failure, separating timeouts so the UI can suggest a longer limit
+func AgentErrorCode(err error) ErrorCode {
+	if errors.Is(err, agent.ErrTimeout) || errors.Is(err, agent.ErrStalled) {
+		return ErrCodeAgentTimeout
+	}
+	if errors.Is(err, agent.ErrCommandDenied) {
+		return ErrCodeCommandDenied
+	}
+	return ErrCodeAgent
+}
+
+// GitErrorCode classifies a git failure, reporting token problems as auth
+// failures and refused protected branches as policy failures. Anything else
+// keeps code.
+func GitErrorCode(code ErrorCode, err error) ErrorCode {
+	switch {
+	case errors.Is(err, git.ErrAuth):
+		return ErrCodeAuth
+	case errors.Is(err, git.ErrProtectedBranch):
+		return ErrCodeBranchPolicy
+	}
+	return code
+}
+
+// PreflightErrorCode classifies a repository preflight failure. Only definite
+// answers (repository missing, token rejected) fail the job or session; other
+// errors (network, rate limit) leave the decision to the clone.
+func PreflightErrorCode(err error) (ErrorCode, bool) {
+	switch {
+	case errors.Is(err, mergerequest.ErrAuth):
+		return ErrCodeAuth, true
+	case errors.Is(err, mergerequest.ErrRepoNotFound):
+		return ErrCodeClone, true
+	}
+	return "", false
+}
@@ -0,0 +1,29 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/repobox/runner/internal/git"
+)
+
+// CheckMergeConflicts test-merges base into the checked-out branch of repoPath
+// so the user knows whether a merge request would merge cleanly, passing a
+// warning line to warn on conflicts. Returns the has_conflicts and
+// conflict_files (one path per line) job or session fields, or an error when
+// the check couldn't run.
+func CheckMergeConflicts(ctx context.Context, g *git.Git, repoPath, base string, warn func(line string)) (map[string]interface{}, error) {
+	clean, conflicts, err := g.WouldMergeCleanly(ctx, repoPath, base)
+	if err != nil {
+		return nil, err
+	}
+	if !clean {
+		warn(fmt.Sprintf("Warning: merging into %s will conflict in %d file(s): %s", base, len(conflicts), strings.Join(conflicts, ", ")))
+	}
+	return map[string]interface{}{
+		"has_conflicts":  strconv.FormatBool(!clean),
+		"conflict_files": strings.Join(conflicts, "\n"),
+	}, nil
+}
@@ -0,0 +1,56 @@
+package job
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/repobox/runner/internal/git"
+)
+
+func TestCheckMergeConflicts(t *testing.T) {
+	origin := filepath.Join(t.TempDir(), "origin")
+	repo := filepath.Join(t.TempDir(), "repo")
+	commit := []string{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-qam"}
+	for _, args := range [][]string{
+		{"init", "-b", "main", origin},
+		{"-C", origin, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--allow-empty", "-m", "initial"},
+		{"clone", origin, repo},
+		{"-C", repo, "checkout", "-b", "repobox/work"},
+	} {
+		if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %s", args, output)
+		}
+	}
+	// Both sides add README.md with different content
+	for _, dir := range []string{origin, repo} {
+		if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte(dir+"\n"), 0644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		for _, args := range [][]string{{"-C", dir, "add", "README.md"}, append(append([]string{"-C", dir}, commit...), "readme")} {
+			if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+				t.Fatalf("git %v failed: %s", args, output)
+			}
+		}
+	}
+	if output, err := exec.Command("git", "-C", repo, "fetch", "-q", "origin").CombinedOutput(); err != nil {
+		t.Fatalf("git fetch failed: %s", output)
+	}
+
+	var lines []string
+	fields, err := CheckMergeConflicts(context.Background(), git.New(), repo, "main", func(line string) {
+		lines = append(lines, line)
+	})
+	if err != nil {
+		t.Fatalf("CheckMergeConflicts() error = %v", err)
+	}
+	if fields["has_conflicts"] != "true" || fields["conflict_files"] != "README.md" {
+		t.Errorf("fields = %v, want README.md conflicting", fields)
+	}
+	if len(lines) != 1 || !strings.Contains(lines[0], "will conflict in 1 file(s): README.md") {
+		t.Errorf("output = %q, want a conflict warning", lines)
+	}
+}
@@ -0,0 +1,71 @@
+package job
+
+import "errors"
+
+// ErrorCode classifies a job/session failure so the UI can offer targeted retry actions
+type ErrorCode string
+
+const (
+	ErrCodeInternal     ErrorCode = "internal"
+	ErrCodeWorkdir      ErrorCode = "workdir_failed"
+	ErrCodeWorkSubdir   ErrorCode = "work_subdir_invalid"
+	ErrCodeProvider     ErrorCode = "provider_failed"
+	ErrCodeAuth         ErrorCode = "auth_failed"
+	ErrCodeClone        ErrorCode = "clone_failed"
+	ErrCodeBranch       ErrorCode = "branch_failed"
+	ErrCodeBranchPolicy ErrorCode = "branch_forbidden"
+	ErrCodeAgent        ErrorCode = "agent_failed"
+	ErrCodeAgentTimeout ErrorCode = "agent_timeout"
+	ErrCodeRepoConfig   ErrorCode = "repo_config_invalid"
+	ErrCodeProtected    ErrorCode = "protected_path"
+	ErrCodeValidation   ErrorCode = "validation_failed"
+	ErrCodeCommit       ErrorCode = "commit_failed"
+	ErrCodePush         ErrorCode = "push_failed"
+	ErrCodeMR           ErrorCode = "mr_failed"
+
+	ErrCodeCommandDenied ErrorCode = "command_denied"
+
+	ErrCodePromptTooLong ErrorCode = "prompt_too_long"
+
+	ErrCodeSessionLimit   ErrorCode = "session_limit_reached"
+	ErrCodeNothingToAmend ErrorCode = "nothing_to_amend"
+
+	ErrCodeSecret ErrorCode = "secret_unavailable"
+
+	ErrCodeApprovalTimeout  ErrorCode = "approval_timeout"
+	ErrCodeApprovalRejected ErrorCode = "approval_rejected"
+	ErrCodeApprovalPending  ErrorCode = "approval_pending"
+
+	ErrCodeCancelled ErrorCode = "cancelled"
+)
+
+// Error attaches an ErrorCode to an underlying error
+type Error struct {
+	Code ErrorCode
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap tags err with a failure code. Returns nil if err is nil.
+func Wrap(code ErrorCode, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// CodeOf returns the failure code attached to err, or ErrCodeInternal if there is none
+func CodeOf(err error) ErrorCode {
+	var jobErr *Error
+	if errors.As(err, &jobErr) {
+		return jobErr.Code
+	}
+	return ErrCodeInternal
+}
@@ -0,0 +1,94 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/repobox/runner/internal/agent"
+	"github.com/repobox/runner/internal/git"
+	"github.com/repobox/runner/internal/mergerequest"
+)
+
+func TestCodeOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorCode
+	}{
+		{"untagged", errors.New("boom"), ErrCodeInternal},
+		{"tagged", Wrap(ErrCodeClone, errors.New("clone failed")), ErrCodeClone},
+		{"wrapped further", fmt.Errorf("outer: %w", Wrap(ErrCodePush, errors.New("rejected"))), ErrCodePush},
+		{"tag on outer error", Wrap(ErrCodeAgentTimeout, fmt.Errorf("agent: %w", errors.New("deadline"))), ErrCodeAgentTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CodeOf(tt.err); got != tt.want {
+				t.Errorf("CodeOf() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	if Wrap(ErrCodeMR, nil) != nil {
+		t.Error("Wrap(nil) should return nil")
+	}
+
+	inner := errors.New("push rejected")
+	err := Wrap(ErrCodePush, inner)
+	if err.Error() != inner.Error() {
+		t.Errorf("Error() = %q, want %q", err.Error(), inner.Error())
+	}
+	if !errors.Is(err, inner) {
+		t.Error("wrapped error should unwrap to the original")
+	}
+}
+
+func TestFailureCodes(t *testing.T) {
+	tests := []struct {
+		name string
+		got  ErrorCode
+		want ErrorCode
+	}{
+		{"agent timeout", AgentErrorCode(agent.ErrTimeout), ErrCodeAgentTimeout},
+		{"agent stalled", AgentErrorCode(fmt.Errorf("%w: no output for 5m0s", agent.ErrStalled)), ErrCodeAgentTimeout},
+		{"agent command denied", AgentErrorCode(fmt.Errorf("%w: rm -rf /", agent.ErrCommandDenied)), ErrCodeCommandDenied},
+		{"agent exit", AgentErrorCode(fmt.Errorf("agent exited with code 1")), ErrCodeAgent},
+		{"clone failed", GitErrorCode(ErrCodeClone, errors.New("repository not found")), ErrCodeClone},
+		{"push rejected", GitErrorCode(ErrCodePush, fmt.Errorf("git push failed: non-fast-forward")), ErrCodePush},
+		{"push auth", GitErrorCode(ErrCodePush, fmt.Errorf("%w: token missing contents:write", git.ErrAuth)), ErrCodeAuth},
+		{"push protected", GitErrorCode(ErrCodePush, fmt.Errorf("%w: refusing to push to protected branch main", git.ErrProtectedBranch)), ErrCodeBranchPolicy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("code = %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreflightErrorCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		want     ErrorCode
+		wantFail bool
+	}{
+		{"repo not found", fmt.Errorf("%w: owner/repo", mergerequest.ErrRepoNotFound), ErrCodeClone, true},
+		{"token rejected", fmt.Errorf("%w: access denied", mergerequest.ErrAuth), ErrCodeAuth, true},
+		{"api unreachable", errors.New("request failed: connection refused"), "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, fail := PreflightErrorCode(tt.err)
+			if got != tt.want || fail != tt.wantFail {
+				t.Errorf("PreflightErrorCode() = %q, %v, want %q, %v", got, fail, tt.want, tt.wantFail)
+			}
+		})
+	}
+}
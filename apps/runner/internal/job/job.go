@@ -12,6 +12,11 @@ const (
 	StatusCancelled Status = "cancelled"
 )
 
+// IsTerminal reports whether a job in this status is done
+func (s Status) IsTerminal() bool {
+	return s == StatusSuccess || s == StatusFailed || s == StatusCancelled
+}
+
 type Job struct {
 	ID           string    `json:"id"`
 	UserID       string    `json:"user_id"`
@@ -26,6 +31,7 @@ type Job struct {
 	LinesAdded   int       `json:"lines_added"`
 	LinesRemoved int       `json:"lines_removed"`
 	ErrorMessage string    `json:"error_message,omitempty"`
+	ErrorCode    ErrorCode `json:"error_code,omitempty"`
 	CreatedAt    time.Time `json:"created_at"`
 	StartedAt    time.Time `json:"started_at,omitempty"`
 	FinishedAt   time.Time `json:"finished_at,omitempty"`
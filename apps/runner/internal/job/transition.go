@@ -0,0 +1,49 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidTransition is returned when a job status change isn't allowed,
+// e.g. a late failure after the job already succeeded
+var ErrInvalidTransition = errors.New("invalid job status transition")
+
+// transitions lists the statuses each status may move to. Success and
+// cancelled are final; failed only moves back to running for a push retry.
+var transitions = map[Status][]Status{
+	StatusPending: {StatusRunning, StatusFailed, StatusCancelled},
+	// running -> running when a job is re-run after a runner died mid-job
+	StatusRunning: {StatusRunning, StatusSuccess, StatusFailed, StatusCancelled},
+	StatusFailed:  {StatusRunning},
+}
+
+// CanTransition reports whether a job may move from one status to another.
+// A job without a status yet may move to any status.
+func CanTransition(from, to Status) bool {
+	if from == "" {
+		return true
+	}
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedFrom returns the statuses that may move to the given status
+func AllowedFrom(to Status) []Status {
+	var from []Status
+	for _, s := range []Status{StatusPending, StatusRunning, StatusSuccess, StatusFailed, StatusCancelled} {
+		if CanTransition(s, to) {
+			from = append(from, s)
+		}
+	}
+	return from
+}
+
+// TransitionError describes a refused status change
+func TransitionError(from, to Status) error {
+	return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, from, to)
+}
@@ -0,0 +1,80 @@
+package job
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from Status
+		to   Status
+		want bool
+	}{
+		// Valid
+		{StatusPending, StatusRunning, true},
+		{StatusPending, StatusFailed, true},
+		{StatusPending, StatusCancelled, true},
+		{StatusRunning, StatusRunning, true},
+		{StatusRunning, StatusSuccess, true},
+		{StatusRunning, StatusFailed, true},
+		{StatusRunning, StatusCancelled, true},
+		{StatusFailed, StatusRunning, true},
+		{"", StatusRunning, true},
+		{"", StatusFailed, true},
+
+		// Invalid
+		{StatusPending, StatusPending, false},
+		{StatusPending, StatusSuccess, false},
+		{StatusRunning, StatusPending, false},
+		{StatusSuccess, StatusFailed, false},
+		{StatusSuccess, StatusRunning, false},
+		{StatusSuccess, StatusCancelled, false},
+		{StatusSuccess, StatusSuccess, false},
+		{StatusFailed, StatusSuccess, false},
+		{StatusFailed, StatusFailed, false},
+		{StatusFailed, StatusCancelled, false},
+		{StatusCancelled, StatusRunning, false},
+		{StatusCancelled, StatusFailed, false},
+		{StatusCancelled, StatusSuccess, false},
+		{"archived", StatusRunning, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"->"+string(tt.to), func(t *testing.T) {
+			if got := CanTransition(tt.from, tt.to); got != tt.want {
+				t.Errorf("CanTransition(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowedFrom(t *testing.T) {
+	tests := []struct {
+		to   Status
+		want []Status
+	}{
+		{StatusRunning, []Status{StatusPending, StatusRunning, StatusFailed}},
+		{StatusSuccess, []Status{StatusRunning}},
+		{StatusFailed, []Status{StatusPending, StatusRunning}},
+		{StatusCancelled, []Status{StatusPending, StatusRunning}},
+		{StatusPending, nil},
+	}
+
+	for _, tt := range tests {
+		if got := AllowedFrom(tt.to); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("AllowedFrom(%q) = %v, want %v", tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestTransitionError(t *testing.T) {
+	err := TransitionError(StatusSuccess, StatusFailed)
+	if !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("TransitionError() = %v, want ErrInvalidTransition", err)
+	}
+	if want := "invalid job status transition: success to failed"; err.Error() != want {
+		t.Errorf("TransitionError() = %q, want %q", err.Error(), want)
+	}
+}
@@ -0,0 +1,65 @@
+// Package joboutput writes the output entries of jobs and work sessions to Redis
+package joboutput
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/agent"
+	"github.com/repobox/runner/internal/redact"
+	rediskeys "github.com/repobox/runner/internal/redis"
+	"github.com/repobox/runner/internal/trace"
+	"github.com/repobox/runner/internal/util"
+)
+
+// Writer appends redacted entries to output lists that expire after ttl
+type Writer struct {
+	rdb      redis.Cmdable
+	seq      *rediskeys.OutputSequencer
+	redactor *redact.Redactor
+	ttl      time.Duration
+}
+
+// NewWriter creates a writer numbering entries with seq and masking secrets with redactor
+func NewWriter(rdb redis.Cmdable, seq *rediskeys.OutputSequencer, redactor *redact.Redactor, ttl time.Duration) *Writer {
+	return &Writer{rdb: rdb, seq: seq, redactor: redactor, ttl: ttl}
+}
+
+// Append adds an output line with extra entry fields to the output list at key
+func (w *Writer) Append(ctx context.Context, key, stream string, source agent.OutputSource, line string, fields map[string]interface{}) {
+	output := map[string]interface{}{
+		"timestamp": time.Now().UnixMilli(),
+		"line":      w.redactor.Redact(line),
+		"stream":    stream,
+		"source":    source,
+	}
+	if n := w.seq.Next(ctx, key); n > 0 {
+		output["seq"] = n
+	}
+	for k, v := range fields {
+		output[k] = v
+	}
+	if traceID := trace.IDFromContext(ctx); traceID != "" {
+		output["trace_id"] = traceID
+	}
+	data, _ := json.Marshal(output)
+	w.seq.Append(ctx, key, string(data), w.ttl)
+}
+
+// AppendToolResult stores the full content of a tool result under its
+// tool_use ID in the hash at resultsKey and adds its summary line with that
+// ID to the output list at key, so the UI can load the full result on demand.
+// The content is capped at maxContent after redaction. If the content can't
+// be stored, the summary is still added, without the ID, and the error is
+// returned.
+func (w *Writer) AppendToolResult(ctx context.Context, key, resultsKey, stream, toolUseID, summary, content string, maxContent int) error {
+	if err := w.rdb.HSet(ctx, resultsKey, toolUseID, util.TruncateMiddle(w.redactor.Redact(content), maxContent)).Err(); err != nil {
+		w.Append(ctx, key, stream, agent.SourceClaude, summary, nil)
+		return err
+	}
+	w.rdb.Expire(ctx, resultsKey, w.ttl)
+	w.Append(ctx, key, stream, agent.SourceClaude, summary, map[string]interface{}{"tool_use_id": toolUseID})
+	return nil
+}
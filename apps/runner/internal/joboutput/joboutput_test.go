@@ -0,0 +1,144 @@
+package joboutput
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/agent"
+	"github.com/repobox/runner/internal/redact"
+	rediskeys "github.com/repobox/runner/internal/redis"
+	"github.com/repobox/runner/internal/trace"
+)
+
+func newTestWriter(t *testing.T) (*Writer, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	redactor, err := redact.New(nil, true)
+	if err != nil {
+		t.Fatalf("redact.New() error = %v", err)
+	}
+	return NewWriter(rdb, rediskeys.NewOutputSequencer(rdb), redactor, time.Hour), rdb
+}
+
+func readEntries(t *testing.T, rdb *redis.Client, key string) []map[string]interface{} {
+	t.Helper()
+	raw, err := rdb.LRange(context.Background(), key, 0, -1).Result()
+	if err != nil {
+		t.Fatalf("LRange() error = %v", err)
+	}
+
+	entries := make([]map[string]interface{}, 0, len(raw))
+	for _, r := range raw {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(r), &entry); err != nil {
+			t.Fatalf("invalid output entry %q: %v", r, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestAppend(t *testing.T) {
+	w, rdb := newTestWriter(t)
+	ctx := trace.WithID(context.Background(), "trace-1")
+
+	secret := "ghp_" + strings.Repeat("a", 36)
+	w.Append(ctx, "out", "stderr", agent.SourceRunner, "token "+secret, map[string]interface{}{"extra": "x"})
+	w.Append(ctx, "out", "stdout", agent.SourceClaude, "second", nil)
+
+	entries := readEntries(t, rdb, "out")
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	first := entries[0]
+	if line, _ := first["line"].(string); strings.Contains(line, secret) {
+		t.Errorf("stored line %q contains the secret", line)
+	}
+	if first["stream"] != "stderr" || first["source"] != string(agent.SourceRunner) || first["extra"] != "x" || first["trace_id"] != "trace-1" {
+		t.Errorf("entry = %v, want stream, source, extra field and trace ID", first)
+	}
+	if entries[0]["seq"] == entries[1]["seq"] {
+		t.Errorf("entries share seq %v", entries[0]["seq"])
+	}
+	if ttl := rdb.TTL(ctx, "out").Val(); ttl <= 0 {
+		t.Errorf("output TTL = %v, want it to expire", ttl)
+	}
+}
+
+func TestAppendToolResult(t *testing.T) {
+	tests := []struct {
+		name        string
+		max         int
+		content     string
+		wantContent string
+	}{
+		{"stored in full", 100, "ok  \tpkg/config\t0.01s", "ok  \tpkg/config\t0.01s"},
+		{"capped", 30, strings.Repeat("a", 40) + strings.Repeat("b", 40), "aaaaa…[70 chars omitted]…bbbbb"},
+		{"no limit", 0, strings.Repeat("c", 500), strings.Repeat("c", 500)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, rdb := newTestWriter(t)
+			ctx := context.Background()
+
+			if err := w.AppendToolResult(ctx, "out", "results", "stdout", "toolu_1", "└─ summary", tt.content, tt.max); err != nil {
+				t.Fatalf("AppendToolResult() error = %v", err)
+			}
+
+			got, err := rdb.HGet(ctx, "results", "toolu_1").Result()
+			if err != nil {
+				t.Fatalf("HGet() error = %v", err)
+			}
+			if got != tt.wantContent {
+				t.Errorf("stored tool result = %q, want %q", got, tt.wantContent)
+			}
+
+			// The log keeps the summary, linked to the full result
+			entries := readEntries(t, rdb, "out")
+			if len(entries) != 1 || entries[0]["line"] != "└─ summary" || entries[0]["tool_use_id"] != "toolu_1" || entries[0]["source"] != string(agent.SourceClaude) {
+				t.Errorf("output = %v, want the summary line with its tool_use_id", entries)
+			}
+		})
+	}
+}
+
+func TestAppendToolResult_RedactsSecrets(t *testing.T) {
+	w, rdb := newTestWriter(t)
+	ctx := context.Background()
+
+	secret := "ghp_" + strings.Repeat("a", 36)
+	if err := w.AppendToolResult(ctx, "out", "results", "stdout", "toolu_1", "└─ env", "GITHUB_TOKEN="+secret, 1000); err != nil {
+		t.Fatalf("AppendToolResult() error = %v", err)
+	}
+
+	if got, _ := rdb.HGet(ctx, "results", "toolu_1").Result(); strings.Contains(got, secret) || got == "" {
+		t.Errorf("stored tool result = %q, want the token masked", got)
+	}
+}
+
+func TestAppendToolResult_StoreFails(t *testing.T) {
+	w, rdb := newTestWriter(t)
+	ctx := context.Background()
+
+	// A string at the results key makes HSET fail
+	if err := rdb.Set(ctx, "results", "not a hash", 0).Err(); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := w.AppendToolResult(ctx, "out", "results", "stdout", "toolu_1", "└─ summary", "content", 100); err == nil {
+		t.Error("AppendToolResult() error = nil, want the store error")
+	}
+
+	entries := readEntries(t, rdb, "out")
+	if len(entries) != 1 || entries[0]["line"] != "└─ summary" || entries[0]["tool_use_id"] != nil {
+		t.Errorf("output = %v, want the summary line without a tool_use_id", entries)
+	}
+}
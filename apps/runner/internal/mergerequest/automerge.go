@@ -0,0 +1,139 @@
+package mergerequest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AutoMergeParams identifies the MR/PR to enable auto-merge on
+type AutoMergeParams struct {
+	Token     string // Plaintext access token
+	BaseURL   string // Provider base URL
+	ProjectID string // GitLab: numeric ID or path, GitHub: owner/repo
+	Result    *Result
+}
+
+// AutoMerger enables auto-merge, so the MR/PR merges once its pipeline/checks pass
+type AutoMerger interface {
+	EnableAutoMerge(ctx context.Context, params AutoMergeParams) error
+}
+
+const githubAutoMergeMutation = `mutation($id: ID!) {
+  enablePullRequestAutoMerge(input: {pullRequestId: $id}) {
+    clientMutationId
+  }
+}`
+
+// EnableAutoMerge enables auto-merge on a pull request via the GraphQL API.
+// Requires auto-merge to be allowed in the repository settings.
+func (c *GitHubClient) EnableAutoMerge(ctx context.Context, params AutoMergeParams) error {
+	if params.Result == nil || params.Result.NodeID == "" {
+		return fmt.Errorf("pull request node ID unknown")
+	}
+
+	apiURL := "https://api.github.com/graphql"
+	if params.BaseURL != "" && params.BaseURL != "https://github.com" {
+		// GitHub Enterprise serves GraphQL at /api/graphql
+		apiURL = strings.TrimSuffix(params.BaseURL, "/") + "/api/graphql"
+	}
+
+	bodyBytes, err := json.Marshal(map[string]interface{}{
+		"query":     githubAutoMergeMutation,
+		"variables": map[string]string{"id": params.Result.NodeID},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", params.Token))
+
+	respBody, status, err := doRequest(c.httpClient, req)
+	if err != nil {
+		return err
+	}
+	if status < 200 || status >= 300 {
+		return fmt.Errorf("GitHub API error (status %d): %s", status, respBody)
+	}
+
+	// GraphQL reports failures with 200 and an errors array
+	var gqlResp struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(respBody, &gqlResp); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(gqlResp.Errors) > 0 {
+		return fmt.Errorf("GitHub API error: %s", gqlResp.Errors[0].Message)
+	}
+	return nil
+}
+
+// EnableAutoMerge sets the merge request to merge when its pipeline succeeds
+func (c *GitLabClient) EnableAutoMerge(ctx context.Context, params AutoMergeParams) error {
+	if params.Result == nil || params.Result.Number == 0 {
+		return fmt.Errorf("merge request IID unknown")
+	}
+
+	baseURL := params.BaseURL
+	if baseURL == "" {
+		baseURL = "https://gitlab.com"
+	}
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s/merge_requests/%d/merge?merge_when_pipeline_succeeds=true",
+		strings.TrimSuffix(baseURL, "/"),
+		url.PathEscape(params.ProjectID),
+		params.Result.Number,
+	)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, apiURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("PRIVATE-TOKEN", params.Token)
+
+	respBody, status, err := doRequest(c.httpClient, req)
+	if err != nil {
+		return err
+	}
+	if status < 200 || status >= 300 {
+		// 405/406/422: no pipeline, not mergeable yet or conflicts
+		var errResp gitlabError
+		_ = json.Unmarshal(respBody, &errResp)
+		msg := errResp.Error
+		if m, ok := errResp.Message.(string); ok && msg == "" {
+			msg = m
+		}
+		if msg == "" {
+			msg = string(respBody)
+		}
+		return fmt.Errorf("GitLab API error (status %d): %s", status, msg)
+	}
+	return nil
+}
+
+// doRequest sends req with client and returns the response body and status code
+func doRequest(client *http.Client, req *http.Request) ([]byte, int, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read response: %w", err)
+	}
+	return body, resp.StatusCode, nil
+}
@@ -0,0 +1,118 @@
+package mergerequest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEnableAutoMerge(t *testing.T) {
+	tests := []struct {
+		name     string
+		merger   AutoMerger
+		result   *Result
+		status   int
+		body     string
+		wantReq  string
+		wantErr  bool
+		checkReq func(t *testing.T, r *http.Request)
+	}{
+		{
+			name:    "github",
+			merger:  NewGitHubClient(),
+			result:  &Result{Number: 7, NodeID: "PR_kwDO"},
+			status:  http.StatusOK,
+			body:    `{"data": {"enablePullRequestAutoMerge": {"clientMutationId": null}}}`,
+			wantReq: "POST /api/graphql",
+			checkReq: func(t *testing.T, r *http.Request) {
+				var req struct {
+					Query     string            `json:"query"`
+					Variables map[string]string `json:"variables"`
+				}
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Fatalf("invalid request body: %v", err)
+				}
+				if !strings.Contains(req.Query, "enablePullRequestAutoMerge") {
+					t.Errorf("query = %q, want enablePullRequestAutoMerge mutation", req.Query)
+				}
+				if req.Variables["id"] != "PR_kwDO" {
+					t.Errorf("id = %q, want PR_kwDO", req.Variables["id"])
+				}
+				if r.Header.Get("Authorization") != "Bearer token" {
+					t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+				}
+			},
+		},
+		{
+			name:    "github graphql error",
+			merger:  NewGitHubClient(),
+			result:  &Result{Number: 7, NodeID: "PR_kwDO"},
+			status:  http.StatusOK,
+			body:    `{"data": null, "errors": [{"message": "Pull request Auto merge is not allowed for this repository"}]}`,
+			wantReq: "POST /api/graphql",
+			wantErr: true,
+		},
+		{
+			name:    "github node ID missing",
+			merger:  NewGitHubClient(),
+			result:  &Result{Number: 7},
+			wantErr: true,
+		},
+		{
+			name:    "gitlab",
+			merger:  NewGitLabClient(),
+			result:  &Result{Number: 7},
+			status:  http.StatusOK,
+			body:    `{"iid": 7, "merge_when_pipeline_succeeds": true}`,
+			wantReq: "PUT /api/v4/projects/owner/repo/merge_requests/7/merge",
+			checkReq: func(t *testing.T, r *http.Request) {
+				if r.URL.Query().Get("merge_when_pipeline_succeeds") != "true" {
+					t.Errorf("query = %q, want merge_when_pipeline_succeeds=true", r.URL.RawQuery)
+				}
+				if r.Header.Get("PRIVATE-TOKEN") != "token" {
+					t.Errorf("PRIVATE-TOKEN = %q", r.Header.Get("PRIVATE-TOKEN"))
+				}
+			},
+		},
+		{
+			name:    "gitlab not mergeable",
+			merger:  NewGitLabClient(),
+			result:  &Result{Number: 7},
+			status:  http.StatusMethodNotAllowed,
+			body:    `{"message": "405 Method Not Allowed"}`,
+			wantReq: "PUT /api/v4/projects/owner/repo/merge_requests/7/merge",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotReq string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotReq = r.Method + " " + r.URL.Path
+				if tt.checkReq != nil {
+					tt.checkReq(t, r)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			err := tt.merger.EnableAutoMerge(context.Background(), AutoMergeParams{
+				Token:     "token",
+				BaseURL:   srv.URL,
+				ProjectID: "owner/repo",
+				Result:    tt.result,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("EnableAutoMerge() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if gotReq != tt.wantReq {
+				t.Errorf("request = %q, want %q", gotReq, tt.wantReq)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package mergerequest
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// azureMaxDescription is the longest PR description Azure DevOps accepts
+const azureMaxDescription = 4000
+
+// AzureDevOpsClient creates pull requests on Azure DevOps
+type AzureDevOpsClient struct {
+	httpClient *http.Client
+}
+
+// NewAzureDevOpsClient creates a new Azure DevOps PR client
+// Supports HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables
+func NewAzureDevOpsClient() *AzureDevOpsClient {
+	return &AzureDevOpsClient{
+		httpClient: newHTTPClient(),
+	}
+}
+
+type azurePRRequest struct {
+	SourceRefName string `json:"sourceRefName"`
+	TargetRefName string `json:"targetRefName"`
+	Title         string `json:"title"`
+	Description   string `json:"description"`
+}
+
+type azurePRResponse struct {
+	PullRequestID int `json:"pullRequestId"`
+	Repository    struct {
+		WebURL string `json:"webUrl"`
+	} `json:"repository"`
+}
+
+type azureError struct {
+	Message string `json:"message"`
+}
+
+// Create creates a pull request on Azure DevOps
+func (c *AzureDevOpsClient) Create(ctx context.Context, params CreateParams) (*Result, error) {
+	apiURL, err := azurePullRequestsURL(params.BaseURL, params.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	reqBody := azurePRRequest{
+		SourceRefName: azureBranchRef(params.SourceBranch),
+		TargetRefName: azureBranchRef(params.TargetBranch),
+		Title:         params.Title,
+		Description:   truncateRunes(params.Description, azureMaxDescription),
+	}
+
+	bodyBytes, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", azureBasicAuth(params.Token))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if authErr := azureAuthError(resp.StatusCode, params.ProjectID); authErr != nil {
+		return nil, authErr
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var errResp azureError
+		errMsg := string(respBody)
+		if json.Unmarshal(respBody, &errResp) == nil && errResp.Message != "" {
+			errMsg = errResp.Message
+		}
+		return nil, fmt.Errorf("Azure DevOps API error (status %d): %s", resp.StatusCode, errMsg)
+	}
+
+	var prResp azurePRResponse
+	if err := json.Unmarshal(respBody, &prResp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &Result{
+		URL:    fmt.Sprintf("%s/pullrequest/%d", strings.TrimSuffix(prResp.Repository.WebURL, "/"), prResp.PullRequestID),
+		Number: prResp.PullRequestID,
+		ID:     fmt.Sprintf("%d", prResp.PullRequestID),
+	}, nil
+}
+
+// azurePullRequestsURL builds the pull request endpoint from an
+// "org/project/repo" project ID (Azure DevOps Server: "collection/project/repo")
+func azurePullRequestsURL(baseURL, projectID string) (string, error) {
+	if baseURL == "" {
+		baseURL = "https://dev.azure.com"
+	}
+
+	segments := strings.Split(projectID, "/")
+	if len(segments) < 3 {
+		return "", fmt.Errorf("%w: %q, expected org/project/repo", ErrInvalidProjectID, projectID)
+	}
+	repo := segments[len(segments)-1]
+	for i, s := range segments[:len(segments)-1] {
+		segments[i] = url.PathEscape(s)
+	}
+
+	return fmt.Sprintf("%s/%s/_apis/git/repositories/%s/pullrequests?api-version=7.0",
+		strings.TrimSuffix(baseURL, "/"),
+		strings.Join(segments[:len(segments)-1], "/"),
+		url.PathEscape(repo),
+	), nil
+}
+
+// azureBranchRef converts a branch name to the full ref Azure DevOps expects
+func azureBranchRef(branch string) string {
+	if strings.HasPrefix(branch, "refs/") {
+		return branch
+	}
+	return "refs/heads/" + branch
+}
+
+// azureBasicAuth returns the Authorization header for a personal access token
+// (basic auth with an empty user name)
+func azureBasicAuth(token string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(":"+token))
+}
+
+// truncateRunes shortens s to at most max characters
+func truncateRunes(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-1]) + "…"
+}
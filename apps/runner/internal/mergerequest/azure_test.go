@@ -0,0 +1,133 @@
+package mergerequest
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAzureDevOpsClient_Create(t *testing.T) {
+	var got azurePRRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/contoso/web/_apis/git/repositories/frontend/pullrequests" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if v := r.URL.Query().Get("api-version"); v != "7.0" {
+			t.Errorf("api-version = %q, want 7.0", v)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Basic "+base64.StdEncoding.EncodeToString([]byte(":pat")) {
+			t.Errorf("Authorization = %q, want basic auth with empty user", auth)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("invalid body: %v", err)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{
+			"pullRequestId": 42,
+			"url": "https://dev.azure.com/contoso/web/_apis/git/repositories/1234/pullRequests/42",
+			"repository": {"id": "1234", "webUrl": "https://dev.azure.com/contoso/web/_git/frontend"}
+		}`))
+	}))
+	defer srv.Close()
+
+	result, err := NewAzureDevOpsClient().Create(context.Background(), CreateParams{
+		Token:        "pat",
+		BaseURL:      srv.URL,
+		ProjectID:    "contoso/web/frontend",
+		Title:        "repobox: fix",
+		Description:  "body",
+		SourceBranch: "repobox/abc",
+		TargetBranch: "refs/heads/main",
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if got.SourceRefName != "refs/heads/repobox/abc" || got.TargetRefName != "refs/heads/main" {
+		t.Errorf("refs = %q -> %q, want refs/heads/repobox/abc -> refs/heads/main", got.SourceRefName, got.TargetRefName)
+	}
+	if got.Title != "repobox: fix" || got.Description != "body" {
+		t.Errorf("title/description = %q/%q", got.Title, got.Description)
+	}
+	if result.URL != "https://dev.azure.com/contoso/web/_git/frontend/pullrequest/42" {
+		t.Errorf("URL = %q", result.URL)
+	}
+	if result.Number != 42 || result.ID != "42" {
+		t.Errorf("Number/ID = %d/%s, want 42", result.Number, result.ID)
+	}
+}
+
+func TestAzureDevOpsClient_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		wantAuth bool
+		wantMsg  string
+	}{
+		{"invalid PAT sign-in page", http.StatusNonAuthoritativeInfo, "<html>Sign in</html>", true, "invalid or expired"},
+		{"unauthorized", http.StatusUnauthorized, "", true, "invalid or expired"},
+		{"missing scope", http.StatusForbidden, `{"message": "denied"}`, true, "Code (Read & Write)"},
+		{"existing PR", http.StatusConflict, `{"message": "TF401179: An active pull request already exists."}`, false, "TF401179"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			_, err := NewAzureDevOpsClient().Create(context.Background(), CreateParams{BaseURL: srv.URL, ProjectID: "contoso/web/frontend"})
+			if err == nil {
+				t.Fatal("Create() error = nil")
+			}
+			if errors.Is(err, ErrAuth) != tt.wantAuth {
+				t.Errorf("Create() error = %v, want ErrAuth %v", err, tt.wantAuth)
+			}
+			if !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("Create() error = %v, want it to mention %q", err, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestAzurePullRequestsURL(t *testing.T) {
+	tests := []struct {
+		baseURL   string
+		projectID string
+		want      string
+		wantErr   bool
+	}{
+		{"", "contoso/web/frontend", "https://dev.azure.com/contoso/web/_apis/git/repositories/frontend/pullrequests?api-version=7.0", false},
+		{"https://tfs.example.com/", "tfs/main/web/frontend", "https://tfs.example.com/tfs/main/web/_apis/git/repositories/frontend/pullrequests?api-version=7.0", false},
+		{"", "contoso/My Project/frontend", "https://dev.azure.com/contoso/My%20Project/_apis/git/repositories/frontend/pullrequests?api-version=7.0", false},
+		{"", "contoso/frontend", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := azurePullRequestsURL(tt.baseURL, tt.projectID)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("azurePullRequestsURL(%q) error = %v, wantErr %v", tt.projectID, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("azurePullRequestsURL(%q, %q) = %q, want %q", tt.baseURL, tt.projectID, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateRunes(t *testing.T) {
+	if got := truncateRunes("short", 10); got != "short" {
+		t.Errorf("truncateRunes() = %q, want unchanged", got)
+	}
+	if got := truncateRunes("ééééé", 3); got != "éé…" {
+		t.Errorf("truncateRunes() = %q, want éé…", got)
+	}
+}
@@ -0,0 +1,216 @@
+package mergerequest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// MRState is the state of a merge request as far as branch cleanup cares
+type MRState string
+
+const (
+	MRStateOpen   MRState = "open"
+	MRStateMerged MRState = "merged"
+	MRStateClosed MRState = "closed"
+)
+
+// BranchParams identifies a branch of a repository
+type BranchParams struct {
+	Token     string // Plaintext access token
+	BaseURL   string // Provider base URL
+	ProjectID string // GitLab: numeric ID or path, GitHub: owner/repo
+	Branch    string
+}
+
+// BranchCleaner looks up the merge requests opened from a branch and deletes branches
+type BranchCleaner interface {
+	// BranchMergeRequests returns the states of all MRs/PRs whose source is the branch
+	BranchMergeRequests(ctx context.Context, params BranchParams) ([]MRState, error)
+	// DeleteBranch deletes the branch; a branch that is already gone is not an error
+	DeleteBranch(ctx context.Context, params BranchParams) error
+}
+
+// GetBranchCleaner returns the branch cleaner for the provider type, nil if unsupported
+func GetBranchCleaner(providerType ProviderType) BranchCleaner {
+	switch providerType {
+	case ProviderGitHub:
+		return NewGitHubClient()
+	case ProviderGitLab:
+		return NewGitLabClient()
+	default:
+		return nil
+	}
+}
+
+// BranchMergeRequests lists pull requests with GET /repos/{owner}/{repo}/pulls?head=owner:branch
+func (c *GitHubClient) BranchMergeRequests(ctx context.Context, params BranchParams) ([]MRState, error) {
+	owner, _, _ := strings.Cut(params.ProjectID, "/")
+	query := url.Values{
+		"state":    {"all"},
+		"head":     {owner + ":" + params.Branch},
+		"per_page": {"100"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, githubRepoAPIURL(params.BaseURL, params.ProjectID)+"/pulls?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	c.setHeaders(req, params.Token)
+
+	respBody, status, err := doRequest(c.httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, githubStatusError(status, respBody, params.ProjectID)
+	}
+
+	var pulls []struct {
+		State    string  `json:"state"`
+		MergedAt *string `json:"merged_at"`
+	}
+	if err := json.Unmarshal(respBody, &pulls); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	states := make([]MRState, 0, len(pulls))
+	for _, p := range pulls {
+		switch {
+		case p.State == "open":
+			states = append(states, MRStateOpen)
+		case p.MergedAt != nil:
+			states = append(states, MRStateMerged)
+		default:
+			states = append(states, MRStateClosed)
+		}
+	}
+	return states, nil
+}
+
+// DeleteBranch deletes the branch with DELETE /repos/{owner}/{repo}/git/refs/heads/{branch}
+func (c *GitHubClient) DeleteBranch(ctx context.Context, params BranchParams) error {
+	apiURL := githubRepoAPIURL(params.BaseURL, params.ProjectID) + "/git/refs/heads/" + params.Branch
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, apiURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	c.setHeaders(req, params.Token)
+
+	respBody, status, err := doRequest(c.httpClient, req)
+	if err != nil {
+		return err
+	}
+	// 422 "Reference does not exist" - already deleted, e.g. by the merge
+	if status == http.StatusNoContent || status == http.StatusNotFound || status == http.StatusUnprocessableEntity {
+		return nil
+	}
+	return githubStatusError(status, respBody, params.ProjectID)
+}
+
+// setHeaders sets the GitHub API headers
+func (c *GitHubClient) setHeaders(req *http.Request, token string) {
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+}
+
+// githubStatusError describes an unexpected GitHub API response
+func githubStatusError(status int, respBody []byte, projectID string) error {
+	var ghErr githubError
+	_ = json.Unmarshal(respBody, &ghErr)
+	if err := githubAuthError(status, "", ghErr.Message, projectID); err != nil {
+		return err
+	}
+	return fmt.Errorf("GitHub API error (status %d): %s", status, ghErr.Message)
+}
+
+// BranchMergeRequests lists merge requests with GET /api/v4/projects/{id}/merge_requests?source_branch=branch
+func (c *GitLabClient) BranchMergeRequests(ctx context.Context, params BranchParams) ([]MRState, error) {
+	query := url.Values{
+		"state":         {"all"},
+		"source_branch": {params.Branch},
+		"per_page":      {"100"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gitlabProjectAPIURL(params.BaseURL, params.ProjectID)+"/merge_requests?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("PRIVATE-TOKEN", params.Token)
+
+	respBody, status, err := doRequest(c.httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, gitlabStatusError(status, respBody, params.ProjectID)
+	}
+
+	var mrs []struct {
+		State string `json:"state"`
+	}
+	if err := json.Unmarshal(respBody, &mrs); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	states := make([]MRState, 0, len(mrs))
+	for _, mr := range mrs {
+		switch mr.State {
+		case "merged":
+			states = append(states, MRStateMerged)
+		case "closed":
+			states = append(states, MRStateClosed)
+		default:
+			// opened, locked
+			states = append(states, MRStateOpen)
+		}
+	}
+	return states, nil
+}
+
+// DeleteBranch deletes the branch with DELETE /api/v4/projects/{id}/repository/branches/{branch}
+func (c *GitLabClient) DeleteBranch(ctx context.Context, params BranchParams) error {
+	apiURL := gitlabProjectAPIURL(params.BaseURL, params.ProjectID) + "/repository/branches/" + url.PathEscape(params.Branch)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, apiURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("PRIVATE-TOKEN", params.Token)
+
+	respBody, status, err := doRequest(c.httpClient, req)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusNoContent || status == http.StatusNotFound {
+		return nil
+	}
+	return gitlabStatusError(status, respBody, params.ProjectID)
+}
+
+// gitlabProjectAPIURL returns the API URL of a project
+func gitlabProjectAPIURL(baseURL, projectID string) string {
+	if baseURL == "" {
+		baseURL = "https://gitlab.com"
+	}
+	return fmt.Sprintf("%s/api/v4/projects/%s", strings.TrimSuffix(baseURL, "/"), url.PathEscape(projectID))
+}
+
+// gitlabStatusError describes an unexpected GitLab API response
+func gitlabStatusError(status int, respBody []byte, projectID string) error {
+	var errResp gitlabError
+	_ = json.Unmarshal(respBody, &errResp)
+	msg := errResp.Error
+	if m, ok := errResp.Message.(string); ok && msg == "" {
+		msg = m
+	}
+
+	switch status {
+	case http.StatusUnauthorized:
+		return fmt.Errorf("%w: GitLab token is invalid or expired (%s)", ErrAuth, msg)
+	case http.StatusForbidden:
+		return fmt.Errorf("%w: access to %s denied (%s)", ErrAuth, projectID, msg)
+	}
+	return fmt.Errorf("GitLab API error (status %d): %s", status, msg)
+}
@@ -0,0 +1,156 @@
+package mergerequest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCreate_ContextDeadline(t *testing.T) {
+	// Server hangs until the test finishes
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	tests := []struct {
+		name    string
+		creator Creator
+	}{
+		{"github", NewGitHubClient()},
+		{"gitlab", NewGitLabClient()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			_, err := tt.creator.Create(ctx, CreateParams{
+				Token:        "token",
+				BaseURL:      srv.URL,
+				ProjectID:    "owner/repo",
+				Title:        "title",
+				SourceBranch: "repobox/abc",
+				TargetBranch: "main",
+			})
+
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("Create() error = %v, want context.DeadlineExceeded", err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("Create() returned after %v, should stop at the context deadline", elapsed)
+			}
+		})
+	}
+}
+
+func TestCreate_ContextCancel(t *testing.T) {
+	// Server signals each request, then hangs until the test finishes
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	tests := []struct {
+		name      string
+		creator   Creator
+		projectID string
+	}{
+		{"github", NewGitHubClient(), "owner/repo"},
+		{"gitlab", NewGitLabClient(), "group/project"},
+		{"azure", NewAzureDevOpsClient(), "org/project/repo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// Cancel once the request is in flight, as a job cancel would
+			go func() {
+				<-started
+				cancel()
+			}()
+
+			_, err := tt.creator.Create(ctx, CreateParams{
+				Token:        "token",
+				BaseURL:      srv.URL,
+				ProjectID:    tt.projectID,
+				Title:        "title",
+				SourceBranch: "repobox/abc",
+				TargetBranch: "main",
+			})
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("Create() error = %v, want context.Canceled", err)
+			}
+		})
+	}
+}
+
+func TestSetHTTPTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	SetHTTPTimeout(50 * time.Millisecond)
+	defer SetHTTPTimeout(DefaultHTTPTimeout)
+	client := NewGitHubClient()
+
+	// No deadline on the context, the client timeout ends the request
+	start := time.Now()
+	_, err := client.Create(context.Background(), CreateParams{
+		Token:        "token",
+		BaseURL:      srv.URL,
+		ProjectID:    "owner/repo",
+		Title:        "title",
+		SourceBranch: "repobox/abc",
+		TargetBranch: "main",
+	})
+	if err == nil {
+		t.Fatal("Create() error = nil, want a client timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Create() returned after %v, should stop at the client timeout", elapsed)
+	}
+}
+
+func TestCreate_Success(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		switch r.URL.Path {
+		case "/api/v3/repos/owner/repo/pulls":
+			w.Write([]byte(`{"id": 1, "number": 7, "html_url": "https://example.com/pr/7"}`))
+		case "/api/v4/projects/owner/repo/merge_requests":
+			w.Write([]byte(`{"id": 1, "iid": 7, "web_url": "https://example.com/mr/7"}`))
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	for name, creator := range map[string]Creator{"github": NewGitHubClient(), "gitlab": NewGitLabClient()} {
+		t.Run(name, func(t *testing.T) {
+			result, err := creator.Create(context.Background(), CreateParams{BaseURL: srv.URL, ProjectID: "owner/repo"})
+			if err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			if result.Number != 7 {
+				t.Errorf("Number = %d, want 7", result.Number)
+			}
+		})
+	}
+}
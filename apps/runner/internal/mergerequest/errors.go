@@ -0,0 +1,72 @@
+package mergerequest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrAuth indicates the provider rejected the token (invalid, expired or missing permissions)
+var ErrAuth = errors.New("provider authentication failed")
+
+// githubAuthError translates a GitHub 401/403 response into an actionable error.
+// acceptedPerms is the X-Accepted-GitHub-Permissions header sent for fine-grained tokens.
+// Returns nil if the response is not an auth failure.
+func githubAuthError(status int, acceptedPerms, message, projectID string) error {
+	switch status {
+	case http.StatusUnauthorized:
+		return fmt.Errorf("%w: GitHub token is invalid or expired (%s)", ErrAuth, message)
+	case http.StatusForbidden:
+		lower := strings.ToLower(message)
+		// Rate limiting also uses 403 - don't misreport it as a permission problem
+		if strings.Contains(lower, "rate limit") {
+			return nil
+		}
+		if acceptedPerms != "" {
+			return fmt.Errorf("%w: token missing %s for %s", ErrAuth, formatGitHubPermissions(acceptedPerms), projectID)
+		}
+		if strings.Contains(lower, "resource not accessible") || strings.Contains(lower, "permission") {
+			return fmt.Errorf("%w: token missing pull_requests:write for %s", ErrAuth, projectID)
+		}
+		return fmt.Errorf("%w: access to %s denied (%s)", ErrAuth, projectID, message)
+	}
+	return nil
+}
+
+// formatGitHubPermissions converts "pull_requests=write, contents=read" to "pull_requests:write, contents:read"
+func formatGitHubPermissions(header string) string {
+	parts := strings.Split(header, ",")
+	for i, p := range parts {
+		parts[i] = strings.ReplaceAll(strings.TrimSpace(p), "=", ":")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// azureAuthError translates an Azure DevOps auth failure into an actionable error.
+// An invalid PAT can also get a 203 with the HTML sign-in page instead of a 401.
+// Returns nil if the response is not an auth failure.
+func azureAuthError(status int, projectID string) error {
+	switch status {
+	case http.StatusNonAuthoritativeInfo, http.StatusUnauthorized:
+		return fmt.Errorf("%w: Azure DevOps token is invalid or expired", ErrAuth)
+	case http.StatusForbidden:
+		return fmt.Errorf("%w: token missing Code (Read & Write) scope for %s", ErrAuth, projectID)
+	}
+	return nil
+}
+
+// gitlabAuthError translates a GitLab 401/403 response into an actionable error.
+// Returns nil if the response is not an auth failure.
+func gitlabAuthError(status int, message, projectID string) error {
+	switch status {
+	case http.StatusUnauthorized:
+		return fmt.Errorf("%w: GitLab token is invalid or expired (%s)", ErrAuth, message)
+	case http.StatusForbidden:
+		if strings.Contains(strings.ToLower(message), "insufficient_scope") {
+			return fmt.Errorf("%w: token missing api scope for %s", ErrAuth, projectID)
+		}
+		return fmt.Errorf("%w: token lacks permission to create merge requests in %s (requires api scope and Developer role)", ErrAuth, projectID)
+	}
+	return nil
+}
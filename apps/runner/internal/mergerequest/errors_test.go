@@ -0,0 +1,96 @@
+package mergerequest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGitHubAuthError(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		acceptedPerms string
+		message       string
+		want          string
+	}{
+		{
+			name:    "bad credentials",
+			status:  401,
+			message: "Bad credentials",
+			want:    "GitHub token is invalid or expired",
+		},
+		{
+			name:          "fine-grained token with accepted permissions header",
+			status:        403,
+			acceptedPerms: "pull_requests=write",
+			message:       "Resource not accessible by personal access token",
+			want:          "token missing pull_requests:write for owner/repo",
+		},
+		{
+			name:    "classic token without header",
+			status:  403,
+			message: "Resource not accessible by personal access token",
+			want:    "token missing pull_requests:write for owner/repo",
+		},
+		{
+			name:    "rate limited",
+			status:  403,
+			message: "API rate limit exceeded for user",
+			want:    "",
+		},
+		{
+			name:    "validation error",
+			status:  422,
+			message: "Validation Failed: A pull request already exists",
+			want:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := githubAuthError(tt.status, tt.acceptedPerms, tt.message, "owner/repo")
+			assertAuthError(t, err, tt.want)
+		})
+	}
+}
+
+func TestGitLabAuthError(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		message string
+		want    string
+	}{
+		{"unauthorized", 401, "401 Unauthorized", "GitLab token is invalid or expired"},
+		{"insufficient scope", 403, "insufficient_scope", "token missing api scope for group/project"},
+		{"forbidden", 403, "403 Forbidden", "token lacks permission to create merge requests in group/project"},
+		{"conflict", 409, "Another open merge request already exists", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := gitlabAuthError(tt.status, tt.message, "group/project")
+			assertAuthError(t, err, tt.want)
+		})
+	}
+}
+
+func assertAuthError(t *testing.T, err error, want string) {
+	t.Helper()
+	if want == "" {
+		if err != nil {
+			t.Errorf("got %v, want nil", err)
+		}
+		return
+	}
+	if err == nil {
+		t.Fatalf("got nil, want error containing %q", want)
+	}
+	if !errors.Is(err, ErrAuth) {
+		t.Errorf("error should wrap ErrAuth: %v", err)
+	}
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("got %q, want it to contain %q", err.Error(), want)
+	}
+}
@@ -2,12 +2,12 @@ package mergerequest
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
-	"time"
 )
 
 // GitHubClient creates pull requests on GitHub
@@ -19,12 +19,7 @@ type GitHubClient struct {
 // Supports HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables
 func NewGitHubClient() *GitHubClient {
 	return &GitHubClient{
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				Proxy: http.ProxyFromEnvironment,
-			},
-		},
+		httpClient: newHTTPClient(),
 	}
 }
 
@@ -37,6 +32,7 @@ type githubPRRequest struct {
 
 type githubPRResponse struct {
 	ID      int    `json:"id"`
+	NodeID  string `json:"node_id"`
 	Number  int    `json:"number"`
 	HTMLURL string `json:"html_url"`
 }
@@ -49,7 +45,7 @@ type githubError struct {
 }
 
 // Create creates a pull request on GitHub
-func (c *GitHubClient) Create(params CreateParams) (*Result, error) {
+func (c *GitHubClient) Create(ctx context.Context, params CreateParams) (*Result, error) {
 	apiURL := c.getAPIURL(params.BaseURL, params.ProjectID)
 
 	reqBody := githubPRRequest{
@@ -64,7 +60,7 @@ func (c *GitHubClient) Create(params CreateParams) (*Result, error) {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest(http.MethodPost, apiURL, bytes.NewReader(bodyBytes))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(bodyBytes))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -97,6 +93,10 @@ func (c *GitHubClient) Create(params CreateParams) (*Result, error) {
 			errMsg = string(respBody)
 		}
 
+		if authErr := githubAuthError(resp.StatusCode, resp.Header.Get("X-Accepted-GitHub-Permissions"), errMsg, params.ProjectID); authErr != nil {
+			return nil, authErr
+		}
+
 		return nil, fmt.Errorf("GitHub API error (status %d): %s", resp.StatusCode, errMsg)
 	}
 
@@ -105,22 +105,27 @@ func (c *GitHubClient) Create(params CreateParams) (*Result, error) {
 		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
 
-	return &Result{
-		URL:    prResp.HTMLURL,
-		Number: prResp.Number,
-		ID:     fmt.Sprintf("%d", prResp.ID),
-	}, nil
+	return prResp.result(), nil
 }
 
 // getAPIURL returns the API URL for creating PRs
-// Handles both github.com and GitHub Enterprise
 func (c *GitHubClient) getAPIURL(baseURL, projectID string) string {
+	return githubRepoAPIURL(baseURL, projectID) + "/pulls"
+}
+
+// githubRepoAPIURL returns the API URL of a repository
+func githubRepoAPIURL(baseURL, projectID string) string {
 	// projectID should be in format "owner/repo"
+	return fmt.Sprintf("%s/repos/%s", githubAPIURL(baseURL), projectID)
+}
+
+// githubAPIURL returns the API root
+// Handles both github.com and GitHub Enterprise
+func githubAPIURL(baseURL string) string {
 	if baseURL == "" || baseURL == "https://github.com" {
-		return fmt.Sprintf("https://api.github.com/repos/%s/pulls", projectID)
+		return "https://api.github.com"
 	}
 
 	// GitHub Enterprise uses /api/v3 suffix
-	baseURL = strings.TrimSuffix(baseURL, "/")
-	return fmt.Sprintf("%s/api/v3/repos/%s/pulls", baseURL, projectID)
+	return strings.TrimSuffix(baseURL, "/") + "/api/v3"
 }
@@ -0,0 +1,221 @@
+package mergerequest
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/repobox/runner/internal/git"
+)
+
+// AuthTypeGitHubApp marks a provider hash holding GitHub App credentials
+// (app_id, installation_id, encrypted private_key) instead of a token
+const AuthTypeGitHubApp = "github_app"
+
+// appJWTLifetime is how long the app JWT is valid; GitHub allows at most 10 minutes
+const appJWTLifetime = 9 * time.Minute
+
+// appJWTClockSkew backdates the JWT issue time against clock drift
+const appJWTClockSkew = time.Minute
+
+// appTokenRefreshMargin is how long before expiry a cached installation token is replaced
+const appTokenRefreshMargin = 5 * time.Minute
+
+// GitHubAppCredentials identify a GitHub App installation
+type GitHubAppCredentials struct {
+	BaseURL        string // Provider base URL, empty or https://github.com for github.com
+	AppID          string
+	InstallationID string
+	PrivateKey     []byte // PEM encoded RSA key (PKCS#1 or PKCS#8)
+}
+
+// githubAppTokenSource mints installation access tokens for a GitHub App and
+// caches each until it is close to expiring
+type githubAppTokenSource struct {
+	creds      GitHubAppCredentials
+	key        *rsa.PrivateKey
+	httpClient *http.Client
+	now        func() time.Time
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// appTokenSources shares one token source per installation across jobs
+var appTokenSources = struct {
+	sync.Mutex
+	m map[string]*githubAppTokenSource
+}{m: make(map[string]*githubAppTokenSource)}
+
+// GitHubAppTokenSource returns the token source of an app installation. Sources
+// are shared per installation, so jobs reuse a cached token until it nears expiry.
+func GitHubAppTokenSource(creds GitHubAppCredentials) (git.TokenSource, error) {
+	id := strings.Join([]string{creds.BaseURL, creds.AppID, creds.InstallationID}, "|")
+
+	appTokenSources.Lock()
+	defer appTokenSources.Unlock()
+	if s, ok := appTokenSources.m[id]; ok && string(s.creds.PrivateKey) == string(creds.PrivateKey) {
+		return s, nil
+	}
+
+	s, err := newGitHubAppTokenSource(creds)
+	if err != nil {
+		return nil, err
+	}
+	appTokenSources.m[id] = s
+	return s, nil
+}
+
+// GitHubAppFromProvider builds the token source of a provider hash with
+// auth_type github_app. decrypt decrypts the stored private key.
+func GitHubAppFromProvider(data map[string]string, decrypt func(string) (string, error)) (git.TokenSource, error) {
+	for _, field := range []string{"app_id", "installation_id", "private_key"} {
+		if data[field] == "" {
+			return nil, fmt.Errorf("GitHub App provider is missing %s", field)
+		}
+	}
+	key, err := decrypt(data["private_key"])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt GitHub App private key: %w", err)
+	}
+	return GitHubAppTokenSource(GitHubAppCredentials{
+		BaseURL:        data["url"],
+		AppID:          data["app_id"],
+		InstallationID: data["installation_id"],
+		PrivateKey:     []byte(key),
+	})
+}
+
+func newGitHubAppTokenSource(creds GitHubAppCredentials) (*githubAppTokenSource, error) {
+	key, err := parseRSAPrivateKey(creds.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &githubAppTokenSource{
+		creds:      creds,
+		key:        key,
+		httpClient: NewGitHubClient().httpClient,
+		now:        time.Now,
+	}, nil
+}
+
+// parseRSAPrivateKey decodes a PEM encoded PKCS#1 or PKCS#8 RSA private key
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("GitHub App private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub App private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("GitHub App private key is not an RSA key")
+	}
+	return key, nil
+}
+
+// Token returns the cached installation token, minting a new one when there
+// is none or it expires within appTokenRefreshMargin
+func (s *githubAppTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && s.now().Add(appTokenRefreshMargin).Before(s.expiresAt) {
+		return s.token, nil
+	}
+
+	token, expiresAt, err := s.mint(ctx)
+	if err != nil {
+		return "", err
+	}
+	s.token, s.expiresAt = token, expiresAt
+	return token, nil
+}
+
+// mint exchanges an app JWT for an installation access token
+func (s *githubAppTokenSource) mint(ctx context.Context) (string, time.Time, error) {
+	jwt, err := s.appJWT()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	apiURL := fmt.Sprintf("%s/app/installations/%s/access_tokens", githubAPIURL(s.creds.BaseURL), s.creds.InstallationID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, nil)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to request installation token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		var ghErr githubError
+		json.Unmarshal(respBody, &ghErr)
+		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusNotFound {
+			return "", time.Time{}, fmt.Errorf("%w: GitHub App %s can't access installation %s (%s)", ErrAuth, s.creds.AppID, s.creds.InstallationID, ghErr.Message)
+		}
+		return "", time.Time{}, fmt.Errorf("GitHub API error (status %d): %s", resp.StatusCode, ghErr.Message)
+	}
+
+	var tokenResp struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.Unmarshal(respBody, &tokenResp); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if tokenResp.Token == "" {
+		return "", time.Time{}, errors.New("GitHub API returned no installation token")
+	}
+	return tokenResp.Token, tokenResp.ExpiresAt, nil
+}
+
+// appJWT builds the RS256 JWT that authenticates as the app itself
+func (s *githubAppTokenSource) appJWT() (string, error) {
+	now := s.now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-appJWTClockSkew).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": s.creds.AppID,
+	})
+
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GitHub App JWT: %w", err)
+	}
+	return signingInput + "." + enc.EncodeToString(sig), nil
+}
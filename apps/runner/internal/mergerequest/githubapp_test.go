@@ -0,0 +1,205 @@
+package mergerequest
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testAppKey generates an RSA key and returns it with its PKCS#1 PEM encoding
+func testAppKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+func TestGitHubAppJWT(t *testing.T) {
+	key, keyPEM := testAppKey(t)
+	s, err := newGitHubAppTokenSource(GitHubAppCredentials{AppID: "12345", InstallationID: "42", PrivateKey: keyPEM})
+	if err != nil {
+		t.Fatalf("newGitHubAppTokenSource() error = %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	s.now = func() time.Time { return now }
+
+	jwt, err := s.appJWT()
+	if err != nil {
+		t.Fatalf("appJWT() error = %v", err)
+	}
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		t.Fatalf("appJWT() = %q, want header.claims.signature", jwt)
+	}
+
+	var header map[string]string
+	var claims map[string]interface{}
+	for i, v := range []interface{}{&header, &claims} {
+		data, err := base64.RawURLEncoding.DecodeString(parts[i])
+		if err != nil {
+			t.Fatalf("part %d is not base64url: %v", i, err)
+		}
+		if err := json.Unmarshal(data, v); err != nil {
+			t.Fatalf("part %d is not JSON: %v", i, err)
+		}
+	}
+	if header["alg"] != "RS256" || header["typ"] != "JWT" {
+		t.Errorf("header = %v, want RS256 JWT", header)
+	}
+	if claims["iss"] != "12345" {
+		t.Errorf("iss = %v, want the app id", claims["iss"])
+	}
+	if iat := int64(claims["iat"].(float64)); iat != now.Add(-appJWTClockSkew).Unix() {
+		t.Errorf("iat = %d, want backdated by %s", iat, appJWTClockSkew)
+	}
+	if exp := int64(claims["exp"].(float64)); exp != now.Add(appJWTLifetime).Unix() || exp-now.Unix() > 600 {
+		t.Errorf("exp = %d, want %s from now and at most 10 minutes", exp, appJWTLifetime)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		t.Fatalf("signature is not base64url: %v", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+}
+
+func TestGitHubAppTokenSource_Caching(t *testing.T) {
+	_, keyPEM := testAppKey(t)
+	now := time.Unix(1_700_000_000, 0)
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v3/app/installations/42/access_tokens" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); !strings.HasPrefix(auth, "Bearer ") || strings.Count(auth, ".") != 2 {
+			t.Errorf("Authorization = %q, want a Bearer JWT", auth)
+		}
+		n := requests.Add(1)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": "ghs_%d", "expires_at": %q}`, n, now.Add(time.Hour).Format(time.RFC3339))
+	}))
+	defer srv.Close()
+
+	s, err := newGitHubAppTokenSource(GitHubAppCredentials{BaseURL: srv.URL, AppID: "1", InstallationID: "42", PrivateKey: keyPEM})
+	if err != nil {
+		t.Fatalf("newGitHubAppTokenSource() error = %v", err)
+	}
+	clock := now
+	s.now = func() time.Time { return clock }
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		at           time.Time
+		wantToken    string
+		wantRequests int32
+	}{
+		{"first call mints", now, "ghs_1", 1},
+		{"cached", now.Add(30 * time.Minute), "ghs_1", 1},
+		{"near expiry mints again", now.Add(time.Hour - appTokenRefreshMargin + time.Second), "ghs_2", 2},
+	}
+	for _, tt := range tests {
+		clock = tt.at
+		token, err := s.Token(ctx)
+		if err != nil {
+			t.Fatalf("%s: Token() error = %v", tt.name, err)
+		}
+		if token != tt.wantToken || requests.Load() != tt.wantRequests {
+			t.Errorf("%s: Token() = %q after %d requests, want %q after %d", tt.name, token, requests.Load(), tt.wantToken, tt.wantRequests)
+		}
+	}
+}
+
+func TestGitHubAppTokenSource_Rejected(t *testing.T) {
+	_, keyPEM := testAppKey(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"message": "A JSON web token could not be decoded"}`))
+	}))
+	defer srv.Close()
+
+	s, err := newGitHubAppTokenSource(GitHubAppCredentials{BaseURL: srv.URL, AppID: "1", InstallationID: "42", PrivateKey: keyPEM})
+	if err != nil {
+		t.Fatalf("newGitHubAppTokenSource() error = %v", err)
+	}
+	if _, err := s.Token(context.Background()); !errors.Is(err, ErrAuth) {
+		t.Errorf("Token() error = %v, want ErrAuth", err)
+	}
+}
+
+func TestParseRSAPrivateKey(t *testing.T) {
+	key, pkcs1 := testAppKey(t)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey() error = %v", err)
+	}
+	pkcs8 := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{"pkcs1", pkcs1, false},
+		{"pkcs8", pkcs8, false},
+		{"not pem", []byte("-----not a key-----"), true},
+		{"garbage block", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("junk")}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseRSAPrivateKey(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseRSAPrivateKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGitHubAppFromProvider(t *testing.T) {
+	_, keyPEM := testAppKey(t)
+	decrypt := func(s string) (string, error) { return strings.TrimPrefix(s, "enc:"), nil }
+	data := map[string]string{
+		"auth_type":       AuthTypeGitHubApp,
+		"url":             "https://github.example.com",
+		"app_id":          "7",
+		"installation_id": "99",
+		"private_key":     "enc:" + string(keyPEM),
+	}
+
+	first, err := GitHubAppFromProvider(data, decrypt)
+	if err != nil {
+		t.Fatalf("GitHubAppFromProvider() error = %v", err)
+	}
+	second, err := GitHubAppFromProvider(data, decrypt)
+	if err != nil {
+		t.Fatalf("GitHubAppFromProvider() error = %v", err)
+	}
+	if first != second {
+		t.Error("GitHubAppFromProvider() returned a new source for the same installation, want the cached one")
+	}
+
+	delete(data, "installation_id")
+	if _, err := GitHubAppFromProvider(data, decrypt); err == nil || !strings.Contains(err.Error(), "installation_id") {
+		t.Errorf("GitHubAppFromProvider() error = %v, want missing installation_id", err)
+	}
+}
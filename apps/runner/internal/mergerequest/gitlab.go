@@ -2,12 +2,12 @@ package mergerequest
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"time"
 )
 
 // GitLabClient creates merge requests on GitLab
@@ -19,12 +19,7 @@ type GitLabClient struct {
 // Supports HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables
 func NewGitLabClient() *GitLabClient {
 	return &GitLabClient{
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				Proxy: http.ProxyFromEnvironment,
-			},
-		},
+		httpClient: newHTTPClient(),
 	}
 }
 
@@ -47,7 +42,7 @@ type gitlabError struct {
 }
 
 // Create creates a merge request on GitLab
-func (c *GitLabClient) Create(params CreateParams) (*Result, error) {
+func (c *GitLabClient) Create(ctx context.Context, params CreateParams) (*Result, error) {
 	baseURL := params.BaseURL
 	if baseURL == "" {
 		baseURL = "https://gitlab.com"
@@ -71,7 +66,7 @@ func (c *GitLabClient) Create(params CreateParams) (*Result, error) {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest(http.MethodPost, apiURL, bytes.NewReader(bodyBytes))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL, bytes.NewReader(bodyBytes))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -108,6 +103,10 @@ func (c *GitLabClient) Create(params CreateParams) (*Result, error) {
 			}
 		}
 
+		if authErr := gitlabAuthError(resp.StatusCode, errMsg, params.ProjectID); authErr != nil {
+			return nil, authErr
+		}
+
 		return nil, fmt.Errorf("GitLab API error (status %d): %s", resp.StatusCode, errMsg)
 	}
 
@@ -116,9 +115,5 @@ func (c *GitLabClient) Create(params CreateParams) (*Result, error) {
 		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
 
-	return &Result{
-		URL:    mrResp.WebURL,
-		Number: mrResp.IID,
-		ID:     fmt.Sprintf("%d", mrResp.ID),
-	}, nil
+	return mrResp.result(), nil
 }
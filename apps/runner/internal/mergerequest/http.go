@@ -0,0 +1,33 @@
+package mergerequest
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/repobox/runner/internal/cacerts"
+)
+
+// DefaultHTTPTimeout is the overall timeout of each MR/PR API request
+const DefaultHTTPTimeout = 30 * time.Second
+
+// httpTimeout is applied to clients created after SetHTTPTimeout
+var httpTimeout = DefaultHTTPTimeout
+
+// SetHTTPTimeout sets the overall timeout of each provider API request,
+// 0 leaves requests bounded only by their context. Call it once at startup,
+// before any client is created.
+func SetHTTPTimeout(d time.Duration) {
+	httpTimeout = d
+}
+
+// newHTTPClient creates the HTTP client shared by the provider clients
+// Supports HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables and EXTRA_CA_CERTS
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		Timeout: httpTimeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: cacerts.TLSConfig(),
+		},
+	}
+}
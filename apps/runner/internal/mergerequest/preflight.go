@@ -0,0 +1,201 @@
+package mergerequest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrRepoNotFound indicates the repository doesn't exist or the token can't see it.
+// Providers answer 404 for private repositories the token has no access to.
+var ErrRepoNotFound = errors.New("repository not found or no access")
+
+// PreflightParams identifies the repository to check
+type PreflightParams struct {
+	Token     string // Plaintext access token
+	BaseURL   string // Provider base URL
+	ProjectID string // GitLab: numeric ID or path, GitHub: owner/repo
+}
+
+// RepoChecker verifies a repository exists and the token can read it
+type RepoChecker interface {
+	Preflight(ctx context.Context, params PreflightParams) error
+	// DefaultBranch returns the repository's default branch from the API, for
+	// when a clone can't tell
+	DefaultBranch(ctx context.Context, params PreflightParams) (string, error)
+}
+
+// repoResponse is the part of the repository (GitHub) or project (GitLab) the runner reads
+type repoResponse struct {
+	DefaultBranch string `json:"default_branch"`
+}
+
+// GetRepoChecker returns the repository checker for the provider type
+func GetRepoChecker(providerType ProviderType) RepoChecker {
+	switch providerType {
+	case ProviderGitHub:
+		return NewGitHubClient()
+	case ProviderGitLab:
+		return NewGitLabClient()
+	default:
+		return nil
+	}
+}
+
+// CheckRepo runs the provider's preflight for repoURL, so a missing repository
+// or a bad token fails in one API call instead of a slow, cryptic git clone.
+// Unknown provider types are not checked.
+func CheckRepo(ctx context.Context, providerType ProviderType, baseURL, token, repoURL string) error {
+	checker := GetRepoChecker(providerType)
+	if checker == nil {
+		return nil
+	}
+
+	projectID, err := ExtractProjectID(repoURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidProjectID, err)
+	}
+	if err := ValidateProjectID(providerType, projectID); err != nil {
+		return err
+	}
+
+	return checker.Preflight(ctx, PreflightParams{Token: token, BaseURL: baseURL, ProjectID: projectID})
+}
+
+// DefaultBranch asks the provider's API for repoURL's default branch, without
+// a clone. Unknown provider types return an error.
+func DefaultBranch(ctx context.Context, providerType ProviderType, baseURL, token, repoURL string) (string, error) {
+	checker := GetRepoChecker(providerType)
+	if checker == nil {
+		return "", fmt.Errorf("default branch lookup not supported for provider %q", providerType)
+	}
+
+	projectID, err := ExtractProjectID(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidProjectID, err)
+	}
+	if err := ValidateProjectID(providerType, projectID); err != nil {
+		return "", err
+	}
+
+	return checker.DefaultBranch(ctx, PreflightParams{Token: token, BaseURL: baseURL, ProjectID: projectID})
+}
+
+// Preflight checks the repository with GET /repos/{owner}/{repo}
+func (c *GitHubClient) Preflight(ctx context.Context, params PreflightParams) error {
+	_, err := c.getRepo(ctx, params)
+	return err
+}
+
+// DefaultBranch reads default_branch from GET /repos/{owner}/{repo}
+func (c *GitHubClient) DefaultBranch(ctx context.Context, params PreflightParams) (string, error) {
+	repo, err := c.getRepo(ctx, params)
+	if err != nil {
+		return "", err
+	}
+	if repo.DefaultBranch == "" {
+		return "", fmt.Errorf("GitHub repository %s has no default branch", params.ProjectID)
+	}
+	return repo.DefaultBranch, nil
+}
+
+// getRepo fetches the repository
+func (c *GitHubClient) getRepo(ctx context.Context, params PreflightParams) (*repoResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, githubRepoAPIURL(params.BaseURL, params.ProjectID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", params.Token))
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	respBody, status, err := doRequest(c.httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var errResp githubError
+	_ = json.Unmarshal(respBody, &errResp)
+
+	switch {
+	case status >= 200 && status < 300:
+		var repo repoResponse
+		if err := json.Unmarshal(respBody, &repo); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+		return &repo, nil
+	case status == http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrRepoNotFound, params.ProjectID)
+	case status == http.StatusUnauthorized:
+		return nil, fmt.Errorf("%w: GitHub token is invalid or expired (%s)", ErrAuth, errResp.Message)
+	case status == http.StatusForbidden && !strings.Contains(strings.ToLower(errResp.Message), "rate limit"):
+		return nil, fmt.Errorf("%w: access to %s denied (%s)", ErrAuth, params.ProjectID, errResp.Message)
+	}
+	return nil, fmt.Errorf("GitHub API error (status %d): %s", status, errResp.Message)
+}
+
+// Preflight checks the project with GET /api/v4/projects/{id}
+func (c *GitLabClient) Preflight(ctx context.Context, params PreflightParams) error {
+	_, err := c.getProject(ctx, params)
+	return err
+}
+
+// DefaultBranch reads default_branch from GET /api/v4/projects/{id}. Empty
+// projects have none.
+func (c *GitLabClient) DefaultBranch(ctx context.Context, params PreflightParams) (string, error) {
+	project, err := c.getProject(ctx, params)
+	if err != nil {
+		return "", err
+	}
+	if project.DefaultBranch == "" {
+		return "", fmt.Errorf("GitLab project %s has no default branch", params.ProjectID)
+	}
+	return project.DefaultBranch, nil
+}
+
+// getProject fetches the project
+func (c *GitLabClient) getProject(ctx context.Context, params PreflightParams) (*repoResponse, error) {
+	baseURL := params.BaseURL
+	if baseURL == "" {
+		baseURL = "https://gitlab.com"
+	}
+	apiURL := fmt.Sprintf("%s/api/v4/projects/%s", strings.TrimSuffix(baseURL, "/"), url.PathEscape(params.ProjectID))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("PRIVATE-TOKEN", params.Token)
+
+	respBody, status, err := doRequest(c.httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var errResp gitlabError
+	_ = json.Unmarshal(respBody, &errResp)
+	msg := errResp.Error
+	if m, ok := errResp.Message.(string); ok && msg == "" {
+		msg = m
+	}
+
+	switch {
+	case status >= 200 && status < 300:
+		var project repoResponse
+		if err := json.Unmarshal(respBody, &project); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+		return &project, nil
+	case status == http.StatusNotFound:
+		return nil, fmt.Errorf("%w: %s", ErrRepoNotFound, params.ProjectID)
+	case status == http.StatusUnauthorized:
+		return nil, fmt.Errorf("%w: GitLab token is invalid or expired (%s)", ErrAuth, msg)
+	case status == http.StatusForbidden:
+		return nil, fmt.Errorf("%w: access to %s denied (%s)", ErrAuth, params.ProjectID, msg)
+	}
+	return nil, fmt.Errorf("GitLab API error (status %d): %s", status, msg)
+}
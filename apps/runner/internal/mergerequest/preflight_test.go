@@ -0,0 +1,130 @@
+package mergerequest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPreflight(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider ProviderType
+		status   int
+		body     string
+		wantPath string
+		wantErr  error
+	}{
+		{"github ok", ProviderGitHub, http.StatusOK, `{"full_name": "owner/repo"}`, "/api/v3/repos/owner/repo", nil},
+		{"github not found", ProviderGitHub, http.StatusNotFound, `{"message": "Not Found"}`, "/api/v3/repos/owner/repo", ErrRepoNotFound},
+		{"github bad token", ProviderGitHub, http.StatusUnauthorized, `{"message": "Bad credentials"}`, "/api/v3/repos/owner/repo", ErrAuth},
+		{"github forbidden", ProviderGitHub, http.StatusForbidden, `{"message": "Resource not accessible by personal access token"}`, "/api/v3/repos/owner/repo", ErrAuth},
+		{"github rate limited", ProviderGitHub, http.StatusForbidden, `{"message": "API rate limit exceeded"}`, "/api/v3/repos/owner/repo", nil},
+		{"gitlab ok", ProviderGitLab, http.StatusOK, `{"id": 1}`, "/api/v4/projects/group/sub/project", nil},
+		{"gitlab not found", ProviderGitLab, http.StatusNotFound, `{"message": "404 Project Not Found"}`, "/api/v4/projects/group/sub/project", ErrRepoNotFound},
+		{"gitlab forbidden", ProviderGitLab, http.StatusForbidden, `{"message": "403 Forbidden"}`, "/api/v4/projects/group/sub/project", ErrAuth},
+		{"gitlab server error", ProviderGitLab, http.StatusBadGateway, `{"message": "bad gateway"}`, "/api/v4/projects/group/sub/project", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath, gotAuth string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				gotAuth = r.Header.Get("Authorization") + r.Header.Get("PRIVATE-TOKEN")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			repoURL := "https://example.com/owner/repo.git"
+			if tt.provider == ProviderGitLab {
+				repoURL = "https://example.com/group/sub/project.git"
+			}
+
+			err := CheckRepo(context.Background(), tt.provider, srv.URL, "token", repoURL)
+			switch {
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+				t.Errorf("CheckRepo() error = %v, want %v", err, tt.wantErr)
+			case tt.wantErr == nil && tt.status < 300 && err != nil:
+				t.Errorf("CheckRepo() error = %v, want nil", err)
+			case tt.wantErr == nil && tt.status >= 300 && (err == nil || errors.Is(err, ErrAuth) || errors.Is(err, ErrRepoNotFound)):
+				t.Errorf("CheckRepo() error = %v, want a non-definite error", err)
+			}
+			if gotPath != tt.wantPath {
+				t.Errorf("request path = %q, want %q", gotPath, tt.wantPath)
+			}
+			if gotAuth != "Bearer token" && gotAuth != "token" {
+				t.Errorf("auth header = %q", gotAuth)
+			}
+		})
+	}
+}
+
+func TestCheckRepo_Skipped(t *testing.T) {
+	// Unknown providers are not checked
+	if err := CheckRepo(context.Background(), ProviderType("bitbucket"), "http://127.0.0.1:0", "token", "https://example.com/a/b"); err != nil {
+		t.Errorf("CheckRepo(unknown provider) error = %v, want nil", err)
+	}
+	// Malformed URLs are reported without an API call
+	err := CheckRepo(context.Background(), ProviderGitHub, "http://127.0.0.1:0", "token", "https://github.com/only-owner")
+	if !errors.Is(err, ErrInvalidProjectID) {
+		t.Errorf("CheckRepo(bad URL) error = %v, want ErrInvalidProjectID", err)
+	}
+}
+
+func TestDefaultBranch(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider ProviderType
+		status   int
+		body     string
+		wantPath string
+		want     string
+		wantErr  error
+	}{
+		{"github", ProviderGitHub, http.StatusOK, `{"full_name": "owner/repo", "default_branch": "develop"}`, "/api/v3/repos/owner/repo", "develop", nil},
+		{"github not found", ProviderGitHub, http.StatusNotFound, `{"message": "Not Found"}`, "/api/v3/repos/owner/repo", "", ErrRepoNotFound},
+		{"gitlab", ProviderGitLab, http.StatusOK, `{"id": 1, "default_branch": "master"}`, "/api/v4/projects/group/sub/project", "master", nil},
+		{"gitlab empty project", ProviderGitLab, http.StatusOK, `{"id": 1, "default_branch": null}`, "/api/v4/projects/group/sub/project", "", nil},
+		{"gitlab bad token", ProviderGitLab, http.StatusUnauthorized, `{"message": "401 Unauthorized"}`, "/api/v4/projects/group/sub/project", "", ErrAuth},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			repoURL := "https://example.com/owner/repo.git"
+			if tt.provider == ProviderGitLab {
+				repoURL = "https://example.com/group/sub/project.git"
+			}
+
+			got, err := DefaultBranch(context.Background(), tt.provider, srv.URL, "token", repoURL)
+			if gotPath != tt.wantPath {
+				t.Errorf("request path = %q, want %q", gotPath, tt.wantPath)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("DefaultBranch() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.want == "" && err == nil {
+				t.Errorf("DefaultBranch() = %q, want an error", got)
+			}
+			if tt.want != "" && (err != nil || got != tt.want) {
+				t.Errorf("DefaultBranch() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	// Providers without a lookup report it instead of guessing
+	if _, err := DefaultBranch(context.Background(), ProviderAzure, "http://127.0.0.1:0", "token", "https://dev.azure.com/org/project/_git/repo"); err == nil {
+		t.Error("DefaultBranch(azure) error = nil")
+	}
+}
@@ -0,0 +1,184 @@
+package mergerequest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ReopenParams identifies the closed MR/PR to reopen
+type ReopenParams struct {
+	Token     string // Plaintext access token
+	BaseURL   string // Provider base URL
+	ProjectID string // GitLab: numeric ID or path, GitHub: owner/repo
+	Result    *Result
+}
+
+// Reopener finds a branch's closed MR/PR and reopens it, so a re-push doesn't
+// open a duplicate next to the one the user closed
+type Reopener interface {
+	// ClosedMR returns the most recently updated MR/PR from params.SourceBranch
+	// into params.TargetBranch that was closed without merging, nil if there is none
+	ClosedMR(ctx context.Context, params CreateParams) (*Result, error)
+	// ReopenMR reopens a closed MR/PR
+	ReopenMR(ctx context.Context, params ReopenParams) (*Result, error)
+}
+
+// ClosedMR looks up closed pull requests with GET /repos/{owner}/{repo}/pulls?state=closed&head=owner:branch&base=target
+func (c *GitHubClient) ClosedMR(ctx context.Context, params CreateParams) (*Result, error) {
+	owner, _, _ := strings.Cut(params.ProjectID, "/")
+	query := url.Values{
+		"state":     {"closed"},
+		"head":      {owner + ":" + params.SourceBranch},
+		"base":      {params.TargetBranch},
+		"sort":      {"updated"},
+		"direction": {"desc"},
+		"per_page":  {"100"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.getAPIURL(params.BaseURL, params.ProjectID)+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	c.setHeaders(req, params.Token)
+
+	respBody, status, err := doRequest(c.httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, githubStatusError(status, respBody, params.ProjectID)
+	}
+
+	var pulls []struct {
+		githubPRResponse
+		MergedAt *string `json:"merged_at"`
+	}
+	if err := json.Unmarshal(respBody, &pulls); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	for _, p := range pulls {
+		// A merged PR is closed too, but can't be reopened
+		if p.MergedAt == nil {
+			return p.result(), nil
+		}
+	}
+	return nil, nil
+}
+
+// ReopenMR reopens a pull request with PATCH /repos/{owner}/{repo}/pulls/{number}
+func (c *GitHubClient) ReopenMR(ctx context.Context, params ReopenParams) (*Result, error) {
+	if params.Result == nil || params.Result.Number == 0 {
+		return nil, fmt.Errorf("pull request number unknown")
+	}
+
+	apiURL := fmt.Sprintf("%s/%d", c.getAPIURL(params.BaseURL, params.ProjectID), params.Result.Number)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, apiURL, bytes.NewReader([]byte(`{"state":"open"}`)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.setHeaders(req, params.Token)
+
+	respBody, status, err := doRequest(c.httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+	// 422 when the head branch was deleted or recreated since the PR was closed
+	if status != http.StatusOK {
+		return nil, githubStatusError(status, respBody, params.ProjectID)
+	}
+
+	var pr githubPRResponse
+	if err := json.Unmarshal(respBody, &pr); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return pr.result(), nil
+}
+
+// result converts the API response to a Result
+func (p githubPRResponse) result() *Result {
+	return &Result{
+		URL:    p.HTMLURL,
+		Number: p.Number,
+		ID:     fmt.Sprintf("%d", p.ID),
+		NodeID: p.NodeID,
+	}
+}
+
+// ClosedMR looks up closed merge requests with GET /api/v4/projects/{id}/merge_requests?state=closed&source_branch=branch&target_branch=target
+func (c *GitLabClient) ClosedMR(ctx context.Context, params CreateParams) (*Result, error) {
+	// GitLab reports merged MRs as "merged", so state=closed only returns unmerged ones
+	query := url.Values{
+		"state":         {"closed"},
+		"source_branch": {params.SourceBranch},
+		"target_branch": {params.TargetBranch},
+		"order_by":      {"updated_at"},
+		"sort":          {"desc"},
+		"per_page":      {"1"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gitlabProjectAPIURL(params.BaseURL, params.ProjectID)+"/merge_requests?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("PRIVATE-TOKEN", params.Token)
+
+	respBody, status, err := doRequest(c.httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, gitlabStatusError(status, respBody, params.ProjectID)
+	}
+
+	var mrs []gitlabMRResponse
+	if err := json.Unmarshal(respBody, &mrs); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(mrs) == 0 {
+		return nil, nil
+	}
+	return mrs[0].result(), nil
+}
+
+// ReopenMR reopens a merge request with PUT /api/v4/projects/{id}/merge_requests/{iid}
+func (c *GitLabClient) ReopenMR(ctx context.Context, params ReopenParams) (*Result, error) {
+	if params.Result == nil || params.Result.Number == 0 {
+		return nil, fmt.Errorf("merge request IID unknown")
+	}
+
+	apiURL := fmt.Sprintf("%s/merge_requests/%d", gitlabProjectAPIURL(params.BaseURL, params.ProjectID), params.Result.Number)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, apiURL, bytes.NewReader([]byte(`{"state_event":"reopen"}`)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("PRIVATE-TOKEN", params.Token)
+
+	respBody, status, err := doRequest(c.httpClient, req)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, gitlabStatusError(status, respBody, params.ProjectID)
+	}
+
+	var mr gitlabMRResponse
+	if err := json.Unmarshal(respBody, &mr); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return mr.result(), nil
+}
+
+// result converts the API response to a Result
+func (m gitlabMRResponse) result() *Result {
+	return &Result{
+		URL:    m.WebURL,
+		Number: m.IID,
+		ID:     fmt.Sprintf("%d", m.ID),
+	}
+}
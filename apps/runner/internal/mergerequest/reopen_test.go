@@ -0,0 +1,182 @@
+package mergerequest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClosedMR(t *testing.T) {
+	tests := []struct {
+		name      string
+		reopener  Reopener
+		projectID string
+		body      string
+		wantReq   string
+		wantQuery map[string]string
+		want      *Result
+	}{
+		{
+			name:      "github skips merged",
+			reopener:  NewGitHubClient(),
+			projectID: "owner/repo",
+			body: `[
+				{"id": 1, "number": 3, "html_url": "https://github.com/owner/repo/pull/3", "merged_at": "2024-01-01T00:00:00Z"},
+				{"id": 2, "number": 5, "node_id": "PR_5", "html_url": "https://github.com/owner/repo/pull/5", "merged_at": null}
+			]`,
+			wantReq:   "GET /api/v3/repos/owner/repo/pulls",
+			wantQuery: map[string]string{"state": "closed", "head": "owner:repobox/abc", "base": "main"},
+			want:      &Result{URL: "https://github.com/owner/repo/pull/5", Number: 5, ID: "2", NodeID: "PR_5"},
+		},
+		{
+			name:      "github only merged",
+			reopener:  NewGitHubClient(),
+			projectID: "owner/repo",
+			body:      `[{"id": 1, "number": 3, "merged_at": "2024-01-01T00:00:00Z"}]`,
+			wantReq:   "GET /api/v3/repos/owner/repo/pulls",
+		},
+		{
+			name:      "gitlab",
+			reopener:  NewGitLabClient(),
+			projectID: "group/project",
+			body:      `[{"id": 90, "iid": 9, "web_url": "https://gitlab.com/group/project/-/merge_requests/9"}]`,
+			wantReq:   "GET /api/v4/projects/group/project/merge_requests",
+			wantQuery: map[string]string{"state": "closed", "source_branch": "repobox/abc", "target_branch": "main"},
+			want:      &Result{URL: "https://gitlab.com/group/project/-/merge_requests/9", Number: 9, ID: "90"},
+		},
+		{
+			name:      "gitlab none",
+			reopener:  NewGitLabClient(),
+			projectID: "group/project",
+			body:      `[]`,
+			wantReq:   "GET /api/v4/projects/group/project/merge_requests",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotReq string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotReq = r.Method + " " + r.URL.Path
+				for k, v := range tt.wantQuery {
+					if got := r.URL.Query().Get(k); got != v {
+						t.Errorf("query %s = %q, want %q", k, got, v)
+					}
+				}
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			got, err := tt.reopener.ClosedMR(context.Background(), CreateParams{
+				Token:        "token",
+				BaseURL:      srv.URL,
+				ProjectID:    tt.projectID,
+				SourceBranch: "repobox/abc",
+				TargetBranch: "main",
+			})
+			if err != nil {
+				t.Fatalf("ClosedMR() error = %v", err)
+			}
+			if gotReq != tt.wantReq {
+				t.Errorf("request = %q, want %q", gotReq, tt.wantReq)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("ClosedMR() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReopenMR(t *testing.T) {
+	tests := []struct {
+		name      string
+		reopener  Reopener
+		projectID string
+		status    int
+		body      string
+		wantReq   string
+		wantBody  map[string]string
+		wantURL   string
+		wantErr   bool
+	}{
+		{
+			name:      "github",
+			reopener:  NewGitHubClient(),
+			projectID: "owner/repo",
+			status:    http.StatusOK,
+			body:      `{"id": 2, "number": 5, "node_id": "PR_5", "html_url": "https://github.com/owner/repo/pull/5"}`,
+			wantReq:   "PATCH /api/v3/repos/owner/repo/pulls/5",
+			wantBody:  map[string]string{"state": "open"},
+			wantURL:   "https://github.com/owner/repo/pull/5",
+		},
+		{
+			name:      "github branch recreated",
+			reopener:  NewGitHubClient(),
+			projectID: "owner/repo",
+			status:    http.StatusUnprocessableEntity,
+			body:      `{"message": "state cannot be changed. The repobox/abc branch has been deleted."}`,
+			wantReq:   "PATCH /api/v3/repos/owner/repo/pulls/5",
+			wantBody:  map[string]string{"state": "open"},
+			wantErr:   true,
+		},
+		{
+			name:      "gitlab",
+			reopener:  NewGitLabClient(),
+			projectID: "group/project",
+			status:    http.StatusOK,
+			body:      `{"id": 90, "iid": 5, "web_url": "https://gitlab.com/group/project/-/merge_requests/5"}`,
+			wantReq:   "PUT /api/v4/projects/group/project/merge_requests/5",
+			wantBody:  map[string]string{"state_event": "reopen"},
+			wantURL:   "https://gitlab.com/group/project/-/merge_requests/5",
+		},
+		{
+			name:      "gitlab forbidden",
+			reopener:  NewGitLabClient(),
+			projectID: "group/project",
+			status:    http.StatusForbidden,
+			body:      `{"message": "403 Forbidden"}`,
+			wantReq:   "PUT /api/v4/projects/group/project/merge_requests/5",
+			wantBody:  map[string]string{"state_event": "reopen"},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotReq string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotReq = r.Method + " " + r.URL.Path
+				var body map[string]string
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Fatalf("invalid request body: %v", err)
+				}
+				for k, v := range tt.wantBody {
+					if body[k] != v {
+						t.Errorf("body %s = %q, want %q", k, body[k], v)
+					}
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			got, err := tt.reopener.ReopenMR(context.Background(), ReopenParams{
+				Token:     "token",
+				BaseURL:   srv.URL,
+				ProjectID: tt.projectID,
+				Result:    &Result{Number: 5},
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReopenMR() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if gotReq != tt.wantReq {
+				t.Errorf("request = %q, want %q", gotReq, tt.wantReq)
+			}
+			if !tt.wantErr && got.URL != tt.wantURL {
+				t.Errorf("ReopenMR() URL = %q, want %q", got.URL, tt.wantURL)
+			}
+		})
+	}
+}
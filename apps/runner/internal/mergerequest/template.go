@@ -1,8 +1,14 @@
 package mergerequest
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"os"
 	"strings"
+	"text/template"
 )
 
 // TemplateParams contains data for generating MR/PR title and description
@@ -12,6 +18,86 @@ type TemplateParams struct {
 	LinesRemoved int
 	BranchName   string
 	JobID        string
+	Summary      string // Final summary reported by the AI agent (may be empty)
+
+	// File counts, zero when unknown
+	FilesChanged int
+	FilesAdded   int
+	FilesDeleted int
+	FilesRenamed int
+
+	Files []ChangedFile // Changed files, nil when unknown
+}
+
+// ChangedFile is one file a MR/PR changes
+type ChangedFile struct {
+	Status  string // A added, D deleted, R renamed, anything else modified
+	Path    string
+	OldPath string // Path before a rename
+}
+
+// MaxListedFiles caps the changed files listed in a description, the rest are counted
+const MaxListedFiles = 50
+
+// fileGroups are the headings of the changed files list, in order
+var fileGroups = []struct {
+	status  string
+	heading string
+}{
+	{"A", "Added"},
+	{"M", "Modified"},
+	{"R", "Renamed"},
+	{"D", "Deleted"},
+}
+
+// FileList returns the changed files formatted by FormatFileList, for use in
+// templates as {{.FileList}}
+func (p TemplateParams) FileList() string {
+	return FormatFileList(p.Files, MaxListedFiles)
+}
+
+// FormatFileList formats files as Markdown lists grouped by added, modified,
+// renamed and deleted. At most max files are listed, the rest are summed up in
+// a "+N more files" note. Returns "" when there are no files.
+func FormatFileList(files []ChangedFile, max int) string {
+	groups := make(map[string][]ChangedFile, len(fileGroups))
+	for _, f := range files {
+		status := f.Status
+		switch status {
+		case "A", "D", "R":
+		default:
+			status = "M"
+		}
+		groups[status] = append(groups[status], f)
+	}
+
+	var b strings.Builder
+	listed := 0
+	for _, g := range fileGroups {
+		if len(groups[g.status]) == 0 || listed >= max {
+			continue
+		}
+		b.WriteString(fmt.Sprintf("**%s**\n\n", g.heading))
+		for _, f := range groups[g.status] {
+			if listed >= max {
+				break
+			}
+			if f.OldPath != "" {
+				b.WriteString(fmt.Sprintf("- `%s` → `%s`\n", f.OldPath, f.Path))
+			} else {
+				b.WriteString(fmt.Sprintf("- `%s`\n", f.Path))
+			}
+			listed++
+		}
+		b.WriteString("\n")
+	}
+
+	if more := len(files) - listed; more == 1 {
+		b.WriteString("_+1 more file_\n\n")
+	} else if more > 1 {
+		b.WriteString(fmt.Sprintf("_+%d more files_\n\n", more))
+	}
+	return strings.TrimSuffix(b.String(), "\n")
 }
 
 // GenerateTitle creates a MR/PR title from the prompt
@@ -49,6 +135,15 @@ func GenerateDescription(params TemplateParams) string {
 	b.WriteString(fmt.Sprintf("- **Lines added:** %d\n", params.LinesAdded))
 	b.WriteString(fmt.Sprintf("- **Lines removed:** %d\n", params.LinesRemoved))
 	b.WriteString(fmt.Sprintf("- **Net change:** %+d lines\n", params.LinesAdded-params.LinesRemoved))
+	if params.FilesChanged > 0 {
+		b.WriteString(fmt.Sprintf("- **Files changed:** %d (%d added, %d deleted, %d renamed)\n",
+			params.FilesChanged, params.FilesAdded, params.FilesDeleted, params.FilesRenamed))
+	}
+
+	if files := params.FileList(); files != "" {
+		b.WriteString("\n### Files\n\n")
+		b.WriteString(files)
+	}
 
 	b.WriteString("\n---\n\n")
 	b.WriteString(fmt.Sprintf("🤖 *Generated by Repobox* • Job ID: `%s`\n", params.JobID[:8]))
@@ -56,6 +151,60 @@ func GenerateDescription(params TemplateParams) string {
 	return b.String()
 }
 
+// DescriptionTemplate renders MR/PR descriptions from an operator-supplied
+// text/template. A zero value renders the built-in GenerateDescription layout.
+type DescriptionTemplate struct {
+	tmpl *template.Template
+	path string
+}
+
+// LoadDescriptionTemplate parses the template at path.
+// An empty path or a missing file yields the built-in default template;
+// unreadable or broken templates return an error so they fail at startup.
+func LoadDescriptionTemplate(path string) (*DescriptionTemplate, error) {
+	if path == "" {
+		return &DescriptionTemplate{}, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return &DescriptionTemplate{}, nil
+		}
+		return nil, fmt.Errorf("failed to read MR template: %w", err)
+	}
+
+	tmpl, err := template.New("mr-description").Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("invalid MR template %s: %w", path, err)
+	}
+
+	// Execute once with empty params so references to unknown fields are caught now
+	if err := tmpl.Execute(io.Discard, TemplateParams{}); err != nil {
+		return nil, fmt.Errorf("invalid MR template %s: %w", path, err)
+	}
+
+	return &DescriptionTemplate{tmpl: tmpl, path: path}, nil
+}
+
+// IsDefault reports whether the built-in description layout is used
+func (t *DescriptionTemplate) IsDefault() bool {
+	return t == nil || t.tmpl == nil
+}
+
+// Render generates the MR/PR description for the given params
+func (t *DescriptionTemplate) Render(params TemplateParams) (string, error) {
+	if t.IsDefault() {
+		return GenerateDescription(params), nil
+	}
+
+	var b bytes.Buffer
+	if err := t.tmpl.Execute(&b, params); err != nil {
+		return "", fmt.Errorf("failed to render MR template %s: %w", t.path, err)
+	}
+	return b.String(), nil
+}
+
 // DetectDefaultBranch tries common default branch names
 // Returns "main" as fallback
 func DetectDefaultBranch(branches []string) string {
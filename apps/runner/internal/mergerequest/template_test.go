@@ -0,0 +1,206 @@
+package mergerequest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTemplate(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "mr.tmpl")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+	return path
+}
+
+func TestLoadDescriptionTemplate_Custom(t *testing.T) {
+	path := writeTemplate(t, "Branch {{.BranchName}}: +{{.LinesAdded}}/-{{.LinesRemoved}}\n{{.Summary}}")
+
+	tmpl, err := LoadDescriptionTemplate(path)
+	if err != nil {
+		t.Fatalf("LoadDescriptionTemplate() error = %v", err)
+	}
+	if tmpl.IsDefault() {
+		t.Fatal("expected custom template, got default")
+	}
+
+	got, err := tmpl.Render(TemplateParams{
+		BranchName:   "repobox/abc12345",
+		LinesAdded:   10,
+		LinesRemoved: 2,
+		Summary:      "Refactored the parser",
+	})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	want := "Branch repobox/abc12345: +10/-2\nRefactored the parser"
+	if got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+}
+
+func TestLoadDescriptionTemplate_Fallback(t *testing.T) {
+	params := TemplateParams{
+		Prompt:     "Fix the bug",
+		BranchName: "repobox/abc12345",
+		JobID:      "abc12345-session",
+	}
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"unset", ""},
+		{"missing file", filepath.Join(t.TempDir(), "does-not-exist.tmpl")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := LoadDescriptionTemplate(tt.path)
+			if err != nil {
+				t.Fatalf("LoadDescriptionTemplate() error = %v", err)
+			}
+			if !tmpl.IsDefault() {
+				t.Error("expected default template")
+			}
+
+			got, err := tmpl.Render(params)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if got != GenerateDescription(params) {
+				t.Errorf("Render() did not match built-in description:\n%s", got)
+			}
+		})
+	}
+}
+
+func TestLoadDescriptionTemplate_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"syntax error", "{{.Prompt"},
+		{"unknown field", "{{.NoSuchField}}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadDescriptionTemplate(writeTemplate(t, tt.content))
+			if err == nil {
+				t.Fatal("expected error for broken template")
+			}
+			if !strings.Contains(err.Error(), "invalid MR template") {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestGenerateDescription_Files(t *testing.T) {
+	tests := []struct {
+		name   string
+		params TemplateParams
+		want   string
+	}{
+		{"with counts", TemplateParams{JobID: "abc12345-job", FilesChanged: 4, FilesAdded: 1, FilesDeleted: 2, FilesRenamed: 1}, "- **Files changed:** 4 (1 added, 2 deleted, 1 renamed)\n"},
+		{"unknown counts", TemplateParams{JobID: "abc12345-job"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GenerateDescription(tt.params)
+			if tt.want == "" {
+				if strings.Contains(got, "Files changed") {
+					t.Errorf("GenerateDescription() = %q, want no file counts", got)
+				}
+				return
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("GenerateDescription() = %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatFileList(t *testing.T) {
+	files := []ChangedFile{
+		{Status: "M", Path: "main.go"},
+		{Status: "A", Path: "new.go"},
+		{Status: "D", Path: "old.go"},
+		{Status: "R", Path: "pkg/b.go", OldPath: "pkg/a.go"},
+		{Status: "T", Path: "link"},
+		{Status: "A", Path: "docs/new.md"},
+	}
+
+	tests := []struct {
+		name  string
+		files []ChangedFile
+		max   int
+		want  string
+	}{
+		{"no files", nil, 10, ""},
+		{
+			"grouped",
+			files,
+			10,
+			"**Added**\n\n- `new.go`\n- `docs/new.md`\n\n" +
+				"**Modified**\n\n- `main.go`\n- `link`\n\n" +
+				"**Renamed**\n\n- `pkg/a.go` → `pkg/b.go`\n\n" +
+				"**Deleted**\n\n- `old.go`\n",
+		},
+		{
+			"truncated",
+			files,
+			3,
+			"**Added**\n\n- `new.go`\n- `docs/new.md`\n\n" +
+				"**Modified**\n\n- `main.go`\n\n" +
+				"_+3 more files_\n",
+		},
+		{
+			"one more",
+			files,
+			5,
+			"**Added**\n\n- `new.go`\n- `docs/new.md`\n\n" +
+				"**Modified**\n\n- `main.go`\n- `link`\n\n" +
+				"**Renamed**\n\n- `pkg/a.go` → `pkg/b.go`\n\n" +
+				"_+1 more file_\n",
+		},
+		{"none listed", files, 0, "_+6 more files_\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatFileList(tt.files, tt.max); got != tt.want {
+				t.Errorf("FormatFileList() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateDescription_FileList(t *testing.T) {
+	params := TemplateParams{JobID: "abc12345-job", FilesChanged: 1, FilesAdded: 1, Files: []ChangedFile{{Status: "A", Path: "new.go"}}}
+	got := GenerateDescription(params)
+	if want := "### Files\n\n**Added**\n\n- `new.go`\n\n---"; !strings.Contains(got, want) {
+		t.Errorf("GenerateDescription() = %q, want it to contain %q", got, want)
+	}
+
+	params.Files = nil
+	if got := GenerateDescription(params); strings.Contains(got, "### Files") {
+		t.Errorf("GenerateDescription() = %q, want no file list without files", got)
+	}
+
+	// Custom templates reach the same list
+	tmpl, err := LoadDescriptionTemplate(writeTemplate(t, "{{.FileList}}"))
+	if err != nil {
+		t.Fatalf("LoadDescriptionTemplate() error = %v", err)
+	}
+	params.Files = []ChangedFile{{Status: "D", Path: "old.go"}}
+	if got, err := tmpl.Render(params); err != nil || got != "**Deleted**\n\n- `old.go`\n" {
+		t.Errorf("Render() = %q, %v, want the deleted file listed", got, err)
+	}
+}
@@ -1,18 +1,21 @@
 package mergerequest
 
+import "context"
+
 // ProviderType identifies the git provider
 type ProviderType string
 
 const (
 	ProviderGitLab ProviderType = "gitlab"
 	ProviderGitHub ProviderType = "github"
+	ProviderAzure  ProviderType = "azure"
 )
 
 // CreateParams contains all data needed to create a MR/PR
 type CreateParams struct {
 	Token        string // Plaintext access token
 	BaseURL      string // Provider base URL (e.g., https://gitlab.com)
-	ProjectID    string // GitLab: numeric ID or path, GitHub: owner/repo
+	ProjectID    string // GitLab: numeric ID or path, GitHub: owner/repo, Azure DevOps: org/project/repo
 	Title        string
 	Description  string
 	SourceBranch string // Branch with changes
@@ -22,12 +25,14 @@ type CreateParams struct {
 // Result contains the created MR/PR info
 type Result struct {
 	URL    string // Web URL to the MR/PR
-	Number int    // MR IID (GitLab) or PR number (GitHub)
+	Number int    // MR IID (GitLab) or PR number (GitHub, Azure DevOps)
 	ID     string // Internal ID
+	NodeID string // GraphQL node ID (GitHub only)
 }
 
 // Creator creates merge requests/pull requests
 type Creator interface {
-	// Create creates a new MR/PR and returns the result
-	Create(params CreateParams) (*Result, error)
+	// Create creates a new MR/PR and returns the result.
+	// The request is canceled when ctx is done.
+	Create(ctx context.Context, params CreateParams) (*Result, error)
 }
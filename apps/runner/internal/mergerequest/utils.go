@@ -1,19 +1,27 @@
 package mergerequest
 
 import (
+	"errors"
+	"fmt"
 	"net/url"
 	"strings"
 )
 
+// ErrInvalidProjectID indicates the repository URL did not yield a usable project path
+var ErrInvalidProjectID = errors.New("invalid project ID")
+
 // ExtractProjectID extracts the project identifier from a repository URL
 //
 // For GitHub: returns "owner/repo" (e.g., "microsoft/vscode")
 // For GitLab: returns "group/project" path (e.g., "gitlab-org/gitlab")
+// For Azure DevOps: returns "org/project/repo" (e.g., "contoso/web/frontend")
 //
 // Handles various URL formats:
 // - https://github.com/owner/repo
 // - https://github.com/owner/repo.git
 // - https://gitlab.com/group/subgroup/project.git
+// - https://dev.azure.com/org/project/_git/repo
+// - https://org.visualstudio.com/project/_git/repo
 func ExtractProjectID(repoURL string) (string, error) {
 	u, err := url.Parse(repoURL)
 	if err != nil {
@@ -25,9 +33,50 @@ func ExtractProjectID(repoURL string) (string, error) {
 	path = strings.TrimSuffix(path, ".git")
 	path = strings.TrimSuffix(path, "/")
 
+	// Azure DevOps: drop the _git segment, legacy hosts carry the org in the subdomain
+	if prefix, repo, ok := strings.Cut(path, "/_git/"); ok {
+		path = prefix + "/" + repo
+		if org, ok := strings.CutSuffix(strings.ToLower(u.Hostname()), ".visualstudio.com"); ok {
+			path = org + "/" + path
+		}
+	}
+
 	return path, nil
 }
 
+// ValidateProjectID checks that a project ID extracted from a repo URL is plausibly shaped,
+// so a malformed URL fails with a clear error instead of an API 404
+//
+// GitHub requires exactly "owner/repo", GitLab at least "group/project"
+func ValidateProjectID(providerType ProviderType, projectID string) error {
+	if projectID == "" {
+		return fmt.Errorf("%w: repository URL has no path", ErrInvalidProjectID)
+	}
+
+	segments := strings.Split(projectID, "/")
+	for _, s := range segments {
+		if s == "" || s == "." || s == ".." {
+			return fmt.Errorf("%w: %q has an empty or relative path segment", ErrInvalidProjectID, projectID)
+		}
+	}
+
+	switch providerType {
+	case ProviderGitHub:
+		if len(segments) != 2 {
+			return fmt.Errorf("%w: %q, expected owner/repo", ErrInvalidProjectID, projectID)
+		}
+	case ProviderGitLab:
+		if len(segments) < 2 {
+			return fmt.Errorf("%w: %q, expected group/project", ErrInvalidProjectID, projectID)
+		}
+	case ProviderAzure:
+		if len(segments) < 3 {
+			return fmt.Errorf("%w: %q, expected org/project/repo", ErrInvalidProjectID, projectID)
+		}
+	}
+	return nil
+}
+
 // GetCreator returns the appropriate MR/PR creator for the provider type
 func GetCreator(providerType ProviderType) Creator {
 	switch providerType {
@@ -35,6 +84,8 @@ func GetCreator(providerType ProviderType) Creator {
 		return NewGitHubClient()
 	case ProviderGitLab:
 		return NewGitLabClient()
+	case ProviderAzure:
+		return NewAzureDevOpsClient()
 	default:
 		return nil
 	}
@@ -0,0 +1,51 @@
+package mergerequest
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExtractAndValidateProjectID(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider ProviderType
+		repoURL  string
+		want     string
+		wantErr  bool
+	}{
+		{"github", ProviderGitHub, "https://github.com/owner/repo.git", "owner/repo", false},
+		{"github trailing slash", ProviderGitHub, "https://github.com/owner/repo/", "owner/repo", false},
+		{"gitlab subgroup", ProviderGitLab, "https://gitlab.com/group/sub/project.git", "group/sub/project", false},
+		{"host only", ProviderGitHub, "https://github.com", "", true},
+		{"host with slash", ProviderGitLab, "https://gitlab.com/", "", true},
+		{"github owner only", ProviderGitHub, "https://github.com/owner", "owner", true},
+		{"github too deep", ProviderGitHub, "https://github.com/owner/repo/tree/main", "owner/repo/tree/main", true},
+		{"gitlab single segment", ProviderGitLab, "https://gitlab.com/project.git", "project", true},
+		{"double slash", ProviderGitHub, "https://github.com/owner//repo", "owner//repo", true},
+		{"azure", ProviderAzure, "https://dev.azure.com/contoso/web/_git/frontend", "contoso/web/frontend", false},
+		{"azure with user", ProviderAzure, "https://contoso@dev.azure.com/contoso/web/_git/frontend", "contoso/web/frontend", false},
+		{"azure legacy host", ProviderAzure, "https://Contoso.visualstudio.com/web/_git/frontend", "contoso/web/frontend", false},
+		{"azure server collection", ProviderAzure, "https://tfs.example.com/tfs/main/web/_git/frontend", "tfs/main/web/frontend", false},
+		{"azure without _git", ProviderAzure, "https://dev.azure.com/contoso/frontend", "contoso/frontend", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExtractProjectID(tt.repoURL)
+			if err != nil {
+				t.Fatalf("ExtractProjectID() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ExtractProjectID() = %q, want %q", got, tt.want)
+			}
+
+			err = ValidateProjectID(tt.provider, got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateProjectID(%q) error = %v, wantErr %v", got, err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidProjectID) {
+				t.Errorf("error should wrap ErrInvalidProjectID: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package providerapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/repobox/runner/internal/cacerts"
+)
+
+// Client reads JSON resources from the GitHub/GitLab API
+type Client struct {
+	httpClient *http.Client
+}
+
+// NewClient creates a new provider API client
+// Supports HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables and EXTRA_CA_CERTS
+func NewClient() *Client {
+	return &Client{
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: cacerts.TLSConfig(),
+			},
+		},
+	}
+}
+
+// GitHubURL returns the API URL of path on github.com or, for any other
+// baseURL, on GitHub Enterprise, which serves the API under /api/v3
+func GitHubURL(baseURL, path string) string {
+	if baseURL != "" && baseURL != "https://github.com" {
+		return fmt.Sprintf("%s/api/v3%s", strings.TrimSuffix(baseURL, "/"), path)
+	}
+	return "https://api.github.com" + path
+}
+
+// GitLabURL returns the API URL of path on the GitLab instance at baseURL,
+// gitlab.com when empty
+func GitLabURL(baseURL, path string) string {
+	if baseURL == "" {
+		baseURL = "https://gitlab.com"
+	}
+	return fmt.Sprintf("%s/api/v4%s", strings.TrimSuffix(baseURL, "/"), path)
+}
+
+// GitHubHeaders returns the request headers of an authenticated GitHub API call
+func GitHubHeaders(token string) map[string]string {
+	return map[string]string{
+		"Accept":               "application/vnd.github+json",
+		"Authorization":        fmt.Sprintf("Bearer %s", token),
+		"X-GitHub-Api-Version": "2022-11-28",
+	}
+}
+
+// GitLabHeaders returns the request headers of an authenticated GitLab API call
+func GitLabHeaders(token string) map[string]string {
+	return map[string]string{"PRIVATE-TOKEN": token}
+}
+
+// GetJSON performs a GET request and decodes the JSON response into v
+func (c *Client) GetJSON(ctx context.Context, apiURL string, headers map[string]string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for k, val := range headers {
+		req.Header.Set(k, val)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("API error (status %d): %s", resp.StatusCode, body)
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package providerapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIURLs(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"github.com", GitHubURL("", "/user/emails"), "https://api.github.com/user/emails"},
+		{"github.com base URL", GitHubURL("https://github.com", "/user/emails"), "https://api.github.com/user/emails"},
+		{"GitHub Enterprise", GitHubURL("https://git.example.com/", "/user/emails"), "https://git.example.com/api/v3/user/emails"},
+		{"gitlab.com", GitLabURL("", "/user"), "https://gitlab.com/api/v4/user"},
+		{"self-hosted GitLab", GitLabURL("https://gitlab.example.com/", "/user"), "https://gitlab.example.com/api/v4/user"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("URL = %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_GetJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "gl-token" {
+			http.Error(w, `{"message":"401 Unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"name":"repobox"}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient()
+	ctx := context.Background()
+
+	var v struct {
+		Name string `json:"name"`
+	}
+	if err := c.GetJSON(ctx, srv.URL, GitLabHeaders("gl-token"), &v); err != nil {
+		t.Fatalf("GetJSON() error = %v", err)
+	}
+	if v.Name != "repobox" {
+		t.Errorf("name = %q, want repobox", v.Name)
+	}
+
+	if err := c.GetJSON(ctx, srv.URL, GitLabHeaders("bad-token"), &v); err == nil {
+		t.Error("GetJSON() with a rejected token succeeded, want an API error")
+	}
+}
@@ -0,0 +1,74 @@
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/repobox/runner/internal/git"
+)
+
+// DefaultPatterns match common secrets that may show up in agent output
+var DefaultPatterns = []string{
+	`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`,                                      // AWS access key ID
+	`\bgh[pousr]_[A-Za-z0-9]{36,255}\b`,                                  // GitHub classic tokens
+	`\bgithub_pat_[A-Za-z0-9_]{22,255}\b`,                                // GitHub fine-grained tokens
+	`\bglpat-[A-Za-z0-9_\-]{20,}`,                                        // GitLab personal access tokens
+	`\bsk-ant-[A-Za-z0-9_\-]{20,}`,                                       // Anthropic API keys
+	`\beyJ[A-Za-z0-9_\-]{10,}\.[A-Za-z0-9_\-]{10,}\.[A-Za-z0-9_\-]{10,}`, // JWTs
+}
+
+// Redactor masks secrets in output lines before they are stored
+type Redactor struct {
+	patterns []*regexp.Regexp
+	values   []string
+}
+
+// New compiles the redaction patterns. Built-in patterns are included when withDefaults is set.
+func New(patterns []string, withDefaults bool) (*Redactor, error) {
+	all := patterns
+	if withDefaults {
+		all = append(append([]string{}, DefaultPatterns...), patterns...)
+	}
+
+	r := &Redactor{}
+	for _, p := range all {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// WithValues returns a copy that also masks the given literal secrets (e.g. the provider token).
+// On a nil Redactor the copy masks only the values.
+func (r *Redactor) WithValues(values ...string) *Redactor {
+	c := &Redactor{}
+	if r != nil {
+		c.patterns = r.patterns
+		c.values = append(c.values, r.values...)
+	}
+	for _, v := range values {
+		if v != "" {
+			c.values = append(c.values, v)
+		}
+	}
+	return c
+}
+
+// Redact masks known secret values and pattern matches in a line.
+// A nil Redactor returns the line unchanged.
+func (r *Redactor) Redact(line string) string {
+	if r == nil {
+		return line
+	}
+	for _, v := range r.values {
+		line = strings.ReplaceAll(line, v, git.MaskToken(v))
+	}
+	for _, re := range r.patterns {
+		line = re.ReplaceAllStringFunc(line, git.MaskToken)
+	}
+	return line
+}
@@ -0,0 +1,68 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// CancelRequestedField is the job hash field that asks the runner holding the job to stop it
+const CancelRequestedField = "cancel_requested"
+
+// requestCancelScript sets the cancel flag (ARGV[1]) when the job is still
+// pending or running. Returns 1 when set, 0 for a finished or missing job.
+var requestCancelScript = redis.NewScript(`
+local status = redis.call("HGET", KEYS[1], "status")
+if status ~= "pending" and status ~= "running" then
+	return 0
+end
+redis.call("HSET", KEYS[1], ARGV[1], "1")
+return 1
+`)
+
+// UserRunningJobs returns the sorted IDs of the user's jobs held by a worker
+func UserRunningJobs(ctx context.Context, rdb redis.UniversalClient, userID string) ([]string, error) {
+	ids, err := rdb.SMembers(ctx, UserRunningJobIDsKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// CancelUserJobs flags every running job of the user for cancellation; the
+// runner holding a job notices the flag and stops it. Jobs that already
+// finished are dropped from the user's set. Returns the number of jobs signaled.
+func CancelUserJobs(ctx context.Context, rdb redis.UniversalClient, userID string) (int, error) {
+	ids, err := UserRunningJobs(ctx, rdb, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list running jobs: %w", err)
+	}
+
+	signaled := 0
+	for _, id := range ids {
+		set, err := requestCancelScript.Run(ctx, rdb, []string{JobKey(id)}, CancelRequestedField).Int()
+		if err != nil {
+			return signaled, fmt.Errorf("failed to cancel job %s: %w", id, err)
+		}
+		if set == 0 {
+			// A runner that crashed never removed it
+			rdb.SRem(ctx, UserRunningJobIDsKey(userID), id)
+			continue
+		}
+		signaled++
+	}
+	return signaled, nil
+}
+
+// CancelRequested reports whether the job was flagged for cancellation
+func CancelRequested(ctx context.Context, rdb redis.UniversalClient, jobID string) (bool, error) {
+	val, err := rdb.HGet(ctx, JobKey(jobID), CancelRequestedField).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	return val == "1", err
+}
@@ -0,0 +1,81 @@
+package redis
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestUserRunningJobs(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	ids, err := UserRunningJobs(ctx, rdb, "user-1")
+	if err != nil || len(ids) != 0 {
+		t.Fatalf("UserRunningJobs() of an idle user = %v, %v, want none", ids, err)
+	}
+
+	rdb.SAdd(ctx, UserRunningJobIDsKey("user-1"), "job-b", "job-a")
+	rdb.SAdd(ctx, UserRunningJobIDsKey("user-2"), "job-c")
+	ids, err = UserRunningJobs(ctx, rdb, "user-1")
+	if err != nil {
+		t.Fatalf("UserRunningJobs() error = %v", err)
+	}
+	if want := []string{"job-a", "job-b"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("UserRunningJobs() = %v, want %v", ids, want)
+	}
+}
+
+func TestCancelUserJobs(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	jobs := map[string]string{
+		"job-running": "running",
+		"job-pending": "pending",
+		"job-done":    "success", // Finished, but its runner crashed before the ACK
+		"job-other":   "running", // Another user's
+	}
+	for id, status := range jobs {
+		rdb.HSet(ctx, JobKey(id), "id", id, "status", status)
+	}
+	rdb.SAdd(ctx, UserRunningJobIDsKey("user-1"), "job-running", "job-pending", "job-done", "job-gone")
+	rdb.SAdd(ctx, UserRunningJobIDsKey("user-2"), "job-other")
+
+	n, err := CancelUserJobs(ctx, rdb, "user-1")
+	if err != nil {
+		t.Fatalf("CancelUserJobs() error = %v", err)
+	}
+	if n != 2 {
+		t.Errorf("CancelUserJobs() = %d, want 2", n)
+	}
+
+	for id, want := range map[string]bool{"job-running": true, "job-pending": true, "job-done": false, "job-other": false} {
+		got, err := CancelRequested(ctx, rdb, id)
+		if err != nil {
+			t.Fatalf("CancelRequested(%s) error = %v", id, err)
+		}
+		if got != want {
+			t.Errorf("CancelRequested(%s) = %v, want %v", id, got, want)
+		}
+	}
+	if got, _ := CancelRequested(ctx, rdb, "job-gone"); got {
+		t.Error("CancelRequested() of a missing job = true, want false")
+	}
+	if rdb.Exists(ctx, JobKey("job-gone")).Val() != 0 {
+		t.Error("CancelUserJobs() created the hash of a missing job")
+	}
+
+	// Finished and missing jobs no longer count as running
+	ids, _ := UserRunningJobs(ctx, rdb, "user-1")
+	if want := []string{"job-pending", "job-running"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("UserRunningJobs() after cancel = %v, want %v", ids, want)
+	}
+}
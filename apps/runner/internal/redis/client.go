@@ -2,34 +2,155 @@ package redis
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// Deployment modes for Options.Mode
+const (
+	ModeStandalone = "standalone"
+	ModeSentinel   = "sentinel"
+	ModeCluster    = "cluster"
+)
+
 type Client struct {
-	rdb *redis.Client
+	rdb redis.UniversalClient
 }
 
-func NewClient(ctx context.Context, url string) (*Client, error) {
-	opts, err := redis.ParseURL(url)
+// Options tunes the connection beyond what the Redis URL can express.
+// Zero values keep the go-redis defaults.
+type Options struct {
+	Mode           string   // standalone (default), sentinel or cluster
+	SentinelMaster string   // Master name monitored by the sentinels
+	Addrs          []string // Sentinel or cluster node addresses (host:port)
+
+	PoolSize      int           // Max socket connections (go-redis default: 10 per CPU)
+	DialTimeout   time.Duration // Timeout for establishing new connections
+	TLSCAFile     string        // PEM CA bundle used to verify the server certificate
+	TLSSkipVerify bool          // Skip server certificate verification (testing only)
+
+	KeyPrefix string // Namespace of every key, see SetKeyPrefix
+}
+
+// NewClient connects to Redis in the configured mode. In sentinel and cluster
+// mode the nodes come from o.Addrs; credentials, DB and TLS still come from the URL.
+// It also sets the key prefix used by the key builders.
+func NewClient(ctx context.Context, url string, o Options) (*Client, error) {
+	SetKeyPrefix(o.KeyPrefix)
+
+	rdb, err := newUniversalClient(url, o)
 	if err != nil {
-		return nil, fmt.Errorf("invalid redis URL: %w", err)
+		return nil, err
 	}
 
-	rdb := redis.NewClient(opts)
-
 	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
 		return nil, fmt.Errorf("failed to ping redis: %w", err)
 	}
 
 	return &Client{rdb: rdb}, nil
 }
 
+// newUniversalClient builds the client type matching o.Mode
+func newUniversalClient(url string, o Options) (redis.UniversalClient, error) {
+	opts, err := clientOptions(url, o)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o.Mode {
+	case "", ModeStandalone:
+		return redis.NewClient(opts), nil
+
+	case ModeSentinel:
+		if o.SentinelMaster == "" || len(o.Addrs) == 0 {
+			return nil, fmt.Errorf("redis sentinel mode requires a master name and sentinel addresses")
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    o.SentinelMaster,
+			SentinelAddrs: o.Addrs,
+			Username:      opts.Username,
+			Password:      opts.Password,
+			DB:            opts.DB,
+			PoolSize:      opts.PoolSize,
+			DialTimeout:   opts.DialTimeout,
+			TLSConfig:     opts.TLSConfig,
+		}), nil
+
+	case ModeCluster:
+		if len(o.Addrs) == 0 {
+			return nil, fmt.Errorf("redis cluster mode requires node addresses")
+		}
+		if opts.DB != 0 {
+			return nil, fmt.Errorf("redis cluster mode supports only DB 0, got %d", opts.DB)
+		}
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:       o.Addrs,
+			Username:    opts.Username,
+			Password:    opts.Password,
+			PoolSize:    opts.PoolSize,
+			DialTimeout: opts.DialTimeout,
+			TLSConfig:   opts.TLSConfig,
+		}), nil
+
+	default:
+		return nil, fmt.Errorf("unknown redis mode %q (want standalone, sentinel or cluster)", o.Mode)
+	}
+}
+
+// clientOptions parses the URL and applies o on top of it
+func clientOptions(url string, o Options) (*redis.Options, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+
+	if o.PoolSize > 0 {
+		opts.PoolSize = o.PoolSize
+	}
+	if o.DialTimeout > 0 {
+		opts.DialTimeout = o.DialTimeout
+	}
+
+	if o.TLSCAFile != "" || o.TLSSkipVerify {
+		// TLS settings only make sense for rediss:// URLs
+		if opts.TLSConfig == nil {
+			return nil, fmt.Errorf("redis TLS options require a rediss:// URL")
+		}
+		if err := applyTLS(opts.TLSConfig, o); err != nil {
+			return nil, err
+		}
+	}
+
+	return opts, nil
+}
+
+// applyTLS loads the CA bundle and verification setting into cfg
+func applyTLS(cfg *tls.Config, o Options) error {
+	if o.TLSCAFile != "" {
+		pem, err := os.ReadFile(o.TLSCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read redis CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("redis CA file %s contains no PEM certificates", o.TLSCAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	cfg.InsecureSkipVerify = o.TLSSkipVerify
+	return nil
+}
+
 func (c *Client) Close() error {
 	return c.rdb.Close()
 }
 
-func (c *Client) Redis() *redis.Client {
+func (c *Client) Redis() redis.UniversalClient {
 	return c.rdb
 }
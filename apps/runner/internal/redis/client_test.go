@@ -0,0 +1,191 @@
+package redis
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// writeCAFile writes a self-signed CA certificate and returns its path
+func writeCAFile(t *testing.T) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "repobox test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatalf("failed to write CA file: %v", err)
+	}
+	return path
+}
+
+func TestClientOptions(t *testing.T) {
+	opts, err := clientOptions("redis://localhost:6379/2", Options{PoolSize: 25, DialTimeout: 2 * time.Second})
+	if err != nil {
+		t.Fatalf("clientOptions() error = %v", err)
+	}
+	if opts.PoolSize != 25 {
+		t.Errorf("PoolSize = %d, want 25", opts.PoolSize)
+	}
+	if opts.DialTimeout != 2*time.Second {
+		t.Errorf("DialTimeout = %v, want 2s", opts.DialTimeout)
+	}
+	if opts.DB != 2 {
+		t.Errorf("DB = %d, want 2 from the URL", opts.DB)
+	}
+
+	// Zero values leave the parsed options alone
+	defaults, err := clientOptions("redis://localhost:6379", Options{})
+	if err != nil {
+		t.Fatalf("clientOptions() error = %v", err)
+	}
+	if defaults.PoolSize != 0 || defaults.DialTimeout != 0 || defaults.TLSConfig != nil {
+		t.Errorf("options changed without settings: pool=%d dial=%v tls=%v", defaults.PoolSize, defaults.DialTimeout, defaults.TLSConfig)
+	}
+}
+
+func TestClientOptions_TLS(t *testing.T) {
+	caFile := writeCAFile(t)
+	invalid := filepath.Join(t.TempDir(), "invalid.pem")
+	if err := os.WriteFile(invalid, []byte("not a certificate"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		url      string
+		opts     Options
+		wantErr  bool
+		wantCA   bool
+		wantSkip bool
+	}{
+		{"CA file", "rediss://redis.example.com:6380", Options{TLSCAFile: caFile}, false, true, false},
+		{"skip verify", "rediss://redis.example.com:6380", Options{TLSSkipVerify: true}, false, false, true},
+		{"plain URL", "redis://redis.example.com:6379", Options{TLSCAFile: caFile}, true, false, false},
+		{"missing CA file", "rediss://redis.example.com:6380", Options{TLSCAFile: filepath.Join(t.TempDir(), "missing.pem")}, true, false, false},
+		{"no certificates", "rediss://redis.example.com:6380", Options{TLSCAFile: invalid}, true, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := clientOptions(tt.url, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("clientOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			cfg := opts.TLSConfig
+			if cfg.ServerName != "redis.example.com" {
+				t.Errorf("ServerName = %q, want the URL host", cfg.ServerName)
+			}
+			if cfg.InsecureSkipVerify != tt.wantSkip {
+				t.Errorf("InsecureSkipVerify = %v, want %v", cfg.InsecureSkipVerify, tt.wantSkip)
+			}
+			if !tt.wantCA {
+				if cfg.RootCAs != nil {
+					t.Error("RootCAs set without a CA file")
+				}
+				return
+			}
+			if cfg.RootCAs == nil {
+				t.Fatal("RootCAs not set")
+			}
+			if !cfg.RootCAs.Equal(poolOf(t, caFile)) {
+				t.Error("RootCAs does not match the CA file")
+			}
+		})
+	}
+}
+
+func poolOf(t *testing.T, caFile string) *x509.CertPool {
+	t.Helper()
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		t.Fatalf("failed to read CA file: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(data)
+	return pool
+}
+
+func TestNewUniversalClient_Mode(t *testing.T) {
+	addrs := []string{"10.0.0.1:26379", "10.0.0.2:26379"}
+
+	tests := []struct {
+		name     string
+		url      string
+		opts     Options
+		wantAddr string // Options().Addr of a *redis.Client
+		wantType string
+		wantErr  bool
+	}{
+		{"default", "redis://localhost:6379", Options{}, "localhost:6379", "client", false},
+		{"standalone", "redis://localhost:6379", Options{Mode: ModeStandalone}, "localhost:6379", "client", false},
+		{"sentinel", "redis://:secret@localhost:6379/1", Options{Mode: ModeSentinel, SentinelMaster: "mymaster", Addrs: addrs}, "FailoverClient", "client", false},
+		{"sentinel without master", "redis://localhost:6379", Options{Mode: ModeSentinel, Addrs: addrs}, "", "", true},
+		{"sentinel without addrs", "redis://localhost:6379", Options{Mode: ModeSentinel, SentinelMaster: "mymaster"}, "", "", true},
+		{"cluster", "redis://:secret@localhost:6379", Options{Mode: ModeCluster, Addrs: addrs, KeyPrefix: "repobox:"}, "", "cluster", false},
+		{"cluster without addrs", "redis://localhost:6379", Options{Mode: ModeCluster}, "", "", true},
+		{"cluster with DB", "redis://localhost:6379/2", Options{Mode: ModeCluster, Addrs: addrs}, "", "", true},
+		{"unknown mode", "redis://localhost:6379", Options{Mode: "replicated"}, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rdb, err := newUniversalClient(tt.url, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newUniversalClient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			defer rdb.Close()
+
+			switch c := rdb.(type) {
+			case *redis.Client:
+				if tt.wantType != "client" {
+					t.Fatalf("got *redis.Client, want %s", tt.wantType)
+				}
+				if got := c.Options().Addr; got != tt.wantAddr {
+					t.Errorf("Addr = %q, want %q", got, tt.wantAddr)
+				}
+			case *redis.ClusterClient:
+				if tt.wantType != "cluster" {
+					t.Fatalf("got *redis.ClusterClient, want %s", tt.wantType)
+				}
+				if got := c.Options(); len(got.Addrs) != len(addrs) || got.Password != "secret" {
+					t.Errorf("cluster options = addrs %v password %q, want %v from REDIS_ADDRS and password from the URL", got.Addrs, got.Password, addrs)
+				}
+			default:
+				t.Fatalf("unexpected client type %T", rdb)
+			}
+		})
+	}
+}
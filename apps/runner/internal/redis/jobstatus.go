@@ -0,0 +1,48 @@
+package redis
+
+import (
+	"context"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/job"
+)
+
+// setJobStatusScript sets the job hash fields (ARGV[2:]) only when the current
+// status is empty or listed in ARGV[1] (",a,b,"). Returns 1 when set, or the
+// current status when refused.
+var setJobStatusScript = redis.NewScript(`
+local current = redis.call("HGET", KEYS[1], "status")
+if current and current ~= "" and not string.find(ARGV[1], "," .. current .. ",", 1, true) then
+	return current
+end
+redis.call("HSET", KEYS[1], unpack(ARGV, 2))
+return 1
+`)
+
+// SetJobStatus moves a job to status and sets fields in one step. The change
+// is refused with job.ErrInvalidTransition when the job's current status may
+// not move to status (see job.CanTransition), so e.g. a late failure can't
+// overwrite a success. fields must not contain "status".
+func SetJobStatus(ctx context.Context, rdb redis.UniversalClient, jobID string, status job.Status, fields map[string]interface{}) error {
+	from := job.AllowedFrom(status)
+	allowed := make([]string, len(from))
+	for i, s := range from {
+		allowed[i] = string(s)
+	}
+
+	args := make([]interface{}, 0, 3+2*len(fields))
+	args = append(args, ","+strings.Join(allowed, ",")+",", "status", string(status))
+	for k, v := range fields {
+		args = append(args, k, v)
+	}
+
+	res, err := setJobStatusScript.Run(ctx, rdb, []string{JobKey(jobID)}, args...).Result()
+	if err != nil {
+		return err
+	}
+	if current, ok := res.(string); ok {
+		return job.TransitionError(job.Status(current), status)
+	}
+	return nil
+}
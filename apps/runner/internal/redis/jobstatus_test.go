@@ -0,0 +1,60 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/job"
+)
+
+func TestSetJobStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		current    string
+		to         job.Status
+		wantErr    bool
+		wantStatus string
+	}{
+		{"no status yet", "", job.StatusRunning, false, "running"},
+		{"pending to running", "pending", job.StatusRunning, false, "running"},
+		{"running to success", "running", job.StatusSuccess, false, "success"},
+		{"failed to running for push retry", "failed", job.StatusRunning, false, "running"},
+		{"late failure after success", "success", job.StatusFailed, true, "success"},
+		{"failure after cancel", "cancelled", job.StatusFailed, true, "cancelled"},
+		{"cancelled job not started", "cancelled", job.StatusRunning, true, "cancelled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			defer rdb.Close()
+			ctx := context.Background()
+
+			rdb.HSet(ctx, JobKey("job-1"), "id", "job-1")
+			if tt.current != "" {
+				rdb.HSet(ctx, JobKey("job-1"), "status", tt.current)
+			}
+
+			err := SetJobStatus(ctx, rdb, "job-1", tt.to, map[string]interface{}{"error_code": "agent_failed", "lines_added": 3})
+			if tt.wantErr != errors.Is(err, job.ErrInvalidTransition) {
+				t.Fatalf("SetJobStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("SetJobStatus() error = %v", err)
+			}
+
+			data := rdb.HGetAll(ctx, JobKey("job-1")).Val()
+			if data["status"] != tt.wantStatus {
+				t.Errorf("status = %q, want %q", data["status"], tt.wantStatus)
+			}
+			// Fields are written together with the status, or not at all
+			if wantFields := !tt.wantErr; (data["error_code"] == "agent_failed" && data["lines_added"] == "3") != wantFields {
+				t.Errorf("fields = %v, want written = %v", data, wantFields)
+			}
+		})
+	}
+}
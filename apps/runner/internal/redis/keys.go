@@ -1,48 +1,168 @@
 package redis
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // Redis key patterns - must match web app keys.ts
+
+// prefix namespaces every key so several environments can share one Redis.
+// Set from REDIS_KEY_PREFIX when the client is created; the web app applies
+// the same prefix with ioredis' keyPrefix.
+var prefix string
+
+// SetKeyPrefix sets the prefix of every key built here, e.g. "staging:".
+// Call it once at startup, before any key is built.
+func SetKeyPrefix(p string) {
+	prefix = p
+}
+
+// KeyPrefix returns the prefix of every key built here
+func KeyPrefix() string {
+	return prefix
+}
+
+// key builds a prefixed key
+func key(format string, args ...interface{}) string {
+	return prefix + fmt.Sprintf(format, args...)
+}
+
+// HashTag returns the part of s Redis Cluster hashes a key by: the text
+// between the first "{" and the next "}". Empty when s has no such tag, then
+// the whole key is hashed. Keys sharing a tag are in the same slot, so
+// scripts and transactions may span them.
+func HashTag(s string) string {
+	start := strings.IndexByte(s, '{')
+	if start < 0 {
+		return ""
+	}
+	end := strings.IndexByte(s[start+1:], '}')
+	if end < 0 {
+		return ""
+	}
+	return s[start+1 : start+1+end]
+}
+
+// Consumer group names are scoped to their stream and aren't prefixed
 const (
-	// Job stream keys (legacy single-shot jobs)
-	JobsStream        = "jobs:stream"
-	JobsConsumerGroup = "jobs:stream:runners"
-
-	// Work Session stream keys
-	WorkSessionsInitStream         = "work_sessions:init:stream"
-	WorkSessionsInitConsumerGroup  = "work_sessions:init:runners"
-	WorkSessionsJobsStream         = "work_sessions:jobs:stream"
-	WorkSessionsJobsConsumerGroup  = "work_sessions:jobs:runners"
-	WorkSessionsPushStream         = "work_sessions:push:stream"
-	WorkSessionsPushConsumerGroup  = "work_sessions:push:runners"
+	JobsConsumerGroup             = "jobs:stream:runners"
+	WorkSessionsInitConsumerGroup = "work_sessions:init:runners"
+	WorkSessionsJobsConsumerGroup = "work_sessions:jobs:runners"
+	WorkSessionsPushConsumerGroup = "work_sessions:push:runners"
 )
 
+// The job queue keys share the {queue} hash tag: a runner blocks on both
+// lanes in one XREADGROUP and moves jobs between them and the delayed set in
+// one script or transaction, which Redis Cluster only allows within a slot.
+
+// Job stream keys (legacy single-shot jobs)
+func JobsStream() string {
+	return key("jobs:{queue}:stream")
+}
+
+// JobsHighStream is the high-priority lane, read with the same consumer group name
+func JobsHighStream() string {
+	return key("jobs:{queue}:stream:high")
+}
+
+// JobsDelayedKey holds jobs the reading runner couldn't take, scored by ready-at time (unix ms)
+func JobsDelayedKey() string {
+	return key("jobs:{queue}:delayed")
+}
+
+// Work Session stream keys
+func WorkSessionsInitStream() string {
+	return key("work_sessions:init:stream")
+}
+
+func WorkSessionsJobsStream() string {
+	return key("work_sessions:jobs:stream")
+}
+
+func WorkSessionsPushStream() string {
+	return key("work_sessions:push:stream")
+}
+
+// WorkSessionsAwaitingApprovalKey holds sessions awaiting push approval, scored by approval deadline (unix ms)
+func WorkSessionsAwaitingApprovalKey() string {
+	return key("work_sessions:awaiting_approval")
+}
+
 // Key builders
 func JobKey(jobID string) string {
-	return fmt.Sprintf("job:%s", jobID)
+	return key("job:%s", jobID)
 }
 
 func JobOutputKey(jobID string) string {
-	return fmt.Sprintf("job:%s:output", jobID)
+	return key("job:%s:output", jobID)
+}
+
+// JobToolResultsKey maps tool_use IDs to the full tool results of a job (AI_TOOL_RESULTS_FULL)
+func JobToolResultsKey(jobID string) string {
+	return key("job:%s:tool_results", jobID)
+}
+
+// JobLockKey is held by the worker executing the job, so a redelivered message doesn't run it twice
+func JobLockKey(jobID string) string {
+	return key("job:%s:lock", jobID)
 }
 
 func GitProviderKey(userID, providerID string) string {
-	return fmt.Sprintf("git_provider:%s:%s", userID, providerID)
+	return key("git_provider:%s:%s", userID, providerID)
+}
+
+// UserKey is the web app's user hash (name, email, ...)
+func UserKey(userID string) string {
+	return key("user:%s", userID)
 }
 
 func UserRunningJobsKey(userID string) string {
-	return fmt.Sprintf("runner:user:%s:running", userID)
+	return key("runner:user:%s:running", userID)
+}
+
+// UserRunningJobIDsKey is the set of IDs of a user's jobs held by a worker
+func UserRunningJobIDsKey(userID string) string {
+	return key("runner:user:%s:running:jobs", userID)
+}
+
+// RepoRunningJobsKey counts running jobs of a repository, keyed by git.NormalizeRepoURL
+func RepoRunningJobsKey(repo string) string {
+	return key("runner:repo:%s:running", repo)
+}
+
+func RunnerCapabilitiesKey(runnerID string) string {
+	return key("runner:%s:capabilities", runnerID)
 }
 
 // Work Session key builders
 func WorkSessionKey(sessionID string) string {
-	return fmt.Sprintf("work_session:%s", sessionID)
+	return key("work_session:%s", sessionID)
 }
 
 func WorkSessionOutputKey(sessionID string) string {
-	return fmt.Sprintf("work_session:%s:output", sessionID)
+	return key("work_session:%s:output", sessionID)
+}
+
+// OutputSeqKey holds the sequence counter of the output list at outputKey
+func OutputSeqKey(outputKey string) string {
+	return outputKey + ":seq"
+}
+
+// WorkSessionToolResultsKey maps tool_use IDs to the full tool results of a session's prompts
+func WorkSessionToolResultsKey(sessionID string) string {
+	return key("work_session:%s:tool_results", sessionID)
 }
 
 func WorkSessionJobsKey(sessionID string) string {
-	return fmt.Sprintf("work_session:%s:jobs", sessionID)
+	return key("work_session:%s:jobs", sessionID)
+}
+
+func WorkSessionPushLockKey(sessionID string) string {
+	return key("work_session:%s:push_lock", sessionID)
+}
+
+// SecretKey is a user's encrypted secret (field "value"), injected into the agent's environment on request
+func SecretKey(userID, name string) string {
+	return key("secrets:%s:%s", userID, name)
 }
@@ -0,0 +1,76 @@
+package redis
+
+import "testing"
+
+func TestKeyBuilders(t *testing.T) {
+	builders := []struct {
+		name  string
+		build func() string
+		want  string // Unprefixed key, as the web app builds it without a prefix
+	}{
+		{"JobsStream", JobsStream, "jobs:{queue}:stream"},
+		{"JobsHighStream", JobsHighStream, "jobs:{queue}:stream:high"},
+		{"JobsDelayedKey", JobsDelayedKey, "jobs:{queue}:delayed"},
+		{"WorkSessionsInitStream", WorkSessionsInitStream, "work_sessions:init:stream"},
+		{"WorkSessionsJobsStream", WorkSessionsJobsStream, "work_sessions:jobs:stream"},
+		{"WorkSessionsPushStream", WorkSessionsPushStream, "work_sessions:push:stream"},
+		{"WorkSessionsAwaitingApprovalKey", WorkSessionsAwaitingApprovalKey, "work_sessions:awaiting_approval"},
+		{"JobKey", func() string { return JobKey("j1") }, "job:j1"},
+		{"JobOutputKey", func() string { return JobOutputKey("j1") }, "job:j1:output"},
+		{"JobToolResultsKey", func() string { return JobToolResultsKey("j1") }, "job:j1:tool_results"},
+		{"JobLockKey", func() string { return JobLockKey("j1") }, "job:j1:lock"},
+		{"GitProviderKey", func() string { return GitProviderKey("u1", "p1") }, "git_provider:u1:p1"},
+		{"UserKey", func() string { return UserKey("u1") }, "user:u1"},
+		{"UserRunningJobsKey", func() string { return UserRunningJobsKey("u1") }, "runner:user:u1:running"},
+		{"UserRunningJobIDsKey", func() string { return UserRunningJobIDsKey("u1") }, "runner:user:u1:running:jobs"},
+		{"RepoRunningJobsKey", func() string { return RepoRunningJobsKey("github.com/acme/app") }, "runner:repo:github.com/acme/app:running"},
+		{"RunnerCapabilitiesKey", func() string { return RunnerCapabilitiesKey("r1") }, "runner:r1:capabilities"},
+		{"WorkSessionKey", func() string { return WorkSessionKey("s1") }, "work_session:s1"},
+		{"WorkSessionOutputKey", func() string { return WorkSessionOutputKey("s1") }, "work_session:s1:output"},
+		{"WorkSessionToolResultsKey", func() string { return WorkSessionToolResultsKey("s1") }, "work_session:s1:tool_results"},
+		{"WorkSessionJobsKey", func() string { return WorkSessionJobsKey("s1") }, "work_session:s1:jobs"},
+		{"WorkSessionPushLockKey", func() string { return WorkSessionPushLockKey("s1") }, "work_session:s1:push_lock"},
+		{"SecretKey", func() string { return SecretKey("u1", "NPM_TOKEN") }, "secrets:u1:NPM_TOKEN"},
+	}
+
+	for _, prefix := range []string{"", "staging:"} {
+		SetKeyPrefix(prefix)
+		for _, b := range builders {
+			if got := b.build(); got != prefix+b.want {
+				t.Errorf("prefix %q: %s() = %q, want %q", prefix, b.name, got, prefix+b.want)
+			}
+		}
+	}
+	SetKeyPrefix("")
+}
+
+func TestHashTag(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"{repobox}:jobs:stream", "repobox"},
+		{"staging:{repobox}:jobs:delayed", "repobox"},
+		{"repobox:jobs:stream", ""},
+		{"{}:jobs:stream", ""},
+		{"{repobox:jobs:stream", ""},
+		{"{a}{b}", "a"},
+	}
+	for _, tt := range tests {
+		if got := HashTag(tt.in); got != tt.want {
+			t.Errorf("HashTag(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	// The job queue keys share a slot with any untagged prefix, other keys
+	// are spread over the cluster
+	SetKeyPrefix("staging:")
+	defer SetKeyPrefix("")
+	for _, k := range []string{JobsStream(), JobsHighStream(), JobsDelayedKey()} {
+		if got := HashTag(k); got != "queue" {
+			t.Errorf("HashTag(%q) = %q, want queue", k, got)
+		}
+	}
+	if got := HashTag(JobKey("job-1")); got != "" {
+		t.Errorf("HashTag(%q) = %q, want none", JobKey("job-1"), got)
+	}
+}
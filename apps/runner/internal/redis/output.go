@@ -0,0 +1,181 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// OutputSequencer assigns strictly increasing sequence numbers to the entries of
+// output lists, so the UI can order lines that share a millisecond timestamp.
+// The counter of each list is kept in Redis, next to the list, so every
+// executor writing to a session's output continues the same numbering.
+// It also writes the entries, optionally batched to save Redis round-trips.
+// Entries that fail to write (Redis unreachable) stay buffered and go out with
+// the next write of their list.
+type OutputSequencer struct {
+	rdb    redis.UniversalClient
+	mu     sync.Mutex
+	ranges map[string]*seqRange
+
+	// Batching: entries are held until batchSize are pending, batchInterval
+	// has passed since the first one, or the key is flushed
+	batchSize     int
+	batchInterval time.Duration
+	bufMu         sync.Mutex
+	pending       map[string]*pendingOutput
+}
+
+// seqBlock is how many sequence numbers a writer reserves from a list's
+// counter at once, so numbering costs one round-trip per block, not per line
+const seqBlock = 1000
+
+// seqRange is the reserved, not yet assigned part of a block
+type seqRange struct {
+	next, last int64
+}
+
+// maxBufferedOutput caps the unwritten entries kept per list while Redis is
+// unreachable; the oldest are dropped first
+const maxBufferedOutput = 10000
+
+// pendingOutput holds the unwritten entries of one output list
+type pendingOutput struct {
+	entries []interface{}
+	ttl     time.Duration
+	timer   *time.Timer
+}
+
+// NewOutputSequencer creates a sequencer backed by the given client that
+// writes each entry immediately
+func NewOutputSequencer(rdb redis.UniversalClient) *OutputSequencer {
+	return NewBatchedOutputSequencer(rdb, 1, 0)
+}
+
+// NewBatchedOutputSequencer creates a sequencer that writes up to batchSize
+// entries per list in one pipelined RPUSH + EXPIRE, at the latest batchInterval
+// after the first pending entry. A batchSize of 1 or less disables batching;
+// with a zero interval entries wait for a full batch or a flush.
+func NewBatchedOutputSequencer(rdb redis.UniversalClient, batchSize int, batchInterval time.Duration) *OutputSequencer {
+	return &OutputSequencer{
+		rdb:           rdb,
+		ranges:        make(map[string]*seqRange),
+		batchSize:     batchSize,
+		batchInterval: batchInterval,
+		pending:       make(map[string]*pendingOutput),
+	}
+}
+
+// Next returns the next sequence number for an output list, from a block
+// reserved on the list's counter (OutputSeqKey). Each writer reserves a new
+// block for its first entry, so numbers keep increasing across executors
+// writing to the same session output. Returns 0, an unnumbered entry, when no
+// block can be reserved.
+func (s *OutputSequencer) Next(ctx context.Context, key string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.ranges[key]
+	if !ok || r.next > r.last {
+		last, err := s.rdb.IncrBy(context.WithoutCancel(ctx), OutputSeqKey(key), seqBlock).Result()
+		if err != nil {
+			return 0
+		}
+		r = &seqRange{next: last - seqBlock + 1, last: last}
+		s.ranges[key] = r
+	}
+	n := r.next
+	r.next++
+	return n
+}
+
+// Append adds an entry to an output list and refreshes the list's TTL
+func (s *OutputSequencer) Append(ctx context.Context, key, entry string, ttl time.Duration) {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+
+	p, ok := s.pending[key]
+	if !ok {
+		p = &pendingOutput{}
+		s.pending[key] = p
+		s.armFlush(ctx, key, p)
+	}
+	p.entries = append(p.entries, entry)
+	p.ttl = ttl
+
+	if len(p.entries) >= s.batchSize {
+		_ = s.flushLocked(ctx, key)
+	}
+}
+
+// Flush writes the pending entries of an output list. On error they stay
+// pending for the next write.
+func (s *OutputSequencer) Flush(ctx context.Context, key string) error {
+	s.bufMu.Lock()
+	defer s.bufMu.Unlock()
+	return s.flushLocked(ctx, key)
+}
+
+// flushLocked writes pending entries while bufMu is held, so batches of a
+// list are written in order
+func (s *OutputSequencer) flushLocked(ctx context.Context, key string) error {
+	p, ok := s.pending[key]
+	if !ok {
+		return nil
+	}
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+
+	if err := s.write(ctx, key, p.entries, p.ttl); err != nil {
+		if n := len(p.entries); n > maxBufferedOutput {
+			p.entries = append([]interface{}(nil), p.entries[n-maxBufferedOutput:]...)
+		}
+		s.armFlush(ctx, key, p)
+		return err
+	}
+	delete(s.pending, key)
+	return nil
+}
+
+// armFlush schedules the interval flush of a batched list
+func (s *OutputSequencer) armFlush(ctx context.Context, key string, p *pendingOutput) {
+	if s.batchSize > 1 && s.batchInterval > 0 {
+		p.timer = time.AfterFunc(s.batchInterval, func() { _ = s.Flush(ctx, key) })
+	}
+}
+
+// write pushes entries in one round-trip. It ignores cancellation so the
+// output of a timed-out or cancelled job is still stored.
+func (s *OutputSequencer) write(ctx context.Context, key string, entries []interface{}, ttl time.Duration) error {
+	ctx = context.WithoutCancel(ctx)
+	pipe := s.rdb.Pipeline()
+	pipe.RPush(ctx, key, entries...)
+	pipe.Expire(ctx, key, ttl)
+	pipe.Expire(ctx, OutputSeqKey(key), ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Forget writes any pending entries, retrying while Redis is unreachable, and
+// drops the reserved numbers and whatever is still unwritten for a key once its writer
+// is done
+func (s *OutputSequencer) Forget(key string) {
+	_ = Retry(context.Background(), StatusRetry, func(ctx context.Context) error {
+		return s.Flush(ctx, key)
+	})
+
+	s.bufMu.Lock()
+	if p, ok := s.pending[key]; ok && p.timer != nil {
+		p.timer.Stop()
+	}
+	delete(s.pending, key)
+	s.bufMu.Unlock()
+
+	s.mu.Lock()
+	delete(s.ranges, key)
+	s.mu.Unlock()
+}
@@ -0,0 +1,195 @@
+package redis
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestOutputSequencer_Concurrent(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+
+	seq := NewOutputSequencer(rdb)
+	ctx := context.Background()
+
+	// Simulates stdout and stderr readers writing to the same job output
+	const perStream = 200
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		got []int64
+	)
+	for stream := 0; stream < 2; stream++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perStream; i++ {
+				n := seq.Next(ctx, JobOutputKey("job-1"))
+				mu.Lock()
+				got = append(got, n)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+	for i, n := range got {
+		if n != int64(i+1) {
+			t.Fatalf("sequence numbers not unique and gapless: position %d has %d", i, n)
+		}
+	}
+}
+
+func TestOutputSequencer_SharedCounter(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+	key := WorkSessionOutputKey("s1")
+
+	// The init and job executors write to the same session output
+	initSeq, jobSeq := NewOutputSequencer(rdb), NewOutputSequencer(rdb)
+	var last int64
+	next := func(seq *OutputSequencer, name string) {
+		t.Helper()
+		n := seq.Next(ctx, key)
+		if n <= last {
+			t.Errorf("%s Next() = %d, want more than %d", name, n, last)
+		}
+		last = n
+	}
+
+	next(initSeq, "init")
+	next(initSeq, "init")
+	initSeq.Forget(key)
+	next(jobSeq, "job")
+	jobSeq.Forget(key)
+
+	// Without Redis no block can be reserved and the entry goes unnumbered
+	mr.SetError("connection refused")
+	if n := initSeq.Next(ctx, key); n != 0 {
+		t.Errorf("Next() without Redis = %d, want 0", n)
+	}
+	mr.SetError("")
+	next(initSeq, "init after the outage")
+	next(initSeq, "init after the outage")
+}
+
+// roundTrips counts commands and pipelines sent to Redis
+type roundTrips struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (r *roundTrips) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.n
+}
+
+func (r *roundTrips) inc() {
+	r.mu.Lock()
+	r.n++
+	r.mu.Unlock()
+}
+
+func (r *roundTrips) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (r *roundTrips) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		r.inc()
+		return next(ctx, cmd)
+	}
+}
+
+func (r *roundTrips) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		r.inc()
+		return next(ctx, cmds)
+	}
+}
+
+func TestOutputSequencer_Append(t *testing.T) {
+	tests := []struct {
+		name       string
+		batchSize  int
+		lines      int
+		wantWrites int
+	}{
+		{"unbatched", 1, 120, 120},
+		{"batched", 50, 120, 3}, // two full batches, the rest on Forget
+		{"batch larger than output", 500, 120, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			defer rdb.Close()
+			ctx := context.Background()
+
+			trips := &roundTrips{}
+			rdb.AddHook(trips)
+
+			key := JobOutputKey("job-1")
+			seq := NewBatchedOutputSequencer(rdb, tt.batchSize, 0)
+			for i := 0; i < tt.lines; i++ {
+				seq.Append(ctx, key, strconv.Itoa(i), time.Hour)
+			}
+			seq.Forget(key)
+
+			if got := trips.count(); got != tt.wantWrites {
+				t.Errorf("round-trips = %d, want %d", got, tt.wantWrites)
+			}
+
+			got, err := rdb.LRange(ctx, key, 0, -1).Result()
+			if err != nil {
+				t.Fatalf("LRange: %v", err)
+			}
+			if len(got) != tt.lines {
+				t.Fatalf("stored %d lines, want %d", len(got), tt.lines)
+			}
+			for i, line := range got {
+				if line != strconv.Itoa(i) {
+					t.Fatalf("line %d = %q, want %q", i, line, strconv.Itoa(i))
+				}
+			}
+			if ttl := mr.TTL(key); ttl != time.Hour {
+				t.Errorf("TTL = %v, want %v", ttl, time.Hour)
+			}
+		})
+	}
+}
+
+func TestOutputSequencer_FlushAfterInterval(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	key := JobOutputKey("job-1")
+	seq := NewBatchedOutputSequencer(rdb, 50, 20*time.Millisecond)
+	seq.Append(ctx, key, "a", time.Hour)
+	seq.Append(ctx, key, "b", time.Hour)
+
+	if n := rdb.LLen(ctx, key).Val(); n != 0 {
+		t.Fatalf("LLen before interval = %d, want 0", n)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for rdb.LLen(ctx, key).Val() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("pending lines not flushed after the batch interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
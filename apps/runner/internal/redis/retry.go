@@ -0,0 +1,54 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/job"
+)
+
+// RetryPolicy sets how often a write is retried while Redis is unreachable.
+// go-redis reconnects on its own, but commands sent during the outage fail.
+type RetryPolicy struct {
+	Attempts int           // Total tries, including the first
+	Backoff  time.Duration // Wait before the second try, doubled after each failure
+}
+
+// maxRetryBackoff caps the doubled wait between tries
+const maxRetryBackoff = 5 * time.Second
+
+var (
+	// StatusRetry covers intermediate status updates
+	StatusRetry = RetryPolicy{Attempts: 3, Backoff: 200 * time.Millisecond}
+
+	// TerminalRetry covers the update that ends a job or session run; when it
+	// is lost the UI shows the run as in progress forever
+	TerminalRetry = RetryPolicy{Attempts: 8, Backoff: 250 * time.Millisecond}
+)
+
+// Retry runs fn until it succeeds, Redis answers with an error reply, or the
+// attempts run out. It ignores cancellation of ctx so the final status of a
+// cancelled or timed-out job is still stored.
+func Retry(ctx context.Context, p RetryPolicy, fn func(ctx context.Context) error) error {
+	ctx = context.WithoutCancel(ctx)
+	backoff := p.Backoff
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(ctx); err == nil || !isTransient(err) || attempt >= p.Attempts {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
+
+// isTransient reports whether err is a connection problem rather than an
+// error reply from the server (WRONGTYPE, NOAUTH, ...) or a refused job status
+// change, which retrying can't fix
+func isTransient(err error) bool {
+	var reply redis.Error
+	return !errors.As(err, &reply) && !errors.Is(err, job.ErrInvalidTransition)
+}
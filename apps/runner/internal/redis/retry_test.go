@@ -0,0 +1,186 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/job"
+)
+
+// outage fails the next n commands and pipelines as if the connection dropped
+type outage struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (o *outage) fail() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.n > 0 {
+		o.n--
+		return io.EOF
+	}
+	return nil
+}
+
+func (o *outage) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (o *outage) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := o.fail(); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (o *outage) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if err := o.fail(); err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		return next(ctx, cmds)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	policy := RetryPolicy{Attempts: 3, Backoff: time.Millisecond}
+
+	tests := []struct {
+		name      string
+		failures  int
+		wantErr   bool
+		wantCalls int
+	}{
+		{"first try", 0, false, 1},
+		{"recovers within attempts", 2, false, 3},
+		{"outage outlasts attempts", 5, true, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			defer rdb.Close()
+			rdb.AddHook(&outage{n: tt.failures})
+
+			calls := 0
+			err := Retry(context.Background(), policy, func(ctx context.Context) error {
+				calls++
+				return rdb.HSet(ctx, JobKey("job-1"), "status", "success").Err()
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Retry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if !tt.wantErr && mr.HGet(JobKey("job-1"), "status") != "success" {
+				t.Error("status not written")
+			}
+		})
+	}
+}
+
+func TestRetry_ErrorReply(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	// WRONGTYPE won't go away by retrying
+	mr.Set(JobKey("job-1"), "not a hash")
+	calls := 0
+	err := Retry(ctx, RetryPolicy{Attempts: 3, Backoff: time.Millisecond}, func(ctx context.Context) error {
+		calls++
+		return rdb.HSet(ctx, JobKey("job-1"), "status", "success").Err()
+	})
+	if err == nil {
+		t.Fatal("Retry() error = nil, want WRONGTYPE")
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestRetry_RefusedTransition(t *testing.T) {
+	calls := 0
+	err := Retry(context.Background(), RetryPolicy{Attempts: 3, Backoff: time.Millisecond}, func(ctx context.Context) error {
+		calls++
+		return job.TransitionError(job.StatusSuccess, job.StatusFailed)
+	})
+	if !errors.Is(err, job.ErrInvalidTransition) {
+		t.Fatalf("Retry() error = %v, want ErrInvalidTransition", err)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestRetry_IgnoresCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := Retry(ctx, RetryPolicy{Attempts: 1}, func(ctx context.Context) error {
+		return ctx.Err()
+	})
+	if err != nil {
+		t.Errorf("Retry() passed a cancelled context: %v", err)
+	}
+}
+
+func TestOutputSequencer_BuffersDuringOutage(t *testing.T) {
+	tests := []struct {
+		name      string
+		batchSize int
+	}{
+		{"unbatched", 1},
+		{"batched", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			defer rdb.Close()
+			ctx := context.Background()
+
+			down := &outage{n: 2}
+			rdb.AddHook(down)
+
+			key := JobOutputKey("job-1")
+			seq := NewBatchedOutputSequencer(rdb, tt.batchSize, 0)
+			for i := 0; i < 6; i++ {
+				seq.Append(ctx, key, strconv.Itoa(i), time.Hour)
+			}
+			if err := seq.Flush(ctx, key); err != nil {
+				t.Fatalf("Flush() error = %v", err)
+			}
+
+			got, err := rdb.LRange(ctx, key, 0, -1).Result()
+			if err != nil {
+				t.Fatalf("LRange: %v", err)
+			}
+			if len(got) != 6 {
+				t.Fatalf("stored %v, want all 6 lines once Redis is back", got)
+			}
+			for i, line := range got {
+				if line != strconv.Itoa(i) {
+					t.Fatalf("line %d = %q, want %q", i, line, strconv.Itoa(i))
+				}
+			}
+		})
+	}
+}
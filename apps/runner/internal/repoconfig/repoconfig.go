@@ -0,0 +1,150 @@
+package repoconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/repobox/runner/internal/git"
+	"github.com/repobox/runner/internal/yamlsubset"
+)
+
+// FileName is the optional per-repository settings file at the repo root
+const FileName = ".repobox.yml"
+
+// Config holds the settings a repository opts into via FileName
+type Config struct {
+	// BaseBranch overrides the default branch jobs start from
+	BaseBranch string
+	// ValidationCommand is run in the repo after the agent, before commit
+	ValidationCommand string
+	// ProtectedPaths are globs the agent must not modify
+	ProtectedPaths []string
+
+	protected []*regexp.Regexp
+}
+
+// Load reads FileName from the repo root.
+// Returns an empty config and no error if the file does not exist.
+func Load(repoPath string) (*Config, error) {
+	data, err := os.ReadFile(filepath.Join(repoPath, FileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", FileName, err)
+	}
+	return Parse(data)
+}
+
+// LoadCommitted reads FileName as committed at rev, ignoring later commits and
+// uncommitted edits so the agent can't lift protections by changing the file.
+// Returns an empty config and no error if rev has no such file.
+func LoadCommitted(ctx context.Context, g *git.Git, repoPath, rev string) (*Config, error) {
+	data, err := g.ReadFileAt(ctx, repoPath, rev, FileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", FileName, err)
+	}
+	return Parse(data)
+}
+
+// Parse parses the small YAML subset used by FileName: top-level "key: value"
+// scalars and string lists, either as "- item" lines or inline "[a, b]".
+// Unknown keys are ignored so newer settings don't break older runners.
+func Parse(data []byte) (*Config, error) {
+	values, err := yamlsubset.Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", FileName, err)
+	}
+
+	cfg := &Config{}
+	for key, v := range values {
+		switch key {
+		case "base_branch":
+			cfg.BaseBranch, err = v.String(key)
+		case "validation_command":
+			cfg.ValidationCommand, err = v.String(key)
+		case "protected_paths":
+			cfg.ProtectedPaths = v.List
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", FileName, err)
+		}
+	}
+
+	for _, pattern := range cfg.ProtectedPaths {
+		re, err := compileGlob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: protected path %q: %w", FileName, pattern, err)
+		}
+		cfg.protected = append(cfg.protected, re)
+	}
+
+	return cfg, nil
+}
+
+// ProtectedViolations returns the changed paths that match a protected glob.
+// When any path is protected, FileName itself is protected too.
+func (c *Config) ProtectedViolations(changed []string) []string {
+	if len(c.protected) == 0 {
+		return nil
+	}
+
+	var violations []string
+	for _, path := range changed {
+		if path == FileName {
+			violations = append(violations, path)
+			continue
+		}
+		for _, re := range c.protected {
+			if re.MatchString(path) {
+				violations = append(violations, path)
+				break
+			}
+		}
+	}
+	return violations
+}
+
+// compileGlob converts a path glob into a regexp matching repo-relative paths.
+// "*" and "?" stay within one path segment, "**" spans segments, and a pattern
+// also matches everything below it when it names a directory.
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	p := strings.Trim(strings.TrimPrefix(pattern, "./"), "/")
+	if p == "" {
+		return nil, fmt.Errorf("empty pattern")
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; c {
+		case '*':
+			if i+1 < len(p) && p[i+1] == '*' {
+				i++
+				if i+1 < len(p) && p[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("(?:/.*)?$")
+
+	return regexp.Compile(b.String())
+}
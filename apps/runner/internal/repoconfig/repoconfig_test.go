@@ -0,0 +1,161 @@
+package repoconfig
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Config
+		wantErr string
+	}{
+		{
+			name: "all settings",
+			input: `# Repobox settings
+base_branch: develop
+validation_command: "make test # quoted hash"
+protected_paths:
+  - .github/**
+  - 'migrations/*.sql'   # never touch migrations
+unknown_key: ignored
+`,
+			want: Config{
+				BaseBranch:        "develop",
+				ValidationCommand: "make test # quoted hash",
+				ProtectedPaths:    []string{".github/**", "migrations/*.sql"},
+			},
+		},
+		{
+			name:  "inline list",
+			input: "protected_paths: [go.sum, \"vendor/\"]\n",
+			want:  Config{ProtectedPaths: []string{"go.sum", "vendor/"}},
+		},
+		{
+			name:  "empty file",
+			input: "\n# nothing here\n",
+			want:  Config{},
+		},
+		{
+			name:    "list item without key",
+			input:   "- foo\n",
+			wantErr: "line 1: list item without a key",
+		},
+		{
+			name:    "nested map",
+			input:   "base_branch:\n  name: develop\n",
+			wantErr: "line 2: nested values are not supported",
+		},
+		{
+			name:    "list for scalar",
+			input:   "base_branch: [a, b]\n",
+			wantErr: "base_branch must be a string",
+		},
+		{
+			name:    "duplicate key",
+			input:   "base_branch: a\nbase_branch: b\n",
+			wantErr: "duplicate key",
+		},
+		{
+			name:    "not key value",
+			input:   "just text\n",
+			wantErr: "expected \"key: value\"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.input))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got.BaseBranch != tt.want.BaseBranch ||
+				got.ValidationCommand != tt.want.ValidationCommand ||
+				!reflect.DeepEqual(got.ProtectedPaths, tt.want.ProtectedPaths) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProtectedViolations(t *testing.T) {
+	cfg, err := Parse([]byte(`protected_paths:
+  - .github/**
+  - migrations/*.sql
+  - config
+  - "**/secrets.env"
+  - go.su?
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		path      string
+		protected bool
+	}{
+		{".github/workflows/ci.yml", true},
+		{"migrations/001_init.sql", true},
+		{"migrations/nested/002.sql", false},
+		{"migrations/README.md", false},
+		{"config/app.yml", true},
+		{"config", true},
+		{"configuration.go", false},
+		{"secrets.env", true},
+		{"deploy/prod/secrets.env", true},
+		{"go.sum", true},
+		{"go.mod", false},
+		{"src/main.go", false},
+		{FileName, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got := len(cfg.ProtectedViolations([]string{tt.path})) > 0
+			if got != tt.protected {
+				t.Errorf("protected(%q) = %v, want %v", tt.path, got, tt.protected)
+			}
+		})
+	}
+}
+
+func TestProtectedViolations_NoProtectedPaths(t *testing.T) {
+	cfg := &Config{}
+	if got := cfg.ProtectedViolations([]string{FileName, "src/main.go"}); got != nil {
+		t.Errorf("ProtectedViolations() = %v, want nil", got)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() without file error = %v", err)
+	}
+	if cfg.BaseBranch != "" || len(cfg.ProtectedPaths) != 0 {
+		t.Errorf("Load() without file = %+v, want empty", cfg)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, FileName), []byte("base_branch: develop\n"), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", FileName, err)
+	}
+	cfg, err = Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.BaseBranch != "develop" {
+		t.Errorf("BaseBranch = %q, want develop", cfg.BaseBranch)
+	}
+}
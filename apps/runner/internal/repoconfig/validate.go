@@ -0,0 +1,63 @@
+package repoconfig
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// validationEnv lists the runner environment variables passed to the validation
+// command. The command comes from the repository, so runner secrets stay out.
+var validationEnv = []string{"PATH", "HOME", "LANG", "LC_ALL", "TMPDIR"}
+
+// RunValidation runs the repository's validation command in repoPath and
+// streams its combined stdout/stderr to output line by line.
+// Returns an error if the command exits non-zero or cannot be started.
+func RunValidation(ctx context.Context, repoPath, command string, output func(line string)) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = repoPath
+	for _, name := range validationEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			cmd.Env = append(cmd.Env, name+"="+value)
+		}
+	}
+
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	// Don't wait forever on background processes that keep the output open
+	cmd.WaitDelay = 5 * time.Second
+
+	if err := cmd.Start(); err != nil {
+		pw.Close()
+		return fmt.Errorf("failed to start validation command: %w", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(pr)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			output(scanner.Text())
+		}
+		// Drain anything left after a scan error so the command never blocks on the pipe
+		io.Copy(io.Discard, pr)
+	}()
+
+	err := cmd.Wait()
+	pw.Close()
+	<-done
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("validation command interrupted: %w", ctx.Err())
+	}
+	if err != nil {
+		return fmt.Errorf("validation command failed: %w", err)
+	}
+	return nil
+}
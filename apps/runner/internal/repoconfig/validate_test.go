@@ -0,0 +1,37 @@
+package repoconfig
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestRunValidation(t *testing.T) {
+	t.Setenv("ENCRYPTION_KEY", "runner-secret")
+
+	tests := []struct {
+		name    string
+		command string
+		want    []string
+		wantErr bool
+	}{
+		{"success", "echo ok; echo warn >&2", []string{"ok", "warn"}, false},
+		{"failure", "echo broken; exit 3", []string{"broken"}, true},
+		{"runner secrets hidden", "echo \"key=${ENCRYPTION_KEY}\"", []string{"key="}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lines []string
+			err := RunValidation(context.Background(), t.TempDir(), tt.command, func(line string) {
+				lines = append(lines, line)
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RunValidation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(lines, tt.want) {
+				t.Errorf("output = %q, want %q", lines, tt.want)
+			}
+		})
+	}
+}
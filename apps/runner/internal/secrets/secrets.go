@@ -0,0 +1,102 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	rediskeys "github.com/repobox/runner/internal/redis"
+)
+
+var (
+	// ErrInvalidName is returned for a secret name that isn't an allowed environment variable name
+	ErrInvalidName = errors.New("invalid secret name")
+	// ErrNotFound is returned when a referenced secret doesn't exist for the user
+	ErrNotFound = errors.New("secret not found")
+)
+
+// namePattern allows conventional environment variable names
+var namePattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]{0,63}$`)
+
+// reservedNames are variables the runner sets or that change how programs load
+var reservedNames = map[string]bool{
+	"PATH":              true,
+	"HOME":              true,
+	"SHELL":             true,
+	"ANTHROPIC_API_KEY": true,
+}
+
+// reservedPrefixes cover the runner's correlation variables and the dynamic loader
+var reservedPrefixes = []string{"REPOBOX_", "LD_", "DYLD_"}
+
+// Decryptor decrypts values encrypted by the web app
+type Decryptor interface {
+	Decrypt(encrypted string) (string, error)
+}
+
+// ValidateName checks a secret name against the allowlist pattern and the reserved names
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("%w: %q must match %s", ErrInvalidName, name, namePattern)
+	}
+	if reservedNames[name] {
+		return fmt.Errorf("%w: %s is reserved", ErrInvalidName, name)
+	}
+	for _, prefix := range reservedPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return fmt.Errorf("%w: %s uses the reserved prefix %s", ErrInvalidName, name, prefix)
+		}
+	}
+	return nil
+}
+
+// Load fetches and decrypts the user's secrets from their secrets:{user}:{name}
+// hashes (field "value"). Names are validated first; errors name the secret
+// but never include a value.
+func Load(ctx context.Context, rdb redis.UniversalClient, decryptor Decryptor, userID string, names []string) (map[string]string, error) {
+	for _, name := range names {
+		if err := ValidateName(name); err != nil {
+			return nil, err
+		}
+	}
+
+	values := make(map[string]string, len(names))
+	for _, name := range names {
+		encrypted, err := rdb.HGet(ctx, rediskeys.SecretKey(userID, name), "value").Result()
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch secret %s: %w", name, err)
+		}
+		value, err := decryptor.Decrypt(encrypted)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt secret %s: %w", name, err)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// Env returns the secrets as sorted NAME=value entries for a process environment
+func Env(values map[string]string) []string {
+	env := make([]string, 0, len(values))
+	for name, value := range values {
+		env = append(env, name+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// Values returns the secret values, for masking them in output
+func Values(values map[string]string) []string {
+	list := make([]string, 0, len(values))
+	for _, value := range values {
+		list = append(list, value)
+	}
+	return list
+}
@@ -0,0 +1,119 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	rediskeys "github.com/repobox/runner/internal/redis"
+)
+
+// prefixDecryptor "decrypts" values stored as "enc:<plaintext>"
+type prefixDecryptor struct{}
+
+func (prefixDecryptor) Decrypt(encrypted string) (string, error) {
+	plain, ok := strings.CutPrefix(encrypted, "enc:")
+	if !ok {
+		return "", errors.New("invalid encrypted data")
+	}
+	return plain, nil
+}
+
+func TestValidateName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"NPM_TOKEN", false},
+		{"PIP_INDEX_URL", false},
+		{"A1", false},
+		{"npm_token", true},
+		{"1TOKEN", true},
+		{"NPM-TOKEN", true},
+		{"TOKEN=x", true},
+		{"", true},
+		{strings.Repeat("A", 65), true},
+		{"PATH", true},
+		{"ANTHROPIC_API_KEY", true},
+		{"REPOBOX_JOB_ID", true},
+		{"LD_PRELOAD", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateName(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidName) {
+				t.Errorf("ValidateName(%q) error = %v, want ErrInvalidName", tt.name, err)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	ctx := context.Background()
+
+	rdb.HSet(ctx, rediskeys.SecretKey("user-1", "NPM_TOKEN"), "value", "enc:npm_abc123")
+	rdb.HSet(ctx, rediskeys.SecretKey("user-1", "PIP_INDEX_URL"), "value", "enc:https://u:p@pypi.example.com/simple")
+	rdb.HSet(ctx, rediskeys.SecretKey("user-1", "BROKEN"), "value", "plaintext")
+	rdb.HSet(ctx, rediskeys.SecretKey("user-2", "OTHER_TOKEN"), "value", "enc:other")
+
+	tests := []struct {
+		name    string
+		names   []string
+		want    map[string]string
+		wantErr error
+	}{
+		{"none", nil, map[string]string{}, nil},
+		{
+			name:  "found",
+			names: []string{"NPM_TOKEN", "PIP_INDEX_URL"},
+			want:  map[string]string{"NPM_TOKEN": "npm_abc123", "PIP_INDEX_URL": "https://u:p@pypi.example.com/simple"},
+		},
+		{"missing", []string{"NPM_TOKEN", "GH_TOKEN"}, nil, ErrNotFound},
+		{"other user's secret", []string{"OTHER_TOKEN"}, nil, ErrNotFound},
+		{"invalid name", []string{"NPM_TOKEN", "ld_preload"}, nil, ErrInvalidName},
+		{"undecryptable", []string{"BROKEN"}, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Load(ctx, rdb, prefixDecryptor{}, "user-1", tt.names)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("Load() = %v, want an error", got)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("Load() error = %v, want %v", err, tt.wantErr)
+				}
+				if strings.Contains(err.Error(), "plaintext") {
+					t.Errorf("Load() error = %q exposes the stored value", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Load() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnv(t *testing.T) {
+	got := Env(map[string]string{"PIP_INDEX_URL": "https://pypi.example.com", "NPM_TOKEN": "npm_abc"})
+	want := []string{"NPM_TOKEN=npm_abc", "PIP_INDEX_URL=https://pypi.example.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Env() = %q, want %q", got, want)
+	}
+}
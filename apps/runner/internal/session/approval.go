@@ -0,0 +1,123 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/git"
+	"github.com/repobox/runner/internal/job"
+	rediskeys "github.com/repobox/runner/internal/redis"
+)
+
+// Push stream actions answering a push held for approval
+const (
+	ActionApprove = "approve"
+	ActionReject  = "reject"
+)
+
+// requestApproval parks a committed session in awaiting_approval until a push
+// message with action=approve arrives or APPROVAL_TIMEOUT passes
+func (e *PushExecutor) requestApproval(ctx context.Context, session *Session, g *git.Git, repoPath string, msg *PushMessage) error {
+	diff, err := g.GetDiffSummary(ctx, repoPath, "origin/"+targetBranch(session, msg))
+	if err != nil {
+		e.logger.Warn("failed to get diff summary", "session_id", session.ID, "error", err)
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(e.cfg.ApprovalTimeout).UnixMilli()
+
+	if err := e.updateSessionStatus(ctx, session.ID, StatusAwaitingApproval, map[string]interface{}{
+		"approval_requested_at": now.UnixMilli(),
+		"approval_expires_at":   expiresAt,
+		"approval_title":        msg.Title,
+		"approval_description":  msg.Description,
+		"approval_target":       msg.TargetBranch,
+		"files_changed":         diff.FilesChanged,
+		"files_added":           diff.FilesAdded,
+		"files_deleted":         diff.FilesDeleted,
+		"files_renamed":         diff.FilesRenamed,
+		"lines_added":           diff.LinesAdded,
+		"lines_removed":         diff.LinesRemoved,
+		"error_message":         "",
+		"error_code":            "",
+	}); err != nil {
+		return fmt.Errorf("failed to update session status: %w", err)
+	}
+	if err := e.rdb.ZAdd(ctx, rediskeys.WorkSessionsAwaitingApprovalKey(), redis.Z{Score: float64(expiresAt), Member: session.ID}).Err(); err != nil {
+		e.logger.Warn("failed to schedule approval timeout", "session_id", session.ID, "error", err)
+	}
+
+	e.appendOutput(ctx, session.ID, "stdout", "runner", fmt.Sprintf(
+		"Waiting for approval before push: %d files changed (%d added, %d deleted, %d renamed), +%d/-%d lines",
+		diff.FilesChanged, diff.FilesAdded, diff.FilesDeleted, diff.FilesRenamed, diff.LinesAdded, diff.LinesRemoved,
+	))
+	e.logger.Info("push awaiting approval", "session_id", session.ID, "expires_at", expiresAt)
+	return nil
+}
+
+// approvalPending reports whether an approve message may go ahead with the push.
+// An approval that arrives after the deadline cancels the push instead.
+func (e *PushExecutor) approvalPending(ctx context.Context, session *Session) bool {
+	if session.Status != StatusAwaitingApproval {
+		e.appendOutput(ctx, session.ID, "stdout", "runner", "No push is awaiting approval for this session.")
+		return false
+	}
+	if session.ApprovalExpiresAt > 0 && time.Now().UnixMilli() > session.ApprovalExpiresAt {
+		e.cancelApproval(ctx, session.ID, job.Wrap(job.ErrCodeApprovalTimeout, fmt.Errorf("push approval timed out")))
+		return false
+	}
+	return true
+}
+
+// cancelApproval drops a pending approval and returns the session to ready.
+// The commits stay in the workdir, so a new push request starts over.
+func (e *PushExecutor) cancelApproval(ctx context.Context, sessionID string, reason error) {
+	e.rdb.ZRem(ctx, rediskeys.WorkSessionsAwaitingApprovalKey(), sessionID)
+	e.appendOutput(ctx, sessionID, "stderr", "runner", fmt.Sprintf("Push cancelled: %s", reason))
+
+	if err := e.updateSessionStatus(ctx, sessionID, StatusReady, map[string]interface{}{
+		"error_message": reason.Error(),
+		"error_code":    string(job.CodeOf(reason)),
+	}); err != nil {
+		e.logger.Warn("failed to update session status", "session_id", sessionID, "error", err)
+	}
+}
+
+// ExpireApprovals cancels pushes whose approval deadline has passed
+func (e *PushExecutor) ExpireApprovals(ctx context.Context) error {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	sessionIDs, err := e.rdb.ZRangeByScore(ctx, rediskeys.WorkSessionsAwaitingApprovalKey(), &redis.ZRangeBy{Min: "-inf", Max: now}).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, sessionID := range sessionIDs {
+		e.expireApproval(ctx, sessionID)
+	}
+	return nil
+}
+
+// expireApproval cancels one expired approval, unless a push for the session is in progress
+func (e *PushExecutor) expireApproval(ctx context.Context, sessionID string) {
+	lockToken, acquired, err := e.acquirePushLock(ctx, sessionID)
+	if err != nil || !acquired {
+		return // Retried on the next tick
+	}
+	defer e.releasePushLock(sessionID, lockToken)
+
+	// Several runners expire approvals - only the one that removes the entry handles it
+	if removed, err := e.rdb.ZRem(ctx, rediskeys.WorkSessionsAwaitingApprovalKey(), sessionID).Result(); err != nil || removed == 0 {
+		return
+	}
+
+	status, err := e.rdb.HGet(ctx, rediskeys.WorkSessionKey(sessionID), "status").Result()
+	if err != nil || Status(status) != StatusAwaitingApproval {
+		return
+	}
+
+	e.logger.Info("push approval timed out", "session_id", sessionID)
+	e.cancelApproval(ctx, sessionID, job.Wrap(job.ErrCodeApprovalTimeout, fmt.Errorf("push approval timed out")))
+}
@@ -0,0 +1,121 @@
+package session
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/job"
+	rediskeys "github.com/repobox/runner/internal/redis"
+)
+
+func TestExecute_ApprovalAnswers(t *testing.T) {
+	future := time.Now().Add(time.Hour).UnixMilli()
+	past := time.Now().Add(-time.Minute).UnixMilli()
+
+	tests := []struct {
+		name       string
+		status     Status
+		expiresAt  int64
+		action     string
+		wantStatus Status
+		wantCode   job.ErrorCode
+		wantLine   string
+	}{
+		{
+			name:       "reject pending approval",
+			status:     StatusAwaitingApproval,
+			expiresAt:  future,
+			action:     ActionReject,
+			wantStatus: StatusReady,
+			wantCode:   job.ErrCodeApprovalRejected,
+			wantLine:   "Push cancelled: push rejected",
+		},
+		{
+			name:       "approve after deadline",
+			status:     StatusAwaitingApproval,
+			expiresAt:  past,
+			action:     ActionApprove,
+			wantStatus: StatusReady,
+			wantCode:   job.ErrCodeApprovalTimeout,
+			wantLine:   "Push cancelled: push approval timed out",
+		},
+		{
+			name:       "approve without pending approval",
+			status:     StatusReady,
+			action:     ActionApprove,
+			wantStatus: StatusReady,
+			wantLine:   "No push is awaiting approval",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, rdb := newTestPushExecutor(t)
+			ctx := context.Background()
+			rdb.HSet(ctx, rediskeys.WorkSessionKey("s1"), map[string]interface{}{
+				"id":                  "s1",
+				"status":              string(tt.status),
+				"approval_expires_at": tt.expiresAt,
+			})
+			rdb.ZAdd(ctx, rediskeys.WorkSessionsAwaitingApprovalKey(), redis.Z{Score: float64(tt.expiresAt), Member: "s1"})
+
+			if err := e.Execute(ctx, &PushMessage{SessionID: "s1", UserID: "u1", Action: tt.action}); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+
+			data := rdb.HGetAll(ctx, rediskeys.WorkSessionKey("s1")).Val()
+			if Status(data["status"]) != tt.wantStatus {
+				t.Errorf("status = %q, want %q", data["status"], tt.wantStatus)
+			}
+			if job.ErrorCode(data["error_code"]) != tt.wantCode {
+				t.Errorf("error_code = %q, want %q", data["error_code"], tt.wantCode)
+			}
+			if tt.wantCode != "" {
+				if n := rdb.ZCard(ctx, rediskeys.WorkSessionsAwaitingApprovalKey()).Val(); n != 0 {
+					t.Errorf("%d approvals still scheduled after cancel, want 0", n)
+				}
+			}
+
+			lines := sessionOutput(t, rdb, "s1")
+			if len(lines) == 0 || !strings.Contains(lines[len(lines)-1], tt.wantLine) {
+				t.Errorf("output = %q, want last line containing %q", lines, tt.wantLine)
+			}
+		})
+	}
+}
+
+func TestExpireApprovals(t *testing.T) {
+	e, rdb := newTestPushExecutor(t)
+	ctx := context.Background()
+
+	expired := time.Now().Add(-time.Minute).UnixMilli()
+	pending := time.Now().Add(time.Hour).UnixMilli()
+	for id, expiresAt := range map[string]int64{"expired": expired, "pending": pending} {
+		rdb.HSet(ctx, rediskeys.WorkSessionKey(id), map[string]interface{}{
+			"status":              string(StatusAwaitingApproval),
+			"approval_expires_at": expiresAt,
+		})
+		rdb.ZAdd(ctx, rediskeys.WorkSessionsAwaitingApprovalKey(), redis.Z{Score: float64(expiresAt), Member: id})
+	}
+
+	if err := e.ExpireApprovals(ctx); err != nil {
+		t.Fatalf("ExpireApprovals() error = %v", err)
+	}
+
+	if got := rdb.HGet(ctx, rediskeys.WorkSessionKey("expired"), "status").Val(); Status(got) != StatusReady {
+		t.Errorf("expired session status = %q, want %q", got, StatusReady)
+	}
+	if got := rdb.HGet(ctx, rediskeys.WorkSessionKey("expired"), "error_code").Val(); job.ErrorCode(got) != job.ErrCodeApprovalTimeout {
+		t.Errorf("expired session error_code = %q, want %q", got, job.ErrCodeApprovalTimeout)
+	}
+	if got := rdb.HGet(ctx, rediskeys.WorkSessionKey("pending"), "status").Val(); Status(got) != StatusAwaitingApproval {
+		t.Errorf("pending session status = %q, want %q", got, StatusAwaitingApproval)
+	}
+	members := rdb.ZRange(ctx, rediskeys.WorkSessionsAwaitingApprovalKey(), 0, -1).Val()
+	if len(members) != 1 || members[0] != "pending" {
+		t.Errorf("scheduled approvals = %v, want [pending]", members)
+	}
+}
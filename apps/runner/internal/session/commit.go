@@ -0,0 +1,112 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/repobox/runner/internal/config"
+	"github.com/repobox/runner/internal/git"
+	"github.com/repobox/runner/internal/identity"
+	"github.com/repobox/runner/internal/job"
+	"github.com/repobox/runner/internal/repoconfig"
+)
+
+// Session commit granularity (SESSION_COMMIT_MODE)
+const (
+	// CommitPerPrompt commits each successful prompt's changes right away
+	CommitPerPrompt = "prompt"
+	// CommitOnPush leaves changes uncommitted until the session is pushed
+	CommitOnPush = "push"
+)
+
+// runnerLine writes a runner line to the session output
+type runnerLine func(stream, line string)
+
+// commitChanges commits the session's work, split into several commits when the
+// agent left a commit manifest. Falls back to a single commit otherwise.
+func commitChanges(ctx context.Context, g *git.Git, repoPath, message string, output runnerLine) error {
+	groups, err := git.ReadCommitManifest(repoPath)
+	if err != nil {
+		output("stderr", fmt.Sprintf("Ignoring commit manifest: %s", err))
+	}
+	if len(groups) == 0 {
+		return g.Commit(ctx, repoPath, message)
+	}
+
+	output("stdout", fmt.Sprintf("Splitting changes into %d commits from %s...", len(groups), git.CommitManifestFile))
+	if err := g.CommitGroups(ctx, repoPath, groups, message); err != nil {
+		output("stderr", fmt.Sprintf("Commit manifest failed, committing remaining changes together: %s", err))
+		return g.Commit(ctx, repoPath, message)
+	}
+	return nil
+}
+
+// commitFilter leaves the files COMMIT_MAX_FILE_MB and COMMIT_DENY_PATTERNS
+// exclude out of the session's commits, reporting each one in the output
+func commitFilter(cfg *config.Config, logger *slog.Logger, output runnerLine) *git.CommitFilter {
+	return git.NewCommitFilter(cfg.CommitMaxFileMB, cfg.CommitDenyPatterns, func(path, reason string) {
+		logger.Warn("file left out of commit", "path", path, "reason", reason)
+		output("stderr", fmt.Sprintf("Not committing %s (%s)", path, reason))
+	})
+}
+
+// promptCommitMessage picks the message of a prompt's commit: the one the
+// agent proposed in git.CommitMessageFile in agentDir, else the first line of
+// its result summary, else one based on the prompt
+func promptCommitMessage(agentDir, prompt, summary string, output runnerLine) string {
+	fileMsg, err := git.ReadCommitMessage(agentDir)
+	if err != nil {
+		output("stderr", fmt.Sprintf("Ignoring commit message file: %s", err))
+	}
+	if fileMsg != "" {
+		output("stdout", fmt.Sprintf("Using commit message from %s", git.CommitMessageFile))
+		return fileMsg
+	}
+	if subject, _, _ := strings.Cut(git.SanitizeCommitMessage(summary), "\n"); subject != "" {
+		return subject
+	}
+	return fmt.Sprintf("repobox: %s", truncateString(prompt, 50))
+}
+
+// checkProtectedPaths fails when the session changed a path protected by the
+// repository's settings file since commit base, in commits or uncommitted.
+// The settings are read as of base, so a commit can't lift them.
+func checkProtectedPaths(ctx context.Context, g *git.Git, repoPath, base string) error {
+	rev := base
+	if rev == "" {
+		rev = "HEAD"
+	}
+	repoCfg, err := repoconfig.LoadCommitted(ctx, g, repoPath, rev)
+	if err != nil {
+		return job.Wrap(job.ErrCodeRepoConfig, err)
+	}
+	if len(repoCfg.ProtectedPaths) == 0 {
+		return nil
+	}
+
+	changed, err := g.ChangedFilesSince(ctx, repoPath, base)
+	if err != nil {
+		return job.Wrap(job.ErrCodeProtected, fmt.Errorf("failed to check protected paths: %w", err))
+	}
+	if violations := repoCfg.ProtectedViolations(changed); len(violations) > 0 {
+		return job.Wrap(job.ErrCodeProtected, fmt.Errorf("session modified protected paths: %s", strings.Join(violations, ", ")))
+	}
+	return nil
+}
+
+// authorEmail returns the commit email for the session: the provider account's
+// verified email when enabled for the provider type, otherwise the configured
+// bot email. A session without a provider commits as the bot.
+func authorEmail(ctx context.Context, cfg *config.Config, client *identity.Client, provider *providerInfo, logger *slog.Logger, output runnerLine) string {
+	if provider == nil {
+		return cfg.GitAuthorEmail
+	}
+	email, err := client.AuthorEmail(ctx, cfg.GitEmailFromProvider, cfg.GitAuthorEmail, provider.Type, provider.URL, provider.Token)
+	if err != nil {
+		logger.Warn("failed to look up provider account email", "error", err)
+		output("stderr", fmt.Sprintf("Could not look up provider account email, committing as %s", email))
+	}
+	return email
+}
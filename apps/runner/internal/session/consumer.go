@@ -2,46 +2,100 @@ package session
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/activity"
 	"github.com/repobox/runner/internal/config"
 	rediskeys "github.com/repobox/runner/internal/redis"
 )
 
+// errInvalidMessage marks stream messages that can never be processed (missing fields)
+var errInvalidMessage = errors.New("invalid stream message")
+
+// messageHandler processes the fields of a stream message. ctx tells the
+// executors whether this is the message's last delivery (see retryLater).
+// A nil error ACKs the message; errors leave it pending for retry unless they
+// wrap errInvalidMessage or are failures already recorded (see recorded).
+type messageHandler func(ctx context.Context, fields map[string]string) error
+
+// claimInterval is how often each stream checks for abandoned messages
+const claimInterval = 30 * time.Second
+
 // Consumer handles consuming messages from work session streams
 type Consumer struct {
-	rdb          *redis.Client
+	rdb          redis.UniversalClient
 	cfg          *config.Config
 	runnerID     string
+	claimMinIdle time.Duration
+	readCount    int64 // Messages fetched per stream read
+	maxDelivery  int64 // Deliveries of a message before its failure is recorded
 	initExecutor *InitExecutor
 	jobExecutor  *JobExecutor
 	pushExecutor *PushExecutor
+	activity     *activity.Registry // Session tasks in flight, nil tracks nothing
 	logger       *slog.Logger
+
+	turns turnQueue // Runs each session's messages of a stream in order
+	users userSlots // Caps a user's concurrent session tasks (MAX_JOBS_PER_USER)
 }
 
 // NewConsumer creates a new session consumer
-func NewConsumer(rdb *redis.Client, cfg *config.Config, logger *slog.Logger) (*Consumer, error) {
+func NewConsumer(rdb redis.UniversalClient, cfg *config.Config, logger *slog.Logger) (*Consumer, error) {
 	initExec, err := NewInitExecutor(rdb, cfg, logger)
 	if err != nil {
 		return nil, err
 	}
 
+	jobExec, err := NewJobExecutor(rdb, cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
 	pushExec, err := NewPushExecutor(rdb, cfg, logger)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Consumer{
+	readCount := int64(cfg.StreamReadCount)
+	if readCount <= 0 {
+		readCount = 1
+	}
+
+	c := &Consumer{
 		rdb:          rdb,
 		cfg:          cfg,
 		runnerID:     cfg.RunnerID,
+		claimMinIdle: sessionClaimMinIdle(cfg),
+		readCount:    readCount,
+		maxDelivery:  int64(cfg.SessionMaxDeliveries),
 		initExecutor: initExec,
-		jobExecutor:  NewJobExecutor(rdb, cfg, logger),
+		jobExecutor:  jobExec,
 		pushExecutor: pushExec,
+		activity:     activity.NewRegistry(),
 		logger:       logger.With("component", "session-consumer"),
-	}, nil
+	}
+	c.users.limit = cfg.MaxJobsPerUser
+	return c, nil
+}
+
+// Activity returns the registry of the session tasks being processed
+func (c *Consumer) Activity() *activity.Registry {
+	return c.activity
+}
+
+// sessionClaimMinIdle returns how long a session message must be pending before
+// it is reclaimed. Session tasks stay pending while they run, so never reclaim
+// before a task could have legitimately finished.
+func sessionClaimMinIdle(cfg *config.Config) time.Duration {
+	if cfg.JobTimeout > cfg.ClaimMinIdle {
+		return cfg.JobTimeout
+	}
+	return cfg.ClaimMinIdle
 }
 
 // Start begins consuming from all work session streams
@@ -59,6 +113,7 @@ func (c *Consumer) Start(ctx context.Context) error {
 	go c.consumeInit(ctx)
 	go c.consumeJobs(ctx)
 	go c.consumePush(ctx)
+	go c.expireApprovals(ctx)
 
 	<-ctx.Done()
 	c.logger.Info("session consumer stopped")
@@ -71,9 +126,9 @@ func (c *Consumer) ensureConsumerGroups(ctx context.Context) error {
 		key   string
 		group string
 	}{
-		{rediskeys.WorkSessionsInitStream, rediskeys.WorkSessionsInitConsumerGroup},
-		{rediskeys.WorkSessionsJobsStream, rediskeys.WorkSessionsJobsConsumerGroup},
-		{rediskeys.WorkSessionsPushStream, rediskeys.WorkSessionsPushConsumerGroup},
+		{rediskeys.WorkSessionsInitStream(), rediskeys.WorkSessionsInitConsumerGroup},
+		{rediskeys.WorkSessionsJobsStream(), rediskeys.WorkSessionsJobsConsumerGroup},
+		{rediskeys.WorkSessionsPushStream(), rediskeys.WorkSessionsPushConsumerGroup},
 	}
 
 	for _, s := range streams {
@@ -88,7 +143,11 @@ func (c *Consumer) ensureConsumerGroups(ctx context.Context) error {
 
 // consumeInit consumes from the init stream
 func (c *Consumer) consumeInit(ctx context.Context) {
-	c.consumeStream(ctx, rediskeys.WorkSessionsInitStream, rediskeys.WorkSessionsInitConsumerGroup, func(fields map[string]string) {
+	c.consumeStream(ctx, rediskeys.WorkSessionsInitStream(), rediskeys.WorkSessionsInitConsumerGroup, c.cfg.SessionInitWorkers, func(ctx context.Context, fields map[string]string) error {
+		if err := requireFields(fields, "session_id", "user_id", "provider_id", "repo_url"); err != nil {
+			return err
+		}
+
 		msg := &InitMessage{
 			SessionID:  fields["session_id"],
 			UserID:     fields["user_id"],
@@ -98,52 +157,127 @@ func (c *Consumer) consumeInit(ctx context.Context) {
 			BaseBranch: fields["base_branch"],
 		}
 
+		ctx, done := c.activity.Start(ctx, activity.Entry{ID: msg.SessionID, Kind: "init", UserID: msg.UserID})
+		defer done()
 		if err := c.initExecutor.Execute(ctx, msg); err != nil {
 			c.logger.Error("init execution failed", "session_id", msg.SessionID, "error", err)
+			return err
 		}
+		return nil
 	})
 }
 
 // consumeJobs consumes from the jobs stream
 func (c *Consumer) consumeJobs(ctx context.Context) {
-	c.consumeStream(ctx, rediskeys.WorkSessionsJobsStream, rediskeys.WorkSessionsJobsConsumerGroup, func(fields map[string]string) {
+	c.consumeStream(ctx, rediskeys.WorkSessionsJobsStream(), rediskeys.WorkSessionsJobsConsumerGroup, c.cfg.SessionJobWorkers, func(ctx context.Context, fields map[string]string) error {
+		if err := requireFields(fields, "session_id", "job_id", "prompt"); err != nil {
+			return err
+		}
+
 		msg := &JobMessage{
 			SessionID:   fields["session_id"],
 			JobID:       fields["job_id"],
 			UserID:      fields["user_id"],
 			Prompt:      fields["prompt"],
 			Environment: fields["environment"],
+			Secrets:     config.ParseList(fields["secrets"]),
+			WorkSubdir:  fields["work_subdir"],
+			Amend:       fields["amend"] == "true",
+			UserName:    fields["user_name"],
+			UserEmail:   fields["user_email"],
 		}
 
+		ctx, done := c.activity.Start(ctx, activity.Entry{ID: msg.SessionID, Kind: "prompt", JobID: msg.JobID, UserID: msg.UserID})
+		defer done()
 		if err := c.jobExecutor.Execute(ctx, msg); err != nil {
 			c.logger.Error("job execution failed", "session_id", msg.SessionID, "job_id", msg.JobID, "error", err)
+			return err
 		}
+		return nil
 	})
 }
 
 // consumePush consumes from the push stream
 func (c *Consumer) consumePush(ctx context.Context) {
-	c.consumeStream(ctx, rediskeys.WorkSessionsPushStream, rediskeys.WorkSessionsPushConsumerGroup, func(fields map[string]string) {
+	c.consumeStream(ctx, rediskeys.WorkSessionsPushStream(), rediskeys.WorkSessionsPushConsumerGroup, c.cfg.SessionPushWorkers, func(ctx context.Context, fields map[string]string) error {
+		if err := requireFields(fields, "session_id", "user_id"); err != nil {
+			return err
+		}
+
 		msg := &PushMessage{
-			SessionID:   fields["session_id"],
-			UserID:      fields["user_id"],
-			Title:       fields["title"],
-			Description: fields["description"],
+			SessionID:    fields["session_id"],
+			UserID:       fields["user_id"],
+			Title:        fields["title"],
+			Description:  fields["description"],
+			Action:       fields["action"],
+			UserName:     fields["user_name"],
+			UserEmail:    fields["user_email"],
+			TargetBranch: fields["target_branch"],
 		}
 
+		ctx, done := c.activity.Start(ctx, activity.Entry{ID: msg.SessionID, Kind: "push", UserID: msg.UserID})
+		defer done()
 		if err := c.pushExecutor.Execute(ctx, msg); err != nil {
 			c.logger.Error("push execution failed", "session_id", msg.SessionID, "error", err)
+			return err
 		}
+		return nil
 	})
 }
 
-// consumeStream is a generic stream consumer
-func (c *Consumer) consumeStream(ctx context.Context, streamKey, groupName string, handler func(fields map[string]string)) {
+// expireApprovals periodically cancels pushes whose approval deadline has passed
+func (c *Consumer) expireApprovals(ctx context.Context) {
+	ticker := time.NewTicker(claimInterval)
+	defer ticker.Stop()
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		default:
+		case <-ticker.C:
+			if err := c.pushExecutor.ExpireApprovals(ctx); err != nil {
+				c.logger.Debug("failed to expire approvals", "error", err)
+			}
+		}
+	}
+}
+
+// requireFields returns an errInvalidMessage error if any of the fields is empty
+func requireFields(fields map[string]string, names ...string) error {
+	for _, name := range names {
+		if fields[name] == "" {
+			return fmt.Errorf("%w: missing %s", errInvalidMessage, name)
+		}
+	}
+	return nil
+}
+
+// consumeStream is a generic stream consumer. Up to workers batches are
+// handled at once (at least one); the stream is only read when a worker is
+// free, so messages aren't held back from other runners.
+func (c *Consumer) consumeStream(ctx context.Context, streamKey, groupName string, workers int, handler messageHandler) {
+	if workers < 1 {
+		workers = 1
+	}
+	slots := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// Recover messages abandoned by crashed runners before reading new ones
+	c.reclaimAndHandle(ctx, streamKey, groupName, handler)
+	lastClaim := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case slots <- struct{}{}:
+		}
+		free := func() { <-slots }
+
+		if time.Since(lastClaim) >= claimInterval {
+			c.reclaimAndHandle(ctx, streamKey, groupName, handler)
+			lastClaim = time.Now()
 		}
 
 		// Read from stream
@@ -151,11 +285,12 @@ func (c *Consumer) consumeStream(ctx context.Context, streamKey, groupName strin
 			Group:    groupName,
 			Consumer: c.runnerID,
 			Streams:  []string{streamKey, ">"},
-			Count:    1,
+			Count:    c.readCount,
 			Block:    5 * time.Second,
 		}).Result()
 
 		if err != nil {
+			free()
 			if err == redis.Nil {
 				continue // No new messages
 			}
@@ -164,24 +299,156 @@ func (c *Consumer) consumeStream(ctx context.Context, streamKey, groupName strin
 			continue
 		}
 
+		var msgs []redis.XMessage
 		for _, stream := range streams {
-			for _, msg := range stream.Messages {
-				// Convert values to string map
-				fields := make(map[string]string)
-				for k, v := range msg.Values {
-					if str, ok := v.(string); ok {
-						fields[k] = str
-					}
-				}
-
-				// Handle message
-				handler(fields)
-
-				// ACK message
-				if err := c.rdb.XAck(ctx, streamKey, groupName, msg.ID).Err(); err != nil {
-					c.logger.Warn("failed to ACK message", "stream", streamKey, "id", msg.ID, "error", err)
-				}
-			}
+			msgs = append(msgs, stream.Messages...)
+		}
+		// Queue the sessions' turns in read order before any worker starts
+		for _, msg := range msgs {
+			c.turns.add(turnKey(streamKey, msg), msg.ID)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer free()
+			c.handleBatch(ctx, streamKey, groupName, msgs, handler)
+		}()
+	}
+}
+
+// turnKey identifies the session a message belongs to within its stream
+func turnKey(streamKey string, msg redis.XMessage) string {
+	sessionID, _ := msg.Values["session_id"].(string)
+	return streamKey + "|" + sessionID
+}
+
+// handleBatch handles messages read together, in stream order. A batch's
+// handlers run one at a time, so a message waiting behind a long task can be
+// reclaimed by another runner meanwhile; handleMessage skips those.
+func (c *Consumer) handleBatch(ctx context.Context, streamKey, groupName string, msgs []redis.XMessage, handler messageHandler) {
+	for _, msg := range msgs {
+		c.handleMessage(ctx, streamKey, groupName, msg, handler)
+	}
+}
+
+// pendingDelivery reports whether a message is still pending for this runner
+// and how often it has been delivered. Lookup errors count as owned so the
+// message isn't dropped, and as its last delivery so a failure is recorded.
+func (c *Consumer) pendingDelivery(ctx context.Context, streamKey, groupName, id string) (owned bool, deliveries int64) {
+	pending, err := c.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: streamKey,
+		Group:  groupName,
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+	if err != nil {
+		c.logger.Debug("failed to check message owner", "stream", streamKey, "id", id, "error", err)
+		return true, c.maxDelivery
+	}
+	if len(pending) != 1 || pending[0].Consumer != c.runnerID {
+		return false, 0
+	}
+	return true, pending[0].RetryCount
+}
+
+// handleMessage converts a stream message, runs the handler and ACKs it. It
+// waits for earlier messages of the same session and for a free slot of the
+// user; on shutdown meanwhile the message stays pending. A message another
+// runner claimed during the wait is skipped, that runner handles it. Transient
+// failures stay pending until the message's SESSION_MAX_DELIVERIES delivery.
+func (c *Consumer) handleMessage(ctx context.Context, streamKey, groupName string, msg redis.XMessage, handler messageHandler) {
+	// Convert values to string map
+	fields := make(map[string]string)
+	for k, v := range msg.Values {
+		if str, ok := v.(string); ok {
+			fields[k] = str
+		}
+	}
+
+	key := turnKey(streamKey, msg)
+	if !c.turns.wait(ctx, key, msg.ID) {
+		return
+	}
+	defer c.turns.done(key, msg.ID)
+
+	release, ok := c.users.acquire(ctx, fields["user_id"])
+	if !ok {
+		return
+	}
+	defer release()
+
+	owned, deliveries := c.pendingDelivery(ctx, streamKey, groupName, msg.ID)
+	if !owned {
+		c.logger.Info("message taken over by another runner, skipping", "stream", streamKey, "id", msg.ID)
+		return
+	}
+
+	// Handle message - failed messages stay pending so they are retried via reclaim
+	if err := handler(withDelivery(ctx, deliveries >= c.maxDelivery), fields); err != nil {
+		switch {
+		case errors.Is(err, errInvalidMessage):
+			// Unprocessable messages would fail forever - ACK them to avoid a poison loop
+			c.logger.Error("dropping invalid message", "stream", streamKey, "id", msg.ID, "error", err)
+		case isRecorded(err):
+			// The failure is stored for the user, a redelivery would only run the task again
+			c.logger.Info("message failed, failure recorded", "stream", streamKey, "id", msg.ID)
+		default:
+			c.logger.Warn("message handling failed, leaving pending for retry", "stream", streamKey, "id", msg.ID, "delivery", deliveries, "error", err)
+			return
+		}
+	}
+
+	// ACK message
+	if err := c.rdb.XAck(ctx, streamKey, groupName, msg.ID).Err(); err != nil {
+		c.logger.Warn("failed to ACK message", "stream", streamKey, "id", msg.ID, "error", err)
+	}
+}
+
+// reclaimAndHandle claims abandoned messages on a stream and processes them
+func (c *Consumer) reclaimAndHandle(ctx context.Context, streamKey, groupName string, handler messageHandler) {
+	claimed, err := c.reclaimPending(ctx, streamKey, groupName)
+	if err != nil {
+		c.logger.Warn("failed to reclaim pending messages", "stream", streamKey, "error", err)
+	}
+
+	for _, msg := range claimed {
+		// A message waiting behind its session's earlier ones idles as long as
+		// they run; it is handled once its turn comes
+		if c.turns.queued(turnKey(streamKey, msg), msg.ID) {
+			c.logger.Debug("reclaimed message already queued, skipping", "stream", streamKey, "id", msg.ID)
+			continue
+		}
+		c.logger.Info("reclaimed pending message", "stream", streamKey, "id", msg.ID)
+		c.handleMessage(ctx, streamKey, groupName, msg, handler)
+	}
+}
+
+// reclaimPending transfers messages pending longer than claimMinIdle to this
+// runner using XAUTOCLAIM, so tasks left by a crashed runner are picked up
+func (c *Consumer) reclaimPending(ctx context.Context, streamKey, groupName string) ([]redis.XMessage, error) {
+	var claimed []redis.XMessage
+	start := "0-0"
+
+	for {
+		msgs, next, err := c.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   streamKey,
+			Group:    groupName,
+			Consumer: c.runnerID,
+			MinIdle:  c.claimMinIdle,
+			Start:    start,
+			Count:    100,
+		}).Result()
+		if err != nil {
+			return claimed, err
+		}
+
+		claimed = append(claimed, msgs...)
+
+		if next == "0-0" || next == "" || next == start {
+			return claimed, nil
 		}
+		start = next
 	}
 }
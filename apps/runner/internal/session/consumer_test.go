@@ -0,0 +1,491 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/config"
+	"github.com/repobox/runner/internal/job"
+	rediskeys "github.com/repobox/runner/internal/redis"
+)
+
+func newTestConsumer(t *testing.T) (*Consumer, *miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	cfg := &config.Config{RunnerID: "runner-new", ClaimMinIdle: 5 * time.Minute, JobTimeout: time.Hour}
+	c := &Consumer{
+		rdb:          rdb,
+		cfg:          cfg,
+		runnerID:     cfg.RunnerID,
+		claimMinIdle: sessionClaimMinIdle(cfg),
+		maxDelivery:  3,
+		logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	if err := c.ensureConsumerGroups(context.Background()); err != nil {
+		t.Fatalf("ensureConsumerGroups() error = %v", err)
+	}
+	return c, mr, rdb
+}
+
+// deliverTo adds a message to a stream and reads it as the given consumer without ACKing
+func deliverTo(t *testing.T, rdb *redis.Client, streamKey, groupName, consumer string, values map[string]interface{}) string {
+	t.Helper()
+	ctx := context.Background()
+	id, err := rdb.XAdd(ctx, &redis.XAddArgs{Stream: streamKey, Values: values}).Result()
+	if err != nil {
+		t.Fatalf("XAdd() error = %v", err)
+	}
+	if err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    groupName,
+		Consumer: consumer,
+		Streams:  []string{streamKey, ">"},
+		Count:    1,
+	}).Err(); err != nil {
+		t.Fatalf("XReadGroup() error = %v", err)
+	}
+	return id
+}
+
+func TestSessionClaimMinIdle(t *testing.T) {
+	tests := []struct {
+		name       string
+		claimIdle  time.Duration
+		jobTimeout time.Duration
+		want       time.Duration
+	}{
+		{"job timeout longer", 5 * time.Minute, time.Hour, time.Hour},
+		{"claim idle longer", 2 * time.Hour, time.Hour, 2 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{ClaimMinIdle: tt.claimIdle, JobTimeout: tt.jobTimeout}
+			if got := sessionClaimMinIdle(cfg); got != tt.want {
+				t.Errorf("sessionClaimMinIdle() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReclaimAndHandle(t *testing.T) {
+	c, mr, rdb := newTestConsumer(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	mr.SetTime(now)
+	deliverTo(t, rdb, rediskeys.WorkSessionsInitStream(), rediskeys.WorkSessionsInitConsumerGroup, "runner-dead",
+		map[string]interface{}{"session_id": "abandoned"})
+
+	mr.SetTime(now.Add(50 * time.Minute))
+	deliverTo(t, rdb, rediskeys.WorkSessionsInitStream(), rediskeys.WorkSessionsInitConsumerGroup, "runner-busy",
+		map[string]interface{}{"session_id": "in-progress"})
+
+	// abandoned message is idle past the job timeout, the other one is still running
+	mr.SetTime(now.Add(61 * time.Minute))
+
+	var handled []string
+	c.reclaimAndHandle(ctx, rediskeys.WorkSessionsInitStream(), rediskeys.WorkSessionsInitConsumerGroup, func(_ context.Context, fields map[string]string) error {
+		handled = append(handled, fields["session_id"])
+		return nil
+	})
+
+	if len(handled) != 1 || handled[0] != "abandoned" {
+		t.Fatalf("handled = %v, want [abandoned]", handled)
+	}
+
+	// Reclaimed message is ACKed, only the in-progress one stays pending
+	pending, err := rdb.XPending(ctx, rediskeys.WorkSessionsInitStream(), rediskeys.WorkSessionsInitConsumerGroup).Result()
+	if err != nil {
+		t.Fatalf("XPending() error = %v", err)
+	}
+	if pending.Count != 1 || pending.Consumers["runner-busy"] != 1 {
+		t.Errorf("pending = %+v, want 1 message owned by runner-busy", pending)
+	}
+}
+
+func TestReclaimAndHandle_SkipsQueued(t *testing.T) {
+	c, mr, rdb := newTestConsumer(t)
+	ctx := context.Background()
+	stream, group := rediskeys.WorkSessionsJobsStream(), rediskeys.WorkSessionsJobsConsumerGroup
+
+	now := time.Now()
+	mr.SetTime(now)
+	id := deliverTo(t, rdb, stream, group, c.runnerID, map[string]interface{}{"session_id": "s1"})
+
+	// The message waits behind an earlier prompt of its session past the claim idle time
+	key := stream + "|s1"
+	c.turns.add(key, "0-1")
+	c.turns.add(key, id)
+	mr.SetTime(now.Add(61 * time.Minute))
+
+	handled := 0
+	c.reclaimAndHandle(ctx, stream, group, func(_ context.Context, fields map[string]string) error {
+		handled++
+		return nil
+	})
+
+	if handled != 0 {
+		t.Errorf("handled %d reclaimed messages, want 0 while queued", handled)
+	}
+	if !c.turns.queued(key, id) {
+		t.Error("queued message was dropped from its session's queue")
+	}
+}
+
+func TestHandleMessage_TakenOverWhileWaiting(t *testing.T) {
+	c, _, rdb := newTestConsumer(t)
+	ctx := context.Background()
+	stream, group := rediskeys.WorkSessionsJobsStream(), rediskeys.WorkSessionsJobsConsumerGroup
+
+	id := deliverTo(t, rdb, stream, group, c.runnerID, map[string]interface{}{"session_id": "s1"})
+	key := stream + "|s1"
+	c.turns.add(key, "0-1")
+
+	handled := make(chan struct{}, 1)
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		c.handleMessage(ctx, stream, group, redis.XMessage{ID: id, Values: map[string]interface{}{"session_id": "s1"}},
+			func(_ context.Context, fields map[string]string) error {
+				handled <- struct{}{}
+				return nil
+			})
+	}()
+
+	// Another runner claims the message while it waits for its turn
+	if err := rdb.XClaim(ctx, &redis.XClaimArgs{Stream: stream, Group: group, Consumer: "runner-other", Messages: []string{id}}).Err(); err != nil {
+		t.Fatalf("XClaim() error = %v", err)
+	}
+	c.turns.done(key, "0-1")
+	<-finished
+
+	select {
+	case <-handled:
+		t.Error("handler ran for a message another runner claimed")
+	default:
+	}
+	pending, err := rdb.XPending(ctx, stream, group).Result()
+	if err != nil {
+		t.Fatalf("XPending() error = %v", err)
+	}
+	if pending.Count != 1 || pending.Consumers["runner-other"] != 1 {
+		t.Errorf("pending = %+v, want 1 message owned by runner-other", pending)
+	}
+	if c.turns.queued(key, id) {
+		t.Error("skipped message is still queued")
+	}
+}
+
+func TestReclaimPending_AllStreams(t *testing.T) {
+	c, mr, rdb := newTestConsumer(t)
+
+	streams := []struct {
+		key   string
+		group string
+	}{
+		{rediskeys.WorkSessionsInitStream(), rediskeys.WorkSessionsInitConsumerGroup},
+		{rediskeys.WorkSessionsJobsStream(), rediskeys.WorkSessionsJobsConsumerGroup},
+		{rediskeys.WorkSessionsPushStream(), rediskeys.WorkSessionsPushConsumerGroup},
+	}
+
+	now := time.Now()
+	mr.SetTime(now)
+	for _, s := range streams {
+		deliverTo(t, rdb, s.key, s.group, "runner-dead", map[string]interface{}{"session_id": "s1"})
+	}
+	mr.SetTime(now.Add(2 * time.Hour))
+
+	for _, s := range streams {
+		claimed, err := c.reclaimPending(context.Background(), s.key, s.group)
+		if err != nil {
+			t.Fatalf("reclaimPending(%s) error = %v", s.key, err)
+		}
+		if len(claimed) != 1 {
+			t.Errorf("reclaimPending(%s) claimed %d, want 1", s.key, len(claimed))
+		}
+	}
+}
+
+func TestHandleMessage_AckSemantics(t *testing.T) {
+	tests := []struct {
+		name        string
+		handlerErr  error
+		wantPending int64
+	}{
+		{"success is ACKed", nil, 0},
+		{"handler error stays pending", errors.New("clone failed"), 1},
+		{"invalid message is ACKed", fmt.Errorf("%w: missing session_id", errInvalidMessage), 0},
+		{"recorded failure is ACKed", recorded(errors.New("agent failed"), nil), 0},
+		{"unrecorded failure stays pending", recorded(errors.New("agent failed"), errors.New("redis down")), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _, rdb := newTestConsumer(t)
+			ctx := context.Background()
+
+			stream, group := rediskeys.WorkSessionsPushStream(), rediskeys.WorkSessionsPushConsumerGroup
+			id := deliverTo(t, rdb, stream, group, c.runnerID, map[string]interface{}{"session_id": "s1"})
+
+			c.handleMessage(ctx, stream, group, redis.XMessage{ID: id, Values: map[string]interface{}{"session_id": "s1"}},
+				func(_ context.Context, fields map[string]string) error { return tt.handlerErr })
+
+			pending, err := rdb.XPending(ctx, stream, group).Result()
+			if err != nil {
+				t.Fatalf("XPending() error = %v", err)
+			}
+			if pending.Count != tt.wantPending {
+				t.Errorf("pending count = %d, want %d", pending.Count, tt.wantPending)
+			}
+		})
+	}
+}
+
+func TestHandleMessage_RetriesTransientPushFailure(t *testing.T) {
+	c, mr, rdb := newTestConsumer(t)
+	c.maxDelivery = 2
+	ctx := context.Background()
+	e := &PushExecutor{rdb: rdb, cfg: c.cfg, seq: rediskeys.NewOutputSequencer(rdb), logger: c.logger}
+	stream, group := rediskeys.WorkSessionsPushStream(), rediskeys.WorkSessionsPushConsumerGroup
+
+	handled := 0
+	handler := func(ctx context.Context, fields map[string]string) error {
+		handled++
+		return e.failSession(ctx, fields["session_id"], job.Wrap(job.ErrCodePush, errors.New("connection reset")))
+	}
+
+	now := time.Now()
+	mr.SetTime(now)
+	id := deliverTo(t, rdb, stream, group, c.runnerID, map[string]interface{}{"session_id": "s1"})
+	c.handleMessage(ctx, stream, group, redis.XMessage{ID: id, Values: map[string]interface{}{"session_id": "s1"}}, handler)
+
+	// First delivery: the failure isn't recorded and the message stays pending
+	if status := rdb.HGet(ctx, rediskeys.WorkSessionKey("s1"), "status").Val(); status != "" {
+		t.Errorf("status after first delivery = %q, want unset", status)
+	}
+	if pending := rdb.XPending(ctx, stream, group).Val(); pending.Count != 1 {
+		t.Fatalf("pending after first delivery = %d, want 1", pending.Count)
+	}
+
+	// Redelivered once idle, the last delivery records the failure and ACKs
+	mr.SetTime(now.Add(61 * time.Minute))
+	c.reclaimAndHandle(ctx, stream, group, handler)
+
+	if handled != 2 {
+		t.Errorf("handled %d times, want 2", handled)
+	}
+	session := rdb.HGetAll(ctx, rediskeys.WorkSessionKey("s1")).Val()
+	if session["status"] != string(StatusReady) || session["error_code"] != string(job.ErrCodePush) {
+		t.Errorf("session = %v, want ready with error_code %s", session, job.ErrCodePush)
+	}
+	if pending := rdb.XPending(ctx, stream, group).Val(); pending.Count != 0 {
+		t.Errorf("pending after last delivery = %d, want 0", pending.Count)
+	}
+}
+
+func TestHandleBatch(t *testing.T) {
+	c, _, rdb := newTestConsumer(t)
+	ctx := context.Background()
+	stream, group := rediskeys.WorkSessionsJobsStream(), rediskeys.WorkSessionsJobsConsumerGroup
+
+	for _, sid := range []string{"s1", "s2", "s3", "s4"} {
+		if err := rdb.XAdd(ctx, &redis.XAddArgs{Stream: stream, Values: map[string]interface{}{"session_id": sid}}).Err(); err != nil {
+			t.Fatalf("XAdd() error = %v", err)
+		}
+	}
+	streams, err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: c.runnerID,
+		Streams:  []string{stream, ">"},
+		Count:    3,
+	}).Result()
+	if err != nil {
+		t.Fatalf("XReadGroup() error = %v", err)
+	}
+	msgs := streams[0].Messages
+	if len(msgs) != 3 {
+		t.Fatalf("read %d messages, want 3", len(msgs))
+	}
+
+	// Another runner reclaims s2 while s1 runs
+	var handled []string
+	handler := func(_ context.Context, fields map[string]string) error {
+		if fields["session_id"] == "s1" {
+			rdb.XClaim(ctx, &redis.XClaimArgs{Stream: stream, Group: group, Consumer: "runner-other", Messages: []string{msgs[1].ID}})
+		}
+		if fields["session_id"] == "s3" {
+			handled = append(handled, "s3")
+			return errors.New("clone failed")
+		}
+		handled = append(handled, fields["session_id"])
+		return nil
+	}
+	c.handleBatch(ctx, stream, group, msgs, handler)
+
+	if got := strings.Join(handled, ","); got != "s1,s3" {
+		t.Errorf("handled = %s, want s1,s3", got)
+	}
+
+	// s2 belongs to the other runner, failed s3 stays pending for retry
+	pending, err := rdb.XPendingExt(ctx, &redis.XPendingExtArgs{Stream: stream, Group: group, Start: "-", End: "+", Count: 10}).Result()
+	if err != nil {
+		t.Fatalf("XPendingExt() error = %v", err)
+	}
+	owners := make(map[string]string)
+	for _, p := range pending {
+		owners[p.ID] = p.Consumer
+	}
+	want := map[string]string{msgs[1].ID: "runner-other", msgs[2].ID: c.runnerID}
+	if len(owners) != len(want) || owners[msgs[1].ID] != want[msgs[1].ID] || owners[msgs[2].ID] != want[msgs[2].ID] {
+		t.Errorf("pending owners = %v, want %v", owners, want)
+	}
+}
+
+func TestRequireFields(t *testing.T) {
+	fields := map[string]string{"session_id": "s1", "user_id": ""}
+
+	if err := requireFields(fields, "session_id"); err != nil {
+		t.Errorf("requireFields() error = %v, want nil", err)
+	}
+
+	err := requireFields(fields, "session_id", "user_id")
+	if !errors.Is(err, errInvalidMessage) {
+		t.Fatalf("requireFields() error = %v, want errInvalidMessage", err)
+	}
+	if !strings.Contains(err.Error(), "user_id") {
+		t.Errorf("error should name the missing field: %v", err)
+	}
+}
+
+func TestConsumeStream_Workers(t *testing.T) {
+	stream, group := rediskeys.WorkSessionsInitStream(), rediskeys.WorkSessionsInitConsumerGroup
+
+	tests := []struct {
+		name        string
+		workers     int
+		userLimit   int
+		messages    []map[string]interface{}
+		wantRunning int      // Most handlers running at once
+		wantOrder   []string // Handling order of the "n" fields, when it is fixed
+	}{
+		{
+			name:        "one worker",
+			workers:     1,
+			messages:    []map[string]interface{}{{"session_id": "s1"}, {"session_id": "s2"}, {"session_id": "s3"}},
+			wantRunning: 1,
+		},
+		{
+			name:        "sessions in parallel",
+			workers:     3,
+			messages:    []map[string]interface{}{{"session_id": "s1"}, {"session_id": "s2"}, {"session_id": "s3"}},
+			wantRunning: 3,
+		},
+		{
+			name:    "one session in read order",
+			workers: 3,
+			messages: []map[string]interface{}{
+				{"session_id": "s1", "n": "1"}, {"session_id": "s1", "n": "2"}, {"session_id": "s1", "n": "3"},
+			},
+			wantRunning: 1,
+			wantOrder:   []string{"1", "2", "3"},
+		},
+		{
+			// u1's second task waits for its slot while u2's runs
+			name:      "user limit",
+			workers:   3,
+			userLimit: 1,
+			messages: []map[string]interface{}{
+				{"session_id": "s1", "user_id": "u1"}, {"session_id": "s2", "user_id": "u2"}, {"session_id": "s3", "user_id": "u1"},
+			},
+			wantRunning: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _, rdb := newTestConsumer(t)
+			c.readCount = 1
+			c.users.limit = tt.userLimit
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			for _, values := range tt.messages {
+				if err := rdb.XAdd(ctx, &redis.XAddArgs{Stream: stream, Values: values}).Err(); err != nil {
+					t.Fatalf("XAdd() error = %v", err)
+				}
+			}
+
+			var mu sync.Mutex
+			running, maxRunning := 0, 0
+			perUser := make(map[string]int)
+			var order []string
+			handled := make(chan struct{}, len(tt.messages))
+			handler := func(_ context.Context, fields map[string]string) error {
+				mu.Lock()
+				running++
+				maxRunning = max(maxRunning, running)
+				if perUser[fields["user_id"]]++; tt.userLimit > 0 && fields["user_id"] != "" && perUser[fields["user_id"]] > tt.userLimit {
+					t.Errorf("user %s runs %d tasks, limit %d", fields["user_id"], perUser[fields["user_id"]], tt.userLimit)
+				}
+				order = append(order, fields["n"])
+				mu.Unlock()
+
+				time.Sleep(100 * time.Millisecond)
+
+				mu.Lock()
+				running--
+				perUser[fields["user_id"]]--
+				mu.Unlock()
+				handled <- struct{}{}
+				return nil
+			}
+
+			// The blocking read only returns after cancel once it times out,
+			// so the consumer isn't waited for
+			go c.consumeStream(ctx, stream, group, tt.workers, handler)
+
+			for range tt.messages {
+				select {
+				case <-handled:
+				case <-time.After(5 * time.Second):
+					t.Fatal("timed out waiting for the handlers")
+				}
+			}
+
+			if maxRunning != tt.wantRunning {
+				t.Errorf("max running handlers = %d, want %d", maxRunning, tt.wantRunning)
+			}
+			if tt.wantOrder != nil && strings.Join(order, ",") != strings.Join(tt.wantOrder, ",") {
+				t.Errorf("order = %v, want %v", order, tt.wantOrder)
+			}
+
+			// Every message is ACKed once its handler returns
+			deadline := time.Now().Add(2 * time.Second)
+			for {
+				pending, err := rdb.XPending(ctx, stream, group).Result()
+				if err != nil {
+					t.Fatalf("XPending() error = %v", err)
+				}
+				if pending.Count == 0 {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("pending count = %d, want 0", pending.Count)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package session
+
+import (
+	"context"
+	"sync"
+)
+
+// turnQueue lets the messages of one session run only one at a time, in the
+// order they were read, while a stream's workers run other sessions' messages
+// in parallel. The zero value is ready to use.
+type turnQueue struct {
+	mu     sync.Mutex
+	queues map[string][]*turn
+}
+
+type turn struct {
+	id    string
+	ready chan struct{} // Closed when the turn reaches the head of its queue
+}
+
+// add queues message id for key unless it is queued already. The reader adds
+// a batch's messages before handing it to a worker, so read order is kept.
+func (q *turnQueue) add(key, id string) *turn {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, t := range q.queues[key] {
+		if t.id == id {
+			return t
+		}
+	}
+
+	if q.queues == nil {
+		q.queues = make(map[string][]*turn)
+	}
+	t := &turn{id: id, ready: make(chan struct{})}
+	if len(q.queues[key]) == 0 {
+		close(t.ready)
+	}
+	q.queues[key] = append(q.queues[key], t)
+	return t
+}
+
+// queued reports whether message id is queued for key, waiting or running
+func (q *turnQueue) queued(key, id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, t := range q.queues[key] {
+		if t.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// wait blocks until message id is the next of key to run. Returns false when
+// ctx ends first; the message is then dropped from the queue.
+func (q *turnQueue) wait(ctx context.Context, key, id string) bool {
+	t := q.add(key, id)
+	select {
+	case <-t.ready:
+		return true
+	case <-ctx.Done():
+		q.done(key, id)
+		return false
+	}
+}
+
+// done removes message id from key's queue, letting the next one run
+func (q *turnQueue) done(key, id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	queue := q.queues[key]
+	for i, t := range queue {
+		if t.id != id {
+			continue
+		}
+		queue = append(queue[:i:i], queue[i+1:]...)
+		if i == 0 && len(queue) > 0 {
+			close(queue[0].ready)
+		}
+		break
+	}
+	if len(queue) == 0 {
+		delete(q.queues, key)
+		return
+	}
+	q.queues[key] = queue
+}
+
+// userSlots caps how many session tasks of one user run at once on this
+// runner. A limit of 0 means no cap. The zero value has no cap.
+type userSlots struct {
+	mu      sync.Mutex
+	limit   int
+	running map[string]int
+	freed   chan struct{} // Closed and replaced whenever a slot is released
+}
+
+// acquire blocks until the user has a free slot and returns the func that
+// releases it. Returns false when ctx ends first.
+func (s *userSlots) acquire(ctx context.Context, userID string) (func(), bool) {
+	for {
+		s.mu.Lock()
+		if s.limit <= 0 || userID == "" {
+			s.mu.Unlock()
+			return func() {}, true
+		}
+		if s.running[userID] < s.limit {
+			if s.running == nil {
+				s.running = make(map[string]int)
+			}
+			s.running[userID]++
+			s.mu.Unlock()
+			return func() { s.release(userID) }, true
+		}
+		if s.freed == nil {
+			s.freed = make(chan struct{})
+		}
+		freed := s.freed
+		s.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+func (s *userSlots) release(userID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[userID]--; s.running[userID] <= 0 {
+		delete(s.running, userID)
+	}
+	if s.freed != nil {
+		close(s.freed)
+		s.freed = nil
+	}
+}
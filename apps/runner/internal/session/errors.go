@@ -0,0 +1,72 @@
+package session
+
+import (
+	"context"
+	"errors"
+
+	"github.com/repobox/runner/internal/job"
+	"github.com/repobox/runner/internal/mergerequest"
+)
+
+// mrErrorCode classifies a merge request failure, reporting token problems as auth failures
+func mrErrorCode(err error) job.ErrorCode {
+	if errors.Is(err, mergerequest.ErrAuth) {
+		return job.ErrCodeAuth
+	}
+	return job.ErrCodeMR
+}
+
+// transientCodes are failures a later delivery of the message may get past:
+// infrastructure and network trouble rather than a refusal or a bad request
+var transientCodes = map[job.ErrorCode]bool{
+	job.ErrCodeInternal: true,
+	job.ErrCodeWorkdir:  true,
+	job.ErrCodeProvider: true,
+	job.ErrCodeClone:    true,
+	job.ErrCodeBranch:   true,
+	job.ErrCodePush:     true,
+	job.ErrCodeMR:       true,
+}
+
+// deliveryKey is the context key of the message's delivery (see withDelivery)
+type deliveryKey struct{}
+
+// withDelivery records whether the message being handled is on its last
+// allowed delivery (SESSION_MAX_DELIVERIES)
+func withDelivery(ctx context.Context, last bool) context.Context {
+	return context.WithValue(ctx, deliveryKey{}, last)
+}
+
+// retryLater reports whether the failure err should be left unrecorded so
+// the consumer leaves the message pending for redelivery: its code is
+// transient and the message has deliveries left. Outside the consumer every
+// failure is recorded.
+func retryLater(ctx context.Context, err error) bool {
+	last, ok := ctx.Value(deliveryKey{}).(bool)
+	return ok && !last && transientCodes[job.CodeOf(err)]
+}
+
+// recordedError marks a failure already stored on the job or session. Running
+// the message again can't change the outcome, so the consumer ACKs it.
+type recordedError struct {
+	err error
+}
+
+func (e *recordedError) Error() string { return e.err.Error() }
+
+func (e *recordedError) Unwrap() error { return e.err }
+
+// recorded marks err as durably stored when storing it succeeded. A failure
+// that couldn't be stored stays unmarked, so the message is retried.
+func recorded(err, storeErr error) error {
+	if storeErr != nil {
+		return err
+	}
+	return &recordedError{err: err}
+}
+
+// isRecorded reports whether err is a failure already stored on the job or session
+func isRecorded(err error) bool {
+	var r *recordedError
+	return errors.As(err, &r)
+}
@@ -0,0 +1,29 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/repobox/runner/internal/job"
+	"github.com/repobox/runner/internal/mergerequest"
+)
+
+func TestMRErrorCode(t *testing.T) {
+	tests := []struct {
+		name string
+		got  job.ErrorCode
+		want job.ErrorCode
+	}{
+		{"mr failed", mrErrorCode(errors.New("422 branch already has a pull request")), job.ErrCodeMR},
+		{"mr auth", mrErrorCode(fmt.Errorf("%w: token missing api scope", mergerequest.ErrAuth)), job.ErrCodeAuth},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("code = %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+}
@@ -2,107 +2,197 @@ package session
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/activity"
+	"github.com/repobox/runner/internal/agent"
 	"github.com/repobox/runner/internal/config"
 	"github.com/repobox/runner/internal/crypto"
 	"github.com/repobox/runner/internal/git"
+	"github.com/repobox/runner/internal/job"
+	"github.com/repobox/runner/internal/joboutput"
+	"github.com/repobox/runner/internal/mergerequest"
+	"github.com/repobox/runner/internal/redact"
 	rediskeys "github.com/repobox/runner/internal/redis"
+	"github.com/repobox/runner/internal/telemetry"
+	"github.com/repobox/runner/internal/tokensource"
+	"github.com/repobox/runner/internal/topics"
+	"github.com/repobox/runner/internal/trace"
 	"github.com/repobox/runner/internal/util"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // InitExecutor handles work session initialization (clone repo, create branch)
 type InitExecutor struct {
-	rdb       *redis.Client
+	rdb       redis.UniversalClient
 	cfg       *config.Config
 	decryptor *crypto.Decryptor
+	tokens    tokensource.Source
+	seq       *rediskeys.OutputSequencer
+	redactor  *redact.Redactor
+	topics    *topics.Client
 	logger    *slog.Logger
 }
 
 // NewInitExecutor creates a new init executor
-func NewInitExecutor(rdb *redis.Client, cfg *config.Config, logger *slog.Logger) (*InitExecutor, error) {
+func NewInitExecutor(rdb redis.UniversalClient, cfg *config.Config, logger *slog.Logger) (*InitExecutor, error) {
 	decryptor, err := crypto.NewDecryptor(cfg.EncryptionKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create decryptor: %w", err)
 	}
 
+	tokens, err := tokensource.New(rdb, cfg, decryptor)
+	if err != nil {
+		return nil, err
+	}
+
+	redactor, err := redact.New(cfg.OutputRedactPatterns, cfg.OutputRedactDefaults)
+	if err != nil {
+		return nil, err
+	}
+
 	return &InitExecutor{
 		rdb:       rdb,
 		cfg:       cfg,
 		decryptor: decryptor,
+		tokens:    tokens,
+		seq:       rediskeys.NewBatchedOutputSequencer(rdb, cfg.OutputBatchSize, cfg.OutputBatchInterval),
+		redactor:  redactor,
+		topics:    topics.NewClient(),
 		logger:    logger.With("component", "session-init-executor"),
 	}, nil
 }
 
 // Execute initializes a work session (clone repo, create branch)
-func (e *InitExecutor) Execute(ctx context.Context, msg *InitMessage) error {
+func (e *InitExecutor) Execute(ctx context.Context, msg *InitMessage) (retErr error) {
+	// The enqueuer may have left out the display name
+	derivedName := msg.RepoName == ""
+	if derivedName {
+		msg.RepoName = git.RepoDisplayName(msg.RepoURL, e.cfg.RepoNameFullPath)
+	}
+
+	traceID := trace.NewID()
+	ctx = trace.WithID(ctx, traceID)
+	ctx, span := telemetry.Start(ctx, "session.init", attribute.String("session.id", msg.SessionID), attribute.String("repo", msg.RepoName))
+	defer func() { telemetry.End(span, retErr) }()
 	logger := e.logger.With(
 		"session_id", msg.SessionID,
 		"user_id", msg.UserID,
 		"repo", msg.RepoName,
+		"trace_id", traceID,
 	)
 
 	logger.Info("initializing work session")
+	defer e.seq.Forget(rediskeys.WorkSessionOutputKey(msg.SessionID))
 
 	// Create session workdir
 	workDir := e.getSessionWorkDir(msg.SessionID)
 	if err := os.MkdirAll(workDir, 0755); err != nil {
-		return e.failSession(ctx, msg.SessionID, fmt.Errorf("failed to create workdir: %w", err))
+		return e.failSession(ctx, msg.SessionID, job.Wrap(job.ErrCodeWorkdir, fmt.Errorf("failed to create workdir: %w", err)))
 	}
 
 	// Get provider info
-	provider, err := e.getProviderInfo(ctx, msg.UserID, msg.ProviderID)
+	provider, err := getProviderInfo(ctx, e.rdb, e.decryptor, e.tokens, msg.UserID, msg.ProviderID)
 	if err != nil {
-		return e.failSession(ctx, msg.SessionID, fmt.Errorf("failed to get provider: %w", err))
+		return e.failSession(ctx, msg.SessionID, job.Wrap(job.ErrCodeProvider, fmt.Errorf("failed to get provider: %w", err)))
 	}
 
-	// Check if repo already cloned (idempotency)
+	g := git.NewWithOptions(git.Options{
+		Token:       provider.Token,
+		TokenSource: provider.TokenSource,
+		AuthorName:  e.cfg.GitAuthorName,
+		AuthorEmail: e.cfg.GitAuthorEmail,
+		CacheDir:    e.cfg.CloneCacheDir,
+		Submodules:  e.cfg.CloneSubmodules,
+	})
+
+	// Resume an init interrupted after the clone (redelivered message, runner crash)
 	repoPath := filepath.Join(workDir, "repo")
-	gitDir := filepath.Join(repoPath, ".git")
-	if _, err := os.Stat(gitDir); err == nil {
+	if cloneComplete(ctx, g, repoPath) {
 		logger.Info("repository already cloned, skipping clone")
-		e.appendOutput(ctx, msg.SessionID, "stdout", "runner", "Repository already initialized.")
+		e.appendOutput(ctx, msg.SessionID, "stdout", agent.SourceRunner, "Repository already cloned, resuming initialization.")
+	} else {
+		// An interrupted clone leaves a directory git clone refuses to overwrite
+		if err := os.RemoveAll(repoPath); err != nil {
+			return e.failSession(ctx, msg.SessionID, job.Wrap(job.ErrCodeWorkdir, fmt.Errorf("failed to remove partial clone: %w", err)))
+		}
 
-		// Update session status to ready (in case previous run failed after clone)
-		if err := e.updateSessionStatus(ctx, msg.SessionID, StatusReady, nil); err != nil {
-			logger.Error("failed to update session status", "error", err)
+		// Fail fast when the repository is missing or the token can't reach it
+		if err := mergerequest.CheckRepo(ctx, mergerequest.ProviderType(provider.Type), provider.URL, provider.Token, msg.RepoURL); err != nil {
+			if code, ok := job.PreflightErrorCode(err); ok {
+				return e.failSession(ctx, msg.SessionID, job.Wrap(code, fmt.Errorf("repository check failed: %w", err)))
+			}
+			logger.Warn("repository preflight check failed, cloning anyway", "error", err)
 		}
-		return nil
-	}
 
-	e.appendOutput(ctx, msg.SessionID, "stdout", "runner", "Cloning repository...")
+		e.appendOutput(ctx, msg.SessionID, "stdout", agent.SourceRunner, "Cloning repository...")
 
-	// Clone repository
-	g := git.NewWithOptions(git.Options{
-		Token:       provider.Token,
-		AuthorName:  e.cfg.GitAuthorName,
-		AuthorEmail: e.cfg.GitAuthorEmail,
-	})
+		activity.SetPhase(ctx, activity.PhaseClone)
+		cloneCtx, cloneSpan := telemetry.Start(ctx, "git.clone")
+		err = g.Clone(cloneCtx, msg.RepoURL, repoPath)
+		telemetry.End(cloneSpan, err)
+		if err != nil {
+			return e.failSession(ctx, msg.SessionID, job.Wrap(job.GitErrorCode(job.ErrCodeClone, err), fmt.Errorf("clone failed: %w", err)))
+		}
 
-	if err := g.Clone(ctx, msg.RepoURL, repoPath); err != nil {
-		return e.failSession(ctx, msg.SessionID, fmt.Errorf("clone failed: %w", err))
+		e.appendOutput(ctx, msg.SessionID, "stdout", agent.SourceRunner, "Clone completed.")
 	}
 
-	e.appendOutput(ctx, msg.SessionID, "stdout", "runner", "Clone completed.")
-
-	// Create work branch
+	// Create work branch, unless the policy forbids changing it directly
 	branchName := fmt.Sprintf("repobox/%s", util.SafePrefix(msg.SessionID, 8))
-	e.appendOutput(ctx, msg.SessionID, "stdout", "runner", fmt.Sprintf("Creating branch %s...", branchName))
+	defaultBranch, err := job.DefaultBranch(ctx, g, repoPath, provider.Type, provider.URL, provider.Token, msg.RepoURL)
+	if err != nil {
+		logger.Warn("default branch unknown", "error", err)
+	}
+	if err := e.checkBranchPolicy(branchName, defaultBranch); err != nil {
+		return e.failSession(ctx, msg.SessionID, err)
+	}
+	if defaultBranch == "" {
+		defaultBranch = "main"
+	}
 
-	if err := g.CreateBranch(ctx, repoPath, branchName); err != nil {
-		return e.failSession(ctx, msg.SessionID, fmt.Errorf("create branch failed: %w", err))
+	baseBranch := msg.BaseBranch
+	if g.BranchExists(ctx, repoPath, branchName) {
+		e.appendOutput(ctx, msg.SessionID, "stdout", agent.SourceRunner, fmt.Sprintf("Branch %s already exists, checking it out...", branchName))
+		if err := g.Checkout(ctx, repoPath, branchName); err != nil {
+			return e.failSession(ctx, msg.SessionID, job.Wrap(job.ErrCodeBranch, fmt.Errorf("checkout branch failed: %w", err)))
+		}
+	} else {
+		// Branch off the requested base branch, else the clone's default HEAD
+		if baseBranch != "" {
+			if err := e.checkoutBaseBranch(ctx, g, repoPath, msg.SessionID, baseBranch); err != nil {
+				return e.failSession(ctx, msg.SessionID, err)
+			}
+		}
+		e.appendOutput(ctx, msg.SessionID, "stdout", agent.SourceRunner, fmt.Sprintf("Creating branch %s...", branchName))
+		if err := g.CreateBranch(ctx, repoPath, branchName); err != nil {
+			return e.failSession(ctx, msg.SessionID, job.Wrap(job.ErrCodeBranch, fmt.Errorf("create branch failed: %w", err)))
+		}
 	}
 
-	e.appendOutput(ctx, msg.SessionID, "stdout", "runner", "Work session ready. You can now submit prompts.")
+	e.appendOutput(ctx, msg.SessionID, "stdout", agent.SourceRunner, "Work session ready. You can now submit prompts.")
 
-	// Update session status to ready
-	if err := e.updateSessionStatus(ctx, msg.SessionID, StatusReady, nil); err != nil {
+	// Update session status to ready, with repo topics for environment auto-selection
+	fields := make(map[string]interface{})
+	if repoTopics := e.fetchTopics(ctx, msg, provider); len(repoTopics) > 0 {
+		fields["repo_topics"] = strings.Join(repoTopics, ",")
+	}
+	if derivedName && msg.RepoName != "" {
+		fields["repo_name"] = msg.RepoName
+	}
+	if baseBranch == "" {
+		baseBranch = defaultBranch
+	}
+	// The job and push executors diff and target against the stored branches
+	fields["base_branch"] = baseBranch
+	fields["work_branch"] = branchName
+	if err := e.updateSessionStatus(ctx, msg.SessionID, StatusReady, fields); err != nil {
 		logger.Error("failed to update session status", "error", err)
 	}
 
@@ -111,6 +201,57 @@ func (e *InitExecutor) Execute(ctx context.Context, msg *InitMessage) error {
 	return nil
 }
 
+// cloneComplete reports whether repoPath holds a finished clone. A clone
+// interrupted before it wrote HEAD has no commit to resolve.
+func cloneComplete(ctx context.Context, g *git.Git, repoPath string) bool {
+	if _, err := os.Stat(filepath.Join(repoPath, ".git")); err != nil {
+		return false
+	}
+	_, err := g.HeadCommit(ctx, repoPath)
+	return err == nil
+}
+
+// checkoutBaseBranch checks out the branch the work branch starts from,
+// creating it locally from origin's branch
+func (e *InitExecutor) checkoutBaseBranch(ctx context.Context, g *git.Git, repoPath, sessionID, branch string) error {
+	if strings.HasPrefix(branch, "-") || !g.RefExists(ctx, repoPath, "origin/"+branch) {
+		return job.Wrap(job.ErrCodeBranch, fmt.Errorf("base branch %s not found in the repository", branch))
+	}
+	e.appendOutput(ctx, sessionID, "stdout", agent.SourceRunner, fmt.Sprintf("Checking out base branch %s...", branch))
+	if err := g.Checkout(ctx, repoPath, branch); err != nil {
+		return job.Wrap(job.ErrCodeBranch, fmt.Errorf("checkout base branch failed: %w", err))
+	}
+	return nil
+}
+
+// checkBranchPolicy fails if the work branch may not be pushed to directly,
+// or if ForbidDefaultBranch is set and defaultBranch is unknown ("")
+func (e *InitExecutor) checkBranchPolicy(branch, defaultBranch string) error {
+	policy := git.BranchPolicy{ForbidDefault: e.cfg.ForbidDefaultBranch, Protected: e.cfg.ProtectedBranches}
+	return job.Wrap(job.ErrCodeBranchPolicy, policy.Check(branch, defaultBranch))
+}
+
+// fetchTopics loads the repository topics when a topic mapping is configured.
+// Failures only cost the auto-selection, so they are logged and ignored.
+func (e *InitExecutor) fetchTopics(ctx context.Context, msg *InitMessage, provider *providerInfo) []string {
+	if len(e.cfg.TopicEnvironments) == 0 {
+		return nil
+	}
+
+	projectID, err := mergerequest.ExtractProjectID(msg.RepoURL)
+	if err != nil {
+		e.logger.Warn("failed to extract project ID for topics", "session_id", msg.SessionID, "error", err)
+		return nil
+	}
+
+	repoTopics, err := e.topics.Fetch(ctx, provider.Type, provider.URL, provider.Token, projectID)
+	if err != nil {
+		e.logger.Warn("failed to fetch repository topics", "session_id", msg.SessionID, "error", err)
+		return nil
+	}
+	return repoTopics
+}
+
 // getSessionWorkDir returns the workdir path for a session
 func (e *InitExecutor) getSessionWorkDir(sessionID string) string {
 	return filepath.Join(e.cfg.TempDir, "sessions", sessionID)
@@ -118,16 +259,31 @@ func (e *InitExecutor) getSessionWorkDir(sessionID string) string {
 
 // providerInfo holds provider data
 type providerInfo struct {
-	Token string
-	Type  string
-	URL   string
+	Token       string
+	TokenSource git.TokenSource // Mints fresh tokens for GitHub App providers, nil otherwise
+	Type        string
+	URL         string
+}
+
+// currentToken returns a token that is valid now, refreshed from the token
+// source for GitHub App providers
+func (p *providerInfo) currentToken(ctx context.Context) (string, error) {
+	if p.TokenSource == nil {
+		return p.Token, nil
+	}
+	token, err := p.TokenSource.Token(ctx)
+	if err != nil {
+		return "", err
+	}
+	p.Token = token
+	return token, nil
 }
 
 // getProviderInfo fetches provider details including decrypted token
-func (e *InitExecutor) getProviderInfo(ctx context.Context, userID, providerID string) (*providerInfo, error) {
+func getProviderInfo(ctx context.Context, rdb redis.UniversalClient, decryptor *crypto.Decryptor, tokens tokensource.Source, userID, providerID string) (*providerInfo, error) {
 	key := rediskeys.GitProviderKey(userID, providerID)
 
-	data, err := e.rdb.HGetAll(ctx, key).Result()
+	data, err := rdb.HGetAll(ctx, key).Result()
 	if err != nil {
 		return nil, err
 	}
@@ -135,14 +291,26 @@ func (e *InitExecutor) getProviderInfo(ctx context.Context, userID, providerID s
 		return nil, fmt.Errorf("provider not found: %s", providerID)
 	}
 
-	encryptedToken, ok := data["token"]
-	if !ok {
-		return nil, fmt.Errorf("token not found for provider: %s", providerID)
+	if data["auth_type"] == mergerequest.AuthTypeGitHubApp {
+		source, err := mergerequest.GitHubAppFromProvider(data, decryptor.Decrypt)
+		if err != nil {
+			return nil, err
+		}
+		token, err := source.Token(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get GitHub App installation token: %w", err)
+		}
+		return &providerInfo{
+			Token:       token,
+			TokenSource: source,
+			Type:        data["type"],
+			URL:         data["url"],
+		}, nil
 	}
 
-	token, err := e.decryptor.Decrypt(encryptedToken)
+	token, err := tokens.Get(ctx, userID, providerID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt token: %w", err)
+		return nil, err
 	}
 
 	return &providerInfo{
@@ -165,30 +333,30 @@ func (e *InitExecutor) updateSessionStatus(ctx context.Context, sessionID string
 		updates[k] = v
 	}
 
-	return e.rdb.HSet(ctx, key, updates).Err()
+	return rediskeys.Retry(ctx, statusRetry(status), func(ctx context.Context) error {
+		// Batched output lines land before the status the UI reacts to
+		_ = e.seq.Flush(ctx, rediskeys.WorkSessionOutputKey(sessionID))
+		return e.rdb.HSet(ctx, key, updates).Err()
+	})
 }
 
 // failSession marks a session as failed
 func (e *InitExecutor) failSession(ctx context.Context, sessionID string, err error) error {
-	e.appendOutput(ctx, sessionID, "stderr", "runner", fmt.Sprintf("Error: %s", err.Error()))
+	e.appendOutput(ctx, sessionID, "stderr", agent.SourceRunner, fmt.Sprintf("Error: %s", err.Error()))
+	if retryLater(ctx, err) {
+		e.appendOutput(ctx, sessionID, "stderr", agent.SourceRunner, "Retrying later...")
+		return err
+	}
 
-	e.updateSessionStatus(ctx, sessionID, StatusFailed, map[string]interface{}{
+	storeErr := e.updateSessionStatus(ctx, sessionID, StatusFailed, map[string]interface{}{
 		"error_message": err.Error(),
+		"error_code":    string(job.CodeOf(err)),
 	})
 
-	return err
+	return recorded(err, storeErr)
 }
 
 // appendOutput adds output line to session output list
-func (e *InitExecutor) appendOutput(ctx context.Context, sessionID, stream, source, line string) {
-	key := rediskeys.WorkSessionOutputKey(sessionID)
-	output := map[string]interface{}{
-		"timestamp": time.Now().UnixMilli(),
-		"line":      line,
-		"stream":    stream,
-		"source":    source,
-	}
-	data, _ := json.Marshal(output)
-	e.rdb.RPush(ctx, key, string(data))
-	e.rdb.Expire(ctx, key, 7*24*time.Hour) // 7 days TTL
+func (e *InitExecutor) appendOutput(ctx context.Context, sessionID, stream string, source agent.OutputSource, line string) {
+	joboutput.NewWriter(e.rdb, e.seq, e.redactor, 7*24*time.Hour).Append(ctx, rediskeys.WorkSessionOutputKey(sessionID), stream, source, line, nil)
 }
@@ -0,0 +1,223 @@
+package session
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/config"
+	"github.com/repobox/runner/internal/job"
+	rediskeys "github.com/repobox/runner/internal/redis"
+)
+
+const testKeyHex = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+// encryptToken encrypts a token the way the web app stores it (iv:authTag:ciphertext)
+func encryptToken(t *testing.T, plaintext string) string {
+	t.Helper()
+	key, _ := hex.DecodeString(testKeyHex)
+
+	iv := make([]byte, 12)
+	if _, err := rand.Read(iv); err != nil {
+		t.Fatalf("rand.Read() error = %v", err)
+	}
+	block, _ := aes.NewCipher(key)
+	gcm, _ := cipher.NewGCMWithNonceSize(block, len(iv))
+	sealed := gcm.Seal(nil, iv, []byte(plaintext), nil)
+	tag, ciphertext := sealed[len(sealed)-16:], sealed[:len(sealed)-16]
+
+	return base64.StdEncoding.EncodeToString(iv) + ":" +
+		base64.StdEncoding.EncodeToString(tag) + ":" +
+		base64.StdEncoding.EncodeToString(ciphertext)
+}
+
+func TestInitExecutor_Resume(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	ctx := context.Background()
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %s", args, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+
+	origin := t.TempDir()
+	git("init", "-b", "main", origin)
+	if err := os.WriteFile(filepath.Join(origin, "README.md"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("-C", origin, "add", "-A")
+	git("-C", origin, "commit", "-m", "initial")
+
+	const branch = "repobox/s1"
+	tests := []struct {
+		name    string
+		prepare func(repoPath string)
+		marker  bool // a file committed on the work branch must survive
+	}{
+		{"no clone", func(string) {}, false},
+		{"interrupted clone", func(repoPath string) {
+			// .git without HEAD, as left by a crash mid-clone
+			if err := os.MkdirAll(filepath.Join(repoPath, ".git", "objects"), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}, false},
+		{"clone without branch", func(repoPath string) {
+			git("clone", origin, repoPath)
+		}, false},
+		{"clone and branch", func(repoPath string) {
+			git("clone", origin, repoPath)
+			git("-C", repoPath, "checkout", "-b", branch)
+			if err := os.WriteFile(filepath.Join(repoPath, "work.txt"), []byte("work\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			git("-C", repoPath, "add", "-A")
+			git("-C", repoPath, "commit", "-m", "work")
+			git("-C", repoPath, "checkout", "main")
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			t.Cleanup(func() { rdb.Close() })
+
+			cfg := &config.Config{TempDir: t.TempDir(), EncryptionKey: testKeyHex}
+			e, err := NewInitExecutor(rdb, cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("NewInitExecutor() error = %v", err)
+			}
+			rdb.HSet(ctx, rediskeys.GitProviderKey("user-1", "p1"), "token", encryptToken(t, ""), "type", "local")
+			rdb.HSet(ctx, rediskeys.WorkSessionKey("s1"), "id", "s1", "status", "initializing")
+
+			repoPath := filepath.Join(cfg.TempDir, "sessions", "s1", "repo")
+			tt.prepare(repoPath)
+
+			err = e.Execute(ctx, &InitMessage{SessionID: "s1", UserID: "user-1", ProviderID: "p1", RepoURL: origin})
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+
+			if status := rdb.HGet(ctx, rediskeys.WorkSessionKey("s1"), "status").Val(); status != string(StatusReady) {
+				t.Errorf("status = %q, want ready", status)
+			}
+			if got := git("-C", repoPath, "rev-parse", "--abbrev-ref", "HEAD"); got != branch {
+				t.Errorf("checked out %q, want %q", got, branch)
+			}
+			_, err = os.Stat(filepath.Join(repoPath, "work.txt"))
+			if tt.marker && err != nil {
+				t.Errorf("work on the existing branch was lost: %v", err)
+			}
+		})
+	}
+}
+
+func TestInitExecutor_BaseBranch(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	ctx := context.Background()
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %s", args, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+
+	// origin's default branch is main; develop has a file main doesn't
+	origin := t.TempDir()
+	git("init", "-b", "main", origin)
+	if err := os.WriteFile(filepath.Join(origin, "README.md"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("-C", origin, "add", "-A")
+	git("-C", origin, "commit", "-m", "initial")
+	git("-C", origin, "checkout", "-b", "develop")
+	if err := os.WriteFile(filepath.Join(origin, "develop.txt"), []byte("develop\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("-C", origin, "add", "-A")
+	git("-C", origin, "commit", "-m", "develop")
+	git("-C", origin, "checkout", "main")
+
+	tests := []struct {
+		name        string
+		baseBranch  string
+		wantBase    string
+		wantDevelop bool // the work branch contains develop's commit
+		wantCode    job.ErrorCode
+	}{
+		{"default branch when empty", "", "main", false, ""},
+		{"default branch by name", "main", "main", false, ""},
+		{"other branch", "develop", "develop", true, ""},
+		{"missing branch", "release", "", false, job.ErrCodeBranch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr := miniredis.RunT(t)
+			rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			t.Cleanup(func() { rdb.Close() })
+
+			cfg := &config.Config{TempDir: t.TempDir(), EncryptionKey: testKeyHex}
+			e, err := NewInitExecutor(rdb, cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if err != nil {
+				t.Fatalf("NewInitExecutor() error = %v", err)
+			}
+			rdb.HSet(ctx, rediskeys.GitProviderKey("user-1", "p1"), "token", encryptToken(t, ""), "type", "local")
+			rdb.HSet(ctx, rediskeys.WorkSessionKey("s1"), "id", "s1", "status", "initializing")
+
+			err = e.Execute(ctx, &InitMessage{SessionID: "s1", UserID: "user-1", ProviderID: "p1", RepoURL: origin, BaseBranch: tt.baseBranch})
+			session := rdb.HGetAll(ctx, rediskeys.WorkSessionKey("s1")).Val()
+			if tt.wantCode != "" {
+				if code := job.CodeOf(err); code != tt.wantCode {
+					t.Fatalf("Execute() error = %v, want code %s", err, tt.wantCode)
+				}
+				if session["status"] != string(StatusFailed) {
+					t.Errorf("status = %q, want failed", session["status"])
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+
+			if session["base_branch"] != tt.wantBase {
+				t.Errorf("base_branch = %q, want %q", session["base_branch"], tt.wantBase)
+			}
+			if session["work_branch"] != "repobox/s1" {
+				t.Errorf("work_branch = %q, want repobox/s1", session["work_branch"])
+			}
+
+			repoPath := filepath.Join(cfg.TempDir, "sessions", "s1", "repo")
+			if got := git("-C", repoPath, "rev-parse", "--abbrev-ref", "HEAD"); got != "repobox/s1" {
+				t.Errorf("checked out %q, want repobox/s1", got)
+			}
+			_, err = os.Stat(filepath.Join(repoPath, "develop.txt"))
+			if hasDevelop := err == nil; hasDevelop != tt.wantDevelop {
+				t.Errorf("work branch has develop.txt = %v, want %v", hasDevelop, tt.wantDevelop)
+			}
+		})
+	}
+}
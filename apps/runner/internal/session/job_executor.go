@@ -2,65 +2,162 @@ package session
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/activity"
 	"github.com/repobox/runner/internal/agent"
 	"github.com/repobox/runner/internal/config"
+	"github.com/repobox/runner/internal/crypto"
 	"github.com/repobox/runner/internal/git"
+	"github.com/repobox/runner/internal/identity"
 	"github.com/repobox/runner/internal/job"
+	"github.com/repobox/runner/internal/joboutput"
+	"github.com/repobox/runner/internal/redact"
 	rediskeys "github.com/repobox/runner/internal/redis"
+	"github.com/repobox/runner/internal/secrets"
+	"github.com/repobox/runner/internal/telemetry"
+	"github.com/repobox/runner/internal/tokensource"
+	"github.com/repobox/runner/internal/topics"
+	"github.com/repobox/runner/internal/trace"
+	"github.com/repobox/runner/internal/util"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // JobExecutor handles running prompts within a work session
 type JobExecutor struct {
-	rdb    *redis.Client
-	cfg    *config.Config
-	agent  agent.Agent
-	logger *slog.Logger
+	rdb          redis.UniversalClient
+	cfg          *config.Config
+	agent        agent.Agent
+	seq          *rediskeys.OutputSequencer
+	redactor     *redact.Redactor
+	decryptor    *crypto.Decryptor
+	tokens       tokensource.Source
+	identity     *identity.Client
+	logger       *slog.Logger
+	instructions agent.Instructions
+	cliArgs      agent.CLIArgs
 }
 
 // NewJobExecutor creates a new job executor
-func NewJobExecutor(rdb *redis.Client, cfg *config.Config, logger *slog.Logger) *JobExecutor {
+func NewJobExecutor(rdb redis.UniversalClient, cfg *config.Config, logger *slog.Logger) (*JobExecutor, error) {
+	redactor, err := redact.New(cfg.OutputRedactPatterns, cfg.OutputRedactDefaults)
+	if err != nil {
+		return nil, err
+	}
+
+	decryptor, err := crypto.NewDecryptor(cfg.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create decryptor: %w", err)
+	}
+
+	tokens, err := tokensource.New(rdb, cfg, decryptor)
+	if err != nil {
+		return nil, err
+	}
+
+	instructions, err := agent.LoadInstructions(cfg.AIInstructionsFile, cfg.AIInstructions)
+	if err != nil {
+		return nil, err
+	}
+
+	cliArgs, err := agent.LoadCLIArgs(cfg.AIExtraArgs, cfg.AIEnvArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	bashPolicy, err := agent.NewBashPolicy(cfg.BashCommandDeny, cfg.BashDenyDefaults, cfg.BashPolicyMode)
+	if err != nil {
+		return nil, err
+	}
+	egress, err := agent.NewEgressPolicy(cfg.AgentNetwork, cfg.AgentAPIHosts, cfg.AgentNetworkAllow)
+	if err != nil {
+		return nil, err
+	}
+
 	agentCfg := &agent.Config{
-		Enabled:        cfg.AIEnabled,
-		Provider:       cfg.AIProvider,
-		CLIPath:        cfg.AICLIPath,
-		APIKey:         cfg.AIAPIKey,
-		Timeout:        int(cfg.AITimeout.Seconds()),
-		MaxOutputLines: cfg.AIMaxOutputLines,
+		Enabled:           cfg.AIEnabled,
+		Provider:          cfg.AIProvider,
+		CLIPath:           cfg.AICLIPath,
+		APIKey:            cfg.AIAPIKey,
+		Timeout:           int(cfg.AITimeout.Seconds()),
+		IdleTimeout:       cfg.AIIdleTimeout,
+		MaxOutputLines:    cfg.AIMaxOutputLines,
+		OutputLogDir:      cfg.OutputLogDir,
+		OutputLogMaxBytes: int64(cfg.OutputLogMaxMB) << 20,
+		BinaryOutputMode:  cfg.AIBinaryOutput,
+		IncludeThinking:   cfg.AIThinking,
+		BashPolicy:        bashPolicy,
+		Egress:            egress,
 	}
 	aiAgent := agent.NewClaudeAgent(agentCfg, logger.With("component", "agent"))
 
 	return &JobExecutor{
-		rdb:    rdb,
-		cfg:    cfg,
-		agent:  aiAgent,
-		logger: logger.With("component", "session-job-executor"),
-	}
+		rdb:          rdb,
+		cfg:          cfg,
+		agent:        aiAgent,
+		seq:          rediskeys.NewBatchedOutputSequencer(rdb, cfg.OutputBatchSize, cfg.OutputBatchInterval),
+		redactor:     redactor,
+		decryptor:    decryptor,
+		tokens:       tokens,
+		identity:     identity.NewClient(),
+		logger:       logger.With("component", "session-job-executor"),
+		instructions: instructions,
+		cliArgs:      cliArgs,
+	}, nil
 }
 
 // Execute runs a prompt within an existing work session
-func (e *JobExecutor) Execute(ctx context.Context, msg *JobMessage) error {
+func (e *JobExecutor) Execute(ctx context.Context, msg *JobMessage) (retErr error) {
+	traceID := trace.NewID()
+	ctx = trace.WithID(ctx, traceID)
+	ctx, span := telemetry.Start(ctx, "session.prompt", attribute.String("session.id", msg.SessionID), attribute.String("job.id", msg.JobID))
+	defer func() { telemetry.End(span, retErr) }()
 	logger := e.logger.With(
 		"session_id", msg.SessionID,
 		"job_id", msg.JobID,
 		"user_id", msg.UserID,
+		"trace_id", traceID,
 	)
 
 	logger.Info("executing prompt in work session")
+	defer e.seq.Forget(rediskeys.WorkSessionOutputKey(msg.SessionID))
 
 	// Verify workdir exists
 	workDir := e.getSessionWorkDir(msg.SessionID)
 	repoPath := filepath.Join(workDir, "repo")
 
 	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
-		return e.failJob(ctx, msg, fmt.Errorf("session workdir not found"))
+		return e.failJob(ctx, msg, job.Wrap(job.ErrCodeWorkdir, fmt.Errorf("session workdir not found")))
+	}
+
+	// A push awaiting approval covers the session's current changes
+	if err := e.checkApprovalPending(ctx, msg.SessionID); err != nil {
+		return e.failJob(ctx, msg, job.Wrap(job.ErrCodeApprovalPending, err))
+	}
+
+	// A session at its prompt limit must be pushed before it grows any further
+	if err := e.checkJobLimit(ctx, msg.SessionID); err != nil {
+		return e.failJob(ctx, msg, job.Wrap(job.ErrCodeSessionLimit, err))
+	}
+
+	// Scope the agent to a subdirectory; git still works from the repository root
+	agentDir, err := git.ResolveSubdir(repoPath, msg.WorkSubdir)
+	if err != nil {
+		return e.failJob(ctx, msg, job.Wrap(job.ErrCodeWorkSubdir, err))
+	}
+
+	// An amending prompt needs an unpushed commit to fold its changes into
+	if msg.Amend {
+		if err := e.checkAmend(ctx, msg.SessionID, repoPath); err != nil {
+			return e.failJob(ctx, msg, job.Wrap(job.ErrCodeNothingToAmend, err))
+		}
 	}
 
 	// Update job status to running
@@ -70,30 +167,134 @@ func (e *JobExecutor) Execute(ctx context.Context, msg *JobMessage) error {
 		logger.Warn("failed to update job status", "error", err)
 	}
 
-	e.appendOutput(ctx, msg.SessionID, "stdout", "runner", fmt.Sprintf("Running prompt: %s", truncateString(msg.Prompt, 100)))
+	// Control characters would corrupt the output
+	msg.Prompt = agent.SanitizePrompt(msg.Prompt)
+	if err := agent.CheckPromptLength(msg.Prompt, e.cfg.MaxPromptLength); err != nil {
+		return e.failJob(ctx, msg, job.Wrap(job.ErrCodePromptTooLong, err))
+	}
+
+	// Secrets the prompt exposes to the agent's commands
+	secretValues, err := secrets.Load(ctx, e.rdb, e.decryptor, msg.UserID, msg.Secrets)
+	if err != nil {
+		return e.failJob(ctx, msg, job.Wrap(job.ErrCodeSecret, err))
+	}
+
+	// The session's provider, for its token and the commit email; nil without one
+	provider, err := e.sessionProvider(ctx, msg)
+	if err != nil {
+		return e.failJob(ctx, msg, job.Wrap(job.ErrCodeProvider, fmt.Errorf("failed to get provider: %w", err)))
+	}
+
+	e.appendPrompt(ctx, msg.SessionID, msg.Prompt)
+	e.appendOutput(ctx, msg.SessionID, "stdout", agent.SourceRunner, fmt.Sprintf("Running prompt: %s", truncateString(msg.Prompt, 100)))
+	if agentDir != repoPath {
+		e.appendOutput(ctx, msg.SessionID, "stdout", agent.SourceRunner, fmt.Sprintf("Running agent in %s", msg.WorkSubdir))
+	}
 
-	// Create output callback that streams to both session and job output
+	// Create output callback that streams to both session and job output,
+	// masking the provider token and secret values in addition to the
+	// patterns appendOutput redacts. Long lines are shortened after redaction
+	// so no secret is cut in half.
+	redactValues := secrets.Values(secretValues)
+	if provider != nil {
+		redactValues = append([]string{provider.Token}, redactValues...)
+	}
+	secretRedactor := e.redactor.WithValues(redactValues...)
 	outputCallback := func(stream string, source agent.OutputSource, line string) {
-		e.appendOutput(ctx, msg.SessionID, stream, string(source), line)
+		e.appendOutput(ctx, msg.SessionID, stream, source, util.TruncateMiddle(secretRedactor.Redact(line), e.cfg.AIMaxLineLength))
+	}
+
+	// Continue the conversation of the session's earlier prompts, so the
+	// agent keeps their context
+	var resumeID string
+	if e.cfg.AIResumeSession {
+		if session, err := e.getSession(ctx, msg.SessionID); err == nil && session.AgentSessionID != "" {
+			resumeID = session.AgentSessionID
+			e.appendOutput(ctx, msg.SessionID, "stdout", agent.SourceRunner, fmt.Sprintf("Resuming agent conversation %s", resumeID))
+		}
 	}
 
 	// Execute AI agent
+	environment := e.selectEnvironment(ctx, msg)
 	agentOpts := agent.ExecuteOptions{
-		WorkDir:     repoPath,
-		Prompt:      msg.Prompt,
-		Environment: msg.Environment,
-		JobID:       msg.JobID,
-		Output:      outputCallback,
+		WorkDir:         agentDir,
+		Prompt:          msg.Prompt,
+		SystemPrompt:    e.instructions.For(environment),
+		ExtraArgs:       e.cliArgs.For(environment),
+		Env:             secrets.Env(secretValues),
+		Environment:     environment,
+		JobID:           msg.JobID,
+		SessionID:       msg.SessionID,
+		RunnerID:        e.cfg.RunnerID,
+		TraceID:         traceID,
+		Output:          outputCallback,
+		ResumeSessionID: resumeID,
+		Redact:          secretRedactor.Redact,
+		OnSession: func(id string) {
+			// Stored right away so even a failed prompt's conversation is resumed
+			if err := e.rdb.HSet(ctx, rediskeys.WorkSessionKey(msg.SessionID), "agent_session_id", id).Err(); err != nil {
+				logger.Warn("failed to store agent session", "agent_session_id", id, "error", err)
+			}
+		},
+	}
+	if e.cfg.AIToolResults {
+		agentOpts.OnToolResult = func(stream, toolUseID, summary, content string) {
+			e.appendToolResult(ctx, msg.SessionID, stream, toolUseID, secretRedactor.Redact(summary), secretRedactor.Redact(content))
+		}
+	}
+	if agentOpts.SystemPrompt != "" {
+		e.appendOutput(ctx, msg.SessionID, "stdout", agent.SourceRunner, fmt.Sprintf("Adding system instructions for environment %s", environment))
+	}
+	if len(msg.Secrets) > 0 {
+		e.appendOutput(ctx, msg.SessionID, "stdout", agent.SourceRunner, fmt.Sprintf("Injecting secrets: %s", strings.Join(msg.Secrets, ", ")))
 	}
 
-	if err := e.agent.Execute(ctx, agentOpts); err != nil {
-		return e.failJob(ctx, msg, fmt.Errorf("agent execution failed: %w", err))
+	runnerOutput := func(stream, line string) {
+		e.appendOutput(ctx, msg.SessionID, stream, agent.SourceRunner, line)
+	}
+	gitOpts := git.Options{
+		AuthorName:  e.cfg.GitAuthorName,
+		AuthorEmail: e.cfg.GitAuthorEmail,
+		Filter:      commitFilter(e.cfg, logger, runnerOutput),
+	}
+	// Commits made by the prompt credit the same author and email as the push
+	if msg.Amend || e.cfg.SessionCommitMode == CommitPerPrompt {
+		gitOpts.AuthorEmail = authorEmail(ctx, e.cfg, e.identity, provider, logger, runnerOutput)
+		gitOpts.Author = identity.CommitAuthor(ctx, e.rdb, logger, msg.UserID, msg.UserName, msg.UserEmail)
+	}
+	g := git.NewWithOptions(gitOpts)
+	// The commit the prompt starts on, to measure what it committed
+	startCommit, _ := g.HeadCommit(ctx, repoPath)
+
+	activity.SetPhase(ctx, activity.PhaseAgent)
+	agentCtx, agentSpan := telemetry.Start(ctx, "agent.run", attribute.String("environment", environment))
+	agentResult, err := agent.ExecuteWithHeartbeat(agentCtx, e.agent, agentOpts, e.cfg.AIHeartbeat)
+	telemetry.End(agentSpan, err)
+	e.recordAgentUsage(ctx, msg.JobID, agentResult)
+	if err != nil {
+		return e.failJob(ctx, msg, job.Wrap(job.AgentErrorCode(err), fmt.Errorf("agent execution failed: %w", err)))
 	}
 
 	// Get diff stats for uncommitted changes
-	g := git.New()
 	linesAdded, linesRemoved, _ := g.GetUncommittedDiffStats(ctx, repoPath)
 
+	// The agent's final summary goes into the commit and the MR description
+	summary := agentResult.Summary
+	if err := e.commitPrompt(ctx, g, msg, repoPath, agentDir, startCommit, summary); err != nil {
+		return e.failJob(ctx, msg, err)
+	}
+
+	// Once committed, the prompt's changes are measured from its start commit,
+	// so new files and the agent's own commits count too
+	committed := startCommit != "" && (msg.Amend || e.cfg.SessionCommitMode == CommitPerPrompt)
+	if committed {
+		if added, removed, err := g.GetDiffStatsSince(ctx, repoPath, startCommit); err == nil {
+			linesAdded, linesRemoved = added, removed
+		} else {
+			logger.Warn("failed to get prompt diff stats", "error", err)
+		}
+	}
+
 	// Update job status to success
 	if err := e.updateJobStatus(ctx, msg.JobID, job.StatusSuccess, map[string]interface{}{
 		"finished_at":   time.Now().UnixMilli(),
@@ -113,18 +314,33 @@ func (e *JobExecutor) Execute(ctx context.Context, msg *JobMessage) error {
 		totalAdded += session.TotalLinesAdded
 		totalRemoved += session.TotalLinesRemoved
 	}
+	// An amending prompt refines the previous change instead of adding one
+	if msg.Amend {
+		jobCount--
+	}
+	// With everything committed the totals are the branch's diff against its
+	// base, which stays right after amends and changes undone by a later prompt
+	if committed && session != nil && session.BaseBranch != "" {
+		if added, removed, err := g.GetDiffStats(ctx, repoPath, session.BaseBranch); err == nil {
+			totalAdded, totalRemoved = added, removed
+		} else {
+			logger.Warn("failed to get session diff stats", "error", err)
+		}
+	}
 
 	if err := e.updateSessionStatus(ctx, msg.SessionID, StatusReady, map[string]interface{}{
 		"job_count":           jobCount,
 		"total_lines_added":   totalAdded,
 		"total_lines_removed": totalRemoved,
 		"error_message":       "", // Clear error on success
+		"error_code":          "",
 		"last_job_status":     string(job.StatusSuccess),
+		"agent_summary":       summary,
 	}); err != nil {
 		logger.Warn("failed to update session status", "error", err)
 	}
 
-	e.appendOutput(ctx, msg.SessionID, "stdout", "runner", "Prompt completed. Session ready for more prompts or push.")
+	e.appendOutput(ctx, msg.SessionID, "stdout", agent.SourceRunner, "Prompt completed. Session ready for more prompts or push.")
 
 	logger.Info("prompt executed successfully",
 		"lines_added", linesAdded,
@@ -134,6 +350,127 @@ func (e *JobExecutor) Execute(ctx context.Context, msg *JobMessage) error {
 	return nil
 }
 
+// recordAgentUsage stores the agent's reported usage on the prompt's job, also when it failed
+func (e *JobExecutor) recordAgentUsage(ctx context.Context, jobID string, res *agent.Result) {
+	fields := res.StatusFields()
+	if fields == nil {
+		return
+	}
+	if err := e.rdb.HSet(ctx, rediskeys.JobKey(jobID), fields).Err(); err != nil {
+		e.logger.Warn("failed to record agent usage", "job_id", jobID, "error", err)
+	}
+}
+
+// checkApprovalPending returns an error while a push of the session awaits
+// approval: the reviewed changes must not move under the approver
+func (e *JobExecutor) checkApprovalPending(ctx context.Context, sessionID string) error {
+	session, err := e.getSession(ctx, sessionID)
+	if err != nil {
+		// Not knowing the status mustn't block the prompt
+		return nil
+	}
+	if session.Status == StatusAwaitingApproval {
+		return fmt.Errorf("session push is awaiting approval; approve or reject it before sending more prompts")
+	}
+	return nil
+}
+
+// checkJobLimit returns an error when the session already ran SESSION_MAX_JOBS
+// prompts since its last push
+func (e *JobExecutor) checkJobLimit(ctx context.Context, sessionID string) error {
+	if e.cfg.SessionMaxJobs <= 0 {
+		return nil
+	}
+	session, err := e.getSession(ctx, sessionID)
+	if err != nil {
+		// Not knowing the count mustn't block the prompt
+		return nil
+	}
+	if session.JobCount-session.PushedJobCount >= e.cfg.SessionMaxJobs {
+		return fmt.Errorf("session prompt limit reached (%d prompts since the last push); please push or start a new session", e.cfg.SessionMaxJobs)
+	}
+	return nil
+}
+
+// commitPrompt commits the prompt's changes: into the last commit when the
+// message asks to amend, as a new commit with SESSION_COMMIT_MODE=prompt, or
+// not until the push otherwise. Protected paths changed since startCommit,
+// including by the agent's own commits, fail the prompt before it commits.
+// The agent's proposed commit message is read from agentDir, where it ran.
+func (e *JobExecutor) commitPrompt(ctx context.Context, g *git.Git, msg *JobMessage, repoPath, agentDir, startCommit, summary string) error {
+	if !msg.Amend && e.cfg.SessionCommitMode != CommitPerPrompt {
+		return nil
+	}
+	if err := checkProtectedPaths(ctx, g, repoPath, startCommit); err != nil {
+		return err
+	}
+
+	output := func(stream, line string) {
+		e.appendOutput(ctx, msg.SessionID, stream, agent.SourceRunner, line)
+	}
+
+	if msg.Amend {
+		// The amended commit keeps its message, so a proposed one is dropped
+		if err := os.Remove(filepath.Join(agentDir, git.CommitMessageFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			output("stderr", fmt.Sprintf("Failed to remove %s: %s", git.CommitMessageFile, err))
+		}
+		amended, err := g.Amend(ctx, repoPath)
+		if err != nil {
+			return job.Wrap(job.ErrCodeCommit, fmt.Errorf("amend failed: %w", err))
+		}
+		if amended {
+			output("stdout", "Changes amended into the last commit.")
+		}
+		return nil
+	}
+
+	before, _ := g.HeadCommit(ctx, repoPath)
+	message := promptCommitMessage(agentDir, msg.Prompt, summary, output)
+	activity.SetPhase(ctx, activity.PhaseCommit)
+	commitCtx, commitSpan := telemetry.Start(ctx, "git.commit")
+	err := commitChanges(commitCtx, g, repoPath, message, output)
+	telemetry.End(commitSpan, err)
+	if err != nil {
+		return job.Wrap(job.ErrCodeCommit, fmt.Errorf("commit failed: %w", err))
+	}
+	if after, _ := g.HeadCommit(ctx, repoPath); after != before {
+		output("stdout", "Changes committed.")
+	}
+	return nil
+}
+
+// checkAmend returns an error when the session has no unpushed commit to amend.
+// Pushed commits are never amended, that would need a force push.
+func (e *JobExecutor) checkAmend(ctx context.Context, sessionID, repoPath string) error {
+	session, err := e.getSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	g := git.New()
+	commits, err := g.CommitsSince(ctx, repoPath, unpushedBase(ctx, g, repoPath, session.WorkBranch, session.BaseBranch))
+	if err != nil {
+		return fmt.Errorf("failed to list session commits: %w", err)
+	}
+	if len(commits) == 0 {
+		return errors.New("nothing to amend: the session has no unpushed commit")
+	}
+	return nil
+}
+
+// sessionProvider fetches the provider the session was cloned with. Returns
+// nil when the session has none.
+func (e *JobExecutor) sessionProvider(ctx context.Context, msg *JobMessage) (*providerInfo, error) {
+	session, err := e.getSession(ctx, msg.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.ProviderID == "" {
+		return nil, nil
+	}
+	return getProviderInfo(ctx, e.rdb, e.decryptor, e.tokens, msg.UserID, session.ProviderID)
+}
+
 // getSessionWorkDir returns the workdir path for a session
 func (e *JobExecutor) getSessionWorkDir(sessionID string) string {
 	return filepath.Join(e.cfg.TempDir, "sessions", sessionID)
@@ -152,11 +489,15 @@ func (e *JobExecutor) getSession(ctx context.Context, sessionID string) (*Sessio
 
 	// Parse numeric fields
 	jobCount := 0
+	pushedJobCount := 0
 	linesAdded := 0
 	linesRemoved := 0
 	if jc, ok := data["job_count"]; ok {
 		fmt.Sscanf(jc, "%d", &jobCount)
 	}
+	if pc, ok := data["pushed_job_count"]; ok {
+		fmt.Sscanf(pc, "%d", &pushedJobCount)
+	}
 	if la, ok := data["total_lines_added"]; ok {
 		fmt.Sscanf(la, "%d", &linesAdded)
 	}
@@ -166,26 +507,61 @@ func (e *JobExecutor) getSession(ctx context.Context, sessionID string) (*Sessio
 
 	return &Session{
 		ID:                data["id"],
+		ProviderID:        data["provider_id"],
+		BaseBranch:        data["base_branch"],
+		WorkBranch:        data["work_branch"],
 		Status:            Status(data["status"]),
 		JobCount:          jobCount,
+		PushedJobCount:    pushedJobCount,
 		TotalLinesAdded:   linesAdded,
 		TotalLinesRemoved: linesRemoved,
+		RepoTopics:        splitTopics(data["repo_topics"]),
+		AgentSessionID:    data["agent_session_id"],
 	}, nil
 }
 
-// updateJobStatus updates job status in Redis
-func (e *JobExecutor) updateJobStatus(ctx context.Context, jobID string, status job.Status, fields map[string]interface{}) error {
-	key := rediskeys.JobKey(jobID)
+// splitTopics parses the comma-separated repo_topics session field
+func splitTopics(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
 
-	updates := map[string]interface{}{
-		"status": string(status),
+// selectEnvironment picks the environment from the topics stored at session init
+// when the prompt left the choice to the runner and a topic mapping is configured
+func (e *JobExecutor) selectEnvironment(ctx context.Context, msg *JobMessage) string {
+	if len(e.cfg.TopicEnvironments) == 0 || !topics.IsAutoEnvironment(msg.Environment) {
+		return msg.Environment
 	}
 
-	for k, v := range fields {
-		updates[k] = v
+	session, err := e.getSession(ctx, msg.SessionID)
+	if err != nil {
+		return msg.Environment
+	}
+
+	env := topics.SelectEnvironment(session.RepoTopics, e.cfg.TopicEnvironments)
+	if env == "" {
+		return msg.Environment
 	}
+	e.appendOutput(ctx, msg.SessionID, "stdout", agent.SourceRunner, fmt.Sprintf("Selected environment %s from repository topics", env))
+	return env
+}
 
-	return e.rdb.HSet(ctx, key, updates).Err()
+// updateJobStatus updates job status in Redis. A change the job's current
+// status doesn't allow is refused with job.ErrInvalidTransition.
+func (e *JobExecutor) updateJobStatus(ctx context.Context, jobID string, status job.Status, fields map[string]interface{}) error {
+	policy := rediskeys.StatusRetry
+	if status.IsTerminal() {
+		policy = rediskeys.TerminalRetry
+	}
+	err := rediskeys.Retry(ctx, policy, func(ctx context.Context) error {
+		return rediskeys.SetJobStatus(ctx, e.rdb, jobID, status, fields)
+	})
+	if errors.Is(err, job.ErrInvalidTransition) {
+		e.logger.Warn("refused job status change", "job_id", jobID, "error", err)
+	}
+	return err
 }
 
 // updateSessionStatus updates session status in Redis
@@ -201,40 +577,72 @@ func (e *JobExecutor) updateSessionStatus(ctx context.Context, sessionID string,
 		updates[k] = v
 	}
 
-	return e.rdb.HSet(ctx, key, updates).Err()
+	return rediskeys.Retry(ctx, statusRetry(status), func(ctx context.Context) error {
+		// Batched output lines land before the status the UI reacts to
+		_ = e.seq.Flush(ctx, rediskeys.WorkSessionOutputKey(sessionID))
+		return e.rdb.HSet(ctx, key, updates).Err()
+	})
 }
 
 // failJob marks a job as failed
 func (e *JobExecutor) failJob(ctx context.Context, msg *JobMessage, err error) error {
-	e.appendOutput(ctx, msg.SessionID, "stderr", "runner", fmt.Sprintf("Error: %s", err.Error()))
+	e.appendOutput(ctx, msg.SessionID, "stderr", agent.SourceRunner, fmt.Sprintf("Error: %s", err.Error()))
+	if retryLater(ctx, err) {
+		e.appendOutput(ctx, msg.SessionID, "stderr", agent.SourceRunner, "Retrying later...")
+		return err
+	}
 
-	// Mark job as failed
-	e.updateJobStatus(ctx, msg.JobID, job.StatusFailed, map[string]interface{}{
+	// Mark job as failed. A refused transition means the job already ended.
+	storeErr := e.updateJobStatus(ctx, msg.JobID, job.StatusFailed, map[string]interface{}{
 		"finished_at":   time.Now().UnixMilli(),
 		"error_message": err.Error(),
+		"error_code":    string(job.CodeOf(err)),
 	})
+	if errors.Is(storeErr, job.ErrInvalidTransition) {
+		storeErr = nil
+	}
 
-	// Session stays ready so user can try again, but store error info for UI
-	e.updateSessionStatus(ctx, msg.SessionID, StatusReady, map[string]interface{}{
+	// Session stays ready so user can try again, but store error info for UI.
+	// A prompt refused for a pending approval leaves the session waiting.
+	fields := map[string]interface{}{
 		"error_message":   err.Error(),
+		"error_code":      string(job.CodeOf(err)),
 		"last_job_status": string(job.StatusFailed),
-	})
+	}
+	if job.CodeOf(err) == job.ErrCodeApprovalPending {
+		key := rediskeys.WorkSessionKey(msg.SessionID)
+		rediskeys.Retry(ctx, rediskeys.TerminalRetry, func(ctx context.Context) error {
+			return e.rdb.HSet(ctx, key, fields).Err()
+		})
+	} else {
+		e.updateSessionStatus(ctx, msg.SessionID, StatusReady, fields)
+	}
 
-	return err
+	return recorded(err, storeErr)
 }
 
 // appendOutput adds output line to session output list
-func (e *JobExecutor) appendOutput(ctx context.Context, sessionID, stream, source, line string) {
-	key := rediskeys.WorkSessionOutputKey(sessionID)
-	output := map[string]interface{}{
-		"timestamp": time.Now().UnixMilli(),
-		"line":      line,
-		"stream":    stream,
-		"source":    source,
-	}
-	data, _ := json.Marshal(output)
-	e.rdb.RPush(ctx, key, string(data))
-	e.rdb.Expire(ctx, key, 7*24*time.Hour)
+func (e *JobExecutor) appendOutput(ctx context.Context, sessionID, stream string, source agent.OutputSource, line string) {
+	joboutput.NewWriter(e.rdb, e.seq, e.redactor, 7*24*time.Hour).Append(ctx, rediskeys.WorkSessionOutputKey(sessionID), stream, source, line, nil)
+}
+
+// appendToolResult stores the full content of a tool result, capped at
+// AI_TOOL_RESULT_MAX_LENGTH, and adds its summary line, capped at
+// AI_MAX_LINE_LENGTH, linked to it
+func (e *JobExecutor) appendToolResult(ctx context.Context, sessionID, stream, toolUseID, summary, content string) {
+	w := joboutput.NewWriter(e.rdb, e.seq, e.redactor, 7*24*time.Hour)
+	err := w.AppendToolResult(ctx, rediskeys.WorkSessionOutputKey(sessionID), rediskeys.WorkSessionToolResultsKey(sessionID), stream, toolUseID, util.TruncateMiddle(summary, e.cfg.AIMaxLineLength), content, e.cfg.AIToolResultMax)
+	if err != nil {
+		e.logger.Warn("failed to store tool result", "session_id", sessionID, "tool_use_id", toolUseID, "error", err)
+	}
+}
+
+// appendPrompt records the full prompt in the session output when enabled
+func (e *JobExecutor) appendPrompt(ctx context.Context, sessionID, prompt string) {
+	if !e.cfg.OutputIncludePrompt {
+		return
+	}
+	e.appendOutput(ctx, sessionID, "stdout", agent.SourcePrompt, prompt)
 }
 
 // truncateString truncates a string to max length
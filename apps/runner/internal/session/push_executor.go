@@ -2,58 +2,146 @@ package session
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/activity"
+	"github.com/repobox/runner/internal/agent"
 	"github.com/repobox/runner/internal/config"
 	"github.com/repobox/runner/internal/crypto"
 	"github.com/repobox/runner/internal/git"
+	"github.com/repobox/runner/internal/identity"
+	"github.com/repobox/runner/internal/job"
+	"github.com/repobox/runner/internal/joboutput"
 	"github.com/repobox/runner/internal/mergerequest"
+	"github.com/repobox/runner/internal/redact"
 	rediskeys "github.com/repobox/runner/internal/redis"
+	"github.com/repobox/runner/internal/telemetry"
+	"github.com/repobox/runner/internal/tokensource"
+	"github.com/repobox/runner/internal/trace"
 	"github.com/repobox/runner/internal/util"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // PushExecutor handles pushing work session branch and creating MR/PR
 type PushExecutor struct {
-	rdb       *redis.Client
-	cfg       *config.Config
-	decryptor *crypto.Decryptor
-	logger    *slog.Logger
+	rdb        redis.UniversalClient
+	cfg        *config.Config
+	decryptor  *crypto.Decryptor
+	tokens     tokensource.Source
+	mrTemplate *mergerequest.DescriptionTemplate
+	seq        *rediskeys.OutputSequencer
+	redactor   *redact.Redactor
+	identity   *identity.Client
+	logger     *slog.Logger
 }
 
 // NewPushExecutor creates a new push executor
-func NewPushExecutor(rdb *redis.Client, cfg *config.Config, logger *slog.Logger) (*PushExecutor, error) {
+func NewPushExecutor(rdb redis.UniversalClient, cfg *config.Config, logger *slog.Logger) (*PushExecutor, error) {
 	decryptor, err := crypto.NewDecryptor(cfg.EncryptionKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create decryptor: %w", err)
 	}
 
+	tokens, err := tokensource.New(rdb, cfg, decryptor)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load MR description template up front so a broken template fails at startup
+	mrTemplate, err := mergerequest.LoadDescriptionTemplate(cfg.MRTemplatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	redactor, err := redact.New(cfg.OutputRedactPatterns, cfg.OutputRedactDefaults)
+	if err != nil {
+		return nil, err
+	}
+
+	logger = logger.With("component", "session-push-executor")
+	if cfg.MRTemplatePath != "" && mrTemplate.IsDefault() {
+		logger.Warn("MR template not found, using built-in default", "path", cfg.MRTemplatePath)
+	}
+
 	return &PushExecutor{
-		rdb:       rdb,
-		cfg:       cfg,
-		decryptor: decryptor,
-		logger:    logger.With("component", "session-push-executor"),
+		rdb:        rdb,
+		cfg:        cfg,
+		decryptor:  decryptor,
+		tokens:     tokens,
+		mrTemplate: mrTemplate,
+		seq:        rediskeys.NewBatchedOutputSequencer(rdb, cfg.OutputBatchSize, cfg.OutputBatchInterval),
+		redactor:   redactor,
+		identity:   identity.NewClient(),
+		logger:     logger,
 	}, nil
 }
 
 // Execute pushes the work session branch and creates MR/PR
-func (e *PushExecutor) Execute(ctx context.Context, msg *PushMessage) error {
+func (e *PushExecutor) Execute(ctx context.Context, msg *PushMessage) (retErr error) {
+	traceID := trace.NewID()
+	ctx = trace.WithID(ctx, traceID)
+	ctx, span := telemetry.Start(ctx, "session.push", attribute.String("session.id", msg.SessionID), attribute.String("action", msg.Action))
+	defer func() { telemetry.End(span, retErr) }()
 	logger := e.logger.With(
 		"session_id", msg.SessionID,
 		"user_id", msg.UserID,
+		"trace_id", traceID,
 	)
 
 	logger.Info("pushing work session")
+	defer e.seq.Forget(rediskeys.WorkSessionOutputKey(msg.SessionID))
+
+	// Only one push per session at a time (double-clicks, several runners)
+	lockToken, acquired, err := e.acquirePushLock(ctx, msg.SessionID)
+	if err != nil {
+		return fmt.Errorf("failed to acquire push lock: %w", err)
+	}
+	if !acquired {
+		logger.Info("push already in progress, skipping duplicate request")
+		e.appendOutput(ctx, msg.SessionID, "stdout", agent.SourceRunner, "Push already in progress for this session.")
+		return nil
+	}
+	defer e.releasePushLock(msg.SessionID, lockToken)
 
 	// Get session info
 	session, err := e.getSession(ctx, msg.SessionID)
 	if err != nil {
-		return e.failSession(ctx, msg.SessionID, fmt.Errorf("failed to get session: %w", err))
+		return e.failSession(ctx, msg.SessionID, job.Wrap(job.ErrCodeInternal, fmt.Errorf("failed to get session: %w", err)))
+	}
+
+	// A duplicate request queued behind a finished push - report its result instead of pushing again
+	if session.Status == StatusPushed && session.MRUrl != "" {
+		logger.Info("session already pushed, skipping duplicate request", "mr_url", session.MRUrl)
+		e.appendOutput(ctx, msg.SessionID, "stdout", agent.SourceRunner, fmt.Sprintf("Already pushed. Merge request: %s", session.MRUrl))
+		return nil
+	}
+
+	// Answers to a push held for approval
+	switch msg.Action {
+	case ActionApprove:
+		if !e.approvalPending(ctx, session) {
+			return nil
+		}
+		logger.Info("push approved")
+		e.appendOutput(ctx, msg.SessionID, "stdout", agent.SourceRunner, "Push approved.")
+		if msg.Title == "" && msg.Description == "" {
+			msg.Title, msg.Description = session.ApprovalTitle, session.ApprovalDescription
+		}
+		if msg.TargetBranch == "" {
+			msg.TargetBranch = session.ApprovalTarget
+		}
+	case ActionReject:
+		if session.Status == StatusAwaitingApproval {
+			e.cancelApproval(ctx, msg.SessionID, job.Wrap(job.ErrCodeApprovalRejected, fmt.Errorf("push rejected")))
+		}
+		return nil
 	}
 
 	// Verify workdir exists
@@ -61,51 +149,126 @@ func (e *PushExecutor) Execute(ctx context.Context, msg *PushMessage) error {
 	repoPath := filepath.Join(workDir, "repo")
 
 	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
-		return e.failSession(ctx, msg.SessionID, fmt.Errorf("session workdir not found"))
+		return e.failSession(ctx, msg.SessionID, job.Wrap(job.ErrCodeWorkdir, fmt.Errorf("session workdir not found")))
 	}
 
 	// Get provider info
-	provider, err := e.getProviderInfo(ctx, msg.UserID, session.ProviderID)
+	provider, err := getProviderInfo(ctx, e.rdb, e.decryptor, e.tokens, msg.UserID, session.ProviderID)
 	if err != nil {
-		return e.failSession(ctx, msg.SessionID, fmt.Errorf("failed to get provider: %w", err))
+		return e.failSession(ctx, msg.SessionID, job.Wrap(job.ErrCodeProvider, fmt.Errorf("failed to get provider: %w", err)))
+	}
+
+	output := func(stream, line string) {
+		e.appendOutput(ctx, msg.SessionID, stream, agent.SourceRunner, line)
 	}
 
 	// Commit all uncommitted changes before push
 	g := git.NewWithOptions(git.Options{
 		Token:       provider.Token,
+		TokenSource: provider.TokenSource,
 		AuthorName:  e.cfg.GitAuthorName,
-		AuthorEmail: e.cfg.GitAuthorEmail,
+		AuthorEmail: authorEmail(ctx, e.cfg, e.identity, provider, logger, output),
+		Author:      identity.CommitAuthor(ctx, e.rdb, logger, msg.UserID, msg.UserName, msg.UserEmail),
+		Protected:   e.cfg.ProtectedBranches,
+		Filter:      commitFilter(e.cfg, logger, output),
 	})
 
+	// Never push straight to a branch the policy forbids
+	if err := e.checkBranchPolicy(ctx, logger, g, provider, repoPath, session.RepoURL, session.WorkBranch); err != nil {
+		return e.failSession(ctx, msg.SessionID, err)
+	}
+
+	// Refuse to push changes to paths the repository protects, committed or not
+	if err := checkProtectedPaths(ctx, g, repoPath, unpushedBase(ctx, g, repoPath, session.WorkBranch, targetBranch(session, msg))); err != nil {
+		return e.failSession(ctx, msg.SessionID, err)
+	}
+
+	// A retargeted MR needs its target on the remote
+	if err := e.checkTargetBranch(ctx, g, repoPath, msg); err != nil {
+		return e.failSession(ctx, msg.SessionID, err)
+	}
+
 	commitMsg := fmt.Sprintf("repobox: Work session %s", util.SafePrefix(session.ID, 8))
-	if err := g.Commit(ctx, repoPath, commitMsg); err != nil {
-		e.appendOutput(ctx, msg.SessionID, "stdout", "runner", "No changes to commit.")
+	// A failed commit here means there was nothing new to commit, not a span error
+	activity.SetPhase(ctx, activity.PhaseCommit)
+	commitCtx, commitSpan := telemetry.Start(ctx, "git.commit")
+	err = commitChanges(commitCtx, g, repoPath, commitMsg, func(stream, line string) {
+		e.appendOutput(ctx, msg.SessionID, stream, agent.SourceRunner, line)
+	})
+	commitSpan.SetAttributes(attribute.Bool("committed", err == nil))
+	telemetry.End(commitSpan, nil)
+	if err != nil {
+		e.appendOutput(ctx, msg.SessionID, "stdout", agent.SourceRunner, "No changes to commit.")
 	} else {
-		e.appendOutput(ctx, msg.SessionID, "stdout", "runner", "Changes committed.")
+		e.appendOutput(ctx, msg.SessionID, "stdout", agent.SourceRunner, "Changes committed.")
 	}
 
-	e.appendOutput(ctx, msg.SessionID, "stdout", "runner", "Pushing branch to remote...")
+	if e.cfg.SquashOnPush {
+		if err := e.squashCommits(ctx, g, repoPath, session, msg, commitMsg); err != nil {
+			return e.failSession(ctx, msg.SessionID, job.Wrap(job.ErrCodeCommit, fmt.Errorf("squash failed: %w", err)))
+		}
+	}
 
-	if err := g.Push(ctx, repoPath, session.WorkBranch); err != nil {
-		return e.failSession(ctx, msg.SessionID, fmt.Errorf("push failed: %w", err))
+	// Higher-trust setups review the committed changes before anything leaves the runner
+	if e.cfg.ApprovalRequired && msg.Action != ActionApprove {
+		return e.requestApproval(ctx, session, g, repoPath, msg)
 	}
 
-	e.appendOutput(ctx, msg.SessionID, "stdout", "runner", "Push completed.")
+	e.appendOutput(ctx, msg.SessionID, "stdout", agent.SourceRunner, "Pushing branch to remote...")
+
+	activity.SetPhase(ctx, activity.PhasePush)
+	pushCtx, pushSpan := telemetry.Start(ctx, "git.push")
+	err = g.Push(pushCtx, repoPath, session.WorkBranch)
+	telemetry.End(pushSpan, err)
+	if err != nil {
+		return e.failSession(ctx, msg.SessionID, job.Wrap(job.GitErrorCode(job.ErrCodePush, err), fmt.Errorf("push failed: %w", err)))
+	}
+
+	e.appendOutput(ctx, msg.SessionID, "stdout", agent.SourceRunner, "Push completed.")
+	if msg.Action == ActionApprove {
+		e.rdb.ZRem(ctx, rediskeys.WorkSessionsAwaitingApprovalKey(), msg.SessionID)
+	}
+
+	// File counts for the MR description, best effort
+	diff, err := g.GetDiffSummary(ctx, repoPath, "origin/"+targetBranch(session, msg))
+	if err != nil {
+		logger.Warn("failed to get diff summary", "error", err)
+	}
+
+	// Tell the user up front whether the MR will merge cleanly
+	conflictFields, err := job.CheckMergeConflicts(ctx, g, repoPath, targetBranch(session, msg), func(line string) {
+		e.appendOutput(ctx, msg.SessionID, "stderr", agent.SourceRunner, line)
+	})
+	if err != nil {
+		logger.Warn("merge conflict check failed", "error", err)
+	}
 
 	// Create MR/PR
-	mrURL, mrWarning := e.createMergeRequest(ctx, session, provider, msg)
+	activity.SetPhase(ctx, activity.PhaseMergeRequest)
+	mrCtx, mrSpan := telemetry.Start(ctx, "mr.create", attribute.String("provider", provider.Type))
+	mrURL, mrErr := e.createMergeRequest(mrCtx, session, provider, msg, diff)
+	telemetry.End(mrSpan, mrErr)
 
 	updates := map[string]interface{}{
-		"pushed_at": time.Now().UnixMilli(),
+		"pushed_at":        time.Now().UnixMilli(),
+		"pushed_job_count": session.JobCount,
+		"error_code":       "",
+	}
+	for k, v := range conflictFields {
+		updates[k] = v
 	}
 
+	var mrWarning string
 	if mrURL != "" {
 		updates["mr_url"] = mrURL
-		e.appendOutput(ctx, msg.SessionID, "stdout", "runner", fmt.Sprintf("Merge request created: %s", mrURL))
+		e.appendOutput(ctx, msg.SessionID, "stdout", agent.SourceRunner, fmt.Sprintf("Merge request created: %s", mrURL))
 	}
-	if mrWarning != "" {
+	if mrErr != nil {
+		// The branch is pushed, so an MR failure is only a warning - the code lets the UI offer a retry
+		mrWarning = mrErr.Error()
 		updates["mr_warning"] = mrWarning
-		e.appendOutput(ctx, msg.SessionID, "stderr", "runner", fmt.Sprintf("Warning: %s", mrWarning))
+		updates["error_code"] = string(job.CodeOf(mrErr))
+		e.appendOutput(ctx, msg.SessionID, "stderr", agent.SourceRunner, fmt.Sprintf("Warning: %s", mrWarning))
 	}
 
 	// Update session status to pushed
@@ -121,17 +284,71 @@ func (e *PushExecutor) Execute(ctx context.Context, msg *PushMessage) error {
 	return nil
 }
 
-// createMergeRequest creates a MR/PR and returns the URL or warning message
+// checkBranchPolicy fails if the session's work branch may not be pushed to
+// directly. An unknown default branch fails closed when ForbidDefaultBranch is set.
+func (e *PushExecutor) checkBranchPolicy(ctx context.Context, logger *slog.Logger, g *git.Git, provider *providerInfo, repoPath, repoURL, branch string) error {
+	defaultBranch, err := job.DefaultBranch(ctx, g, repoPath, provider.Type, provider.URL, provider.Token, repoURL)
+	if err != nil {
+		logger.Warn("default branch unknown", "error", err)
+	}
+	policy := git.BranchPolicy{ForbidDefault: e.cfg.ForbidDefaultBranch, Protected: e.cfg.ProtectedBranches}
+	return job.Wrap(job.ErrCodeBranchPolicy, policy.Check(branch, defaultBranch))
+}
+
+// targetBranch returns the branch the MR merges into: the push message's
+// target_branch, else the session's base branch
+func targetBranch(session *Session, msg *PushMessage) string {
+	if msg.TargetBranch != "" {
+		return msg.TargetBranch
+	}
+	return session.BaseBranch
+}
+
+// checkTargetBranch fails if the push message retargets the MR to a branch
+// the remote doesn't have
+func (e *PushExecutor) checkTargetBranch(ctx context.Context, g *git.Git, repoPath string, msg *PushMessage) error {
+	if msg.TargetBranch == "" {
+		return nil
+	}
+
+	exists, err := g.RemoteBranchExists(ctx, repoPath, msg.TargetBranch)
+	if err != nil {
+		return job.Wrap(job.GitErrorCode(job.ErrCodeBranch, err), fmt.Errorf("failed to check target branch %s: %w", msg.TargetBranch, err))
+	}
+	if !exists {
+		return job.Wrap(job.ErrCodeBranch, fmt.Errorf("target branch %s does not exist on the remote", msg.TargetBranch))
+	}
+	e.appendOutput(ctx, msg.SessionID, "stdout", agent.SourceRunner, fmt.Sprintf("Targeting branch %s.", msg.TargetBranch))
+	return nil
+}
+
+// changedFiles converts the diff's files for the MR/PR description
+func changedFiles(diff git.DiffSummary) []mergerequest.ChangedFile {
+	if len(diff.Files) == 0 {
+		return nil
+	}
+	files := make([]mergerequest.ChangedFile, len(diff.Files))
+	for i, f := range diff.Files {
+		files[i] = mergerequest.ChangedFile{Status: f.Status, Path: f.Path, OldPath: f.OldPath}
+	}
+	return files
+}
+
+// createMergeRequest creates a MR/PR and returns the URL, or an error to be reported as a warning
 func (e *PushExecutor) createMergeRequest(
 	ctx context.Context,
 	session *Session,
 	provider *providerInfo,
 	msg *PushMessage,
-) (mrURL string, warning string) {
+	diff git.DiffSummary,
+) (mrURL string, mrErr error) {
 	// Extract project ID from repo URL
 	projectID, err := mergerequest.ExtractProjectID(session.RepoURL)
 	if err != nil {
-		return "", fmt.Sprintf("Failed to extract project ID: %s", err)
+		return "", job.Wrap(job.ErrCodeMR, fmt.Errorf("Failed to extract project ID: %s", err))
+	}
+	if err := mergerequest.ValidateProjectID(mergerequest.ProviderType(provider.Type), projectID); err != nil {
+		return "", job.Wrap(job.ErrCodeMR, fmt.Errorf("Failed to extract project ID from %s: %w", session.RepoURL, err))
 	}
 
 	// Get the appropriate client
@@ -141,8 +358,10 @@ func (e *PushExecutor) createMergeRequest(
 		creator = mergerequest.NewGitHubClient()
 	case "gitlab":
 		creator = mergerequest.NewGitLabClient()
+	case "azure":
+		creator = mergerequest.NewAzureDevOpsClient()
 	default:
-		return "", fmt.Sprintf("Unknown provider type: %s", provider.Type)
+		return "", job.Wrap(job.ErrCodeMR, fmt.Errorf("Unknown provider type: %s", provider.Type))
 	}
 
 	// Generate title and description
@@ -153,32 +372,219 @@ func (e *PushExecutor) createMergeRequest(
 
 	description := msg.Description
 	if description == "" {
-		description = mergerequest.GenerateDescription(mergerequest.TemplateParams{
+		description, err = e.mrTemplate.Render(mergerequest.TemplateParams{
 			Prompt:       fmt.Sprintf("Work session with %d prompts", session.JobCount),
 			LinesAdded:   session.TotalLinesAdded,
 			LinesRemoved: session.TotalLinesRemoved,
 			BranchName:   session.WorkBranch,
 			JobID:        session.ID,
+			Summary:      session.AgentSummary,
+			FilesChanged: diff.FilesChanged,
+			FilesAdded:   diff.FilesAdded,
+			FilesDeleted: diff.FilesDeleted,
+			FilesRenamed: diff.FilesRenamed,
+			Files:        changedFiles(diff),
 		})
+		if err != nil {
+			return "", job.Wrap(job.ErrCodeMR, fmt.Errorf("Failed to render merge request description: %s", err))
+		}
 	}
 
-	e.appendOutput(ctx, session.ID, "stdout", "runner", "Creating merge request...")
+	e.appendOutput(ctx, session.ID, "stdout", agent.SourceRunner, "Creating merge request...")
+
+	// Bound the API call so a hung self-hosted server can't stall the push
+	mrCtx := ctx
+	if e.cfg.MRCreateTimeout > 0 {
+		var cancel context.CancelFunc
+		mrCtx, cancel = context.WithTimeout(ctx, e.cfg.MRCreateTimeout)
+		defer cancel()
+	}
 
-	result, err := creator.Create(mergerequest.CreateParams{
-		Token:        provider.Token,
+	// The push may have outlived a GitHub App token fetched at its start
+	token, err := provider.currentToken(mrCtx)
+	if err != nil {
+		return "", job.Wrap(job.ErrCodeAuth, fmt.Errorf("Failed to get provider token: %w", err))
+	}
+
+	params := mergerequest.CreateParams{
+		Token:        token,
 		BaseURL:      provider.URL,
 		ProjectID:    projectID,
 		Title:        title,
 		Description:  description,
 		SourceBranch: session.WorkBranch,
-		TargetBranch: session.BaseBranch,
+		TargetBranch: targetBranch(session, msg),
+	}
+
+	var result *mergerequest.Result
+	if reopener, ok := creator.(mergerequest.Reopener); ok && e.cfg.MRReopenClosed {
+		result = e.reopenClosedMR(mrCtx, session.ID, reopener, params)
+	}
+	if result == nil {
+		result, err = creator.Create(mrCtx, params)
+		if err != nil {
+			return "", job.Wrap(mrErrorCode(err), fmt.Errorf("Failed to create merge request: %w", err))
+		}
+	}
+
+	if e.cfg.MRAutoMerge {
+		e.enableAutoMerge(mrCtx, session.ID, creator, mergerequest.AutoMergeParams{
+			Token:     token,
+			BaseURL:   provider.URL,
+			ProjectID: projectID,
+			Result:    result,
+		})
+	}
+
+	return result.URL, nil
+}
+
+// reopenClosedMR reopens the MR/PR the user closed on an earlier push of the
+// same branch into the same target. Returns nil when there is none or it can't
+// be reopened, so a new one is created instead.
+func (e *PushExecutor) reopenClosedMR(ctx context.Context, sessionID string, reopener mergerequest.Reopener, params mergerequest.CreateParams) *mergerequest.Result {
+	closed, err := reopener.ClosedMR(ctx, params)
+	if err != nil {
+		e.logger.Warn("failed to look up closed merge request", "session_id", sessionID, "error", err)
+		return nil
+	}
+	if closed == nil {
+		return nil
+	}
+
+	result, err := reopener.ReopenMR(ctx, mergerequest.ReopenParams{
+		Token:     params.Token,
+		BaseURL:   params.BaseURL,
+		ProjectID: params.ProjectID,
+		Result:    closed,
 	})
+	if err != nil {
+		e.logger.Warn("failed to reopen merge request", "session_id", sessionID, "mr_url", closed.URL, "error", err)
+		e.appendOutput(ctx, sessionID, "stderr", agent.SourceRunner, fmt.Sprintf("Warning: could not reopen closed merge request %s, creating a new one: %s", closed.URL, err))
+		return nil
+	}
+	e.appendOutput(ctx, sessionID, "stdout", agent.SourceRunner, fmt.Sprintf("Reopened closed merge request: %s", result.URL))
+	return result
+}
+
+// enableAutoMerge asks the provider to merge the MR/PR once its pipeline passes.
+// The MR exists at this point, so a failure is only reported as a warning.
+func (e *PushExecutor) enableAutoMerge(ctx context.Context, sessionID string, creator mergerequest.Creator, params mergerequest.AutoMergeParams) {
+	merger, ok := creator.(mergerequest.AutoMerger)
+	if !ok {
+		return
+	}
+
+	if err := merger.EnableAutoMerge(ctx, params); err != nil {
+		e.logger.Warn("failed to enable auto-merge", "session_id", sessionID, "error", err)
+		e.appendOutput(ctx, sessionID, "stderr", agent.SourceRunner, fmt.Sprintf("Warning: could not enable auto-merge: %s", err))
+		return
+	}
+	e.appendOutput(ctx, sessionID, "stdout", agent.SourceRunner, "Auto-merge enabled: the merge request merges once its pipeline passes")
+}
+
+// squashCommits folds the session's unpushed commits into one whose message
+// lists the prompts behind them. After an earlier push only the commits since
+// then are squashed, so the push stays a fast-forward.
+func (e *PushExecutor) squashCommits(ctx context.Context, g *git.Git, repoPath string, session *Session, msg *PushMessage, title string) error {
+	base := unpushedBase(ctx, g, repoPath, session.WorkBranch, targetBranch(session, msg))
+	commits, err := g.CommitsSince(ctx, repoPath, base)
+	if err != nil {
+		return err
+	}
+	if len(commits) < 2 {
+		return nil
+	}
+
+	message := squashMessage(title, e.sessionPrompts(ctx, session), commits)
+	n, err := g.Squash(ctx, repoPath, base, message)
+	if err != nil {
+		return err
+	}
+	e.appendOutput(ctx, session.ID, "stdout", agent.SourceRunner, fmt.Sprintf("Squashed %d commits into one.", n))
+	return nil
+}
 
+// unpushedBase returns the ref the session's unpushed commits sit on: the
+// work branch as last pushed, or the target branch before the first push
+func unpushedBase(ctx context.Context, g *git.Git, repoPath, workBranch, target string) string {
+	if pushed := "origin/" + workBranch; g.RefExists(ctx, repoPath, pushed) {
+		return pushed
+	}
+	return "origin/" + target
+}
+
+// sessionPrompts returns the prompts of the session's jobs since its last
+// push, oldest first. Best effort: jobs that can't be read are skipped.
+func (e *PushExecutor) sessionPrompts(ctx context.Context, session *Session) []string {
+	jobIDs, err := e.rdb.LRange(ctx, rediskeys.WorkSessionJobsKey(session.ID), 0, -1).Result()
 	if err != nil {
-		return "", fmt.Sprintf("Failed to create merge request: %s", err)
+		e.logger.Warn("failed to list session jobs", "session_id", session.ID, "error", err)
+		return nil
 	}
 
-	return result.URL, ""
+	var prompts []string
+	for _, id := range jobIDs {
+		data, err := e.rdb.HMGet(ctx, rediskeys.JobKey(id), "prompt", "created_at").Result()
+		if err != nil || data[0] == nil {
+			continue
+		}
+		if createdAt, _ := data[1].(string); session.PushedAt > 0 && createdAt != "" {
+			if ts, err := strconv.ParseInt(createdAt, 10, 64); err == nil && ts < session.PushedAt {
+				continue
+			}
+		}
+		prompts = append(prompts, data[0].(string))
+	}
+	return prompts
+}
+
+// maxSquashPromptLength caps each prompt listed in a squashed commit message
+const maxSquashPromptLength = 200
+
+// squashMessage builds the message of a squashed commit: the title, then the
+// prompts behind the changes, or the squashed commits' subjects without any
+func squashMessage(title string, prompts []string, commits []git.CommitInfo) string {
+	var b strings.Builder
+	b.WriteString(title)
+
+	if len(prompts) > 0 {
+		b.WriteString("\n\nPrompts:")
+		for _, p := range prompts {
+			b.WriteString("\n- " + truncateString(strings.Join(strings.Fields(p), " "), maxSquashPromptLength))
+		}
+		return b.String()
+	}
+
+	b.WriteString("\n\nSquashed commits:")
+	for _, c := range commits {
+		b.WriteString("\n- " + c.Subject)
+	}
+	return b.String()
+}
+
+// releasePushLockScript deletes the lock only if it is still held by the caller's token
+var releasePushLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// acquirePushLock takes the per-session push lock. The TTL frees it if the runner dies mid-push.
+func (e *PushExecutor) acquirePushLock(ctx context.Context, sessionID string) (token string, acquired bool, err error) {
+	token = fmt.Sprintf("%s:%d", e.cfg.RunnerID, time.Now().UnixNano())
+	acquired, err = e.rdb.SetNX(ctx, rediskeys.WorkSessionPushLockKey(sessionID), token, e.cfg.PushLockTTL).Result()
+	return token, acquired, err
+}
+
+// releasePushLock frees the push lock unless it already expired and was taken by another push
+func (e *PushExecutor) releasePushLock(sessionID, token string) {
+	// Background context so the lock is released even if the push context was cancelled
+	err := releasePushLockScript.Run(context.Background(), e.rdb, []string{rediskeys.WorkSessionPushLockKey(sessionID)}, token).Err()
+	if err != nil {
+		e.logger.Warn("failed to release push lock", "session_id", sessionID, "error", err)
+	}
 }
 
 // getSessionWorkDir returns the workdir path for a session
@@ -204,6 +610,8 @@ func (e *PushExecutor) getSession(ctx context.Context, sessionID string) (*Sessi
 	fmt.Sscanf(data["job_count"], "%d", &jobCount)
 	fmt.Sscanf(data["total_lines_added"], "%d", &linesAdded)
 	fmt.Sscanf(data["total_lines_removed"], "%d", &linesRemoved)
+	approvalExpiresAt, _ := strconv.ParseInt(data["approval_expires_at"], 10, 64)
+	pushedAt, _ := strconv.ParseInt(data["pushed_at"], 10, 64)
 
 	return &Session{
 		ID:                data["id"],
@@ -214,38 +622,17 @@ func (e *PushExecutor) getSession(ctx context.Context, sessionID string) (*Sessi
 		BaseBranch:        data["base_branch"],
 		WorkBranch:        data["work_branch"],
 		Status:            Status(data["status"]),
+		MRUrl:             data["mr_url"],
 		JobCount:          jobCount,
 		TotalLinesAdded:   linesAdded,
 		TotalLinesRemoved: linesRemoved,
-	}, nil
-}
-
-// getProviderInfo fetches provider details including decrypted token
-func (e *PushExecutor) getProviderInfo(ctx context.Context, userID, providerID string) (*providerInfo, error) {
-	key := rediskeys.GitProviderKey(userID, providerID)
-
-	data, err := e.rdb.HGetAll(ctx, key).Result()
-	if err != nil {
-		return nil, err
-	}
-	if len(data) == 0 {
-		return nil, fmt.Errorf("provider not found: %s", providerID)
-	}
+		AgentSummary:      data["agent_summary"],
+		PushedAt:          pushedAt,
 
-	encryptedToken, ok := data["token"]
-	if !ok {
-		return nil, fmt.Errorf("token not found for provider: %s", providerID)
-	}
-
-	token, err := e.decryptor.Decrypt(encryptedToken)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt token: %w", err)
-	}
-
-	return &providerInfo{
-		Token: token,
-		Type:  data["type"],
-		URL:   data["url"],
+		ApprovalExpiresAt:   approvalExpiresAt,
+		ApprovalTitle:       data["approval_title"],
+		ApprovalDescription: data["approval_description"],
+		ApprovalTarget:      data["approval_target"],
 	}, nil
 }
 
@@ -262,31 +649,31 @@ func (e *PushExecutor) updateSessionStatus(ctx context.Context, sessionID string
 		updates[k] = v
 	}
 
-	return e.rdb.HSet(ctx, key, updates).Err()
+	return rediskeys.Retry(ctx, statusRetry(status), func(ctx context.Context) error {
+		// Batched output lines land before the status the UI reacts to
+		_ = e.seq.Flush(ctx, rediskeys.WorkSessionOutputKey(sessionID))
+		return e.rdb.HSet(ctx, key, updates).Err()
+	})
 }
 
 // failSession marks a session as failed and returns to ready state
 func (e *PushExecutor) failSession(ctx context.Context, sessionID string, err error) error {
-	e.appendOutput(ctx, sessionID, "stderr", "runner", fmt.Sprintf("Error: %s", err.Error()))
+	e.appendOutput(ctx, sessionID, "stderr", agent.SourceRunner, fmt.Sprintf("Error: %s", err.Error()))
+	if retryLater(ctx, err) {
+		e.appendOutput(ctx, sessionID, "stderr", agent.SourceRunner, "Retrying later...")
+		return err
+	}
 
 	// Return to ready so user can retry
-	e.updateSessionStatus(ctx, sessionID, StatusReady, map[string]interface{}{
+	storeErr := e.updateSessionStatus(ctx, sessionID, StatusReady, map[string]interface{}{
 		"mr_warning": err.Error(),
+		"error_code": string(job.CodeOf(err)),
 	})
 
-	return err
+	return recorded(err, storeErr)
 }
 
 // appendOutput adds output line to session output list
-func (e *PushExecutor) appendOutput(ctx context.Context, sessionID, stream, source, line string) {
-	key := rediskeys.WorkSessionOutputKey(sessionID)
-	output := map[string]interface{}{
-		"timestamp": time.Now().UnixMilli(),
-		"line":      line,
-		"stream":    stream,
-		"source":    source,
-	}
-	data, _ := json.Marshal(output)
-	e.rdb.RPush(ctx, key, string(data))
-	e.rdb.Expire(ctx, key, 7*24*time.Hour)
+func (e *PushExecutor) appendOutput(ctx context.Context, sessionID, stream string, source agent.OutputSource, line string) {
+	joboutput.NewWriter(e.rdb, e.seq, e.redactor, 7*24*time.Hour).Append(ctx, rediskeys.WorkSessionOutputKey(sessionID), stream, source, line, nil)
 }
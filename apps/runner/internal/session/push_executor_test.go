@@ -0,0 +1,327 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/config"
+	"github.com/repobox/runner/internal/git"
+	"github.com/repobox/runner/internal/job"
+	rediskeys "github.com/repobox/runner/internal/redis"
+)
+
+func newTestPushExecutor(t *testing.T) (*PushExecutor, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	return &PushExecutor{
+		rdb:    rdb,
+		cfg:    &config.Config{RunnerID: "runner-1", TempDir: t.TempDir(), PushLockTTL: time.Minute},
+		seq:    rediskeys.NewOutputSequencer(rdb),
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}, rdb
+}
+
+// sessionOutput returns the output lines of a session
+func sessionOutput(t *testing.T, rdb *redis.Client, sessionID string) []string {
+	t.Helper()
+	raw, err := rdb.LRange(context.Background(), rediskeys.WorkSessionOutputKey(sessionID), 0, -1).Result()
+	if err != nil {
+		t.Fatalf("LRange() error = %v", err)
+	}
+	lines := make([]string, 0, len(raw))
+	for _, r := range raw {
+		var entry struct {
+			Line string `json:"line"`
+		}
+		if err := json.Unmarshal([]byte(r), &entry); err != nil {
+			t.Fatalf("invalid output entry %q: %v", r, err)
+		}
+		lines = append(lines, entry.Line)
+	}
+	return lines
+}
+
+func TestAcquirePushLock_Concurrent(t *testing.T) {
+	e, _ := newTestPushExecutor(t)
+	ctx := context.Background()
+
+	const requests = 20
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		acquired int
+	)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, ok, err := e.acquirePushLock(ctx, "s1")
+			if err != nil {
+				t.Errorf("acquirePushLock() error = %v", err)
+				return
+			}
+			if ok {
+				mu.Lock()
+				acquired++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if acquired != 1 {
+		t.Errorf("%d of %d concurrent pushes acquired the lock, want 1", acquired, requests)
+	}
+}
+
+func TestReleasePushLock(t *testing.T) {
+	e, rdb := newTestPushExecutor(t)
+	ctx := context.Background()
+	key := rediskeys.WorkSessionPushLockKey("s1")
+
+	token, ok, err := e.acquirePushLock(ctx, "s1")
+	if err != nil || !ok {
+		t.Fatalf("acquirePushLock() = %v, %v", ok, err)
+	}
+
+	// A stale token (lock expired and re-taken) must not release the current holder
+	e.releasePushLock("s1", "someone-else")
+	if n, _ := rdb.Exists(ctx, key).Result(); n != 1 {
+		t.Fatal("lock released by a non-owner")
+	}
+
+	e.releasePushLock("s1", token)
+	if n, _ := rdb.Exists(ctx, key).Result(); n != 0 {
+		t.Error("lock still held after release by owner")
+	}
+}
+
+func TestExecute_DuplicatePush(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(ctx context.Context, rdb *redis.Client)
+		wantLine string
+	}{
+		{
+			name: "push in progress",
+			setup: func(ctx context.Context, rdb *redis.Client) {
+				rdb.Set(ctx, rediskeys.WorkSessionPushLockKey("s1"), "runner-2:1", time.Minute)
+			},
+			wantLine: "Push already in progress",
+		},
+		{
+			name: "push completed",
+			setup: func(ctx context.Context, rdb *redis.Client) {
+				rdb.HSet(ctx, rediskeys.WorkSessionKey("s1"), map[string]interface{}{
+					"status": string(StatusPushed),
+					"mr_url": "https://github.com/owner/repo/pull/7",
+				})
+			},
+			wantLine: "Already pushed. Merge request: https://github.com/owner/repo/pull/7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, rdb := newTestPushExecutor(t)
+			ctx := context.Background()
+			rdb.HSet(ctx, rediskeys.WorkSessionKey("s1"), map[string]interface{}{
+				"id":          "s1",
+				"provider_id": "p1",
+				"work_branch": "repobox/s1",
+			})
+			tt.setup(ctx, rdb)
+
+			if err := e.Execute(ctx, &PushMessage{SessionID: "s1", UserID: "user-1"}); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+
+			lines := sessionOutput(t, rdb, "s1")
+			if len(lines) != 1 || !strings.HasPrefix(lines[0], tt.wantLine) {
+				t.Errorf("output = %q, want only %q", lines, tt.wantLine)
+			}
+		})
+	}
+}
+
+func TestCheckBranchPolicy(t *testing.T) {
+	origin := filepath.Join(t.TempDir(), "origin")
+	repo := filepath.Join(t.TempDir(), "repo")
+	for _, args := range [][]string{
+		{"init", "-b", "main", origin},
+		{"-C", origin, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--allow-empty", "-m", "initial"},
+		{"clone", origin, repo},
+	} {
+		if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %s", args, output)
+		}
+	}
+
+	// Without an origin or a reachable provider the default branch is unknown
+	orphan := t.TempDir()
+	if output, err := exec.Command("git", "init", orphan).CombinedOutput(); err != nil {
+		t.Fatalf("git init failed: %s", output)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+	provider := &providerInfo{Token: "gl-token", Type: "gitlab", URL: srv.URL}
+
+	tests := []struct {
+		name      string
+		repo      string
+		forbid    bool
+		protected []string
+		branch    string
+		wantErr   bool
+	}{
+		{"policy off", repo, false, nil, "main", false},
+		{"work branch", repo, true, nil, "repobox/abc12345", false},
+		{"default branch", repo, true, nil, "main", true},
+		{"protected branch", repo, false, []string{"release/*"}, "release/2.0", true},
+		{"unknown default fails closed", orphan, true, nil, "repobox/abc12345", true},
+		{"unknown default without policy", orphan, false, nil, "repobox/abc12345", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, _ := newTestPushExecutor(t)
+			e.cfg.ForbidDefaultBranch = tt.forbid
+			e.cfg.ProtectedBranches = tt.protected
+
+			err := e.checkBranchPolicy(context.Background(), e.logger, git.New(), provider, tt.repo, "https://gitlab.example.com/group/project.git", tt.branch)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkBranchPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && job.CodeOf(err) != job.ErrCodeBranchPolicy {
+				t.Errorf("error code = %q, want %q", job.CodeOf(err), job.ErrCodeBranchPolicy)
+			}
+		})
+	}
+}
+
+func TestTargetBranch(t *testing.T) {
+	session := &Session{BaseBranch: "main"}
+
+	tests := []struct {
+		name string
+		msg  *PushMessage
+		want string
+	}{
+		{"base branch by default", &PushMessage{}, "main"},
+		{"push message overrides", &PushMessage{TargetBranch: "release/2.0"}, "release/2.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := targetBranch(session, tt.msg); got != tt.want {
+				t.Errorf("targetBranch() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckTargetBranch(t *testing.T) {
+	origin := filepath.Join(t.TempDir(), "origin")
+	repo := filepath.Join(t.TempDir(), "repo")
+	for _, args := range [][]string{
+		{"init", "-b", "main", origin},
+		{"-C", origin, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--allow-empty", "-m", "initial"},
+		{"clone", origin, repo},
+		{"-C", origin, "branch", "release/2.0"},
+	} {
+		if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %s", args, output)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		target  string
+		wantErr bool
+	}{
+		{"no override", "", false},
+		{"branch created after the clone", "release/2.0", false},
+		{"missing branch", "release/3.0", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, _ := newTestPushExecutor(t)
+
+			err := e.checkTargetBranch(context.Background(), git.New(), repo, &PushMessage{SessionID: "s1", TargetBranch: tt.target})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkTargetBranch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && job.CodeOf(err) != job.ErrCodeBranch {
+				t.Errorf("error code = %q, want %q", job.CodeOf(err), job.ErrCodeBranch)
+			}
+		})
+	}
+}
+
+func TestSquashMessage(t *testing.T) {
+	commits := []git.CommitInfo{{Subject: "repobox: Work session abc12345"}, {Subject: "Add tests"}}
+
+	tests := []struct {
+		name    string
+		prompts []string
+		want    string
+	}{
+		{"prompts", []string{"Add a README", "Fix the\n  failing tests"}, "repobox: Work session abc12345\n\nPrompts:\n- Add a README\n- Fix the failing tests"},
+		{"long prompt truncated", []string{strings.Repeat("a", 250)}, "repobox: Work session abc12345\n\nPrompts:\n- " + strings.Repeat("a", 197) + "..."},
+		{"commit subjects without prompts", nil, "repobox: Work session abc12345\n\nSquashed commits:\n- repobox: Work session abc12345\n- Add tests"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := squashMessage("repobox: Work session abc12345", tt.prompts, commits); got != tt.want {
+				t.Errorf("squashMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionPrompts(t *testing.T) {
+	e, rdb := newTestPushExecutor(t)
+	ctx := context.Background()
+
+	rdb.RPush(ctx, rediskeys.WorkSessionJobsKey("s1"), "job-1", "job-2", "job-missing", "job-3")
+	rdb.HSet(ctx, rediskeys.JobKey("job-1"), "prompt", "Before the push", "created_at", "1000")
+	rdb.HSet(ctx, rediskeys.JobKey("job-2"), "prompt", "After the push", "created_at", "3000")
+	rdb.HSet(ctx, rediskeys.JobKey("job-3"), "prompt", "No timestamp")
+
+	tests := []struct {
+		name     string
+		pushedAt int64
+		want     []string
+	}{
+		{"never pushed", 0, []string{"Before the push", "After the push", "No timestamp"}},
+		{"pushed before", 2000, []string{"After the push", "No timestamp"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := e.sessionPrompts(ctx, &Session{ID: "s1", PushedAt: tt.pushedAt})
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("sessionPrompts() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
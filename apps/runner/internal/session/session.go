@@ -1,17 +1,31 @@
 package session
 
+import rediskeys "github.com/repobox/runner/internal/redis"
+
 // Status represents work session status
 type Status string
 
 const (
-	StatusInitializing Status = "initializing"
-	StatusReady        Status = "ready"
-	StatusRunning      Status = "running"
-	StatusPushed       Status = "pushed"
-	StatusArchived     Status = "archived"
-	StatusFailed       Status = "failed"
+	StatusInitializing     Status = "initializing"
+	StatusReady            Status = "ready"
+	StatusRunning          Status = "running"
+	StatusAwaitingApproval Status = "awaiting_approval"
+	StatusPushed           Status = "pushed"
+	StatusArchived         Status = "archived"
+	StatusFailed           Status = "failed"
 )
 
+// statusRetry picks how hard a session status update is retried while Redis
+// is unreachable. Any status but initializing/running ends an executor's run
+// and must land, or the session looks busy forever.
+func statusRetry(status Status) rediskeys.RetryPolicy {
+	switch status {
+	case StatusInitializing, StatusRunning:
+		return rediskeys.StatusRetry
+	}
+	return rediskeys.TerminalRetry
+}
+
 // Session represents a work session
 type Session struct {
 	ID               string
@@ -28,9 +42,19 @@ type Session struct {
 	TotalLinesAdded  int
 	TotalLinesRemoved int
 	JobCount         int
+	PushedJobCount   int // JobCount at the last push; SESSION_MAX_JOBS counts the prompts since
+	AgentSummary     string
+	AgentSessionID   string // Claude CLI session of the last prompt, resumed by the next one
+	RepoTopics       []string
 	LastActivityAt   int64
 	CreatedAt        int64
-	PushedAt         int64
+	PushedAt         int64 // Last push (unix ms)
+
+	// Push awaiting approval
+	ApprovalExpiresAt   int64  // Approval deadline (unix ms)
+	ApprovalTitle       string // MR title from the original push request
+	ApprovalDescription string // MR description from the original push request
+	ApprovalTarget      string // MR target branch from the original push request, empty for the base branch
 }
 
 // InitMessage represents a session init task from the stream
@@ -50,12 +74,21 @@ type JobMessage struct {
 	UserID      string
 	Prompt      string
 	Environment string
+	Secrets     []string // Names of the user's secrets to inject into the agent's environment
+	WorkSubdir  string   // Repository subdirectory the agent runs in, empty for the root
+	Amend       bool     // Fold the changes into the session's last unpushed commit
+	UserName    string   // Requesting user's name, credited as author of the prompt's commits
+	UserEmail   string   // Requesting user's email, credited as author of the prompt's commits
 }
 
 // PushMessage represents a session push task from the stream
 type PushMessage struct {
-	SessionID   string
-	UserID      string
-	Title       string
-	Description string
+	SessionID    string
+	UserID       string
+	Title        string
+	Description  string
+	Action       string // Empty to push, ActionApprove or ActionReject for a push awaiting approval
+	UserName     string // Requesting user's name, credited as commit author
+	UserEmail    string // Requesting user's email, credited as commit author
+	TargetBranch string // Branch the MR merges into instead of the session's base branch
 }
@@ -0,0 +1,114 @@
+// Package telemetry exports OpenTelemetry spans for the major phases of jobs
+// and session tasks (clone, agent, commit, push, MR creation).
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/repobox/runner/internal/trace"
+)
+
+// ServiceName is the default service.name resource attribute
+const ServiceName = "repobox-runner"
+
+const instrumentationName = "github.com/repobox/runner"
+
+// Setup installs a global tracer provider exporting over OTLP/HTTP. With an
+// empty endpoint tracing stays a no-op. The exporter reads the standard
+// OTEL_EXPORTER_OTLP_* variables (endpoint, headers, TLS). The returned
+// function flushes and stops the exporter.
+func Setup(ctx context.Context, endpoint, runnerID string) (shutdown func(context.Context) error, err error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	// OTEL_SERVICE_NAME / OTEL_RESOURCE_ATTRIBUTES override the defaults
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			attribute.String("service.name", ServiceName),
+			attribute.String("repobox.runner_id", runnerID),
+		),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTel resource: %w", err)
+	}
+
+	tp := NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return tp.Shutdown, nil
+}
+
+// NewTracerProvider creates a tracer provider whose root spans take their
+// trace ID from the job's trace ID, so spans, output entries and log lines
+// share one ID
+func NewTracerProvider(opts ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(append(opts, sdktrace.WithIDGenerator(idGenerator{}))...)
+}
+
+// Start starts a span named name as a child of the span in ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, oteltrace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, oteltrace.WithAttributes(attrs...))
+}
+
+// End records err as a span event and error status, then ends the span
+func End(span oteltrace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// idGenerator uses the trace ID from the context (a UUID) as the OTel trace
+// ID of root spans, falling back to random IDs
+type idGenerator struct{}
+
+func (idGenerator) NewIDs(ctx context.Context) (oteltrace.TraceID, oteltrace.SpanID) {
+	traceID, ok := parseTraceID(trace.IDFromContext(ctx))
+	if !ok {
+		_, _ = rand.Read(traceID[:])
+	}
+	return traceID, newSpanID()
+}
+
+func (idGenerator) NewSpanID(ctx context.Context, traceID oteltrace.TraceID) oteltrace.SpanID {
+	return newSpanID()
+}
+
+func newSpanID() oteltrace.SpanID {
+	var id oteltrace.SpanID
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+// parseTraceID converts a UUID to an OTel trace ID
+func parseTraceID(id string) (oteltrace.TraceID, bool) {
+	var traceID oteltrace.TraceID
+	b, err := hex.DecodeString(strings.ReplaceAll(id, "-", ""))
+	if err != nil || len(b) != len(traceID) {
+		return traceID, false
+	}
+	copy(traceID[:], b)
+	return traceID, traceID.IsValid()
+}
@@ -0,0 +1,103 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/repobox/runner/internal/trace"
+)
+
+// recordSpans installs a tracer provider that keeps ended spans in memory
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	tp := NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prev)
+		_ = tp.Shutdown(context.Background())
+	})
+	return recorder
+}
+
+func TestSetup_NoEndpoint(t *testing.T) {
+	shutdown, err := Setup(context.Background(), "", "runner-1")
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown() error = %v", err)
+	}
+}
+
+func TestStart_SpanTree(t *testing.T) {
+	recorder := recordSpans(t)
+
+	traceID := trace.NewID()
+	ctx := trace.WithID(context.Background(), traceID)
+	ctx, root := Start(ctx, "job")
+	_, clone := Start(ctx, "git.clone")
+	End(clone, nil)
+	_, push := Start(ctx, "git.push")
+	End(push, errors.New("push rejected"))
+	End(root, nil)
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want 3", len(spans))
+	}
+	byName := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range spans {
+		byName[s.Name()] = s
+	}
+
+	want, _ := parseTraceID(traceID)
+	rootSpan := byName["job"]
+	if got := rootSpan.SpanContext().TraceID(); got != want {
+		t.Errorf("root trace ID = %s, want %s from the job trace ID", got, want)
+	}
+	if rootSpan.Parent().IsValid() {
+		t.Errorf("root span has parent %s, want none", rootSpan.Parent().SpanID())
+	}
+	for _, name := range []string{"git.clone", "git.push"} {
+		if got := byName[name].Parent().SpanID(); got != rootSpan.SpanContext().SpanID() {
+			t.Errorf("%s parent = %s, want root %s", name, got, rootSpan.SpanContext().SpanID())
+		}
+	}
+
+	pushSpan := byName["git.push"]
+	if pushSpan.Status().Code != codes.Error {
+		t.Errorf("git.push status = %v, want Error", pushSpan.Status().Code)
+	}
+	if events := pushSpan.Events(); len(events) != 1 || events[0].Name != "exception" {
+		t.Errorf("git.push events = %v, want one exception event", events)
+	}
+	if byName["git.clone"].Status().Code == codes.Error {
+		t.Error("git.clone status = Error, want unset")
+	}
+}
+
+func TestParseTraceID(t *testing.T) {
+	tests := []struct {
+		id string
+		ok bool
+	}{
+		{"4f1c2a9e-7b3d-4e8f-9a6b-1c2d3e4f5a6b", true},
+		{"", false},
+		{"not-a-uuid", false},
+		{"00000000-0000-0000-0000-000000000000", false},
+	}
+
+	for _, tt := range tests {
+		if _, ok := parseTraceID(tt.id); ok != tt.ok {
+			t.Errorf("parseTraceID(%q) ok = %v, want %v", tt.id, ok, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package tokensource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	rediskeys "github.com/repobox/runner/internal/redis"
+	"github.com/repobox/runner/internal/secrets"
+)
+
+// Redis reads the token the web app stores encrypted in the provider hash
+// (git_provider:{user}:{provider}, field "token")
+type Redis struct {
+	rdb       redis.UniversalClient
+	decryptor secrets.Decryptor
+}
+
+// NewRedis creates the default, Redis-backed source
+func NewRedis(rdb redis.UniversalClient, decryptor secrets.Decryptor) *Redis {
+	return &Redis{rdb: rdb, decryptor: decryptor}
+}
+
+// Get fetches and decrypts the provider's token
+func (s *Redis) Get(ctx context.Context, userID, providerID string) (string, error) {
+	encrypted, err := s.rdb.HGet(ctx, rediskeys.GitProviderKey(userID, providerID), "token").Result()
+	if errors.Is(err, redis.Nil) {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, providerID)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	token, err := s.decryptor.Decrypt(encrypted)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt token: %w", err)
+	}
+	return token, nil
+}
@@ -0,0 +1,45 @@
+// Package tokensource fetches git provider access tokens from where the
+// deployment keeps them: the provider hash in Redis or an external secrets manager
+package tokensource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/config"
+	"github.com/repobox/runner/internal/secrets"
+)
+
+// Kinds for TOKEN_SOURCE
+const (
+	KindRedis = "redis"
+	KindVault = "vault"
+)
+
+// ErrNotFound is returned when no token is stored for the provider
+var ErrNotFound = errors.New("token not found for provider")
+
+// Source returns the plaintext access token of a user's git provider
+type Source interface {
+	Get(ctx context.Context, userID, providerID string) (string, error)
+}
+
+// New creates the source selected by TOKEN_SOURCE
+func New(rdb redis.UniversalClient, cfg *config.Config, decryptor secrets.Decryptor) (Source, error) {
+	switch cfg.TokenSource {
+	case "", KindRedis:
+		return NewRedis(rdb, decryptor), nil
+	case KindVault:
+		return NewVault(VaultOptions{
+			Addr:         cfg.VaultAddr,
+			Token:        cfg.VaultToken,
+			Namespace:    cfg.VaultNamespace,
+			PathTemplate: cfg.VaultTokenPath,
+			Field:        cfg.VaultTokenField,
+		})
+	default:
+		return nil, fmt.Errorf("unknown token source %q", cfg.TokenSource)
+	}
+}
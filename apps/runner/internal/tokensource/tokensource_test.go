@@ -0,0 +1,100 @@
+package tokensource
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/repobox/runner/internal/config"
+	rediskeys "github.com/repobox/runner/internal/redis"
+)
+
+// fakeDecryptor "decrypts" values of the form enc:<plaintext>
+type fakeDecryptor struct{}
+
+func (fakeDecryptor) Decrypt(encrypted string) (string, error) {
+	plain, ok := strings.CutPrefix(encrypted, "enc:")
+	if !ok {
+		return "", errors.New("not encrypted")
+	}
+	return plain, nil
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		want    string
+		wantErr bool
+	}{
+		{"default", config.Config{}, "*tokensource.Redis", false},
+		{"redis", config.Config{TokenSource: KindRedis}, "*tokensource.Redis", false},
+		{"vault", config.Config{TokenSource: KindVault, VaultAddr: "https://vault:8200", VaultToken: "s.x"}, "*tokensource.Vault", false},
+		{"vault unconfigured", config.Config{TokenSource: KindVault}, "", true},
+		{"unknown", config.Config{TokenSource: "aws"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := New(nil, &tt.cfg, fakeDecryptor{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var got string
+			switch src.(type) {
+			case *Redis:
+				got = "*tokensource.Redis"
+			case *Vault:
+				got = "*tokensource.Vault"
+			}
+			if got != tt.want {
+				t.Errorf("New() = %T, want %s", src, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedis_Get(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	ctx := context.Background()
+
+	rdb.HSet(ctx, rediskeys.GitProviderKey("user-1", "prov-1"), "type", "github", "token", "enc:ghp_secret")
+	rdb.HSet(ctx, rediskeys.GitProviderKey("user-1", "prov-2"), "type", "github")
+	rdb.HSet(ctx, rediskeys.GitProviderKey("user-1", "prov-3"), "token", "plaintext")
+
+	tests := []struct {
+		name       string
+		providerID string
+		want       string
+		wantErr    error
+	}{
+		{"stored token", "prov-1", "ghp_secret", nil},
+		{"no token field", "prov-2", "", ErrNotFound},
+		{"no provider", "prov-missing", "", ErrNotFound},
+		{"undecryptable", "prov-3", "", nil},
+	}
+
+	src := NewRedis(rdb, fakeDecryptor{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := src.Get(ctx, "user-1", tt.providerID)
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Get() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.want == "" && err == nil {
+				t.Fatalf("Get() = %q, want an error", got)
+			}
+			if got != tt.want {
+				t.Errorf("Get() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
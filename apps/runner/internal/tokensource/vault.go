@@ -0,0 +1,116 @@
+package tokensource
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/repobox/runner/internal/cacerts"
+)
+
+// DefaultVaultTokenPath is the secret path of a provider token in a KV v2 mount named secret
+const DefaultVaultTokenPath = "secret/data/repobox/{user_id}/{provider_id}"
+
+// VaultOptions configure the Vault source
+type VaultOptions struct {
+	Addr         string // Vault address, e.g. https://vault.example.com:8200
+	Token        string // Vault token with read access to the paths
+	Namespace    string // Optional Vault Enterprise namespace
+	PathTemplate string // Secret path, {user_id} and {provider_id} are replaced
+	Field        string // Field of the secret holding the token
+}
+
+// Vault reads provider tokens from a HashiCorp Vault KV secret per provider.
+// Both KV v1 and v2 mounts are supported; for v2 the path includes data/.
+type Vault struct {
+	opts       VaultOptions
+	httpClient *http.Client
+}
+
+// NewVault creates a Vault source
+func NewVault(opts VaultOptions) (*Vault, error) {
+	if opts.Addr == "" || opts.Token == "" {
+		return nil, errors.New("vault token source requires VAULT_ADDR and VAULT_TOKEN")
+	}
+	if opts.PathTemplate == "" {
+		opts.PathTemplate = DefaultVaultTokenPath
+	}
+	if opts.Field == "" {
+		opts.Field = "token"
+	}
+	return &Vault{
+		opts: opts,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: cacerts.TLSConfig(),
+			},
+		},
+	}, nil
+}
+
+// Get reads the provider's token with GET /v1/{path}
+func (s *Vault) Get(ctx context.Context, userID, providerID string) (string, error) {
+	path := strings.NewReplacer(
+		"{user_id}", url.PathEscape(userID),
+		"{provider_id}", url.PathEscape(providerID),
+	).Replace(strings.Trim(s.opts.PathTemplate, "/"))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(s.opts.Addr, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", s.opts.Token)
+	if s.opts.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.opts.Namespace)
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read vault response: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", fmt.Errorf("%w: %s", ErrNotFound, providerID)
+	default:
+		// Vault error bodies don't contain secrets
+		var errResp struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.Unmarshal(body, &errResp)
+		return "", fmt.Errorf("vault error (status %d): %s", resp.StatusCode, strings.Join(errResp.Errors, "; "))
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return "", fmt.Errorf("failed to parse vault response: %w", err)
+	}
+
+	// KV v2 nests the secret under data.data
+	data := secret.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+	token, _ := data[s.opts.Field].(string)
+	if token == "" {
+		return "", fmt.Errorf("%w: %s (field %s missing at %s)", ErrNotFound, providerID, s.opts.Field, path)
+	}
+	return token, nil
+}
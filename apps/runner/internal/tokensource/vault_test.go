@@ -0,0 +1,125 @@
+package tokensource
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVault_Get(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     VaultOptions
+		status   int
+		body     string
+		wantPath string
+		want     string
+		wantErr  error
+	}{
+		{
+			name:     "kv v2",
+			status:   http.StatusOK,
+			body:     `{"data": {"data": {"token": "ghp_v2"}, "metadata": {"version": 3}}}`,
+			wantPath: "/v1/secret/data/repobox/user-1/prov-1",
+			want:     "ghp_v2",
+		},
+		{
+			name:     "kv v1 with custom path and field",
+			opts:     VaultOptions{PathTemplate: "/kv/git/{provider_id}/", Field: "pat"},
+			status:   http.StatusOK,
+			body:     `{"data": {"pat": "glpat_v1"}}`,
+			wantPath: "/v1/kv/git/prov-1",
+			want:     "glpat_v1",
+		},
+		{
+			name:     "secret missing",
+			status:   http.StatusNotFound,
+			body:     `{"errors": []}`,
+			wantPath: "/v1/secret/data/repobox/user-1/prov-1",
+			wantErr:  ErrNotFound,
+		},
+		{
+			name:     "field missing",
+			status:   http.StatusOK,
+			body:     `{"data": {"data": {"other": "x"}}}`,
+			wantPath: "/v1/secret/data/repobox/user-1/prov-1",
+			wantErr:  ErrNotFound,
+		},
+		{
+			name:     "permission denied",
+			status:   http.StatusForbidden,
+			body:     `{"errors": ["permission denied"]}`,
+			wantPath: "/v1/secret/data/repobox/user-1/prov-1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				if r.Header.Get("X-Vault-Token") != "s.token" {
+					t.Errorf("X-Vault-Token = %q", r.Header.Get("X-Vault-Token"))
+				}
+				if r.Header.Get("X-Vault-Namespace") != "team" {
+					t.Errorf("X-Vault-Namespace = %q, want team", r.Header.Get("X-Vault-Namespace"))
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			opts := tt.opts
+			opts.Addr, opts.Token, opts.Namespace = srv.URL+"/", "s.token", "team"
+			src, err := NewVault(opts)
+			if err != nil {
+				t.Fatalf("NewVault() error = %v", err)
+			}
+
+			got, err := src.Get(context.Background(), "user-1", "prov-1")
+			if gotPath != tt.wantPath {
+				t.Errorf("path = %q, want %q", gotPath, tt.wantPath)
+			}
+			switch {
+			case tt.want != "":
+				if err != nil || got != tt.want {
+					t.Errorf("Get() = %q, %v, want %q", got, err, tt.want)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Get() error = %v, want %v", err, tt.wantErr)
+				}
+			default:
+				if err == nil {
+					t.Errorf("Get() = %q, want an error", got)
+				}
+			}
+		})
+	}
+}
+
+func TestVault_PathEscaping(t *testing.T) {
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.RawPath
+		if gotPath == "" {
+			gotPath = r.URL.Path
+		}
+		w.Write([]byte(`{"data": {"data": {"token": "t"}}}`))
+	}))
+	defer srv.Close()
+
+	src, err := NewVault(VaultOptions{Addr: srv.URL, Token: "s.token"})
+	if err != nil {
+		t.Fatalf("NewVault() error = %v", err)
+	}
+	// IDs can't climb out of the templated path
+	if _, err := src.Get(context.Background(), "../admin", "p/1"); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if want := "/v1/secret/data/repobox/..%2Fadmin/p%2F1"; gotPath != want {
+		t.Errorf("path = %q, want %q", gotPath, want)
+	}
+}
@@ -0,0 +1,75 @@
+package topics
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/repobox/runner/internal/providerapi"
+)
+
+// Client fetches repository topics from the GitHub/GitLab API
+type Client struct {
+	api *providerapi.Client
+}
+
+// NewClient creates a new topics client
+func NewClient() *Client {
+	return &Client{api: providerapi.NewClient()}
+}
+
+// Fetch returns the topics of a repository
+// providerType is "github" or "gitlab", projectID is "owner/repo" or "group/project"
+func (c *Client) Fetch(ctx context.Context, providerType, baseURL, token, projectID string) ([]string, error) {
+	switch providerType {
+	case "github":
+		return c.fetchGitHub(ctx, baseURL, token, projectID)
+	case "gitlab":
+		return c.fetchGitLab(ctx, baseURL, token, projectID)
+	default:
+		return nil, fmt.Errorf("unknown provider type: %s", providerType)
+	}
+}
+
+func (c *Client) fetchGitHub(ctx context.Context, baseURL, token, projectID string) ([]string, error) {
+	var resp struct {
+		Names []string `json:"names"`
+	}
+	apiURL := providerapi.GitHubURL(baseURL, fmt.Sprintf("/repos/%s/topics", projectID))
+	if err := c.api.GetJSON(ctx, apiURL, providerapi.GitHubHeaders(token), &resp); err != nil {
+		return nil, fmt.Errorf("GitHub topics: %w", err)
+	}
+	return resp.Names, nil
+}
+
+func (c *Client) fetchGitLab(ctx context.Context, baseURL, token, projectID string) ([]string, error) {
+	var resp struct {
+		Topics  []string `json:"topics"`
+		TagList []string `json:"tag_list"` // GitLab < 14.0
+	}
+	apiURL := providerapi.GitLabURL(baseURL, "/projects/"+url.PathEscape(projectID))
+	if err := c.api.GetJSON(ctx, apiURL, providerapi.GitLabHeaders(token), &resp); err != nil {
+		return nil, fmt.Errorf("GitLab topics: %w", err)
+	}
+	if len(resp.Topics) == 0 {
+		return resp.TagList, nil
+	}
+	return resp.Topics, nil
+}
+
+// SelectEnvironment returns the environment mapped to the first repository topic
+// that has a mapping, or "" if none matches. Topics are compared case-insensitively.
+func SelectEnvironment(topics []string, mapping map[string]string) string {
+	for _, topic := range topics {
+		if env, ok := mapping[strings.ToLower(strings.TrimSpace(topic))]; ok && env != "" {
+			return env
+		}
+	}
+	return ""
+}
+
+// IsAutoEnvironment reports whether the requested environment leaves the choice to the runner
+func IsAutoEnvironment(env string) bool {
+	return env == "" || env == "default"
+}
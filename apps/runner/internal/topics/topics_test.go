@@ -0,0 +1,86 @@
+package topics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/repos/owner/repo/topics":
+			if r.Header.Get("Authorization") != "Bearer gh-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"names": ["python", "django"]}`))
+		case "/api/v4/projects/group/app":
+			if r.Header.Get("PRIVATE-TOKEN") != "gl-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"id": 1, "topics": ["laravel", "php"]}`))
+		case "/api/v4/projects/group/legacy":
+			w.Write([]byte(`{"id": 2, "tag_list": ["node"]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "Not Found"}`))
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name      string
+		provider  string
+		token     string
+		projectID string
+		want      []string
+		wantErr   bool
+	}{
+		{"github", "github", "gh-token", "owner/repo", []string{"python", "django"}, false},
+		{"gitlab", "gitlab", "gl-token", "group/app", []string{"laravel", "php"}, false},
+		{"gitlab tag_list", "gitlab", "gl-token", "group/legacy", []string{"node"}, false},
+		{"bad token", "github", "wrong", "owner/repo", nil, true},
+		{"not found", "github", "gh-token", "owner/missing", nil, true},
+		{"unknown provider", "bitbucket", "token", "owner/repo", nil, true},
+	}
+
+	c := NewClient()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Fetch(context.Background(), tt.provider, srv.URL, tt.token, tt.projectID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fetch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Fetch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectEnvironment(t *testing.T) {
+	mapping := map[string]string{"python": "python", "laravel": "php", "php": "php", "typescript": "nodejs-full"}
+
+	tests := []struct {
+		name   string
+		topics []string
+		want   string
+	}{
+		{"first mapped topic wins", []string{"django", "python", "php"}, "python"},
+		{"case insensitive", []string{"Laravel"}, "php"},
+		{"no mapped topic", []string{"rust", "cli"}, ""},
+		{"no topics", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SelectEnvironment(tt.topics, mapping); got != tt.want {
+				t.Errorf("SelectEnvironment(%v) = %q, want %q", tt.topics, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+// Package trace carries a correlation ID for one job or session task, so its
+// output entries, log lines and agent subprocess can be matched up.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+)
+
+type contextKey struct{}
+
+// NewID returns a random UUID (version 4)
+func NewID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// WithID returns a context carrying the trace ID
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// IDFromContext returns the trace ID of ctx, or "" if it has none
+func IDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
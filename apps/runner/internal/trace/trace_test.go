@@ -0,0 +1,31 @@
+package trace
+
+import (
+	"context"
+	"regexp"
+	"testing"
+)
+
+func TestNewID(t *testing.T) {
+	uuidV4 := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	a, b := NewID(), NewID()
+	if !uuidV4.MatchString(a) {
+		t.Errorf("NewID() = %q, want a UUID v4", a)
+	}
+	if a == b {
+		t.Errorf("NewID() returned %q twice", a)
+	}
+}
+
+func TestIDFromContext(t *testing.T) {
+	if got := IDFromContext(context.Background()); got != "" {
+		t.Errorf("IDFromContext(background) = %q, want empty", got)
+	}
+
+	ctx, cancel := context.WithCancel(WithID(context.Background(), "trace-1"))
+	defer cancel()
+	if got := IDFromContext(ctx); got != "trace-1" {
+		t.Errorf("IDFromContext(derived) = %q, want trace-1", got)
+	}
+}
@@ -1,5 +1,10 @@
 package util
 
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
 // SafePrefix returns the first n characters of a string, or the whole string if shorter.
 // This prevents panic from slice bounds out of range.
 func SafePrefix(s string, n int) string {
@@ -8,3 +13,31 @@ func SafePrefix(s string, n int) string {
 	}
 	return s[:n]
 }
+
+// TruncateMiddle shortens s to at most max characters (runes), replacing its
+// middle with a "…[N chars omitted]…" marker so both ends stay readable.
+// max <= 0 leaves s unchanged; a max too small for the marker keeps the start.
+func TruncateMiddle(s string, max int) string {
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+
+	// The marker's length depends on the count it names, so settle both
+	omitted := len(runes) - max
+	for {
+		marker := fmt.Sprintf("…[%d chars omitted]…", omitted)
+		keep := max - utf8.RuneCountInString(marker)
+		if keep <= 0 {
+			return string(runes[:max])
+		}
+		if len(runes)-keep == omitted {
+			head := (keep + 1) / 2
+			return string(runes[:head]) + marker + string(runes[len(runes)-(keep-head):])
+		}
+		omitted = len(runes) - keep
+	}
+}
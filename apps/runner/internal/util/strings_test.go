@@ -0,0 +1,40 @@
+package util
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateMiddle(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		max  int
+		want string
+	}{
+		{"short", "hello", 10, "hello"},
+		{"exactly max", "0123456789", 10, "0123456789"},
+		{"no limit", strings.Repeat("x", 100), 0, strings.Repeat("x", 100)},
+		{"one over", strings.Repeat("a", 30) + strings.Repeat("b", 11), 40, strings.Repeat("a", 10) + "…[21 chars omitted]…" + strings.Repeat("b", 10)},
+		{"oversized", strings.Repeat("a", 500) + strings.Repeat("b", 500), 40, strings.Repeat("a", 10) + "…[981 chars omitted]…" + strings.Repeat("b", 9)},
+		{"multibyte within max", "žluťoučký kůň", 13, "žluťoučký kůň"},
+		{"multibyte", strings.Repeat("ž", 50) + strings.Repeat("ř", 50), 40, strings.Repeat("ž", 10) + "…[80 chars omitted]…" + strings.Repeat("ř", 10)},
+		{"max below marker length", strings.Repeat("x", 100), 5, "xxxxx"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := TruncateMiddle(tt.s, tt.max)
+			if got != tt.want {
+				t.Errorf("TruncateMiddle() = %q, want %q", got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("TruncateMiddle() = %q is not valid UTF-8", got)
+			}
+			if tt.max > 0 && utf8.RuneCountInString(got) > tt.max {
+				t.Errorf("TruncateMiddle() has %d characters, want at most %d", utf8.RuneCountInString(got), tt.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package version
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+func TestInfo_String(t *testing.T) {
+	tests := []struct {
+		name string
+		info Info
+		want string
+	}{
+		{
+			name: "release build",
+			info: Info{Version: "v1.4.0", Commit: "3fe1413", BuildDate: "2024-05-01T12:00:00Z", GoVersion: "go1.23.4"},
+			want: "runner v1.4.0 (commit 3fe1413, built 2024-05-01T12:00:00Z, go1.23.4)",
+		},
+		{
+			name: "local build",
+			info: Info{Version: "dev", Commit: "unknown", BuildDate: "unknown", GoVersion: "go1.23.4"},
+			want: "runner dev (commit unknown, built unknown, go1.23.4)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.info.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Handler(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var got Info
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if got.Version != Version || got.GoVersion != runtime.Version() {
+		t.Errorf("Handler() = %+v, want version %q and go %q", got, Version, runtime.Version())
+	}
+
+	rec = httptest.NewRecorder()
+	Handler(rec, httptest.NewRequest(http.MethodPost, "/version", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -6,17 +6,33 @@ import (
 	"log/slog"
 	"sync"
 
+	"github.com/repobox/runner/internal/activity"
 	"github.com/repobox/runner/internal/job"
 )
 
 // ErrPoolStopped is returned when submitting to a stopped pool
 var ErrPoolStopped = errors.New("worker pool is stopped")
 
+// ErrPoolFull is returned by TrySubmit when the job queue has no room
+var ErrPoolFull = errors.New("worker pool is full")
+
+// ActionRetryPush re-pushes the branch kept from a job whose push failed
+const ActionRetryPush = "retry_push"
+
 // JobMessage represents a job from Redis stream
 type JobMessage struct {
-	StreamID   string   // Redis stream message ID for ACK
-	Job        *job.Job // Parsed job data
-	ProviderID string   // For fetching token
+	StreamID       string            // Redis stream message ID for ACK
+	Stream         string            // Stream (priority lane) the message came from
+	Job            *job.Job          // Parsed job data
+	ProviderID     string            // For fetching token
+	RequiredLabels map[string]string // Runner labels required to run this job
+	Action         string            // Empty for a normal run, ActionRetryPush to retry a failed push
+	WorkdirRunner  string            // Runner holding the kept work dir (retry-push only)
+	Ref            string            // Commit SHA, tag or branch to work from instead of the default branch HEAD
+	WorkSubdir     string            // Repository subdirectory the agent runs in, empty for the root
+	UserName       string            // Requesting user's name, credited as commit author
+	UserEmail      string            // Requesting user's email, credited as commit author
+	Secrets        []string          // Names of the user's secrets to inject into the agent's environment
 }
 
 // JobHandler processes a single job
@@ -31,6 +47,8 @@ type Pool struct {
 	logger  *slog.Logger
 	mu      sync.RWMutex
 	stopped bool
+
+	activity *activity.Registry
 }
 
 // NewPool creates a new worker pool
@@ -40,6 +58,8 @@ func NewPool(size int, handler JobHandler, logger *slog.Logger) *Pool {
 		jobs:    make(chan *JobMessage, size*2), // Buffer for smooth flow
 		handler: handler,
 		logger:  logger,
+
+		activity: activity.NewRegistry(),
 	}
 }
 
@@ -63,6 +83,22 @@ func (p *Pool) Submit(msg *JobMessage) error {
 	return nil
 }
 
+// TrySubmit adds a job to the queue without blocking. Returns ErrPoolFull if
+// the queue has no room, ErrPoolStopped if pool is stopped.
+func (p *Pool) TrySubmit(msg *JobMessage) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.stopped {
+		return ErrPoolStopped
+	}
+	select {
+	case p.jobs <- msg:
+		return nil
+	default:
+		return ErrPoolFull
+	}
+}
+
 // Stop gracefully shuts down the pool
 func (p *Pool) Stop() {
 	p.mu.Lock()
@@ -107,6 +143,13 @@ func (p *Pool) processJob(ctx context.Context, logger *slog.Logger, msg *JobMess
 	jobLogger := logger.With("job_id", msg.Job.ID, "user_id", msg.Job.UserID)
 	jobLogger.Info("processing job")
 
+	kind := msg.Action
+	if kind == "" {
+		kind = "run"
+	}
+	ctx, done := p.activity.Start(ctx, activity.Entry{ID: msg.Job.ID, Kind: kind, UserID: msg.Job.UserID})
+	defer done()
+
 	if err := p.handler(ctx, msg); err != nil {
 		jobLogger.Error("job failed", "error", err)
 	} else {
@@ -123,3 +166,8 @@ func (p *Pool) JobsChannel() chan<- *JobMessage {
 func (p *Pool) QueueSize() int {
 	return len(p.jobs)
 }
+
+// Activity returns the registry of the jobs the workers are processing
+func (p *Pool) Activity() *activity.Registry {
+	return p.activity
+}
@@ -0,0 +1,71 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/repobox/runner/internal/job"
+)
+
+func newTestPool(size int) *Pool {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewPool(size, func(ctx context.Context, msg *JobMessage) error { return nil }, logger)
+}
+
+func TestTrySubmit_Full(t *testing.T) {
+	// Pool is never started, submitted jobs stay queued
+	p := newTestPool(1)
+	msg := &JobMessage{Job: &job.Job{ID: "job-1"}}
+
+	for i := 0; i < 2; i++ {
+		if err := p.TrySubmit(msg); err != nil {
+			t.Fatalf("TrySubmit() #%d error = %v", i+1, err)
+		}
+	}
+	if err := p.TrySubmit(msg); !errors.Is(err, ErrPoolFull) {
+		t.Errorf("TrySubmit() on a full pool error = %v, want ErrPoolFull", err)
+	}
+	if got := p.QueueSize(); got != 2 {
+		t.Errorf("QueueSize() = %d, want 2", got)
+	}
+}
+
+func TestTrySubmit_Stopped(t *testing.T) {
+	p := newTestPool(1)
+	p.Stop()
+
+	if err := p.TrySubmit(&JobMessage{Job: &job.Job{ID: "job-1"}}); !errors.Is(err, ErrPoolStopped) {
+		t.Errorf("TrySubmit() on a stopped pool error = %v, want ErrPoolStopped", err)
+	}
+}
+
+func TestPool_Activity(t *testing.T) {
+	running := make(chan struct{})
+	release := make(chan struct{})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	p := NewPool(1, func(ctx context.Context, msg *JobMessage) error {
+		close(running)
+		<-release
+		return nil
+	}, logger)
+	p.Start(context.Background())
+
+	if err := p.Submit(&JobMessage{Job: &job.Job{ID: "job-1", UserID: "user-1"}, Action: ActionRetryPush}); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	<-running
+
+	list := p.Activity().List()
+	if len(list) != 1 || list[0].ID != "job-1" || list[0].UserID != "user-1" || list[0].Kind != ActionRetryPush {
+		t.Errorf("Activity() while running = %+v, want job-1 of user-1 retrying its push", list)
+	}
+
+	close(release)
+	p.Stop()
+	if list := p.Activity().List(); len(list) != 0 {
+		t.Errorf("Activity() after the job = %+v, want empty", list)
+	}
+}
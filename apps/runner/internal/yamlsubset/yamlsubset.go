@@ -0,0 +1,112 @@
+package yamlsubset
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Value is a parsed top-level value: a scalar or a list
+type Value struct {
+	Scalar string
+	List   []string
+	IsList bool
+}
+
+// String returns the scalar value of key, or an error if it is a list
+func (v Value) String(key string) (string, error) {
+	if v.IsList {
+		return "", fmt.Errorf("%s must be a string", key)
+	}
+	return v.Scalar, nil
+}
+
+// Parse parses the small YAML subset of the runner's settings files: top-level
+// "key: value" scalars and string lists, either as "- item" lines or inline
+// "[a, b]". Values may be quoted; nested values are not supported.
+func Parse(s string) (map[string]Value, error) {
+	values := make(map[string]Value)
+	var listKey string
+
+	for i, raw := range strings.Split(s, "\n") {
+		lineNo := i + 1
+		line := strings.TrimRight(stripComment(raw), " \t\r")
+		if strings.TrimSpace(line) == "" || line == "---" {
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			if listKey == "" {
+				return nil, fmt.Errorf("line %d: list item without a key", lineNo)
+			}
+			v := values[listKey]
+			v.List = append(v.List, unquote(strings.TrimSpace(strings.TrimPrefix(trimmed, "-"))))
+			values[listKey] = v
+			continue
+		}
+
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("line %d: nested values are not supported", lineNo)
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", lineNo)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if _, dup := values[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", lineNo, key)
+		}
+
+		switch {
+		case value == "":
+			// Block list follows
+			values[key] = Value{IsList: true}
+			listKey = key
+		case strings.HasPrefix(value, "["):
+			if !strings.HasSuffix(value, "]") {
+				return nil, fmt.Errorf("line %d: unterminated list", lineNo)
+			}
+			v := Value{IsList: true}
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				if item = unquote(strings.TrimSpace(item)); item != "" {
+					v.List = append(v.List, item)
+				}
+			}
+			values[key] = v
+			listKey = ""
+		default:
+			values[key] = Value{Scalar: unquote(value)}
+			listKey = ""
+		}
+	}
+
+	return values, nil
+}
+
+// stripComment removes a trailing "# comment" that is not inside quotes
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// unquote removes matching surrounding single or double quotes
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,56 @@
+package yamlsubset
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]Value
+		wantErr string
+	}{
+		{
+			"scalars",
+			"---\nname: repobox # comment\nquoted: \"a # b\"\nsingle: 'x'\n",
+			map[string]Value{"name": {Scalar: "repobox"}, "quoted": {Scalar: "a # b"}, "single": {Scalar: "x"}},
+			"",
+		},
+		{
+			"lists",
+			"block:\n  - a\n  - \"b\"\ninline: [c, 'd']\nempty:\n",
+			map[string]Value{
+				"block":  {List: []string{"a", "b"}, IsList: true},
+				"inline": {List: []string{"c", "d"}, IsList: true},
+				"empty":  {IsList: true},
+			},
+			"",
+		},
+		{"nested", "redis:\n  url: x\n", nil, "line 2: nested values"},
+		{"item without key", "- a\n", nil, "line 1: list item without a key"},
+		{"missing colon", "name repobox\n", nil, "line 1: expected"},
+		{"duplicate", "a: 1\na: 2\n", nil, "line 2: duplicate key"},
+		{"unterminated list", "a: [b, c\n", nil, "line 1: unterminated list"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -56,7 +56,7 @@ export async function POST(request: NextRequest) {
 
   try {
     const body = await request.json();
-    const { providerId, repoUrl, repoName, branch, environment, prompt } = body;
+    const { providerId, repoUrl, repoName, branch, environment, prompt, priority, workSubdir } = body;
 
     // Validate required fields
     if (!providerId || !repoUrl || !repoName || !prompt) {
@@ -66,6 +66,20 @@ export async function POST(request: NextRequest) {
       );
     }
 
+    if (priority !== undefined && priority !== "high" && priority !== "normal") {
+      return NextResponse.json(
+        { error: "Priority must be \"high\" or \"normal\"" },
+        { status: 400 }
+      );
+    }
+
+    if (workSubdir !== undefined && typeof workSubdir !== "string") {
+      return NextResponse.json(
+        { error: "workSubdir must be a string" },
+        { status: 400 }
+      );
+    }
+
     // Verify provider ownership
     const provider = await getGitProvider(session.user.id, providerId);
     if (!provider) {
@@ -105,6 +119,8 @@ export async function POST(request: NextRequest) {
       repoUrl: job.repoUrl,
       prompt: job.prompt,
       environment: job.environment,
+      priority,
+      workSubdir,
     });
 
     return NextResponse.json(job, { status: 201 });
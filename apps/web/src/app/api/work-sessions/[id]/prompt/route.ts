@@ -27,7 +27,7 @@ export async function POST(request: NextRequest, { params }: RouteParams) {
 
   try {
     const body = await request.json();
-    const { prompt, environment } = body;
+    const { prompt, environment, workSubdir } = body;
 
     // Validate required fields
     if (!prompt) {
@@ -37,6 +37,13 @@ export async function POST(request: NextRequest, { params }: RouteParams) {
       );
     }
 
+    if (workSubdir !== undefined && typeof workSubdir !== "string") {
+      return NextResponse.json(
+        { error: "workSubdir must be a string" },
+        { status: 400 }
+      );
+    }
+
     const workSession = await getWorkSession(sessionId);
 
     if (!workSession) {
@@ -98,6 +105,7 @@ export async function POST(request: NextRequest, { params }: RouteParams) {
       userId: session.user.id,
       prompt,
       environment: environment || "default",
+      workSubdir,
     });
 
     return NextResponse.json(job, { status: 201 });
@@ -147,6 +147,12 @@ function parseOutput(lines: JobOutput[]): ParsedOutput {
       continue;
     }
 
+    // Validation command output belongs with the runner lines, not the agent's answer
+    if (line.source === "validate") {
+      internalLines.push(text);
+      continue;
+    }
+
     // Stderr from Claude CLI goes to error lines
     if (line.stream === "stderr") {
       errorLines.push(text);
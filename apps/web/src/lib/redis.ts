@@ -1,6 +1,8 @@
 import Redis, { type RedisOptions } from "ioredis";
 
 const redisOptions: RedisOptions = {
+  // Namespaces every key; must match the runners' REDIS_KEY_PREFIX
+  keyPrefix: process.env.REDIS_KEY_PREFIX || "",
   maxRetriesPerRequest: 3,
   lazyConnect: true,
   retryStrategy: (times: number): number => {
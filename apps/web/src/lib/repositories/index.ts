@@ -48,4 +48,5 @@ export {
   ensureConsumerGroup,
   getPendingJobs,
   type JobStreamMessage,
+  type JobPriority,
 } from "./job";
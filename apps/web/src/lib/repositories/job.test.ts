@@ -371,7 +371,7 @@ describe("JobRepository", () => {
 
         expect(result).toBe("1700000000000-0");
         expect(xadd).toHaveBeenCalledWith(
-          "jobs:stream",
+          "jobs:{queue}:stream",
           "*",
           "job_id",
           "job-123",
@@ -387,6 +387,22 @@ describe("JobRepository", () => {
           "default"
         );
       });
+
+      it("adds high priority job to the high stream", async () => {
+        xadd.mockResolvedValue("1700000000000-1");
+
+        await enqueueJob({
+          jobId: "job-123",
+          userId: "user-456",
+          providerId: "provider-789",
+          repoUrl: "https://github.com/test/repo",
+          prompt: "Fix the bug",
+          environment: "default",
+          priority: "high",
+        });
+
+        expect(xadd.mock.calls[0][0]).toBe("jobs:{queue}:stream:high");
+      });
     });
 
     describe("ensureConsumerGroup", () => {
@@ -397,7 +413,14 @@ describe("JobRepository", () => {
 
         expect(xgroup).toHaveBeenCalledWith(
           "CREATE",
-          "jobs:stream",
+          "jobs:{queue}:stream",
+          "jobs:stream:runners",
+          "0",
+          "MKSTREAM"
+        );
+        expect(xgroup).toHaveBeenCalledWith(
+          "CREATE",
+          "jobs:{queue}:stream:high",
           "jobs:stream:runners",
           "0",
           "MKSTREAM"
@@ -18,6 +18,7 @@ const JOB_SCHEMA: FieldSchema = {
   linesAdded: "number",
   linesRemoved: "number",
   errorMessage: "optional_string",
+  errorCode: "optional_string",
   createdAt: "number",
   startedAt: "optional_number",
   finishedAt: "optional_number",
@@ -218,6 +219,8 @@ export async function getJobOutputCount(jobId: string): Promise<number> {
 
 // --- Job Queue Stream ---
 
+export type JobPriority = "high" | "normal";
+
 export interface JobStreamMessage {
   jobId: string;
   userId: string;
@@ -225,19 +228,18 @@ export interface JobStreamMessage {
   repoUrl: string;
   prompt: string;
   environment: string;
+  priority?: JobPriority;
+  workSubdir?: string; // Repository subdirectory the agent runs in
 }
 
 /**
- * Adds a job to the job stream queue
+ * Adds a job to the job stream queue of its priority lane
  * Returns the stream message ID
  */
 export async function enqueueJob(message: JobStreamMessage): Promise<string> {
-  const streamKey = REDIS_KEYS.jobsStream;
+  const streamKey = message.priority === "high" ? REDIS_KEYS.jobsHighStream : REDIS_KEYS.jobsStream;
 
-  // XADD with * auto-generates message ID
-  const messageId = await redis.xadd(
-    streamKey,
-    "*",
+  const args: string[] = [
     "job_id",
     message.jobId,
     "user_id",
@@ -249,30 +251,38 @@ export async function enqueueJob(message: JobStreamMessage): Promise<string> {
     "prompt",
     message.prompt,
     "environment",
-    message.environment
-  );
+    message.environment,
+  ];
+
+  if (message.workSubdir) {
+    args.push("work_subdir", message.workSubdir);
+  }
+
+  // XADD with * auto-generates message ID
+  const messageId = await redis.xadd(streamKey, "*", ...args);
 
   return messageId as string;
 }
 
 /**
- * Creates consumer group if it doesn't exist
+ * Creates the consumer group on each priority lane if it doesn't exist
  * This should be called at application startup
  */
 export async function ensureConsumerGroup(): Promise<void> {
-  const streamKey = REDIS_KEYS.jobsStream;
   const groupName = REDIS_KEYS.jobsConsumerGroup;
 
-  try {
-    // Create stream with first entry if it doesn't exist
-    await redis.xgroup("CREATE", streamKey, groupName, "0", "MKSTREAM");
-    console.log("[job-stream] Consumer group created");
-  } catch (error) {
-    // Group already exists - this is expected
-    if (error instanceof Error && error.message.includes("BUSYGROUP")) {
-      return;
+  for (const streamKey of [REDIS_KEYS.jobsHighStream, REDIS_KEYS.jobsStream]) {
+    try {
+      // Create stream with first entry if it doesn't exist
+      await redis.xgroup("CREATE", streamKey, groupName, "0", "MKSTREAM");
+      console.log(`[job-stream] Consumer group created on ${streamKey}`);
+    } catch (error) {
+      // Group already exists - this is expected
+      if (error instanceof Error && error.message.includes("BUSYGROUP")) {
+        continue;
+      }
+      throw error;
     }
-    throw error;
   }
 }
 
@@ -1,6 +1,9 @@
 /**
  * Redis key patterns per SPEC.MD#Data-Model
  * Centralized key management for all Redis operations
+ *
+ * Keys are unprefixed here: the Redis client adds REDIS_KEY_PREFIX (ioredis
+ * keyPrefix), the runner adds the same prefix in its key builders
  */
 export const REDIS_KEYS = {
   // User keys
@@ -19,9 +22,13 @@ export const REDIS_KEYS = {
   jobOutput: (jobId: string) => `job:${jobId}:output`,
   userJobs: (userId: string) => `jobs:user:${userId}`,
 
-  // Job queue stream (legacy single-shot jobs)
-  jobsStream: "jobs:stream",
+  // Job queue stream (legacy single-shot jobs). The {queue} hash tag keeps
+  // the lanes and the delayed set in one Redis Cluster slot, the runner reads
+  // and moves jobs across them atomically
+  jobsStream: "jobs:{queue}:stream",
+  jobsHighStream: "jobs:{queue}:stream:high",
   jobsConsumerGroup: "jobs:stream:runners",
+  jobsDelayed: "jobs:{queue}:delayed",
 
   // Work Session keys (for iterative AI work on repositories)
   workSession: (sessionId: string) => `work_session:${sessionId}`,
@@ -36,6 +43,7 @@ export const REDIS_KEYS = {
   workSessionsJobsConsumerGroup: "work_sessions:jobs:runners",
   workSessionsPushStream: "work_sessions:push:stream",
   workSessionsPushConsumerGroup: "work_sessions:push:runners",
+  workSessionsAwaitingApproval: "work_sessions:awaiting_approval",
 } as const;
 
 // TTL values in seconds
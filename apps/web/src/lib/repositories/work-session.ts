@@ -15,6 +15,7 @@ const WORK_SESSION_SCHEMA: FieldSchema = {
   mrUrl: "optional_string",
   mrWarning: "optional_string",
   errorMessage: "optional_string",
+  errorCode: "optional_string",
   lastJobStatus: "optional_string",
   totalLinesAdded: "number",
   totalLinesRemoved: "number",
@@ -268,6 +269,8 @@ export interface WorkSessionJobMessage {
   userId: string;
   prompt: string;
   environment: string;
+  workSubdir?: string; // Repository subdirectory the agent runs in
+  amend?: boolean; // Fold the changes into the session's last unpushed commit
 }
 
 export interface WorkSessionPushMessage {
@@ -275,6 +278,7 @@ export interface WorkSessionPushMessage {
   userId: string;
   title?: string;
   description?: string;
+  targetBranch?: string; // MR target, defaults to the session's base branch
 }
 
 /**
@@ -303,15 +307,22 @@ export async function enqueueWorkSessionInit(message: WorkSessionInitMessage): P
 export async function enqueueWorkSessionJob(message: WorkSessionJobMessage): Promise<string> {
   const streamKey = REDIS_KEYS.workSessionsJobsStream;
 
-  const messageId = await redis.xadd(
-    streamKey,
-    "*",
+  const args: string[] = [
     "session_id", message.sessionId,
     "job_id", message.jobId,
     "user_id", message.userId,
     "prompt", message.prompt,
-    "environment", message.environment
-  );
+    "environment", message.environment,
+  ];
+
+  if (message.workSubdir) {
+    args.push("work_subdir", message.workSubdir);
+  }
+  if (message.amend) {
+    args.push("amend", "true");
+  }
+
+  const messageId = await redis.xadd(streamKey, "*", ...args);
 
   return messageId as string;
 }
@@ -333,6 +344,9 @@ export async function enqueueWorkSessionPush(message: WorkSessionPushMessage): P
   if (message.description) {
     args.push("description", message.description);
   }
+  if (message.targetBranch) {
+    args.push("target_branch", message.targetBranch);
+  }
 
   const messageId = await redis.xadd(streamKey, "*", ...args);
 
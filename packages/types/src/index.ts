@@ -21,6 +21,7 @@ export type WorkSessionStatus =
   | "initializing"
   | "ready"
   | "running"
+  | "awaiting_approval" // Push held until approved (APPROVAL_REQUIRED)
   | "pushed"
   | "archived"
   | "failed";
@@ -37,6 +38,7 @@ export interface WorkSession {
   mrUrl?: string;
   mrWarning?: string;
   errorMessage?: string;
+  errorCode?: ErrorCode;
   lastJobStatus?: JobStatus; // Status of the last executed job
   totalLinesAdded: number;
   totalLinesRemoved: number;
@@ -45,10 +47,12 @@ export interface WorkSession {
   createdAt: number;
   pushedAt?: number;
   prompts?: string[]; // Prompts submitted in this session
+  hasConflicts?: boolean; // Work branch conflicts with the MR target, checked at push
+  conflictFiles?: string; // Conflicting paths, one per line
 }
 
 // Git Provider types
-export type GitProviderType = "gitlab" | "github";
+export type GitProviderType = "gitlab" | "github" | "azure";
 
 export interface GitProvider {
   id: string;
@@ -78,6 +82,30 @@ export type JobStatus =
   | "failed"
   | "cancelled";
 
+// Failure classification set by the runner alongside errorMessage
+export type ErrorCode =
+  | "internal"
+  | "workdir_failed"
+  | "work_subdir_invalid"
+  | "provider_failed"
+  | "auth_failed"
+  | "clone_failed"
+  | "branch_failed"
+  | "branch_forbidden"
+  | "agent_failed"
+  | "agent_timeout"
+  | "repo_config_invalid"
+  | "protected_path"
+  | "validation_failed"
+  | "commit_failed"
+  | "push_failed"
+  | "mr_failed"
+  | "command_denied"
+  | "prompt_too_long"
+  | "secret_unavailable"
+  | "approval_timeout"
+  | "approval_rejected";
+
 export interface Job {
   id: string;
   userId: string;
@@ -86,28 +114,38 @@ export interface Job {
   repoUrl: string;
   repoName: string;
   branch: string;
+  ref?: string; // Commit SHA, tag or branch to work from instead of the default branch HEAD
   prompt: string;
   environment: string;
   status: JobStatus;
+  queuePosition?: number; // Best-effort estimate while deferred by the per-user limit
   mrUrl?: string;
   mrWarning?: string;
   linesAdded: number;
   linesRemoved: number;
+  filesChanged?: number; // Binary files included
+  filesAdded?: number;
+  filesDeleted?: number;
+  filesRenamed?: number;
+  hasConflicts?: boolean; // Pushed branch conflicts with the default branch
+  conflictFiles?: string; // Conflicting paths, one per line
   errorMessage?: string;
+  errorCode?: ErrorCode;
   createdAt: number;
   startedAt?: number;
   finishedAt?: number;
 }
 
-export type JobOutputSource = "runner" | "claude";
+export type JobOutputSource = "runner" | "claude" | "prompt" | "heartbeat" | "thinking" | "validate";
 
 // Claude stream-json event types
 export type ClaudeEventType = "system" | "assistant" | "user" | "result";
-export type ContentBlockType = "text" | "tool_use" | "tool_result";
+export type ContentBlockType = "text" | "thinking" | "tool_use" | "tool_result";
 
 export interface ContentBlock {
   type: ContentBlockType;
   text?: string;                    // for "text" blocks
+  thinking?: string;                // for "thinking" blocks
   id?: string;                      // for "tool_use"
   name?: string;                    // for "tool_use" (Read, Edit, Bash, etc.)
   input?: Record<string, unknown>;  // for "tool_use"
@@ -131,9 +169,11 @@ export interface ClaudeMessage {
 
 export interface JobOutput {
   timestamp: number;
+  seq?: number;                     // Strictly increasing per output list, orders lines within a millisecond
   line: string;
   stream: "stdout" | "stderr";
   source?: JobOutputSource;         // Optional for backward compatibility
+  trace_id?: string;                // Correlates the entry with runner logs of the same job/session task
   claude?: ClaudeMessage;           // Structured data from stream-json (future use)
 }
 